@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+)
+
+func TestSendLicenseError(t *testing.T) {
+	tests := []struct {
+		err     error
+		status  int
+		message string
+	}{
+		{ErrLicenseNotFound, http.StatusUnauthorized, "Invalid license key"},
+		{ErrLicenseKeyChecksum, http.StatusBadRequest, "Invalid license key: checksum does not match, check it for typos"},
+		{ErrLicenseDeactivated, http.StatusForbidden, "License has been deactivated"},
+		{ErrLicenseRevoked, http.StatusForbidden, "License has been revoked"},
+		{ErrLicenseExpired, http.StatusForbidden, "License has expired"},
+		{fmt.Errorf("%w (3)", ErrMaxActivations), http.StatusForbidden, "Maximum activations reached"},
+		{fmt.Errorf("database error: %w", ErrLicenseDeactivated), http.StatusForbidden, "License has been deactivated"},
+		{fmt.Errorf("database error"), http.StatusInternalServerError, "Internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sendLicenseError(w, tt.err)
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+			if w.Code != tt.status || resp.Error != tt.message {
+				t.Fatalf("got %d %q, want %d %q", w.Code, resp.Error, tt.status, tt.message)
+			}
+		})
+	}
+}
+
+func TestActivationReportsSeatLimit(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	useTestSigningKey(t)
+	seedLicense(t, "LIC-SEATS", "openai-only", time.Now().AddDate(0, 1, 0)) // one device
+	if err := recordActivation(t.Context(), "LIC-SEATS", "hw-first-device"); err != nil {
+		t.Fatalf("recordActivation: %v", err)
+	}
+
+	w := postJSON(handleActivation("sk-test", false, &Config{}, nil), "/activate",
+		ActivationRequest{LicenseKey: "LIC-SEATS", HardwareID: "hw-second-device"})
+
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("response isn't JSON: %v", err)
+	}
+	if w.Code != http.StatusForbidden || resp.Error != "Maximum activations (1) reached" {
+		t.Fatalf("got %d %q, want 403 with the seat count", w.Code, resp.Error)
+	}
+}
+
+// activateWithKey posts an activation for hardwareID with idempotencyKey
+func activateWithKey(handler http.HandlerFunc, licenseID, hardwareID, idempotencyKey string) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(ActivationRequest{LicenseKey: licenseID, HardwareID: hardwareID})
+	r := httptest.NewRequest(http.MethodPost, "/activate", bytes.NewReader(encoded))
+	r.Header.Set("Idempotency-Key", idempotencyKey)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestActivationIdempotencyReplay(t *testing.T) {
+	tests := []struct {
+		name       string
+		change     func(t *testing.T, revocations *revocationCache)
+		status     int
+		replayed   bool
+		activation int // activation rows after the retry
+	}{
+		{"unchanged", func(t *testing.T, _ *revocationCache) {}, http.StatusOK, true, 1},
+		{"device deactivated", func(t *testing.T, _ *revocationCache) {
+			if _, err := store.DeleteActivations("LIC-IDEM", "hw-idempotent"); err != nil {
+				t.Fatal(err)
+			}
+		}, http.StatusOK, false, 1},
+		{"license deactivated", func(t *testing.T, _ *revocationCache) {
+			if _, err := db.Exec(fmt.Sprintf(`UPDATE licenses SET active = false WHERE license_id = %s`, sqlPlaceholder(1)), "LIC-IDEM"); err != nil {
+				t.Fatal(err)
+			}
+		}, http.StatusForbidden, false, 1},
+		{"license revoked", func(t *testing.T, revocations *revocationCache) {
+			if err := store.AddRevocation("LIC-IDEM", "chargeback"); err != nil {
+				t.Fatal(err)
+			}
+			if err := revocations.refresh(); err != nil {
+				t.Fatal(err)
+			}
+		}, http.StatusForbidden, false, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			useTestTiers(t)
+			useTestSigningKey(t)
+			previous := activateReplies
+			activateReplies = newIdempotencyCache()
+			t.Cleanup(func() { activateReplies = previous })
+			revocations := &revocationCache{}
+			if err := revocations.refresh(); err != nil {
+				t.Fatal(err)
+			}
+			handler := handleActivation("sk-test", true, &Config{}, revocations)
+			seedLicense(t, "LIC-IDEM", "pro", time.Now().AddDate(0, 1, 0))
+
+			if w := activateWithKey(handler, "LIC-IDEM", "hw-idempotent", "retry-1"); w.Code != http.StatusOK {
+				t.Fatalf("first activation: status = %d: %s", w.Code, w.Body)
+			}
+			tt.change(t, revocations)
+
+			w := activateWithKey(handler, "LIC-IDEM", "hw-idempotent", "retry-1")
+			if w.Code != tt.status {
+				t.Fatalf("retry: status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if got := w.Header().Get("Idempotent-Replayed") == "true"; got != tt.replayed {
+				t.Fatalf("retry replayed: %v, want %v", got, tt.replayed)
+			}
+			count, err := getActivationCount(t.Context(), "LIC-IDEM")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.activation {
+				t.Fatalf("activation rows = %d, want %d", count, tt.activation)
+			}
+		})
+	}
+}
+
+// openBundle decrypts an activation response's bundle the way the CLI's
+// decryptBundle does
+func openBundle(t *testing.T, resp ActivationResponse, licenseKey, hardwareID string) (*DecryptedData, error) {
+	t.Helper()
+	ciphertext, err := base64.StdEncoding.DecodeString(resp.EncryptedAPIKey)
+	if err != nil {
+		t.Fatalf("bundle encoding: %v", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(resp.IV)
+	if err != nil {
+		t.Fatalf("iv encoding: %v", err)
+	}
+	key, err := licensecrypto.DeriveKey(licenseKey, hardwareID, resp.Salt)
+	if err != nil {
+		t.Fatalf("derive key: %v", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	var bundle DecryptedData
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		t.Fatalf("bundle isn't JSON: %v", err)
+	}
+	return &bundle, nil
+}
+
+func TestActivationBundleRoundTrip(t *testing.T) {
+	for _, proxyMode := range []bool{false, true} {
+		t.Run(fmt.Sprintf("proxy=%v", proxyMode), func(t *testing.T) {
+			openTestDB(t)
+			useTestTiers(t)
+			publicKey := useTestSigningKey(t)
+			seedLicense(t, "LIC-BUNDLE", "basic", time.Now().AddDate(0, 1, 0))
+
+			w := postJSON(handleActivation("sk-protected", proxyMode, &Config{}, nil), "/activate",
+				ActivationRequest{LicenseKey: "LIC-BUNDLE", HardwareID: "hw-bundle"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp ActivationResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if err := licensecrypto.VerifyLicenseSignature(publicKey, resp.EncryptedAPIKey, resp.IV, resp.Salt, "LIC-BUNDLE", resp.BundleSignature); err != nil {
+				t.Fatalf("bundle signature: %v", err)
+			}
+
+			bundle, err := openBundle(t, resp, "LIC-BUNDLE", "hw-bundle")
+			if err != nil {
+				t.Fatalf("decrypt bundle: %v", err)
+			}
+			want, mode := "sk-protected", "direct"
+			if proxyMode {
+				mode = "proxy"
+				if err := db.QueryRow(`SELECT proxy_key FROM proxy_keys WHERE license_id = `+sqlPlaceholder(1), "LIC-BUNDLE").Scan(&want); err != nil {
+					t.Fatalf("load proxy key: %v", err)
+				}
+			}
+			if resp.Mode != mode || bundle.APIKey != want {
+				t.Fatalf("%s bundle holds %q, want %q", resp.Mode, bundle.APIKey, want)
+			}
+			if bundle.Tier != "basic" || bundle.Limits.DailyLimit != 100 || bundle.Limits.MaxActivations != 2 {
+				t.Fatalf("bundle license details = %+v", bundle)
+			}
+
+			if _, err := openBundle(t, resp, "LIC-BUNDLE", "hw-other"); err == nil {
+				t.Fatal("bundle decrypted with another hardware ID")
+			}
+		})
+	}
+}
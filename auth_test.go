@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// okHandler answers 200 so a test can tell a request got through
+func okHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	const key = "adm_correct-key"
+	tests := []struct {
+		name       string
+		configured string
+		header     http.Header
+		want       int
+	}{
+		{"no key configured", "", http.Header{"Authorization": {"Bearer " + key}}, http.StatusServiceUnavailable},
+		{"missing key", key, http.Header{}, http.StatusUnauthorized},
+		{"wrong key", key, http.Header{"Authorization": {"Bearer adm_wrong-key"}}, http.StatusUnauthorized},
+		{"prefix of the key", key, http.Header{"X-Admin-Key": {key[:5]}}, http.StatusUnauthorized},
+		{"empty bearer", key, http.Header{"Authorization": {"Bearer "}}, http.StatusUnauthorized},
+		{"basic credentials", key, http.Header{"Authorization": {"Basic YWRtaW46cGFzcw=="}}, http.StatusUnauthorized},
+		{"bearer", key, http.Header{"Authorization": {"Bearer " + key}}, http.StatusOK},
+		{"lower-case scheme", key, http.Header{"Authorization": {"bearer " + key}}, http.StatusOK},
+		{"X-Admin-Key", key, http.Header{"X-Admin-Key": {key}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/check", nil)
+			r.Header = tt.header
+			w := httptest.NewRecorder()
+			apiKeyMiddleware(tt.configured, okHandler)(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("401 without a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestAdminAuthMiddleware(t *testing.T) {
+	config := &Config{AdminAPIKey: "adm_correct-key", AdminUsername: "admin", AdminPassword: "s3cret"}
+	handler := adminAuthMiddleware(config, okHandler)
+
+	tests := []struct {
+		name  string
+		setup func(r *http.Request)
+		want  int
+	}{
+		{"nothing", func(r *http.Request) {}, http.StatusUnauthorized},
+		{"api key", func(r *http.Request) { r.Header.Set("X-Admin-Key", "adm_correct-key") }, http.StatusOK},
+		{"password", func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") }, http.StatusOK},
+		{"wrong password", func(r *http.Request) { r.SetBasicAuth("admin", "guess") }, http.StatusUnauthorized},
+		// A wrong key isn't retried as a password
+		{"wrong api key", func(r *http.Request) { r.Header.Set("X-Admin-Key", "adm_wrong-key") }, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			tt.setup(r)
+			w := httptest.NewRecorder()
+			handler(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
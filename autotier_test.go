@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// autoTierTiers promotes basic licenses using 90% of their monthly limit
+// for two months to pro, and demotes pro licenses under 5% for one month
+const autoTierTiers = `
+[tiers.basic]
+name = "Basic"
+daily_limit = 100
+monthly_limit = 1000
+max_devices = 1
+
+[tiers.pro]
+name = "Pro"
+daily_limit = 1000
+monthly_limit = 20000
+max_devices = 5
+
+[[auto_tier]]
+from = "basic"
+to = "pro"
+direction = "above"
+percent = 90
+months = 2
+
+[[auto_tier]]
+from = "pro"
+to = "basic"
+direction = "below"
+percent = 5
+months = 1
+`
+
+// seedMonthlyUsage records usage scans for licenseID on the first day of
+// month
+func seedMonthlyUsage(t *testing.T, licenseID string, month time.Time, usage int) {
+	t.Helper()
+	if err := store.RecordUsage(licenseID, month.Format("2006-01")+"-01", "hw-1", usage); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+}
+
+// backdateLicense makes licenseID older than every auto-tier window
+func backdateLicense(t *testing.T, licenseID string) {
+	t.Helper()
+	_, err := db.Exec(fmt.Sprintf(`UPDATE licenses SET created_at = %s WHERE license_id = %s`, sqlPlaceholder(1), sqlPlaceholder(2)),
+		"2020-01-01 00:00:00", licenseID)
+	if err != nil {
+		t.Fatalf("backdate license: %v", err)
+	}
+}
+
+func TestEvaluateAutoTier(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	april, may := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		tier    string
+		usage   map[time.Time]int
+		dryRun  bool
+		want    string
+		daily   int
+		monthly int
+		devices int
+	}{
+		{"promoted", "basic", map[time.Time]int{april: 950, may: 900}, false, "pro", 1000, 20000, 5},
+		{"one month below the threshold", "basic", map[time.Time]int{april: 950, may: 899}, false, "basic", 100, 1000, 1},
+		{"demoted", "pro", map[time.Time]int{may: 999}, false, "basic", 100, 1000, 1},
+		{"busy pro stays", "pro", map[time.Time]int{may: 1001}, false, "pro", 1000, 20000, 5},
+		{"dry run", "basic", map[time.Time]int{april: 950, may: 900}, true, "basic", 100, 1000, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			useTiers(t, autoTierTiers)
+			seedLicense(t, "LIC-AUTO", tt.tier, now.AddDate(1, 0, 0))
+			backdateLicense(t, "LIC-AUTO")
+			for month, usage := range tt.usage {
+				seedMonthlyUsage(t, "LIC-AUTO", month, usage)
+			}
+
+			evaluateAutoTier(&Config{AutoTierDryRun: tt.dryRun}, now)
+
+			license, err := store.GetLicense("LIC-AUTO")
+			if err != nil {
+				t.Fatalf("GetLicense: %v", err)
+			}
+			if license.Tier != tt.want || license.DailyLimit != tt.daily || license.MonthlyLimit != tt.monthly || license.MaxActivations != tt.devices {
+				t.Fatalf("license = %s with limits %d/%d and %d devices, want %s with %d/%d and %d devices",
+					license.Tier, license.DailyLimit, license.MonthlyLimit, license.MaxActivations,
+					tt.want, tt.daily, tt.monthly, tt.devices)
+			}
+		})
+	}
+}
+
+func TestEvaluateAutoTierMovesOncePerRun(t *testing.T) {
+	openTestDB(t)
+	useTiers(t, autoTierTiers)
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	seedLicense(t, "LIC-AUTO", "basic", now.AddDate(1, 0, 0))
+	backdateLicense(t, "LIC-AUTO")
+	// Above 90% of basic's limit, but under 5% of pro's: promoted by the
+	// first rule, then not demoted straight back by the second
+	seedMonthlyUsage(t, "LIC-AUTO", time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC), 950)
+	seedMonthlyUsage(t, "LIC-AUTO", time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC), 950)
+
+	evaluateAutoTier(&Config{}, now)
+	evaluateAutoTier(&Config{}, now)
+
+	license, err := store.GetLicense("LIC-AUTO")
+	if err != nil {
+		t.Fatalf("GetLicense: %v", err)
+	}
+	if license.Tier != "pro" {
+		t.Fatalf("tier = %s, want pro", license.Tier)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHandleCheck(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	seedLicense(t, "LIC-VALID", "basic", time.Now().AddDate(0, 1, 0))
+	seedDevice(t, "LIC-VALID", "hw-valid", nil)
+	seedLicense(t, "LIC-EXPIRED", "basic", time.Now().AddDate(0, 0, -1))
+	seedLicense(t, "LIC-OFF", "basic", time.Now().AddDate(0, 1, 0))
+	if _, err := db.Exec(`UPDATE licenses SET active = `+sqlPlaceholder(1)+` WHERE license_id = `+sqlPlaceholder(2), false, "LIC-OFF"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		license     string
+		status      int
+		valid       bool
+		reason      string
+		activations int
+	}{
+		{"LIC-VALID", http.StatusOK, true, "", 1},
+		{"LIC-EXPIRED", http.StatusOK, false, ErrLicenseExpired.Error(), 0},
+		{"LIC-OFF", http.StatusOK, false, ErrLicenseDeactivated.Error(), 0},
+		{"LIC-UNKNOWN", http.StatusUnauthorized, false, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.license, func(t *testing.T) {
+			w := postJSON(handleCheck(), "/check", CheckRequest{LicenseKey: tt.license})
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var resp CheckResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if tt.status != http.StatusOK {
+				if resp.Success || resp.Error == "" {
+					t.Fatalf("unknown license answered %+v", resp)
+				}
+				return
+			}
+			if !resp.Success || resp.Valid != tt.valid || resp.Reason != tt.reason {
+				t.Fatalf("valid = %v (%q), want %v (%q)", resp.Valid, resp.Reason, tt.valid, tt.reason)
+			}
+			if resp.Tier != "basic" || resp.DailyLimit != 100 || resp.MonthlyLimit != 1000 || resp.Limits.MaxActivations != 2 {
+				t.Fatalf("license details = %s, %d/%d, %d devices", resp.Tier, resp.DailyLimit, resp.MonthlyLimit, resp.Limits.MaxActivations)
+			}
+			if resp.CurrentActivations != tt.activations {
+				t.Fatalf("current activations = %d, want %d", resp.CurrentActivations, tt.activations)
+			}
+		})
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		if w := postJSON(handleCheck(), "/check", CheckRequest{}); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+}
@@ -1,19 +1,36 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"crypto/ed25519"
 	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/BurntSushi/toml"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+	"github.com/melihbirim/licensify/internal/database"
+	"github.com/melihbirim/licensify/internal/database/migrations"
+	"github.com/melihbirim/licensify/internal/email"
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/melihbirim/licensify/internal/secrets"
 	"github.com/melihbirim/licensify/internal/tiers"
 	_ "modernc.org/sqlite"
 )
@@ -24,13 +41,42 @@ const (
 
 var (
 	db           *sql.DB
+	store        *database.DB // wraps db; shares prepared statements across a command's queries
 	isPostgresDB bool
+	jsonOutput   bool                  // -json: print structured JSON and report errors as JSON on stderr
+	auditActor   string                // -actor: who the audit log records as making changes, default $USER
+	tierRegistry = tiers.NewRegistry() // Loaded from TIERS_CONFIG_PATH by the commands that need tiers
 )
 
 func main() {
 	// Load .env file
 	_ = godotenv.Load()
 
+	// -json and -actor are global and may appear anywhere on the command line
+	args := os.Args[:1]
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case arg == "-json" || arg == "--json":
+			jsonOutput = true
+		case arg == "-actor" || arg == "--actor":
+			if i+1 >= len(os.Args) {
+				fmt.Println("Error: -actor requires a name")
+				os.Exit(1)
+			}
+			i++
+			auditActor = os.Args[i]
+		case strings.HasPrefix(arg, "-actor=") || strings.HasPrefix(arg, "--actor="):
+			auditActor = arg[strings.Index(arg, "=")+1:]
+		default:
+			args = append(args, arg)
+		}
+	}
+	os.Args = args
+	if auditActor == "" {
+		auditActor = getEnv("USER", "unknown")
+	}
+
 	// Define commands
 	if len(os.Args) < 2 {
 		printUsage()
@@ -48,18 +94,54 @@ func main() {
 		handleUpgrade()
 	case "fix":
 		handleFix()
+	case "renew":
+		handleRenew()
 	case "list":
 		handleList()
+	case "search":
+		handleSearch()
 	case "get":
 		handleGet()
 	case "deactivate":
 		handleDeactivate()
 	case "activate":
 		handleActivate()
+	case "revoke":
+		handleRevoke()
+	case "delete":
+		handleDelete()
+	case "seats":
+		handleSeats()
+	case "activations":
+		handleActivations()
+	case "products":
+		handleProducts()
+	case "issue-offline":
+		handleIssueOffline()
 	case "tiers":
 		handleTiers()
 	case "migrate":
 		handleMigrate()
+	case "remind":
+		handleRemind()
+	case "import":
+		handleImport()
+	case "import-legacy":
+		handleImportLegacy()
+	case "export":
+		handleExport()
+	case "import-dump":
+		handleImportDump()
+	case "migrate-schema":
+		handleMigrateSchema()
+	case "audit":
+		handleAudit()
+	case "stats":
+		handleStats()
+	case "stale":
+		handleStale()
+	case "keys":
+		handleKeys()
 	default:
 		fmt.Printf("Unknown command: %s\n\n", command)
 		printUsage()
@@ -73,16 +155,38 @@ func printUsage() {
 	fmt.Println("Usage:")
 	fmt.Println("  licensify-admin <command> [flags]")
 	fmt.Println()
+	fmt.Println("Global flags:")
+	fmt.Println("  -json        JSON output for list, search, get, stats, stale, tiers list, tiers get, audit list, and migrate/remind -dry-run")
+	fmt.Println("  -actor NAME  Who the audit log records for changes (default: $USER)")
+	fmt.Println()
 	fmt.Println("Commands:")
 	fmt.Println("  create       Create a new license")
 	fmt.Println("  upgrade      Upgrade/downgrade a license (creates new key, emails customer)")
 	fmt.Println("  fix          Fix an existing license (silent corrections, no email)")
+	fmt.Println("  renew        Extend a license's expiry, keeping its key")
 	fmt.Println("  list         List all licenses")
+	fmt.Println("  search       Find licenses by key, customer name or email")
 	fmt.Println("  get          Get license details")
 	fmt.Println("  activate     Activate a license")
 	fmt.Println("  deactivate   Deactivate a license")
+	fmt.Println("  revoke       Revoke a license with a reason, or list revocations")
+	fmt.Println("  delete       Permanently delete a license and its data (e.g. GDPR erasure)")
+	fmt.Println("  seats        Set activation limit from purchased seat count")
+	fmt.Println("  activations  List or reset a license's device activations")
+	fmt.Println("  products     Show or change the products a license unlocks")
+	fmt.Println("  issue-offline Write a signed license file for an offline machine")
+	fmt.Println("  keys         Create, rotate or list the signing keyring")
 	fmt.Println("  tiers        Manage tier configuration")
 	fmt.Println("  migrate      Migrate licenses from deprecated tiers")
+	fmt.Println("  remind       Email renewal reminders for licenses about to expire")
+	fmt.Println("  import       Create licenses in bulk from a CSV of email,name,tier,months")
+	fmt.Println("  import-legacy Import licenses exported from another licensing system")
+	fmt.Println("  export       Back up all licenses as JSON or CSV")
+	fmt.Println("  import-dump  Restore licenses from an export file")
+	fmt.Println("  migrate-schema Apply pending database schema migrations")
+	fmt.Println("  audit        List the audit log of admin changes")
+	fmt.Println("  stats        Show license counts by tier, activations and this month's usage")
+	fmt.Println("  stale        List active licenses that haven't checked in recently")
 	fmt.Println("  version      Show version")
 	fmt.Println()
 	fmt.Println("Examples:")
@@ -92,14 +196,169 @@ func printUsage() {
 	fmt.Println("  # Upgrade a license (sends email with new key)")
 	fmt.Println("  licensify-admin upgrade -license LIC-xxx -tier enterprise")
 	fmt.Println()
+	fmt.Println("  # Renew for another year and email the customer")
+	fmt.Println("  licensify-admin renew -license LIC-xxx -months 12 -send-email")
+	fmt.Println()
 	fmt.Println("  # Fix license details (no email)")
 	fmt.Println("  licensify-admin fix -license LIC-xxx -months 6")
 	fmt.Println()
 	fmt.Println("  # List all licenses")
 	fmt.Println("  licensify-admin list")
 	fmt.Println()
+	fmt.Println("  # Find a customer's licenses")
+	fmt.Println("  licensify-admin search -q acme")
+	fmt.Println()
 	fmt.Println("  # Get specific license details")
 	fmt.Println("  licensify-admin get -license LIC-xxx")
+	fmt.Println()
+	fmt.Println("  # Expiring licenses as JSON")
+	fmt.Println("  licensify-admin list -json | jq '.licenses[] | select(.expires_at < \"2026-01-01\")'")
+}
+
+// writeJSON prints v as indented JSON on stdout
+func writeJSON(v interface{}) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fatalf("Failed to encode output: %v", err)
+	}
+}
+
+// fatalf reports an unexpected error and exits. With -json the message is
+// written to stderr as {"error": "..."}.
+func fatalf(format string, args ...interface{}) {
+	if jsonOutput {
+		writeJSONError(fmt.Sprintf(format, args...))
+	}
+	log.Fatalf(format, args...)
+}
+
+// failf reports a user-facing failure such as an unknown license and exits 1
+func failf(format string, args ...interface{}) {
+	if jsonOutput {
+		writeJSONError(fmt.Sprintf(format, args...))
+	}
+	fmt.Printf("❌ "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// confirm asks before a destructive change and reports whether the answer
+// was "yes". With -yes it doesn't ask. Without a terminal to answer on, it
+// fails rather than waiting for input, so scripts must pass -yes.
+func confirm(prompt string, yes bool) bool {
+	return confirmAnswer(prompt+" (yes/no): ", "yes", yes)
+}
+
+// confirmAnswer is confirm for prompts that want a specific answer, such as
+// the license key being deleted. Case is ignored.
+func confirmAnswer(prompt, want string, yes bool) bool {
+	if yes {
+		return true
+	}
+	info, err := os.Stdin.Stat()
+	terminal := err == nil && info.Mode()&os.ModeCharDevice != 0
+	confirmed, err := readAnswer(os.Stdin, os.Stdout, terminal, prompt, want)
+	if errors.Is(err, errNotTerminal) {
+		failf("Confirmation needed but stdin is not a terminal; pass -yes to confirm")
+	}
+	return confirmed
+}
+
+// errNotTerminal is returned by readAnswer when there is no one to answer
+var errNotTerminal = errors.New("stdin is not a terminal")
+
+// readAnswer writes prompt to out and reports whether the answer read from
+// in is want. It reads nothing unless in is a terminal.
+func readAnswer(in io.Reader, out io.Writer, terminal bool, prompt, want string) (bool, error) {
+	if !terminal {
+		return false, errNotTerminal
+	}
+	_, _ = fmt.Fprint(out, prompt)
+	var answer string
+	_, _ = fmt.Fscanln(in, &answer)
+	return strings.EqualFold(strings.TrimSpace(answer), want), nil
+}
+
+// lookupLicense loads a license, failing if it doesn't exist, so commands
+// can refuse an unknown key before asking for confirmation
+func lookupLicense(licenseID string) *database.License {
+	lic, err := store.GetLicense(licenseID)
+	if errors.Is(err, database.ErrLicenseNotFound) {
+		failf("License not found: %s", licenseID)
+	}
+	if err != nil {
+		fatalf("Failed to load license: %v", err)
+	}
+	return lic
+}
+
+// usageError reports a missing or invalid flag with the command's flag help
+func usageError(fs *flag.FlagSet, message string) {
+	if jsonOutput {
+		writeJSONError(message)
+	}
+	fmt.Println("Error: " + message)
+	fs.PrintDefaults()
+	os.Exit(1)
+}
+
+func writeJSONError(message string) {
+	_ = json.NewEncoder(os.Stderr).Encode(map[string]string{"error": message})
+	os.Exit(1)
+}
+
+// auditSecretFlags marks flags whose values stay out of the audit log, by
+// substring of the flag name
+var auditSecretFlags = []string{"password", "secret", "token", "api-key", "private-key"}
+
+// flagDetails returns every flag of fs with its effective value, after any
+// tier defaults the command filled in, for an audit entry's details
+func flagDetails(fs *flag.FlagSet) map[string]interface{} {
+	return collectFlags(fs.VisitAll)
+}
+
+// setFlagDetails is flagDetails for commands like fix where a flag left
+// unset means "leave unchanged": only flags given on the command line are
+// recorded
+func setFlagDetails(fs *flag.FlagSet) map[string]interface{} {
+	return collectFlags(fs.Visit)
+}
+
+func collectFlags(visit func(func(*flag.Flag))) map[string]interface{} {
+	details := make(map[string]interface{})
+	visit(func(f *flag.Flag) {
+		for _, secret := range auditSecretFlags {
+			if strings.Contains(f.Name, secret) {
+				return
+			}
+		}
+		if getter, ok := f.Value.(flag.Getter); ok {
+			details[f.Name] = getter.Get()
+		} else {
+			details[f.Name] = f.Value.String()
+		}
+	})
+	return details
+}
+
+// recordAudit appends an entry to the audit log for a change that has
+// already been made, so a failure to record it is a warning rather than an
+// error
+func recordAudit(action, licenseID string, details map[string]interface{}) {
+	data, err := json.Marshal(details)
+	if err != nil {
+		fmt.Printf("⚠️  Failed to record %s in the audit log: %v\n", action, err)
+		return
+	}
+	entry := database.AuditEntry{
+		Action:        action,
+		TargetLicense: licenseID,
+		Actor:         auditActor,
+		Details:       data,
+	}
+	if err := store.RecordAudit(entry); err != nil {
+		fmt.Printf("⚠️  Failed to record %s in the audit log: %v\n", action, err)
+	}
 }
 
 func handleCreate() {
@@ -111,6 +370,7 @@ func handleCreate() {
 	dailyLimit := fs.Int("daily", 0, "Daily API limit (0 for tier default, -1 unlimited)")
 	monthlyLimit := fs.Int("monthly", 0, "Monthly API limit (0 for tier default, -1 unlimited)")
 	maxActivations := fs.Int("activations", 0, "Max device activations (0 for tier default, -1 unlimited)")
+	productList := fs.String("products", "", "Comma-separated product IDs the license unlocks (default: DEFAULT_PRODUCT only)")
 
 	_ = fs.Parse(os.Args[2:])
 
@@ -120,30 +380,29 @@ func handleCreate() {
 		os.Exit(1)
 	}
 
+	products := parseProductsFlag("products", *productList)
+
 	// Load tier configuration
-	tiersPath := os.Getenv("TIERS_CONFIG_PATH")
-	if tiersPath == "" {
-		tiersPath = "tiers.toml"
-	}
-	if err := tiers.LoadWithFallback(tiersPath); err != nil {
-		log.Fatalf("Failed to load tier configuration: %v", err)
+	tiersPath := getEnv("TIERS_CONFIG_PATH", "tiers.toml")
+	if err := tierRegistry.LoadWithFallback(tiersPath); err != nil {
+		fatalf("Failed to load tier configuration: %v", err)
 	}
 
 	// Validate tier exists
-	if !tiers.Exists(*tier) {
-		fmt.Printf("Error: Invalid tier '%s'. Available tiers: %v\n", *tier, tiers.List())
+	if !tierRegistry.Exists(*tier) {
+		fmt.Printf("Error: Invalid tier '%s'. Available tiers: %v\n", *tier, tierRegistry.List())
 		fmt.Println("Use 'licensify-admin tiers list' to see tier details")
 		os.Exit(1)
 	}
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }()
 
 	// Get tier configuration
-	tierConfig, _ := tiers.Get(*tier)
+	tierConfig, _ := tierRegistry.Get(*tier)
 
 	// Set defaults based on tier if not specified
 	if *dailyLimit == 0 {
@@ -156,30 +415,31 @@ func handleCreate() {
 		*maxActivations = tierConfig.MaxDevices
 	}
 
-	// Generate license key
-	licenseKey := generateLicenseKey(*tier)
-
 	// Calculate expiry
-	var expiresAt time.Time
-	if *months == 0 {
-		expiresAt = time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC)
-	} else {
-		expiresAt = time.Now().AddDate(0, *months, 0)
-	}
+	expiresAt := licenseExpiry(*months)
 
-	// Insert license
+	// Insert license under a newly generated key
 	query := fmt.Sprintf(`
 		INSERT INTO licenses (
 			license_id, customer_name, customer_email, tier,
 			expires_at, daily_limit, monthly_limit, max_activations, active
 		) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, true)
+		ON CONFLICT (license_id) DO NOTHING
 	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4),
 		sqlPlaceholder(5), sqlPlaceholder(6), sqlPlaceholder(7), sqlPlaceholder(8))
 
-	_, err := db.Exec(query, licenseKey, *name, *email, *tier, expiresAt, *dailyLimit, *monthlyLimit, *maxActivations)
+	licenseKey, err := insertWithNewKey(*tier, func(licenseKey string) (sql.Result, error) {
+		return db.Exec(query, licenseKey, *name, *email, *tier, expiresAt, *dailyLimit, *monthlyLimit, *maxActivations)
+	})
 	if err != nil {
-		log.Fatalf("Failed to create license: %v", err)
+		fatalf("Failed to create license: %v", err)
+	}
+	if len(products) > 0 {
+		if err := store.SetLicenseProducts(licenseKey, products); err != nil {
+			fatalf("License %s created but setting products failed: %v", licenseKey, err)
+		}
 	}
+	recordAudit("create", licenseKey, flagDetails(fs))
 
 	fmt.Println("✅ License created successfully!")
 	fmt.Println()
@@ -189,6 +449,7 @@ func handleCreate() {
 	fmt.Printf("Daily Limit:     %s\n", formatLimit(*dailyLimit))
 	fmt.Printf("Monthly Limit:   %s\n", formatLimit(*monthlyLimit))
 	fmt.Printf("Max Activations: %s\n", formatLimit(*maxActivations))
+	fmt.Printf("Products:        %s\n", formatProducts(products))
 	fmt.Printf("Expires:         %s\n", expiresAt.Format("2006-01-02"))
 }
 
@@ -198,6 +459,7 @@ func handleUpgrade() {
 	newTier := fs.String("tier", "", "New tier (required - use 'tiers list' to see available)")
 	months := fs.Int("months", 0, "Duration for new license in months (0 to keep same expiry)")
 	sendEmail := fs.Bool("send-email", true, "Send email to customer with new license key")
+	dryRun := fs.Bool("dry-run", false, "Show the new license without creating it, deactivating the old one or sending email")
 
 	_ = fs.Parse(os.Args[2:])
 
@@ -208,77 +470,88 @@ func handleUpgrade() {
 	}
 
 	// Load tier configuration
-	tiersPath := os.Getenv("TIERS_CONFIG_PATH")
-	if tiersPath == "" {
-		tiersPath = "tiers.toml"
+	tiersPath := getEnv("TIERS_CONFIG_PATH", "tiers.toml")
+	if err := tierRegistry.LoadWithFallback(tiersPath); err != nil {
+		fatalf("Failed to load tier configuration: %v", err)
 	}
-	if err := tiers.LoadWithFallback(tiersPath); err != nil {
-		log.Fatalf("Failed to load tier configuration: %v", err)
+	var mailer *email.Client
+	if *sendEmail && !*dryRun {
+		mailer = newMailer()
 	}
 
 	// Validate tier exists
-	if !tiers.Exists(*newTier) {
-		fmt.Printf("Error: Invalid tier '%s'. Available tiers: %v\n", *newTier, tiers.List())
+	if !tierRegistry.Exists(*newTier) {
+		fmt.Printf("Error: Invalid tier '%s'. Available tiers: %v\n", *newTier, tierRegistry.List())
 		fmt.Println("Use 'licensify-admin tiers list' to see tier details")
 		os.Exit(1)
 	}
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }()
 
 	// Get current license details
-	var oldName, oldEmail, oldTier string
-	var oldExpiresAt time.Time
+	var oldName, oldEmail, oldTier, oldExpiry string
 	query := fmt.Sprintf(`
 		SELECT customer_name, customer_email, tier, expires_at
 		FROM licenses WHERE license_id = %s
 	`, sqlPlaceholder(1))
 
-	err := db.QueryRow(query, *oldLicense).Scan(&oldName, &oldEmail, &oldTier, &oldExpiresAt)
+	err := db.QueryRow(query, *oldLicense).Scan(&oldName, &oldEmail, &oldTier, &oldExpiry)
 	if err == sql.ErrNoRows {
 		fmt.Printf("❌ License not found: %s\n", *oldLicense)
 		os.Exit(1)
 	} else if err != nil {
-		log.Fatalf("Failed to get license: %v", err)
+		fatalf("Failed to get license: %v", err)
+	}
+	// SQLite keeps expires_at as text, so it can't be scanned as a time
+	oldExpiresAt, err := database.ParseTime(oldExpiry)
+	if err != nil {
+		fatalf("License %s has an invalid expiry %q: %v", *oldLicense, oldExpiry, err)
 	}
 
 	// Get tier configuration
-	tierConfig, _ := tiers.Get(*newTier)
+	tierConfig, _ := tierRegistry.Get(*newTier)
 	dailyLimit := tierConfig.DailyLimit
 	monthlyLimit := tierConfig.MonthlyLimit
 	maxActivations := tierConfig.MaxDevices
 
-	// Calculate new expiry
-	var newExpiresAt time.Time
-	if *months == 0 {
-		// Keep same expiry as old license
-		newExpiresAt = oldExpiresAt
-	} else if *months < 0 {
-		// Lifetime
-		newExpiresAt = time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC)
-	} else {
-		// New duration from now
-		newExpiresAt = time.Now().AddDate(0, *months, 0)
-	}
+	newExpiresAt := upgradeExpiry(*months, oldExpiresAt)
 
-	// Generate new license key
-	newLicenseKey := generateLicenseKey(*newTier)
+	if *dryRun {
+		fmt.Println("🔍 DRY RUN - No changes will be made")
+		fmt.Println()
+		fmt.Printf("Old License:     %s (%s) - would be DEACTIVATED\n", *oldLicense, oldTier)
+		fmt.Printf("New License:     new %s key\n", *newTier)
+		fmt.Printf("Customer:        %s (%s)\n", oldName, oldEmail)
+		fmt.Printf("Daily Limit:     %s\n", formatLimit(dailyLimit))
+		fmt.Printf("Monthly Limit:   %s\n", formatLimit(monthlyLimit))
+		fmt.Printf("Max Activations: %s\n", formatLimit(maxActivations))
+		fmt.Printf("Expires:         %s\n", newExpiresAt.Format("2006-01-02"))
+		if *sendEmail {
+			fmt.Printf("Email:           upgrade notice to %s\n", oldEmail)
+		}
+		fmt.Println("\nRun without -dry-run to perform the upgrade")
+		return
+	}
 
-	// Insert new license
+	// Insert new license under a newly generated key
 	insertQuery := fmt.Sprintf(`
 		INSERT INTO licenses (
 			license_id, customer_name, customer_email, tier,
 			expires_at, daily_limit, monthly_limit, max_activations, active
 		) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, true)
+		ON CONFLICT (license_id) DO NOTHING
 	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4),
 		sqlPlaceholder(5), sqlPlaceholder(6), sqlPlaceholder(7), sqlPlaceholder(8))
 
-	_, err = db.Exec(insertQuery, newLicenseKey, oldName, oldEmail, *newTier, newExpiresAt, dailyLimit, monthlyLimit, maxActivations)
+	newLicenseKey, err := insertWithNewKey(*newTier, func(licenseKey string) (sql.Result, error) {
+		return db.Exec(insertQuery, licenseKey, oldName, oldEmail, *newTier, newExpiresAt, dailyLimit, monthlyLimit, maxActivations)
+	})
 	if err != nil {
-		log.Fatalf("Failed to create new license: %v", err)
+		fatalf("Failed to create new license: %v", err)
 	}
 
 	// Deactivate old license
@@ -286,6 +559,9 @@ func handleUpgrade() {
 	if err != nil {
 		log.Printf("Warning: Failed to deactivate old license: %v", err)
 	}
+	details := flagDetails(fs)
+	details["new_license"] = newLicenseKey
+	recordAudit("upgrade", *oldLicense, details)
 
 	fmt.Println("✅ License upgraded successfully!")
 	fmt.Println()
@@ -300,22 +576,31 @@ func handleUpgrade() {
 
 	// Send email if enabled
 	if *sendEmail {
-		resendAPIKey := os.Getenv("RESEND_API_KEY")
-		fromEmail := os.Getenv("FROM_EMAIL")
-
-		if resendAPIKey == "" || fromEmail == "" {
-			fmt.Println("⚠️  Email not sent: RESEND_API_KEY or FROM_EMAIL not configured")
+		if mailer == nil {
+			fmt.Println("⚠️  Email not sent: SMTP_HOST or RESEND_API_KEY, and FROM_EMAIL, are not configured")
 			fmt.Println("    Add these to your .env file to enable email notifications")
+		} else if err := mailer.SendUpgradeNotice(oldEmail, oldName, oldTier, *newTier, newLicenseKey, dailyLimit); err != nil {
+			fmt.Printf("⚠️  Failed to send email: %v\n", err)
 		} else {
-			if err := sendUpgradeEmail(resendAPIKey, fromEmail, oldEmail, oldName, oldTier, *newTier, newLicenseKey, dailyLimit); err != nil {
-				fmt.Printf("⚠️  Failed to send email: %v\n", err)
-			} else {
-				fmt.Printf("✅ Upgrade notification sent to %s\n", oldEmail)
-			}
+			fmt.Printf("✅ Upgrade notification sent to %s\n", oldEmail)
 		}
 	}
 }
 
+// upgradeExpiry returns the expiry of the license issued by upgrade: the old
+// license's expiry for months == 0, lifetime for negative months, and
+// otherwise months from now
+func upgradeExpiry(months int, oldExpiresAt time.Time) time.Time {
+	switch {
+	case months == 0:
+		return oldExpiresAt
+	case months < 0:
+		return database.LifetimeExpiry
+	default:
+		return time.Now().AddDate(0, months, 0)
+	}
+}
+
 func handleFix() {
 	fs := flag.NewFlagSet("fix", flag.ExitOnError)
 	license := fs.String("license", "", "License key (required)")
@@ -324,6 +609,7 @@ func handleFix() {
 	dailyLimit := fs.Int("daily", -999, "Daily API limit (-1 unlimited)")
 	monthlyLimit := fs.Int("monthly", -999, "Monthly API limit (-1 unlimited)")
 	maxActivations := fs.Int("activations", -999, "Max device activations (-1 unlimited)")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt")
 
 	_ = fs.Parse(os.Args[2:])
 
@@ -335,9 +621,9 @@ func handleFix() {
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }()
 
 	// Build update query dynamically
 	updates := []string{}
@@ -362,6 +648,14 @@ func handleFix() {
 		argNum++
 	}
 
+	// Remember the previous limits so a reduction only applies from the next reset
+	if *dailyLimit != -999 || *monthlyLimit != -999 {
+		limitChange, limitArgs := database.LimitChangeAssignments(sqlPlaceholder, argNum, time.Now())
+		updates = append(updates, limitChange...)
+		args = append(args, limitArgs...)
+		argNum += len(limitArgs)
+	}
+
 	if *maxActivations != -999 {
 		updates = append(updates, fmt.Sprintf("max_activations = %s", sqlPlaceholder(argNum)))
 		args = append(args, *maxActivations)
@@ -391,6 +685,12 @@ func handleFix() {
 		os.Exit(1)
 	}
 
+	lic := lookupLicense(*license)
+	if !confirm(fmt.Sprintf("⚠️  This will change %s (%s) in place, without emailing the customer. Continue?", lic.LicenseID, lic.CustomerName), *yes) {
+		fmt.Println("Fix cancelled")
+		return
+	}
+
 	// Add license key to args
 	args = append(args, *license)
 
@@ -399,7 +699,7 @@ func handleFix() {
 
 	result, err := db.Exec(query, args...)
 	if err != nil {
-		log.Fatalf("Failed to update license: %v", err)
+		fatalf("Failed to update license: %v", err)
 	}
 
 	rows, _ := result.RowsAffected()
@@ -407,104 +707,254 @@ func handleFix() {
 		fmt.Printf("❌ License not found: %s\n", *license)
 		os.Exit(1)
 	}
+	recordAudit("fix", *license, setFlagDetails(fs))
 
 	fmt.Printf("✅ License updated: %s\n", *license)
 
 	// Show updated license
-	showLicense(*license)
+	showLicense(*license, recentUsageDays, false)
+}
+
+func handleRenew() {
+	fs := flag.NewFlagSet("renew", flag.ExitOnError)
+	license := fs.String("license", "", "License key (required)")
+	months := fs.Int("months", 12, "Extend license by N months (0 for lifetime)")
+	sendEmail := fs.Bool("send-email", false, "Email the customer a renewal confirmation")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *license == "" {
+		usageError(fs, "-license is required")
+	}
+	if *months < 0 {
+		usageError(fs, "-months must not be negative")
+	}
+
+	var mailer *email.Client
+	if *sendEmail {
+		mailer = newMailer()
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	expiresAt, err := store.ExtendLicense(*license, *months)
+	if errors.Is(err, database.ErrLicenseNotFound) {
+		failf("License not found: %s", *license)
+	}
+	if err != nil {
+		fatalf("Failed to renew license: %v", err)
+	}
+	details := flagDetails(fs)
+	details["expires_at"] = expiresAt.UTC().Format(time.RFC3339)
+	recordAudit("renew", *license, details)
+
+	expiry := ""
+	if expiresAt.Equal(database.LifetimeExpiry) {
+		fmt.Printf("✅ License renewed: %s (lifetime)\n", *license)
+	} else {
+		expiry = expiresAt.Format("January 2, 2006")
+		fmt.Printf("✅ License renewed: %s (valid until %s)\n", *license, expiry)
+	}
+
+	if *sendEmail {
+		lic, err := store.GetLicense(*license)
+		if err != nil {
+			fatalf("Failed to load license: %v", err)
+		}
+		switch {
+		case mailer == nil:
+			fmt.Println("⚠️  Email not sent: SMTP_HOST or RESEND_API_KEY, and FROM_EMAIL, are not configured")
+		case lic.CustomerEmail == "":
+			fmt.Println("⚠️  Email not sent: the license has no customer email")
+		default:
+			if err := mailer.SendRenewalConfirmation(lic.CustomerEmail, lic.CustomerName, lic.Tier, lic.LicenseID, expiry); err != nil {
+				fmt.Printf("⚠️  Failed to send email: %v\n", err)
+			} else {
+				fmt.Printf("✅ Renewal confirmation sent to %s\n", lic.CustomerEmail)
+			}
+		}
+	}
 }
 
 func handleList() {
 	fs := flag.NewFlagSet("list", flag.ExitOnError)
 	tier := fs.String("tier", "", "Filter by tier")
 	activeOnly := fs.Bool("active", false, "Show only active licenses")
+	email := fs.String("email", "", "Filter by email (case-insensitive partial match)")
+	limit := fs.Int("limit", 50, "Maximum number of licenses to show (0 for all)")
+	offset := fs.Int("offset", 0, "Number of licenses to skip")
 
 	_ = fs.Parse(os.Args[2:])
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	licenses, total, err := store.ListLicenses(database.LicenseFilter{
+		Tier:          *tier,
+		ActiveOnly:    *activeOnly,
+		EmailContains: *email,
+		Limit:         *limit,
+		Offset:        *offset,
+	})
+	if err != nil {
+		fatalf("Failed to list licenses: %v", err)
 	}
-	defer func() { _ = db.Close() }()
 
-	// Build query
-	query := "SELECT license_id, customer_name, customer_email, tier, expires_at, active FROM licenses WHERE 1=1"
-	args := []interface{}{}
-	argNum := 1
+	out := licenseList{Licenses: []licenseSummary{}, Total: total, Offset: *offset, Limit: *limit}
+	for _, l := range licenses {
+		out.Licenses = append(out.Licenses, newLicenseSummary(l))
+	}
+	if jsonOutput {
+		writeJSON(out)
+		return
+	}
+	printLicenseList(out)
+}
 
-	if *tier != "" {
-		query += fmt.Sprintf(" AND tier = %s", sqlPlaceholder(argNum))
-		args = append(args, *tier)
-		_ = argNum // argNum is used in sqlPlaceholder above
+// handleSearch lists the licenses whose key, customer name or email
+// contains the search term
+func handleSearch() {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	query := fs.String("q", "", "Search term: part of a license key, customer name or email (required)")
+	tier := fs.String("tier", "", "Filter by tier")
+	activeOnly := fs.Bool("active", false, "Show only active licenses")
+	limit := fs.Int("limit", 50, "Maximum number of licenses to show (0 for all)")
+	offset := fs.Int("offset", 0, "Number of licenses to skip")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if strings.TrimSpace(*query) == "" {
+		usageError(fs, "-q is required")
 	}
 
-	if *activeOnly {
-		query += " AND active = true"
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	licenses, total, err := store.SearchLicenses(*query, database.LicenseFilter{
+		Tier:       *tier,
+		ActiveOnly: *activeOnly,
+		Limit:      *limit,
+		Offset:     *offset,
+	})
+	if err != nil {
+		fatalf("Failed to search licenses: %v", err)
 	}
 
-	query += " ORDER BY created_at DESC"
+	out := licenseList{Licenses: []licenseSummary{}, Total: total, Offset: *offset, Limit: *limit}
+	for _, l := range licenses {
+		out.Licenses = append(out.Licenses, newLicenseSummary(l))
+	}
+	if jsonOutput {
+		writeJSON(out)
+		return
+	}
+	printLicenseList(out)
+}
 
-	rows, err := db.Query(query, args...)
-	if err != nil {
-		log.Fatalf("Failed to list licenses: %v", err)
+// licenseList is the output of the list and search commands
+type licenseList struct {
+	Licenses []licenseSummary `json:"licenses"`
+	Total    int              `json:"total"`
+	Offset   int              `json:"offset"`
+	Limit    int              `json:"limit"`
+}
+
+// licenseSummary is a license as shown by list and get
+type licenseSummary struct {
+	LicenseKey     string    `json:"license_key"`
+	CustomerName   string    `json:"customer_name"`
+	CustomerEmail  string    `json:"customer_email"`
+	Tier           string    `json:"tier"`
+	Active         bool      `json:"active"`
+	DailyLimit     int       `json:"daily_limit"`
+	MonthlyLimit   int       `json:"monthly_limit"`
+	MaxActivations int       `json:"max_activations"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at"`
+}
+
+func newLicenseSummary(l database.License) licenseSummary {
+	return licenseSummary{
+		LicenseKey:     l.LicenseID,
+		CustomerName:   l.CustomerName,
+		CustomerEmail:  l.CustomerEmail,
+		Tier:           l.Tier,
+		Active:         l.Active,
+		DailyLimit:     l.DailyLimit,
+		MonthlyLimit:   l.MonthlyLimit,
+		MaxActivations: l.MaxActivations,
+		CreatedAt:      l.CreatedAt,
+		ExpiresAt:      l.ExpiresAt,
 	}
-	defer func() { _ = rows.Close() }()
+}
 
+func printLicenseList(out licenseList) {
 	fmt.Println("Licenses:")
 	fmt.Println(strings.Repeat("-", 100))
 	fmt.Printf("%-30s %-20s %-30s %-12s %-12s %-6s\n", "License Key", "Name", "Email", "Tier", "Expires", "Active")
 	fmt.Println(strings.Repeat("-", 100))
 
-	count := 0
-	for rows.Next() {
-		var licenseID, name, email, tier string
-		var expiresAt time.Time
-		var active bool
-
-		if err := rows.Scan(&licenseID, &name, &email, &tier, &expiresAt, &active); err != nil {
-			log.Printf("Error scanning row: %v", err)
-			continue
-		}
-
+	for _, l := range out.Licenses {
 		activeStr := "✓"
-		if !active {
+		if !l.Active {
 			activeStr = "✗"
 		}
 
 		fmt.Printf("%-30s %-20s %-30s %-12s %-12s %-6s\n",
-			licenseID, truncate(name, 20), truncate(email, 30), tier,
-			expiresAt.Format("2006-01-02"), activeStr)
-		count++
+			l.LicenseKey, truncate(l.CustomerName, 20), truncate(l.CustomerEmail, 30), l.Tier,
+			l.ExpiresAt.Format("2006-01-02"), activeStr)
 	}
 
 	fmt.Println(strings.Repeat("-", 100))
-	fmt.Printf("Total: %d licenses\n", count)
+	if len(out.Licenses) == 0 {
+		fmt.Printf("Total: %d licenses\n", out.Total)
+		return
+	}
+	fmt.Printf("Showing %d-%d of %d licenses\n", out.Offset+1, out.Offset+len(out.Licenses), out.Total)
+	if next := out.Offset + len(out.Licenses); next < out.Total {
+		fmt.Printf("Next page: -offset %d\n", next)
+	}
 }
 
 func handleGet() {
 	fs := flag.NewFlagSet("get", flag.ExitOnError)
 	license := fs.String("license", "", "License key (required)")
+	usageDays := fs.Int("usage-days", recentUsageDays, "Days of recent usage to include")
+	redactPII := fs.Bool("redact", false, "Mask the license key, customer name, email and hardware IDs, e.g. for sharing")
 
 	_ = fs.Parse(os.Args[2:])
 
 	if *license == "" {
-		fmt.Println("Error: -license is required")
-		fs.PrintDefaults()
-		os.Exit(1)
+		usageError(fs, "-license is required")
+	}
+	if *usageDays < 1 || *usageDays > database.MaxUsageRangeDays {
+		usageError(fs, fmt.Sprintf("-usage-days must be between 1 and %d", database.MaxUsageRangeDays))
 	}
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }()
 
-	showLicense(*license)
+	showLicense(*license, *usageDays, *redactPII)
 }
 
 func handleDeactivate() {
 	fs := flag.NewFlagSet("deactivate", flag.ExitOnError)
 	license := fs.String("license", "", "License key (required)")
+	reason := fs.String("reason", "deactivated", "Reason recorded in the revocation list")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt")
 
 	_ = fs.Parse(os.Args[2:])
 
@@ -516,171 +966,1994 @@ func handleDeactivate() {
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }()
 
-	result, err := db.Exec(fmt.Sprintf("UPDATE licenses SET active = false WHERE license_id = %s", sqlPlaceholder(1)), *license)
-	if err != nil {
-		log.Fatalf("Failed to deactivate license: %v", err)
-	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		fmt.Printf("❌ License not found: %s\n", *license)
-		os.Exit(1)
+	lic := lookupLicense(*license)
+	if !confirm(fmt.Sprintf("⚠️  This will deactivate %s (%s) on every device. Continue?", lic.LicenseID, lic.CustomerName), *yes) {
+		fmt.Println("Deactivation cancelled")
+		return
 	}
 
+	revokeLicense(*license, *reason)
+	recordAudit("deactivate", *license, flagDetails(fs))
+	invalidateServerCaches(*license)
 	fmt.Printf("✅ License deactivated: %s\n", *license)
 }
 
-func handleActivate() {
-	fs := flag.NewFlagSet("activate", flag.ExitOnError)
-	license := fs.String("license", "", "License key (required)")
+func handleRevoke() {
+	fs := flag.NewFlagSet("revoke", flag.ExitOnError)
+	license := fs.String("license", "", "License key (required unless -list)")
+	reason := fs.String("reason", "", "Why the license is revoked (required)")
+	list := fs.Bool("list", false, "List revoked licenses")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt")
 
 	_ = fs.Parse(os.Args[2:])
 
-	if *license == "" {
-		fmt.Println("Error: -license is required")
+	if !*list && (*license == "" || *reason == "") {
+		fmt.Println("Error: -license and -reason are required")
 		fs.PrintDefaults()
 		os.Exit(1)
 	}
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }()
 
-	result, err := db.Exec(fmt.Sprintf("UPDATE licenses SET active = true WHERE license_id = %s", sqlPlaceholder(1)), *license)
-	if err != nil {
-		log.Fatalf("Failed to activate license: %v", err)
+	if *list {
+		revocations, err := store.ListRevocations()
+		if err != nil {
+			fatalf("Failed to list revocations: %v", err)
+		}
+		if len(revocations) == 0 {
+			fmt.Println("No revoked licenses")
+			return
+		}
+		fmt.Printf("%-30s %-20s %s\n", "LICENSE", "REVOKED", "REASON")
+		for _, r := range revocations {
+			fmt.Printf("%-30s %-20s %s\n", r.LicenseID, r.RevokedAt.Format("2006-01-02 15:04:05"), r.Reason)
+		}
+		return
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		fmt.Printf("❌ License not found: %s\n", *license)
-		os.Exit(1)
+	lic := lookupLicense(*license)
+	if !confirm(fmt.Sprintf("⚠️  This will revoke %s (%s) on every device. Continue?", lic.LicenseID, lic.CustomerName), *yes) {
+		fmt.Println("Revocation cancelled")
+		return
 	}
 
-	fmt.Printf("✅ License activated: %s\n", *license)
+	revokeLicense(*license, *reason)
+	recordAudit("revoke", *license, flagDetails(fs))
+	invalidateServerCaches(*license)
+	fmt.Printf("✅ License revoked: %s (%s)\n", *license, *reason)
+	fmt.Println("   Running servers reject it on /proxy within REVOCATION_REFRESH")
 }
 
-// Helper functions
+func handleDelete() {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	license := fs.String("license", "", "License key (required)")
+	purgeEmail := fs.Bool("purge-email", false, "Also delete pending verification codes for the customer's email")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt")
 
-func initDB() error {
-	dbURL := os.Getenv("DATABASE_URL")
-	dbPath := os.Getenv("DATABASE_PATH")
-	if dbPath == "" {
-		dbPath = "licensify.db"
+	_ = fs.Parse(os.Args[2:])
+
+	if *license == "" {
+		usageError(fs, "-license is required")
 	}
 
-	var err error
-	if dbURL != "" {
-		// PostgreSQL
-		db, err = sql.Open("postgres", dbURL)
-		isPostgresDB = true
-	} else {
-		// SQLite
-		db, err = sql.Open("sqlite", dbPath)
-		isPostgresDB = false
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
 	}
+	defer func() { _ = store.Close() }()
 
-	if err != nil {
-		return fmt.Errorf("failed to open database: %v", err)
+	lic := lookupLicense(*license)
+
+	if !*yes {
+		fmt.Printf("⚠️  This permanently deletes %s (%s <%s>, %s) with its activations, usage,\n", lic.LicenseID, lic.CustomerName, lic.CustomerEmail, lic.Tier)
+		fmt.Println("   check-ins and proxy keys. It cannot be undone.")
+	}
+	if !confirmAnswer("Type the license key to confirm: ", lic.LicenseID, *yes) {
+		fmt.Println("Delete cancelled")
+		return
 	}
 
-	if err := db.Ping(); err != nil {
-		return fmt.Errorf("failed to ping database: %v", err)
+	if err := store.DeleteLicense(lic.LicenseID); err != nil {
+		fatalf("Failed to delete license: %v", err)
 	}
+	recordAudit("delete", lic.LicenseID, flagDetails(fs))
+	fmt.Printf("✅ License deleted: %s\n", lic.LicenseID)
 
-	// Initialize schema if tables don't exist
-	if err := initSchema(); err != nil {
-		return fmt.Errorf("failed to initialize schema: %v", err)
+	if *purgeEmail && lic.CustomerEmail != "" {
+		removed, err := store.DeleteVerificationCodes(lic.CustomerEmail)
+		if err != nil {
+			fatalf("Failed to purge verification codes: %v", err)
+		}
+		fmt.Printf("✅ Removed %d verification code(s) for %s\n", removed, lic.CustomerEmail)
 	}
+}
 
-	return nil
+// invalidateServerCaches asks every server in LICENSIFY_SERVER_URLS to drop
+// licenseID from its license cache, so a change made here applies at once
+// instead of after LICENSE_CACHE_TTL. Failures are only reported, since the
+// change itself is already saved.
+func invalidateServerCaches(licenseID string) {
+	servers := getEnv("LICENSIFY_SERVER_URLS", "")
+	if servers == "" {
+		return
+	}
+	apiKey, err := secrets.Get("ADMIN_API_KEY")
+	if err != nil || apiKey == "" {
+		fmt.Println("⚠️  ADMIN_API_KEY is not set, so running servers keep the license cached until LICENSE_CACHE_TTL")
+		return
+	}
+
+	body, _ := json.Marshal(map[string]string{"license_key": licenseID})
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, server := range strings.Split(servers, ",") {
+		server = strings.TrimRight(strings.TrimSpace(server), "/")
+		if server == "" {
+			continue
+		}
+		if err := postCacheInvalidate(client, server, apiKey, body); err != nil {
+			fmt.Printf("⚠️  Failed to invalidate the license cache on %s: %v\n", server, err)
+		}
+	}
 }
 
-func initSchema() error {
-	// Load and execute schema from SQL files
-	var schemaPath string
-	if isPostgresDB {
-		schemaPath = "sql/postgres/init.sql"
-	} else {
-		schemaPath = "sql/sqlite/init.sql"
+// postCacheInvalidate sends one POST /admin/cache/invalidate
+func postCacheInvalidate(client *http.Client, server, apiKey string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, server+"/admin/cache/invalidate", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("server returned %s", resp.Status)
 	}
+	return nil
+}
 
-	schema, err := os.ReadFile(schemaPath)
+// revokeLicense deactivates a license and adds it to the revocation list
+// published at GET /revocations
+func revokeLicense(licenseID, reason string) {
+	result, err := db.Exec(fmt.Sprintf("UPDATE licenses SET active = false WHERE license_id = %s", sqlPlaceholder(1)), licenseID)
 	if err != nil {
-		return fmt.Errorf("failed to read schema file %s: %w", schemaPath, err)
+		fatalf("Failed to deactivate license: %v", err)
 	}
 
-	_, err = db.Exec(string(schema))
-	return err
-}
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		fmt.Printf("❌ License not found: %s\n", licenseID)
+		os.Exit(1)
+	}
 
-func sqlPlaceholder(n int) string {
-	if isPostgresDB {
-		return fmt.Sprintf("$%d", n)
+	if err := store.AddRevocation(licenseID, reason); err != nil {
+		fatalf("Failed to revoke license: %v", err)
 	}
-	return "?"
 }
 
-func generateLicenseKey(tier string) string {
+func handleActivate() {
+	fs := flag.NewFlagSet("activate", flag.ExitOnError)
+	license := fs.String("license", "", "License key (required)")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *license == "" {
+		fmt.Println("Error: -license is required")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	result, err := db.Exec(fmt.Sprintf("UPDATE licenses SET active = true WHERE license_id = %s", sqlPlaceholder(1)), *license)
+	if err != nil {
+		fatalf("Failed to activate license: %v", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		fmt.Printf("❌ License not found: %s\n", *license)
+		os.Exit(1)
+	}
+
+	if _, err := store.RemoveRevocation(*license); err != nil {
+		fatalf("Failed to lift revocation: %v", err)
+	}
+	recordAudit("activate", *license, flagDetails(fs))
+	invalidateServerCaches(*license)
+
+	fmt.Printf("✅ License activated: %s\n", *license)
+}
+
+func handleSeats() {
+	fs := flag.NewFlagSet("seats", flag.ExitOnError)
+	license := fs.String("license", "", "License key (required)")
+	seats := fs.Int("seats", 0, "Purchased seat count, sets max activations (required)")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *license == "" || *seats < 1 {
+		fmt.Println("Error: -license and -seats (at least 1) are required")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	result, err := db.Exec(fmt.Sprintf("UPDATE licenses SET max_activations = %s WHERE license_id = %s", sqlPlaceholder(1), sqlPlaceholder(2)), *seats, *license)
+	if err != nil {
+		fatalf("Failed to update seats: %v", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		fmt.Printf("❌ License not found: %s\n", *license)
+		os.Exit(1)
+	}
+
+	recordAudit("seats", *license, flagDetails(fs))
+	invalidateServerCaches(*license)
+
+	var count int
+	_ = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s", sqlPlaceholder(1)), *license).Scan(&count)
+
+	fmt.Printf("✅ Seats set to %d for %s (%d devices activated)\n", *seats, *license, count)
+	if count > *seats {
+		fmt.Println("⚠️  License is over-provisioned: existing devices keep working, new activations are blocked")
+	}
+}
+
+func handleIssueOffline() {
+	fs := flag.NewFlagSet("issue-offline", flag.ExitOnError)
+	license := fs.String("license", "", "License key (required)")
+	hardwareID := fs.String("hardware-id", "", "Hardware ID of the offline machine (required)")
+	out := fs.String("out", "license.lic", "Output file")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *license == "" || *hardwareID == "" {
+		fmt.Println("Error: -license and -hardware-id are required")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	privateKey, err := loadPrivateKey()
+	if err != nil {
+		fatalf("Signing key error: %v", err)
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	lic, err := store.GetLicense(*license)
+	if errors.Is(err, database.ErrLicenseNotFound) {
+		fmt.Printf("❌ License not found: %s\n", *license)
+		os.Exit(1)
+	} else if err != nil {
+		fatalf("Failed to get license: %v", err)
+	}
+	if !lic.Active {
+		fmt.Printf("❌ License is inactive: %s\n", *license)
+		os.Exit(1)
+	}
+	if time.Now().After(lic.ExpiresAt) {
+		fmt.Printf("❌ License expired on %s\n", lic.ExpiresAt.Format("2006-01-02"))
+		os.Exit(1)
+	}
+
+	products, err := store.GetLicenseProducts(*license)
+	if err != nil {
+		fatalf("Failed to get products: %v", err)
+	}
+	if len(products) == 0 {
+		products = []string{getEnv("DEFAULT_PRODUCT", "default")}
+	}
+
+	// The offline machine takes a seat like any online activation
+	var activated, count int
+	_ = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s AND hardware_id = %s", sqlPlaceholder(1), sqlPlaceholder(2)), *license, *hardwareID).Scan(&activated)
+	if activated == 0 {
+		_ = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s", sqlPlaceholder(1)), *license).Scan(&count)
+		if lic.MaxActivations != -1 && count >= lic.MaxActivations {
+			fmt.Printf("❌ Activation limit reached (%d/%d devices)\n", count, lic.MaxActivations)
+			os.Exit(1)
+		}
+		if _, err := db.Exec(fmt.Sprintf("INSERT INTO activations (license_id, hardware_id) VALUES (%s, %s)", sqlPlaceholder(1), sqlPlaceholder(2)), *license, *hardwareID); err != nil {
+			fatalf("Failed to record activation: %v", err)
+		}
+	}
+
+	file, err := licensecrypto.SignOfflineLicense(privateKey, licensecrypto.OfflineLicense{
+		LicenseID:      lic.LicenseID,
+		CustomerName:   lic.CustomerName,
+		CustomerEmail:  lic.CustomerEmail,
+		Tier:           lic.Tier,
+		Products:       products,
+		HardwareID:     *hardwareID,
+		DailyLimit:     lic.DailyLimit,
+		MonthlyLimit:   lic.MonthlyLimit,
+		MaxActivations: lic.MaxActivations,
+		ExpiresAt:      lic.ExpiresAt.UTC(),
+		IssuedAt:       time.Now().UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		fatalf("Failed to sign license: %v", err)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		fatalf("Failed to encode license: %v", err)
+	}
+	if err := os.WriteFile(*out, append(data, '\n'), 0644); err != nil {
+		fatalf("Failed to write %s: %v", *out, err)
+	}
+	recordAudit("issue-offline", *license, flagDetails(fs))
+
+	fmt.Printf("✅ Offline license for %s written to %s\n", *license, *out)
+	fmt.Printf("   Hardware ID: %s\n", *hardwareID)
+	fmt.Printf("   Expires:     %s\n", lic.ExpiresAt.Format("2006-01-02"))
+	fmt.Printf("   Public key:  %s\n", file.PublicKey)
+	fmt.Println("   Share the public key with the customer separately so they can verify the file")
+}
+
+// loadPrivateKey returns the server's Ed25519 signing key: the primary key of
+// the KEYRING_PATH keyring if set, otherwise PRIVATE_KEY
+func loadPrivateKey() (ed25519.PrivateKey, error) {
+	if path := os.Getenv("KEYRING_PATH"); path != "" {
+		keyring, err := licensecrypto.LoadKeyring(path)
+		if err != nil {
+			return nil, err
+		}
+		return keyring.Primary, nil
+	}
+	return loadPrivateKeyFromEnv()
+}
+
+// loadPrivateKeyFromEnv decodes the signing key from PRIVATE_KEY
+func loadPrivateKeyFromEnv() (ed25519.PrivateKey, error) {
+	encoded, err := secrets.Get("PRIVATE_KEY")
+	if err != nil {
+		return nil, err
+	}
+	if encoded == "" {
+		return nil, fmt.Errorf("PRIVATE_KEY is not set")
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("PRIVATE_KEY is not valid base64: %w", err)
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("PRIVATE_KEY has invalid length: got %d, want %d bytes", len(key), ed25519.PrivateKeySize)
+	}
+	return ed25519.PrivateKey(key), nil
+}
+
+func handleKeys() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: licensify-admin keys <subcommand>")
+		fmt.Println()
+		fmt.Println("Subcommands:")
+		fmt.Println("  init      Create a keyring file, from PRIVATE_KEY or a new key")
+		fmt.Println("  rotate    Replace the signing key, keeping the old public key for verification")
+		fmt.Println("  list      Show the signing key and retired keys")
+		fmt.Println()
+		fmt.Println("Examples:")
+		fmt.Println("  licensify-admin keys init -keyring keyring.json -from-env")
+		fmt.Println("  licensify-admin keys rotate -keyring keyring.json")
+		fmt.Println("  licensify-admin keys list")
+		os.Exit(1)
+	}
+
+	subcommand := os.Args[2]
+	fs := flag.NewFlagSet("keys "+subcommand, flag.ExitOnError)
+	path := fs.String("keyring", os.Getenv("KEYRING_PATH"), "Keyring file (default: KEYRING_PATH)")
+	var fromEnv *bool
+	switch subcommand {
+	case "init":
+		fromEnv = fs.Bool("from-env", false, "Start from the current PRIVATE_KEY instead of a new key")
+	case "rotate", "list":
+	default:
+		fmt.Printf("Unknown keys subcommand: %s\n", subcommand)
+		os.Exit(1)
+	}
+
+	_ = fs.Parse(os.Args[3:])
+
+	if *path == "" {
+		usageError(fs, "-keyring or KEYRING_PATH is required")
+	}
+
+	switch subcommand {
+	case "init":
+		if _, err := os.Stat(*path); err == nil {
+			failf("%s already exists; use 'keys rotate' to replace its key", *path)
+		}
+		var keyring *licensecrypto.Keyring
+		if *fromEnv {
+			key, err := loadPrivateKeyFromEnv()
+			if err != nil {
+				fatalf("Signing key error: %v", err)
+			}
+			keyring = &licensecrypto.Keyring{Primary: key}
+		} else {
+			var err error
+			if keyring, err = licensecrypto.NewKeyring(); err != nil {
+				fatalf("Failed to create keyring: %v", err)
+			}
+		}
+		if err := keyring.Save(*path); err != nil {
+			fatalf("Failed to save keyring: %v", err)
+		}
+		fmt.Printf("✅ Keyring written to %s\n", *path)
+		fmt.Printf("   Public key: %s\n", base64.StdEncoding.EncodeToString(keyring.PublicKey()))
+		fmt.Println("   Set KEYRING_PATH to this file on the server and remove PRIVATE_KEY")
+
+	case "rotate":
+		keyring, err := licensecrypto.RotateKey(*path)
+		if err != nil {
+			fatalf("Failed to rotate key: %v", err)
+		}
+		retired := keyring.Retired[len(keyring.Retired)-1]
+		fmt.Printf("✅ Signing key rotated in %s\n", *path)
+		fmt.Printf("   New public key:     %s\n", base64.StdEncoding.EncodeToString(keyring.PublicKey()))
+		fmt.Printf("   Retired public key: %s\n", base64.StdEncoding.EncodeToString(retired.PublicKey))
+		fmt.Println("   Restart the server to start signing with the new key.")
+		fmt.Println("   Clients that pinned the old key must be given the new one, e.g.")
+		fmt.Println("   licensify config set public-key <new public key>")
+
+	case "list":
+		keyring, err := licensecrypto.LoadKeyring(*path)
+		if err != nil {
+			fatalf("Failed to load keyring: %v", err)
+		}
+		if jsonOutput {
+			retired := make([]map[string]interface{}, 0, len(keyring.Retired))
+			for _, r := range keyring.Retired {
+				retired = append(retired, map[string]interface{}{
+					"public_key": base64.StdEncoding.EncodeToString(r.PublicKey),
+					"retired_at": r.RetiredAt,
+				})
+			}
+			writeJSON(map[string]interface{}{
+				"public_key": base64.StdEncoding.EncodeToString(keyring.PublicKey()),
+				"retired":    retired,
+			})
+			return
+		}
+		fmt.Printf("Signing key: %s\n", base64.StdEncoding.EncodeToString(keyring.PublicKey()))
+		if len(keyring.Retired) == 0 {
+			fmt.Println("No retired keys")
+			return
+		}
+		fmt.Println("Retired keys (still accepted for verification):")
+		for i := len(keyring.Retired) - 1; i >= 0; i-- {
+			r := keyring.Retired[i]
+			fmt.Printf("  %s  retired %s\n", base64.StdEncoding.EncodeToString(r.PublicKey), r.RetiredAt.Format("2006-01-02 15:04"))
+		}
+	}
+}
+
+func handleActivations() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: licensify-admin activations <subcommand>")
+		fmt.Println()
+		fmt.Println("Subcommands:")
+		fmt.Println("  list      List the devices activated for a license")
+		fmt.Println("  reset     Remove one or all device activations")
+		fmt.Println()
+		fmt.Println("Examples:")
+		fmt.Println("  licensify-admin activations list -license LIC-xxx")
+		fmt.Println("  licensify-admin activations reset -license LIC-xxx -hardware-id hw-abc123")
+		fmt.Println("  licensify-admin activations reset -license LIC-xxx")
+		os.Exit(1)
+	}
+
+	subcommand := os.Args[2]
+	fs := flag.NewFlagSet("activations "+subcommand, flag.ExitOnError)
+	license := fs.String("license", "", "License key (required)")
+	var showIDs, yes *bool
+	var hardwareID *string
+	switch subcommand {
+	case "list":
+		showIDs = fs.Bool("show-ids", false, "Show full hardware IDs instead of redacted ones")
+	case "reset":
+		hardwareID = fs.String("hardware-id", "", "Remove only this device (default: all devices)")
+		yes = fs.Bool("yes", false, "Skip the confirmation prompt")
+	default:
+		fmt.Printf("Unknown activations subcommand: %s\n", subcommand)
+		os.Exit(1)
+	}
+
+	_ = fs.Parse(os.Args[3:])
+
+	if *license == "" {
+		fmt.Println("Error: -license is required")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	lic, err := store.GetLicense(*license)
+	if errors.Is(err, database.ErrLicenseNotFound) {
+		fmt.Printf("❌ License not found: %s\n", *license)
+		os.Exit(1)
+	} else if err != nil {
+		fatalf("Failed to get license: %v", err)
+	}
+
+	if subcommand == "list" {
+		activations, err := store.ListActivations(*license)
+		if err != nil {
+			fatalf("Failed to list activations: %v", err)
+		}
+
+		fmt.Printf("Activations for %s (%d of %s):\n", *license, len(activations), formatLimit(lic.MaxActivations))
+		fmt.Println(strings.Repeat("-", 80))
+		fmt.Printf("%-40s %-20s %-20s\n", "Hardware ID", "Activated", "Last Check-in")
+		fmt.Println(strings.Repeat("-", 80))
+		for _, a := range activations {
+			id := redactHardwareID(a.HardwareID)
+			if *showIDs {
+				id = a.HardwareID
+			}
+			fmt.Printf("%-40s %-20s %-20s\n", truncate(id, 40), formatTimestamp(a.ActivatedAt), formatTimestamp(a.LastCheckIn))
+		}
+		fmt.Println(strings.Repeat("-", 80))
+		return
+	}
+
+	prompt := fmt.Sprintf("⚠️  This will remove device %s from %s. Continue?", redactHardwareID(*hardwareID), *license)
+	if *hardwareID == "" {
+		prompt = fmt.Sprintf("⚠️  This will remove ALL device activations for %s. Continue?", *license)
+	}
+	if !confirm(prompt, *yes) {
+		fmt.Println("Reset cancelled")
+		return
+	}
+
+	removed, err := store.DeleteActivations(*license, *hardwareID)
+	if err != nil {
+		fatalf("Failed to reset activations: %v", err)
+	}
+	if removed > 0 {
+		details := flagDetails(fs)
+		details["removed"] = removed
+		recordAudit("activations reset", *license, details)
+	}
+	if *hardwareID != "" {
+		if removed == 0 {
+			fmt.Printf("❌ Device %s is not activated for %s\n", redactHardwareID(*hardwareID), *license)
+			os.Exit(1)
+		}
+		fmt.Printf("✅ Removed device %s from %s\n", redactHardwareID(*hardwareID), *license)
+		return
+	}
+	fmt.Printf("✅ Removed %d device activations from %s\n", removed, *license)
+}
+
+// redactHardwareID shortens a hardware ID to its first 8 and last 4
+// characters, enough for support staff to match it with the customer
+func redactHardwareID(id string) string {
+	return redact.Ends(id, 8, 4)
+}
+
+// formatTimestamp formats a database timestamp, or "-" when it is unset
+func formatTimestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04:05")
+}
+
+// legacyMapping describes how a CSV/JSON export from another licensing
+// system maps onto Licensify licenses (see legacy-map.example.toml)
+type legacyMapping struct {
+	Format      string            `toml:"format"`       // "csv" or "json"; inferred from the file extension when empty
+	Columns     legacyColumns     `toml:"columns"`      // source column (or JSON key) for each Licensify field
+	DateFormats []string          `toml:"date_formats"` // Go layouts tried in order for expires_at
+	TierMap     map[string]string `toml:"tier_map"`     // source plan name -> Licensify tier
+	DefaultTier string            `toml:"default_tier"` // used when the tier column is empty
+}
+
+type legacyColumns struct {
+	LicenseID      string `toml:"license_id"`
+	Email          string `toml:"email"`
+	Name           string `toml:"name"`
+	Tier           string `toml:"tier"`
+	ExpiresAt      string `toml:"expires_at"`
+	DailyLimit     string `toml:"daily_limit"`
+	MonthlyLimit   string `toml:"monthly_limit"`
+	MaxActivations string `toml:"max_activations"`
+	Active         string `toml:"active"`
+}
+
+// legacyLicense is a validated row ready to be inserted
+type legacyLicense struct {
+	Row            int
+	LicenseID      string
+	Name           string
+	Email          string
+	Tier           string
+	ExpiresAt      time.Time
+	DailyLimit     int
+	MonthlyLimit   int
+	MaxActivations int
+	Active         bool
+}
+
+func handleProducts() {
+	fs := flag.NewFlagSet("products", flag.ExitOnError)
+	licenseID := fs.String("license", "", "License key (required)")
+	set := fs.String("set", "", "Replace the entitlements with these comma-separated product IDs")
+	add := fs.String("add", "", "Comma-separated product IDs to add")
+	remove := fs.String("remove", "", "Comma-separated product IDs to remove")
+	reset := fs.Bool("reset", false, "Remove all entitlements so the license only covers DEFAULT_PRODUCT")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *licenseID == "" {
+		fmt.Println("Error: -license is required")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+	if *reset && (*set != "" || *add != "" || *remove != "") {
+		fmt.Println("Error: -reset cannot be combined with -set, -add or -remove")
+		os.Exit(1)
+	}
+	if *set != "" && (*add != "" || *remove != "") {
+		fmt.Println("Error: -set cannot be combined with -add or -remove")
+		os.Exit(1)
+	}
+
+	setIDs := parseProductsFlag("set", *set)
+	addIDs := parseProductsFlag("add", *add)
+	removeIDs := parseProductsFlag("remove", *remove)
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	var exists int
+	_ = db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM licenses WHERE license_id = %s", sqlPlaceholder(1)), *licenseID).Scan(&exists)
+	if exists == 0 {
+		fmt.Printf("❌ License not found: %s\n", *licenseID)
+		os.Exit(1)
+	}
+
+	current, err := store.GetLicenseProducts(*licenseID)
+	if err != nil {
+		fatalf("Failed to get products: %v", err)
+	}
+
+	if !*reset && *set == "" && *add == "" && *remove == "" {
+		fmt.Printf("Products for %s: %s\n", *licenseID, formatProducts(current))
+		return
+	}
+
+	var products []string
+	switch {
+	case *reset:
+		// No entitlements: back to the default product
+	case *set != "":
+		products = setIDs
+	default:
+		drop := make(map[string]bool)
+		for _, id := range removeIDs {
+			drop[id] = true
+		}
+		for _, id := range append(current, addIDs...) {
+			if !drop[id] {
+				products = append(products, id)
+			}
+		}
+		// Normalize the merged list (sort and de-duplicate)
+		products, _ = database.ParseProductIDs(strings.Join(products, ","))
+	}
+
+	if err := store.SetLicenseProducts(*licenseID, products); err != nil {
+		fatalf("Failed to update products: %v", err)
+	}
+	details := flagDetails(fs)
+	details["products"] = products
+	recordAudit("products", *licenseID, details)
+
+	fmt.Printf("✅ Products for %s: %s\n", *licenseID, formatProducts(products))
+	fmt.Println("   Clients see the change on their next activation or check.")
+}
+
+// parseProductsFlag parses a comma-separated product flag, exiting on invalid IDs
+func parseProductsFlag(name, value string) []string {
+	products, err := database.ParseProductIDs(value)
+	if err != nil {
+		fmt.Printf("Error: -%s: %v\n", name, err)
+		os.Exit(1)
+	}
+	return products
+}
+
+func handleMigrateSchema() {
+	fs := flag.NewFlagSet("migrate-schema", flag.ExitOnError)
+	status := fs.Bool("status", false, "Show applied and pending migrations without applying them")
+
+	_ = fs.Parse(os.Args[2:])
+
+	// Connect without migrating so -status reports the schema as it is
+	if err := openDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	if !*status {
+		applied, err := migrations.Migrate(db, isPostgresDB)
+		for _, m := range applied {
+			fmt.Printf("✅ Applied %s\n", m)
+		}
+		if err != nil {
+			fatalf("Migration error: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("Schema is up to date")
+		} else {
+			fmt.Printf("Applied %d migration(s)\n", len(applied))
+		}
+		return
+	}
+
+	statuses, err := migrations.List(db, isPostgresDB)
+	if err != nil {
+		fatalf("Failed to read migrations: %v", err)
+	}
+
+	fmt.Println("Schema migrations:")
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("%-40s %-8s %s\n", "Migration", "Status", "Applied At")
+	fmt.Println(strings.Repeat("-", 70))
+	pending := 0
+	for _, st := range statuses {
+		state := "applied"
+		if !st.Applied {
+			state = "pending"
+			pending++
+		}
+		fmt.Printf("%-40s %-8s %s\n", st.Migration, state, st.AppliedAt)
+	}
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("Pending: %d\n", pending)
+}
+
+// importRow is a validated row of an import CSV
+type importRow struct {
+	Row        int // line in the CSV file
+	Email      string
+	Name       string
+	Tier       string
+	Months     int
+	LicenseKey string
+}
+
+func handleImport() {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	file := fs.String("file", "", "CSV file with email,name,tier,months rows (required)")
+	continueOnError := fs.Bool("continue-on-error", false, "Create the valid rows even if some rows fail")
+	duplicates := fs.String("duplicates", "error", "Rows whose email already has a license: error or skip")
+	sendEmail := fs.Bool("send-email", false, "Email each customer their new license key")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *file == "" {
+		usageError(fs, "-file is required")
+	}
+	if *duplicates != "error" && *duplicates != "skip" {
+		usageError(fs, "-duplicates must be error or skip")
+	}
+
+	// Load tier configuration
+	tiersPath := getEnv("TIERS_CONFIG_PATH", "tiers.toml")
+	if err := tierRegistry.LoadWithFallback(tiersPath); err != nil {
+		fatalf("Failed to load tier configuration: %v", err)
+	}
+	var mailer *email.Client
+	if *sendEmail {
+		mailer = newMailer()
+	}
+
+	records, failed, err := readImportCSV(*file)
+	if err != nil {
+		fatalf("Failed to read %s: %v", *file, err)
+	}
+	if len(records) == 0 && len(failed) == 0 {
+		fmt.Printf("✅ No rows found in %s\n", *file)
+		return
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// Validate every row before creating anything
+	existsQuery := fmt.Sprintf("SELECT COUNT(*) FROM licenses WHERE LOWER(customer_email) = %s", sqlPlaceholder(1))
+	seen := make(map[string]int)
+	var valid []importRow
+	var skipped []string
+	for _, record := range records {
+		row := record.Line
+		r, err := parseImportRow(record.Fields)
+		if err == nil {
+			key := strings.ToLower(r.Email)
+			var count int
+			if first, dup := seen[key]; dup {
+				err = fmt.Errorf("duplicate email %s (first seen on line %d)", r.Email, first)
+			} else if qErr := db.QueryRow(existsQuery, key).Scan(&count); qErr != nil {
+				fatalf("Failed to check existing licenses: %v", qErr)
+			} else if count > 0 {
+				err = fmt.Errorf("%s already has a license", r.Email)
+			}
+			if err != nil && *duplicates == "skip" {
+				skipped = append(skipped, fmt.Sprintf("line %d: %v", row, err))
+				continue
+			}
+		}
+		if err != nil {
+			failed = append(failed, fmt.Sprintf("line %d: %v", row, err))
+			continue
+		}
+		seen[strings.ToLower(r.Email)] = row
+		r.Row = row
+		valid = append(valid, r)
+	}
+
+	if len(failed) > 0 && !*continueOnError {
+		printImportSummary(*file, nil, skipped, failed)
+		fmt.Println("\n❌ Nothing imported. Fix the rows above or re-run with -continue-on-error")
+		os.Exit(1)
+	}
+
+	// Create all licenses in one transaction so a failure leaves nothing half-imported
+	tx, err := db.Begin()
+	if err != nil {
+		fatalf("Failed to start transaction: %v", err)
+	}
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO licenses (
+			license_id, customer_name, customer_email, tier,
+			expires_at, daily_limit, monthly_limit, max_activations, active
+		) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, true)
+		ON CONFLICT (license_id) DO NOTHING
+	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4),
+		sqlPlaceholder(5), sqlPlaceholder(6), sqlPlaceholder(7), sqlPlaceholder(8))
+
+	for i := range valid {
+		r := &valid[i]
+		tierConfig, _ := tierRegistry.Get(r.Tier)
+
+		r.LicenseKey, err = insertWithNewKey(r.Tier, func(licenseKey string) (sql.Result, error) {
+			return tx.Exec(insertQuery, licenseKey, r.Name, r.Email, r.Tier, licenseExpiry(r.Months),
+				tierConfig.DailyLimit, tierConfig.MonthlyLimit, tierConfig.MaxDevices)
+		})
+		if err != nil {
+			_ = tx.Rollback()
+			fatalf("Failed to create license for line %d (%s), nothing imported: %v", r.Row, r.Email, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		fatalf("Failed to commit import: %v", err)
+	}
+	for _, r := range valid {
+		details := flagDetails(fs)
+		details["line"] = r.Row
+		details["email"] = r.Email
+		details["tier"] = r.Tier
+		details["months"] = r.Months
+		recordAudit("import", r.LicenseKey, details)
+	}
+
+	printImportSummary(*file, valid, skipped, failed)
+
+	if *sendEmail && len(valid) > 0 {
+		if mailer == nil {
+			fmt.Println("\n⚠️  Emails not sent: SMTP_HOST or RESEND_API_KEY, and FROM_EMAIL, are not configured")
+			return
+		}
+
+		fmt.Println()
+		sent := 0
+		for _, r := range valid {
+			if err := mailer.SendWelcome(r.Email, r.Name, r.Tier, r.LicenseKey, licenseExpiry(r.Months).Format("January 2, 2006")); err != nil {
+				fmt.Printf("⚠️  Failed to email %s: %v\n", r.Email, err)
+				continue
+			}
+			sent++
+		}
+		fmt.Printf("📧 Emailed %d of %d customers\n", sent, len(valid))
+	}
+}
+
+// importRecord is a raw CSV record and the line it starts on
+type importRecord struct {
+	Line   int
+	Fields []string
+}
+
+// readImportCSV reads an import file, skipping an optional header row.
+// Records that are not valid CSV are returned as failures so the rest of
+// the file can still be checked.
+func readImportCSV(path string) ([]importRecord, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1 // field counts are checked per row
+	reader.TrimLeadingSpace = true
+
+	var records []importRecord
+	var failed []string
+	for {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			failed = append(failed, fmt.Sprintf("line %d: %v", parseErr.StartLine, parseErr.Err))
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(records) == 0 && len(failed) == 0 && strings.EqualFold(strings.TrimSpace(fields[0]), "email") {
+			continue // header row
+		}
+		records = append(records, importRecord{Line: line, Fields: fields})
+	}
+	return records, failed, nil
+}
+
+// parseImportRow validates one email,name,tier[,months] CSV record.
+// months defaults to 12 and 0 means lifetime, as with create.
+func parseImportRow(record []string) (importRow, error) {
+	if len(record) < 3 || len(record) > 4 {
+		return importRow{}, fmt.Errorf("expected email,name,tier,months but got %d fields", len(record))
+	}
+	r := importRow{
+		Email:  strings.TrimSpace(record[0]),
+		Name:   strings.TrimSpace(record[1]),
+		Tier:   strings.TrimSpace(record[2]),
+		Months: 12,
+	}
+	if !strings.Contains(r.Email, "@") {
+		return r, fmt.Errorf("invalid email %q", r.Email)
+	}
+	if r.Name == "" {
+		return r, fmt.Errorf("name is required")
+	}
+	if !tierRegistry.Exists(r.Tier) {
+		return r, fmt.Errorf("unknown tier %q", r.Tier)
+	}
+	if len(record) == 4 && strings.TrimSpace(record[3]) != "" {
+		months, err := strconv.Atoi(strings.TrimSpace(record[3]))
+		if err != nil || months < 0 {
+			return r, fmt.Errorf("invalid months %q", record[3])
+		}
+		r.Months = months
+	}
+	return r, nil
+}
+
+func printImportSummary(file string, created []importRow, skipped, failed []string) {
+	fmt.Printf("\n📋 Import Summary: %s\n", file)
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("Created:  %d\n", len(created))
+	fmt.Printf("Skipped:  %d\n", len(skipped))
+	fmt.Printf("Failed:   %d\n", len(failed))
+	if len(created) > 0 {
+		fmt.Println()
+		for _, r := range created {
+			fmt.Printf("  ✅ line %d: %s  %s (%s)\n", r.Row, r.LicenseKey, r.Email, r.Tier)
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Println()
+		for _, msg := range skipped {
+			fmt.Printf("  ⏭️  %s\n", msg)
+		}
+	}
+	if len(failed) > 0 {
+		fmt.Println()
+		for _, msg := range failed {
+			fmt.Printf("  ❌ %s\n", msg)
+		}
+	}
+	fmt.Println(strings.Repeat("=", 80))
+}
+
+// exportHeader opens a JSON export; licenses are streamed into its array
+type exportHeader struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+}
+
+const (
+	exportFormat  = "licensify-export"
+	exportVersion = 1
+)
+
+// exportCSVColumns is the header of a CSV export. Products are space separated.
+var exportCSVColumns = []string{
+	"license_id", "customer_name", "customer_email", "tier", "expires_at", "created_at",
+	"daily_limit", "monthly_limit", "max_activations", "active", "encryption_salt",
+	"previous_daily_limit", "previous_monthly_limit", "limits_changed_on", "products",
+}
+
+func handleExport() {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", "json", "Output format: json or csv")
+	output := fs.String("o", "", "Write to this file instead of stdout")
+	withActivations := fs.Bool("activations", false, "Include device activations (json only)")
+	withUsage := fs.Bool("usage", false, "Include daily usage (json only)")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *format != "json" && *format != "csv" {
+		usageError(fs, "-format must be json or csv")
+	}
+	if *format == "csv" && (*withActivations || *withUsage) {
+		usageError(fs, "-activations and -usage require -format json")
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	out := os.Stdout
+	if *output != "" {
+		f, err := os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			fatalf("Failed to create %s: %v", *output, err)
+		}
+		out = f
+	}
+	w := bufio.NewWriter(out)
+
+	opts := database.ExportOptions{Activations: *withActivations, Usage: *withUsage}
+	var count int
+	var err error
+	if *format == "csv" {
+		count, err = exportCSV(w, store, opts)
+	} else {
+		count, err = exportJSON(w, store, opts)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if *output != "" {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		fatalf("Export failed: %v", err)
+	}
+
+	// Keep stdout clean for the export itself
+	if *output != "" {
+		fmt.Printf("✅ Exported %d licenses to %s\n", count, *output)
+	} else {
+		fmt.Fprintf(os.Stderr, "✅ Exported %d licenses\n", count)
+	}
+}
+
+// exportJSON writes the header and then one license at a time, so the whole
+// export is never held in memory
+func exportJSON(w io.Writer, store *database.DB, opts database.ExportOptions) (int, error) {
+	header, err := json.Marshal(exportHeader{Format: exportFormat, Version: exportVersion, ExportedAt: time.Now().UTC()})
+	if err != nil {
+		return 0, err
+	}
+	// Reopen the header object to append the licenses array
+	if _, err := fmt.Fprintf(w, "%s,\"licenses\":[", header[:len(header)-1]); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = store.ExportLicenses(opts, func(l *database.ExportedLicense) error {
+		data, err := json.Marshal(l)
+		if err != nil {
+			return err
+		}
+		sep := "\n"
+		if count > 0 {
+			sep = ",\n"
+		}
+		count++
+		_, err = fmt.Fprintf(w, "%s%s", sep, data)
+		return err
+	})
+	if err != nil {
+		return count, err
+	}
+	_, err = fmt.Fprint(w, "\n]}\n")
+	return count, err
+}
+
+func exportCSV(w io.Writer, store *database.DB, opts database.ExportOptions) (int, error) {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(exportCSVColumns); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err := store.ExportLicenses(opts, func(l *database.ExportedLicense) error {
+		count++
+		return writer.Write([]string{
+			l.LicenseID, l.CustomerName, l.CustomerEmail, l.Tier,
+			l.ExpiresAt.UTC().Format(time.RFC3339Nano), l.CreatedAt.UTC().Format(time.RFC3339Nano),
+			strconv.Itoa(l.DailyLimit), strconv.Itoa(l.MonthlyLimit), strconv.Itoa(l.MaxActivations),
+			strconv.FormatBool(l.Active), l.EncryptionSalt,
+			formatOptionalInt(l.PreviousDailyLimit), formatOptionalInt(l.PreviousMonthlyLimit),
+			l.LimitsChangedOn, strings.Join(l.Products, " "),
+		})
+	})
+	writer.Flush()
+	if err != nil {
+		return count, err
+	}
+	return count, writer.Error()
+}
+
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+func handleImportDump() {
+	fs := flag.NewFlagSet("import-dump", flag.ExitOnError)
+	file := fs.String("file", "", "File written by export (required)")
+	format := fs.String("format", "", "json or csv (default: detected from the file)")
+	skipExisting := fs.Bool("skip-existing", false, "Skip licenses that already exist instead of failing")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *file == "" {
+		usageError(fs, "-file is required")
+	}
+	if *format != "" && *format != "json" && *format != "csv" {
+		usageError(fs, "-format must be json or csv")
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		fatalf("Failed to open %s: %v", *file, err)
+	}
+	defer func() { _ = f.Close() }()
+	r := bufio.NewReader(f)
+
+	if *format == "" {
+		*format = detectDumpFormat(r)
+	}
+	var next func() (*database.ExportedLicense, error)
+	if *format == "json" {
+		next, err = readJSONDump(r)
+	} else {
+		next, err = readCSVDump(r)
+	}
+	if err != nil {
+		failf("%s is not a licensify export: %v", *file, err)
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	result, err := store.RestoreLicenses(*skipExisting, next)
+	if err != nil {
+		failf("Restore failed, nothing was imported: %v", err)
+	}
+	details := flagDetails(fs)
+	details["restored"] = result.Restored
+	details["skipped"] = result.Skipped
+	recordAudit("import-dump", "", details)
+
+	fmt.Printf("✅ Restored %d licenses from %s\n", result.Restored, *file)
+	if result.Skipped > 0 {
+		fmt.Printf("⏭️  Skipped %d licenses that already exist\n", result.Skipped)
+	}
+}
+
+// detectDumpFormat treats a file starting with '{' as JSON and anything else as CSV
+func detectDumpFormat(r *bufio.Reader) string {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return "csv"
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			_, _ = r.ReadByte()
+		case '{':
+			return "json"
+		default:
+			return "csv"
+		}
+	}
+}
+
+// readJSONDump checks the export header and returns a function decoding one
+// license at a time from the licenses array
+func readJSONDump(r io.Reader) (func() (*database.ExportedLicense, error), error) {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	var header exportHeader
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("no licenses array found")
+		}
+		switch key {
+		case "format":
+			err = dec.Decode(&header.Format)
+		case "version":
+			err = dec.Decode(&header.Version)
+		case "licenses":
+			if header.Format != exportFormat {
+				return nil, fmt.Errorf("format is %q, expected %q", header.Format, exportFormat)
+			}
+			if header.Version != exportVersion {
+				return nil, fmt.Errorf("unsupported export version %d", header.Version)
+			}
+			if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+				return nil, fmt.Errorf("licenses is not an array")
+			}
+			return func() (*database.ExportedLicense, error) {
+				if !dec.More() {
+					return nil, io.EOF
+				}
+				var l database.ExportedLicense
+				if err := dec.Decode(&l); err != nil {
+					return nil, fmt.Errorf("invalid license: %w", err)
+				}
+				return &l, nil
+			}, nil
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// readCSVDump checks the header row and returns a function parsing one
+// license per row
+func readCSVDump(r io.Reader) (func() (*database.ExportedLicense, error), error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = len(exportCSVColumns)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if strings.Join(header, ",") != strings.Join(exportCSVColumns, ",") {
+		return nil, fmt.Errorf("unexpected CSV header %q", strings.Join(header, ","))
+	}
+
+	return func() (*database.ExportedLicense, error) {
+		record, err := reader.Read()
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		l, err := parseDumpRow(record)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		return l, nil
+	}, nil
+}
+
+func parseDumpRow(record []string) (*database.ExportedLicense, error) {
+	l := &database.ExportedLicense{
+		LicenseID:       record[0],
+		CustomerName:    record[1],
+		CustomerEmail:   record[2],
+		Tier:            record[3],
+		EncryptionSalt:  record[10],
+		LimitsChangedOn: record[13],
+		Products:        strings.Fields(record[14]),
+	}
+	var err error
+	if l.ExpiresAt, err = time.Parse(time.RFC3339Nano, record[4]); err != nil {
+		return nil, fmt.Errorf("invalid expires_at %q", record[4])
+	}
+	if l.CreatedAt, err = time.Parse(time.RFC3339Nano, record[5]); err != nil {
+		return nil, fmt.Errorf("invalid created_at %q", record[5])
+	}
+	for i, dst := range []*int{&l.DailyLimit, &l.MonthlyLimit, &l.MaxActivations} {
+		if *dst, err = strconv.Atoi(record[6+i]); err != nil {
+			return nil, fmt.Errorf("invalid %s %q", exportCSVColumns[6+i], record[6+i])
+		}
+	}
+	if l.Active, err = strconv.ParseBool(record[9]); err != nil {
+		return nil, fmt.Errorf("invalid active %q", record[9])
+	}
+	for i, dst := range []**int{&l.PreviousDailyLimit, &l.PreviousMonthlyLimit} {
+		if record[11+i] == "" {
+			continue
+		}
+		v, err := strconv.Atoi(record[11+i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", exportCSVColumns[11+i], record[11+i])
+		}
+		*dst = &v
+	}
+	return l, nil
+}
+
+func handleImportLegacy() {
+	fs := flag.NewFlagSet("import-legacy", flag.ExitOnError)
+	file := fs.String("file", "", "CSV or JSON export from the previous system (required)")
+	mapPath := fs.String("map", "", "TOML file mapping source columns to license fields (required)")
+	dryRun := fs.Bool("dry-run", false, "Validate and show what would be imported without making changes")
+	skipInvalid := fs.Bool("skip-invalid", false, "Import valid rows even if some rows fail validation")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *file == "" || *mapPath == "" {
+		fmt.Println("Error: -file and -map are required")
+		fs.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Load tier configuration
+	tiersPath := getEnv("TIERS_CONFIG_PATH", "tiers.toml")
+	if err := tierRegistry.LoadWithFallback(tiersPath); err != nil {
+		fatalf("Failed to load tier configuration: %v", err)
+	}
+
+	mapping, err := loadLegacyMapping(*mapPath, *file)
+	if err != nil {
+		fatalf("Invalid mapping: %v", err)
+	}
+
+	records, err := readLegacyRecords(*file, mapping.Format)
+	if err != nil {
+		fatalf("Failed to read %s: %v", *file, err)
+	}
+	if len(records) == 0 {
+		fmt.Printf("✅ No rows found in %s\n", *file)
+		return
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	// Validate every row before touching the database
+	existsQuery := fmt.Sprintf("SELECT COUNT(*) FROM licenses WHERE license_id = %s", sqlPlaceholder(1))
+	seen := make(map[string]int)
+	var valid []legacyLicense
+	var problems []string
+	for i, record := range records {
+		row := i + 1
+		lic, err := mapping.convert(record)
+		if err == nil {
+			if first, dup := seen[lic.LicenseID]; dup {
+				err = fmt.Errorf("duplicate license_id %s (first seen in row %d)", lic.LicenseID, first)
+			} else {
+				var count int
+				if qErr := db.QueryRow(existsQuery, lic.LicenseID).Scan(&count); qErr != nil {
+					fatalf("Failed to check existing licenses: %v", qErr)
+				}
+				if count > 0 {
+					err = fmt.Errorf("license_id %s already exists", lic.LicenseID)
+				}
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: %v", row, err))
+			continue
+		}
+		seen[lic.LicenseID] = row
+		lic.Row = row
+		valid = append(valid, lic)
+	}
+
+	fmt.Printf("\n📋 Import Report: %s\n", *file)
+	fmt.Println(strings.Repeat("=", 80))
+	fmt.Printf("Rows:     %d\n", len(records))
+	fmt.Printf("Valid:    %d\n", len(valid))
+	fmt.Printf("Invalid:  %d\n", len(problems))
+	if len(problems) > 0 {
+		fmt.Println()
+		for _, p := range problems {
+			fmt.Printf("  ❌ %s\n", p)
+		}
+	}
+	fmt.Println(strings.Repeat("=", 80))
+
+	if len(problems) > 0 && !*skipInvalid {
+		fmt.Println("\n❌ Nothing imported. Fix the rows above or re-run with -skip-invalid")
+		os.Exit(1)
+	}
+	if len(valid) == 0 {
+		fmt.Println("\n✅ Nothing to import")
+		return
+	}
+
+	if *dryRun {
+		fmt.Println("\n🔍 DRY RUN - No changes will be made")
+		fmt.Println("\nLicenses that would be imported:")
+		for _, lic := range valid {
+			fmt.Printf("  %d. %s - %s (%s) - %s - Expires: %s\n",
+				lic.Row, lic.LicenseID, lic.Name, lic.Email, lic.Tier, lic.ExpiresAt.Format("2006-01-02"))
+		}
+		fmt.Println("\nRun without -dry-run to perform the import")
+		return
+	}
+
+	// Import all rows in one transaction so a failure leaves nothing half-imported
+	tx, err := db.Begin()
+	if err != nil {
+		fatalf("Failed to start transaction: %v", err)
+	}
+	insertQuery := fmt.Sprintf(`
+		INSERT INTO licenses (
+			license_id, customer_name, customer_email, tier,
+			expires_at, daily_limit, monthly_limit, max_activations, active
+		) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s)
+	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4),
+		sqlPlaceholder(5), sqlPlaceholder(6), sqlPlaceholder(7), sqlPlaceholder(8), sqlPlaceholder(9))
+
+	for _, lic := range valid {
+		if _, err := tx.Exec(insertQuery, lic.LicenseID, lic.Name, lic.Email, lic.Tier,
+			lic.ExpiresAt, lic.DailyLimit, lic.MonthlyLimit, lic.MaxActivations, lic.Active); err != nil {
+			_ = tx.Rollback()
+			fatalf("Failed to import row %d (%s), nothing imported: %v", lic.Row, lic.LicenseID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		fatalf("Failed to commit import: %v", err)
+	}
+	for _, lic := range valid {
+		details := flagDetails(fs)
+		details["row"] = lic.Row
+		details["tier"] = lic.Tier
+		recordAudit("import-legacy", lic.LicenseID, details)
+	}
+
+	fmt.Printf("\n✅ Imported %d licenses", len(valid))
+	if len(problems) > 0 {
+		fmt.Printf(" (%d invalid rows skipped)", len(problems))
+	}
+	fmt.Println()
+}
+
+// loadLegacyMapping reads and checks a mapping file, filling in defaults
+func loadLegacyMapping(path, dataFile string) (*legacyMapping, error) {
+	var m legacyMapping
+	if _, err := toml.DecodeFile(path, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if m.Format == "" {
+		m.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(dataFile)), ".")
+	}
+	if m.Format != "csv" && m.Format != "json" {
+		return nil, fmt.Errorf("format must be \"csv\" or \"json\", got %q", m.Format)
+	}
+	if m.Columns.LicenseID == "" || m.Columns.Email == "" {
+		return nil, fmt.Errorf("columns.license_id and columns.email are required")
+	}
+	if m.Columns.Tier == "" && m.DefaultTier == "" {
+		return nil, fmt.Errorf("set columns.tier or default_tier")
+	}
+	if m.DefaultTier != "" && !tierRegistry.Exists(m.DefaultTier) {
+		return nil, fmt.Errorf("default_tier %q not found. Available tiers: %v", m.DefaultTier, tierRegistry.List())
+	}
+	for from, to := range m.TierMap {
+		if !tierRegistry.Exists(to) {
+			return nil, fmt.Errorf("tier_map %q -> %q: tier not found. Available tiers: %v", from, to, tierRegistry.List())
+		}
+	}
+	if len(m.DateFormats) == 0 {
+		m.DateFormats = []string{time.RFC3339, "2006-01-02"}
+	}
+	return &m, nil
+}
+
+// readLegacyRecords loads rows as column -> value maps. CSV files must have
+// a header row; JSON files must contain an array of objects.
+func readLegacyRecords(path, format string) ([]map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var records []map[string]string
+	if format == "csv" {
+		r := csv.NewReader(f)
+		r.TrimLeadingSpace = true
+		rows, err := r.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			return nil, nil
+		}
+		header := rows[0]
+		for _, row := range rows[1:] {
+			record := make(map[string]string, len(header))
+			for i, col := range header {
+				record[strings.TrimSpace(col)] = strings.TrimSpace(row[i])
+			}
+			records = append(records, record)
+		}
+		return records, nil
+	}
+
+	var objects []map[string]any
+	dec := json.NewDecoder(f)
+	dec.UseNumber()
+	if err := dec.Decode(&objects); err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		record := make(map[string]string, len(obj))
+		for k, v := range obj {
+			if v != nil {
+				record[k] = strings.TrimSpace(fmt.Sprint(v))
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// convert applies the mapping and transforms to one source row
+func (m *legacyMapping) convert(record map[string]string) (legacyLicense, error) {
+	get := func(column string) string {
+		if column == "" {
+			return ""
+		}
+		return record[column]
+	}
+
+	lic := legacyLicense{
+		LicenseID: get(m.Columns.LicenseID),
+		Email:     get(m.Columns.Email),
+		Name:      get(m.Columns.Name),
+		Active:    true,
+	}
+	if lic.LicenseID == "" {
+		return lic, fmt.Errorf("missing license_id (column %q)", m.Columns.LicenseID)
+	}
+	// The server would reject the key before looking it up
+	if err := licensekey.VerifyChecksum(lic.LicenseID); err != nil {
+		return lic, fmt.Errorf("license_id %s: %w", lic.LicenseID, err)
+	}
+	if !strings.Contains(lic.Email, "@") {
+		return lic, fmt.Errorf("invalid email %q", lic.Email)
+	}
+
+	// Remap the source plan name, falling back to a tier with the same ID
+	sourceTier := get(m.Columns.Tier)
+	switch {
+	case sourceTier == "":
+		lic.Tier = m.DefaultTier
+	case m.TierMap[sourceTier] != "":
+		lic.Tier = m.TierMap[sourceTier]
+	case tierRegistry.Exists(strings.ToLower(sourceTier)):
+		lic.Tier = strings.ToLower(sourceTier)
+	default:
+		return lic, fmt.Errorf("unknown tier %q (add it to tier_map)", sourceTier)
+	}
+	tierConfig, _ := tierRegistry.Get(lic.Tier)
+
+	// Empty expiry means a lifetime license, as with 'create -months 0'
+	lic.ExpiresAt = time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC)
+	if v := get(m.Columns.ExpiresAt); v != "" {
+		parsed := false
+		for _, layout := range m.DateFormats {
+			if t, err := time.Parse(layout, v); err == nil {
+				lic.ExpiresAt = t
+				parsed = true
+				break
+			}
+		}
+		if !parsed {
+			return lic, fmt.Errorf("expires_at %q does not match date_formats %v", v, m.DateFormats)
+		}
+	}
+
+	var err error
+	if lic.DailyLimit, err = parseLegacyLimit(get(m.Columns.DailyLimit), tierConfig.DailyLimit); err != nil {
+		return lic, fmt.Errorf("daily_limit: %w", err)
+	}
+	if lic.MonthlyLimit, err = parseLegacyLimit(get(m.Columns.MonthlyLimit), tierConfig.MonthlyLimit); err != nil {
+		return lic, fmt.Errorf("monthly_limit: %w", err)
+	}
+	if lic.MaxActivations, err = parseLegacyLimit(get(m.Columns.MaxActivations), tierConfig.MaxDevices); err != nil {
+		return lic, fmt.Errorf("max_activations: %w", err)
+	}
+
+	if v := get(m.Columns.Active); v != "" {
+		if lic.Active, err = strconv.ParseBool(v); err != nil {
+			return lic, fmt.Errorf("active must be true or false, got %q", v)
+		}
+	}
+
+	return lic, nil
+}
+
+// parseLegacyLimit parses a limit column; empty uses the tier default and
+// "unlimited" or -1 means no limit
+func parseLegacyLimit(v string, tierDefault int) (int, error) {
+	if v == "" {
+		return tierDefault, nil
+	}
+	if strings.EqualFold(v, "unlimited") {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < -1 {
+		return 0, fmt.Errorf("invalid limit %q", v)
+	}
+	return n, nil
+}
+
+// Helper functions
+
+// getEnv returns the environment variable or a default, using the same
+// variable names and defaults as the server
+// newMailer builds the email client from the same variables as the server,
+// with SMTP_HOST taking precedence over RESEND_API_KEY. It returns nil when
+// email is not configured, and exits on a broken EMAIL_TEMPLATE_DIR before
+// any license is changed.
+func newMailer() *email.Client {
+	from := getEnv("FROM_EMAIL", "")
+	var transport email.Transport
+	if host := getEnv("SMTP_HOST", ""); host != "" {
+		port, err := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+		if err != nil {
+			fatalf("SMTP_PORT must be a number, got %q", os.Getenv("SMTP_PORT"))
+		}
+		password, err := secrets.Get("SMTP_PASS")
+		if err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		}
+		transport = &email.SMTPTransport{
+			Host:     host,
+			Port:     port,
+			Username: getEnv("SMTP_USER", ""),
+			Password: password,
+			Security: getEnv("SMTP_TLS", email.SMTPStartTLS),
+			From:     from,
+		}
+	} else {
+		apiKey, err := secrets.Get("RESEND_API_KEY")
+		if err != nil {
+			fmt.Printf("⚠️  %v\n", err)
+		}
+		if apiKey != "" {
+			transport = email.NewResendTransport(apiKey, from)
+		}
+	}
+	if transport == nil || from == "" {
+		return nil
+	}
+
+	mailer := email.NewClient(transport)
+	templates, err := email.LoadTemplates(os.Getenv("EMAIL_TEMPLATE_DIR"))
+	if err != nil {
+		fatalf("Failed to load email templates: %v", err)
+	}
+	mailer.Templates = templates
+	return mailer
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func initDB() error {
+	if err := openDB(); err != nil {
+		return err
+	}
+
+	// Apply any pending schema migrations
+	if err := initSchema(); err != nil {
+		return fmt.Errorf("failed to initialize schema: %v", err)
+	}
+
+	return nil
+}
+
+// openDB connects to the configured database without touching the schema
+func openDB() error {
+	// DB_PATH matches the server; DATABASE_PATH is still accepted for older setups
+	dbURL := getEnv("DATABASE_URL", "")
+	dbPath := getEnv("DB_PATH", getEnv("DATABASE_PATH", "licensify.db"))
+
+	var err error
+	if dbURL != "" {
+		// PostgreSQL
+		db, err = sql.Open("postgres", dbURL)
+		isPostgresDB = true
+	} else {
+		// SQLite
+		db, err = sql.Open("sqlite", dbPath)
+		isPostgresDB = false
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	store = database.New(db, isPostgresDB)
+
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("failed to ping database: %v", err)
+	}
+
+	return nil
+}
+
+func initSchema() error {
+	_, err := migrations.Migrate(db, isPostgresDB)
+	return err
+}
+
+func sqlPlaceholder(n int) string {
+	if isPostgresDB {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func generateLicenseKey(tier string) string {
 	timestamp := time.Now().Format("200601")
-	tierPrefix := strings.ToUpper(tier[:min(4, len(tier))])
-	return fmt.Sprintf("LIC-%s-%s-%06d", timestamp, tierPrefix, time.Now().Unix()%1000000)
+	random, err := licensekey.RandomString(8)
+	if err != nil {
+		fatalf("%v", err)
+	}
+	return licensekey.AppendChecksum(fmt.Sprintf("LIC-%s-%s-%s", timestamp, licensekey.TierPrefix(tier), random))
 }
 
-func showLicense(licenseID string) {
-	var name, email, tier string
-	var expiresAt, createdAt time.Time
-	var dailyLimit, monthlyLimit, maxActivations int
-	var active bool
+// maxKeyAttempts bounds how often insertWithNewKey regenerates a colliding key
+const maxKeyAttempts = 5
+
+// insertWithNewKey runs insert with freshly generated keys until one is not
+// taken. insert must use ON CONFLICT (license_id) DO NOTHING so a collision
+// shows up as zero affected rows instead of an error, which would also abort
+// a PostgreSQL transaction.
+func insertWithNewKey(tier string, insert func(licenseKey string) (sql.Result, error)) (string, error) {
+	for attempt := 0; attempt < maxKeyAttempts; attempt++ {
+		licenseKey := generateLicenseKey(tier)
+		result, err := insert(licenseKey)
+		if err != nil {
+			return "", err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return "", err
+		} else if n == 1 {
+			return licenseKey, nil
+		}
+	}
+	return "", fmt.Errorf("no unused license key found after %d attempts", maxKeyAttempts)
+}
 
-	query := fmt.Sprintf(`
-		SELECT customer_name, customer_email, tier, expires_at, 
-		       daily_limit, monthly_limit, max_activations, active, created_at
-		FROM licenses WHERE license_id = %s
-	`, sqlPlaceholder(1))
+// licenseDetails is the output of the get command
+type licenseDetails struct {
+	licenseSummary
+	CurrentActivations int                `json:"current_activations"`
+	Products           []string           `json:"products"`
+	LastCheckIn        *time.Time         `json:"last_check_in"` // null if never checked in
+	Activations        []activationOutput `json:"activations"`
+	Usage              recentUsage        `json:"usage"`
+}
 
-	err := db.QueryRow(query, licenseID).Scan(&name, &email, &tier, &expiresAt,
-		&dailyLimit, &monthlyLimit, &maxActivations, &active, &createdAt)
+// activationOutput is a device as shown by get
+type activationOutput struct {
+	HardwareID  string     `json:"hardware_id"`
+	ActivatedAt time.Time  `json:"activated_at"`
+	LastCheckIn *time.Time `json:"last_check_in"` // null if the device never checked in
+}
 
-	if err == sql.ErrNoRows {
-		fmt.Printf("❌ License not found: %s\n", licenseID)
-		os.Exit(1)
+// recentUsage is a license's daily usage over the last days as shown by get.
+// Days without usage are left out of Days.
+type recentUsage struct {
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	TotalScans int        `json:"total_scans"`
+	Days       []usageDay `json:"days"`
+}
+
+type usageDay struct {
+	Date  string `json:"date"`
+	Scans int    `json:"scans"`
+}
+
+// licenseExpiry returns the expiry for a license lasting months from now,
+// with 0 meaning lifetime
+func licenseExpiry(months int) time.Time {
+	if months == 0 {
+		return time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC)
+	}
+	return time.Now().AddDate(0, months, 0)
+}
+
+// recentUsageDays is how many days of usage get shows by default
+const recentUsageDays = 30
+
+// showLicense prints a license with its devices, recent usage and last
+// check-in. With redactPII, the key, customer and hardware IDs are masked so
+// the output can be shared, e.g. in a support ticket.
+func showLicense(licenseID string, usageDays int, redactPII bool) {
+	lic, err := store.GetLicense(licenseID)
+	if errors.Is(err, database.ErrLicenseNotFound) {
+		failf("License not found: %s", licenseID)
 	} else if err != nil {
-		log.Fatalf("Failed to get license: %v", err)
+		fatalf("Failed to get license: %v", err)
 	}
 
-	// Get activation count
-	var activationCount int
+	out := licenseDetails{licenseSummary: newLicenseSummary(*lic)}
+
 	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s", sqlPlaceholder(1))
-	_ = db.QueryRow(countQuery, licenseID).Scan(&activationCount)
+	_ = db.QueryRow(countQuery, licenseID).Scan(&out.CurrentActivations)
+
+	out.Products, err = store.GetLicenseProducts(licenseID)
+	if err != nil {
+		fatalf("Failed to get products: %v", err)
+	}
+	if out.Products == nil {
+		out.Products = []string{}
+	}
+
+	lastCheckIn, err := store.GetLastCheckIn(licenseID)
+	if err != nil {
+		fatalf("Failed to get last check-in: %v", err)
+	}
+	if !lastCheckIn.IsZero() {
+		out.LastCheckIn = &lastCheckIn
+	}
+
+	activations, err := store.ListActivations(licenseID)
+	if err != nil {
+		fatalf("Failed to list activations: %v", err)
+	}
+	out.Activations = []activationOutput{}
+	for _, a := range activations {
+		device := activationOutput{HardwareID: a.HardwareID, ActivatedAt: a.ActivatedAt}
+		if redactPII {
+			device.HardwareID = redactHardwareID(a.HardwareID)
+		}
+		if !a.LastCheckIn.IsZero() {
+			lastSeen := a.LastCheckIn
+			device.LastCheckIn = &lastSeen
+		}
+		out.Activations = append(out.Activations, device)
+	}
+
+	// Usage is recorded under the server's local date
+	to := time.Now()
+	out.Usage = recentUsage{
+		From: to.AddDate(0, 0, 1-usageDays).Format("2006-01-02"),
+		To:   to.Format("2006-01-02"),
+		Days: []usageDay{},
+	}
+	usage, err := store.GetUsageRange(licenseID, out.Usage.From, out.Usage.To)
+	if err != nil {
+		fatalf("Failed to get usage: %v", err)
+	}
+	for _, day := range usage {
+		out.Usage.Days = append(out.Usage.Days, usageDay{Date: day.Date, Scans: day.Scans})
+		out.Usage.TotalScans += day.Scans
+	}
+
+	if redactPII {
+		out.LicenseKey = redact.Key(out.LicenseKey)
+		out.CustomerName = redact.PII(out.CustomerName)
+		out.CustomerEmail = redact.Email(out.CustomerEmail)
+	}
+
+	if jsonOutput {
+		writeJSON(out)
+		return
+	}
 
 	// Display
 	fmt.Println()
 	fmt.Println("License Details:")
 	fmt.Println(strings.Repeat("=", 60))
-	fmt.Printf("License Key:       %s\n", licenseID)
-	fmt.Printf("Customer Name:     %s\n", name)
-	fmt.Printf("Customer Email:    %s\n", email)
-	fmt.Printf("Tier:              %s\n", strings.ToUpper(tier))
-	fmt.Printf("Status:            %s\n", formatActive(active))
+	fmt.Printf("License Key:       %s\n", out.LicenseKey)
+	fmt.Printf("Customer Name:     %s\n", out.CustomerName)
+	fmt.Printf("Customer Email:    %s\n", out.CustomerEmail)
+	fmt.Printf("Tier:              %s\n", strings.ToUpper(out.Tier))
+	fmt.Printf("Status:            %s\n", formatActive(out.Active))
 	fmt.Println(strings.Repeat("-", 60))
-	fmt.Printf("Daily Limit:       %s\n", formatLimit(dailyLimit))
-	fmt.Printf("Monthly Limit:     %s\n", formatLimit(monthlyLimit))
-	fmt.Printf("Max Activations:   %s\n", formatLimit(maxActivations))
-	fmt.Printf("Current Activations: %d\n", activationCount)
+	fmt.Printf("Daily Limit:       %s\n", formatLimit(out.DailyLimit))
+	fmt.Printf("Monthly Limit:     %s\n", formatLimit(out.MonthlyLimit))
+	fmt.Printf("Max Activations:   %s\n", formatLimit(out.MaxActivations))
+	fmt.Printf("Current Activations: %d\n", out.CurrentActivations)
+	fmt.Printf("Products:          %s\n", formatProducts(out.Products))
 	fmt.Println(strings.Repeat("-", 60))
-	fmt.Printf("Created:           %s\n", createdAt.Format("2006-01-02 15:04:05"))
-	fmt.Printf("Expires:           %s\n", expiresAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Created:           %s\n", out.CreatedAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Expires:           %s\n", out.ExpiresAt.Format("2006-01-02 15:04:05"))
+	fmt.Printf("Last Seen:         %s\n", formatLastSeen(lastCheckIn))
+	fmt.Printf("Usage (%d days):   %d requests\n", usageDays, out.Usage.TotalScans)
 	fmt.Println(strings.Repeat("=", 60))
 	fmt.Println()
 }
 
+// formatLastSeen shows a check-in time and how long ago it was
+func formatLastSeen(t time.Time) string {
+	if t.IsZero() {
+		return "Never"
+	}
+	return fmt.Sprintf("%s (%d days ago)", t.Format("2006-01-02 15:04:05"), int(time.Since(t).Hours()/24))
+}
+
+// formatProducts lists a license's products, naming the implicit default
+// product when none are set
+func formatProducts(products []string) string {
+	if len(products) == 0 {
+		return getEnv("DEFAULT_PRODUCT", "default") + " (default)"
+	}
+	return strings.Join(products, ", ")
+}
+
 func formatLimit(limit int) string {
 	if limit == -1 {
 		return "Unlimited"
@@ -709,129 +2982,6 @@ func min(a, b int) int {
 	return b
 }
 
-func sendUpgradeEmail(resendAPIKey, fromEmail, toEmail, customerName, oldTier, newTier, newLicenseKey string, dailyLimit int) error {
-	type EmailRequest struct {
-		From    string   `json:"from"`
-		To      []string `json:"to"`
-		Subject string   `json:"subject"`
-		HTML    string   `json:"html"`
-	}
-
-	tierAction := "upgraded"
-	if newTier == "free" {
-		tierAction = "changed"
-	}
-
-	limitText := fmt.Sprintf("%d requests/day", dailyLimit)
-	if dailyLimit == -1 {
-		limitText = "unlimited requests"
-	}
-
-	htmlBody := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
-        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
-        .license-box { background: white; border: 2px solid #667eea; border-radius: 8px; padding: 20px; margin: 20px 0; text-align: center; }
-        .license-key { font-size: 24px; font-weight: bold; color: #667eea; font-family: monospace; letter-spacing: 1px; word-break: break-all; }
-        .tier-badge { display: inline-block; padding: 8px 16px; border-radius: 20px; font-weight: bold; margin: 10px 0; }
-        .tier-free { background: #e3f2fd; color: #1976d2; }
-        .tier-pro { background: #f3e5f5; color: #7b1fa2; }
-        .tier-enterprise { background: #fff3e0; color: #e65100; }
-        .feature-list { list-style: none; padding: 0; }
-        .feature-list li { padding: 10px 0; border-bottom: 1px solid #eee; }
-        .feature-list li:before { content: "✓ "; color: #4caf50; font-weight: bold; margin-right: 10px; }
-        .cta-button { display: inline-block; background: #667eea; color: white; padding: 15px 30px; text-decoration: none; border-radius: 5px; margin-top: 20px; }
-        .footer { text-align: center; color: #999; font-size: 12px; margin-top: 30px; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>🎉 License %s!</h1>
-        </div>
-        <div class="content">
-            <p>Hi %s,</p>
-            
-            <p>Great news! Your license has been %s from <strong>%s</strong> to:</p>
-            
-            <div style="text-align: center;">
-                <span class="tier-badge tier-%s">%s Tier</span>
-            </div>
-            
-            <div class="license-box">
-                <p style="margin: 0 0 10px 0; color: #666;">Your New License Key:</p>
-                <div class="license-key">%s</div>
-            </div>
-            
-            <h3>📊 Your New Limits:</h3>
-            <ul class="feature-list">
-                <li>%s</li>
-                <li>Priority support</li>
-                <li>Full API access</li>
-            </ul>
-            
-            <h3>🚀 Next Steps:</h3>
-            <ol>
-                <li>Save your new license key in a secure location</li>
-                <li>Update your application with the new license key</li>
-                <li>Activate your license to start using the new features</li>
-            </ol>
-            
-            <p><strong>Note:</strong> Your previous license key has been deactivated and will no longer work.</p>
-            
-            <p>If you have any questions or need assistance, please don't hesitate to reach out to our support team.</p>
-            
-            <p>Best regards,<br>
-            The Licensify Team</p>
-        </div>
-        
-        <div class="footer">
-            <p>This is an automated email from Licensify License Management System.</p>
-        </div>
-    </div>
-</body>
-</html>
-	`, tierAction, customerName, tierAction, oldTier, newTier, strings.ToUpper(newTier), newLicenseKey, limitText)
-
-	emailReq := EmailRequest{
-		From:    fromEmail,
-		To:      []string{toEmail},
-		Subject: fmt.Sprintf("Your License Has Been %s to %s!", strings.ToUpper(tierAction[:1])+tierAction[1:], strings.ToUpper(newTier)),
-		HTML:    htmlBody,
-	}
-
-	jsonData, err := json.Marshal(emailReq)
-	if err != nil {
-		return fmt.Errorf("failed to marshal email request: %v", err)
-	}
-
-	req, err := http.NewRequest("POST", "https://api.resend.com/emails", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+resendAPIKey)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
-	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("resend API returned status %d", resp.StatusCode)
-	}
-
-	return nil
-}
-
 func handleTiers() {
 	if len(os.Args) < 3 {
 		fmt.Println("Usage: licensify-admin tiers <subcommand>")
@@ -840,11 +2990,17 @@ func handleTiers() {
 		fmt.Println("  list      List all available tiers with details")
 		fmt.Println("  get       Get specific tier configuration")
 		fmt.Println("  validate  Validate tiers.toml configuration")
+		fmt.Println("  add       Add a tier to tiers.toml")
+		fmt.Println("  set       Change a tier's settings in tiers.toml")
+		fmt.Println("  remove    Remove a tier from tiers.toml")
 		fmt.Println()
 		fmt.Println("Examples:")
 		fmt.Println("  licensify-admin tiers list")
 		fmt.Println("  licensify-admin tiers get -name tier-2")
 		fmt.Println("  licensify-admin tiers validate")
+		fmt.Println("  licensify-admin tiers add -name tier-4 -display-name Team -daily 5000 -monthly 100000 -devices 10")
+		fmt.Println("  licensify-admin tiers set -name tier-1 -deprecated -migrate-to tier-11")
+		fmt.Println("  licensify-admin tiers remove -name tier-1")
 		fmt.Println()
 		fmt.Println("Tier Naming Convention:")
 		fmt.Println("  Use numeric IDs: tier-1, tier-2, tier-3, tier-100, etc.")
@@ -855,18 +3011,23 @@ func handleTiers() {
 	subcommand := os.Args[2]
 
 	// Load tier configuration
-	tiersPath := os.Getenv("TIERS_CONFIG_PATH")
-	if tiersPath == "" {
-		tiersPath = "tiers.toml"
-	}
+	tiersPath := getEnv("TIERS_CONFIG_PATH", "tiers.toml")
 
 	switch subcommand {
 	case "list":
-		if err := tiers.LoadWithFallback(tiersPath); err != nil {
-			log.Fatalf("Failed to load tier configuration: %v", err)
+		if err := tierRegistry.LoadWithFallback(tiersPath); err != nil {
+			fatalf("Failed to load tier configuration: %v", err)
 		}
 
-		allTiers := tiers.GetAll()
+		allTiers := tierRegistry.GetAll()
+		if jsonOutput {
+			out := tierList{Tiers: []tierOutput{}}
+			for _, name := range sortedTierNames(allTiers) {
+				out.Tiers = append(out.Tiers, newTierOutput(name, allTiers[name]))
+			}
+			writeJSON(out)
+			return
+		}
 		if len(allTiers) == 0 {
 			fmt.Println("No tiers configured")
 			return
@@ -874,7 +3035,8 @@ func handleTiers() {
 
 		fmt.Println("Available Tiers:")
 		fmt.Println(strings.Repeat("=", 100))
-		for name, tier := range allTiers {
+		for _, name := range sortedTierNames(allTiers) {
+			tier := allTiers[name]
 			deprecatedMarker := ""
 			if tier.Deprecated {
 				deprecatedMarker = " [DEPRECATED]"
@@ -885,12 +3047,18 @@ func handleTiers() {
 			fmt.Printf("  Monthly Limit:     %s\n", formatLimit(tier.MonthlyLimit))
 			fmt.Printf("  Max Devices:       %s\n", formatLimit(tier.MaxDevices))
 			fmt.Printf("  Features:          %s\n", strings.Join(tier.Features, ", "))
+			if len(tier.Providers) > 0 {
+				fmt.Printf("  Providers:         %s\n", strings.Join(tier.Providers, ", "))
+			}
 			fmt.Printf("  Email Verification: %v\n", tier.EmailVerificationRequired)
 			if tier.PriceMonthly > 0 {
-				fmt.Printf("  Price (Monthly):   $%.2f\n", tier.PriceMonthly)
+				fmt.Printf("  Price (Monthly):   %s\n", formatPrice(tier.PriceMonthly, tier.Currency))
+			}
+			if tier.PriceAnnual > 0 {
+				fmt.Printf("  Price (Annual):    %s\n", formatPrice(tier.PriceAnnual, tier.Currency))
 			}
 			if tier.OneTimePayment > 0 {
-				fmt.Printf("  Price (Lifetime):  $%.2f\n", tier.OneTimePayment)
+				fmt.Printf("  Price (Lifetime):  %s\n", formatPrice(tier.OneTimePayment, tier.Currency))
 			}
 			if tier.CustomPricing {
 				fmt.Printf("  Custom Pricing:    Yes\n")
@@ -914,23 +3082,23 @@ func handleTiers() {
 	case "get":
 		fs := flag.NewFlagSet("get", flag.ExitOnError)
 		tierName := fs.String("name", "", "Tier name (required)")
-		_ = fs.Parse(os.Args[2:])
+		_ = fs.Parse(os.Args[3:])
 
 		if *tierName == "" {
-			fmt.Println("Error: -name is required")
-			fs.PrintDefaults()
-			os.Exit(1)
+			usageError(fs, "-name is required")
 		}
 
-		if err := tiers.LoadWithFallback(tiersPath); err != nil {
-			log.Fatalf("Failed to load tier configuration: %v", err)
+		if err := tierRegistry.LoadWithFallback(tiersPath); err != nil {
+			fatalf("Failed to load tier configuration: %v", err)
 		}
 
-		tier, err := tiers.Get(*tierName)
+		tier, err := tierRegistry.Get(*tierName)
 		if err != nil {
-			fmt.Printf("❌ %v\n", err)
-			fmt.Printf("Available tiers: %v\n", tiers.List())
-			os.Exit(1)
+			failf("%v (available tiers: %v)", err, tierRegistry.List())
+		}
+		if jsonOutput {
+			writeJSON(newTierOutput(*tierName, tier))
+			return
 		}
 
 		fmt.Printf("\n📦 %s (%s)\n", strings.ToUpper(*tierName), tier.Name)
@@ -939,12 +3107,18 @@ func handleTiers() {
 		fmt.Printf("Monthly Limit:         %s\n", formatLimit(tier.MonthlyLimit))
 		fmt.Printf("Max Devices:           %s\n", formatLimit(tier.MaxDevices))
 		fmt.Printf("Features:              %s\n", strings.Join(tier.Features, ", "))
+		if len(tier.Providers) > 0 {
+			fmt.Printf("Providers:             %s\n", strings.Join(tier.Providers, ", "))
+		}
 		fmt.Printf("Email Verification:    %v\n", tier.EmailVerificationRequired)
 		if tier.PriceMonthly > 0 {
-			fmt.Printf("Price (Monthly):       $%.2f\n", tier.PriceMonthly)
+			fmt.Printf("Price (Monthly):       %s\n", formatPrice(tier.PriceMonthly, tier.Currency))
+		}
+		if tier.PriceAnnual > 0 {
+			fmt.Printf("Price (Annual):        %s\n", formatPrice(tier.PriceAnnual, tier.Currency))
 		}
 		if tier.OneTimePayment > 0 {
-			fmt.Printf("Price (Lifetime):      $%.2f\n", tier.OneTimePayment)
+			fmt.Printf("Price (Lifetime):      %s\n", formatPrice(tier.OneTimePayment, tier.Currency))
 		}
 		if tier.CustomPricing {
 			fmt.Printf("Custom Pricing:        Yes\n")
@@ -966,14 +3140,14 @@ func handleTiers() {
 	case "validate":
 		fmt.Printf("Validating tier configuration: %s\n", tiersPath)
 
-		if err := tiers.Load(tiersPath); err != nil {
+		if err := tierRegistry.Load(tiersPath); err != nil {
 			fmt.Printf("❌ Validation failed: %v\n", err)
 			os.Exit(1)
 		}
 
-		allTiers := tiers.GetAll()
+		allTiers := tierRegistry.GetAll()
 		fmt.Printf("✅ Configuration is valid!\n")
-		fmt.Printf("   Found %d tier(s): %v\n", len(allTiers), tiers.List())
+		fmt.Printf("   Found %d tier(s): %v\n", len(allTiers), tierRegistry.List())
 
 		// Check for common issues and deprecations
 		warnings := []string{}
@@ -982,32 +3156,302 @@ func handleTiers() {
 			if tier.DailyLimit > tier.MonthlyLimit && tier.MonthlyLimit != -1 {
 				warnings = append(warnings, fmt.Sprintf("tier '%s': daily_limit (%d) > monthly_limit (%d)", name, tier.DailyLimit, tier.MonthlyLimit))
 			}
-			if len(tier.Features) == 0 {
-				warnings = append(warnings, fmt.Sprintf("tier '%s': no features defined", name))
+			if len(tier.Features) == 0 {
+				warnings = append(warnings, fmt.Sprintf("tier '%s': no features defined", name))
+			}
+			if tier.PriceAnnual > 0 && tier.PriceMonthly > 0 && tier.PriceAnnual >= 12*tier.PriceMonthly {
+				warnings = append(warnings, fmt.Sprintf("tier '%s': price_annual (%s) is no discount over 12 × price_monthly (%s)",
+					name, formatPrice(tier.PriceAnnual, tier.Currency), formatPrice(12*tier.PriceMonthly, tier.Currency)))
+			}
+			if tier.Deprecated {
+				deprecatedCount++
+				if tier.MigrateTo == "" {
+					warnings = append(warnings, fmt.Sprintf("tier '%s': deprecated but no migrate_to target specified", name))
+				}
+			}
+		}
+
+		if deprecatedCount > 0 {
+			fmt.Printf("   ⚠️  %d deprecated tier(s) found\n", deprecatedCount)
+		}
+
+		if len(warnings) > 0 {
+			fmt.Println("\n⚠️  Warnings:")
+			for _, warning := range warnings {
+				fmt.Printf("   - %s\n", warning)
+			}
+		}
+
+	case "add", "set":
+		handleTierEdit(subcommand, tiersPath)
+
+	case "remove":
+		handleTierRemove(tiersPath)
+
+	default:
+		fmt.Printf("Unknown subcommand: %s\n", subcommand)
+		os.Exit(1)
+	}
+}
+
+// tierFlagKeys maps the flags of tiers add and tiers set to tiers.toml
+// keys, in the order a new tier's keys are written
+var tierFlagKeys = []struct{ flag, key string }{
+	{"display-name", "name"},
+	{"daily", "daily_limit"},
+	{"monthly", "monthly_limit"},
+	{"devices", "max_devices"},
+	{"features", "features"},
+	{"providers", "providers"},
+	{"email-verification", "email_verification_required"},
+	{"price-monthly", "price_monthly"},
+	{"price-annual", "price_annual"},
+	{"one-time-payment", "one_time_payment"},
+	{"currency", "currency"},
+	{"custom-pricing", "custom_pricing"},
+	{"hidden", "hidden"},
+	{"deprecated", "deprecated"},
+	{"migrate-to", "migrate_to"},
+	{"description", "description"},
+	{"extends", "extends"},
+}
+
+// handleTierEdit adds a tier to tiers.toml, or changes an existing one.
+// Only the flags given are written, so a tier with extends keeps inheriting
+// everything else from its base tier.
+func handleTierEdit(subcommand, tiersPath string) {
+	fs := flag.NewFlagSet("tiers "+subcommand, flag.ExitOnError)
+	name := fs.String("name", "", "Tier ID, e.g. tier-4 (required)")
+	fs.String("display-name", "", "Display name, e.g. Team (required for add)")
+	fs.String("description", "", "Description shown in tier listings")
+	fs.Int("daily", 0, "Daily API limit (-1 unlimited)")
+	fs.Int("monthly", 0, "Monthly API limit (-1 unlimited)")
+	fs.Int("devices", 0, "Max device activations (-1 unlimited)")
+	fs.String("features", "", "Comma-separated features")
+	fs.String("providers", "", "Comma-separated proxy providers the tier may call (empty allows all)")
+	fs.Bool("email-verification", false, "Require email verification")
+	fs.Float64("price-monthly", 0, "Monthly price")
+	fs.Float64("price-annual", 0, "Annual price")
+	fs.Float64("one-time-payment", 0, "One-time (lifetime) price")
+	fs.String("currency", "", "ISO 4217 currency of the prices (default USD)")
+	fs.Bool("custom-pricing", false, "Priced per customer")
+	fs.Bool("hidden", false, "Hide from public tier listings")
+	fs.Bool("deprecated", false, "Mark as deprecated")
+	fs.String("migrate-to", "", "Tier that licenses on this deprecated tier migrate to")
+	fs.String("extends", "", "Base tier to inherit unset settings from")
+	_ = fs.Parse(os.Args[3:])
+
+	if *name == "" {
+		usageError(fs, "-name is required")
+	}
+	given := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	if subcommand == "add" && !given["display-name"] {
+		usageError(fs, "-display-name is required")
+	}
+	if subcommand == "set" && len(given) == 1 {
+		usageError(fs, "nothing to change: give at least one setting flag")
+	}
+
+	file, err := tiers.OpenFile(tiersPath)
+	if err != nil {
+		fatalf("Failed to load tier configuration: %v", err)
+	}
+	if subcommand == "add" {
+		err = file.AddTier(*name)
+	} else if !file.Has(*name) {
+		err = fmt.Errorf("tier '%s' not found in %s", *name, tiersPath)
+	}
+	if err != nil {
+		failf("%v", err)
+	}
+
+	// A tier that is no longer deprecated can't keep its migration target
+	if given["deprecated"] && !given["migrate-to"] && !fs.Lookup("deprecated").Value.(flag.Getter).Get().(bool) {
+		_ = file.Unset(*name, "migrate_to")
+	}
+	for _, fk := range tierFlagKeys {
+		if !given[fk.flag] {
+			continue
+		}
+		value := fs.Lookup(fk.flag).Value.(flag.Getter).Get()
+		if fk.flag == "features" || fk.flag == "providers" {
+			value = splitList(value.(string))
+		}
+		// Empty and false settings are left out rather than written
+		switch v := value.(type) {
+		case string:
+			if v == "" {
+				_ = file.Unset(*name, fk.key)
+				continue
+			}
+		case bool:
+			if !v {
+				_ = file.Unset(*name, fk.key)
+				continue
 			}
-			if tier.Deprecated {
-				deprecatedCount++
-				if tier.MigrateTo == "" {
-					warnings = append(warnings, fmt.Sprintf("tier '%s': deprecated but no migrate_to target specified", name))
-				}
+		case []string:
+			if len(v) == 0 {
+				_ = file.Unset(*name, fk.key)
+				continue
 			}
 		}
+		_ = file.Set(*name, fk.key, value)
+	}
 
-		if deprecatedCount > 0 {
-			fmt.Printf("   ⚠️  %d deprecated tier(s) found\n", deprecatedCount)
-		}
+	if err := file.Save(); err != nil {
+		failf("%s not changed: %v", tiersPath, err)
+	}
+	if err := tierRegistry.Load(tiersPath); err != nil {
+		fatalf("Failed to reload tier configuration: %v", err)
+	}
+	tier, err := tierRegistry.GetRaw(*name)
+	if err != nil {
+		fatalf("Failed to reload tier configuration: %v", err)
+	}
 
-		if len(warnings) > 0 {
-			fmt.Println("\n⚠️  Warnings:")
-			for _, warning := range warnings {
-				fmt.Printf("   - %s\n", warning)
-			}
+	if subcommand == "add" {
+		fmt.Printf("✅ Added %s (%s) to %s\n", *name, tier.Name, tiersPath)
+	} else {
+		fmt.Printf("✅ Updated %s (%s) in %s\n", *name, tier.Name, tiersPath)
+	}
+	fmt.Printf("   Limits: %s/day, %s/month, %s devices\n", formatLimit(tier.DailyLimit), formatLimit(tier.MonthlyLimit), formatLimit(tier.MaxDevices))
+	fmt.Printf("   Tiers:  %v\n", tierRegistry.List())
+	fmt.Println("   Restart the server to apply the change")
+}
+
+// handleTierRemove removes a tier from tiers.toml once nothing refers to it
+func handleTierRemove(tiersPath string) {
+	fs := flag.NewFlagSet("tiers remove", flag.ExitOnError)
+	name := fs.String("name", "", "Tier ID (required)")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt")
+	_ = fs.Parse(os.Args[3:])
+
+	if *name == "" {
+		usageError(fs, "-name is required")
+	}
+
+	file, err := tiers.OpenFile(tiersPath)
+	if err != nil {
+		fatalf("Failed to load tier configuration: %v", err)
+	}
+	if err := file.RemoveTier(*name); err != nil {
+		failf("Cannot remove %s: %v", *name, err)
+	}
+
+	fmt.Printf("⚠️  Licenses still on %s keep their limits but lose its features and proxy access.\n", *name)
+	fmt.Printf("   Move them first with: licensify-admin migrate -from %s -to <tier>\n", *name)
+	if !confirm(fmt.Sprintf("Remove %s from %s?", *name, tiersPath), *yes) {
+		fmt.Println("Tier removal cancelled")
+		return
+	}
+	if err := file.Save(); err != nil {
+		failf("%s not changed: %v", tiersPath, err)
+	}
+	fmt.Printf("✅ Removed %s from %s\n", *name, tiersPath)
+	fmt.Println("   Restart the server to apply the change")
+}
+
+// splitList parses a comma-separated flag value, dropping empty entries
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
 		}
+	}
+	return items
+}
 
-	default:
-		fmt.Printf("Unknown subcommand: %s\n", subcommand)
-		os.Exit(1)
+// tierList is the output of tiers list
+type tierList struct {
+	Tiers []tierOutput `json:"tiers"`
+}
+
+// tierOutput is a tier as shown by tiers list and tiers get
+type tierOutput struct {
+	ID                        string   `json:"id"`
+	Name                      string   `json:"name"`
+	DailyLimit                int      `json:"daily_limit"`
+	MonthlyLimit              int      `json:"monthly_limit"`
+	MaxDevices                int      `json:"max_devices"`
+	Features                  []string `json:"features"`
+	Providers                 []string `json:"providers,omitempty"`
+	EmailVerificationRequired bool     `json:"email_verification_required"`
+	PriceMonthly              float64  `json:"price_monthly,omitempty"`
+	PriceAnnual               float64  `json:"price_annual,omitempty"`
+	OneTimePayment            float64  `json:"one_time_payment,omitempty"`
+	Currency                  string   `json:"currency"`
+	CustomPricing             bool     `json:"custom_pricing"`
+	Hidden                    bool     `json:"hidden"`
+	Deprecated                bool     `json:"deprecated"`
+	MigrateTo                 string   `json:"migrate_to,omitempty"`
+	UsageThresholds           []int    `json:"usage_thresholds,omitempty"`
+	Description               string   `json:"description"`
+	Extends                   string   `json:"extends,omitempty"`
+}
+
+func newTierOutput(id string, tier *tiers.TierDetails) tierOutput {
+	features := tier.Features
+	if features == nil {
+		features = []string{}
+	}
+	return tierOutput{
+		ID:                        id,
+		Name:                      tier.Name,
+		DailyLimit:                tier.DailyLimit,
+		MonthlyLimit:              tier.MonthlyLimit,
+		MaxDevices:                tier.MaxDevices,
+		Features:                  features,
+		Providers:                 tier.Providers,
+		EmailVerificationRequired: tier.EmailVerificationRequired,
+		PriceMonthly:              tier.PriceMonthly,
+		PriceAnnual:               tier.PriceAnnual,
+		OneTimePayment:            tier.OneTimePayment,
+		Currency:                  tier.Currency,
+		CustomPricing:             tier.CustomPricing,
+		Hidden:                    tier.Hidden,
+		Deprecated:                tier.Deprecated,
+		MigrateTo:                 tier.MigrateTo,
+		UsageThresholds:           tier.UsageThresholds,
+		Description:               tier.Description,
+		Extends:                   tier.Extends,
+	}
+}
+
+// formatPrice shows an amount with its currency symbol, e.g. $29.99 or €290.00
+func formatPrice(amount float64, currency string) string {
+	return fmt.Sprintf("%s%.2f", tiers.CurrencySymbol(currency), amount)
+}
+
+func sortedTierNames(all map[string]*tiers.TierDetails) []string {
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
+}
+
+// migrationPlan is the output of migrate -dry-run -json
+type migrationPlan struct {
+	From     string                 `json:"from"`
+	To       string                 `json:"to"`
+	DryRun   bool                   `json:"dry_run"`
+	Limits   map[string]limitChange `json:"limits"`
+	Licenses []migrationLicense     `json:"licenses"`
+}
+
+type limitChange struct {
+	From int `json:"from"`
+	To   int `json:"to"`
+}
+
+type migrationLicense struct {
+	LicenseKey    string    `json:"license_key"`
+	CustomerName  string    `json:"customer_name"`
+	CustomerEmail string    `json:"customer_email"`
+	ExpiresAt     time.Time `json:"expires_at"`
 }
 
 func handleMigrate() {
@@ -1016,70 +3460,92 @@ func handleMigrate() {
 	toTier := fs.String("to", "", "Target tier to migrate to (optional - uses tier config if not specified)")
 	dryRun := fs.Bool("dry-run", false, "Show what would be migrated without making changes")
 	sendEmail := fs.Bool("send-email", true, "Send email notifications to migrated customers")
+	retries := fs.Int("retries", 3, "Retries per license after a failed update")
+	retryDelay := fs.Duration("retry-delay", 500*time.Millisecond, "Delay before the first retry, doubled for each further retry")
+	retryFile := fs.String("retry-file", "", "Only migrate the license IDs listed in this file (e.g. a previous run's failures)")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt")
+	failuresFile := fs.String("failures-file", "migrate-failures.txt", "Where to write license IDs that still fail after retries")
 
 	_ = fs.Parse(os.Args[2:])
 
 	if *fromTier == "" {
-		fmt.Println("Error: -from is required")
-		fs.PrintDefaults()
-		os.Exit(1)
+		usageError(fs, "-from is required")
+	}
+	if *retries < 0 {
+		usageError(fs, "-retries must not be negative")
+	}
+	if jsonOutput && !*dryRun {
+		usageError(fs, "-json is only supported with -dry-run")
+	}
+
+	var onlyIDs map[string]bool
+	if *retryFile != "" {
+		ids, err := readLicenseIDFile(*retryFile)
+		if err != nil {
+			fatalf("Failed to read retry file: %v", err)
+		}
+		onlyIDs = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			onlyIDs[id] = true
+		}
+		if !jsonOutput {
+			fmt.Printf("ℹ️  Retrying %d license(s) from %s\n", len(ids), *retryFile)
+		}
 	}
 
 	// Load tier configuration
-	tiersPath := os.Getenv("TIERS_CONFIG_PATH")
-	if tiersPath == "" {
-		tiersPath = "tiers.toml"
+	tiersPath := getEnv("TIERS_CONFIG_PATH", "tiers.toml")
+	if err := tierRegistry.LoadWithFallback(tiersPath); err != nil {
+		fatalf("Failed to load tier configuration: %v", err)
 	}
-	if err := tiers.LoadWithFallback(tiersPath); err != nil {
-		log.Fatalf("Failed to load tier configuration: %v", err)
+	var mailer *email.Client
+	if *sendEmail {
+		mailer = newMailer()
 	}
 
 	// Validate source tier exists
-	if !tiers.Exists(*fromTier) {
-		fmt.Printf("❌ Source tier '%s' not found. Available tiers: %v\n", *fromTier, tiers.List())
-		os.Exit(1)
+	if !tierRegistry.Exists(*fromTier) {
+		failf("Source tier '%s' not found. Available tiers: %v", *fromTier, tierRegistry.List())
 	}
 
 	// Determine target tier
 	targetTier := *toTier
 	if targetTier == "" {
 		// Check if source tier has a migration target
-		migrationTarget, err := tiers.GetMigrationTarget(*fromTier)
+		migrationTarget, err := tierRegistry.GetMigrationTarget(*fromTier)
 		if err != nil {
-			fmt.Printf("❌ %v\n", err)
-			fmt.Println("Please specify -to flag to set the migration target manually")
-			os.Exit(1)
+			failf("%v (specify -to to set the migration target manually)", err)
 		}
 		targetTier = migrationTarget
-		fmt.Printf("ℹ️  Using configured migration target: %s → %s\n", *fromTier, targetTier)
+		if !jsonOutput {
+			fmt.Printf("ℹ️  Using configured migration target: %s → %s\n", *fromTier, targetTier)
+		}
 	} else {
 		// Validate target tier exists
-		if !tiers.Exists(targetTier) {
-			fmt.Printf("❌ Target tier '%s' not found. Available tiers: %v\n", targetTier, tiers.List())
-			os.Exit(1)
+		if !tierRegistry.Exists(targetTier) {
+			failf("Target tier '%s' not found. Available tiers: %v", targetTier, tierRegistry.List())
 		}
 	}
 
 	if *fromTier == targetTier {
-		fmt.Println("❌ Source and target tiers cannot be the same")
-		os.Exit(1)
+		failf("Source and target tiers cannot be the same")
 	}
 
 	// Connect to database
 	if err := initDB(); err != nil {
-		log.Fatalf("Database error: %v", err)
+		fatalf("Database error: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }()
 
 	// Get source and target tier configurations (use GetRaw to get actual tier data, not migration target)
-	sourceTierConfig, _ := tiers.GetRaw(*fromTier)
-	targetTierConfig, _ := tiers.GetRaw(targetTier)
+	sourceTierConfig, _ := tierRegistry.GetRaw(*fromTier)
+	targetTierConfig, _ := tierRegistry.GetRaw(targetTier)
 
 	// Find all licenses on the source tier
 	query := fmt.Sprintf("SELECT license_id, customer_name, customer_email, expires_at FROM licenses WHERE tier = %s AND active = true", sqlPlaceholder(1))
 	rows, err := db.Query(query, *fromTier)
 	if err != nil {
-		log.Fatalf("Failed to query licenses: %v", err)
+		fatalf("Failed to query licenses: %v", err)
 	}
 	defer func() { _ = rows.Close() }()
 
@@ -1093,13 +3559,47 @@ func handleMigrate() {
 	licenses := []LicenseInfo{}
 	for rows.Next() {
 		var lic LicenseInfo
-		if err := rows.Scan(&lic.LicenseID, &lic.Name, &lic.Email, &lic.ExpiresAt); err != nil {
+		var expiresAt string
+		if err := rows.Scan(&lic.LicenseID, &lic.Name, &lic.Email, &expiresAt); err != nil {
 			log.Printf("Error scanning row: %v", err)
 			continue
 		}
+		if onlyIDs != nil && !onlyIDs[lic.LicenseID] {
+			continue
+		}
+		lic.ExpiresAt, _ = database.ParseTime(expiresAt)
 		licenses = append(licenses, lic)
 	}
 
+	if jsonOutput {
+		plan := migrationPlan{
+			From:     *fromTier,
+			To:       targetTier,
+			DryRun:   true,
+			Licenses: []migrationLicense{},
+			Limits: map[string]limitChange{
+				"daily":       {From: sourceTierConfig.DailyLimit, To: targetTierConfig.DailyLimit},
+				"monthly":     {From: sourceTierConfig.MonthlyLimit, To: targetTierConfig.MonthlyLimit},
+				"max_devices": {From: sourceTierConfig.MaxDevices, To: targetTierConfig.MaxDevices},
+			},
+		}
+		for _, lic := range licenses {
+			plan.Licenses = append(plan.Licenses, migrationLicense{
+				LicenseKey:    lic.LicenseID,
+				CustomerName:  lic.Name,
+				CustomerEmail: lic.Email,
+				ExpiresAt:     lic.ExpiresAt,
+			})
+		}
+		writeJSON(plan)
+		return
+	}
+
+	if onlyIDs != nil && len(licenses) < len(onlyIDs) {
+		fmt.Printf("ℹ️  %d license(s) in %s are no longer active on tier '%s' and will be skipped\n",
+			len(onlyIDs)-len(licenses), *retryFile, *fromTier)
+	}
+
 	if len(licenses) == 0 {
 		fmt.Printf("✅ No active licenses found on tier '%s'\n", *fromTier)
 		return
@@ -1130,169 +3630,507 @@ func handleMigrate() {
 	}
 
 	// Confirm migration
-	fmt.Print("\n⚠️  This will update licenses in the database. Continue? (yes/no): ")
-	var confirmation string
-	_, _ = fmt.Scanln(&confirmation)
-	if strings.ToLower(confirmation) != "yes" {
+	fmt.Println()
+	if !confirm("⚠️  This will update licenses in the database. Continue?", *yes) {
 		fmt.Println("Migration cancelled")
 		return
 	}
 
 	// Perform migration
+	// The old limits are kept alongside the change date so a downgrade only
+	// takes effect from the next daily/monthly reset
 	fmt.Println("\n🔄 Migrating licenses...")
+	limitChange, limitArgs := database.LimitChangeAssignments(sqlPlaceholder, 5, time.Now())
 	updateQuery := fmt.Sprintf(`
 		UPDATE licenses 
 		SET tier = %s, 
 		    daily_limit = %s, 
 		    monthly_limit = %s, 
-		    max_activations = %s
+		    max_activations = %s,
+		    %s
 		WHERE license_id = %s
-	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4), sqlPlaceholder(5))
+	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4), strings.Join(limitChange, ", "), sqlPlaceholder(8))
 
 	successCount := 0
-	failCount := 0
+	var failed []string
 
 	for i, lic := range licenses {
-		_, err := db.Exec(updateQuery,
-			targetTier,
-			targetTierConfig.DailyLimit,
-			targetTierConfig.MonthlyLimit,
-			targetTierConfig.MaxDevices,
-			lic.LicenseID)
+		err := retryWithBackoff(*retries, *retryDelay, func(attempt int, err error) {
+			fmt.Printf("  ⚠️  %d. %s - Attempt %d failed: %v\n", i+1, lic.LicenseID, attempt, err)
+		}, func() error {
+			args := append([]interface{}{
+				targetTier,
+				targetTierConfig.DailyLimit,
+				targetTierConfig.MonthlyLimit,
+				targetTierConfig.MaxDevices,
+			}, limitArgs...)
+			_, err := db.Exec(updateQuery, append(args, lic.LicenseID)...)
+			return err
+		})
 
 		if err != nil {
 			fmt.Printf("  ❌ %d. %s - Failed: %v\n", i+1, lic.LicenseID, err)
-			failCount++
+			failed = append(failed, lic.LicenseID)
 			continue
 		}
 
+		details := flagDetails(fs)
+		details["to"] = targetTier
+		recordAudit("migrate", lic.LicenseID, details)
 		fmt.Printf("  ✅ %d. %s - %s (%s)\n", i+1, lic.LicenseID, lic.Name, lic.Email)
 		successCount++
 
 		// Send email notification if enabled
-		if *sendEmail {
-			resendAPIKey := os.Getenv("RESEND_API_KEY")
-			fromEmail := os.Getenv("FROM_EMAIL")
-
-			if resendAPIKey != "" && fromEmail != "" {
-				if err := sendMigrationEmail(resendAPIKey, fromEmail, lic.Email, lic.Name,
-					*fromTier, sourceTierConfig.Name, targetTier, targetTierConfig.Name,
-					targetTierConfig.DailyLimit, lic.LicenseID); err != nil {
-					fmt.Printf("     ⚠️  Failed to send email: %v\n", err)
-				} else {
-					fmt.Printf("     📧 Email sent\n")
-				}
+		if mailer != nil {
+			if err := mailer.SendMigrationNotice(lic.Email, lic.Name,
+				*fromTier, sourceTierConfig.Name, targetTier, targetTierConfig.Name,
+				targetTierConfig.DailyLimit, lic.LicenseID); err != nil {
+				fmt.Printf("     ⚠️  Failed to send email: %v\n", err)
+			} else {
+				fmt.Printf("     📧 Email sent\n")
 			}
 		}
 	}
 
 	fmt.Println()
 	fmt.Println(strings.Repeat("=", 80))
-	fmt.Printf("✅ Migration completed: %d succeeded, %d failed\n", successCount, failCount)
+	fmt.Printf("✅ Migration completed: %d succeeded, %d failed\n", successCount, len(failed))
 	fmt.Println(strings.Repeat("=", 80))
+
+	if len(failed) == 0 {
+		// A successful retry run has nothing left to resume
+		if *retryFile != "" && *retryFile == *failuresFile {
+			_ = os.Remove(*failuresFile)
+		}
+		return
+	}
+
+	fmt.Println("\nFailed licenses:")
+	for _, id := range failed {
+		fmt.Printf("  - %s\n", id)
+	}
+	header := fmt.Sprintf("Failed migration %s -> %s on %s", *fromTier, targetTier, time.Now().Format(time.RFC3339))
+	if err := writeLicenseIDFile(*failuresFile, header, failed); err != nil {
+		fmt.Printf("\n⚠️  Could not save failures: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nSaved failed license IDs to %s. Retry just those with:\n", *failuresFile)
+	fmt.Printf("  licensify-admin migrate -from %s -to %s -retry-file %s\n", *fromTier, targetTier, *failuresFile)
+	os.Exit(1)
+}
+
+// retryWithBackoff calls fn until it succeeds or retries are exhausted,
+// doubling the delay after each failure. onRetry is told about every failed
+// attempt that will be retried.
+func retryWithBackoff(retries int, delay time.Duration, onRetry func(attempt int, err error), fn func() error) error {
+	err := fn()
+	for attempt := 1; err != nil && attempt <= retries; attempt++ {
+		onRetry(attempt, err)
+		time.Sleep(delay)
+		delay *= 2
+		err = fn()
+	}
+	return err
 }
 
-func sendMigrationEmail(resendAPIKey, fromEmail, toEmail, customerName, oldTierID, oldTierName, newTierID, newTierName string, newDailyLimit int, licenseKey string) error {
-	type EmailRequest struct {
-		From    string   `json:"from"`
-		To      []string `json:"to"`
-		Subject string   `json:"subject"`
-		HTML    string   `json:"html"`
-	}
-
-	limitText := fmt.Sprintf("%d requests/day", newDailyLimit)
-	if newDailyLimit == -1 {
-		limitText = "unlimited requests"
-	}
-
-	htmlBody := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <style>
-        body { font-family: Arial, sans-serif; line-height: 1.6; color: #333; }
-        .container { max-width: 600px; margin: 0 auto; padding: 20px; }
-        .header { background: linear-gradient(135deg, #667eea 0%%, #764ba2 100%%); color: white; padding: 30px; text-align: center; border-radius: 10px 10px 0 0; }
-        .content { background: #f9f9f9; padding: 30px; border-radius: 0 0 10px 10px; }
-        .tier-box { background: white; border: 2px solid #667eea; border-radius: 8px; padding: 20px; margin: 20px 0; }
-        .migration-arrow { text-align: center; font-size: 24px; color: #667eea; margin: 10px 0; }
-        .footer { text-align: center; color: #999; font-size: 12px; margin-top: 30px; }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <div class="header">
-            <h1>📦 Your License Tier Has Been Updated</h1>
-        </div>
-        <div class="content">
-            <p>Hi %s,</p>
-            
-            <p>We're writing to inform you that your license tier has been migrated to a new plan:</p>
-            
-            <div class="tier-box">
-                <h3>Previous Tier</h3>
-                <p><strong>%s</strong> (%s)</p>
-            </div>
-            
-            <div class="migration-arrow">↓</div>
-            
-            <div class="tier-box">
-                <h3>New Tier</h3>
-                <p><strong>%s</strong> (%s)</p>
-                <p><strong>New Limits:</strong> %s</p>
-            </div>
-            
-            <h3>What This Means:</h3>
-            <ul>
-                <li>Your license key remains the same: <code>%s</code></li>
-                <li>No action is required from you</li>
-                <li>Your new limits are now active</li>
-            </ul>
-            
-            <p>If you have any questions about this migration, please don't hesitate to reach out to our support team.</p>
-            
-            <p>Best regards,<br>
-            The Licensify Team</p>
-        </div>
-        
-        <div class="footer">
-            <p>This is an automated email from Licensify License Management System.</p>
-        </div>
-    </div>
-</body>
-</html>
-	`, customerName, oldTierName, oldTierID, newTierName, newTierID, limitText, licenseKey)
-
-	emailReq := EmailRequest{
-		From:    fromEmail,
-		To:      []string{toEmail},
-		Subject: fmt.Sprintf("Your License Has Been Migrated to %s", newTierName),
-		HTML:    htmlBody,
-	}
-
-	jsonData, err := json.Marshal(emailReq)
+// readLicenseIDFile reads license IDs one per line, ignoring blank lines and
+// "#" comments
+func readLicenseIDFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return fmt.Errorf("failed to marshal email request: %v", err)
+		return nil, err
+	}
+	var ids []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ids = append(ids, line)
+	}
+	return ids, nil
+}
+
+// writeLicenseIDFile writes license IDs one per line under a "#" header
+func writeLicenseIDFile(path, header string, ids []string) error {
+	content := "# " + header + "\n" + strings.Join(ids, "\n") + "\n"
+	return os.WriteFile(path, []byte(content), 0o600)
+}
+
+// reminderPlan is the output of remind -dry-run -json
+type reminderPlan struct {
+	Days     int               `json:"days"`
+	DryRun   bool              `json:"dry_run"`
+	Licenses []reminderLicense `json:"licenses"`
+}
+
+type reminderLicense struct {
+	LicenseKey    string    `json:"license_key"`
+	CustomerName  string    `json:"customer_name"`
+	CustomerEmail string    `json:"customer_email"`
+	Tier          string    `json:"tier"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	DaysLeft      int       `json:"days_left"`
+	AlreadySent   bool      `json:"already_sent"`
+}
+
+func handleRemind() {
+	fs := flag.NewFlagSet("remind", flag.ExitOnError)
+	days := fs.Int("days", 7, "Remind customers whose license expires within this many days")
+	dryRun := fs.Bool("dry-run", false, "Show who would be reminded without sending or recording anything")
+
+	_ = fs.Parse(os.Args[2:])
+
+	if *days < 1 {
+		usageError(fs, "-days must be at least 1")
+	}
+	if jsonOutput && !*dryRun {
+		usageError(fs, "-json is only supported with -dry-run")
 	}
 
-	req, err := http.NewRequest("POST", "https://api.resend.com/emails", bytes.NewBuffer(jsonData))
+	var mailer *email.Client
+	if !*dryRun {
+		if mailer = newMailer(); mailer == nil {
+			failf("Email is not configured: set FROM_EMAIL and either SMTP_HOST or RESEND_API_KEY")
+		}
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	licenses, err := store.GetExpiringLicenses(time.Duration(*days) * 24 * time.Hour)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
+		fatalf("Failed to load expiring licenses: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+resendAPIKey)
-	req.Header.Set("Content-Type", "application/json")
+	plan := reminderPlan{Days: *days, DryRun: *dryRun, Licenses: []reminderLicense{}}
+	for _, l := range licenses {
+		sent, err := store.ReminderSent(l.LicenseID, *days, l.ExpiresAt)
+		if err != nil {
+			fatalf("Failed to check reminders: %v", err)
+		}
+		plan.Licenses = append(plan.Licenses, reminderLicense{
+			LicenseKey:    l.LicenseID,
+			CustomerName:  l.CustomerName,
+			CustomerEmail: l.CustomerEmail,
+			Tier:          l.Tier,
+			ExpiresAt:     l.ExpiresAt,
+			DaysLeft:      daysUntil(l.ExpiresAt),
+			AlreadySent:   sent,
+		})
+	}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
+	if jsonOutput {
+		writeJSON(plan)
+		return
+	}
+	if len(plan.Licenses) == 0 {
+		fmt.Printf("✅ No active licenses expire within %d day(s)\n", *days)
+		return
+	}
+
+	if *dryRun {
+		fmt.Printf("🔍 DRY RUN - %d license(s) expire within %d day(s)\n\n", len(plan.Licenses), *days)
+		fmt.Printf("%-30s %-30s %-12s %-6s %s\n", "LICENSE", "EMAIL", "EXPIRES", "DAYS", "REMINDER")
+		for _, l := range plan.Licenses {
+			status := "would send"
+			if l.AlreadySent {
+				status = "already sent"
+			}
+			fmt.Printf("%-30s %-30s %-12s %-6d %s\n", l.LicenseKey, l.CustomerEmail, l.ExpiresAt.Format("2006-01-02"), l.DaysLeft, status)
+		}
+		return
+	}
+
+	var sent, skipped, failed int
+	for _, l := range plan.Licenses {
+		if l.AlreadySent || l.CustomerEmail == "" {
+			skipped++
+			continue
+		}
+		// Claim the reminder first so overlapping runs don't both send it
+		first, err := store.MarkReminderSent(l.LicenseKey, *days, l.ExpiresAt)
+		if err != nil {
+			fatalf("Failed to record reminder: %v", err)
+		}
+		if !first {
+			skipped++
+			continue
+		}
+		err = mailer.SendRenewalReminder(l.CustomerEmail, l.CustomerName, l.Tier, l.LicenseKey, l.ExpiresAt.Format("January 2, 2006"), l.DaysLeft)
+		if err != nil {
+			fmt.Printf("  ⚠️  %s (%s) - Failed: %v\n", l.LicenseKey, l.CustomerEmail, err)
+			if err := store.UnmarkReminderSent(l.LicenseKey, *days, l.ExpiresAt); err != nil {
+				fmt.Printf("     ⚠️  %v\n", err)
+			}
+			failed++
+			continue
+		}
+		recordAudit("remind", l.LicenseKey, flagDetails(fs))
+		fmt.Printf("  📧 %s - %s (expires %s)\n", l.LicenseKey, l.CustomerEmail, l.ExpiresAt.Format("2006-01-02"))
+		sent++
+	}
+
+	fmt.Printf("\n✅ Sent %d reminder(s), skipped %d (already reminded or no email), %d failed\n", sent, skipped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// daysUntil returns the number of started days until t
+func daysUntil(t time.Time) int {
+	return int((time.Until(t) + 24*time.Hour - 1) / (24 * time.Hour))
+}
+
+// auditLog is the output of audit list -json
+type auditLog struct {
+	Entries []auditLogEntry `json:"entries"`
+}
+
+type auditLogEntry struct {
+	ID         int64           `json:"id"`
+	Action     string          `json:"action"`
+	LicenseKey string          `json:"license_key,omitempty"`
+	Actor      string          `json:"actor"`
+	Details    json.RawMessage `json:"details,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+func handleAudit() {
+	if len(os.Args) < 3 || os.Args[2] != "list" {
+		fmt.Println("Usage: licensify-admin audit list [-license LIC-xxx] [-limit N]")
+		fmt.Println()
+		fmt.Println("Examples:")
+		fmt.Println("  licensify-admin audit list")
+		fmt.Println("  licensify-admin audit list -license LIC-xxx -limit 0")
+		os.Exit(1)
+	}
+
+	fs := flag.NewFlagSet("audit list", flag.ExitOnError)
+	license := fs.String("license", "", "Only show entries for this license")
+	limit := fs.Int("limit", 50, "Maximum number of entries to show, newest first (0 for all)")
+
+	_ = fs.Parse(os.Args[3:])
+
+	if *limit < 0 {
+		usageError(fs, "-limit must not be negative")
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	entries, err := store.ListAudit(database.AuditFilter{
+		LicenseID: *license,
+		Limit:     *limit,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to send request: %v", err)
+		fatalf("Failed to list audit log: %v", err)
 	}
-	defer func() { _ = resp.Body.Close() }()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("resend API returned status %d", resp.StatusCode)
+	if jsonOutput {
+		out := auditLog{Entries: []auditLogEntry{}}
+		for _, e := range entries {
+			out.Entries = append(out.Entries, auditLogEntry{
+				ID:         e.ID,
+				Action:     e.Action,
+				LicenseKey: e.TargetLicense,
+				Actor:      e.Actor,
+				Details:    e.Details,
+				CreatedAt:  e.CreatedAt,
+			})
+		}
+		writeJSON(out)
+		return
 	}
 
-	return nil
+	if len(entries) == 0 {
+		fmt.Println("No audit log entries")
+		return
+	}
+	fmt.Printf("%-6s %-20s %-12s %-18s %-30s %s\n", "ID", "TIME", "ACTOR", "ACTION", "LICENSE", "DETAILS")
+	for _, e := range entries {
+		target := e.TargetLicense
+		if target == "" {
+			target = "-"
+		}
+		fmt.Printf("%-6d %-20s %-12s %-18s %-30s %s\n", e.ID, e.CreatedAt.Format("2006-01-02 15:04:05"),
+			truncate(e.Actor, 12), e.Action, target, e.Details)
+	}
+}
+
+type statsOutput struct {
+	Licenses    int               `json:"licenses"`
+	Active      int               `json:"active"`
+	Expired     int               `json:"expired"`
+	Deactivated int               `json:"deactivated"`
+	Tiers       []tierStatsOutput `json:"tiers"`
+	Activations int               `json:"activations"`
+	Month       string            `json:"month"`
+	MonthScans  int64             `json:"month_scans"`
+	MonthTokens int64             `json:"month_tokens"`
+}
+
+type tierStatsOutput struct {
+	Tier        string `json:"tier"`
+	Licenses    int    `json:"licenses"`
+	Active      int    `json:"active"`
+	Expired     int    `json:"expired"`
+	Deactivated int    `json:"deactivated"`
+}
+
+func handleStats() {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	_ = fs.Parse(os.Args[2:])
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	stats, err := store.GetStats()
+	if err != nil {
+		fatalf("Failed to load stats: %v", err)
+	}
+
+	if jsonOutput {
+		out := statsOutput{
+			Licenses:    stats.Licenses,
+			Active:      stats.Active,
+			Expired:     stats.Expired,
+			Deactivated: stats.Deactivated,
+			Tiers:       []tierStatsOutput{},
+			Activations: stats.Activations,
+			Month:       stats.Month,
+			MonthScans:  stats.MonthScans,
+			MonthTokens: stats.MonthTokens,
+		}
+		for _, t := range stats.Tiers {
+			out.Tiers = append(out.Tiers, tierStatsOutput(t))
+		}
+		writeJSON(out)
+		return
+	}
+
+	fmt.Printf("%-20s %9s %9s %9s %12s\n", "TIER", "LICENSES", "ACTIVE", "EXPIRED", "DEACTIVATED")
+	for _, t := range stats.Tiers {
+		fmt.Printf("%-20s %9d %9d %9d %12d\n", truncate(t.Tier, 20), t.Licenses, t.Active, t.Expired, t.Deactivated)
+	}
+	fmt.Printf("%-20s %9d %9d %9d %12d\n", "TOTAL", stats.Licenses, stats.Active, stats.Expired, stats.Deactivated)
+	fmt.Println()
+	fmt.Printf("%-20s %d\n", "Activations:", stats.Activations)
+	fmt.Printf("%-20s %d\n", "Usage in "+stats.Month+":", stats.MonthScans)
+	if stats.MonthTokens > 0 {
+		fmt.Printf("%-20s %d\n", "Tokens in "+stats.Month+":", stats.MonthTokens)
+	}
+}
+
+// staleLicense is a license as shown by the stale command
+type staleLicense struct {
+	licenseSummary
+	LastCheckIn *time.Time `json:"last_check_in"` // null if never checked in
+	Activations int        `json:"activations"`
+}
+
+func handleStale() {
+	fs := flag.NewFlagSet("stale", flag.ExitOnError)
+	days := fs.Int("days", 30, "List licenses that haven't checked in for this many days")
+	freeSeats := fs.Bool("free-seats", false, "Remove the device activations of every stale license")
+	yes := fs.Bool("yes", false, "Skip the confirmation prompt for -free-seats")
+	_ = fs.Parse(os.Args[2:])
+
+	if *days <= 0 {
+		usageError(fs, "-days must be positive")
+	}
+
+	// Connect to database
+	if err := initDB(); err != nil {
+		fatalf("Database error: %v", err)
+	}
+	defer func() { _ = store.Close() }()
+
+	licenses, err := store.GetStaleLicenses(time.Duration(*days) * 24 * time.Hour)
+	if err != nil {
+		fatalf("Failed to list stale licenses: %v", err)
+	}
+
+	if *freeSeats {
+		freeStaleSeats(store, fs, licenses, *yes)
+		return
+	}
+
+	out := []staleLicense{}
+	for _, l := range licenses {
+		s := staleLicense{licenseSummary: newLicenseSummary(l.License), Activations: l.Activations}
+		if !l.LastCheckIn.IsZero() {
+			lastCheckIn := l.LastCheckIn
+			s.LastCheckIn = &lastCheckIn
+		}
+		out = append(out, s)
+	}
+	if jsonOutput {
+		writeJSON(out)
+		return
+	}
+
+	fmt.Printf("Licenses not seen for %d days:\n", *days)
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("%-30s %-30s %-12s %-20s %-6s\n", "License Key", "Email", "Tier", "Last Seen", "Seats")
+	fmt.Println(strings.Repeat("-", 100))
+	for _, l := range licenses {
+		lastSeen := "Never"
+		if !l.LastCheckIn.IsZero() {
+			lastSeen = formatTimestamp(l.LastCheckIn)
+		}
+		fmt.Printf("%-30s %-30s %-12s %-20s %d/%s\n", l.LicenseID, truncate(l.CustomerEmail, 30), l.Tier,
+			lastSeen, l.Activations, formatLimit(l.MaxActivations))
+	}
+	fmt.Println(strings.Repeat("-", 100))
+	fmt.Printf("Total: %d licenses\n", len(licenses))
+}
+
+// freeStaleSeats removes every device activation of the stale licenses, so
+// their seats can be used again
+func freeStaleSeats(store *database.DB, fs *flag.FlagSet, licenses []database.StaleLicense, yes bool) {
+	var withSeats []database.StaleLicense
+	for _, l := range licenses {
+		if l.Activations > 0 {
+			withSeats = append(withSeats, l)
+		}
+	}
+	if len(withSeats) == 0 {
+		fmt.Println("No stale licenses have activated devices")
+		return
+	}
+
+	if !confirm(fmt.Sprintf("⚠️  This will remove the device activations of %d stale licenses. Continue?", len(withSeats)), yes) {
+		fmt.Println("Cancelled")
+		return
+	}
+
+	total, failed := 0, 0
+	for _, l := range withSeats {
+		removed, err := store.DeleteActivations(l.LicenseID, "")
+		if err != nil {
+			fmt.Printf("❌ %s: %v\n", l.LicenseID, err)
+			failed++
+			continue
+		}
+		if removed > 0 {
+			details := flagDetails(fs)
+			details["removed"] = removed
+			recordAudit("stale free-seats", l.LicenseID, details)
+		}
+		total += removed
+	}
+	fmt.Printf("✅ Removed %d device activations from %d licenses\n", total, len(withSeats)-failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,952 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/database/migrations"
+)
+
+// adminArgsEnv makes the test binary run the admin CLI with these
+// space-separated arguments instead of the tests
+const adminArgsEnv = "LICENSIFY_ADMIN_TEST_ARGS"
+
+func TestMain(m *testing.M) {
+	if args := os.Getenv(adminArgsEnv); args != "" {
+		os.Args = append([]string{"licensify-admin"}, strings.Fields(args)...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runAdmin runs the admin CLI against the SQLite database at dbPath with
+// stdin that is not a terminal, returning its output and exit code
+func runAdmin(t *testing.T, dbPath string, args ...string) (string, int) {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), adminArgsEnv+"="+strings.Join(args, " "), "DB_PATH="+dbPath, "DATABASE_URL=")
+	cmd.Dir = t.TempDir() // no .env file
+	cmd.Stdin = strings.NewReader("yes\n")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return string(out), exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("run admin: %v", err)
+	}
+	return string(out), 0
+}
+
+// seedLicense creates a migrated SQLite database with one active license
+func seedLicense(t *testing.T, licenseID string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "licensify.db")
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := migrations.Migrate(conn, false); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	_, err = conn.Exec(`INSERT INTO licenses (license_id, customer_name, customer_email, tier, expires_at,
+		daily_limit, monthly_limit, max_activations) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		licenseID, "Alice", "alice@example.com", "tier-1", time.Now().AddDate(1, 0, 0).UTC().Format(time.RFC3339), 100, 1000, 3)
+	if err != nil {
+		t.Fatalf("create license: %v", err)
+	}
+	return path
+}
+
+// licenseActive reports whether the license in the database at path is active
+func licenseActive(t *testing.T, path, licenseID string) bool {
+	t.Helper()
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	var active bool
+	if err := conn.QueryRow("SELECT active FROM licenses WHERE license_id = ?", licenseID).Scan(&active); err != nil {
+		t.Fatalf("load license: %v", err)
+	}
+	return active
+}
+
+func TestReadAnswer(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		terminal bool
+		want     string
+		ok       bool
+		err      error
+	}{
+		{"yes", "yes\n", true, "yes", true, nil},
+		{"yes in capitals", "YES\n", true, "yes", true, nil},
+		{"no", "no\n", true, "yes", false, nil},
+		{"y is not yes", "y\n", true, "yes", false, nil},
+		{"empty line", "\n", true, "yes", false, nil},
+		{"end of input", "", true, "yes", false, nil},
+		{"license key", "lic-202601-pro-abcd1234-x\n", true, "LIC-202601-PRO-ABCD1234-X", true, nil},
+		{"wrong license key", "LIC-202601-PRO-ABCD1234-Y\n", true, "LIC-202601-PRO-ABCD1234-X", false, nil},
+		{"not a terminal", "yes\n", false, "yes", false, errNotTerminal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			ok, err := readAnswer(strings.NewReader(tt.input), &out, tt.terminal, "Continue? ", tt.want)
+			if ok != tt.ok || !errors.Is(err, tt.err) {
+				t.Fatalf("readAnswer = %v, %v; want %v, %v", ok, err, tt.ok, tt.err)
+			}
+			wantPrompt := "Continue? "
+			if !tt.terminal {
+				wantPrompt = ""
+			}
+			if out.String() != wantPrompt {
+				t.Fatalf("prompt = %q, want %q", out.String(), wantPrompt)
+			}
+		})
+	}
+}
+
+func TestConfirmWithYesDoesNotAsk(t *testing.T) {
+	// -yes must not touch stdin, which isn't a terminal under go test
+	if !confirm("Continue?", true) {
+		t.Fatal("confirm with -yes = false")
+	}
+	if !confirmAnswer("Type the license key: ", "LIC-1", true) {
+		t.Fatal("confirmAnswer with -yes = false")
+	}
+}
+
+func TestDestructiveCommandsLookUpLicenseFirst(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"fix", []string{"fix", "-license", "LIC-MISSING", "-daily", "5"}},
+		{"deactivate", []string{"deactivate", "-license", "LIC-MISSING"}},
+		{"revoke", []string{"revoke", "-license", "LIC-MISSING", "-reason", "test"}},
+		{"delete", []string{"delete", "-license", "LIC-MISSING"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := seedLicense(t, "LIC-EXISTS")
+			out, code := runAdmin(t, path, tt.args...)
+			if code != 1 || !strings.Contains(out, "License not found: LIC-MISSING") {
+				t.Fatalf("exit %d, output %q; want 'License not found'", code, out)
+			}
+			if strings.Contains(out, "Continue?") || strings.Contains(out, "Confirmation needed") {
+				t.Fatalf("asked for confirmation before looking up the license: %q", out)
+			}
+		})
+	}
+}
+
+func TestConfirmationWithoutTerminal(t *testing.T) {
+	path := seedLicense(t, "LIC-EXISTS")
+
+	out, code := runAdmin(t, path, "deactivate", "-license", "LIC-EXISTS")
+	if code != 1 || !strings.Contains(out, "stdin is not a terminal; pass -yes") {
+		t.Fatalf("exit %d, output %q; want a refusal to prompt", code, out)
+	}
+	if !licenseActive(t, path, "LIC-EXISTS") {
+		t.Fatal("license deactivated without confirmation")
+	}
+
+	out, code = runAdmin(t, path, "deactivate", "-license", "LIC-EXISTS", "-yes")
+	if code != 0 || !strings.Contains(out, "License deactivated") {
+		t.Fatalf("exit %d, output %q; want the license deactivated", code, out)
+	}
+	if licenseActive(t, path, "LIC-EXISTS") {
+		t.Fatal("license still active after -yes")
+	}
+}
+
+func TestDeactivateInvalidatesServerCaches(t *testing.T) {
+	var calls []string
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization")+" "+string(body))
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"success":true,"dropped":1}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("LICENSIFY_SERVER_URLS", srv.URL+"/, "+srv.URL)
+	t.Setenv("ADMIN_API_KEY", "admin-key")
+
+	path := seedLicense(t, "LIC-CACHED")
+	if out, code := runAdmin(t, path, "deactivate", "-license", "LIC-CACHED", "-yes"); code != 0 {
+		t.Fatalf("deactivate exited %d: %s", code, out)
+	}
+
+	want := `POST /admin/cache/invalidate Bearer admin-key {"license_key":"LIC-CACHED"}`
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 2 || calls[0] != want || calls[1] != want {
+		t.Fatalf("server got %q, want %q from each server", calls, want)
+	}
+}
+
+// rowsAffected is a sql.Result for an insert that affected n rows
+type rowsAffected int64
+
+func (n rowsAffected) LastInsertId() (int64, error) { return 0, nil }
+func (n rowsAffected) RowsAffected() (int64, error) { return int64(n), nil }
+
+func TestInsertWithNewKey(t *testing.T) {
+	t.Run("retries a colliding key", func(t *testing.T) {
+		var tried []string
+		key, err := insertWithNewKey("pro", func(licenseKey string) (sql.Result, error) {
+			tried = append(tried, licenseKey)
+			if len(tried) < 3 {
+				return rowsAffected(0), nil
+			}
+			return rowsAffected(1), nil
+		})
+		if err != nil {
+			t.Fatalf("insertWithNewKey: %v", err)
+		}
+		if len(tried) != 3 || key != tried[2] {
+			t.Fatalf("got %q after trying %q, want the third key", key, tried)
+		}
+		if tried[0] == tried[1] || tried[1] == tried[2] {
+			t.Fatalf("retries reused a key: %q", tried)
+		}
+	})
+
+	t.Run("every attempt collides", func(t *testing.T) {
+		attempts := 0
+		_, err := insertWithNewKey("pro", func(string) (sql.Result, error) {
+			attempts++
+			return rowsAffected(0), nil
+		})
+		if err == nil {
+			t.Fatal("expected an error when every key is taken")
+		}
+		if attempts != maxKeyAttempts {
+			t.Fatalf("attempts = %d, want %d", attempts, maxKeyAttempts)
+		}
+	})
+
+	t.Run("insert error", func(t *testing.T) {
+		failure := errors.New("disk full")
+		attempts := 0
+		_, err := insertWithNewKey("pro", func(string) (sql.Result, error) {
+			attempts++
+			return nil, failure
+		})
+		if !errors.Is(err, failure) || attempts != 1 {
+			t.Fatalf("error = %v after %d attempts, want %v without retrying", err, attempts, failure)
+		}
+	})
+}
+
+// execSQL runs query against the SQLite database at path
+func execSQL(t *testing.T, path, query string, args ...interface{}) {
+	t.Helper()
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := conn.Exec(query, args...); err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+}
+
+// activatedDevices returns the number of devices activated for licenseID
+func activatedDevices(t *testing.T, path, licenseID string) int {
+	t.Helper()
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	var n int
+	if err := conn.QueryRow("SELECT COUNT(*) FROM activations WHERE license_id = ?", licenseID).Scan(&n); err != nil {
+		t.Fatalf("count activations: %v", err)
+	}
+	return n
+}
+
+func TestActivationsCommands(t *testing.T) {
+	path := seedLicense(t, "LIC-DEVICES")
+	for _, hardwareID := range []string{"hw-laptop-0123456789abcdef", "hw-desktop-0123456789abcdef"} {
+		execSQL(t, path, "INSERT INTO activations (license_id, hardware_id) VALUES (?, ?)", "LIC-DEVICES", hardwareID)
+	}
+
+	out, code := runAdmin(t, path, "activations", "list", "-license", "LIC-DEVICES")
+	if code != 0 || !strings.Contains(out, "(2 of 3)") {
+		t.Fatalf("list exited %d: %s", code, out)
+	}
+	if strings.Contains(out, "hw-laptop-0123456789abcdef") || !strings.Contains(out, "hw-lapto") {
+		t.Fatalf("list without -show-ids should redact hardware IDs: %s", out)
+	}
+	out, _ = runAdmin(t, path, "activations", "list", "-license", "LIC-DEVICES", "-show-ids")
+	if !strings.Contains(out, "hw-laptop-0123456789abcdef") || !strings.Contains(out, "hw-desktop-0123456789abcdef") {
+		t.Fatalf("list -show-ids is missing a device: %s", out)
+	}
+
+	if out, code := runAdmin(t, path, "activations", "reset", "-license", "LIC-DEVICES", "-hardware-id", "hw-laptop-0123456789abcdef", "-yes"); code != 0 {
+		t.Fatalf("reset one device exited %d: %s", code, out)
+	}
+	if n := activatedDevices(t, path, "LIC-DEVICES"); n != 1 {
+		t.Fatalf("%d devices after resetting one, want 1", n)
+	}
+	if out, code := runAdmin(t, path, "activations", "reset", "-license", "LIC-DEVICES", "-hardware-id", "hw-unknown", "-yes"); code != 1 {
+		t.Fatalf("reset an unknown device exited %d, want 1: %s", code, out)
+	}
+
+	out, code = runAdmin(t, path, "activations", "reset", "-license", "LIC-DEVICES", "-yes")
+	if code != 0 || !strings.Contains(out, "Removed 1 device activations") {
+		t.Fatalf("reset every device exited %d: %s", code, out)
+	}
+	if n := activatedDevices(t, path, "LIC-DEVICES"); n != 0 {
+		t.Fatalf("%d devices after resetting all, want 0", n)
+	}
+
+	if out, code := runAdmin(t, path, "activations", "list", "-license", "LIC-MISSING"); code != 1 {
+		t.Fatalf("list for an unknown license exited %d, want 1: %s", code, out)
+	}
+}
+
+// jsonKeys returns the sorted keys of a JSON object
+func jsonKeys(t *testing.T, object map[string]json.RawMessage) string {
+	t.Helper()
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ",")
+}
+
+func TestJSONOutputShape(t *testing.T) {
+	path := seedLicense(t, "LIC-JSON")
+	execSQL(t, path, "INSERT INTO activations (license_id, hardware_id) VALUES (?, ?)", "LIC-JSON", "hw-json")
+	const summaryKeys = "active,created_at,customer_email,customer_name,daily_limit,expires_at,license_key,max_activations,monthly_limit,tier"
+
+	t.Run("get", func(t *testing.T) {
+		out, code := runAdmin(t, path, "get", "-license", "LIC-JSON", "-json")
+		if code != 0 {
+			t.Fatalf("get exited %d: %s", code, out)
+		}
+		var got map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("get -json isn't one JSON object: %v\n%s", err, out)
+		}
+		want := summaryKeys + ",activations,current_activations,last_check_in,products,usage"
+		wantSorted := strings.Split(want, ",")
+		sort.Strings(wantSorted)
+		if keys := jsonKeys(t, got); keys != strings.Join(wantSorted, ",") {
+			t.Fatalf("get keys = %s, want %s", keys, strings.Join(wantSorted, ","))
+		}
+
+		var details struct {
+			LicenseKey         string                       `json:"license_key"`
+			CurrentActivations int                          `json:"current_activations"`
+			Products           []string                     `json:"products"`
+			Activations        []map[string]json.RawMessage `json:"activations"`
+			Usage              map[string]json.RawMessage   `json:"usage"`
+		}
+		if err := json.Unmarshal([]byte(out), &details); err != nil {
+			t.Fatal(err)
+		}
+		if details.LicenseKey != "LIC-JSON" || details.CurrentActivations != 1 || details.Products == nil {
+			t.Fatalf("get = %+v", details)
+		}
+		if len(details.Activations) != 1 || jsonKeys(t, details.Activations[0]) != "activated_at,hardware_id,last_check_in" {
+			t.Fatalf("activations = %v", details.Activations)
+		}
+		if keys := jsonKeys(t, details.Usage); keys != "days,from,to,total_scans" {
+			t.Fatalf("usage keys = %s", keys)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		out, code := runAdmin(t, path, "list", "-json")
+		if code != 0 {
+			t.Fatalf("list exited %d: %s", code, out)
+		}
+		var got struct {
+			Licenses []map[string]json.RawMessage `json:"licenses"`
+			Total    *int                         `json:"total"`
+			Offset   *int                         `json:"offset"`
+			Limit    *int                         `json:"limit"`
+		}
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("list -json isn't one JSON object: %v\n%s", err, out)
+		}
+		if got.Total == nil || *got.Total != 1 || got.Offset == nil || got.Limit == nil || len(got.Licenses) != 1 {
+			t.Fatalf("list = %s", out)
+		}
+		if keys := jsonKeys(t, got.Licenses[0]); keys != summaryKeys {
+			t.Fatalf("license keys = %s, want %s", keys, summaryKeys)
+		}
+
+		// No matches is an empty array, not null
+		out, _ = runAdmin(t, path, "list", "-json", "-tier", "missing")
+		if !strings.Contains(out, `"licenses": []`) {
+			t.Fatalf("empty list = %s", out)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		out, code := runAdmin(t, path, "get", "-license", "LIC-MISSING", "-json")
+		var got struct {
+			Error string `json:"error"`
+		}
+		if code == 0 || json.Unmarshal([]byte(out), &got) != nil || got.Error == "" {
+			t.Fatalf("unknown license exited %d with %s, want a JSON error", code, out)
+		}
+	})
+}
+
+func TestGetJSONDetails(t *testing.T) {
+	const licenseID = "LIC-202601-ABCDEF-123456"
+	path := seedLicense(t, licenseID)
+	checkIn := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	execSQL(t, path, "INSERT INTO activations (license_id, hardware_id, last_check_in) VALUES (?, ?, ?)",
+		licenseID, "hw-laptop-0123456789abcdef", checkIn.Format(time.RFC3339))
+	execSQL(t, path, "INSERT INTO check_ins (license_id, last_check_in) VALUES (?, ?)", licenseID, checkIn.Format("2006-01-02 15:04:05"))
+	// Usage is recorded under the local date; the oldest day is outside the default 30 days
+	today := time.Now().Format("2006-01-02")
+	lastWeek := time.Now().AddDate(0, 0, -7).Format("2006-01-02")
+	for date, scans := range map[string]int{today: 5, lastWeek: 3, time.Now().AddDate(0, 0, -40).Format("2006-01-02"): 100} {
+		execSQL(t, path, "INSERT INTO daily_usage (license_id, date, hardware_id, scans) VALUES (?, ?, ?, ?)",
+			licenseID, date, "hw-laptop-0123456789abcdef", scans)
+	}
+
+	type details struct {
+		LicenseKey    string     `json:"license_key"`
+		CustomerName  string     `json:"customer_name"`
+		CustomerEmail string     `json:"customer_email"`
+		LastCheckIn   *time.Time `json:"last_check_in"`
+		Activations   []struct {
+			HardwareID  string     `json:"hardware_id"`
+			LastCheckIn *time.Time `json:"last_check_in"`
+		} `json:"activations"`
+		Usage struct {
+			To         string `json:"to"`
+			TotalScans int    `json:"total_scans"`
+			Days       []struct {
+				Date  string `json:"date"`
+				Scans int    `json:"scans"`
+			} `json:"days"`
+		} `json:"usage"`
+	}
+	get := func(t *testing.T, args ...string) (details, string) {
+		t.Helper()
+		out, code := runAdmin(t, path, append([]string{"-json", "get", "-license", licenseID}, args...)...)
+		if code != 0 {
+			t.Fatalf("get exited %d: %s", code, out)
+		}
+		var got details
+		if err := json.Unmarshal([]byte(out), &got); err != nil {
+			t.Fatalf("get -json isn't one JSON object: %v\n%s", err, out)
+		}
+		return got, out
+	}
+
+	t.Run("full", func(t *testing.T) {
+		got, _ := get(t)
+		if got.LicenseKey != licenseID || got.CustomerName != "Alice" || got.CustomerEmail != "alice@example.com" {
+			t.Fatalf("license = %+v", got)
+		}
+		if got.LastCheckIn == nil || !got.LastCheckIn.Equal(checkIn) {
+			t.Fatalf("last_check_in = %v, want %v", got.LastCheckIn, checkIn)
+		}
+		if len(got.Activations) != 1 || got.Activations[0].HardwareID != "hw-laptop-0123456789abcdef" ||
+			got.Activations[0].LastCheckIn == nil || !got.Activations[0].LastCheckIn.Equal(checkIn) {
+			t.Fatalf("activations = %+v", got.Activations)
+		}
+		if got.Usage.To != today || got.Usage.TotalScans != 8 || len(got.Usage.Days) != 2 {
+			t.Fatalf("usage = %+v, want 8 scans over 2 days up to %s", got.Usage, today)
+		}
+	})
+
+	t.Run("usage days", func(t *testing.T) {
+		got, _ := get(t, "-usage-days", "1")
+		if got.Usage.TotalScans != 5 || len(got.Usage.Days) != 1 || got.Usage.Days[0].Date != today {
+			t.Fatalf("usage over 1 day = %+v, want today's 5 scans", got.Usage)
+		}
+	})
+
+	t.Run("redact", func(t *testing.T) {
+		got, out := get(t, "-redact")
+		if got.LicenseKey != "LIC-...3456" || got.CustomerName != "***" || got.CustomerEmail != "al***@example.com" {
+			t.Fatalf("redacted license = %+v", got)
+		}
+		if len(got.Activations) != 1 || got.Activations[0].HardwareID != "hw-lapto...cdef" {
+			t.Fatalf("redacted activations = %+v", got.Activations)
+		}
+		for _, secret := range []string{licenseID, "Alice", "alice@", "hw-laptop-0123456789abcdef"} {
+			if strings.Contains(out, secret) {
+				t.Errorf("get -redact leaks %q: %s", secret, out)
+			}
+		}
+		// Redaction only masks identifiers
+		if got.Usage.TotalScans != 8 || got.LastCheckIn == nil {
+			t.Fatalf("get -redact lost usage or check-in: %+v", got)
+		}
+	})
+}
+
+// useAdminTiers points the admin CLI at a tiers file with basic and pro
+func useAdminTiers(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tiers.toml")
+	config := `
+[tiers.basic]
+name = "Basic"
+daily_limit = 100
+monthly_limit = 1000
+max_devices = 2
+
+[tiers.pro]
+name = "Pro"
+daily_limit = 1000
+monthly_limit = 20000
+max_devices = 5
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TIERS_CONFIG_PATH", path)
+}
+
+// licensesFor returns the tiers of the licenses for email, in creation order
+func licensesFor(t *testing.T, path, email string) []string {
+	t.Helper()
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	rows, err := conn.Query("SELECT tier FROM licenses WHERE customer_email = ? ORDER BY created_at, license_id", email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+	var tiers []string
+	for rows.Next() {
+		var tier string
+		if err := rows.Scan(&tier); err != nil {
+			t.Fatal(err)
+		}
+		tiers = append(tiers, tier)
+	}
+	return tiers
+}
+
+func TestImportCSV(t *testing.T) {
+	useAdminTiers(t)
+	csvPath := filepath.Join(t.TempDir(), "customers.csv")
+	rows := "email,name,tier,months\n" +
+		"bob@example.com,Bob,basic,6\n" +
+		"carol@example.com,Carol,pro\n" +
+		"alice@example.com,Alice,pro,12\n" + // already has a license
+		"bob@example.com,Bob again,pro,12\n" + // repeats line 2
+		"dave@example.com,Dave,platinum,12\n" // unknown tier
+	if err := os.WriteFile(csvPath, []byte(rows), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("stops on bad rows", func(t *testing.T) {
+		path := seedLicense(t, "LIC-EXISTING")
+		out, code := runAdmin(t, path, "import", "-file", csvPath)
+		if code != 1 || !strings.Contains(out, "Nothing imported") {
+			t.Fatalf("import exited %d: %s", code, out)
+		}
+		for _, msg := range []string{"line 4: alice@example.com already has a license", "line 5: duplicate email bob@example.com (first seen on line 2)", `line 6: unknown tier "platinum"`} {
+			if !strings.Contains(out, msg) {
+				t.Fatalf("output is missing %q: %s", msg, out)
+			}
+		}
+		if got := licensesFor(t, path, "bob@example.com"); len(got) != 0 {
+			t.Fatalf("bob has licenses %v after a failed import", got)
+		}
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		path := seedLicense(t, "LIC-EXISTING")
+		out, code := runAdmin(t, path, "import", "-file", csvPath, "-continue-on-error")
+		if code != 0 || !strings.Contains(out, "Created:  2") || !strings.Contains(out, "Failed:   3") {
+			t.Fatalf("import exited %d: %s", code, out)
+		}
+		if got := licensesFor(t, path, "bob@example.com"); strings.Join(got, ",") != "basic" {
+			t.Fatalf("bob's licenses = %v, want one basic license", got)
+		}
+		if got := licensesFor(t, path, "carol@example.com"); strings.Join(got, ",") != "pro" {
+			t.Fatalf("carol's licenses = %v, want one pro license", got)
+		}
+		if got := licensesFor(t, path, "alice@example.com"); len(got) != 1 {
+			t.Fatalf("alice has %d licenses, want only the existing one", len(got))
+		}
+		if got := licensesFor(t, path, "dave@example.com"); len(got) != 0 {
+			t.Fatalf("dave got licenses %v on an unknown tier", got)
+		}
+	})
+
+	t.Run("skip duplicates", func(t *testing.T) {
+		path := seedLicense(t, "LIC-EXISTING")
+		out, code := runAdmin(t, path, "import", "-file", csvPath, "-duplicates", "skip", "-continue-on-error")
+		if code != 0 || !strings.Contains(out, "Created:  2") || !strings.Contains(out, "Skipped:  2") || !strings.Contains(out, "Failed:   1") {
+			t.Fatalf("import exited %d: %s", code, out)
+		}
+	})
+}
+
+// emptyDB creates a migrated SQLite database without licenses
+func emptyDB(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "licensify.db")
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	if _, err := migrations.Migrate(conn, false); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return path
+}
+
+func TestExportImportDumpRoundTrip(t *testing.T) {
+	source := seedLicense(t, "LIC-BACKUP")
+	execSQL(t, source, `UPDATE licenses SET encryption_salt = 'a1b2c3', previous_daily_limit = 50,
+		previous_monthly_limit = 500, limits_changed_on = '2026-05-01', created_at = '2025-01-02 03:04:05' WHERE license_id = 'LIC-BACKUP'`)
+	execSQL(t, source, `INSERT INTO license_products (license_id, product_id) VALUES ('LIC-BACKUP', 'editor')`)
+	execSQL(t, source, `INSERT INTO activations (license_id, hardware_id, activated_at, last_check_in)
+		VALUES ('LIC-BACKUP', 'hw-backup', '2025-02-01T10:00:00Z', '2025-03-01T10:00:00Z')`)
+	execSQL(t, source, `INSERT INTO daily_usage (license_id, date, hardware_id, scans) VALUES ('LIC-BACKUP', '2025-03-01', 'hw-backup', 7)`)
+
+	for _, format := range []string{"json", "csv"} {
+		t.Run(format, func(t *testing.T) {
+			args := []string{"export", "-format", format}
+			if format == "json" {
+				args = append(args, "-activations", "-usage")
+			}
+			dir := t.TempDir()
+			dump := filepath.Join(dir, "dump."+format)
+			if out, code := runAdmin(t, source, append(args, "-o", dump)...); code != 0 {
+				t.Fatalf("export exited %d: %s", code, out)
+			}
+
+			target := emptyDB(t)
+			if out, code := runAdmin(t, target, "import-dump", "-file", dump); code != 0 {
+				t.Fatalf("import-dump exited %d: %s", code, out)
+			}
+			again := filepath.Join(dir, "again."+format)
+			if out, code := runAdmin(t, target, append(args, "-o", again)...); code != 0 {
+				t.Fatalf("second export exited %d: %s", code, out)
+			}
+
+			first, err := os.ReadFile(dump)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := os.ReadFile(again)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Everything but the export time must survive the round trip
+			exportedAt := regexp.MustCompile(`"exported_at":"[^"]*"`)
+			first, second = exportedAt.ReplaceAll(first, nil), exportedAt.ReplaceAll(second, nil)
+			if string(first) != string(second) {
+				t.Fatalf("restored export differs:\n%s\nwant:\n%s", second, first)
+			}
+			if format == "json" && (!strings.Contains(string(first), "hw-backup") || !strings.Contains(string(first), "a1b2c3")) {
+				t.Fatalf("export is missing the activation or salt: %s", first)
+			}
+
+			// Restoring over existing licenses fails unless they are skipped
+			if out, code := runAdmin(t, target, "import-dump", "-file", dump); code == 0 {
+				t.Fatalf("second import-dump succeeded: %s", out)
+			}
+			if out, code := runAdmin(t, target, "import-dump", "-file", dump, "-skip-existing"); code != 0 {
+				t.Fatalf("import-dump -skip-existing exited %d: %s", code, out)
+			}
+		})
+	}
+}
+
+func TestTiersValidateAnnualPrice(t *testing.T) {
+	tests := []struct {
+		name    string
+		annual  string
+		warning bool
+	}{
+		{"discounted", "99.00", false},
+		{"twelve months", "120.00", true},
+		{"more than twelve months", "150.00", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tiers.toml")
+			config := "[tiers.basic]\nname = \"Basic\"\nfeatures = [\"basic_api_access\"]\ncurrency = \"EUR\"\nprice_monthly = 10.00\nprice_annual = " + tt.annual + "\n"
+			if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("TIERS_CONFIG_PATH", path)
+
+			out, code := runAdmin(t, filepath.Join(t.TempDir(), "licensify.db"), "tiers", "validate")
+			if code != 0 {
+				t.Fatalf("tiers validate exited %d: %s", code, out)
+			}
+			if got := strings.Contains(out, "price_annual"); got != tt.warning {
+				t.Fatalf("annual price warning = %v, want %v:\n%s", got, tt.warning, out)
+			}
+			if tt.warning && !strings.Contains(out, "(€120.00)") {
+				t.Fatalf("warning doesn't show 12 × price_monthly in the tier's currency:\n%s", out)
+			}
+		})
+	}
+
+	path := filepath.Join(t.TempDir(), "tiers.toml")
+	if err := os.WriteFile(path, []byte("[tiers.basic]\nname = \"Basic\"\ncurrency = \"usd\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TIERS_CONFIG_PATH", path)
+	if out, code := runAdmin(t, filepath.Join(t.TempDir(), "licensify.db"), "tiers", "validate"); code == 0 || !strings.Contains(out, "unknown currency") {
+		t.Fatalf("lower-case currency: exit %d, output:\n%s", code, out)
+	}
+}
+
+// auditRow is one row of the audit_log table
+type auditRow struct {
+	action, target, actor string
+	details               map[string]interface{}
+}
+
+// auditRows returns the audit log at path, oldest first
+func auditRows(t *testing.T, path string) []auditRow {
+	t.Helper()
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = conn.Close() }()
+	rows, err := conn.Query("SELECT action, target_license, actor, details FROM audit_log ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rows.Close() }()
+	var entries []auditRow
+	for rows.Next() {
+		var row auditRow
+		var details string
+		if err := rows.Scan(&row.action, &row.target, &row.actor, &details); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal([]byte(details), &row.details); err != nil {
+			t.Fatalf("audit details %q: %v", details, err)
+		}
+		entries = append(entries, row)
+	}
+	return entries
+}
+
+func TestCreateWritesAuditEntry(t *testing.T) {
+	useAdminTiers(t)
+	t.Setenv("USER", "dana")
+	path := emptyDB(t)
+
+	out, code := runAdmin(t, path, "create", "-email", "carol@example.com", "-name", "Carol", "-tier", "pro", "-months", "6")
+	if code != 0 {
+		t.Fatalf("create exited %d: %s", code, out)
+	}
+	out, code = runAdmin(t, path, "-actor", "ops-bot", "create", "-email", "erin@example.com", "-name", "Erin", "-tier", "basic")
+	if code != 0 {
+		t.Fatalf("create with -actor exited %d: %s", code, out)
+	}
+
+	entries := auditRows(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("audit log has %d entries, want one per create: %+v", len(entries), entries)
+	}
+	first := entries[0]
+	if first.action != "create" || first.actor != "dana" || !strings.HasPrefix(first.target, "LIC-") {
+		t.Fatalf("first entry = %+v, want a create by $USER on the new license", first)
+	}
+	if !licenseActive(t, path, first.target) {
+		t.Fatalf("audit target %s isn't the created license", first.target)
+	}
+	// The command's effective parameters, with tier defaults filled in
+	for flag, want := range map[string]interface{}{"email": "carol@example.com", "tier": "pro", "months": 6.0, "daily": 1000.0} {
+		if got := first.details[flag]; got != want {
+			t.Errorf("details[%s] = %v, want %v", flag, got, want)
+		}
+	}
+	if entries[1].actor != "ops-bot" || entries[1].details["email"] != "erin@example.com" {
+		t.Fatalf("second entry = %+v, want a create by ops-bot", entries[1])
+	}
+
+	out, code = runAdmin(t, path, "audit", "list", "-license", first.target)
+	if code != 0 || !strings.Contains(out, "dana") || strings.Contains(out, "ops-bot") {
+		t.Fatalf("audit list -license exited %d:\n%s", code, out)
+	}
+}
+
+// useCountingSMTP points the admin CLI's email at a local listener that
+// hangs up on every connection, and returns how many it has received
+func useCountingSMTP(t *testing.T) func() int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	var mu sync.Mutex
+	connections := 0
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			connections++
+			mu.Unlock()
+			_ = conn.Close()
+		}
+	}()
+
+	t.Setenv("SMTP_HOST", "127.0.0.1")
+	t.Setenv("SMTP_PORT", strconv.Itoa(ln.Addr().(*net.TCPAddr).Port))
+	t.Setenv("SMTP_TLS", "none")
+	t.Setenv("FROM_EMAIL", "noreply@example.com")
+	return func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return connections
+	}
+}
+
+func TestUpgradeDryRun(t *testing.T) {
+	useAdminTiers(t)
+	emails := useCountingSMTP(t)
+	path := seedLicense(t, "LIC-UPGRADE")
+
+	out, code := runAdmin(t, path, "upgrade", "-license", "LIC-UPGRADE", "-tier", "pro", "-months", "12", "-dry-run")
+	if code != 0 {
+		t.Fatalf("upgrade -dry-run exited %d: %s", code, out)
+	}
+	for _, want := range []string{"DRY RUN", "LIC-UPGRADE (tier-1) - would be DEACTIVATED", "Daily Limit:     1000", "upgrade notice to alice@example.com"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output is missing %q:\n%s", want, out)
+		}
+	}
+	if tiers := licensesFor(t, path, "alice@example.com"); len(tiers) != 1 || !licenseActive(t, path, "LIC-UPGRADE") {
+		t.Fatalf("dry run changed the licenses: %v, old active %v", tiers, licenseActive(t, path, "LIC-UPGRADE"))
+	}
+	if entries := auditRows(t, path); len(entries) != 0 {
+		t.Fatalf("dry run wrote %d audit entries", len(entries))
+	}
+	if n := emails(); n != 0 {
+		t.Fatalf("dry run connected to the mail server %d times", n)
+	}
+
+	// The same command without -dry-run does all three
+	out, code = runAdmin(t, path, "upgrade", "-license", "LIC-UPGRADE", "-tier", "pro", "-months", "12")
+	if code != 0 {
+		t.Fatalf("upgrade exited %d: %s", code, out)
+	}
+	tiers := licensesFor(t, path, "alice@example.com")
+	sort.Strings(tiers)
+	if strings.Join(tiers, ",") != "pro,tier-1" || licenseActive(t, path, "LIC-UPGRADE") {
+		t.Fatalf("after upgrade: licenses %v, old active %v", tiers, licenseActive(t, path, "LIC-UPGRADE"))
+	}
+	if n := emails(); n == 0 {
+		t.Fatal("upgrade didn't try to send the notice")
+	}
+}
+
+func TestTiersAddSetRemove(t *testing.T) {
+	useAdminTiers(t)
+	tiersPath := os.Getenv("TIERS_CONFIG_PATH")
+	config, err := os.ReadFile(tiersPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config = append(config, "\n[tiers.pro-legacy]\nname = \"Pro (legacy)\"\ndeprecated = true\nmigrate_to = \"pro\"\n"...)
+	if err := os.WriteFile(tiersPath, config, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := emptyDB(t)
+
+	out, code := runAdmin(t, path, "tiers", "add", "-name", "team", "-display-name", "Team", "-daily", "5000", "-monthly", "100000", "-devices", "10", "-providers", "openai,anthropic")
+	if code != 0 || !strings.Contains(out, "Added team (Team)") {
+		t.Fatalf("tiers add exited %d:\n%s", code, out)
+	}
+	if out, code := runAdmin(t, path, "tiers", "validate"); code != 0 {
+		t.Fatalf("tiers validate after add exited %d:\n%s", code, out)
+	}
+	if out, code := runAdmin(t, path, "tiers", "set", "-name", "team", "-daily", "6000"); code != 0 {
+		t.Fatalf("tiers set exited %d:\n%s", code, out)
+	}
+
+	out, code = runAdmin(t, path, "-json", "tiers", "list")
+	if code != 0 {
+		t.Fatalf("tiers list exited %d:\n%s", code, out)
+	}
+	var list struct {
+		Tiers []struct {
+			ID         string   `json:"id"`
+			DailyLimit int      `json:"daily_limit"`
+			MaxDevices int      `json:"max_devices"`
+			Providers  []string `json:"providers"`
+		} `json:"tiers"`
+	}
+	if err := json.Unmarshal([]byte(out), &list); err != nil {
+		t.Fatalf("tiers list -json: %v\n%s", err, out)
+	}
+	var listed []string
+	for _, tier := range list.Tiers {
+		listed = append(listed, tier.ID)
+		if tier.ID == "team" && (tier.DailyLimit != 6000 || tier.MaxDevices != 10 || strings.Join(tier.Providers, ",") != "openai,anthropic") {
+			t.Fatalf("team = %+v, want the added settings with the new daily limit", tier)
+		}
+	}
+	if strings.Join(listed, ",") != "basic,pro,pro-legacy,team" {
+		t.Fatalf("tiers listed = %v", listed)
+	}
+
+	// pro is a migration target, so removing it would strand pro-legacy
+	before, _ := os.ReadFile(tiersPath)
+	out, code = runAdmin(t, path, "tiers", "remove", "-name", "pro", "-yes")
+	if code == 0 || !strings.Contains(out, "migration target of tier 'pro-legacy'") {
+		t.Fatalf("removing a migration target exited %d:\n%s", code, out)
+	}
+	if after, _ := os.ReadFile(tiersPath); string(after) != string(before) {
+		t.Fatal("refused removal changed tiers.toml")
+	}
+
+	if out, code := runAdmin(t, path, "tiers", "remove", "-name", "team", "-yes"); code != 0 {
+		t.Fatalf("tiers remove exited %d:\n%s", code, out)
+	}
+	if out, _ := runAdmin(t, path, "tiers", "get", "-name", "team"); !strings.Contains(out, "not found") {
+		t.Fatalf("removed tier still there:\n%s", out)
+	}
+}
@@ -1,27 +1,46 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/melihbirim/licensify/internal/licensekey"
 	"github.com/spf13/cobra"
 )
 
 var (
-	checkKey string
+	checkKey      string
+	checkOffline  bool
+	checkMaxStale time.Duration
 )
 
+// defaultCheckMaxStale is how old a cached check may be before it's no
+// longer trusted offline
+const defaultCheckMaxStale = 72 * time.Hour
+
 var checkCmd = &cobra.Command{
 	Use:   "check",
 	Short: "Check license validity with server",
-	Long:  `Verify license status with the server and display usage information.`,
+	Long: `Verify license status with the server and display usage information.
+
+Each answer from the server is saved. When the server can't be reached the
+saved status is shown instead, marked stale, as long as it is newer than
+--max-stale. --offline skips the server and always uses the saved status.`,
 	Example: `  licensify check
-  licensify check --key LIC-xxx`,
+  licensify check --key LIC-xxx
+  licensify check --offline
+  licensify check --max-stale 24h`,
 	RunE: runCheck,
 }
 
 func init() {
 	checkCmd.Flags().StringVarP(&checkKey, "key", "k", "", "License key (uses saved key if omitted)")
+	checkCmd.Flags().BoolVar(&checkOffline, "offline", false, "Show the saved status without contacting the server")
+	checkCmd.Flags().DurationVar(&checkMaxStale, "max-stale", defaultCheckMaxStale, "Oldest saved status to show when offline (LICENSIFY_CHECK_MAX_STALE sets the default)")
 }
 
 func runCheck(cmd *cobra.Command, args []string) error {
@@ -38,18 +57,57 @@ func runCheck(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("no license key provided and no saved key found. Use --key or run 'licensify verify' first")
 		}
 	}
+	if err := licensekey.VerifyChecksum(licenseKey); err != nil {
+		return err
+	}
 
-	client := newHTTPClient(config.Server)
-
-	printInfo("Checking license with server...")
+	maxStale := checkMaxStale
+	if !cmd.Flags().Changed("max-stale") {
+		if env := os.Getenv("LICENSIFY_CHECK_MAX_STALE"); env != "" {
+			if maxStale, err = time.ParseDuration(env); err != nil {
+				return fmt.Errorf("invalid LICENSIFY_CHECK_MAX_STALE: %w", err)
+			}
+		}
+	}
 
-	resp, err := client.checkLicense(licenseKey)
-	if err != nil {
-		return fmt.Errorf("check failed: %w", err)
+	var resp *CheckResponse
+	if checkOffline {
+		if resp, err = cachedCheck(config, licenseKey, maxStale); err != nil {
+			return err
+		}
+	} else {
+		client := newHTTPClient(config.Server)
+
+		printInfo("Checking license with server...")
+
+		resp, err = client.checkLicense(licenseKey)
+		if err != nil {
+			if !isUnreachable(err) {
+				return fmt.Errorf("check failed: %w", err)
+			}
+			printError(fmt.Sprintf("Server unreachable: %v", err))
+			cached, cacheErr := cachedCheck(config, licenseKey, maxStale)
+			if cacheErr != nil {
+				return fmt.Errorf("check failed: %w (%v)", err, cacheErr)
+			}
+			resp = cached
+		} else {
+			// Save the answer, valid or not, for offline use
+			config.LastCheck = time.Now()
+			config.CachedCheck = &CachedCheck{LicenseKey: licenseKey, FetchedAt: config.LastCheck, Response: *resp}
+			if err := saveConfig(config); err != nil {
+				// Don't fail on config save error
+				printError(fmt.Sprintf("Warning: Could not save config: %v", err))
+			}
+		}
 	}
 
 	if !resp.Valid {
-		printError("License is NOT valid")
+		if resp.Reason != "" {
+			printError(fmt.Sprintf("License is NOT valid: %s", resp.Reason))
+		} else {
+			printError("License is NOT valid")
+		}
 		return fmt.Errorf("license validation failed")
 	}
 
@@ -59,6 +117,9 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	fmt.Println("───────────────────")
 	fmt.Printf("Status:        ✅ Active\n")
 	fmt.Printf("Tier:          %s\n", resp.Tier)
+	if len(resp.Products) > 0 {
+		fmt.Printf("Products:      %s\n", strings.Join(resp.Products, ", "))
+	}
 
 	if resp.CustomerName != "" {
 		fmt.Printf("Customer:      %s\n", resp.CustomerName)
@@ -97,12 +158,42 @@ func runCheck(cmd *cobra.Command, args []string) error {
 	}
 	fmt.Println()
 
-	// Update last check time
-	config.LastCheck = time.Now()
-	if err := saveConfig(config); err != nil {
-		// Don't fail on config save error
-		printError(fmt.Sprintf("Warning: Could not save config: %v", err))
+	if resp.DailyTokens > 0 || resp.MonthlyTokens > 0 {
+		fmt.Printf("Tokens:        %d today, %d this month\n", resp.DailyTokens, resp.MonthlyTokens)
 	}
 
 	return nil
 }
+
+// isUnreachable reports whether a request failed before the server answered,
+// as opposed to the server rejecting it
+func isUnreachable(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// cachedCheck returns the saved check response for licenseKey if it is no
+// older than maxStale, after printing a banner saying how old it is
+func cachedCheck(config *Config, licenseKey string, maxStale time.Duration) (*CheckResponse, error) {
+	cached := config.CachedCheck
+	if cached == nil || cached.LicenseKey != licenseKey {
+		return nil, fmt.Errorf("no saved status for this license; run 'licensify check' while online first")
+	}
+
+	age := time.Since(cached.FetchedAt)
+	if age > maxStale {
+		return nil, fmt.Errorf("saved status from %s is older than %s and has expired; connect to the server to check again",
+			cached.FetchedAt.Format("2006-01-02 15:04"), maxStale)
+	}
+
+	fmt.Printf("⚠️  Offline: showing saved status, stale as of %s (%s ago)\n",
+		cached.FetchedAt.Format("2006-01-02 15:04"), age.Round(time.Minute))
+
+	resp := cached.Response
+	// The license may have expired since the status was saved
+	if resp.Valid && !resp.ExpiresAt.IsZero() && time.Now().After(resp.ExpiresAt) {
+		resp.Valid = false
+		resp.Reason = "license expired"
+	}
+	return &resp, nil
+}
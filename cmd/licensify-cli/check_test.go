@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/licensekey"
+)
+
+// checkServer answers /check with a valid pro license
+func checkServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(CheckResponse{
+			Valid:      true,
+			Tier:       "pro",
+			ExpiresAt:  time.Now().AddDate(0, 6, 0),
+			DailyLimit: 1000,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCheckFallsBackToCache(t *testing.T) {
+	useConfigHome(t)
+	t.Setenv("LICENSIFY_CHECK_MAX_STALE", "")
+	previous := retryCount
+	retryCount = 0
+	t.Cleanup(func() { retryCount = previous })
+
+	key, err := licensekey.GenerateKeyWithChecksum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := checkServer(t)
+	if err := saveConfig(&Config{Server: srv.URL, LicenseKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := captureStdout(t, func() error { return runCheck(checkCmd, nil) })
+	if err != nil || strings.Contains(out, "Offline") {
+		t.Fatalf("online check: %v\n%s", err, out)
+	}
+	config, err := loadConfig()
+	if err != nil || config.CachedCheck == nil || config.CachedCheck.LicenseKey != key || config.CachedCheck.Response.Tier != "pro" {
+		t.Fatalf("cached check = %+v, %v", config.CachedCheck, err)
+	}
+
+	// With the server gone the saved status is shown, marked stale
+	srv.Close()
+	out, err = captureStdout(t, func() error { return runCheck(checkCmd, nil) })
+	if err != nil {
+		t.Fatalf("offline check: %v", err)
+	}
+	if !strings.Contains(out, "stale as of") || !strings.Contains(out, "Tier:          pro") {
+		t.Fatalf("offline check printed:\n%s", out)
+	}
+
+	// A cache older than the threshold is refused
+	config.CachedCheck.FetchedAt = time.Now().Add(-defaultCheckMaxStale - time.Hour)
+	if err := saveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := captureStdout(t, func() error { return runCheck(checkCmd, nil) }); err == nil || !strings.Contains(err.Error(), "has expired") {
+		t.Fatalf("too-stale cache: error = %v", err)
+	}
+	t.Setenv("LICENSIFY_CHECK_MAX_STALE", "100h")
+	if _, err := captureStdout(t, func() error { return runCheck(checkCmd, nil) }); err != nil {
+		t.Fatalf("cache inside LICENSIFY_CHECK_MAX_STALE: %v", err)
+	}
+}
+
+func TestCachedCheck(t *testing.T) {
+	now := time.Now()
+	config := &Config{CachedCheck: &CachedCheck{
+		LicenseKey: "LIC-CACHED",
+		FetchedAt:  now.Add(-2 * time.Hour),
+		Response:   CheckResponse{Valid: true, Tier: "pro", ExpiresAt: now.Add(-time.Hour)},
+	}}
+
+	tests := []struct {
+		name     string
+		key      string
+		maxStale time.Duration
+		wantErr  bool
+	}{
+		{"inside the threshold", "LIC-CACHED", 3 * time.Hour, false},
+		{"past the threshold", "LIC-CACHED", time.Hour, true},
+		{"another license", "LIC-OTHER", 3 * time.Hour, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *CheckResponse
+			_, err := captureStdout(t, func() error {
+				var err error
+				resp, err = cachedCheck(config, tt.key, tt.maxStale)
+				return err
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			// The license expired after the status was saved
+			if err == nil && (resp.Valid || resp.Reason != "license expired") {
+				t.Fatalf("response = %+v, want it marked expired", resp)
+			}
+		})
+	}
+	if !config.CachedCheck.Response.Valid {
+		t.Fatal("cachedCheck changed the saved response")
+	}
+}
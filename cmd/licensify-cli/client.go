@@ -2,24 +2,41 @@ package main
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/bits"
+	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"strconv"
 	"time"
 )
 
 type HTTPClient struct {
 	baseURL string
-	client  *http.Client
+	client  *http.Client  // Timeout applies to each attempt
+	retries int           // extra attempts after a transient failure
+	backoff time.Duration // wait before the first retry, doubled after each
 }
 
+// maxRetryBackoff caps the wait between attempts
+const maxRetryBackoff = 10 * time.Second
+
 func newHTTPClient(baseURL string) *HTTPClient {
 	return &HTTPClient{
 		baseURL: baseURL,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
+		retries: retryCount,
+		backoff: retryBackoff,
 	}
 }
 
@@ -37,41 +54,123 @@ func (c *HTTPClient) post(endpoint string, payload interface{}) ([]byte, error)
 
 	req.Header.Set("Content-Type", "application/json")
 
+	return c.do(req)
+}
+
+func (c *HTTPClient) get(endpoint string) ([]byte, error) {
+	req, err := http.NewRequest("GET", c.baseURL+endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	return c.do(req)
+}
+
+// do sends a request and returns the body of a 200 response, turning
+// anything else into an error with the server's message. Transient failures
+// are retried with exponential backoff; see retryable.
+func (c *HTTPClient) do(req *http.Request) ([]byte, error) {
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		body, status, err := c.attempt(req)
+		if err == nil && status == http.StatusOK {
+			return body, nil
+		}
+		if attempt >= c.retries || !retryable(req, status, err) {
+			if err != nil {
+				return nil, err
+			}
+			return nil, responseError(status, body)
+		}
+
+		reason := http.StatusText(status)
+		if err != nil {
+			reason = "connection failed"
+		}
+		fmt.Fprintf(os.Stderr, "  ↻ %s, retrying in %s...\n", reason, backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, maxRetryBackoff)
+
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, fmt.Errorf("failed to create request: %w", err)
+			}
+		}
+	}
+}
+
+// attempt sends req once, returning the response body and status
+func (c *HTTPClient) attempt(req *http.Request) ([]byte, int, error) {
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, 0, fmt.Errorf("request failed: %w", err)
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
+		return nil, 0, fmt.Errorf("failed to read response: %w", err)
 	}
+	return body, resp.StatusCode, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		// Try to parse error message
-		var errorResp struct {
-			Error   string `json:"error"`
-			Message string `json:"message"`
+// retryable reports whether a failed attempt is safe to repeat: the server
+// or a gateway in front of it was unavailable (502, 503, or 504 for a GET),
+// or the request never reached it. A POST that may have been received, e.g.
+// one that timed out waiting for the answer or got a gateway timeout, isn't
+// repeated since /init would send a second email. 4xx responses are never
+// retried.
+func retryable(req *http.Request, status int, err error) bool {
+	if err == nil {
+		switch status {
+		case http.StatusBadGateway, http.StatusServiceUnavailable:
+			return true
+		case http.StatusGatewayTimeout:
+			return req.Method == http.MethodGet
 		}
-		if json.Unmarshal(body, &errorResp) == nil {
-			if errorResp.Error != "" {
-				return nil, fmt.Errorf("API error: %s", errorResp.Error)
-			}
-			if errorResp.Message != "" {
-				return nil, fmt.Errorf("API error: %s", errorResp.Message)
+		return false
+	}
+	if req.Method == http.MethodGet {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// responseError turns a non-200 response into an error with the server's
+// message
+func responseError(status int, body []byte) error {
+	// Try to parse error message
+	var errorResp struct {
+		Error      string `json:"error"`
+		Message    string `json:"message"`
+		Code       string `json:"code"`
+		ServerTime int64  `json:"server_time"`
+	}
+	if json.Unmarshal(body, &errorResp) == nil {
+		if errorResp.Code == "timestamp_out_of_window" && errorResp.ServerTime != 0 {
+			offset, direction := time.Since(time.Unix(errorResp.ServerTime, 0)).Round(time.Second), "ahead of"
+			if offset < 0 {
+				offset, direction = -offset, "behind"
 			}
+			return fmt.Errorf("API error: %s (local clock is %s %s the server)", errorResp.Error, offset, direction)
+		}
+		if errorResp.Error != "" {
+			return fmt.Errorf("API error: %s", errorResp.Error)
+		}
+		if errorResp.Message != "" {
+			return fmt.Errorf("API error: %s", errorResp.Message)
 		}
-		return nil, fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
 	}
-
-	return body, nil
+	return fmt.Errorf("API error (status %d): %s", status, string(body))
 }
 
 // Init requests a new license
 type InitRequest struct {
-	Email string `json:"email"`
-	Tier  string `json:"tier"`
+	Email             string `json:"email"`
+	Tier              string `json:"tier"`
+	Challenge         string `json:"challenge,omitempty"`
+	ChallengeResponse string `json:"challenge_response,omitempty"`
 }
 
 type InitResponse struct {
@@ -80,11 +179,8 @@ type InitResponse struct {
 	Email   string `json:"email"`
 }
 
-func (c *HTTPClient) requestLicense(email, tier string) (*InitResponse, error) {
-	body, err := c.post("/init", InitRequest{
-		Email: email,
-		Tier:  tier,
-	})
+func (c *HTTPClient) requestLicense(req InitRequest) (*InitResponse, error) {
+	body, err := c.post("/init", req)
 	if err != nil {
 		return nil, err
 	}
@@ -97,6 +193,71 @@ func (c *HTTPClient) requestLicense(email, tier string) (*InitResponse, error) {
 	return &resp, nil
 }
 
+// InitChallengeResponse describes the anti-bot challenge /init expects
+type InitChallengeResponse struct {
+	Type       string `json:"type"` // "none", "pow" or "captcha"
+	Challenge  string `json:"challenge,omitempty"`
+	Difficulty int    `json:"difficulty,omitempty"`
+	Provider   string `json:"provider,omitempty"`
+}
+
+func (c *HTTPClient) initChallenge() (*InitChallengeResponse, error) {
+	body, err := c.get("/init/challenge")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp InitChallengeResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// TiersResponse lists the tiers the server offers, keyed by tier name
+type TiersResponse struct {
+	Success bool `json:"success"`
+	Tiers   map[string]struct {
+		Name        string `json:"name"`
+		Description string `json:"description"`
+	} `json:"tiers"`
+}
+
+func (c *HTTPClient) tiers() (*TiersResponse, error) {
+	body, err := c.get("/tiers")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp TiersResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// solveProofOfWork finds a response such that SHA-256(challenge + ":" +
+// response) starts with difficulty zero bits
+func solveProofOfWork(challenge string, difficulty int) string {
+	for n := 0; ; n++ {
+		response := strconv.Itoa(n)
+		sum := sha256.Sum256([]byte(challenge + ":" + response))
+		zeros := 0
+		for _, b := range sum {
+			if b != 0 {
+				zeros += bits.LeadingZeros8(b)
+				break
+			}
+			zeros += 8
+		}
+		if zeros >= difficulty {
+			return response
+		}
+	}
+}
+
 // Verify verifies email and creates license
 type VerifyRequest struct {
 	Email string `json:"email"`
@@ -138,12 +299,28 @@ type ActivateRequest struct {
 	HardwareID string `json:"hardware_id"`
 }
 
+// ActivateResponse mirrors the server's ActivationResponse.
+// EncryptedAPIKey is an AES-256-GCM sealed DecryptedBundle (base64) with its
+// nonce in IV; decryptBundle derives the key from the license key, hardware ID
+// and Salt. In "proxy" mode the bundle's api_key is the proxy key.
 type ActivateResponse struct {
-	Success         bool   `json:"success"`
-	Message         string `json:"message,omitempty"`
-	EncryptedBundle string `json:"encrypted_bundle,omitempty"`
-	BundleSignature string `json:"bundle_signature,omitempty"`
-	ProxyKey        string `json:"proxy_key,omitempty"`
+	Success         bool       `json:"success"`
+	Mode            string     `json:"mode,omitempty"`
+	CustomerName    string     `json:"customer_name,omitempty"`
+	ExpiresAt       time.Time  `json:"expires_at,omitempty"`
+	Tier            string     `json:"tier,omitempty"`
+	EncryptedAPIKey string     `json:"encrypted_api_key,omitempty"`
+	IV              string     `json:"iv,omitempty"`
+	Salt            string     `json:"salt,omitempty"`
+	BundleSignature string     `json:"bundle_signature,omitempty"`
+	Products        []string   `json:"products,omitempty"`
+	ProxyKeyExpires *time.Time `json:"proxy_key_expires_at,omitempty"`
+	Limits          struct {
+		DailyLimit     int `json:"daily_limit"`
+		MonthlyLimit   int `json:"monthly_limit"`
+		MaxActivations int `json:"max_activations"`
+	} `json:"limits,omitempty"`
+	Error string `json:"error,omitempty"`
 }
 
 func (c *HTTPClient) activateLicense(licenseKey, hardwareID string) (*ActivateResponse, error) {
@@ -163,20 +340,195 @@ func (c *HTTPClient) activateLicense(licenseKey, hardwareID string) (*ActivateRe
 	return &resp, nil
 }
 
+// ProxyKeyRotationRequest asks the server for a new proxy key. Signature is
+// HMAC-SHA256(proxy_key, timestamp + "rotate").
+type ProxyKeyRotationRequest struct {
+	ProxyKey  string `json:"proxy_key"`
+	Timestamp int64  `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// rotateProxyKey replaces proxyKey on the server. The new key comes back in
+// an activation bundle.
+func (c *HTTPClient) rotateProxyKey(proxyKey string) (*ActivateResponse, error) {
+	timestamp := time.Now().Unix()
+	mac := hmac.New(sha256.New, []byte(proxyKey))
+	mac.Write([]byte(fmt.Sprintf("%drotate", timestamp)))
+
+	body, err := c.post("/proxy-key/rotate", ProxyKeyRotationRequest{
+		ProxyKey:  proxyKey,
+		Timestamp: timestamp,
+		Signature: hex.EncodeToString(mac.Sum(nil)),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ActivateResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// ActivationTestResponse holds a sentinel bundle from /activate/test
+type ActivationTestResponse struct {
+	Success         bool   `json:"success"`
+	EncryptedAPIKey string `json:"encrypted_api_key"`
+	IV              string `json:"iv"`
+	Salt            string `json:"salt"`
+	KDF             string `json:"kdf"`
+	Sentinel        string `json:"sentinel"`
+}
+
+func (c *HTTPClient) activationTest(licenseKey, hardwareID string) (*ActivationTestResponse, error) {
+	body, err := c.post("/activate/test", ActivateRequest{
+		LicenseKey: licenseKey,
+		HardwareID: hardwareID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ActivationTestResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// PubKeyResponse holds the server's bundle signing key
+type PubKeyResponse struct {
+	Algorithm   string   `json:"algorithm"`
+	PublicKey   string   `json:"public_key"`
+	RetiredKeys []string `json:"retired_keys,omitempty"`
+}
+
+func (c *HTTPClient) publicKey() (*PubKeyResponse, error) {
+	body, err := c.get("/pubkey")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp PubKeyResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// RevocationsResponse is the server's signed list of revoked licenses
+type RevocationsResponse struct {
+	Revocations json.RawMessage `json:"revocations"`
+	Algorithm   string          `json:"algorithm"`
+	Signature   string          `json:"signature"`
+	PublicKey   string          `json:"public_key"`
+}
+
+func (c *HTTPClient) revocations() (*RevocationsResponse, error) {
+	body, err := c.get("/revocations")
+	if err != nil {
+		return nil, err
+	}
+
+	var resp RevocationsResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// Deactivate releases this machine's activation seat
+type DeactivateRequest struct {
+	LicenseKey string `json:"license_key"`
+	HardwareID string `json:"hardware_id"`
+}
+
+type DeactivateResponse struct {
+	Success        bool   `json:"success"`
+	Message        string `json:"message"`
+	Activations    int    `json:"activations"`
+	MaxActivations int    `json:"max_activations"`
+}
+
+func (c *HTTPClient) deactivateLicense(licenseKey, hardwareID string) (*DeactivateResponse, error) {
+	body, err := c.post("/deactivate", DeactivateRequest{
+		LicenseKey: licenseKey,
+		HardwareID: hardwareID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp DeactivateResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// ReceiptResponse is a signed proof of license. Signature covers the
+// compact form of Receipt.
+type ReceiptResponse struct {
+	Receipt   json.RawMessage `json:"receipt"`
+	Algorithm string          `json:"algorithm"`
+	Signature string          `json:"signature"`
+	PublicKey string          `json:"public_key"`
+}
+
+// LicenseReceipt holds the fields of a receipt
+type LicenseReceipt struct {
+	Version       int       `json:"version"`
+	LicenseID     string    `json:"license_id"`
+	CustomerName  string    `json:"customer_name"`
+	CustomerEmail string    `json:"customer_email"`
+	Tier          string    `json:"tier"`
+	HardwareID    string    `json:"hardware_id"`
+	ActivatedAt   time.Time `json:"activated_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	IssuedAt      time.Time `json:"issued_at"`
+}
+
+func (c *HTTPClient) receipt(licenseKey, hardwareID string) (*ReceiptResponse, error) {
+	body, err := c.post("/receipt", ActivateRequest{
+		LicenseKey: licenseKey,
+		HardwareID: hardwareID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ReceiptResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
 // Check checks license status
 type CheckRequest struct {
 	LicenseKey string `json:"license_key"`
 }
 
 type CheckResponse struct {
-	Valid        bool      `json:"valid"`
-	CustomerName string    `json:"customer_name,omitempty"`
-	Tier         string    `json:"tier,omitempty"`
-	ExpiresAt    time.Time `json:"expires_at,omitempty"`
-	DailyUsage   int       `json:"daily_usage,omitempty"`
-	MonthlyUsage int       `json:"monthly_usage,omitempty"`
-	DailyLimit   int       `json:"daily_limit,omitempty"`
-	MonthlyLimit int       `json:"monthly_limit,omitempty"`
+	Valid         bool      `json:"valid"`
+	Reason        string    `json:"reason,omitempty"`
+	CustomerName  string    `json:"customer_name,omitempty"`
+	Tier          string    `json:"tier,omitempty"`
+	Products      []string  `json:"products,omitempty"`
+	ExpiresAt     time.Time `json:"expires_at,omitempty"`
+	DailyUsage    int       `json:"daily_usage,omitempty"`
+	MonthlyUsage  int       `json:"monthly_usage,omitempty"`
+	DailyLimit    int       `json:"daily_limit,omitempty"`
+	MonthlyLimit  int       `json:"monthly_limit,omitempty"`
+	DailyTokens   int64     `json:"daily_tokens,omitempty"`
+	MonthlyTokens int64     `json:"monthly_tokens,omitempty"`
 }
 
 func (c *HTTPClient) checkLicense(licenseKey string) (*CheckResponse, error) {
@@ -194,3 +546,204 @@ func (c *HTTPClient) checkLicense(licenseKey string) (*CheckResponse, error) {
 
 	return &resp, nil
 }
+
+// UsageHistoryResponse is a license's daily usage over a date range
+type UsageHistoryResponse struct {
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Days       []UsageDay `json:"days"`
+	TotalScans int        `json:"total_scans"`
+	DailyLimit int        `json:"daily_limit"`
+}
+
+type UsageDay struct {
+	Date  string `json:"date"`
+	Scans int    `json:"scans"`
+}
+
+// usageHistory fetches daily usage between from and to (YYYY-MM-DD); empty
+// values use the server's defaults
+func (c *HTTPClient) usageHistory(licenseKey, from, to string) (*UsageHistoryResponse, error) {
+	query := url.Values{"license_key": {licenseKey}}
+	if from != "" {
+		query.Set("from", from)
+	}
+	if to != "" {
+		query.Set("to", to)
+	}
+	body, err := c.get("/usage?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	var resp UsageHistoryResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// UsageBatchRequest reports several days of usage for one license at once
+type UsageBatchRequest struct {
+	LicenseKey string            `json:"license_key"`
+	Entries    []UsageBatchEntry `json:"entries"`
+}
+
+type UsageBatchEntry struct {
+	Date       string `json:"date"` // YYYY-MM-DD
+	Scans      int    `json:"scans"`
+	HardwareID string `json:"hardware_id"`
+}
+
+// UsageResponse is the license's usage after a report
+type UsageResponse struct {
+	Success      bool   `json:"success"`
+	Recorded     int    `json:"recorded"`
+	DailyUsage   int    `json:"daily_usage"`
+	MonthlyUsage int    `json:"monthly_usage"`
+	DailyLimit   int    `json:"daily_limit"`
+	MonthlyLimit int    `json:"monthly_limit"`
+	Tier         string `json:"tier"`
+}
+
+// reportUsageBatch records entries in a single request; the server applies
+// all of them or none
+func (c *HTTPClient) reportUsageBatch(licenseKey string, entries []UsageBatchEntry) (*UsageResponse, error) {
+	body, err := c.post("/usage/batch", UsageBatchRequest{
+		LicenseKey: licenseKey,
+		Entries:    entries,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp UsageResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// Trial requests an anonymous trial license bound to this machine
+type TrialRequest struct {
+	HardwareID string `json:"hardware_id"`
+}
+
+type TrialResponse struct {
+	Success      bool      `json:"success"`
+	Message      string    `json:"message"`
+	LicenseKey   string    `json:"license_key"`
+	Tier         string    `json:"tier"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	DailyLimit   int       `json:"daily_limit"`
+	MonthlyLimit int       `json:"monthly_limit"`
+}
+
+func (c *HTTPClient) requestTrial(hardwareID string) (*TrialResponse, error) {
+	body, err := c.post("/trial", TrialRequest{
+		HardwareID: hardwareID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp TrialResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// ProxyRequest is a signed call to a provider through the server's /proxy
+// endpoint. Signature is HMAC-SHA256(proxy_key, message), where message is
+// timestamp, method, path, provider and body joined by newlines.
+type ProxyRequest struct {
+	ProxyKey  string          `json:"proxy_key"`
+	Provider  string          `json:"provider"`
+	Body      json.RawMessage `json:"body"`
+	Signature string          `json:"signature"`
+	Timestamp int64           `json:"timestamp"`
+	Nonce     string          `json:"nonce,omitempty"`
+}
+
+// Server-side limits on proxied calls, plus headroom for the server itself
+const (
+	proxyClientTimeout       = 90 * time.Second
+	proxyClientStreamTimeout = 11 * time.Minute
+)
+
+// signProxyRequest signs a provider call the way the server's
+// validateProxySignature checks it. path is the request path, e.g.
+// /proxy/openai/v1/chat/completions.
+func signProxyRequest(proxyKey, method, path, provider, nonce string, body []byte, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(proxyKey))
+	mac.Write([]byte(fmt.Sprintf("%d\n%s\n%s\n%s\n%s\n%s", timestamp, method, path, provider, nonce, body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// proxy sends body to provider through /proxy/<provider><path> and returns
+// the upstream response for the caller to read and close. Errors from the
+// server or provider are returned with their message.
+func (c *HTTPClient) proxy(proxyKey, provider, path string, body []byte, stream bool) (*http.Response, error) {
+	// The server checks the signature against body exactly as it appears
+	// in the request, which json.Marshal would compact, so compact it first
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, body); err != nil {
+		return nil, fmt.Errorf("request body is not valid JSON: %w", err)
+	}
+	timestamp := time.Now().Unix()
+
+	// The server accepts each nonce once, so retries must sign a new one
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+
+	// The signature covers the path as the server decodes it
+	endpoint, err := url.Parse("/proxy/" + provider + path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid path %q: %w", path, err)
+	}
+
+	var payload bytes.Buffer
+	encoder := json.NewEncoder(&payload)
+	encoder.SetEscapeHTML(false) // keep <, > and & as signed
+	if err := encoder.Encode(ProxyRequest{
+		ProxyKey:  proxyKey,
+		Provider:  provider,
+		Body:      compact.Bytes(),
+		Signature: signProxyRequest(proxyKey, http.MethodPost, endpoint.Path, provider, nonce, compact.Bytes(), timestamp),
+		Timestamp: timestamp,
+		Nonce:     nonce,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+endpoint.String(), &payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	timeout := proxyClientTimeout
+	if stream {
+		timeout = proxyClientStreamTimeout
+	}
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer func() { _ = resp.Body.Close() }()
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response: %w", err)
+		}
+		return nil, responseError(resp.StatusCode, data)
+	}
+	return resp, nil
+}
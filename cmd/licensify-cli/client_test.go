@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testClient returns a client for url that retries twice without waiting
+func testClient(url string) *HTTPClient {
+	return &HTTPClient{
+		baseURL: url,
+		client:  &http.Client{Timeout: 5 * time.Second},
+		retries: 2,
+		backoff: time.Millisecond,
+	}
+}
+
+// failingServer answers the first failures requests with status, then 200
+func failingServer(t *testing.T, failures int, status int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(atomic.AddInt32(&calls, 1)) <= failures {
+			w.WriteHeader(status)
+			_, _ = w.Write([]byte(`{"error":"try again"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		failures  int
+		status    int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{"POST retried after 502", http.MethodPost, 1, http.StatusBadGateway, false, 2},
+		{"POST retried after 503", http.MethodPost, 2, http.StatusServiceUnavailable, false, 3},
+		{"POST not retried after 504", http.MethodPost, 1, http.StatusGatewayTimeout, true, 1},
+		{"GET retried after 504", http.MethodGet, 1, http.StatusGatewayTimeout, false, 2},
+		{"POST 400 fails immediately", http.MethodPost, 1, http.StatusBadRequest, true, 1},
+		{"GET 404 fails immediately", http.MethodGet, 1, http.StatusNotFound, true, 1},
+		{"gives up after the retries", http.MethodGet, 5, http.StatusServiceUnavailable, true, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := failingServer(t, tt.failures, tt.status)
+			client := testClient(srv.URL)
+
+			var err error
+			if tt.method == http.MethodPost {
+				_, err = client.post("/init", map[string]string{"email": "a@example.com"})
+			} else {
+				_, err = client.get("/tiers")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error: %v", err, tt.wantErr)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Fatalf("server got %d requests, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestClientRetriesPostBody(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != `{"email":"a@example.com"}` {
+			t.Errorf("attempt %d sent body %q", atomic.LoadInt32(&calls)+1, body)
+		}
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true}`))
+	}))
+	defer srv.Close()
+
+	if _, err := testClient(srv.URL).post("/init", map[string]string{"email": "a@example.com"}); err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Fatalf("server got %d requests, want 2", calls)
+	}
+}
+
+func TestClientRetriesPostDialErrors(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String()
+	_ = listener.Close()
+
+	client := testClient(url)
+	client.retries = 1
+	_, err = client.post("/init", map[string]string{"email": "a@example.com"})
+	if err == nil || !strings.Contains(err.Error(), "request failed") {
+		t.Fatalf("error = %v, want a connection failure", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, url, nil)
+	if !retryable(req, 0, &net.OpError{Op: "dial", Err: err}) {
+		t.Fatal("POST dial error isn't retryable")
+	}
+	if retryable(req, 0, &net.OpError{Op: "read", Err: err}) {
+		t.Fatal("POST read error is retryable")
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/melihbirim/licensify/internal/redact"
 	"github.com/spf13/cobra"
 )
 
@@ -30,6 +32,7 @@ You will receive a verification code via email.`,
 func init() {
 	initCmd.Flags().StringVarP(&initEmail, "email", "e", "", "Email address")
 	initCmd.Flags().StringVarP(&initTier, "tier", "t", "", "License tier (free, pro, enterprise)")
+	_ = initCmd.RegisterFlagCompletionFunc("tier", completeTiers)
 }
 
 func runInit(cmd *cobra.Command, args []string) error {
@@ -91,7 +94,21 @@ func runInit(cmd *cobra.Command, args []string) error {
 
 	printInfo(fmt.Sprintf("Requesting license for %s (tier: %s)...", initEmail, initTier))
 
-	resp, err := client.requestLicense(initEmail, initTier)
+	req := InitRequest{Email: initEmail, Tier: initTier}
+
+	// Servers without /init/challenge don't require one
+	if challenge, err := client.initChallenge(); err == nil {
+		switch challenge.Type {
+		case "pow":
+			printInfo(fmt.Sprintf("Solving anti-bot challenge (difficulty %d)...", challenge.Difficulty))
+			req.Challenge = challenge.Challenge
+			req.ChallengeResponse = solveProofOfWork(challenge.Challenge, challenge.Difficulty)
+		case "captcha":
+			return fmt.Errorf("this server requires a %s CAPTCHA for new licenses; request one through its signup page instead", challenge.Provider)
+		}
+	}
+
+	resp, err := client.requestLicense(req)
 	if err != nil {
 		return fmt.Errorf("failed to request license: %w", err)
 	}
@@ -205,8 +222,10 @@ func runVerify(cmd *cobra.Command, args []string) error {
 
 // Activate command
 var (
-	activateKey        string
-	activateHardwareID string
+	activateKey         string
+	activateHardwareID  string
+	activateOfflineFile string
+	activatePublicKey   string
 )
 
 var activateCmd = &cobra.Command{
@@ -215,13 +234,16 @@ var activateCmd = &cobra.Command{
 	Long:  `Activate your license on the current machine. Hardware ID will be auto-detected if not provided.`,
 	Example: `  licensify activate
   licensify activate --key LIC-xxx
-  licensify activate --key LIC-xxx --hardware-id hw-123`,
+  licensify activate --key LIC-xxx --hardware-id hw-123
+  licensify activate --offline-file license.lic --public-key <base64>`,
 	RunE: runActivate,
 }
 
 func init() {
 	activateCmd.Flags().StringVarP(&activateKey, "key", "k", "", "License key (uses saved key if omitted)")
 	activateCmd.Flags().StringVar(&activateHardwareID, "hardware-id", "", "Hardware ID (auto-detected if omitted)")
+	activateCmd.Flags().StringVar(&activateOfflineFile, "offline-file", "", "Install a signed offline license file instead of contacting the server")
+	activateCmd.Flags().StringVar(&activatePublicKey, "public-key", "", "Server public key (base64) to verify --offline-file with")
 }
 
 func runActivate(cmd *cobra.Command, args []string) error {
@@ -230,6 +252,10 @@ func runActivate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
+	if activateOfflineFile != "" {
+		return runActivateOffline(config)
+	}
+
 	// Use provided key or fall back to saved key
 	licenseKey := activateKey
 	if licenseKey == "" {
@@ -238,17 +264,20 @@ func runActivate(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("no license key provided and no saved key found. Use --key or run 'licensify verify' first")
 		}
 	}
+	if err := licensekey.VerifyChecksum(licenseKey); err != nil {
+		return err
+	}
 
 	// Get or detect hardware ID
 	hardwareID := activateHardwareID
 	if hardwareID == "" {
 		printInfo("Detecting hardware ID...")
-		hwID, err := getHardwareID()
+		hwID, err := getHardwareID(config.AppSalt)
 		if err != nil {
 			return fmt.Errorf("failed to detect hardware ID: %w\nProvide it manually with --hardware-id", err)
 		}
 		hardwareID = hwID
-		printInfo(fmt.Sprintf("Hardware ID: %s", redactKey(hardwareID)))
+		printInfo(fmt.Sprintf("Hardware ID: %s", redact.Key(hardwareID)))
 	}
 
 	client := newHTTPClient(config.Server)
@@ -261,7 +290,16 @@ func runActivate(cmd *cobra.Command, args []string) error {
 	}
 
 	if !resp.Success {
-		return fmt.Errorf("activation failed: %s", resp.Message)
+		return fmt.Errorf("activation failed: %s", resp.Error)
+	}
+
+	// Make sure the bundle is usable on this machine before saving anything
+	bundle, err := decryptBundle(resp.EncryptedAPIKey, resp.IV, resp.Salt, licenseKey, hardwareID)
+	if err != nil {
+		return fmt.Errorf("activation succeeded but the bundle could not be decrypted: %w", err)
+	}
+	if err := verifyBundleSignature(client, config, resp, licenseKey); err != nil {
+		return fmt.Errorf("activation bundle failed signature verification: %w", err)
 	}
 
 	printSuccess("License activated successfully!")
@@ -269,13 +307,28 @@ func runActivate(cmd *cobra.Command, args []string) error {
 	// Update config
 	config.LicenseKey = licenseKey
 	config.HardwareID = hardwareID
+	config.Tier = resp.Tier
+	config.Products = resp.Products
+	config.ExpiresAt = resp.ExpiresAt
 	config.ActivatedAt = time.Now()
+	config.ProxyKey = bundleProxyKey(resp.Mode, bundle)
+	config.ProxyKeyExpiresAt = resp.ProxyKeyExpires
 	if err := saveConfig(config); err != nil {
 		printError(fmt.Sprintf("Warning: Could not save config: %v", err))
 	}
 
-	fmt.Printf("\nLicense Key: %s\n", redactKey(licenseKey))
-	fmt.Printf("Hardware ID: %s\n", redactKey(hardwareID))
+	fmt.Printf("\nLicense Key: %s\n", redact.Key(licenseKey))
+	fmt.Printf("Hardware ID: %s\n", redact.Key(hardwareID))
+	fmt.Printf("Tier: %s\n", resp.Tier)
+	if len(resp.Products) > 0 {
+		fmt.Printf("Products: %s\n", strings.Join(resp.Products, ", "))
+	}
+	if resp.Mode != "" {
+		fmt.Printf("Mode: %s\n", resp.Mode)
+	}
+	if config.ProxyKey != "" {
+		fmt.Printf("Proxy Key: %s (saved for licensify proxy)\n", redact.Key(config.ProxyKey))
+	}
 	fmt.Println("\nYour license is now active!")
 
 	return nil
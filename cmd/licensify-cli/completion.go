@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Completion command
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate shell completion scripts",
+	Long: `Generate a tab-completion script for licensify.
+
+Bash (needs the bash-completion package):
+  # Current session
+  source <(licensify completion bash)
+  # Every session, Linux
+  licensify completion bash > /etc/bash_completion.d/licensify
+  # Every session, macOS (Homebrew)
+  licensify completion bash > $(brew --prefix)/etc/bash_completion.d/licensify
+
+Zsh:
+  # Enable completion once if it isn't already
+  echo "autoload -U compinit; compinit" >> ~/.zshrc
+  licensify completion zsh > "${fpath[1]}/_licensify"
+
+Fish:
+  licensify completion fish > ~/.config/fish/completions/licensify.fish
+
+PowerShell:
+  licensify completion powershell | Out-String | Invoke-Expression
+  # Add the line above to your profile to load it in every session
+
+Start a new shell for the completions to take effect.`,
+	Example: `  licensify completion bash
+  licensify completion zsh > "${fpath[1]}/_licensify"`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.MaximumNArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	RunE:                  runCompletion,
+}
+
+func runCompletion(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		return cmd.Help()
+	}
+
+	out := cmd.OutOrStdout()
+	switch args[0] {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(out, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(out)
+	case "fish":
+		return rootCmd.GenFishCompletion(out, true)
+	case "powershell":
+		return rootCmd.GenPowerShellCompletionWithDesc(out)
+	}
+	return fmt.Errorf("unsupported shell %q", args[0])
+}
+
+// defaultTiers is offered when the server can't be reached
+var defaultTiers = []string{"free", "pro", "enterprise"}
+
+// tierCompletionTimeout keeps tab completion responsive when the server is
+// slow or offline
+const tierCompletionTimeout = 2 * time.Second
+
+// completeTiers offers the tier names the server lists at /tiers, falling back
+// to defaultTiers
+func completeTiers(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return matchPrefix(serverTiers(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+func serverTiers() []string {
+	config, err := loadConfig()
+	if err != nil {
+		return defaultTiers
+	}
+	client := newHTTPClient(config.Server)
+	client.client.Timeout = tierCompletionTimeout
+	client.retries = 0
+
+	resp, err := client.tiers()
+	if err != nil || len(resp.Tiers) == 0 {
+		return defaultTiers
+	}
+
+	names := make([]string, 0, len(resp.Tiers))
+	for name, tier := range resp.Tiers {
+		if tier.Description != "" {
+			name += "\t" + tier.Description
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// configKeys are the keys `config set` accepts
+var configKeys = []string{"server", "key", "hardware-id", "tier", "proxy-key", "app-salt", "public-key"}
+
+// completeConfigSet completes the key of `config set`, and the value when
+// the key is tier
+func completeConfigSet(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch {
+	case len(args) == 0:
+		return matchPrefix(configKeys, toComplete), cobra.ShellCompDirectiveNoFileComp
+	case len(args) == 1 && args[0] == "tier":
+		return completeTiers(cmd, args, toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+func matchPrefix(candidates []string, prefix string) []string {
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	return matches
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{"bash", []string{"# bash completion V2 for licensify", "complete -o default -F __start_licensify licensify"}},
+		{"zsh", []string{"#compdef licensify", "compdef _licensify licensify"}},
+		{"fish", []string{"# fish completion for licensify", "complete -c licensify"}},
+		{"powershell", []string{"# powershell completion for licensify", "Register-ArgumentCompleter"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			var out bytes.Buffer
+			completionCmd.SetOut(&out)
+			t.Cleanup(func() { completionCmd.SetOut(nil) })
+
+			if err := runCompletion(completionCmd, []string{tt.shell}); err != nil {
+				t.Fatalf("completion %s: %v", tt.shell, err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("%s script is missing %q", tt.shell, want)
+				}
+			}
+		})
+	}
+
+	if err := completionCmd.Args(completionCmd, []string{"tcsh"}); err == nil {
+		t.Fatal("completion accepted an unsupported shell")
+	}
+
+	// Without a shell the usage docs are printed
+	var out bytes.Buffer
+	completionCmd.SetOut(&out)
+	t.Cleanup(func() { completionCmd.SetOut(nil) })
+	if err := runCompletion(completionCmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "source <(licensify completion bash)") {
+		t.Fatalf("completion without a shell printed:\n%s", out.String())
+	}
+}
+
+func TestCompleteTiers(t *testing.T) {
+	useConfigHome(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tiers" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(`{"success":true,"tiers":{"team":{"name":"Team","description":"For small teams"},"starter":{"name":"Starter"}}}`))
+	}))
+	t.Cleanup(srv.Close)
+	t.Setenv("LICENSIFY_SERVER", srv.URL)
+
+	got, directive := completeTiers(initCmd, nil, "t")
+	if strings.Join(got, ",") != "team\tFor small teams" || directive != cobra.ShellCompDirectiveNoFileComp {
+		t.Fatalf("completeTiers(t) = %q, %v", got, directive)
+	}
+
+	// Offline, the static list is offered
+	srv.Close()
+	if got, _ := completeTiers(initCmd, nil, ""); strings.Join(got, ",") != strings.Join(defaultTiers, ",") {
+		t.Fatalf("offline completeTiers = %q, want %q", got, defaultTiers)
+	}
+}
+
+func TestCompleteConfigSet(t *testing.T) {
+	if got, _ := completeConfigSet(configSetCmd, nil, "p"); strings.Join(got, ",") != "proxy-key,public-key" {
+		t.Fatalf("keys starting with p = %q", got)
+	}
+	if got, _ := completeConfigSet(configSetCmd, []string{"server"}, ""); got != nil {
+		t.Fatalf("server values = %q, want none", got)
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
 )
 
 type Config struct {
@@ -14,9 +16,43 @@ type Config struct {
 	LicenseKey  string    `json:"license_key,omitempty"`
 	HardwareID  string    `json:"hardware_id,omitempty"`
 	Tier        string    `json:"tier,omitempty"`
+	Products    []string  `json:"products,omitempty"`
 	ActivatedAt time.Time `json:"activated_at,omitempty"`
 	ExpiresAt   time.Time `json:"expires_at,omitempty"`
 	LastCheck   time.Time `json:"last_check,omitempty"`
+	// Bundle signing key fetched from PublicKeyServer on first activation
+	PublicKey       string `json:"public_key,omitempty"`
+	PublicKeyServer string `json:"public_key_server,omitempty"`
+	// Signed license installed with `activate --offline-file`
+	OfflineLicense *licensecrypto.OfflineLicenseFile `json:"offline_license,omitempty"`
+	// Last signed revocation list synced from the server, checked against
+	// OfflineLicense when the server can't be reached
+	Revocations *SyncedRevocations `json:"revocations,omitempty"`
+	// Key for the server's /proxy endpoint, saved when activation returns a
+	// proxy-mode bundle
+	ProxyKey string `json:"proxy_key,omitempty"`
+	// When ProxyKey expires, if the server sets PROXY_KEY_TTL
+	ProxyKeyExpiresAt *time.Time `json:"proxy_key_expires_at,omitempty"`
+	// Mixed into the hardware ID so each app on a machine gets its own;
+	// changing it re-binds the machine
+	AppSalt string `json:"app_salt,omitempty"`
+	// Last response from the server's /check, shown by `check` when offline
+	CachedCheck *CachedCheck `json:"cached_check,omitempty"`
+}
+
+// CachedCheck is a /check response and when it was fetched
+type CachedCheck struct {
+	LicenseKey string        `json:"license_key"`
+	FetchedAt  time.Time     `json:"fetched_at"`
+	Response   CheckResponse `json:"response"`
+}
+
+// SyncedRevocations is the signed /revocations list as the server sent it, so
+// it can be verified again each time it is used
+type SyncedRevocations struct {
+	Revocations json.RawMessage `json:"revocations"`
+	Signature   string          `json:"signature"`
+	SyncedAt    time.Time       `json:"synced_at"`
 }
 
 func getConfigPath() (string, error) {
@@ -37,20 +73,18 @@ func loadConfig() (*Config, error) {
 		return nil, err
 	}
 
-	data, err := os.ReadFile(configPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Return default config if file doesn't exist
-			return &Config{
-				Server: getEnv("LICENSIFY_SERVER", "http://localhost:8080"),
-			}, nil
-		}
-		return nil, err
-	}
-
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	data, err := os.ReadFile(configPath)
+	switch {
+	case os.IsNotExist(err):
+		// Start from the defaults if the file doesn't exist yet
+		config.Server = "http://localhost:8080"
+	case err != nil:
 		return nil, err
+	default:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, err
+		}
 	}
 
 	// Apply overrides in priority order: flag > env var > config
@@ -63,6 +97,12 @@ func loadConfig() (*Config, error) {
 	if key := os.Getenv("LICENSIFY_KEY"); key != "" {
 		config.LicenseKey = key
 	}
+	if salt := os.Getenv("LICENSIFY_APP_SALT"); salt != "" {
+		config.AppSalt = salt
+	}
+	if appSalt != "" {
+		config.AppSalt = appSalt
+	}
 
 	return &config, nil
 }
@@ -78,21 +118,12 @@ func saveConfig(config *Config) error {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0600)
-}
-
-func getEnv(key, fallback string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return fallback
-}
-
-func redactKey(key string) string {
-	if len(key) <= 12 {
-		return "***"
+	// WriteFile only applies the mode to new files, so tighten an existing
+	// one before writing keys into it
+	if err := os.Chmod(configPath, 0600); err != nil && !os.IsNotExist(err) {
+		return err
 	}
-	return key[:4] + "..." + key[len(key)-4:]
+	return os.WriteFile(configPath, data, 0600)
 }
 
 func printSuccess(message string) {
@@ -2,9 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/melihbirim/licensify/internal/redact"
 	"github.com/spf13/cobra"
 )
 
@@ -28,11 +33,21 @@ var configShowCmd = &cobra.Command{
 var configSetCmd = &cobra.Command{
 	Use:   "set <key> <value>",
 	Short: "Set configuration value",
-	Long:  `Set a configuration value. Supported keys: server, key`,
+	Long: `Set a configuration value. Supported keys: server, key, hardware-id, tier, proxy-key, app-salt, public-key.
+
+Changing app-salt changes this machine's hardware ID, so the next activation
+takes a new device seat.
+
+public-key pins the server's bundle signing key, e.g. after the server rotates
+it. Check the new key with the server operator before pinning it.`,
 	Example: `  licensify config set server http://localhost:8080
-  licensify config set key LIC-xxx-yyy-zzz`,
-	Args: cobra.ExactArgs(2),
-	RunE: runConfigSet,
+  licensify config set key LIC-xxx-yyy-zzz
+  licensify config set proxy-key px_xxx
+  licensify config set app-salt com.example.myapp
+  licensify config set public-key <base64 key>`,
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeConfigSet,
+	RunE:              runConfigSet,
 }
 
 var configResetCmd = &cobra.Command{
@@ -69,13 +84,13 @@ func runConfigShow(cmd *cobra.Command, args []string) error {
 	fmt.Printf("Server:       %s\n", config.Server)
 
 	if config.LicenseKey != "" {
-		fmt.Printf("License Key:  %s\n", redactKey(config.LicenseKey))
+		fmt.Printf("License Key:  %s\n", redact.Key(config.LicenseKey))
 	} else {
 		fmt.Println("License Key:  (not set)")
 	}
 
 	if config.HardwareID != "" {
-		fmt.Printf("Hardware ID:  %s\n", redactKey(config.HardwareID))
+		fmt.Printf("Hardware ID:  %s\n", redact.Key(config.HardwareID))
 	} else {
 		fmt.Println("Hardware ID:  (not set)")
 	}
@@ -84,6 +99,14 @@ func runConfigShow(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Tier:         %s\n", config.Tier)
 	}
 
+	if config.ProxyKey != "" {
+		fmt.Printf("Proxy Key:    %s\n", redact.Key(config.ProxyKey))
+	}
+
+	if config.AppSalt != "" {
+		fmt.Printf("App Salt:     %s\n", config.AppSalt)
+	}
+
 	configPath, _ := getConfigPath()
 	fmt.Printf("\nConfig file:  %s\n", configPath)
 
@@ -104,16 +127,43 @@ func runConfigSet(cmd *cobra.Command, args []string) error {
 		config.Server = value
 		printSuccess(fmt.Sprintf("Server URL set to: %s", value))
 	case "key", "license-key", "license_key":
+		err := licensekey.Validate(value)
+		if errors.Is(err, licensekey.ErrMalformed) {
+			// Keys imported from another licensing system have their own format
+			printInfo("This key doesn't look like LIC-YYYYMM-XXXXXX-XXXXXX; check it if activation fails")
+		} else if err != nil {
+			return err
+		}
 		config.LicenseKey = value
-		printSuccess(fmt.Sprintf("License key set to: %s", redactKey(value)))
+		printSuccess(fmt.Sprintf("License key set to: %s", redact.Key(value)))
 	case "hardware-id", "hardware_id":
 		config.HardwareID = value
-		printSuccess(fmt.Sprintf("Hardware ID set to: %s", redactKey(value)))
+		printSuccess(fmt.Sprintf("Hardware ID set to: %s", redact.Key(value)))
 	case "tier":
 		config.Tier = value
 		printSuccess(fmt.Sprintf("Tier set to: %s", value))
+	case "proxy-key", "proxy_key":
+		if !strings.HasPrefix(value, "px_") {
+			return fmt.Errorf("proxy keys start with px_")
+		}
+		config.ProxyKey = value
+		config.ProxyKeyExpiresAt = nil
+		printSuccess(fmt.Sprintf("Proxy key set to: %s", redact.Key(value)))
+	case "app-salt", "app_salt":
+		if config.AppSalt != value && config.HardwareID != "" {
+			printInfo("Changing the app salt changes this machine's hardware ID; activate again to bind it")
+		}
+		config.AppSalt = value
+		printSuccess(fmt.Sprintf("App salt set to: %s", value))
+	case "public-key", "public_key":
+		if _, err := licensecrypto.ParsePublicKey(value); err != nil {
+			return fmt.Errorf("invalid public key: %w", err)
+		}
+		config.PublicKey = value
+		config.PublicKeyServer = config.Server
+		printSuccess(fmt.Sprintf("Public key for %s set to: %s", config.Server, value))
 	default:
-		return fmt.Errorf("unknown config key: %s (supported: server, key, hardware-id, tier)", key)
+		return fmt.Errorf("unknown config key: %s (supported: server, key, hardware-id, tier, proxy-key, app-salt, public-key)", key)
 	}
 
 	if err := saveConfig(config); err != nil {
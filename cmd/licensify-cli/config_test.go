@@ -0,0 +1,187 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useConfigHome points the config file at an empty home directory and
+// clears the environment overrides
+func useConfigHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	for _, env := range []string{"LICENSIFY_SERVER", "LICENSIFY_KEY", "LICENSIFY_APP_SALT"} {
+		t.Setenv(env, "")
+	}
+	return home
+}
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- string(data)
+	}()
+	fnErr := fn()
+	_ = w.Close()
+	return <-out, fnErr
+}
+
+// mustCapture is captureStdout for fn that must succeed
+func mustCapture(t *testing.T, fn func() error) string {
+	t.Helper()
+	out, err := captureStdout(t, fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func TestConfigRoundTrip(t *testing.T) {
+	home := useConfigHome(t)
+	expires := time.Date(2027, 1, 2, 3, 4, 5, 0, time.UTC)
+	saved := &Config{
+		Server:            "https://licensify.example.com",
+		LicenseKey:        "LIC-202601-ABCDEF-123456",
+		HardwareID:        "0123456789abcdef0123456789abcdef",
+		Tier:              "pro",
+		ProxyKey:          "px_0123456789abcdef0123456789abcdef",
+		ProxyKeyExpiresAt: &expires,
+		AppSalt:           "acme-editor",
+	}
+	if err := saveConfig(saved); err != nil {
+		t.Fatalf("saveConfig: %v", err)
+	}
+
+	path := filepath.Join(home, ".licensify", "config.json")
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Fatalf("config mode = %o, want 600", info.Mode().Perm())
+	}
+
+	loaded, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if loaded.Server != saved.Server || loaded.LicenseKey != saved.LicenseKey || loaded.HardwareID != saved.HardwareID ||
+		loaded.ProxyKey != saved.ProxyKey || loaded.AppSalt != saved.AppSalt ||
+		loaded.ProxyKeyExpiresAt == nil || !loaded.ProxyKeyExpiresAt.Equal(expires) {
+		t.Fatalf("loaded %+v, want %+v", loaded, saved)
+	}
+
+	// A file left readable by others is tightened on the next save
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveConfig(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Fatalf("config mode after save = %o, want 600", info.Mode().Perm())
+	}
+
+	// Environment variables override the file
+	t.Setenv("LICENSIFY_SERVER", "http://localhost:9999")
+	if loaded, err := loadConfig(); err != nil || loaded.Server != "http://localhost:9999" {
+		t.Fatalf("server with LICENSIFY_SERVER = %v, %v", loaded, err)
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	useConfigHome(t)
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if config.Server != "http://localhost:8080" || config.LicenseKey != "" || config.ProxyKey != "" {
+		t.Fatalf("default config = %+v", config)
+	}
+}
+
+func TestConfigRedactsSecrets(t *testing.T) {
+	useConfigHome(t)
+	config := &Config{
+		Server:     "https://licensify.example.com",
+		LicenseKey: "LIC-202601-ABCDEF-123456",
+		HardwareID: "0123456789abcdef0123456789abcdef",
+		ProxyKey:   "px_0123456789abcdef0123456789abcdef",
+	}
+	if err := saveConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	secrets := []string{config.LicenseKey, config.HardwareID, config.ProxyKey}
+
+	tests := []struct {
+		name string
+		run  func() error
+	}{
+		{"config show", func() error { return runConfigShow(configShowCmd, nil) }},
+		{"proxy-key show", func() error { return runProxyKeyShow(proxyKeyShowCmd, nil) }},
+		{"config set proxy-key", func() error {
+			return runConfigSet(configSetCmd, []string{"proxy-key", config.ProxyKey})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := captureStdout(t, tt.run)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range secrets {
+				if strings.Contains(out, secret) {
+					t.Errorf("output shows %s in full:\n%s", secret, out)
+				}
+			}
+		})
+	}
+
+	if !strings.Contains(mustCapture(t, func() error { return runConfigShow(configShowCmd, nil) }), "Proxy Key:") {
+		t.Fatal("config show doesn't mention the proxy key")
+	}
+
+	// --reveal is the one way to print the key, for scripts
+	proxyKeyReveal = true
+	t.Cleanup(func() { proxyKeyReveal = false })
+	if out := mustCapture(t, func() error { return runProxyKeyShow(proxyKeyShowCmd, nil) }); out != config.ProxyKey+"\n" {
+		t.Fatalf("proxy-key show --reveal = %q, want the key alone", out)
+	}
+}
+
+func TestConfigSetProxyKey(t *testing.T) {
+	useConfigHome(t)
+	expires := time.Now().Add(time.Hour)
+	if err := saveConfig(&Config{ProxyKey: "px_old", ProxyKeyExpiresAt: &expires}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := captureStdout(t, func() error { return runConfigSet(configSetCmd, []string{"proxy-key", "sk-not-a-proxy-key"}) }); err == nil {
+		t.Fatal("config set accepted a key without the px_ prefix")
+	}
+	mustCapture(t, func() error { return runConfigSet(configSetCmd, []string{"proxy-key", "px_new"}) })
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The old key's expiry doesn't carry over to the new one
+	if config.ProxyKey != "px_new" || config.ProxyKeyExpiresAt != nil {
+		t.Fatalf("proxy key = %s expiring %v, want px_new without an expiry", config.ProxyKey, config.ProxyKeyExpiresAt)
+	}
+}
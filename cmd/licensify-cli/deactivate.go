@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+var (
+	deactivateKey        string
+	deactivateHardwareID string
+)
+
+var deactivateCmd = &cobra.Command{
+	Use:   "deactivate",
+	Short: "Release this machine's activation seat",
+	Long: `Deactivate your license on the current machine so the seat can be used on another device.
+Hardware ID will be auto-detected if not provided.`,
+	Example: `  licensify deactivate
+  licensify deactivate --key LIC-xxx --hardware-id hw-123`,
+	RunE: runDeactivate,
+}
+
+func init() {
+	deactivateCmd.Flags().StringVarP(&deactivateKey, "key", "k", "", "License key (uses saved key if omitted)")
+	deactivateCmd.Flags().StringVar(&deactivateHardwareID, "hardware-id", "", "Hardware ID (auto-detected if omitted)")
+}
+
+func runDeactivate(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use provided key or fall back to saved key
+	licenseKey := deactivateKey
+	if licenseKey == "" {
+		licenseKey = config.LicenseKey
+		if licenseKey == "" {
+			return fmt.Errorf("no license key provided and no saved key found. Use --key")
+		}
+	}
+	if err := licensekey.VerifyChecksum(licenseKey); err != nil {
+		return err
+	}
+
+	// Get or detect hardware ID
+	hardwareID := deactivateHardwareID
+	if hardwareID == "" {
+		printInfo("Detecting hardware ID...")
+		hwID, err := getHardwareID(config.AppSalt)
+		if err != nil {
+			return fmt.Errorf("failed to detect hardware ID: %w\nProvide it manually with --hardware-id", err)
+		}
+		hardwareID = hwID
+		printInfo(fmt.Sprintf("Hardware ID: %s", redact.Key(hardwareID)))
+	}
+
+	client := newHTTPClient(config.Server)
+
+	printInfo("Deactivating license on this machine...")
+
+	resp, err := client.deactivateLicense(licenseKey, hardwareID)
+	if err != nil {
+		return fmt.Errorf("deactivation failed: %w", err)
+	}
+
+	printSuccess("Device deactivated!")
+
+	// Forget the activation if it was this machine's saved one
+	if licenseKey == config.LicenseKey && hardwareID == config.HardwareID {
+		config.ActivatedAt = time.Time{}
+		config.ProxyKey = ""
+		config.ProxyKeyExpiresAt = nil
+		if err := saveConfig(config); err != nil {
+			printError(fmt.Sprintf("Warning: Could not save config: %v", err))
+		}
+	}
+
+	fmt.Printf("\nLicense Key: %s\n", redact.Key(licenseKey))
+	fmt.Printf("Activations: %d / %s\n", resp.Activations, formatSeatLimit(resp.MaxActivations))
+
+	return nil
+}
+
+func formatSeatLimit(limit int) string {
+	if limit < 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d", limit)
+}
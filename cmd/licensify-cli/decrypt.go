@@ -0,0 +1,231 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+// Decrypt command
+var (
+	decryptTest       bool
+	decryptKey        string
+	decryptHardwareID string
+	decryptData       string
+	decryptIV         string
+	decryptSalt       string
+)
+
+var decryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt an activation bundle",
+	Long: `Decrypt an encrypted API key bundle the same way a client integration would.
+
+With --test, requests a sentinel bundle from the server's /activate/test endpoint
+(enabled with ENABLE_ACTIVATION_TEST=true) and checks that it decrypts to the
+expected sentinel. No real API key is involved.`,
+	Example: `  licensify decrypt --test
+  licensify decrypt --data <base64> --iv <base64> --salt <hex>`,
+	RunE: runDecrypt,
+}
+
+func init() {
+	decryptCmd.Flags().BoolVar(&decryptTest, "test", false, "Verify decryption against the server's test bundle")
+	decryptCmd.Flags().StringVarP(&decryptKey, "key", "k", "", "License key (uses saved key if omitted)")
+	decryptCmd.Flags().StringVar(&decryptHardwareID, "hardware-id", "", "Hardware ID (uses saved or detected ID if omitted)")
+	decryptCmd.Flags().StringVar(&decryptData, "data", "", "Encrypted bundle (base64)")
+	decryptCmd.Flags().StringVar(&decryptIV, "iv", "", "Nonce (base64)")
+	decryptCmd.Flags().StringVar(&decryptSalt, "salt", "", "License encryption salt (hex)")
+}
+
+// DecryptedBundle is the plaintext of an activation bundle
+type DecryptedBundle struct {
+	APIKey       string    `json:"api_key"`
+	CustomerName string    `json:"customer_name"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Tier         string    `json:"tier"`
+	Limits       struct {
+		DailyLimit     int `json:"daily_limit"`
+		MonthlyLimit   int `json:"monthly_limit"`
+		MaxActivations int `json:"max_activations"`
+	} `json:"limits"`
+}
+
+func runDecrypt(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	licenseKey := decryptKey
+	if licenseKey == "" {
+		licenseKey = config.LicenseKey
+		if licenseKey == "" {
+			return fmt.Errorf("no license key provided and no saved key found. Use --key")
+		}
+	}
+	if err := licensekey.VerifyChecksum(licenseKey); err != nil {
+		return err
+	}
+
+	hardwareID := decryptHardwareID
+	if hardwareID == "" {
+		hardwareID = config.HardwareID
+	}
+	if hardwareID == "" {
+		hwID, err := getHardwareID(config.AppSalt)
+		if err != nil {
+			return fmt.Errorf("failed to detect hardware ID: %w\nProvide it manually with --hardware-id", err)
+		}
+		hardwareID = hwID
+	}
+
+	if decryptTest {
+		return runDecryptTest(config, licenseKey, hardwareID)
+	}
+
+	if decryptData == "" || decryptIV == "" || decryptSalt == "" {
+		return fmt.Errorf("--data, --iv and --salt are required (or use --test)")
+	}
+
+	bundle, err := decryptBundle(decryptData, decryptIV, decryptSalt, licenseKey, hardwareID)
+	if err != nil {
+		return err
+	}
+
+	printSuccess("Bundle decrypted successfully!")
+	fmt.Printf("\nAPI Key:       %s\n", redact.Key(bundle.APIKey))
+	fmt.Printf("Customer:      %s\n", bundle.CustomerName)
+	fmt.Printf("Tier:          %s\n", bundle.Tier)
+	fmt.Printf("Expires:       %s\n", bundle.ExpiresAt.Format("2006-01-02"))
+
+	return nil
+}
+
+func runDecryptTest(config *Config, licenseKey, hardwareID string) error {
+	client := newHTTPClient(config.Server)
+
+	printInfo("Requesting test bundle...")
+
+	resp, err := client.activationTest(licenseKey, hardwareID)
+	if err != nil {
+		return fmt.Errorf("test bundle request failed: %w", err)
+	}
+
+	printInfo(fmt.Sprintf("Deriving key (%s)...", resp.KDF))
+
+	bundle, err := decryptBundle(resp.EncryptedAPIKey, resp.IV, resp.Salt, licenseKey, hardwareID)
+	if err != nil {
+		return err
+	}
+
+	if bundle.APIKey != resp.Sentinel {
+		return fmt.Errorf("decrypted bundle does not contain the expected sentinel")
+	}
+
+	printSuccess("Decryption handshake verified: key derivation and bundle parsing work")
+	return nil
+}
+
+// decryptBundle derives the bundle key with Argon2id and opens it with AES-256-GCM.
+// Parameters must match the server's deriveKey.
+func decryptBundle(dataB64, ivB64, salt, licenseKey, hardwareID string) (*DecryptedBundle, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(dataB64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle encoding: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(ivB64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid iv encoding: %w", err)
+	}
+
+	key, err := licensecrypto.DeriveKey(licenseKey, hardwareID, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid iv length %d", len(nonce))
+	}
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed (wrong license key, hardware ID or salt): %w", err)
+	}
+
+	var bundle DecryptedBundle
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		return nil, fmt.Errorf("decrypted bundle is not valid JSON: %w", err)
+	}
+
+	return &bundle, nil
+}
+
+// verifyBundleSignature checks that an activation bundle was signed by the
+// server. The server's public key is fetched once and pinned in the config
+// (saved by the caller). An unsigned bundle is rejected: anyone able to
+// answer in the server's place could otherwise drop the signature.
+func verifyBundleSignature(client *HTTPClient, config *Config, resp *ActivateResponse, licenseKey string) error {
+	if resp.BundleSignature == "" {
+		return fmt.Errorf("activation bundle is not signed: %w", licensecrypto.ErrInvalidSignature)
+	}
+
+	publicKey, err := serverPublicKey(client, config)
+	if err != nil {
+		return err
+	}
+	err = licensecrypto.VerifyLicenseSignature(publicKey, resp.EncryptedAPIKey, resp.IV, resp.Salt, licenseKey, resp.BundleSignature)
+	if errors.Is(err, licensecrypto.ErrInvalidSignature) && pinnedKeyRetired(client, config) {
+		return fmt.Errorf("the server has rotated its signing key and the pinned key is retired; " +
+			"verify the new key with the server operator, then run 'licensify config set public-key <key>'")
+	}
+	return err
+}
+
+// pinnedKeyRetired reports whether the server lists the pinned public key as
+// retired, which explains a signature failure after a key rotation
+func pinnedKeyRetired(client *HTTPClient, config *Config) bool {
+	pk, err := client.publicKey()
+	if err != nil {
+		return false
+	}
+	for _, key := range pk.RetiredKeys {
+		if key == config.PublicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// serverPublicKey returns the server's signing key, fetching it from /pubkey
+// and pinning it in the config (saved by the caller) the first time
+func serverPublicKey(client *HTTPClient, config *Config) (ed25519.PublicKey, error) {
+	if config.PublicKey == "" || config.PublicKeyServer != config.Server {
+		pk, err := client.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch server public key: %w", err)
+		}
+		config.PublicKey = pk.PublicKey
+		config.PublicKeyServer = config.Server
+	}
+
+	return licensecrypto.ParsePublicKey(config.PublicKey)
+}
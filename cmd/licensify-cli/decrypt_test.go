@@ -0,0 +1,71 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+)
+
+// pubkeyServer serves publicKey at /pubkey
+func pubkeyServer(t *testing.T, publicKey ed25519.PublicKey) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(PubKeyResponse{Algorithm: "ed25519", PublicKey: base64.StdEncoding.EncodeToString(publicKey)})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestVerifyBundleSignature(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := pubkeyServer(t, publicKey)
+
+	const licenseKey = "LIC-202601-ABC123-XYZ789"
+	signed := ActivateResponse{EncryptedAPIKey: "Y2lwaGVy", IV: "aXY=", Salt: "00ff"}
+	signed.BundleSignature = licensecrypto.SignBundle(privateKey, signed.EncryptedAPIKey, signed.IV, signed.Salt, licenseKey)
+	unsigned := signed
+	unsigned.BundleSignature = ""
+	tampered := signed
+	tampered.EncryptedAPIKey = "Y2lwaGVz"
+
+	tests := []struct {
+		name    string
+		pinned  bool
+		resp    ActivateResponse
+		wantErr bool
+	}{
+		{"signed", false, signed, false},
+		{"signed with a pinned key", true, signed, false},
+		{"unsigned", false, unsigned, true},
+		{"unsigned with a pinned key", true, unsigned, true},
+		{"tampered", true, tampered, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Server: srv.URL}
+			if tt.pinned {
+				config.PublicKey = base64.StdEncoding.EncodeToString(publicKey)
+				config.PublicKeyServer = srv.URL
+			}
+			err := verifyBundleSignature(testClient(srv.URL), config, &tt.resp, licenseKey)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("valid bundle rejected: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, licensecrypto.ErrInvalidSignature) {
+				t.Fatalf("error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
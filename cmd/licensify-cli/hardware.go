@@ -3,114 +3,203 @@ package main
 import (
 	"crypto/sha256"
 	"fmt"
+	"net"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"strings"
 )
 
-// getHardwareID returns a unique hardware identifier for the current machine
-func getHardwareID() (string, error) {
-	var id string
-	var err error
+// hardwareSource is one machine identifier mixed into the hardware ID. The
+// name is part of the hashed input, so renaming a source changes every ID.
+type hardwareSource interface {
+	Name() string
+	Read() (string, error)
+}
+
+// commandSource is a hardwareSource read by a function on this machine
+type commandSource struct {
+	name string
+	read func() (string, error)
+}
+
+func (s commandSource) Name() string          { return s.name }
+func (s commandSource) Read() (string, error) { return s.read() }
+
+// hardwareSourceResult records what one source contributed to an ID
+type hardwareSourceResult struct {
+	Name  string
+	Value string
+	Err   error // why the source was skipped
+}
+
+// getHardwareID returns a unique hardware identifier for the current machine.
+// A non-empty salt gives each application its own ID on the same machine.
+func getHardwareID(salt string) (string, error) {
+	id, _, err := detectHardwareID(salt)
+	return id, err
+}
 
+// detectHardwareID hashes every identifier this platform offers and reports
+// which ones were used
+func detectHardwareID(salt string) (string, []hardwareSourceResult, error) {
+	sources, err := hardwareSources()
+	if err != nil {
+		return "", nil, err
+	}
+	return combineHardwareSources(sources, salt)
+}
+
+// hardwareSources lists the identifiers for this platform in the order they
+// are hashed. Several are combined so a cloned disk image (same machine-id)
+// still gets a distinct ID on each machine.
+func hardwareSources() ([]hardwareSource, error) {
 	switch runtime.GOOS {
 	case "darwin":
-		id, err = getMacOSHardwareID()
+		return []hardwareSource{
+			commandSource{"serial", getMacOSSerial},
+			commandSource{"platform-uuid", getMacOSPlatformUUID},
+			commandSource{"mac", getPrimaryMAC},
+		}, nil
 	case "linux":
-		id, err = getLinuxHardwareID()
+		// The DMI serial and product UUID are only readable by root, so
+		// mixing them in would give root and other users different IDs
+		return []hardwareSource{
+			commandSource{"machine-id", getLinuxMachineID},
+			commandSource{"mac", getPrimaryMAC},
+		}, nil
 	case "windows":
-		id, err = getWindowsHardwareID()
+		return []hardwareSource{
+			commandSource{"system-uuid", getWindowsSystemUUID},
+			commandSource{"machine-guid", getWindowsMachineGUID},
+			commandSource{"mac", getPrimaryMAC},
+		}, nil
 	default:
-		return "", fmt.Errorf("unsupported platform: %s", runtime.GOOS)
+		return nil, fmt.Errorf("unsupported platform: %s", runtime.GOOS)
 	}
+}
 
-	if err != nil {
-		return "", err
+// combineHardwareSources reads each source and hashes the ones that answered,
+// plus the salt if any, into a 64-character hex string (SHA256). Sources that
+// fail are skipped, so detection only fails when none are available.
+func combineHardwareSources(sources []hardwareSource, salt string) (string, []hardwareSourceResult, error) {
+	results := make([]hardwareSourceResult, 0, len(sources))
+	var input strings.Builder
+	used := 0
+	for _, source := range sources {
+		value, err := source.Read()
+		value = strings.TrimSpace(value)
+		if err == nil && value == "" {
+			err = fmt.Errorf("empty value")
+		}
+		results = append(results, hardwareSourceResult{Name: source.Name(), Value: value, Err: err})
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&input, "%s=%s\n", source.Name(), value)
+		used++
+	}
+
+	if used == 0 {
+		return "", results, fmt.Errorf("could not determine hardware ID: no hardware sources available")
+	}
+	// Unsalted IDs stay as they were before salts existed
+	if salt != "" {
+		fmt.Fprintf(&input, "app-salt=%s\n", salt)
 	}
 
-	// Hash the ID to get consistent 64-character hex string (SHA256)
-	hash := sha256.Sum256([]byte(id))
-	return fmt.Sprintf("%x", hash), nil
+	hash := sha256.Sum256([]byte(input.String()))
+	return fmt.Sprintf("%x", hash), results, nil
 }
 
-func getMacOSHardwareID() (string, error) {
-	// Try to get system serial number
-	cmd := exec.Command("ioreg", "-l")
-	output, err := cmd.Output()
+// getPrimaryMAC returns the MAC address of the first physical network
+// interface by name. Loopback, virtual and locally administered addresses
+// (bridges, containers, randomized Wi-Fi MACs) are skipped. Down interfaces
+// count, so unplugging a cable doesn't change the ID.
+func getPrimaryMAC() (string, error) {
+	ifaces, err := net.Interfaces()
 	if err != nil {
-		return "", fmt.Errorf("failed to get system info: %w", err)
+		return "", fmt.Errorf("failed to list network interfaces: %w", err)
 	}
+	sort.Slice(ifaces, func(i, j int) bool { return ifaces[i].Name < ifaces[j].Name })
 
-	// Look for IOPlatformSerialNumber
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		if strings.Contains(line, "IOPlatformSerialNumber") {
-			parts := strings.Split(line, "=")
-			if len(parts) == 2 {
-				serial := strings.TrimSpace(strings.Trim(parts[1], `"`))
-				if serial != "" {
-					return serial, nil
-				}
-			}
+	for _, iface := range ifaces {
+		mac := iface.HardwareAddr
+		if iface.Flags&net.FlagLoopback != 0 || len(mac) != 6 {
+			continue
+		}
+		if mac[0]&0x02 != 0 {
+			continue
+		}
+		if !isPhysicalInterface(iface.Name) {
+			continue
 		}
+		return mac.String(), nil
 	}
 
-	// Fallback to system UUID
-	cmd = exec.Command("system_profiler", "SPHardwareDataType")
-	output, err = cmd.Output()
+	return "", fmt.Errorf("no physical network interface found")
+}
+
+// isPhysicalInterface reports whether a network interface is backed by a
+// device. Only Linux exposes this; elsewhere every interface counts.
+func isPhysicalInterface(name string) bool {
+	if runtime.GOOS != "linux" {
+		return true
+	}
+	_, err := os.Stat("/sys/class/net/" + name + "/device")
+	return err == nil
+}
+
+func getMacOSSerial() (string, error) {
+	return ioregPlatformValue("IOPlatformSerialNumber")
+}
+
+func getMacOSPlatformUUID() (string, error) {
+	return ioregPlatformValue("IOPlatformUUID")
+}
+
+// ioregPlatformValue reads a string property of IOPlatformExpertDevice
+func ioregPlatformValue(key string) (string, error) {
+	cmd := exec.Command("ioreg", "-rd1", "-c", "IOPlatformExpertDevice")
+	output, err := cmd.Output()
 	if err != nil {
-		return "", fmt.Errorf("failed to get hardware UUID: %w", err)
+		return "", fmt.Errorf("failed to get system info: %w", err)
 	}
 
-	lines = strings.Split(string(output), "\n")
+	// Lines look like: "IOPlatformSerialNumber" = "C02XXXXXXXXX"
+	lines := strings.Split(string(output), "\n")
 	for _, line := range lines {
-		if strings.Contains(line, "Hardware UUID") {
-			parts := strings.Split(line, ":")
+		if strings.Contains(line, `"`+key+`"`) {
+			parts := strings.Split(line, "=")
 			if len(parts) == 2 {
-				uuid := strings.TrimSpace(parts[1])
-				if uuid != "" {
-					return uuid, nil
+				value := strings.TrimSpace(strings.Trim(strings.TrimSpace(parts[1]), `"`))
+				if value != "" {
+					return value, nil
 				}
 			}
 		}
 	}
 
-	return "", fmt.Errorf("could not determine hardware ID")
+	return "", fmt.Errorf("%s not found", key)
 }
 
-func getLinuxHardwareID() (string, error) {
-	// Try /etc/machine-id first
-	data, err := os.ReadFile("/etc/machine-id")
-	if err == nil {
-		id := strings.TrimSpace(string(data))
-		if id != "" {
-			return id, nil
-		}
-	}
-
-	// Try /var/lib/dbus/machine-id
-	data, err = os.ReadFile("/var/lib/dbus/machine-id")
-	if err == nil {
-		id := strings.TrimSpace(string(data))
-		if id != "" {
-			return id, nil
-		}
-	}
-
-	// Try DMI product UUID
-	data, err = os.ReadFile("/sys/class/dmi/id/product_uuid")
-	if err == nil {
-		id := strings.TrimSpace(string(data))
-		if id != "" {
-			return id, nil
+func getLinuxMachineID() (string, error) {
+	// /etc/machine-id on systemd systems, the dbus copy on older ones
+	for _, path := range []string{"/etc/machine-id", "/var/lib/dbus/machine-id"} {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			id := strings.TrimSpace(string(data))
+			if id != "" {
+				return id, nil
+			}
 		}
 	}
 
-	return "", fmt.Errorf("could not determine hardware ID")
+	return "", fmt.Errorf("no machine-id found")
 }
 
-func getWindowsHardwareID() (string, error) {
+func getWindowsSystemUUID() (string, error) {
 	// Use WMIC to get UUID
 	cmd := exec.Command("wmic", "csproduct", "get", "UUID")
 	output, err := cmd.Output()
@@ -130,3 +219,21 @@ func getWindowsHardwareID() (string, error) {
 
 	return uuid, nil
 }
+
+func getWindowsMachineGUID() (string, error) {
+	cmd := exec.Command("reg", "query", `HKLM\SOFTWARE\Microsoft\Cryptography`, "/v", "MachineGuid")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read MachineGuid: %w", err)
+	}
+
+	// Output line: MachineGuid    REG_SZ    <guid>
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 3 && fields[0] == "MachineGuid" {
+			return fields[2], nil
+		}
+	}
+
+	return "", fmt.Errorf("MachineGuid not found")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+var hardwareIDShowSources bool
+
+var hardwareIDCmd = &cobra.Command{
+	Use:   "hardware-id",
+	Short: "Print this machine's hardware ID",
+	Long: `Print the full hardware ID of this machine. Send it to your license provider
+to get an offline license file for the machine.`,
+	Example: `  licensify hardware-id
+  licensify hardware-id --hardware-sources`,
+	Args: cobra.NoArgs,
+	RunE: runHardwareID,
+}
+
+func init() {
+	hardwareIDCmd.Flags().BoolVar(&hardwareIDShowSources, "hardware-sources", false, "Also show which machine identifiers the ID was built from")
+}
+
+func runHardwareID(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	hardwareID, sources, err := detectHardwareID(config.AppSalt)
+	if err != nil && !hardwareIDShowSources {
+		return fmt.Errorf("failed to detect hardware ID: %w", err)
+	}
+	if hardwareID != "" {
+		fmt.Println(hardwareID)
+	}
+
+	if hardwareIDShowSources {
+		fmt.Println("\nSources:")
+		for _, source := range sources {
+			if source.Err != nil {
+				fmt.Printf("  ✗ %-13s not used: %v\n", source.Name, source.Err)
+				continue
+			}
+			fmt.Printf("  ✓ %-13s %s\n", source.Name, redact.Key(source.Value))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to detect hardware ID: %w", err)
+		}
+	}
+	return nil
+}
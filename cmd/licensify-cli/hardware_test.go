@@ -0,0 +1,156 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+// fakeSource is a hardwareSource with a fixed answer
+type fakeSource struct {
+	name  string
+	value string
+	err   error
+}
+
+func (s fakeSource) Name() string          { return s.name }
+func (s fakeSource) Read() (string, error) { return s.value, s.err }
+
+var hardwareIDPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func TestCombineHardwareSourcesPartial(t *testing.T) {
+	all := []hardwareSource{
+		fakeSource{name: "machine-id", value: "0f3c2d"},
+		fakeSource{name: "mac", value: "00:1a:2b:3c:4d:5e"},
+	}
+	full, _, err := combineHardwareSources(all, "")
+	if err != nil {
+		t.Fatalf("combine: %v", err)
+	}
+	if !hardwareIDPattern.MatchString(full) {
+		t.Fatalf("hardware ID %q isn't 64 hex characters", full)
+	}
+
+	partial := []hardwareSource{
+		fakeSource{name: "machine-id", value: "0f3c2d"},
+		fakeSource{name: "mac", err: errors.New("no physical network interface found")},
+		fakeSource{name: "serial", value: "  \n"},
+	}
+	id, results, err := combineHardwareSources(partial, "")
+	if err != nil {
+		t.Fatalf("combine with failing sources: %v", err)
+	}
+	if !hardwareIDPattern.MatchString(id) || id == full {
+		t.Fatalf("hardware ID %q should be a different 64-character ID when mac is missing", id)
+	}
+	if len(results) != 3 || results[0].Err != nil || results[1].Err == nil || results[2].Err == nil {
+		t.Fatalf("results = %+v, want machine-id used and mac and serial skipped", results)
+	}
+
+	// A failing source hashes the same as one this platform doesn't have
+	onlyMachineID, _, err := combineHardwareSources(partial[:1], "")
+	if err != nil || onlyMachineID != id {
+		t.Fatalf("machine-id alone = %q, %v, want %q", onlyMachineID, err, id)
+	}
+
+	none := []hardwareSource{fakeSource{name: "machine-id", err: errors.New("no machine-id found")}}
+	if _, _, err := combineHardwareSources(none, ""); err == nil {
+		t.Fatal("no available sources should fail")
+	}
+}
+
+func TestCombineHardwareSourcesDeterministic(t *testing.T) {
+	sources := []hardwareSource{
+		fakeSource{name: "machine-id", value: "0f3c2d"},
+		fakeSource{name: "mac", value: "00:1a:2b:3c:4d:5e"},
+	}
+	first, _, err := combineHardwareSources(sources, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		again, _, err := combineHardwareSources(sources, "")
+		if err != nil || again != first {
+			t.Fatalf("run %d = %q, %v, want %q", i, again, err, first)
+		}
+	}
+
+	// Values are bound to their source names, so a cloned machine-id
+	// with a different MAC is a different machine
+	cloned := []hardwareSource{
+		fakeSource{name: "machine-id", value: "0f3c2d"},
+		fakeSource{name: "mac", value: "00:1a:2b:3c:4d:5f"},
+	}
+	if other, _, _ := combineHardwareSources(cloned, ""); other == first {
+		t.Fatal("different MACs gave the same hardware ID")
+	}
+	swapped := []hardwareSource{
+		fakeSource{name: "machine-id", value: "00:1a:2b:3c:4d:5e"},
+		fakeSource{name: "mac", value: "0f3c2d"},
+	}
+	if other, _, _ := combineHardwareSources(swapped, ""); other == first {
+		t.Fatal("swapping values between sources gave the same hardware ID")
+	}
+}
+
+func TestHardwareIDSalt(t *testing.T) {
+	sources := []hardwareSource{fakeSource{name: "machine-id", value: "0f3c2d"}}
+	id := func(salt string) string {
+		t.Helper()
+		id, _, err := combineHardwareSources(sources, salt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	// Unsalted IDs are unchanged from before salts existed
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("machine-id=0f3c2d\n"))); id("") != want {
+		t.Fatalf("unsalted ID = %s, want %s", id(""), want)
+	}
+
+	seen := map[string]string{id(""): "no salt"}
+	for _, salt := range []string{"acme-editor", "acme-viewer", "Acme-Editor"} {
+		salted := id(salt)
+		if !hardwareIDPattern.MatchString(salted) {
+			t.Fatalf("salt %q: ID %q isn't 64 hex characters", salt, salted)
+		}
+		if other, ok := seen[salted]; ok {
+			t.Fatalf("salt %q gave the same ID as %s", salt, other)
+		}
+		seen[salted] = salt
+		if again := id(salt); again != salted {
+			t.Fatalf("salt %q: ID changed from %s to %s", salt, salted, again)
+		}
+	}
+}
+
+func TestAppSaltPrecedence(t *testing.T) {
+	useConfigHome(t)
+	if err := saveConfig(&Config{AppSalt: "from-config"}); err != nil {
+		t.Fatal(err)
+	}
+	salt := func() string {
+		t.Helper()
+		config, err := loadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config.AppSalt
+	}
+
+	if got := salt(); got != "from-config" {
+		t.Fatalf("salt = %q, want the saved one", got)
+	}
+	t.Setenv("LICENSIFY_APP_SALT", "from-env")
+	if got := salt(); got != "from-env" {
+		t.Fatalf("salt = %q, want LICENSIFY_APP_SALT", got)
+	}
+	appSalt = "from-flag"
+	t.Cleanup(func() { appSalt = "" })
+	if got := salt(); got != "from-flag" {
+		t.Fatalf("salt = %q, want --app-salt", got)
+	}
+}
@@ -3,15 +3,20 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 var (
-	version   = "dev"
-	gitCommit = "none"
-	buildTime = "unknown"
-	serverURL string
+	version      = "dev"
+	gitCommit    = "none"
+	buildTime    = "unknown"
+	serverURL    string
+	appSalt      string
+	retryCount   int
+	retryBackoff time.Duration
 )
 
 var rootCmd = &cobra.Command{
@@ -21,6 +26,9 @@ var rootCmd = &cobra.Command{
 	
 It allows you to request, verify, activate, and check licenses from your terminal.`,
 	Version: version,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return applyRetryEnv(cmd)
+	},
 }
 
 func init() {
@@ -28,14 +36,48 @@ func init() {
 
 	// Global flags
 	rootCmd.PersistentFlags().StringVarP(&serverURL, "server", "s", "", "Server URL (overrides config and LICENSIFY_SERVER)")
+	rootCmd.PersistentFlags().StringVar(&appSalt, "app-salt", "", "Application salt for the hardware ID (overrides config and LICENSIFY_APP_SALT)")
+	rootCmd.PersistentFlags().IntVar(&retryCount, "retries", 2, "Retries after a connection failure or 502/503 (overrides LICENSIFY_RETRIES)")
+	rootCmd.PersistentFlags().DurationVar(&retryBackoff, "retry-backoff", 500*time.Millisecond, "Wait before the first retry, doubled after each (overrides LICENSIFY_RETRY_BACKOFF)")
 
 	// Add all commands
 	rootCmd.AddCommand(initCmd)
 	rootCmd.AddCommand(verifyCmd)
 	rootCmd.AddCommand(activateCmd)
+	rootCmd.AddCommand(deactivateCmd)
+	rootCmd.AddCommand(quickstartCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(usageCmd)
+	rootCmd.AddCommand(decryptCmd)
+	rootCmd.AddCommand(receiptCmd)
+	rootCmd.AddCommand(verifyReceiptCmd)
+	rootCmd.AddCommand(hardwareIDCmd)
 	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(proxyCmd)
+	rootCmd.AddCommand(proxyKeyCmd)
+	rootCmd.AddCommand(revocationsCmd)
+	rootCmd.AddCommand(completionCmd)
+}
+
+// applyRetryEnv takes --retries and --retry-backoff from LICENSIFY_RETRIES and
+// LICENSIFY_RETRY_BACKOFF when the flags aren't given
+func applyRetryEnv(cmd *cobra.Command) error {
+	var err error
+	if env := os.Getenv("LICENSIFY_RETRIES"); env != "" && !cmd.Flags().Changed("retries") {
+		if retryCount, err = strconv.Atoi(env); err != nil {
+			return fmt.Errorf("invalid LICENSIFY_RETRIES: %w", err)
+		}
+	}
+	if env := os.Getenv("LICENSIFY_RETRY_BACKOFF"); env != "" && !cmd.Flags().Changed("retry-backoff") {
+		if retryBackoff, err = time.ParseDuration(env); err != nil {
+			return fmt.Errorf("invalid LICENSIFY_RETRY_BACKOFF: %w", err)
+		}
+	}
+	if retryCount < 0 || retryBackoff < 0 {
+		return fmt.Errorf("--retries and --retry-backoff can't be negative")
+	}
+	return nil
 }
 
 func main() {
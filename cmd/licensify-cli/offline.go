@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+	"github.com/melihbirim/licensify/internal/redact"
+)
+
+// runActivateOffline installs a signed license file issued with
+// `licensify-admin issue-offline`, without contacting the server when a
+// trusted public key is already available
+func runActivateOffline(config *Config) error {
+	data, err := os.ReadFile(activateOfflineFile)
+	if err != nil {
+		return fmt.Errorf("failed to read license file: %w", err)
+	}
+	var file licensecrypto.OfflineLicenseFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid license file: %w", err)
+	}
+
+	// Trust an explicit key, the pinned key or the server's, never the one
+	// embedded in the file, which anyone could replace along with the signature
+	trustedKey := activatePublicKey
+	if trustedKey == "" {
+		trustedKey = config.PublicKey
+	}
+	if trustedKey == "" {
+		printInfo("No pinned public key, fetching it from the server...")
+		if _, err := serverPublicKey(newHTTPClient(config.Server), config); err != nil {
+			return fmt.Errorf("%w\nProvide the key from your license provider with --public-key", err)
+		}
+		trustedKey = config.PublicKey
+	}
+	publicKey, err := licensecrypto.ParsePublicKey(trustedKey)
+	if err != nil {
+		return err
+	}
+	if file.PublicKey != "" && file.PublicKey != trustedKey {
+		return fmt.Errorf("license file was signed with a different key than the trusted server key")
+	}
+
+	hardwareID := activateHardwareID
+	if hardwareID == "" {
+		printInfo("Detecting hardware ID...")
+		if hardwareID, err = getHardwareID(config.AppSalt); err != nil {
+			return fmt.Errorf("failed to detect hardware ID: %w\nProvide it manually with --hardware-id", err)
+		}
+		printInfo(fmt.Sprintf("Hardware ID: %s", redact.Key(hardwareID)))
+	}
+
+	revocations, err := currentRevocations(config, publicKey)
+	if err != nil {
+		return err
+	}
+
+	license, err := licensecrypto.VerifyOfflineLicense(publicKey, &file, hardwareID, time.Now(), revocations)
+	switch {
+	case errors.Is(err, licensecrypto.ErrHardwareMismatch):
+		return fmt.Errorf("this license file was issued for a different machine")
+	case errors.Is(err, licensecrypto.ErrLicenseRevoked):
+		return fmt.Errorf("this license has been revoked")
+	case err != nil:
+		return fmt.Errorf("license file verification failed: %w", err)
+	}
+
+	printSuccess("Offline license verified!")
+
+	config.LicenseKey = license.LicenseID
+	config.HardwareID = hardwareID
+	config.Tier = license.Tier
+	config.Products = license.Products
+	config.ExpiresAt = license.ExpiresAt
+	config.ActivatedAt = time.Now()
+	config.OfflineLicense = &file
+	if activatePublicKey != "" {
+		config.PublicKey = activatePublicKey
+	}
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save license: %w", err)
+	}
+
+	fmt.Printf("\nLicense Key: %s\n", redact.Key(license.LicenseID))
+	fmt.Printf("Hardware ID: %s\n", redact.Key(hardwareID))
+	fmt.Printf("Tier: %s\n", license.Tier)
+	if len(license.Products) > 0 {
+		fmt.Printf("Products: %s\n", strings.Join(license.Products, ", "))
+	}
+	fmt.Printf("Expires: %s\n", license.ExpiresAt.Format("2006-01-02"))
+	fmt.Println("\nYour license is now active on this machine (offline)!")
+
+	return nil
+}
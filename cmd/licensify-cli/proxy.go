@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+// Proxy command
+var (
+	proxyProvider string
+	proxyBody     string
+	proxyPath     string
+	proxyStream   bool
+	proxyKeyFlag  string
+)
+
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+var proxyCmd = &cobra.Command{
+	Use:   "proxy",
+	Short: "Call an AI provider through the license server",
+	Long: `Send a request to OpenAI, Anthropic, Gemini or a custom provider configured on the
+server through its /proxy endpoint and print the provider's response. The request is signed with your proxy key, the
+api_key of a proxy-mode activation bundle, saved by activate.
+
+--body takes the provider's request JSON inline, from a file with @file, or from
+stdin with @- or -. --stream asks the provider to stream its answer and prints
+server-sent events as they arrive.`,
+	Example: `  licensify proxy --provider openai --body @request.json
+  echo '{"model":"gpt-4o-mini","messages":[{"role":"user","content":"Hi"}]}' | licensify proxy --provider openai --body -
+  licensify proxy --provider anthropic --body @request.json --stream
+  licensify proxy --provider openai --path /v1/embeddings --body @embed.json`,
+	RunE: runProxy,
+}
+
+func init() {
+	proxyCmd.Flags().StringVarP(&proxyProvider, "provider", "p", "", "Provider: openai, anthropic, gemini or a custom provider name (required)")
+	proxyCmd.Flags().StringVarP(&proxyBody, "body", "b", "", "Request JSON, @file, or @- / - for stdin (required)")
+	proxyCmd.Flags().StringVar(&proxyPath, "path", "", "Provider API path, e.g. /v1/embeddings (default: the server's chat endpoint)")
+	proxyCmd.Flags().BoolVar(&proxyStream, "stream", false, "Stream the response as server-sent events")
+	proxyCmd.Flags().StringVar(&proxyKeyFlag, "proxy-key", "", "Proxy key (default: LICENSIFY_PROXY_KEY, then the saved key)")
+	_ = proxyCmd.MarkFlagRequired("provider")
+	_ = proxyCmd.RegisterFlagCompletionFunc("provider", cobra.FixedCompletions(
+		[]string{"openai", "anthropic", "gemini"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = proxyCmd.MarkFlagRequired("body")
+}
+
+func runProxy(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Priority: flag > env var > config
+	proxyKey := proxyKeyFlag
+	if proxyKey == "" {
+		proxyKey = os.Getenv("LICENSIFY_PROXY_KEY")
+	}
+	if proxyKey == "" {
+		proxyKey = config.ProxyKey
+	}
+	if proxyKey == "" {
+		return fmt.Errorf("no proxy key provided. Activate a proxy-mode license, or use --proxy-key or LICENSIFY_PROXY_KEY")
+	}
+	if !strings.HasPrefix(proxyKey, "px_") {
+		return fmt.Errorf("proxy keys start with px_; this looks like a different kind of key")
+	}
+
+	// The server decides which providers exist, so only reject names that
+	// can't be part of the URL
+	if !providerNamePattern.MatchString(proxyProvider) {
+		return fmt.Errorf("invalid provider name %q. Use lowercase letters, digits, '-' and '_', e.g. openai", proxyProvider)
+	}
+	if proxyPath != "" && !strings.HasPrefix(proxyPath, "/") {
+		proxyPath = "/" + proxyPath
+	}
+
+	body, err := readProxyBody(proxyBody, cmd.InOrStdin())
+	if err != nil {
+		return err
+	}
+	if proxyStream {
+		if body, err = withStream(body); err != nil {
+			return err
+		}
+	}
+
+	client := newHTTPClient(config.Server)
+	resp, err := client.proxy(proxyKey, proxyProvider, proxyPath, body, proxyStream)
+	if err != nil {
+		return fmt.Errorf("proxy request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// Stdout is unbuffered, so streamed events are printed as they arrive
+	if _, err := io.Copy(cmd.OutOrStdout(), resp.Body); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	return nil
+}
+
+// readProxyBody returns the --body value: inline JSON, @file, or @- / - for
+// stdin
+func readProxyBody(value string, stdin io.Reader) ([]byte, error) {
+	var data []byte
+	var err error
+	switch {
+	case value == "-" || value == "@-":
+		data, err = io.ReadAll(stdin)
+	case strings.HasPrefix(value, "@"):
+		data, err = os.ReadFile(value[1:])
+	default:
+		data = []byte(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("request body is not valid JSON")
+	}
+	return data, nil
+}
+
+// withStream sets "stream": true in a JSON object body, which is how the
+// providers and the server's proxy recognise a streaming request
+func withStream(body []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("--stream needs the request body to be a JSON object")
+	}
+	fields["stream"] = json.RawMessage("true")
+	return json.Marshal(fields)
+}
+
+// bundleProxyKey returns the key to save for licensify proxy: the bundle's
+// api_key when the server runs in proxy mode, otherwise nothing
+func bundleProxyKey(mode string, bundle *DecryptedBundle) string {
+	if mode != "proxy" || bundle == nil || !strings.HasPrefix(bundle.APIKey, "px_") {
+		return ""
+	}
+	return bundle.APIKey
+}
+
+// Proxy key command
+var proxyKeyReveal bool
+
+var proxyKeyCmd = &cobra.Command{
+	Use:   "proxy-key",
+	Short: "Manage the saved proxy key",
+	Long: `Manage the proxy key saved when activating a proxy-mode license.
+Use "licensify config set proxy-key" to replace it.`,
+	Example: `  licensify proxy-key show
+  licensify proxy-key show --reveal
+  licensify proxy-key rotate`,
+}
+
+var proxyKeyShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Show the saved proxy key",
+	Long: `Display the saved proxy key (redacted). --reveal prints the full key on
+its own line, for use in scripts.`,
+	Example: `  licensify proxy-key show
+  export LICENSIFY_PROXY_KEY=$(licensify proxy-key show --reveal)`,
+	RunE: runProxyKeyShow,
+}
+
+var proxyKeyRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Replace the saved proxy key with a new one",
+	Long: `Ask the server for a new proxy key and save it. The old key stops working
+immediately, so rotate when it may have leaked or before it expires. An expired
+key can't be rotated; activate the license again instead.`,
+	Example: `  licensify proxy-key rotate`,
+	Args:    cobra.NoArgs,
+	RunE:    runProxyKeyRotate,
+}
+
+func init() {
+	proxyKeyShowCmd.Flags().BoolVar(&proxyKeyReveal, "reveal", false, "Print the full key")
+	proxyKeyCmd.AddCommand(proxyKeyShowCmd)
+	proxyKeyCmd.AddCommand(proxyKeyRotateCmd)
+}
+
+func runProxyKeyShow(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if config.ProxyKey == "" {
+		return fmt.Errorf("no proxy key saved. Activate a license on a proxy-mode server or run 'licensify config set proxy-key <key>'")
+	}
+
+	if proxyKeyReveal {
+		fmt.Println(config.ProxyKey)
+		return nil
+	}
+	fmt.Printf("Proxy Key:    %s\n", redact.Key(config.ProxyKey))
+	if config.ProxyKeyExpiresAt != nil {
+		fmt.Printf("Expires:      %s\n", config.ProxyKeyExpiresAt.Local().Format(time.RFC1123))
+	}
+	return nil
+}
+
+func runProxyKeyRotate(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if config.ProxyKey == "" {
+		return fmt.Errorf("no proxy key saved. Activate a license on a proxy-mode server first")
+	}
+	// The new key is encrypted for the activated license and device
+	if config.LicenseKey == "" || config.HardwareID == "" {
+		return fmt.Errorf("no activated license saved. Run 'licensify activate' first")
+	}
+
+	client := newHTTPClient(config.Server)
+	resp, err := client.rotateProxyKey(config.ProxyKey)
+	if err != nil {
+		return fmt.Errorf("rotation failed: %w", err)
+	}
+	if !resp.Success {
+		return fmt.Errorf("rotation failed: %s", resp.Error)
+	}
+
+	// The old key is already gone on the server, so a bundle that can't be
+	// read leaves this machine without a working key until it re-activates
+	bundle, err := decryptBundle(resp.EncryptedAPIKey, resp.IV, resp.Salt, config.LicenseKey, config.HardwareID)
+	if err != nil {
+		return fmt.Errorf("the key was rotated but the bundle could not be decrypted, run 'licensify activate' to get a new one: %w", err)
+	}
+	if err := verifyBundleSignature(client, config, resp, config.LicenseKey); err != nil {
+		return fmt.Errorf("the rotated key failed signature verification, run 'licensify activate' to get a new one: %w", err)
+	}
+
+	config.ProxyKey = bundleProxyKey(resp.Mode, bundle)
+	config.ProxyKeyExpiresAt = resp.ProxyKeyExpires
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save the new proxy key: %w", err)
+	}
+
+	printSuccess("Proxy key rotated")
+	fmt.Printf("Proxy Key:    %s\n", redact.Key(config.ProxyKey))
+	if config.ProxyKeyExpiresAt != nil {
+		fmt.Printf("Expires:      %s\n", config.ProxyKeyExpiresAt.Local().Format(time.RFC1123))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Shared with TestProxySignatureMessageMatchesCLI in the server's
+// replay_test.go, so a change to either side's message format fails both
+const (
+	oracleProxyKey  = "px_0racle0racle0racle0racle0racle0racle0racle0"
+	oraclePath      = "/proxy/openai/v1/chat/completions"
+	oracleNonce     = "0123456789abcdef0123456789abcdef"
+	oracleBody      = `{"messages":[{"content":"<a & b>"}]}`
+	oracleTimestamp = 1767225600
+	oracleSignature = "5af56a148c5bd96b5f07c92844c929d3ba6ca4af2c77ea7d1520df589b540f22"
+)
+
+func TestSignProxyRequestMatchesServer(t *testing.T) {
+	got := signProxyRequest(oracleProxyKey, http.MethodPost, oraclePath, "openai", oracleNonce, []byte(oracleBody), oracleTimestamp)
+	if got != oracleSignature {
+		t.Fatalf("signature = %s, want %s", got, oracleSignature)
+	}
+}
+
+func TestProxySignsBodyAsSent(t *testing.T) {
+	var got ProxyRequest
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	resp, err := testClient(srv.URL).proxy(oracleProxyKey, "openai", "/v1/chat/completions", []byte("{\n  \"messages\": [{\"content\": \"<a & b>\"}]\n}"), false)
+	if err != nil {
+		t.Fatalf("proxy: %v", err)
+	}
+	_ = resp.Body.Close()
+
+	if path != oraclePath {
+		t.Fatalf("path = %s, want %s", path, oraclePath)
+	}
+	// The server verifies the body bytes exactly as they arrive, so they
+	// must be compacted and keep <, > and & unescaped
+	if !bytes.Equal(got.Body, []byte(oracleBody)) {
+		t.Fatalf("body = %s, want %s", got.Body, oracleBody)
+	}
+	want := signProxyRequest(oracleProxyKey, http.MethodPost, path, got.Provider, got.Nonce, got.Body, got.Timestamp)
+	if got.Signature != want || got.Nonce == "" {
+		t.Fatalf("signature %s with nonce %q doesn't cover the request as sent", got.Signature, got.Nonce)
+	}
+}
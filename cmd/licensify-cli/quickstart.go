@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+var quickstartHardwareID string
+
+var quickstartCmd = &cobra.Command{
+	Use:   "quickstart",
+	Short: "Start an anonymous trial on this machine",
+	Long: `Request an anonymous trial license bound to this machine and activate it in one step.
+No email is required. The server must have anonymous trials enabled (ALLOW_ANONYMOUS_TRIAL=true),
+and each device is limited to one free license.`,
+	Example: `  licensify quickstart
+  licensify quickstart --hardware-id hw-123`,
+	RunE: runQuickstart,
+}
+
+func init() {
+	quickstartCmd.Flags().StringVar(&quickstartHardwareID, "hardware-id", "", "Hardware ID (auto-detected if omitted)")
+}
+
+func runQuickstart(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Get or detect hardware ID
+	hardwareID := quickstartHardwareID
+	if hardwareID == "" {
+		printInfo("Detecting hardware ID...")
+		hwID, err := getHardwareID(config.AppSalt)
+		if err != nil {
+			return fmt.Errorf("failed to detect hardware ID: %w\nProvide it manually with --hardware-id", err)
+		}
+		hardwareID = hwID
+		printInfo(fmt.Sprintf("Hardware ID: %s", redact.Key(hardwareID)))
+	}
+
+	client := newHTTPClient(config.Server)
+
+	printInfo("Requesting trial license...")
+
+	trial, err := client.requestTrial(hardwareID)
+	if err != nil {
+		return fmt.Errorf("trial request failed: %w", err)
+	}
+
+	if !trial.Success {
+		return fmt.Errorf("trial request failed: %s", trial.Message)
+	}
+
+	printInfo("Activating license...")
+
+	resp, err := client.activateLicense(trial.LicenseKey, hardwareID)
+	if err != nil {
+		return fmt.Errorf("activation failed: %w", err)
+	}
+
+	if !resp.Success {
+		return fmt.Errorf("activation failed: %s", resp.Error)
+	}
+
+	bundle, err := decryptBundle(resp.EncryptedAPIKey, resp.IV, resp.Salt, trial.LicenseKey, hardwareID)
+	if err != nil {
+		return fmt.Errorf("activation succeeded but the bundle could not be decrypted: %w", err)
+	}
+	if err := verifyBundleSignature(client, config, resp, trial.LicenseKey); err != nil {
+		return fmt.Errorf("activation bundle failed signature verification: %w", err)
+	}
+
+	printSuccess("Trial license activated!")
+
+	// Save everything so the other commands pick it up
+	config.LicenseKey = trial.LicenseKey
+	config.Tier = trial.Tier
+	config.ExpiresAt = trial.ExpiresAt
+	config.HardwareID = hardwareID
+	config.ActivatedAt = time.Now()
+	config.ProxyKey = bundleProxyKey(resp.Mode, bundle)
+	config.ProxyKeyExpiresAt = resp.ProxyKeyExpires
+	if err := saveConfig(config); err != nil {
+		printError(fmt.Sprintf("Warning: Could not save config: %v", err))
+	}
+
+	fmt.Printf("\nLicense Key: %s\n", trial.LicenseKey)
+	fmt.Printf("Tier: %s (trial)\n", trial.Tier)
+	fmt.Printf("Expires: %s\n", trial.ExpiresAt.Format("2006-01-02"))
+	fmt.Printf("Daily Limit: %d\n", trial.DailyLimit)
+	fmt.Println("\nTo keep using Licensify after the trial, request a license with:")
+	fmt.Println("  licensify init --email your@email.com")
+
+	return nil
+}
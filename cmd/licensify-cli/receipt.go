@@ -0,0 +1,197 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+var (
+	receiptKey        string
+	receiptHardwareID string
+	receiptOut        string
+	receiptPublicKey  string
+)
+
+var receiptCmd = &cobra.Command{
+	Use:   "receipt",
+	Short: "Download a signed license receipt",
+	Long: `Fetch a signed proof-of-license receipt for this machine's activation and save it.
+The receipt can be archived and checked later with 'licensify verify-receipt'.
+The server must run with ENABLE_RECEIPTS=true.`,
+	Example: `  licensify receipt --out receipt.json
+  licensify receipt --key LIC-xxx --hardware-id hw-123 --out receipt.json`,
+	RunE: runReceipt,
+}
+
+var verifyReceiptCmd = &cobra.Command{
+	Use:   "verify-receipt <file>",
+	Short: "Verify a signed license receipt",
+	Long: `Check a receipt's signature against the server's public key.
+Uses --public-key if given, otherwise the key pinned in the config, otherwise the key from the server.
+Receipts signed before a server key rotation are accepted with the retired
+keys the server lists, as long as it still signs with the pinned key.`,
+	Example: `  licensify verify-receipt receipt.json
+  licensify verify-receipt receipt.json --public-key BASE64_KEY`,
+	Args: cobra.ExactArgs(1),
+	RunE: runVerifyReceipt,
+}
+
+func init() {
+	receiptCmd.Flags().StringVarP(&receiptKey, "key", "k", "", "License key (uses saved key if omitted)")
+	receiptCmd.Flags().StringVar(&receiptHardwareID, "hardware-id", "", "Hardware ID (uses saved or detected ID if omitted)")
+	receiptCmd.Flags().StringVarP(&receiptOut, "out", "o", "receipt.json", "File to write the receipt to")
+
+	verifyReceiptCmd.Flags().StringVar(&receiptPublicKey, "public-key", "", "Base64 Ed25519 public key of the server")
+}
+
+func runReceipt(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use provided key or fall back to saved key
+	licenseKey := receiptKey
+	if licenseKey == "" {
+		licenseKey = config.LicenseKey
+		if licenseKey == "" {
+			return fmt.Errorf("no license key provided and no saved key found. Use --key")
+		}
+	}
+	if err := licensekey.VerifyChecksum(licenseKey); err != nil {
+		return err
+	}
+
+	// Prefer the hardware ID the license was activated with
+	hardwareID := receiptHardwareID
+	if hardwareID == "" {
+		hardwareID = config.HardwareID
+	}
+	if hardwareID == "" {
+		printInfo("Detecting hardware ID...")
+		hwID, err := getHardwareID(config.AppSalt)
+		if err != nil {
+			return fmt.Errorf("failed to detect hardware ID: %w\nProvide it manually with --hardware-id", err)
+		}
+		hardwareID = hwID
+	}
+
+	client := newHTTPClient(config.Server)
+
+	printInfo("Requesting receipt...")
+
+	resp, err := client.receipt(licenseKey, hardwareID)
+	if err != nil {
+		return fmt.Errorf("receipt request failed: %w", err)
+	}
+
+	// Never save a receipt that wouldn't verify later
+	publicKey, err := serverPublicKey(client, config)
+	if err != nil {
+		return err
+	}
+	if err := licensecrypto.VerifyReceipt(publicKey, resp.Receipt, resp.Signature); err != nil {
+		return fmt.Errorf("server returned a receipt that failed verification: %w", err)
+	}
+	if err := saveConfig(config); err != nil {
+		printError(fmt.Sprintf("Warning: Could not save config: %v", err))
+	}
+
+	data, err := json.MarshalIndent(resp, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode receipt: %w", err)
+	}
+	if err := os.WriteFile(receiptOut, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write receipt: %w", err)
+	}
+
+	printSuccess(fmt.Sprintf("Receipt saved to %s", receiptOut))
+	return nil
+}
+
+func runVerifyReceipt(cmd *cobra.Command, args []string) error {
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to read receipt: %w", err)
+	}
+
+	var signed ReceiptResponse
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return fmt.Errorf("invalid receipt file: %w", err)
+	}
+
+	// Trust an explicit key or the pinned/server key, never the one embedded
+	// in the file, which anyone could replace along with the signature
+	trustedKeys := []string{receiptPublicKey}
+	if receiptPublicKey == "" {
+		config, err := loadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		client := newHTTPClient(config.Server)
+		if _, err := serverPublicKey(client, config); err != nil {
+			return err
+		}
+		trustedKeys = []string{config.PublicKey}
+		// Receipts issued before a key rotation verify with the retired key,
+		// trusted only while the server still signs with the pinned key
+		if pk, err := client.publicKey(); err == nil && pk.PublicKey == config.PublicKey {
+			trustedKeys = append(trustedKeys, pk.RetiredKeys...)
+		}
+	}
+	publicKeys := make([]ed25519.PublicKey, 0, len(trustedKeys))
+	for _, key := range trustedKeys {
+		publicKey, err := licensecrypto.ParsePublicKey(key)
+		if err != nil {
+			return err
+		}
+		publicKeys = append(publicKeys, publicKey)
+	}
+
+	if signed.PublicKey != "" && !slices.Contains(trustedKeys, signed.PublicKey) {
+		printError("Receipt was signed with a different key than the trusted server key")
+		return fmt.Errorf("receipt verification failed")
+	}
+	err = licensecrypto.VerifyAny(publicKeys, func(publicKey ed25519.PublicKey) error {
+		return licensecrypto.VerifyReceipt(publicKey, signed.Receipt, signed.Signature)
+	})
+	if err != nil {
+		printError("Receipt signature is NOT valid")
+		return fmt.Errorf("receipt verification failed: %w", err)
+	}
+
+	var receipt LicenseReceipt
+	if err := json.Unmarshal(signed.Receipt, &receipt); err != nil {
+		return fmt.Errorf("invalid receipt contents: %w", err)
+	}
+
+	printSuccess("Receipt signature is valid!")
+
+	fmt.Println("\n🧾 License Receipt")
+	fmt.Println("──────────────────")
+	fmt.Printf("License Key:   %s\n", redact.Key(receipt.LicenseID))
+	if receipt.CustomerEmail != "" {
+		fmt.Printf("Customer:      %s (%s)\n", receipt.CustomerName, receipt.CustomerEmail)
+	} else {
+		fmt.Printf("Customer:      %s\n", receipt.CustomerName)
+	}
+	fmt.Printf("Tier:          %s\n", receipt.Tier)
+	fmt.Printf("Hardware ID:   %s\n", redact.Key(receipt.HardwareID))
+	fmt.Printf("Activated:     %s\n", receipt.ActivatedAt.Format("2006-01-02"))
+	fmt.Printf("Expires:       %s\n", receipt.ExpiresAt.Format("2006-01-02"))
+	fmt.Printf("Issued:        %s\n", receipt.IssuedAt.Format("2006-01-02 15:04:05 MST"))
+	if time.Now().After(receipt.ExpiresAt) {
+		printInfo("The license in this receipt has since expired")
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"time"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/spf13/cobra"
+)
+
+var revocationsCmd = &cobra.Command{
+	Use:   "revocations",
+	Short: "Sync the server's list of revoked licenses",
+	Long: `Download the signed list of revoked licenses from the server, verify it with
+the pinned public key and save it. An installed offline license that is on the
+list is removed. The saved list is used by 'activate --offline-file' when the
+server can't be reached.`,
+	Example: `  licensify revocations`,
+	Args:    cobra.NoArgs,
+	RunE:    runRevocations,
+}
+
+func runRevocations(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	client := newHTTPClient(config.Server)
+	publicKey, err := serverPublicKey(client, config)
+	if err != nil {
+		return err
+	}
+	list, err := syncRevocations(client, config, publicKey)
+	if err != nil {
+		return err
+	}
+	printSuccess(fmt.Sprintf("Revocation list synced: %d revoked license(s), issued %s",
+		len(list.Revocations), list.IssuedAt.Format(time.RFC3339)))
+
+	var revokedErr error
+	if config.OfflineLicense != nil {
+		_, err := licensecrypto.VerifyOfflineLicense(publicKey, config.OfflineLicense, config.HardwareID, time.Now(), list)
+		if errors.Is(err, licensecrypto.ErrLicenseRevoked) {
+			config.OfflineLicense = nil
+			revokedErr = fmt.Errorf("offline license %s has been revoked and was removed", redact.Key(config.LicenseKey))
+		}
+	}
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save revocation list: %w", err)
+	}
+	return revokedErr
+}
+
+// syncRevocations fetches the server's revocation list, verifies it with
+// publicKey and saves it in config. A list older than the saved one is
+// refused, so a replayed response can't un-revoke a license.
+func syncRevocations(client *HTTPClient, config *Config, publicKey ed25519.PublicKey) (*licensecrypto.RevocationList, error) {
+	resp, err := client.revocations()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch revocation list: %w", err)
+	}
+	list, err := licensecrypto.VerifyRevocationList(publicKey, resp.Revocations, resp.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("revocation list verification failed: %w", err)
+	}
+	if saved, err := savedRevocations(config, publicKey); err == nil && saved != nil && list.IssuedAt.Before(saved.IssuedAt) {
+		return nil, fmt.Errorf("revocation list issued %s is older than the saved one", list.IssuedAt.Format(time.RFC3339))
+	}
+
+	config.Revocations = &SyncedRevocations{
+		Revocations: resp.Revocations,
+		Signature:   resp.Signature,
+		SyncedAt:    time.Now(),
+	}
+	return list, nil
+}
+
+// savedRevocations verifies and returns the list saved by syncRevocations,
+// or nil if none has been synced
+func savedRevocations(config *Config, publicKey ed25519.PublicKey) (*licensecrypto.RevocationList, error) {
+	if config.Revocations == nil {
+		return nil, nil
+	}
+	list, err := licensecrypto.VerifyRevocationList(publicKey, config.Revocations.Revocations, config.Revocations.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("saved revocation list verification failed: %w", err)
+	}
+	return list, nil
+}
+
+// currentRevocations syncs the revocation list, falling back to the saved
+// one when the server can't be reached. It returns nil if neither is
+// available.
+func currentRevocations(config *Config, publicKey ed25519.PublicKey) (*licensecrypto.RevocationList, error) {
+	list, err := syncRevocations(newHTTPClient(config.Server), config, publicKey)
+	if err == nil {
+		return list, nil
+	}
+	printInfo(fmt.Sprintf("Could not sync the revocation list: %v", err))
+
+	list, err = savedRevocations(config, publicKey)
+	switch {
+	case err != nil:
+		return nil, err
+	case list == nil:
+		printInfo("No saved revocation list, the license can't be checked against one")
+	default:
+		printInfo(fmt.Sprintf("Using the revocation list synced %s", config.Revocations.SyncedAt.Format(time.RFC3339)))
+	}
+	return list, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+)
+
+// revocationsServer serves list signed with privateKey at /revocations
+func revocationsServer(t *testing.T, privateKey ed25519.PrivateKey, list licensecrypto.RevocationList) *httptest.Server {
+	t.Helper()
+	payload, signature, err := licensecrypto.SignRevocationList(privateKey, list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(RevocationsResponse{Revocations: payload, Algorithm: "ed25519", Signature: signature})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestSyncRevocations(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	revoked := licensecrypto.RevocationList{
+		IssuedAt:    now,
+		Revocations: []licensecrypto.RevokedLicense{{LicenseID: "LIC-REVOKED", RevokedAt: now}},
+	}
+
+	t.Run("verified and saved", func(t *testing.T) {
+		config := &Config{}
+		srv := revocationsServer(t, privateKey, revoked)
+		list, err := syncRevocations(testClient(srv.URL), config, publicKey)
+		if err != nil {
+			t.Fatalf("syncRevocations: %v", err)
+		}
+		if !list.Contains("LIC-REVOKED") {
+			t.Fatal("synced list lost the revocation")
+		}
+		saved, err := savedRevocations(config, publicKey)
+		if err != nil || saved == nil || !saved.Contains("LIC-REVOKED") {
+			t.Fatalf("saved list = %v, %v", saved, err)
+		}
+	})
+
+	t.Run("signed with another key", func(t *testing.T) {
+		config := &Config{}
+		srv := revocationsServer(t, otherKey, revoked)
+		if _, err := syncRevocations(testClient(srv.URL), config, publicKey); !errors.Is(err, licensecrypto.ErrInvalidSignature) {
+			t.Fatalf("error = %v, want ErrInvalidSignature", err)
+		}
+		if config.Revocations != nil {
+			t.Fatal("unverified list was saved")
+		}
+	})
+
+	t.Run("older than the saved list", func(t *testing.T) {
+		config := &Config{}
+		if _, err := syncRevocations(testClient(revocationsServer(t, privateKey, revoked).URL), config, publicKey); err != nil {
+			t.Fatal(err)
+		}
+		older := licensecrypto.RevocationList{IssuedAt: now.Add(-time.Hour)}
+		if _, err := syncRevocations(testClient(revocationsServer(t, privateKey, older).URL), config, publicKey); err == nil {
+			t.Fatal("older list replaced the saved one")
+		}
+		saved, err := savedRevocations(config, publicKey)
+		if err != nil || !saved.Contains("LIC-REVOKED") {
+			t.Fatalf("saved list = %v, %v", saved, err)
+		}
+	})
+
+	t.Run("saved list tampered", func(t *testing.T) {
+		config := &Config{}
+		if _, err := syncRevocations(testClient(revocationsServer(t, privateKey, revoked).URL), config, publicKey); err != nil {
+			t.Fatal(err)
+		}
+		config.Revocations.Revocations = json.RawMessage(`{"issued_at":"` + now.Format(time.RFC3339) + `","revocations":[]}`)
+		if _, err := savedRevocations(config, publicKey); !errors.Is(err, licensecrypto.ErrInvalidSignature) {
+			t.Fatalf("error = %v, want ErrInvalidSignature", err)
+		}
+	})
+}
+
+func TestCurrentRevocationsRefusesRevokedOfflineLicense(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := retryCount
+	retryCount = 0
+	t.Cleanup(func() { retryCount = previous })
+
+	now := time.Now().UTC().Truncate(time.Second)
+	file, err := licensecrypto.SignOfflineLicense(privateKey, licensecrypto.OfflineLicense{
+		LicenseID:  "LIC-REVOKED",
+		HardwareID: "hw-offline",
+		ExpiresAt:  now.AddDate(1, 0, 0),
+		IssuedAt:   now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := revocationsServer(t, privateKey, licensecrypto.RevocationList{
+		IssuedAt:    now,
+		Revocations: []licensecrypto.RevokedLicense{{LicenseID: "LIC-REVOKED", RevokedAt: now}},
+	})
+
+	config := &Config{Server: srv.URL}
+	list, err := currentRevocations(config, publicKey)
+	if err != nil {
+		t.Fatalf("currentRevocations: %v", err)
+	}
+	if _, err := licensecrypto.VerifyOfflineLicense(publicKey, file, "hw-offline", now, list); !errors.Is(err, licensecrypto.ErrLicenseRevoked) {
+		t.Fatalf("error = %v, want ErrLicenseRevoked", err)
+	}
+
+	// With the server gone, the saved list still refuses the license
+	srv.Close()
+	list, err = currentRevocations(config, publicKey)
+	if err != nil {
+		t.Fatalf("currentRevocations offline: %v", err)
+	}
+	if _, err := licensecrypto.VerifyOfflineLicense(publicKey, file, "hw-offline", now, list); !errors.Is(err, licensecrypto.ErrLicenseRevoked) {
+		t.Fatalf("offline error = %v, want ErrLicenseRevoked", err)
+	}
+}
@@ -2,8 +2,10 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/melihbirim/licensify/internal/redact"
 	"github.com/spf13/cobra"
 )
 
@@ -37,16 +39,23 @@ func runStatus(cmd *cobra.Command, args []string) error {
 		fmt.Printf("Email:        %s\n", config.Email)
 	}
 
-	fmt.Printf("License Key:  %s\n", redactKey(config.LicenseKey))
+	fmt.Printf("License Key:  %s\n", redact.Key(config.LicenseKey))
 	fmt.Printf("Tier:         %s\n", config.Tier)
+	if len(config.Products) > 0 {
+		fmt.Printf("Products:     %s\n", strings.Join(config.Products, ", "))
+	}
 	fmt.Printf("Server:       %s\n", config.Server)
 
 	if config.HardwareID != "" {
-		fmt.Printf("Hardware ID:  %s\n", redactKey(config.HardwareID))
+		fmt.Printf("Hardware ID:  %s\n", redact.Key(config.HardwareID))
 	} else {
 		fmt.Println("Hardware ID:  (not activated)")
 	}
 
+	if config.ProxyKey != "" {
+		fmt.Printf("Proxy Key:    %s\n", redact.Key(config.ProxyKey))
+	}
+
 	if !config.ExpiresAt.IsZero() {
 		fmt.Printf("Expires:      %s", config.ExpiresAt.Format("2006-01-02"))
 
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/spf13/cobra"
+)
+
+var (
+	usageKey  string
+	usageFrom string
+	usageTo   string
+	usageDays int
+)
+
+// usageBarWidth is the length of the longest bar in the usage chart
+const usageBarWidth = 40
+
+var usageCmd = &cobra.Command{
+	Use:   "usage",
+	Short: "Show daily usage history",
+	Long: `Fetch the license's daily usage from the server and draw it as a bar chart.
+Shows the last 14 days unless --days or --from/--to are given. Ranges are limited to 366 days.`,
+	Example: `  licensify usage
+  licensify usage --days 30
+  licensify usage --from 2025-01-01 --to 2025-01-31`,
+	RunE: runUsage,
+}
+
+func init() {
+	usageCmd.Flags().StringVarP(&usageKey, "key", "k", "", "License key (uses saved key if omitted)")
+	usageCmd.Flags().StringVar(&usageFrom, "from", "", "First day to show (YYYY-MM-DD)")
+	usageCmd.Flags().StringVar(&usageTo, "to", "", "Last day to show (YYYY-MM-DD, default today)")
+	usageCmd.Flags().IntVarP(&usageDays, "days", "d", 14, "Number of days to show, ending at --to")
+}
+
+func runUsage(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use provided key or fall back to saved key
+	licenseKey := usageKey
+	if licenseKey == "" {
+		licenseKey = config.LicenseKey
+		if licenseKey == "" {
+			return fmt.Errorf("no license key provided and no saved key found. Use --key or run 'licensify verify' first")
+		}
+	}
+	if err := licensekey.VerifyChecksum(licenseKey); err != nil {
+		return err
+	}
+
+	// --days counts back from --to unless --from is given explicitly
+	from := usageFrom
+	if from == "" {
+		if usageDays < 1 {
+			return fmt.Errorf("--days must be at least 1")
+		}
+		end := time.Now()
+		if usageTo != "" {
+			end, err = time.Parse("2006-01-02", usageTo)
+			if err != nil {
+				return fmt.Errorf("--to must be a date in YYYY-MM-DD format")
+			}
+		}
+		from = end.AddDate(0, 0, -(usageDays - 1)).Format("2006-01-02")
+	}
+
+	client := newHTTPClient(config.Server)
+	resp, err := client.usageHistory(licenseKey, from, usageTo)
+	if err != nil {
+		return fmt.Errorf("failed to fetch usage: %w", err)
+	}
+
+	fmt.Printf("\n📈 Usage %s to %s\n", resp.From, resp.To)
+	fmt.Println(strings.Repeat("─", 12+usageBarWidth+10))
+	fmt.Print(renderUsageChart(resp.Days, resp.DailyLimit))
+	fmt.Println(strings.Repeat("─", 12+usageBarWidth+10))
+
+	fmt.Printf("Total:         %d\n", resp.TotalScans)
+	if len(resp.Days) > 0 {
+		fmt.Printf("Daily average: %.1f\n", float64(resp.TotalScans)/float64(len(resp.Days)))
+	}
+	if resp.DailyLimit > 0 {
+		fmt.Printf("Daily limit:   %d\n", resp.DailyLimit)
+	} else if resp.DailyLimit == -1 {
+		fmt.Println("Daily limit:   Unlimited")
+	}
+
+	return nil
+}
+
+// renderUsageChart draws one bar per day, scaled to the busiest day. Days at
+// or over the daily limit are flagged.
+func renderUsageChart(days []UsageDay, dailyLimit int) string {
+	peak := 0
+	for _, day := range days {
+		peak = max(peak, day.Scans)
+	}
+
+	var b strings.Builder
+	for _, day := range days {
+		width := 0
+		if peak > 0 {
+			width = day.Scans * usageBarWidth / peak
+		}
+		if day.Scans > 0 && width == 0 {
+			width = 1 // keep light days visible
+		}
+		fmt.Fprintf(&b, "%s │%-*s│ %d", day.Date, usageBarWidth, strings.Repeat("█", width), day.Scans)
+		if dailyLimit > 0 && day.Scans >= dailyLimit {
+			b.WriteString(" ⚠️")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/spf13/cobra"
+)
+
+var (
+	usageRecordKey      string
+	usageRecordScans    int
+	usageRecordInterval time.Duration
+)
+
+var usageRecordCmd = &cobra.Command{
+	Use:   "record",
+	Short: "Report usage to the server",
+	Long: `Report scans to the server in batches.
+
+With --scans, report that many scans now. Otherwise each line read from stdin
+counts as one scan. Scans are buffered and sent together every
+--flush-interval, and once more when stdin closes or the command is
+interrupted. A failed flush keeps its scans for the next one.`,
+	Example: `  licensify usage record --scans 5
+  my-scanner | licensify usage record
+  tail -f scans.log | licensify usage record --flush-interval 1m`,
+	RunE: runUsageRecord,
+}
+
+func init() {
+	usageRecordCmd.Flags().StringVarP(&usageRecordKey, "key", "k", "", "License key (uses saved key if omitted)")
+	usageRecordCmd.Flags().IntVarP(&usageRecordScans, "scans", "n", 0, "Report this many scans instead of reading stdin")
+	usageRecordCmd.Flags().DurationVar(&usageRecordInterval, "flush-interval", 30*time.Second, "How often to send buffered scans")
+	usageCmd.AddCommand(usageRecordCmd)
+}
+
+func runUsageRecord(cmd *cobra.Command, args []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use provided key or fall back to saved key
+	licenseKey := usageRecordKey
+	if licenseKey == "" {
+		licenseKey = config.LicenseKey
+		if licenseKey == "" {
+			return fmt.Errorf("no license key provided and no saved key found. Use --key or run 'licensify verify' first")
+		}
+	}
+	if err := licensekey.VerifyChecksum(licenseKey); err != nil {
+		return err
+	}
+
+	// Prefer the hardware ID the license was activated with
+	hardwareID := config.HardwareID
+	if hardwareID == "" {
+		if hardwareID, err = getHardwareID(config.AppSalt); err != nil {
+			return fmt.Errorf("failed to detect hardware ID: %w", err)
+		}
+	}
+
+	buffer := newUsageBuffer(newHTTPClient(config.Server), licenseKey, hardwareID)
+
+	if cmd.Flags().Changed("scans") {
+		if usageRecordScans < 1 {
+			return fmt.Errorf("--scans must be at least 1")
+		}
+		buffer.add(usageRecordScans)
+		return finishUsageRecord(buffer)
+	}
+	if usageRecordInterval <= 0 {
+		return fmt.Errorf("--flush-interval must be positive")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			buffer.add(1)
+		}
+		done <- scanner.Err()
+	}()
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	ticker := time.NewTicker(usageRecordInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := buffer.flush(); err != nil {
+				printError(fmt.Sprintf("Failed to report usage, will retry: %v", err))
+			}
+		case err := <-done:
+			if err != nil {
+				printError(fmt.Sprintf("Failed to read stdin: %v", err))
+			}
+			return finishUsageRecord(buffer)
+		case <-interrupted:
+			return finishUsageRecord(buffer)
+		}
+	}
+}
+
+// finishUsageRecord sends whatever is still buffered and prints the totals
+func finishUsageRecord(buffer *usageBuffer) error {
+	resp, err := buffer.flush()
+	if err != nil {
+		return fmt.Errorf("failed to report %d scans: %w", buffer.pendingScans(), err)
+	}
+	printSuccess(fmt.Sprintf("Reported %d scans", buffer.reported))
+	if resp != nil {
+		fmt.Printf("Today:       %s\n", formatUsage(resp.DailyUsage, resp.DailyLimit))
+		fmt.Printf("This month:  %s\n", formatUsage(resp.MonthlyUsage, resp.MonthlyLimit))
+	}
+	return nil
+}
+
+func formatUsage(used, limit int) string {
+	if limit == -1 {
+		return fmt.Sprintf("%d (unlimited)", used)
+	}
+	return fmt.Sprintf("%d / %d", used, limit)
+}
+
+// usageBuffer counts scans per day and reports them to /usage/batch in one
+// request, so busy clients don't send a request per scan
+type usageBuffer struct {
+	client     *HTTPClient
+	licenseKey string
+	hardwareID string
+
+	mu       sync.Mutex
+	pending  map[string]int // YYYY-MM-DD -> scans not yet reported
+	reported int
+}
+
+func newUsageBuffer(client *HTTPClient, licenseKey, hardwareID string) *usageBuffer {
+	return &usageBuffer{client: client, licenseKey: licenseKey, hardwareID: hardwareID, pending: make(map[string]int)}
+}
+
+// add counts scans against today's date
+func (b *usageBuffer) add(scans int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending[time.Now().Format("2006-01-02")] += scans
+}
+
+// pendingScans returns the number of scans not yet reported
+func (b *usageBuffer) pendingScans() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	total := 0
+	for _, scans := range b.pending {
+		total += scans
+	}
+	return total
+}
+
+// flush reports the buffered scans and returns the server's usage totals,
+// or nil when there was nothing to send. On failure the scans are kept for
+// the next flush. A request that reached the server but whose answer was
+// lost is sent again, so those scans may be counted twice.
+func (b *usageBuffer) flush() (*UsageResponse, error) {
+	b.mu.Lock()
+	pending := b.pending
+	b.pending = make(map[string]int)
+	b.mu.Unlock()
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	entries := make([]UsageBatchEntry, 0, len(pending))
+	for date, scans := range pending {
+		entries = append(entries, UsageBatchEntry{Date: date, Scans: scans, HardwareID: b.hardwareID})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Date < entries[j].Date })
+
+	resp, err := b.client.reportUsageBatch(b.licenseKey, entries)
+	if err != nil {
+		b.mu.Lock()
+		for date, scans := range pending {
+			b.pending[date] += scans
+		}
+		b.mu.Unlock()
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.reported += resp.Recorded
+	b.mu.Unlock()
+	return resp, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// getHealth calls handleHealth with query and decodes the response
+func getHealth(t *testing.T, query string) (int, map[string]interface{}, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	handleHealth(w, httptest.NewRequest(http.MethodGet, "/health"+query, nil))
+	var body map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+	return w.Code, body, w.Body.String()
+}
+
+func TestHealthDeepCheck(t *testing.T) {
+	openTestDB(t)
+
+	code, body, _ := getHealth(t, "")
+	if code != http.StatusOK || body["status"] != "ok" || body["database"] != nil {
+		t.Fatalf("liveness = %d %v, want 200 without database details", code, body)
+	}
+
+	code, body, _ = getHealth(t, "?deep=1")
+	database, _ := body["database"].(map[string]interface{})
+	if code != http.StatusOK || body["status"] != "ok" || database["status"] != "ok" || database["backend"] != "sqlite" {
+		t.Fatalf("deep check = %d %v, want 200 with a healthy database", code, body)
+	}
+	if _, ok := database["pool"].(map[string]interface{}); !ok {
+		t.Fatalf("deep check has no pool stats: %v", database)
+	}
+
+	// A dead database fails readiness but not liveness
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	code, body, raw := getHealth(t, "?deep=true")
+	database, _ = body["database"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || body["status"] != "unavailable" || database["status"] != "ping failed" {
+		t.Fatalf("deep check on a closed database = %d %v, want 503 with the ping failure", code, body)
+	}
+	if strings.Contains(raw, "closed") {
+		t.Fatalf("response leaks the database error: %s", raw)
+	}
+	if code, _, _ := getHealth(t, "?deep=0"); code != http.StatusOK {
+		t.Fatalf("liveness on a closed database = %d, want 200", code)
+	}
+}
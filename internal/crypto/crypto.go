@@ -0,0 +1,232 @@
+// Package crypto defines the activation bundle, receipt, offline license and
+// revocation list signatures shared by the server and licensify-admin, which
+// sign them, and clients, which verify them, along with the Argon2id key
+// derivation for activation bundles.
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidSignature is returned when a bundle or receipt signature does not match
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// signedMessage is what a bundle signature covers: the base64 ciphertext,
+// base64 IV, base64 of the salt (with its KDF parameters) and license ID
+// joined with ".". Base64 never contains ".", so the fields cannot be
+// shifted into one another, and a bundle can't be paired with a salt that
+// derives its key with weaker parameters.
+func signedMessage(ciphertext, iv, salt, licenseID string) []byte {
+	return []byte(ciphertext + "." + iv + "." + base64.StdEncoding.EncodeToString([]byte(salt)) + "." + licenseID)
+}
+
+// SignBundle signs an activation bundle and returns the base64 signature
+func SignBundle(privateKey ed25519.PrivateKey, ciphertext, iv, salt, licenseID string) string {
+	sig := ed25519.Sign(privateKey, signedMessage(ciphertext, iv, salt, licenseID))
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// VerifyLicenseSignature checks a base64 bundle signature against the
+// server's public key
+func VerifyLicenseSignature(publicKey ed25519.PublicKey, ciphertext, iv, salt, licenseID, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: bad encoding", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(publicKey, signedMessage(ciphertext, iv, salt, licenseID), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// ParsePublicKey decodes a base64 Ed25519 public key as served by /pubkey
+func ParsePublicKey(b64 string) (ed25519.PublicKey, error) {
+	key, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length %d, expected %d", len(key), ed25519.PublicKeySize)
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// SignReceipt signs a license receipt and returns the base64 signature. The
+// signature covers the compact form of the receipt JSON, so receipts can be
+// pretty-printed when saved and still verify.
+func SignReceipt(privateKey ed25519.PrivateKey, receipt []byte) (string, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, receipt); err != nil {
+		return "", fmt.Errorf("invalid receipt JSON: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, compact.Bytes())), nil
+}
+
+// VerifyReceipt checks a base64 receipt signature against the server's
+// public key
+func VerifyReceipt(publicKey ed25519.PublicKey, receipt []byte, signature string) error {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, receipt); err != nil {
+		return fmt.Errorf("invalid receipt JSON: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: bad encoding", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(publicKey, compact.Bytes(), sig) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Offline license errors returned by VerifyOfflineLicense
+var (
+	ErrHardwareMismatch = errors.New("license is bound to a different machine")
+	ErrLicenseExpired   = errors.New("license has expired")
+	ErrLicenseRevoked   = errors.New("license has been revoked")
+)
+
+// offlineLicenseDomain prefixes the signed offline license payload so a
+// signature made for a receipt can never pass as an offline license
+const offlineLicenseDomain = "licensify-offline-license-v1\n"
+
+// OfflineLicense is the signed content of an offline license file. It lets
+// air-gapped machines use a license without contacting the server.
+type OfflineLicense struct {
+	LicenseID      string    `json:"license_id"`
+	CustomerName   string    `json:"customer_name"`
+	CustomerEmail  string    `json:"customer_email"`
+	Tier           string    `json:"tier"`
+	Products       []string  `json:"products,omitempty"`
+	HardwareID     string    `json:"hardware_id"`
+	DailyLimit     int       `json:"daily_limit"`
+	MonthlyLimit   int       `json:"monthly_limit"`
+	MaxActivations int       `json:"max_activations"`
+	ExpiresAt      time.Time `json:"expires_at"`
+	IssuedAt       time.Time `json:"issued_at"`
+}
+
+// OfflineLicenseFile is the JSON document handed to the customer. License
+// holds the payload exactly as signed; PublicKey is informational and must
+// not be trusted on its own.
+type OfflineLicenseFile struct {
+	License   json.RawMessage `json:"license"`
+	Signature string          `json:"signature"`
+	PublicKey string          `json:"public_key"`
+}
+
+// SignOfflineLicense signs an offline license. The signature covers the
+// compact JSON of the license, so the file may be reformatted and still verify.
+func SignOfflineLicense(privateKey ed25519.PrivateKey, license OfflineLicense) (*OfflineLicenseFile, error) {
+	payload, err := json.Marshal(license)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode offline license: %w", err)
+	}
+	sig := ed25519.Sign(privateKey, append([]byte(offlineLicenseDomain), payload...))
+	return &OfflineLicenseFile{
+		License:   payload,
+		Signature: base64.StdEncoding.EncodeToString(sig),
+		PublicKey: base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+	}, nil
+}
+
+// VerifyOfflineLicense checks an offline license file's signature against the
+// server's public key and that it is bound to hardwareID, not expired at now
+// and not on revocations, a list verified with VerifyRevocationList. Pass nil
+// revocations only when no list is available. It returns the license only if
+// every check passes.
+func VerifyOfflineLicense(publicKey ed25519.PublicKey, file *OfflineLicenseFile, hardwareID string, now time.Time, revocations *RevocationList) (*OfflineLicense, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, file.License); err != nil {
+		return nil, fmt.Errorf("invalid offline license JSON: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(file.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad encoding", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(publicKey, append([]byte(offlineLicenseDomain), compact.Bytes()...), sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	var license OfflineLicense
+	if err := json.Unmarshal(compact.Bytes(), &license); err != nil {
+		return nil, fmt.Errorf("invalid offline license contents: %w", err)
+	}
+	if license.HardwareID != hardwareID {
+		return nil, ErrHardwareMismatch
+	}
+	if now.After(license.ExpiresAt) {
+		return nil, ErrLicenseExpired
+	}
+	if revocations != nil && revocations.Contains(license.LicenseID) {
+		return nil, ErrLicenseRevoked
+	}
+	return &license, nil
+}
+
+// revocationListDomain prefixes the signed revocation list payload
+const revocationListDomain = "licensify-revocations-v1\n"
+
+// RevokedLicense is one entry of a RevocationList
+type RevokedLicense struct {
+	LicenseID string    `json:"license_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+}
+
+// RevocationList is the signed content served at GET /revocations
+type RevocationList struct {
+	IssuedAt    time.Time        `json:"issued_at"`
+	Revocations []RevokedLicense `json:"revocations"`
+}
+
+// Contains reports whether licenseID is on the list
+func (l *RevocationList) Contains(licenseID string) bool {
+	for _, r := range l.Revocations {
+		if r.LicenseID == licenseID {
+			return true
+		}
+	}
+	return false
+}
+
+// SignRevocationList signs the compact JSON of a revocation list and returns
+// it together with the base64 signature
+func SignRevocationList(privateKey ed25519.PrivateKey, list RevocationList) (json.RawMessage, string, error) {
+	if list.Revocations == nil {
+		list.Revocations = []RevokedLicense{}
+	}
+	payload, err := json.Marshal(list)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode revocation list: %w", err)
+	}
+	sig := ed25519.Sign(privateKey, append([]byte(revocationListDomain), payload...))
+	return payload, base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyRevocationList checks a revocation list signature made by
+// SignRevocationList and returns the decoded list
+func VerifyRevocationList(publicKey ed25519.PublicKey, payload json.RawMessage, signatureB64 string) (*RevocationList, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, payload); err != nil {
+		return nil, fmt.Errorf("invalid revocation list JSON: %w", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad encoding", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(publicKey, append([]byte(revocationListDomain), compact.Bytes()...), sig) {
+		return nil, ErrInvalidSignature
+	}
+
+	var list RevocationList
+	if err := json.Unmarshal(compact.Bytes(), &list); err != nil {
+		return nil, fmt.Errorf("invalid revocation list contents: %w", err)
+	}
+	return &list, nil
+}
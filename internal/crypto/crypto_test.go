@@ -0,0 +1,161 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyLicenseSignatureRejectsTampering(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const ciphertext, iv, salt, licenseID = "Y2lwaGVydGV4dA==", "aW5pdHZlY3Rvcg==", "00ff", "LIC-1"
+	sig := SignBundle(privateKey, ciphertext, iv, salt, licenseID)
+	raw, _ := base64.StdEncoding.DecodeString(sig)
+	raw[0] ^= 1
+	flipped := base64.StdEncoding.EncodeToString(raw)
+
+	tests := []struct {
+		name                      string
+		key                       ed25519.PublicKey
+		ciphertext, iv, licenseID string
+		signature                 string
+		wantErr                   bool
+	}{
+		{"untouched", publicKey, ciphertext, iv, licenseID, sig, false},
+		{"ciphertext", publicKey, "Y2lwaGVydGV4dB==", iv, licenseID, sig, true},
+		{"ciphertext swapped with IV", publicKey, iv, ciphertext, licenseID, sig, true},
+		{"IV", publicKey, ciphertext, "aW5pdHZlY3Rvcw==", licenseID, sig, true},
+		{"license ID", publicKey, ciphertext, iv, "LIC-2", sig, true},
+		{"license ID moved into IV", publicKey, ciphertext, iv + ".LIC", "-1", sig, true},
+		{"signature", publicKey, ciphertext, iv, licenseID, flipped, true},
+		{"signature not base64", publicKey, ciphertext, iv, licenseID, "not base64!", true},
+		{"another key", otherKey, ciphertext, iv, licenseID, sig, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyLicenseSignature(tt.key, tt.ciphertext, tt.iv, salt, tt.licenseID, tt.signature)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("valid signature rejected: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestBundleSignatureCoversSalt(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	salt := EncodeSalt("00ff", KDFParams{Time: 3, Memory: 65536, Threads: 4})
+	sig := SignBundle(privateKey, "Y2lwaGVy", "aXY=", salt, "LIC-1")
+
+	if err := VerifyLicenseSignature(publicKey, "Y2lwaGVy", "aXY=", salt, "LIC-1", sig); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	weaker := EncodeSalt("00ff", KDFParams{Time: 1, Memory: 8, Threads: 1})
+	if err := VerifyLicenseSignature(publicKey, "Y2lwaGVy", "aXY=", weaker, "LIC-1", sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("signature accepted with weaker KDF parameters: %v", err)
+	}
+	if err := VerifyLicenseSignature(publicKey, "Y2lwaGVy", "aXY=", "00fe", "LIC-1", sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("signature accepted with another salt: %v", err)
+	}
+}
+
+func TestVerifyOfflineLicense(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	file, err := SignOfflineLicense(privateKey, OfflineLicense{
+		LicenseID:  "LIC-OFFLINE",
+		HardwareID: "hw-offline",
+		Tier:       "basic",
+		DailyLimit: 100,
+		ExpiresAt:  now.AddDate(1, 0, 0),
+		IssuedAt:   now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// edit returns a copy of file with its payload changed by replacing old
+	// with new, keeping the original signature
+	edit := func(old, new string) *OfflineLicenseFile {
+		edited := *file
+		edited.License = json.RawMessage(strings.Replace(string(file.License), old, new, 1))
+		return &edited
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, file.License, "", "  "); err != nil {
+		t.Fatal(err)
+	}
+	reformatted := *file
+	reformatted.License = indented.Bytes()
+	receiptSig, err := SignReceipt(privateKey, file.License)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiptSigned := *file
+	receiptSigned.Signature = receiptSig
+	revoked := &RevocationList{IssuedAt: now, Revocations: []RevokedLicense{{LicenseID: "LIC-OFFLINE", RevokedAt: now}}}
+	unrelated := &RevocationList{IssuedAt: now, Revocations: []RevokedLicense{{LicenseID: "LIC-OTHER", RevokedAt: now}}}
+
+	tests := []struct {
+		name        string
+		key         ed25519.PublicKey
+		file        *OfflineLicenseFile
+		hardwareID  string
+		now         time.Time
+		revocations *RevocationList
+		want        error
+	}{
+		{"valid", publicKey, file, "hw-offline", now, nil, nil},
+		{"reformatted", publicKey, &reformatted, "hw-offline", now, nil, nil},
+		{"revocation list without it", publicKey, file, "hw-offline", now, unrelated, nil},
+		{"daily limit raised", publicKey, edit(`"daily_limit":100`, `"daily_limit":100000`), "hw-offline", now, nil, ErrInvalidSignature},
+		{"hardware ID swapped", publicKey, edit(`"hw-offline"`, `"hw-attacker"`), "hw-attacker", now, nil, ErrInvalidSignature},
+		{"expiry extended", publicKey, edit(`"expires_at":"2027`, `"expires_at":"2099`), "hw-offline", now, nil, ErrInvalidSignature},
+		{"receipt signature", publicKey, &receiptSigned, "hw-offline", now, nil, ErrInvalidSignature},
+		{"another key", otherKey, file, "hw-offline", now, nil, ErrInvalidSignature},
+		{"another machine", publicKey, file, "hw-other", now, nil, ErrHardwareMismatch},
+		{"expired", publicKey, file, "hw-offline", now.AddDate(1, 0, 1), nil, ErrLicenseExpired},
+		{"revoked", publicKey, file, "hw-offline", now, revoked, ErrLicenseRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			license, err := VerifyOfflineLicense(tt.key, tt.file, tt.hardwareID, tt.now, tt.revocations)
+			if tt.want == nil {
+				if err != nil || license.LicenseID != "LIC-OFFLINE" {
+					t.Fatalf("got %v, %v, want the license", license, err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) || license != nil {
+				t.Fatalf("got %v, %v, want %v", license, err, tt.want)
+			}
+		})
+	}
+}
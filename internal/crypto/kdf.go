@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KeyLength is the size of a derived bundle key (AES-256)
+const KeyLength = 32
+
+// KDFParams are the Argon2id settings used to derive a bundle key
+type KDFParams struct {
+	Time    uint32 // iterations
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+// LegacyKDFParams are the settings every bundle used before they were encoded
+// with the salt. A salt without a prefix always means these, so they must
+// never change.
+var LegacyKDFParams = KDFParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// DefaultKDFParams are used for new salts unless the server is configured
+// with others
+var DefaultKDFParams = LegacyKDFParams
+
+// Upper bounds on the parameters, so a salt can't make a client spend
+// minutes or gigabytes deriving a key
+const (
+	MaxKDFTime   = 10
+	MaxKDFMemory = 1024 * 1024 // KiB, i.e. 1 GiB
+)
+
+// kdfPrefix starts a salt that carries its own parameters
+const kdfPrefix = "argon2id$"
+
+// Validate rejects parameters Argon2id can't run with or that exceed
+// MaxKDFTime and MaxKDFMemory
+func (p KDFParams) Validate() error {
+	if p.Time < 1 {
+		return fmt.Errorf("argon2 time must be at least 1")
+	}
+	if p.Time > MaxKDFTime {
+		return fmt.Errorf("argon2 time must be at most %d", MaxKDFTime)
+	}
+	if p.Threads < 1 {
+		return fmt.Errorf("argon2 threads must be at least 1")
+	}
+	if p.Memory < 8*uint32(p.Threads) {
+		return fmt.Errorf("argon2 memory must be at least 8 KiB per thread")
+	}
+	if p.Memory > MaxKDFMemory {
+		return fmt.Errorf("argon2 memory must be at most %d KiB", MaxKDFMemory)
+	}
+	return nil
+}
+
+// String describes the parameters, e.g. "argon2id:t=3,m=65536,p=4,len=32"
+func (p KDFParams) String() string {
+	return fmt.Sprintf("argon2id:t=%d,m=%d,p=%d,len=%d", p.Time, p.Memory, p.Threads, KeyLength)
+}
+
+// EncodeSalt stores params with a hex salt as "argon2id$t=1,m=19456,p=1$<salt>"
+// so the key can be derived with the same settings after the defaults change.
+// Salts using LegacyKDFParams are returned as-is, which keeps them readable by
+// clients that predate the prefix.
+func EncodeSalt(salt string, params KDFParams) string {
+	if params == LegacyKDFParams {
+		return salt
+	}
+	return fmt.Sprintf("%st=%d,m=%d,p=%d$%s", kdfPrefix, params.Time, params.Memory, params.Threads, salt)
+}
+
+// ParseSalt splits a salt from EncodeSalt into the raw salt and its params.
+// A salt without a prefix uses LegacyKDFParams.
+func ParseSalt(encoded string) (string, KDFParams, error) {
+	if !strings.HasPrefix(encoded, kdfPrefix) {
+		return encoded, LegacyKDFParams, nil
+	}
+	settings, salt, ok := strings.Cut(strings.TrimPrefix(encoded, kdfPrefix), "$")
+	if !ok || salt == "" {
+		return "", KDFParams{}, fmt.Errorf("invalid salt: missing salt after parameters")
+	}
+
+	var params KDFParams
+	if _, err := fmt.Sscanf(settings, "t=%d,m=%d,p=%d", &params.Time, &params.Memory, &params.Threads); err != nil {
+		return "", KDFParams{}, fmt.Errorf("invalid salt parameters %q: %w", settings, err)
+	}
+	if err := params.Validate(); err != nil {
+		return "", KDFParams{}, fmt.Errorf("invalid salt parameters %q: %w", settings, err)
+	}
+	return salt, params, nil
+}
+
+// DeriveKey derives the AES key for an activation bundle from the license
+// key, hardware ID and salt, using the parameters encoded in the salt or
+// LegacyKDFParams when it has none
+func DeriveKey(licenseKey, hardwareID, salt string) ([]byte, error) {
+	raw, params, err := ParseSalt(salt)
+	if err != nil {
+		return nil, err
+	}
+	return DeriveKeyWithParams(licenseKey, hardwareID, raw, params), nil
+}
+
+// DeriveKeyWithParams derives a bundle key as
+// Argon2id(licenseKey + ":" + hardwareID, salt, params). salt is hex encoded;
+// legacy salts that aren't hex are used as raw bytes.
+func DeriveKeyWithParams(licenseKey, hardwareID, salt string, params KDFParams) []byte {
+	saltBytes, _ := hex.DecodeString(salt)
+	if len(saltBytes) == 0 {
+		saltBytes = []byte(salt)
+	}
+	return argon2.IDKey([]byte(licenseKey+":"+hardwareID), saltBytes, params.Time, params.Memory, params.Threads, KeyLength)
+}
@@ -0,0 +1,104 @@
+package crypto
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// testKDFParams are cheap settings for tests that don't care about strength
+var testKDFParams = KDFParams{Time: 1, Memory: 64, Threads: 1}
+
+func TestSaltRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		salt    string
+		params  KDFParams
+		encoded string
+	}{
+		{"legacy params keep the bare salt", "00ff", LegacyKDFParams, "00ff"},
+		{"other params get a prefix", "00ff", KDFParams{Time: 1, Memory: 19456, Threads: 1}, "argon2id$t=1,m=19456,p=1$00ff"},
+		{"upper bounds", "00ff", KDFParams{Time: MaxKDFTime, Memory: MaxKDFMemory, Threads: 255}, "argon2id$t=10,m=1048576,p=255$00ff"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := EncodeSalt(tt.salt, tt.params)
+			if encoded != tt.encoded {
+				t.Fatalf("EncodeSalt = %q, want %q", encoded, tt.encoded)
+			}
+			salt, params, err := ParseSalt(encoded)
+			if err != nil {
+				t.Fatalf("ParseSalt: %v", err)
+			}
+			if salt != tt.salt || params != tt.params {
+				t.Fatalf("ParseSalt = %q, %+v, want %q, %+v", salt, params, tt.salt, tt.params)
+			}
+		})
+	}
+}
+
+func TestParseSaltRejectsBadParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+		want    string
+	}{
+		{"missing salt", "argon2id$t=1,m=64,p=1$", "missing salt"},
+		{"malformed", "argon2id$t=one,m=64,p=1$00ff", "invalid salt parameters"},
+		{"zero time", "argon2id$t=0,m=64,p=1$00ff", "at least 1"},
+		{"time over bound", "argon2id$t=11,m=64,p=1$00ff", "time must be at most 10"},
+		{"memory below threads", "argon2id$t=1,m=8,p=2$00ff", "at least 8 KiB per thread"},
+		{"memory over bound", "argon2id$t=1,m=1048577,p=1$00ff", "memory must be at most 1048576 KiB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := ParseSalt(tt.encoded)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseSalt(%q) error = %v, want one containing %q", tt.encoded, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveKeyUsesSaltParams(t *testing.T) {
+	encoded := EncodeSalt("00ff", testKDFParams)
+	key, err := DeriveKey("LIC-1", "hw-1", encoded)
+	if err != nil {
+		t.Fatalf("DeriveKey: %v", err)
+	}
+	if len(key) != KeyLength {
+		t.Fatalf("key length = %d, want %d", len(key), KeyLength)
+	}
+	if want := DeriveKeyWithParams("LIC-1", "hw-1", "00ff", testKDFParams); !bytes.Equal(key, want) {
+		t.Fatal("DeriveKey doesn't match DeriveKeyWithParams with the encoded params")
+	}
+	again, _ := DeriveKey("LIC-1", "hw-1", encoded)
+	if !bytes.Equal(key, again) {
+		t.Fatal("DeriveKey isn't deterministic")
+	}
+}
+
+func TestDeriveKeyDiffersByInput(t *testing.T) {
+	base := DeriveKeyWithParams("LIC-1", "hw-1", "00ff", testKDFParams)
+	tests := []struct {
+		name                 string
+		licenseKey, hardware string
+		salt                 string
+		params               KDFParams
+	}{
+		{"time", "LIC-1", "hw-1", "00ff", KDFParams{Time: 2, Memory: 64, Threads: 1}},
+		{"memory", "LIC-1", "hw-1", "00ff", KDFParams{Time: 1, Memory: 128, Threads: 1}},
+		{"threads", "LIC-1", "hw-1", "00ff", KDFParams{Time: 1, Memory: 64, Threads: 2}},
+		{"salt", "LIC-1", "hw-1", "00fe", testKDFParams},
+		{"license key", "LIC-2", "hw-1", "00ff", testKDFParams},
+		{"hardware ID", "LIC-1", "hw-2", "00ff", testKDFParams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := DeriveKeyWithParams(tt.licenseKey, tt.hardware, tt.salt, tt.params)
+			if bytes.Equal(key, base) {
+				t.Fatal("different input derived the same key")
+			}
+		})
+	}
+}
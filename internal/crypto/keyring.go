@@ -0,0 +1,164 @@
+package crypto
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Keyring is the server's Ed25519 signing key plus the public keys it signed
+// with before, so keys can be rotated without invalidating old signatures
+type Keyring struct {
+	Primary ed25519.PrivateKey
+	Retired []RetiredKey // oldest first
+}
+
+// RetiredKey is a public key that no longer signs but still verifies
+type RetiredKey struct {
+	PublicKey ed25519.PublicKey
+	RetiredAt time.Time
+}
+
+// keyringFile is the JSON form of a Keyring, with base64 keys
+type keyringFile struct {
+	PrivateKey string           `json:"private_key"`
+	Retired    []retiredKeyFile `json:"retired,omitempty"`
+}
+
+type retiredKeyFile struct {
+	PublicKey string    `json:"public_key"`
+	RetiredAt time.Time `json:"retired_at"`
+}
+
+// NewKeyring returns a keyring with a freshly generated primary key
+func NewKeyring() (*Keyring, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	return &Keyring{Primary: priv}, nil
+}
+
+// LoadKeyring reads a keyring file. A missing or malformed file is an error:
+// replacing the key would invalidate every signature made with it.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid keyring %s: %w", path, err)
+	}
+
+	priv, err := base64.StdEncoding.DecodeString(file.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keyring %s: private key is not valid base64: %w", path, err)
+	}
+	if len(priv) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid keyring %s: private key has length %d, want %d bytes", path, len(priv), ed25519.PrivateKeySize)
+	}
+
+	keyring := &Keyring{Primary: ed25519.PrivateKey(priv)}
+	for i, r := range file.Retired {
+		pub, err := ParsePublicKey(r.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keyring %s: retired key %d: %w", path, i+1, err)
+		}
+		keyring.Retired = append(keyring.Retired, RetiredKey{PublicKey: pub, RetiredAt: r.RetiredAt})
+	}
+	return keyring, nil
+}
+
+// Save writes the keyring to path with mode 0600, replacing any existing
+// file only once the new one is fully written
+func (k *Keyring) Save(path string) error {
+	file := keyringFile{PrivateKey: base64.StdEncoding.EncodeToString(k.Primary)}
+	for _, r := range k.Retired {
+		file.Retired = append(file.Retired, retiredKeyFile{
+			PublicKey: base64.StdEncoding.EncodeToString(r.PublicKey),
+			RetiredAt: r.RetiredAt.UTC(),
+		})
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if err := tmp.Chmod(0600); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
+
+// PublicKey returns the primary key's public half
+func (k *Keyring) PublicKey() ed25519.PublicKey {
+	return k.Primary.Public().(ed25519.PublicKey)
+}
+
+// PublicKeys returns every key that verifies, primary first, then retired
+// keys newest first
+func (k *Keyring) PublicKeys() []ed25519.PublicKey {
+	keys := []ed25519.PublicKey{k.PublicKey()}
+	for i := len(k.Retired) - 1; i >= 0; i-- {
+		keys = append(keys, k.Retired[i].PublicKey)
+	}
+	return keys
+}
+
+// RotateKey replaces the primary key of the keyring at path with a new one
+// and retires the old public key, which keeps verifying. The keyring must
+// already exist.
+func RotateKey(path string) (*Keyring, error) {
+	keyring, err := LoadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	next, err := NewKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	keyring.Retired = append(keyring.Retired, RetiredKey{PublicKey: keyring.PublicKey(), RetiredAt: time.Now().UTC()})
+	keyring.Primary = next.Primary
+	if err := keyring.Save(path); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+// VerifyAny runs verify, e.g. a closure around VerifyReceipt, with each key
+// in turn and succeeds if any key does. Errors other than ErrInvalidSignature
+// mean the input itself is bad and are returned straight away.
+func VerifyAny(keys []ed25519.PublicKey, verify func(ed25519.PublicKey) error) error {
+	err := ErrInvalidSignature
+	for _, key := range keys {
+		err = verify(key)
+		if err == nil || !errors.Is(err, ErrInvalidSignature) {
+			return err
+		}
+	}
+	return err
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Activation is a device activated for a license
+type Activation struct {
+	HardwareID  string
+	ActivatedAt time.Time
+	LastCheckIn time.Time // zero if the device never checked in
+}
+
+// ListActivations calls ListActivationsContext with context.Background()
+func (db *DB) ListActivations(licenseID string) ([]Activation, error) {
+	return db.ListActivationsContext(context.Background(), licenseID)
+}
+
+// ListActivationsContext returns a license's activated devices, oldest first
+func (db *DB) ListActivationsContext(ctx context.Context, licenseID string) ([]Activation, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT hardware_id, activated_at, last_check_in FROM activations
+		WHERE license_id = %s ORDER BY activated_at, hardware_id`, db.placeholder(1)), licenseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load activations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var activations []Activation
+	for rows.Next() {
+		var a Activation
+		var activatedAt, lastCheckIn sql.NullString
+		if err := rows.Scan(&a.HardwareID, &activatedAt, &lastCheckIn); err != nil {
+			return nil, fmt.Errorf("failed to load activations: %w", err)
+		}
+		if activatedAt.Valid {
+			a.ActivatedAt, _ = ParseTime(activatedAt.String)
+		}
+		if lastCheckIn.Valid {
+			a.LastCheckIn, _ = ParseTime(lastCheckIn.String)
+		}
+		activations = append(activations, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load activations: %w", err)
+	}
+	return activations, nil
+}
+
+// ErrMaxActivations is returned by ActivateDevice when every seat of the
+// license is taken
+var ErrMaxActivations = errors.New("maximum activations reached")
+
+// ActivateDevice calls ActivateDeviceContext with context.Background()
+func (db *DB) ActivateDevice(licenseID, hardwareID string, maxActivations int) (bool, error) {
+	return db.ActivateDeviceContext(context.Background(), licenseID, hardwareID, maxActivations)
+}
+
+// ActivateDeviceContext activates a device for a license unless that would
+// take it past maxActivations (-1 for unlimited), in which case it returns
+// ErrMaxActivations. It reports false if the device was already activated,
+// which always succeeds so existing devices keep working when seats are
+// reduced. The seat check and the insert are atomic: on PostgreSQL the
+// license row is locked for the transaction, and on SQLite the insert is a
+// single statement, which holds the write lock while it counts.
+func (db *DB) ActivateDeviceContext(ctx context.Context, licenseID, hardwareID string, maxActivations int) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if db.postgres {
+		var id string
+		err := tx.QueryRowContext(ctx, "SELECT license_id FROM licenses WHERE license_id = $1 FOR UPDATE", licenseID).Scan(&id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, ErrLicenseNotFound
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to lock license: %w", err)
+		}
+	}
+
+	// The first statement writes, so SQLite never has to upgrade a read
+	// lock, which fails rather than waits under contention
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO activations (license_id, hardware_id)
+		SELECT %s, %s WHERE NOT EXISTS (SELECT 1 FROM activations WHERE license_id = %s AND hardware_id = %s)
+		AND (%s = -1 OR (SELECT COUNT(*) FROM activations WHERE license_id = %s) < %s)`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5), db.placeholder(6), db.placeholder(7)),
+		licenseID, hardwareID, licenseID, hardwareID, maxActivations, licenseID, maxActivations)
+	if err != nil {
+		return false, fmt.Errorf("failed to record activation: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return false, fmt.Errorf("failed to record activation: %w", err)
+	} else if rows > 0 {
+		if err := tx.Commit(); err != nil {
+			return false, fmt.Errorf("failed to record activation: %w", err)
+		}
+		return true, nil
+	}
+
+	// Nothing was inserted: either the device is already activated or the
+	// license is full
+	var existing int
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s AND hardware_id = %s",
+		db.placeholder(1), db.placeholder(2)), licenseID, hardwareID).Scan(&existing); err != nil {
+		return false, fmt.Errorf("failed to check activation: %w", err)
+	}
+	if existing == 0 {
+		return false, fmt.Errorf("%w (%d)", ErrMaxActivations, maxActivations)
+	}
+	return false, nil
+}
+
+// DeleteActivations calls DeleteActivationsContext with context.Background()
+func (db *DB) DeleteActivations(licenseID, hardwareID string) (int, error) {
+	return db.DeleteActivationsContext(context.Background(), licenseID, hardwareID)
+}
+
+// DeleteActivationsContext removes one device's activation, or every activation of
+// the license when hardwareID is empty, together with the proxy keys issued
+// to those devices. It returns the number of activations removed.
+func (db *DB) DeleteActivationsContext(ctx context.Context, licenseID, hardwareID string) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	where := fmt.Sprintf("license_id = %s", db.placeholder(1))
+	args := []interface{}{licenseID}
+	if hardwareID != "" {
+		where += fmt.Sprintf(" AND hardware_id = %s", db.placeholder(2))
+		args = append(args, hardwareID)
+	}
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM activations WHERE "+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete activations: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM proxy_keys WHERE "+where, args...); err != nil {
+		return 0, fmt.Errorf("failed to delete proxy keys: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to delete activations: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
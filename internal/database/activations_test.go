@@ -0,0 +1,131 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestActivateDeviceConcurrently(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		const seats, devices = 3, 20
+		createLicense(t, db, "LIC-CONCURRENT", seats)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var activated, full int
+		start := make(chan struct{})
+		for i := 0; i < devices; i++ {
+			wg.Add(1)
+			go func(hardwareID string) {
+				defer wg.Done()
+				<-start
+				created, err := db.ActivateDevice("LIC-CONCURRENT", hardwareID, seats)
+				mu.Lock()
+				defer mu.Unlock()
+				switch {
+				case errors.Is(err, ErrMaxActivations):
+					full++
+				case err != nil:
+					t.Errorf("activate %s: %v", hardwareID, err)
+				case created:
+					activated++
+				}
+			}(fmt.Sprintf("hw-%02d", i))
+		}
+		close(start)
+		wg.Wait()
+
+		if activated != seats || full != devices-seats {
+			t.Fatalf("activated %d and refused %d devices, want %d and %d", activated, full, seats, devices-seats)
+		}
+		activations, err := db.ListActivations("LIC-CONCURRENT")
+		if err != nil {
+			t.Fatalf("ListActivations: %v", err)
+		}
+		if len(activations) != seats {
+			t.Fatalf("license has %d activations, want %d", len(activations), seats)
+		}
+	})
+}
+
+func TestActivateDeviceAgainWhenFull(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-FULL", 1)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		if _, err := db.ActivateDevice("LIC-FULL", "hw-1", 1); err != nil {
+			t.Fatalf("first activation: %v", err)
+		}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				created, err := db.ActivateDevice("LIC-FULL", "hw-1", 1)
+				if err == nil && created {
+					err = errors.New("device activated twice")
+				}
+				errs <- err
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Errorf("reactivating the same device: %v", err)
+			}
+		}
+		if _, err := db.ActivateDevice("LIC-FULL", "hw-2", 1); !errors.Is(err, ErrMaxActivations) {
+			t.Fatalf("second device: error = %v, want ErrMaxActivations", err)
+		}
+	})
+}
+
+func TestDeleteActivations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-DELETE", 3)
+		for _, hardwareID := range []string{"hw-1", "hw-2", "hw-3"} {
+			if _, err := db.ActivateDevice("LIC-DELETE", hardwareID, 3); err != nil {
+				t.Fatalf("activate %s: %v", hardwareID, err)
+			}
+			_, err := db.Exec(fmt.Sprintf("INSERT INTO proxy_keys (proxy_key, license_id, hardware_id) VALUES (%s, %s, %s)",
+				db.placeholder(1), db.placeholder(2), db.placeholder(3)), "px_"+hardwareID, "LIC-DELETE", hardwareID)
+			if err != nil {
+				t.Fatalf("insert proxy key: %v", err)
+			}
+		}
+		proxyKeys := func() int {
+			t.Helper()
+			var n int
+			if err := db.QueryRow("SELECT COUNT(*) FROM proxy_keys").Scan(&n); err != nil {
+				t.Fatalf("count proxy keys: %v", err)
+			}
+			return n
+		}
+
+		if n, err := db.DeleteActivations("LIC-DELETE", "hw-1"); err != nil || n != 1 {
+			t.Fatalf("delete one device = %d, %v; want 1", n, err)
+		}
+		if n := proxyKeys(); n != 2 {
+			t.Fatalf("%d proxy keys left after deleting one device, want 2", n)
+		}
+		if n, err := db.DeleteActivations("LIC-DELETE", "hw-1"); err != nil || n != 0 {
+			t.Fatalf("delete a device again = %d, %v; want 0", n, err)
+		}
+		if n, err := db.DeleteActivations("LIC-OTHER", "hw-2"); err != nil || n != 0 {
+			t.Fatalf("delete another license's device = %d, %v; want 0", n, err)
+		}
+
+		if n, err := db.DeleteActivations("LIC-DELETE", ""); err != nil || n != 2 {
+			t.Fatalf("delete every device = %d, %v; want 2", n, err)
+		}
+		if activations, err := db.ListActivations("LIC-DELETE"); err != nil || len(activations) != 0 {
+			t.Fatalf("ListActivations = %v, %v; want none", activations, err)
+		}
+		if n := proxyKeys(); n != 0 {
+			t.Fatalf("%d proxy keys left after deleting every device, want 0", n)
+		}
+	})
+}
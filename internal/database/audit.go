@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntry is one admin action recorded in the audit log
+type AuditEntry struct {
+	ID            int64
+	Action        string
+	TargetLicense string // empty for actions not tied to one license
+	Actor         string
+	Details       json.RawMessage // the command's parameters as a JSON object
+	CreatedAt     time.Time
+}
+
+// AuditFilter narrows ListAudit; zero values match everything
+type AuditFilter struct {
+	LicenseID string
+	Limit     int
+}
+
+// RecordAudit calls RecordAuditContext with context.Background()
+func (db *DB) RecordAudit(entry AuditEntry) error {
+	return db.RecordAuditContext(context.Background(), entry)
+}
+
+// RecordAuditContext appends an entry to the audit log. ID is assigned by
+// the database and a zero CreatedAt means now.
+func (db *DB) RecordAuditContext(ctx context.Context, entry AuditEntry) error {
+	if entry.Action == "" {
+		return fmt.Errorf("audit entry has no action")
+	}
+	details := "{}"
+	if len(entry.Details) > 0 {
+		details = string(entry.Details)
+	}
+	createdAt := entry.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO audit_log (action, target_license, actor, details, created_at)
+		VALUES (%s, %s, %s, %s, %s)`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5)),
+		entry.Action, entry.TargetLicense, entry.Actor, details, createdAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// ListAudit calls ListAuditContext with context.Background()
+func (db *DB) ListAudit(filter AuditFilter) ([]AuditEntry, error) {
+	return db.ListAuditContext(context.Background(), filter)
+}
+
+// ListAuditContext returns audit entries matching the filter, newest first
+func (db *DB) ListAuditContext(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	query := "SELECT id, action, target_license, actor, details, created_at FROM audit_log"
+	var args []interface{}
+	if filter.LicenseID != "" {
+		args = append(args, filter.LicenseID)
+		query += fmt.Sprintf(" WHERE target_license = %s", db.placeholder(len(args)))
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT %s", db.placeholder(len(args)))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load audit log: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var e AuditEntry
+		var details, createdAt string
+		if err := rows.Scan(&e.ID, &e.Action, &e.TargetLicense, &e.Actor, &details, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to load audit log: %w", err)
+		}
+		if details != "" {
+			e.Details = json.RawMessage(details)
+		}
+		if e.CreatedAt, err = ParseTime(createdAt); err != nil {
+			return nil, fmt.Errorf("audit entry %d: invalid created_at: %w", e.ID, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load audit log: %w", err)
+	}
+	return entries, nil
+}
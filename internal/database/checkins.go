@@ -0,0 +1,106 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GetLastCheckIn calls GetLastCheckInContext with context.Background()
+func (db *DB) GetLastCheckIn(licenseID string) (time.Time, error) {
+	return db.GetLastCheckInContext(context.Background(), licenseID)
+}
+
+// GetLastCheckInContext returns when a license last checked in through
+// /activate or a usage report, or the zero time if it never has
+func (db *DB) GetLastCheckInContext(ctx context.Context, licenseID string) (time.Time, error) {
+	var lastCheckIn sql.NullString
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT last_check_in FROM check_ins WHERE license_id = %s",
+		db.placeholder(1)), licenseID).Scan(&lastCheckIn)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !lastCheckIn.Valid) {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load check-in: %w", err)
+	}
+	t, err := ParseTime(lastCheckIn.String)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("license %s: invalid last_check_in: %w", licenseID, err)
+	}
+	return t, nil
+}
+
+// StaleLicense is an active license that hasn't checked in recently
+type StaleLicense struct {
+	License
+	LastCheckIn time.Time // zero if the license never checked in
+	Activations int
+}
+
+// GetStaleLicenses calls GetStaleLicensesContext with context.Background()
+func (db *DB) GetStaleLicenses(since time.Duration) ([]StaleLicense, error) {
+	return db.GetStaleLicensesContext(context.Background(), since)
+}
+
+// GetStaleLicensesContext returns the active licenses that last checked in
+// more than since ago, least recently seen first. Licenses that never
+// checked in count once they are older than since.
+func (db *DB) GetStaleLicensesContext(ctx context.Context, since time.Duration) ([]StaleLicense, error) {
+	cutoff := time.Now().Add(-since).UTC()
+	// check_ins is only written with CURRENT_TIMESTAMP, which SQLite stores
+	// as text in this layout, so the comparison can stay in SQL
+	var cutoffArg interface{} = cutoff
+	if !db.postgres {
+		cutoffArg = cutoff.Format("2006-01-02 15:04:05")
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT l.license_id, l.customer_name, l.customer_email, l.tier, l.expires_at,
+		l.daily_limit, l.monthly_limit, l.max_activations, l.active, l.created_at, c.last_check_in,
+		(SELECT COUNT(*) FROM activations a WHERE a.license_id = l.license_id)
+		FROM licenses l LEFT JOIN check_ins c ON c.license_id = l.license_id
+		WHERE l.active = true AND (c.last_check_in IS NULL OR c.last_check_in < %s)`, db.placeholder(1)), cutoffArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list stale licenses: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var stale []StaleLicense
+	for rows.Next() {
+		var s StaleLicense
+		var expiresAt string
+		var createdAt, lastCheckIn sql.NullString
+		if err := rows.Scan(&s.LicenseID, &s.CustomerName, &s.CustomerEmail, &s.Tier, &expiresAt,
+			&s.DailyLimit, &s.MonthlyLimit, &s.MaxActivations, &s.Active, &createdAt, &lastCheckIn, &s.Activations); err != nil {
+			return nil, fmt.Errorf("failed to read license: %w", err)
+		}
+		if s.ExpiresAt, err = ParseTime(expiresAt); err != nil {
+			return nil, fmt.Errorf("license %s: invalid expires_at: %w", s.LicenseID, err)
+		}
+		if createdAt.Valid {
+			s.CreatedAt, _ = ParseTime(createdAt.String)
+		}
+		if lastCheckIn.Valid {
+			s.LastCheckIn, _ = ParseTime(lastCheckIn.String)
+		}
+		// created_at is stored in several layouts, so new licenses are
+		// filtered here rather than in SQL
+		if s.LastCheckIn.IsZero() && s.CreatedAt.After(cutoff) {
+			continue
+		}
+		stale = append(stale, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list stale licenses: %w", err)
+	}
+
+	sort.SliceStable(stale, func(i, j int) bool {
+		if !stale[i].LastCheckIn.Equal(stale[j].LastCheckIn) {
+			return stale[i].LastCheckIn.Before(stale[j].LastCheckIn)
+		}
+		return stale[i].LicenseID < stale[j].LicenseID
+	})
+	return stale, nil
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// checkIn records that licenseID checked in at, in the layout the server's
+// CURRENT_TIMESTAMP writes use
+func checkIn(t *testing.T, db *DB, licenseID string, at time.Time) {
+	t.Helper()
+	var arg interface{} = at.UTC()
+	if !db.postgres {
+		arg = at.UTC().Format("2006-01-02 15:04:05")
+	}
+	if _, err := db.Exec(db.rebind(`INSERT INTO check_ins (license_id, last_check_in) VALUES (?, ?)`), licenseID, arg); err != nil {
+		t.Fatalf("insert check-in: %v", err)
+	}
+}
+
+func TestGetStaleLicenses(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		const since = 30 * 24 * time.Hour
+		now := time.Now()
+		// A couple of seconds either side of the threshold, since check-ins
+		// are stored to the second
+		checkIns := map[string]time.Time{
+			"LIC-JUST-STALE": now.Add(-since - 2*time.Second),
+			"LIC-JUST-FRESH": now.Add(-since + 2*time.Second),
+			"LIC-LONG-GONE":  now.Add(-3 * since),
+			"LIC-RECENT":     now.Add(-time.Hour),
+			"LIC-INACTIVE":   now.Add(-3 * since),
+		}
+		for id, at := range checkIns {
+			createLicense(t, db, id, 2)
+			checkIn(t, db, id, at)
+		}
+		setExpiry(t, db, "LIC-INACTIVE", now.AddDate(1, 0, 0), false)
+		if _, err := db.ActivateDevice("LIC-LONG-GONE", "hw-1", 2); err != nil {
+			t.Fatal(err)
+		}
+
+		// Licenses that never checked in are stale once they're older than
+		// the threshold
+		createLicense(t, db, "LIC-NEVER-OLD", 1)
+		createLicense(t, db, "LIC-NEVER-NEW", 1)
+		if _, err := db.Exec(db.rebind(`UPDATE licenses SET created_at = ? WHERE license_id = ?`),
+			db.timeArg(now.Add(-since-time.Hour)), "LIC-NEVER-OLD"); err != nil {
+			t.Fatal(err)
+		}
+
+		stale, err := db.GetStaleLicenses(since)
+		if err != nil {
+			t.Fatalf("GetStaleLicenses: %v", err)
+		}
+		var got []string
+		for _, s := range stale {
+			got = append(got, fmt.Sprintf("%s/%d", s.LicenseID, s.Activations))
+		}
+		// Least recently seen first, never-seen before everything
+		want := []string{"LIC-NEVER-OLD/0", "LIC-LONG-GONE/1", "LIC-JUST-STALE/0"}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("stale = %v, want %v", got, want)
+		}
+		if !stale[0].LastCheckIn.IsZero() {
+			t.Fatalf("never-seen license has LastCheckIn %v", stale[0].LastCheckIn)
+		}
+		if diff := stale[2].LastCheckIn.Sub(checkIns["LIC-JUST-STALE"]); diff < -time.Second || diff > time.Second {
+			t.Fatalf("LastCheckIn = %v, want %v", stale[2].LastCheckIn, checkIns["LIC-JUST-STALE"])
+		}
+	})
+}
+
+func TestGetLastCheckIn(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-SEEN", 1)
+		last, err := db.GetLastCheckIn("LIC-SEEN")
+		if err != nil || !last.IsZero() {
+			t.Fatalf("before any check-in = %v, %v, want the zero time", last, err)
+		}
+
+		at := time.Now().Add(-time.Hour).Truncate(time.Second)
+		checkIn(t, db, "LIC-SEEN", at)
+		last, err = db.GetLastCheckIn("LIC-SEEN")
+		if err != nil || !last.Equal(at) {
+			t.Fatalf("GetLastCheckIn = %v, %v, want %v", last, err, at)
+		}
+	})
+}
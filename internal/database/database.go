@@ -0,0 +1,126 @@
+// Package database provides the license queries shared by the server and
+// licensify-admin on top of SQLite or PostgreSQL. Every query method has a
+// ...Context variant that is canceled with its context; the plain method
+// uses context.Background().
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DB wraps a database connection together with the SQL dialect it speaks
+type DB struct {
+	*sql.DB
+	postgres bool
+
+	stmtMu sync.Mutex
+	stmts  map[string]*sql.Stmt // prepared statements by query as written
+}
+
+// New wraps an open connection. postgres selects PostgreSQL placeholders
+// and syntax; otherwise SQLite is assumed.
+func New(conn *sql.DB, postgres bool) *DB {
+	return &DB{DB: conn, postgres: postgres, stmts: make(map[string]*sql.Stmt)}
+}
+
+// Close closes the cached prepared statements and then the connection
+func (db *DB) Close() error {
+	db.stmtMu.Lock()
+	var errs []error
+	for query, stmt := range db.stmts {
+		if err := stmt.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(db.stmts, query)
+	}
+	db.stmtMu.Unlock()
+	return errors.Join(append(errs, db.DB.Close())...)
+}
+
+// prepare returns the prepared statement for query, preparing it on first
+// use. query is written with ? placeholders, which are rewritten for the
+// dialect once rather than on every call. Used on hot paths; statements
+// live until Close.
+func (db *DB) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	db.stmtMu.Lock()
+	stmt, ok := db.stmts[query]
+	db.stmtMu.Unlock()
+	if ok {
+		return stmt, nil
+	}
+
+	// Prepare without holding the lock so a slow prepare doesn't block
+	// other queries; if two callers race, the loser's statement is closed
+	stmt, err := db.PrepareContext(ctx, db.rebind(query))
+	if err != nil {
+		return nil, err
+	}
+	db.stmtMu.Lock()
+	defer db.stmtMu.Unlock()
+	if existing, ok := db.stmts[query]; ok {
+		_ = stmt.Close()
+		return existing, nil
+	}
+	db.stmts[query] = stmt
+	return stmt, nil
+}
+
+// rebind rewrites the ? placeholders in query as $1, $2, ... for PostgreSQL
+func (db *DB) rebind(query string) string {
+	if !db.postgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// IsPostgres reports whether the connection is to PostgreSQL
+func (db *DB) IsPostgres() bool {
+	return db.postgres
+}
+
+// placeholder returns the nth bind parameter for the dialect
+func (db *DB) placeholder(n int) string {
+	if db.postgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+// timeLayouts are the formats timestamps come back in: PostgreSQL TIMESTAMP
+// columns scanned into a string, and the various ways SQLite TEXT columns
+// have been written by the server, the admin CLI and CURRENT_TIMESTAMP.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parses a timestamp column value scanned into a string
+func ParseTime(value string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", value)
+}
@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+
+	"github.com/melihbirim/licensify/internal/database/migrations"
+)
+
+// postgresURLEnv names the variable holding a PostgreSQL connection URL
+// for the tests; without it they only run against SQLite
+const postgresURLEnv = "LICENSIFY_TEST_POSTGRES_URL"
+
+// forEachBackend runs fn as a subtest against a migrated SQLite database
+// and, when LICENSIFY_TEST_POSTGRES_URL is set, a migrated PostgreSQL
+// schema of its own
+func forEachBackend(t *testing.T, fn func(t *testing.T, db *DB)) {
+	t.Helper()
+	t.Run("sqlite", func(t *testing.T) {
+		fn(t, openSQLite(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		url := os.Getenv(postgresURLEnv)
+		if url == "" {
+			t.Skipf("%s not set", postgresURLEnv)
+		}
+		fn(t, openPostgres(t, url))
+	})
+}
+
+// openSQLite returns a migrated SQLite database in a temporary file. A file
+// rather than :memory: so every pooled connection sees the same database.
+func openSQLite(t testing.TB) *DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "licensify.db")
+	conn, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	return migrate(t, conn, false)
+}
+
+// openPostgres returns a migrated PostgreSQL database in a new schema that
+// is dropped when the test ends
+func openPostgres(t *testing.T, url string) *DB {
+	t.Helper()
+	admin, err := sql.Open("postgres", url)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+
+	schema := fmt.Sprintf("licensify_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	separator := "?"
+	if strings.Contains(url, "?") {
+		separator = "&"
+	}
+	conn, err := sql.Open("postgres", url+separator+"search_path="+schema)
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	return migrate(t, conn, true)
+}
+
+func migrate(t testing.TB, conn *sql.DB, postgres bool) *DB {
+	t.Helper()
+	db := New(conn, postgres)
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := migrations.Migrate(conn, postgres); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// createLicense inserts a license with the given seats that expires in a year
+func createLicense(t testing.TB, db *DB, licenseID string, maxActivations int) {
+	t.Helper()
+	p := db.placeholder
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO licenses (license_id, customer_name, customer_email, tier, expires_at,
+		daily_limit, monthly_limit, max_activations) VALUES (%s, %s, %s, %s, %s, %s, %s, %s)`,
+		p(1), p(2), p(3), p(4), p(5), p(6), p(7), p(8)),
+		licenseID, "Test Customer", "test@example.com", "free", db.timeArg(time.Now().AddDate(1, 0, 0)), 100, 1000, maxActivations)
+	if err != nil {
+		t.Fatalf("create license: %v", err)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-CANCEL", 1)
+		canceled, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := db.GetLicenseContext(canceled, "LIC-CANCEL"); !errors.Is(err, context.Canceled) {
+			t.Errorf("GetLicenseContext error = %v, want context.Canceled", err)
+		}
+		if err := db.RecordUsageContext(canceled, "LIC-CANCEL", "2026-01-01", "hw-1", 1); !errors.Is(err, context.Canceled) {
+			t.Errorf("RecordUsageContext error = %v, want context.Canceled", err)
+		}
+		if _, err := db.ActivateDeviceContext(canceled, "LIC-CANCEL", "hw-1", 1); !errors.Is(err, context.Canceled) {
+			t.Errorf("ActivateDeviceContext error = %v, want context.Canceled", err)
+		}
+		if usage, err := db.GetUsageRange("LIC-CANCEL", "2026-01-01", "2026-01-31"); err != nil || len(usage) != 0 {
+			t.Errorf("canceled RecordUsageContext wrote %v, %v", usage, err)
+		}
+	})
+}
+
+func TestContextInterruptsSlowQuery(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		// Counts to a billion, which takes far longer than the timeout
+		start := time.Now()
+		var n int64
+		err := db.QueryRowContext(ctx, `WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000)
+			SELECT count(*) FROM c`).Scan(&n)
+		if err == nil {
+			t.Fatalf("query finished with %d despite the timeout", n)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Fatalf("query returned after %v, want promptly after the 50ms timeout", elapsed)
+		}
+		if ctx.Err() == nil {
+			t.Fatalf("query failed before the timeout: %v", err)
+		}
+	})
+}
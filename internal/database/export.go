@@ -0,0 +1,273 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportedLicense is a license with everything needed to restore it into
+// another database, including the salt existing activations were derived with
+type ExportedLicense struct {
+	LicenseID            string               `json:"license_id"`
+	CustomerName         string               `json:"customer_name"`
+	CustomerEmail        string               `json:"customer_email"`
+	Tier                 string               `json:"tier"`
+	ExpiresAt            time.Time            `json:"expires_at"`
+	CreatedAt            time.Time            `json:"created_at"`
+	DailyLimit           int                  `json:"daily_limit"`
+	MonthlyLimit         int                  `json:"monthly_limit"`
+	MaxActivations       int                  `json:"max_activations"`
+	Active               bool                 `json:"active"`
+	EncryptionSalt       string               `json:"encryption_salt,omitempty"`
+	PreviousDailyLimit   *int                 `json:"previous_daily_limit,omitempty"`
+	PreviousMonthlyLimit *int                 `json:"previous_monthly_limit,omitempty"`
+	LimitsChangedOn      string               `json:"limits_changed_on,omitempty"` // YYYY-MM-DD
+	Products             []string             `json:"products,omitempty"`
+	Activations          []ExportedActivation `json:"activations,omitempty"`
+	Usage                []ExportedUsage      `json:"usage,omitempty"`
+}
+
+// ExportedActivation is an activated device of an ExportedLicense
+type ExportedActivation struct {
+	HardwareID  string    `json:"hardware_id"`
+	ActivatedAt time.Time `json:"activated_at"`
+	LastCheckIn time.Time `json:"last_check_in"`
+}
+
+// ExportedUsage is a day of usage of an ExportedLicense
+type ExportedUsage struct {
+	Date       string `json:"date"` // YYYY-MM-DD
+	HardwareID string `json:"hardware_id,omitempty"`
+	Scans      int    `json:"scans"`
+}
+
+// ExportOptions selects what ExportLicenses includes besides the licenses
+type ExportOptions struct {
+	Activations bool
+	Usage       bool
+}
+
+// ExportLicenses calls ExportLicensesContext with context.Background()
+func (db *DB) ExportLicenses(opts ExportOptions, fn func(*ExportedLicense) error) error {
+	return db.ExportLicensesContext(context.Background(), opts, fn)
+}
+
+// ExportLicensesContext calls fn for every license, oldest first, reading one row
+// at a time so large databases are never held in memory
+func (db *DB) ExportLicensesContext(ctx context.Context, opts ExportOptions, fn func(*ExportedLicense) error) error {
+	rows, err := db.QueryContext(ctx, `SELECT license_id, customer_name, customer_email, tier, expires_at, created_at,
+		daily_limit, monthly_limit, max_activations, active, encryption_salt,
+		previous_daily_limit, previous_monthly_limit, limits_changed_on
+		FROM licenses ORDER BY created_at, license_id`)
+	if err != nil {
+		return fmt.Errorf("failed to export licenses: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var l ExportedLicense
+		var expiresAt string
+		var createdAt, salt, changedOn sql.NullString
+		var prevDaily, prevMonthly sql.NullInt64
+		if err := rows.Scan(&l.LicenseID, &l.CustomerName, &l.CustomerEmail, &l.Tier, &expiresAt, &createdAt,
+			&l.DailyLimit, &l.MonthlyLimit, &l.MaxActivations, &l.Active, &salt,
+			&prevDaily, &prevMonthly, &changedOn); err != nil {
+			return fmt.Errorf("failed to read license: %w", err)
+		}
+		if l.ExpiresAt, err = ParseTime(expiresAt); err != nil {
+			return fmt.Errorf("license %s: invalid expires_at: %w", l.LicenseID, err)
+		}
+		if createdAt.Valid {
+			l.CreatedAt, _ = ParseTime(createdAt.String)
+		}
+		l.EncryptionSalt = salt.String
+		if prevDaily.Valid {
+			v := int(prevDaily.Int64)
+			l.PreviousDailyLimit = &v
+		}
+		if prevMonthly.Valid {
+			v := int(prevMonthly.Int64)
+			l.PreviousMonthlyLimit = &v
+		}
+		if changedOn.Valid && changedOn.String != "" {
+			if t, err := ParseTime(changedOn.String); err == nil {
+				l.LimitsChangedOn = t.Format("2006-01-02")
+			}
+		}
+
+		if l.Products, err = db.GetLicenseProductsContext(ctx, l.LicenseID); err != nil {
+			return err
+		}
+		if opts.Activations {
+			activations, err := db.ListActivationsContext(ctx, l.LicenseID)
+			if err != nil {
+				return err
+			}
+			for _, a := range activations {
+				l.Activations = append(l.Activations, ExportedActivation(a))
+			}
+		}
+		if opts.Usage {
+			if l.Usage, err = db.exportUsage(ctx, l.LicenseID); err != nil {
+				return err
+			}
+		}
+
+		if err := fn(&l); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export licenses: %w", err)
+	}
+	return nil
+}
+
+func (db *DB) exportUsage(ctx context.Context, licenseID string) ([]ExportedUsage, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT date, hardware_id, scans FROM daily_usage WHERE license_id = %s ORDER BY date",
+		db.placeholder(1)), licenseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export usage: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var usage []ExportedUsage
+	for rows.Next() {
+		var u ExportedUsage
+		var date string
+		var hardwareID sql.NullString
+		if err := rows.Scan(&date, &hardwareID, &u.Scans); err != nil {
+			return nil, fmt.Errorf("failed to export usage: %w", err)
+		}
+		// PostgreSQL DATE columns come back as timestamps
+		t, err := ParseTime(date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid usage date: %w", err)
+		}
+		u.Date = t.Format("2006-01-02")
+		u.HardwareID = hardwareID.String
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+// RestoreResult counts what RestoreLicenses did
+type RestoreResult struct {
+	Restored int
+	Skipped  int // already present, with skipExisting
+}
+
+// RestoreLicenses calls RestoreLicensesContext with context.Background()
+func (db *DB) RestoreLicenses(skipExisting bool, next func() (*ExportedLicense, error)) (RestoreResult, error) {
+	return db.RestoreLicensesContext(context.Background(), skipExisting, next)
+}
+
+// RestoreLicensesContext inserts the licenses returned by next, until it returns
+// io.EOF, in a single transaction. Timestamps are kept as exported. A license
+// that already exists fails the whole restore unless skipExisting is set.
+func (db *DB) RestoreLicensesContext(ctx context.Context, skipExisting bool, next func() (*ExportedLicense, error)) (RestoreResult, error) {
+	var result RestoreResult
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for {
+		l, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return RestoreResult{}, err
+		}
+
+		var count int
+		if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM licenses WHERE license_id = %s", db.placeholder(1)),
+			l.LicenseID).Scan(&count); err != nil {
+			return RestoreResult{}, fmt.Errorf("failed to check license %s: %w", l.LicenseID, err)
+		}
+		if count > 0 {
+			if !skipExisting {
+				return RestoreResult{}, fmt.Errorf("license %s already exists", l.LicenseID)
+			}
+			result.Skipped++
+			continue
+		}
+
+		if err := db.restoreLicense(ctx, tx, l); err != nil {
+			return RestoreResult{}, fmt.Errorf("license %s: %w", l.LicenseID, err)
+		}
+		result.Restored++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return RestoreResult{}, fmt.Errorf("failed to commit restore: %w", err)
+	}
+	return result, nil
+}
+
+func (db *DB) restoreLicense(ctx context.Context, tx *sql.Tx, l *ExportedLicense) error {
+	var changedOn interface{}
+	if l.LimitsChangedOn != "" {
+		changedOn = l.LimitsChangedOn
+	}
+	var salt interface{}
+	if l.EncryptionSalt != "" {
+		salt = l.EncryptionSalt
+	}
+	createdAt := l.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	p := db.placeholder
+	_, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO licenses (license_id, customer_name, customer_email, tier, expires_at, created_at,
+		daily_limit, monthly_limit, max_activations, active, encryption_salt,
+		previous_daily_limit, previous_monthly_limit, limits_changed_on)
+		VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s, %s)`,
+		p(1), p(2), p(3), p(4), p(5), p(6), p(7), p(8), p(9), p(10), p(11), p(12), p(13), p(14)),
+		l.LicenseID, l.CustomerName, l.CustomerEmail, l.Tier, db.timeArg(l.ExpiresAt), db.timeArg(createdAt),
+		l.DailyLimit, l.MonthlyLimit, l.MaxActivations, l.Active, salt,
+		l.PreviousDailyLimit, l.PreviousMonthlyLimit, changedOn)
+	if err != nil {
+		return fmt.Errorf("failed to insert license: %w", err)
+	}
+
+	for _, id := range l.Products {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO license_products (license_id, product_id) VALUES (%s, %s)", p(1), p(2)),
+			l.LicenseID, id); err != nil {
+			return fmt.Errorf("failed to insert product %s: %w", id, err)
+		}
+	}
+	for _, a := range l.Activations {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO activations (license_id, hardware_id, activated_at, last_check_in) VALUES (%s, %s, %s, %s)",
+			p(1), p(2), p(3), p(4)), l.LicenseID, a.HardwareID, db.timeArg(a.ActivatedAt), db.timeArg(a.LastCheckIn)); err != nil {
+			return fmt.Errorf("failed to insert activation: %w", err)
+		}
+	}
+	for _, u := range l.Usage {
+		var hardwareID interface{}
+		if u.HardwareID != "" {
+			hardwareID = u.HardwareID
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO daily_usage (license_id, date, hardware_id, scans) VALUES (%s, %s, %s, %s)",
+			p(1), p(2), p(3), p(4)), l.LicenseID, u.Date, hardwareID, u.Scans); err != nil {
+			return fmt.Errorf("failed to insert usage for %s: %w", u.Date, err)
+		}
+	}
+	return nil
+}
+
+// timeArg converts t to a bind parameter. SQLite stores timestamps as TEXT,
+// so they are written as RFC 3339, which every reader of these columns parses.
+func (db *DB) timeArg(t time.Time) interface{} {
+	if db.postgres {
+		return t
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
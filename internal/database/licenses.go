@@ -0,0 +1,322 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// License is a row of the licenses table
+type License struct {
+	LicenseID      string
+	CustomerName   string
+	CustomerEmail  string
+	Tier           string
+	ExpiresAt      time.Time
+	DailyLimit     int
+	MonthlyLimit   int
+	MaxActivations int
+	Active         bool
+	CreatedAt      time.Time
+}
+
+// ErrLicenseNotFound is returned when no license has the requested ID
+var ErrLicenseNotFound = errors.New("license not found")
+
+// LifetimeExpiry is the expires_at given to lifetime licenses
+var LifetimeExpiry = time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC)
+
+// LimitChangeAssignments returns the SET clauses that record a change of a
+// license's limits on day, and their arguments for the placeholders numbered
+// from first. previous_daily_limit and previous_monthly_limit keep the limits
+// in force at the start of the day and month, so a second change in the same
+// window doesn't replace them with limits that were never in force for all
+// of it.
+func LimitChangeAssignments(placeholder func(int) string, first int, day time.Time) ([]string, []interface{}) {
+	date := day.Format("2006-01-02")
+	assignments := []string{
+		fmt.Sprintf("previous_daily_limit = CASE WHEN limits_changed_on = %s THEN previous_daily_limit ELSE daily_limit END", placeholder(first)),
+		fmt.Sprintf("previous_monthly_limit = CASE WHEN limits_changed_on LIKE %s THEN previous_monthly_limit ELSE monthly_limit END", placeholder(first+1)),
+		fmt.Sprintf("limits_changed_on = %s", placeholder(first+2)),
+	}
+	return assignments, []interface{}{date, date[:7] + "%", date}
+}
+
+// GetLicense calls GetLicenseContext with context.Background()
+func (db *DB) GetLicense(licenseID string) (*License, error) {
+	return db.GetLicenseContext(context.Background(), licenseID)
+}
+
+// GetLicenseContext returns a single license by ID
+func (db *DB) GetLicenseContext(ctx context.Context, licenseID string) (*License, error) {
+	var l License
+	var expiresAt string
+	var createdAt sql.NullString
+	stmt, err := db.prepare(ctx, `SELECT license_id, customer_name, customer_email, tier, expires_at,
+		daily_limit, monthly_limit, max_activations, active, created_at
+		FROM licenses WHERE license_id = ?`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load license: %w", err)
+	}
+	err = stmt.QueryRowContext(ctx, licenseID).Scan(
+		&l.LicenseID, &l.CustomerName, &l.CustomerEmail, &l.Tier, &expiresAt,
+		&l.DailyLimit, &l.MonthlyLimit, &l.MaxActivations, &l.Active, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrLicenseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load license: %w", err)
+	}
+	if l.ExpiresAt, err = ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("license %s: invalid expires_at: %w", l.LicenseID, err)
+	}
+	if createdAt.Valid {
+		l.CreatedAt, _ = ParseTime(createdAt.String)
+	}
+	return &l, nil
+}
+
+// LicenseFilter narrows ListLicenses. Zero values match everything; a zero
+// Limit returns all remaining rows.
+type LicenseFilter struct {
+	Tier          string
+	ActiveOnly    bool
+	EmailContains string // case-insensitive substring of customer_email
+	Search        string // case-insensitive substring of license_id, customer_name or customer_email
+	Limit         int
+	Offset        int
+}
+
+// ListLicenses calls ListLicensesContext with context.Background()
+func (db *DB) ListLicenses(filter LicenseFilter) ([]License, int, error) {
+	return db.ListLicensesContext(context.Background(), filter)
+}
+
+// ListLicensesContext returns one page of licenses matching filter, newest first,
+// together with the total number of matching licenses
+func (db *DB) ListLicensesContext(ctx context.Context, filter LicenseFilter) ([]License, int, error) {
+	if filter.Limit < 0 || filter.Offset < 0 {
+		return nil, 0, fmt.Errorf("limit and offset must not be negative")
+	}
+
+	where := " WHERE 1=1"
+	var args []interface{}
+	if filter.Tier != "" {
+		args = append(args, filter.Tier)
+		where += fmt.Sprintf(" AND tier = %s", db.placeholder(len(args)))
+	}
+	if filter.ActiveOnly {
+		where += " AND active = true"
+	}
+	if filter.EmailContains != "" {
+		args = append(args, "%"+escapeLike(strings.ToLower(filter.EmailContains))+"%")
+		where += fmt.Sprintf(` AND LOWER(customer_email) LIKE %s ESCAPE '\'`, db.placeholder(len(args)))
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Search)) + "%"
+		args = append(args, pattern, pattern, pattern)
+		where += fmt.Sprintf(` AND (LOWER(license_id) LIKE %s ESCAPE '\' OR LOWER(customer_name) LIKE %s ESCAPE '\'
+			OR LOWER(customer_email) LIKE %s ESCAPE '\')`,
+			db.placeholder(len(args)-2), db.placeholder(len(args)-1), db.placeholder(len(args)))
+	}
+
+	var total int
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM licenses"+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count licenses: %w", err)
+	}
+
+	query := `SELECT license_id, customer_name, customer_email, tier, expires_at,
+		daily_limit, monthly_limit, max_activations, active, created_at
+		FROM licenses` + where + " ORDER BY created_at DESC, license_id"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT %s", db.placeholder(len(args)))
+	} else if filter.Offset > 0 && !db.postgres {
+		query += " LIMIT -1" // SQLite only accepts OFFSET after LIMIT
+	}
+	if filter.Offset > 0 {
+		args = append(args, filter.Offset)
+		query += fmt.Sprintf(" OFFSET %s", db.placeholder(len(args)))
+	}
+
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list licenses: %w", err)
+	}
+	licenses, err := scanLicenses(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	return licenses, total, nil
+}
+
+// SearchLicenses calls SearchLicensesContext with context.Background()
+func (db *DB) SearchLicenses(term string, filter LicenseFilter) ([]License, int, error) {
+	return db.SearchLicensesContext(context.Background(), term, filter)
+}
+
+// SearchLicensesContext is ListLicensesContext for the licenses whose ID,
+// customer name or email contains term, ignoring case
+func (db *DB) SearchLicensesContext(ctx context.Context, term string, filter LicenseFilter) ([]License, int, error) {
+	if strings.TrimSpace(term) == "" {
+		return nil, 0, fmt.Errorf("search term must not be empty")
+	}
+	filter.Search = strings.TrimSpace(term)
+	return db.ListLicensesContext(ctx, filter)
+}
+
+// GetLicensesByEmail calls GetLicensesByEmailContext with context.Background()
+func (db *DB) GetLicensesByEmail(email string) ([]License, error) {
+	return db.GetLicensesByEmailContext(context.Background(), email)
+}
+
+// GetLicensesByEmailContext returns every license issued to an email
+// address, ignoring case, newest first
+func (db *DB) GetLicensesByEmailContext(ctx context.Context, email string) ([]License, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT license_id, customer_name, customer_email, tier, expires_at,
+		daily_limit, monthly_limit, max_activations, active, created_at
+		FROM licenses WHERE LOWER(customer_email) = %s ORDER BY created_at DESC, license_id`, db.placeholder(1)),
+		strings.ToLower(email))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list licenses: %w", err)
+	}
+	return scanLicenses(rows)
+}
+
+// scanLicenses reads and closes rows holding the columns GetLicense selects
+func scanLicenses(rows *sql.Rows) ([]License, error) {
+	defer func() { _ = rows.Close() }()
+
+	var licenses []License
+	for rows.Next() {
+		var l License
+		var expiresAt string
+		var createdAt sql.NullString
+		if err := rows.Scan(&l.LicenseID, &l.CustomerName, &l.CustomerEmail, &l.Tier, &expiresAt,
+			&l.DailyLimit, &l.MonthlyLimit, &l.MaxActivations, &l.Active, &createdAt); err != nil {
+			return nil, fmt.Errorf("failed to read license: %w", err)
+		}
+		var err error
+		if l.ExpiresAt, err = ParseTime(expiresAt); err != nil {
+			return nil, fmt.Errorf("license %s: invalid expires_at: %w", l.LicenseID, err)
+		}
+		if createdAt.Valid {
+			l.CreatedAt, _ = ParseTime(createdAt.String)
+		}
+		licenses = append(licenses, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list licenses: %w", err)
+	}
+	return licenses, nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ExtendLicense calls ExtendLicenseContext with context.Background()
+func (db *DB) ExtendLicense(licenseID string, months int) (time.Time, error) {
+	return db.ExtendLicenseContext(context.Background(), licenseID, months)
+}
+
+// ExtendLicenseContext renews a license in place, keeping its key, and
+// returns the new expiry. The months are added to the current expiry, or to
+// now if the license has already lapsed, so a late renewal still buys the
+// full period. months == 0 makes the license lifetime, and a lifetime
+// license stays lifetime.
+func (db *DB) ExtendLicenseContext(ctx context.Context, licenseID string, months int) (time.Time, error) {
+	if months < 0 {
+		return time.Time{}, fmt.Errorf("months must not be negative")
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var current string
+	err = tx.QueryRowContext(ctx, fmt.Sprintf("SELECT expires_at FROM licenses WHERE license_id = %s", db.placeholder(1)),
+		licenseID).Scan(&current)
+	if err == sql.ErrNoRows {
+		return time.Time{}, ErrLicenseNotFound
+	}
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to load license: %w", err)
+	}
+	expiresAt, err := ParseTime(current)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("license %s: invalid expires_at: %w", licenseID, err)
+	}
+
+	switch {
+	case months == 0 || !expiresAt.Before(LifetimeExpiry):
+		expiresAt = LifetimeExpiry
+	case expiresAt.Before(time.Now()):
+		expiresAt = time.Now().UTC().AddDate(0, months, 0)
+	default:
+		expiresAt = expiresAt.AddDate(0, months, 0)
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("UPDATE licenses SET expires_at = %s WHERE license_id = %s",
+		db.placeholder(1), db.placeholder(2)), db.timeArg(expiresAt), licenseID); err != nil {
+		return time.Time{}, fmt.Errorf("failed to extend license: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, fmt.Errorf("failed to extend license: %w", err)
+	}
+	return expiresAt, nil
+}
+
+// licenseTables are the tables holding rows that belong to a license, in the
+// order DeleteLicense clears them
+var licenseTables = []string{
+	"activations",
+	"daily_usage",
+	"check_ins",
+	"proxy_keys",
+	"license_products",
+	"usage_threshold_notified",
+	"token_usage",
+	"revocations",
+	"reminders_sent",
+}
+
+// DeleteLicense calls DeleteLicenseContext with context.Background()
+func (db *DB) DeleteLicense(licenseID string) error {
+	return db.DeleteLicenseContext(context.Background(), licenseID)
+}
+
+// DeleteLicenseContext permanently deletes a license together with its
+// activations, usage, check-ins, proxy keys and every other row that refers
+// to it, in a single transaction. It returns ErrLicenseNotFound, and deletes
+// nothing, if the license does not exist.
+func (db *DB) DeleteLicenseContext(ctx context.Context, licenseID string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	for _, table := range licenseTables {
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE license_id = %s", table, db.placeholder(1)), licenseID); err != nil {
+			return fmt.Errorf("failed to delete %s: %w", table, err)
+		}
+	}
+	result, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM licenses WHERE license_id = %s", db.placeholder(1)), licenseID)
+	if err != nil {
+		return fmt.Errorf("failed to delete license: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return ErrLicenseNotFound
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete license: %w", err)
+	}
+	return nil
+}
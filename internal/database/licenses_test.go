@@ -0,0 +1,302 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLimitChangeAssignments(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-LIMITS", 1) // 100/day, 1000/month
+
+		change := func(daily, monthly int, day time.Time) {
+			t.Helper()
+			assignments, args := LimitChangeAssignments(db.placeholder, 3, day)
+			args = append([]interface{}{daily, monthly}, args...)
+			_, err := db.Exec(fmt.Sprintf("UPDATE licenses SET daily_limit = %s, monthly_limit = %s, %s WHERE license_id = %s",
+				db.placeholder(1), db.placeholder(2), strings.Join(assignments, ", "), db.placeholder(6)), append(args, "LIC-LIMITS")...)
+			if err != nil {
+				t.Fatalf("change limits: %v", err)
+			}
+		}
+		previous := func() (daily, monthly int, changedOn string) {
+			t.Helper()
+			err := db.QueryRow(fmt.Sprintf("SELECT previous_daily_limit, previous_monthly_limit, limits_changed_on FROM licenses WHERE license_id = %s",
+				db.placeholder(1)), "LIC-LIMITS").Scan(&daily, &monthly, &changedOn)
+			if err != nil {
+				t.Fatalf("read previous limits: %v", err)
+			}
+			return daily, monthly, changedOn
+		}
+
+		june3 := time.Date(2026, 6, 3, 9, 0, 0, 0, time.UTC)
+		change(50, 500, june3)
+		change(20, 200, june3.Add(time.Hour))
+		if daily, monthly, on := previous(); daily != 100 || monthly != 1000 || on != "2026-06-03" {
+			t.Fatalf("after two changes on one day: previous = %d/%d on %s, want 100/1000 on 2026-06-03", daily, monthly, on)
+		}
+
+		// Later in the month the day starts at 20, the month still at 1000
+		change(10, 100, time.Date(2026, 6, 20, 9, 0, 0, 0, time.UTC))
+		if daily, monthly, on := previous(); daily != 20 || monthly != 1000 || on != "2026-06-20" {
+			t.Fatalf("after a change later in the month: previous = %d/%d on %s, want 20/1000 on 2026-06-20", daily, monthly, on)
+		}
+
+		change(5, 50, time.Date(2026, 7, 1, 9, 0, 0, 0, time.UTC))
+		if daily, monthly, on := previous(); daily != 10 || monthly != 100 || on != "2026-07-01" {
+			t.Fatalf("after a change in the next month: previous = %d/%d on %s, want 10/100 on 2026-07-01", daily, monthly, on)
+		}
+	})
+}
+
+// seedCustomers creates licenses for ListLicenses and SearchLicenses,
+// newest first in the order listed
+func seedCustomers(t *testing.T, db *DB) {
+	t.Helper()
+	p := db.placeholder
+	now := time.Now().UTC()
+	customers := []struct {
+		id, name, email, tier string
+		active                bool
+	}{
+		{"LIC-A1", "Alice Smith", "alice@example.com", "basic", true},
+		{"LIC-A2", "Alice Smith", "alice@work.example", "pro", false},
+		{"LIC-B1", "Bob Jones", "bob@example.com", "basic", true},
+		{"LIC-C1", "Carol 100%_Off", "carol@shop.example", "pro", true},
+		{"LIC-D1", "Dave Brown", "DAVE@Example.com", "basic", false},
+	}
+	for i, c := range customers {
+		_, err := db.Exec(fmt.Sprintf(`INSERT INTO licenses (license_id, customer_name, customer_email, tier, expires_at,
+			daily_limit, monthly_limit, max_activations, active, created_at) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, %s, %s)`,
+			p(1), p(2), p(3), p(4), p(5), p(6), p(7), p(8), p(9), p(10)),
+			c.id, c.name, c.email, c.tier, db.timeArg(now.AddDate(1, 0, 0)), 100, 1000, 1, c.active,
+			db.timeArg(now.Add(-time.Duration(i+1)*time.Hour)))
+		if err != nil {
+			t.Fatalf("create license %s: %v", c.id, err)
+		}
+	}
+}
+
+// licenseIDs returns the IDs of licenses in order
+func licenseIDs(licenses []License) string {
+	ids := make([]string, len(licenses))
+	for i, l := range licenses {
+		ids[i] = l.LicenseID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestListLicenses(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		seedCustomers(t, db)
+
+		tests := []struct {
+			name   string
+			filter LicenseFilter
+			want   string
+			total  int
+		}{
+			{"everything", LicenseFilter{}, "LIC-A1,LIC-A2,LIC-B1,LIC-C1,LIC-D1", 5},
+			{"tier", LicenseFilter{Tier: "basic"}, "LIC-A1,LIC-B1,LIC-D1", 3},
+			{"tier and active", LicenseFilter{Tier: "basic", ActiveOnly: true}, "LIC-A1,LIC-B1", 2},
+			{"email ignores case", LicenseFilter{EmailContains: "EXAMPLE.com"}, "LIC-A1,LIC-B1,LIC-D1", 3},
+			{"tier and email", LicenseFilter{Tier: "pro", EmailContains: "example"}, "LIC-A2,LIC-C1", 2},
+			{"active and search", LicenseFilter{ActiveOnly: true, Search: "example"}, "LIC-A1,LIC-B1,LIC-C1", 3},
+			{"search by name", LicenseFilter{Search: "alice"}, "LIC-A1,LIC-A2", 2},
+			{"percent is literal", LicenseFilter{Search: "%"}, "LIC-C1", 1},
+			{"underscore is literal", LicenseFilter{Search: "_"}, "LIC-C1", 1},
+			{"no match", LicenseFilter{Tier: "enterprise"}, "", 0},
+			{"first page", LicenseFilter{Tier: "basic", Limit: 2}, "LIC-A1,LIC-B1", 3},
+			{"last partial page", LicenseFilter{Tier: "basic", Limit: 2, Offset: 2}, "LIC-D1", 3},
+			{"offset at the end", LicenseFilter{Tier: "basic", Limit: 2, Offset: 3}, "", 3},
+			{"offset past the end", LicenseFilter{Offset: 10}, "", 5},
+			{"offset without limit", LicenseFilter{Tier: "basic", Offset: 1}, "LIC-B1,LIC-D1", 3},
+			{"limit above the total", LicenseFilter{Limit: 50}, "LIC-A1,LIC-A2,LIC-B1,LIC-C1,LIC-D1", 5},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				licenses, total, err := db.ListLicenses(tt.filter)
+				if err != nil {
+					t.Fatalf("ListLicenses: %v", err)
+				}
+				if got := licenseIDs(licenses); got != tt.want || total != tt.total {
+					t.Fatalf("got %q of %d, want %q of %d", got, total, tt.want, tt.total)
+				}
+			})
+		}
+
+		for _, filter := range []LicenseFilter{{Limit: -1}, {Offset: -1}} {
+			if _, _, err := db.ListLicenses(filter); err == nil {
+				t.Fatalf("%+v: expected an error", filter)
+			}
+		}
+	})
+}
+
+func TestSearchLicenses(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		seedCustomers(t, db)
+
+		tests := []struct {
+			name   string
+			term   string
+			filter LicenseFilter
+			want   string
+		}{
+			{"email local part", "bob@", LicenseFilter{}, "LIC-B1"},
+			{"email domain fragment", "work.exam", LicenseFilter{}, "LIC-A2"},
+			{"email ignores case", "dave@example", LicenseFilter{}, "LIC-D1"},
+			{"first name", "Alice", LicenseFilter{}, "LIC-A1,LIC-A2"},
+			{"surname fragment ignores case", "JON", LicenseFilter{}, "LIC-B1"},
+			{"name across a space", "e Sm", LicenseFilter{}, "LIC-A1,LIC-A2"},
+			{"license ID", "lic-c", LicenseFilter{}, "LIC-C1"},
+			{"surrounding space trimmed", "  brown ", LicenseFilter{}, "LIC-D1"},
+			{"matches email or name", "example.com", LicenseFilter{}, "LIC-A1,LIC-B1,LIC-D1"},
+			{"combined with filters", "alice", LicenseFilter{ActiveOnly: true}, "LIC-A1"},
+			{"combined with tier", "example", LicenseFilter{Tier: "pro"}, "LIC-A2,LIC-C1"},
+			{"paged", "example", LicenseFilter{Limit: 1, Offset: 1}, "LIC-A2"},
+			{"no match", "zoe", LicenseFilter{}, ""},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				licenses, _, err := db.SearchLicenses(tt.term, tt.filter)
+				if err != nil {
+					t.Fatalf("SearchLicenses: %v", err)
+				}
+				if got := licenseIDs(licenses); got != tt.want {
+					t.Fatalf("SearchLicenses(%q) = %q, want %q", tt.term, got, tt.want)
+				}
+			})
+		}
+
+		for _, term := range []string{"", "   "} {
+			if _, _, err := db.SearchLicenses(term, LicenseFilter{}); err == nil {
+				t.Fatalf("SearchLicenses(%q): expected an error", term)
+			}
+		}
+	})
+}
+
+func TestExtendLicense(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		now := time.Now().UTC().Truncate(time.Second)
+		future := now.AddDate(0, 2, 0)
+		tests := []struct {
+			name      string
+			expiresAt time.Time
+			months    int
+			want      time.Time
+		}{
+			{"adds to the current expiry", future, 12, future.AddDate(0, 12, 0)},
+			{"month end", time.Date(2099, 1, 31, 12, 0, 0, 0, time.UTC), 1, time.Date(2099, 3, 3, 12, 0, 0, 0, time.UTC)},
+			{"lapsed license starts from now", now.AddDate(0, -6, 0), 3, now.AddDate(0, 3, 0)},
+			{"zero months makes it lifetime", future, 0, LifetimeExpiry},
+			{"lifetime stays lifetime", LifetimeExpiry, 12, LifetimeExpiry},
+		}
+		for i, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				id := fmt.Sprintf("LIC-EXTEND-%d", i)
+				createLicense(t, db, id, 1)
+				setExpiry(t, db, id, tt.expiresAt, true)
+
+				got, err := db.ExtendLicense(id, tt.months)
+				if err != nil {
+					t.Fatalf("ExtendLicense: %v", err)
+				}
+				// A lapsed license is extended from the time of the call
+				if got.Before(tt.want) || got.After(tt.want.Add(time.Minute)) {
+					t.Fatalf("new expiry = %v, want %v", got, tt.want)
+				}
+				license, err := db.GetLicense(id)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// Backends store timestamps at different precisions
+				if diff := license.ExpiresAt.Sub(got); diff < -time.Second || diff > time.Second || license.LicenseID != id {
+					t.Fatalf("stored expiry = %v, want %v on the same key", license.ExpiresAt, got)
+				}
+			})
+		}
+
+		if _, err := db.ExtendLicense("LIC-MISSING", 12); !errors.Is(err, ErrLicenseNotFound) {
+			t.Fatalf("missing license: error = %v, want ErrLicenseNotFound", err)
+		}
+		createLicense(t, db, "LIC-NEGATIVE", 1)
+		if _, err := db.ExtendLicense("LIC-NEGATIVE", -1); err == nil {
+			t.Fatal("negative months: expected an error")
+		}
+	})
+}
+
+// seedLicenseRows gives licenseID a row in every table of licenseTables
+func seedLicenseRows(t *testing.T, db *DB, licenseID string) {
+	t.Helper()
+	p := db.placeholder
+	steps := []struct {
+		table string
+		err   error
+	}{
+		{"activations", func() error { _, err := db.ActivateDevice(licenseID, "hw-"+licenseID, 1); return err }()},
+		{"daily_usage", db.RecordUsage(licenseID, "2026-01-01", "hw-"+licenseID, 5)},
+		{"check_ins", func() error {
+			_, err := db.Exec(fmt.Sprintf("INSERT INTO check_ins (license_id) VALUES (%s)", p(1)), licenseID)
+			return err
+		}()},
+		{"proxy_keys", func() error {
+			_, err := db.Exec(fmt.Sprintf("INSERT INTO proxy_keys (proxy_key, license_id, hardware_id) VALUES (%s, %s, %s)", p(1), p(2), p(3)),
+				"px_"+licenseID, licenseID, "hw-"+licenseID)
+			return err
+		}()},
+		{"license_products", db.SetLicenseProducts(licenseID, []string{"app"})},
+		{"usage_threshold_notified", func() error { _, err := db.MarkThresholdNotified(licenseID, "daily", "2026-01-01", 80); return err }()},
+		{"token_usage", db.AddTokenUsage(licenseID, "2026-01-01", 100)},
+		{"revocations", db.AddRevocation(licenseID, "test")},
+		{"reminders_sent", func() error { _, err := db.MarkReminderSent(licenseID, 7, time.Now()); return err }()},
+	}
+	for _, step := range steps {
+		if step.err != nil {
+			t.Fatalf("seed %s: %v", step.table, step.err)
+		}
+	}
+}
+
+// countRows returns how many rows of table belong to licenseID
+func countRows(t *testing.T, db *DB, table, licenseID string) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE license_id = %s", table, db.placeholder(1)), licenseID).Scan(&n); err != nil {
+		t.Fatalf("count %s: %v", table, err)
+	}
+	return n
+}
+
+func TestDeleteLicense(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		for _, id := range []string{"LIC-ERASE", "LIC-KEEP"} {
+			createLicense(t, db, id, 1)
+			seedLicenseRows(t, db, id)
+		}
+
+		if err := db.DeleteLicense("LIC-ERASE"); err != nil {
+			t.Fatalf("DeleteLicense: %v", err)
+		}
+		if _, err := db.GetLicense("LIC-ERASE"); !errors.Is(err, ErrLicenseNotFound) {
+			t.Fatalf("GetLicense after delete: error = %v, want ErrLicenseNotFound", err)
+		}
+		for _, table := range licenseTables {
+			if n := countRows(t, db, table, "LIC-ERASE"); n != 0 {
+				t.Errorf("%s still has %d row(s) for the deleted license", table, n)
+			}
+			if n := countRows(t, db, table, "LIC-KEEP"); n == 0 {
+				t.Errorf("%s lost the other license's rows", table)
+			}
+		}
+
+		if err := db.DeleteLicense("LIC-ERASE"); !errors.Is(err, ErrLicenseNotFound) {
+			t.Fatalf("second delete: error = %v, want ErrLicenseNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,281 @@
+// Package migrations holds the versioned database schema shared by the
+// server and licensify-admin, and applies it to SQLite or PostgreSQL.
+//
+// Each dialect has its own directory of numbered files named
+// NNNN_description.sql. Applied versions are recorded in the
+// schema_migrations table so every migration runs exactly once.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sqlite/*.sql postgres/*.sql
+var files embed.FS
+
+// Migration is a single numbered schema change
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	// IfColumn, set with a "-- if-column: table.column" line, names a column
+	// that must exist for the statements to run. Without it the migration is
+	// recorded as applied but changes nothing.
+	IfColumn string
+}
+
+// String returns the migration's file name without the extension
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// Status reports whether a migration has been applied and when
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt string
+}
+
+var (
+	fileNamePattern  = regexp.MustCompile(`^(\d+)_(\w+)\.sql$`)
+	addColumnPattern = regexp.MustCompile(`(?i)^ALTER\s+TABLE\s+(\w+)\s+ADD\s+COLUMN\s+(\w+)`)
+	ifColumnPattern  = regexp.MustCompile(`(?m)^--\s*if-column:\s*(\w+\.\w+)\s*$`)
+)
+
+// Load returns the migrations for a dialect ordered by version
+func Load(postgres bool) ([]Migration, error) {
+	dir := dialectDir(postgres)
+	entries, err := fs.ReadDir(files, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s migrations: %w", dir, err)
+	}
+
+	var migrations []Migration
+	seen := make(map[int]string)
+	for _, entry := range entries {
+		match := fileNamePattern.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("invalid migration file name %s/%s (expected NNNN_description.sql)", dir, entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, entry.Name())
+		}
+		seen[version] = entry.Name()
+
+		body, err := files.ReadFile(path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		m := Migration{Version: version, Name: match[2], SQL: string(body)}
+		if guard := ifColumnPattern.FindStringSubmatch(m.SQL); guard != nil {
+			m.IfColumn = guard[1]
+		}
+		migrations = append(migrations, m)
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies every pending migration in version order, each in its own
+// transaction, and returns the migrations it applied. Running it against an
+// up-to-date database is a no-op.
+func Migrate(db *sql.DB, postgres bool) ([]Migration, error) {
+	migrations, err := Load(postgres)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureVersionTable(db, postgres); err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, m := range migrations {
+		ran, err := apply(db, postgres, m)
+		if err != nil {
+			return applied, fmt.Errorf("migration %s failed: %w", m, err)
+		}
+		if ran {
+			applied = append(applied, m)
+		}
+	}
+	return applied, nil
+}
+
+// List returns every known migration along with whether it has been applied
+func List(db *sql.DB, postgres bool) ([]Status, error) {
+	migrations, err := Load(postgres)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureVersionTable(db, postgres); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	appliedAt := make(map[int]string)
+	for rows.Next() {
+		var version int
+		var at sql.NullString
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+		}
+		appliedAt[version] = at.String
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read schema_migrations: %w", err)
+	}
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, m := range migrations {
+		at, ok := appliedAt[m.Version]
+		statuses = append(statuses, Status{Migration: m, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+func dialectDir(postgres bool) string {
+	if postgres {
+		return "postgres"
+	}
+	return "sqlite"
+}
+
+func placeholder(postgres bool, n int) string {
+	if postgres {
+		return fmt.Sprintf("$%d", n)
+	}
+	return "?"
+}
+
+func ensureVersionTable(db *sql.DB, postgres bool) error {
+	timestampType := "TEXT"
+	if postgres {
+		timestampType = "TIMESTAMP"
+	}
+	_, err := db.Exec(fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at %s DEFAULT CURRENT_TIMESTAMP
+		)
+	`, timestampType))
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations table: %w", err)
+	}
+	return nil
+}
+
+// apply runs one migration unless it is already recorded. On PostgreSQL an
+// advisory lock serialises servers that start at the same time.
+func apply(db *sql.DB, postgres bool, m Migration) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if postgres {
+		if _, err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('licensify_schema_migrations'))"); err != nil {
+			return false, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+
+	var count int
+	err = tx.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM schema_migrations WHERE version = %s", placeholder(postgres, 1)), m.Version).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to check schema_migrations: %w", err)
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	statements := splitStatements(m.SQL)
+	if m.IfColumn != "" {
+		table, column, _ := strings.Cut(m.IfColumn, ".")
+		exists, err := columnExists(tx, postgres, table, column)
+		if err != nil {
+			return false, err
+		}
+		if !exists {
+			statements = nil
+		}
+	}
+
+	for _, stmt := range statements {
+		// SQLite has no ADD COLUMN IF NOT EXISTS. Databases created from the
+		// old unversioned schema may already have the column, so skip it.
+		if !postgres {
+			if match := addColumnPattern.FindStringSubmatch(stmt); match != nil {
+				exists, err := columnExists(tx, postgres, match[1], match[2])
+				if err != nil {
+					return false, err
+				}
+				if exists {
+					continue
+				}
+			}
+		}
+		if _, err := tx.Exec(stmt); err != nil {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(fmt.Sprintf("INSERT INTO schema_migrations (version, name) VALUES (%s, %s)",
+		placeholder(postgres, 1), placeholder(postgres, 2)), m.Version, m.Name)
+	if err != nil {
+		return false, fmt.Errorf("failed to record migration: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit: %w", err)
+	}
+	return true, nil
+}
+
+func columnExists(tx *sql.Tx, postgres bool, table, column string) (bool, error) {
+	query := "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+	if postgres {
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2"
+	}
+	var count int
+	if err := tx.QueryRow(query, table, column).Scan(&count); err != nil {
+		return false, fmt.Errorf("failed to inspect table %s: %w", table, err)
+	}
+	return count > 0, nil
+}
+
+// splitStatements strips "--" comments and splits a migration into its
+// statements. Migration files must not use ";" inside literals or bodies.
+func splitStatements(script string) []string {
+	var cleaned strings.Builder
+	for _, line := range strings.Split(script, "\n") {
+		if i := strings.Index(line, "--"); i >= 0 {
+			line = line[:i]
+		}
+		cleaned.WriteString(line)
+		cleaned.WriteString("\n")
+	}
+
+	var statements []string
+	for _, stmt := range strings.Split(cleaned.String(), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
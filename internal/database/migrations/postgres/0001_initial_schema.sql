@@ -1,5 +1,6 @@
--- PostgreSQL initialization schema
--- This file creates all necessary tables for Licensify
+-- PostgreSQL baseline schema
+-- The schema as it was before versioned migrations were introduced.
+-- Later columns and tables are added by the numbered migrations that follow.
 
 CREATE TABLE IF NOT EXISTS licenses (
 	license_id TEXT PRIMARY KEY,
@@ -11,8 +12,7 @@ CREATE TABLE IF NOT EXISTS licenses (
 	monthly_limit INTEGER NOT NULL,
 	max_activations INTEGER NOT NULL,
 	active BOOLEAN DEFAULT true,
-	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-	encryption_salt TEXT
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE IF NOT EXISTS activations (
@@ -0,0 +1,5 @@
+-- Add encryption_salt column for proper key derivation
+-- Licenses created before this column existed get a salt generated the
+-- first time the server loads them.
+
+ALTER TABLE licenses ADD COLUMN IF NOT EXISTS encryption_salt TEXT;
@@ -0,0 +1,17 @@
+-- Rebuild proxy_keys around the per-device proxy key
+-- The baseline table stored provider keys per license, which nothing reads;
+-- proxy mode issues one proxy key per activated device instead.
+-- Only tables still holding the per-license provider keys are rebuilt, so
+-- per-device keys created before versioning are kept.
+-- if-column: proxy_keys.openai_key
+
+DROP TABLE IF EXISTS proxy_keys;
+
+CREATE TABLE proxy_keys (
+	proxy_key TEXT PRIMARY KEY,
+	license_id TEXT NOT NULL REFERENCES licenses(license_id),
+	hardware_id TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS proxy_keys_license_hardware_idx ON proxy_keys (license_id, hardware_id);
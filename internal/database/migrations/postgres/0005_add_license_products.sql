@@ -0,0 +1,10 @@
+-- Product entitlements for suite licenses
+-- A license with no rows here is entitled to the server's DEFAULT_PRODUCT
+-- only, so existing licenses keep working unchanged.
+
+CREATE TABLE IF NOT EXISTS license_products (
+	license_id TEXT NOT NULL REFERENCES licenses(license_id),
+	product_id TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (license_id, product_id)
+);
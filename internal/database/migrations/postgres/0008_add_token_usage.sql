@@ -0,0 +1,11 @@
+-- Token usage for proxied LLM requests
+-- Filled in when TOKEN_USAGE=true, from the usage the provider reports in
+-- each response. Request counts stay in daily_usage.
+-- date is YYYY-MM-DD text so monthly totals can match on a YYYY-MM prefix.
+
+CREATE TABLE IF NOT EXISTS token_usage (
+	license_id TEXT NOT NULL REFERENCES licenses(license_id),
+	date TEXT NOT NULL,
+	tokens BIGINT NOT NULL DEFAULT 0,
+	PRIMARY KEY (license_id, date)
+);
@@ -0,0 +1,9 @@
+-- Revoked licenses
+-- Written by licensify-admin deactivate and revoke and published, signed, at
+-- GET /revocations so clients holding offline files or proxy keys can sync.
+
+CREATE TABLE IF NOT EXISTS revocations (
+	license_id TEXT PRIMARY KEY REFERENCES licenses(license_id),
+	revoked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	reason TEXT NOT NULL DEFAULT ''
+);
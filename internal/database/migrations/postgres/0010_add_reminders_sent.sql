@@ -0,0 +1,12 @@
+-- Renewal reminder markers
+-- One row per license, reminder window and expiry date that has already been
+-- emailed by licensify-admin remind, so each reminder goes out once. Keying on
+-- expires_at means a renewed license gets reminded again before its new expiry.
+
+CREATE TABLE IF NOT EXISTS reminders_sent (
+	license_id TEXT NOT NULL REFERENCES licenses(license_id),
+	days INTEGER NOT NULL,
+	expires_at TEXT NOT NULL,
+	sent_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (license_id, days, expires_at)
+);
@@ -0,0 +1,5 @@
+-- Proxy request nonces
+-- The nonce a client sent with a proxied request, so the audit log shows
+-- which request a row belongs to. Empty for clients that send none.
+
+ALTER TABLE proxy_requests ADD COLUMN nonce TEXT NOT NULL DEFAULT '';
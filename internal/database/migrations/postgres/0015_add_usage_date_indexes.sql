@@ -0,0 +1,7 @@
+-- Usage date indexes
+-- The primary keys lead with license_id, so totals across all licenses for a
+-- date range, like this month's usage in stats, would otherwise scan the
+-- whole table.
+
+CREATE INDEX IF NOT EXISTS idx_daily_usage_date ON daily_usage(date);
+CREATE INDEX IF NOT EXISTS idx_token_usage_date ON token_usage(date);
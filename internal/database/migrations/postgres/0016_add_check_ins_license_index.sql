@@ -0,0 +1,9 @@
+-- Unique check-ins per license
+-- The check-in upsert conflicts on license_id, which had no unique
+-- constraint, so check-ins were never recorded. Keep the newest row of any
+-- duplicates before adding one.
+
+DELETE FROM check_ins WHERE id NOT IN (SELECT MAX(id) FROM check_ins GROUP BY license_id);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_check_ins_license ON check_ins(license_id);
+CREATE INDEX IF NOT EXISTS idx_check_ins_last_check_in ON check_ins(last_check_in);
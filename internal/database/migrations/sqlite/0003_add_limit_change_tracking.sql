@@ -0,0 +1,7 @@
+-- Track the limits that were in force before the last limit change
+-- A reduced limit only takes effect from the next daily/monthly reset,
+-- so the previous limits are kept for the rest of the current window.
+
+ALTER TABLE licenses ADD COLUMN previous_daily_limit INTEGER;
+ALTER TABLE licenses ADD COLUMN previous_monthly_limit INTEGER;
+ALTER TABLE licenses ADD COLUMN limits_changed_on TEXT; -- YYYY-MM-DD
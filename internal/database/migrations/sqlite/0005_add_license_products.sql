@@ -0,0 +1,11 @@
+-- Product entitlements for suite licenses
+-- A license with no rows here is entitled to the server's DEFAULT_PRODUCT
+-- only, so existing licenses keep working unchanged.
+
+CREATE TABLE IF NOT EXISTS license_products (
+	license_id TEXT NOT NULL,
+	product_id TEXT NOT NULL,
+	created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (license_id, product_id),
+	FOREIGN KEY (license_id) REFERENCES licenses(license_id)
+);
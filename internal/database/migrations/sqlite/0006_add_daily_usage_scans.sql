@@ -0,0 +1,6 @@
+-- Add the columns the server records usage in
+-- The initial schema created daily_usage with a count column, but /usage and
+-- the proxy write scans and hardware_id. The old count column is left unused.
+
+ALTER TABLE daily_usage ADD COLUMN scans INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE daily_usage ADD COLUMN hardware_id TEXT;
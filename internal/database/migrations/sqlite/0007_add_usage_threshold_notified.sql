@@ -0,0 +1,14 @@
+-- Usage alert markers
+-- One row per license, period and threshold that has already been notified,
+-- so each usage.threshold_reached alert fires at most once per day or month.
+-- period is 'daily' or 'monthly', period_key is YYYY-MM-DD or YYYY-MM.
+
+CREATE TABLE IF NOT EXISTS usage_threshold_notified (
+	license_id TEXT NOT NULL,
+	period TEXT NOT NULL,
+	period_key TEXT NOT NULL,
+	threshold INTEGER NOT NULL,
+	notified_at TEXT DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (license_id, period, period_key, threshold),
+	FOREIGN KEY (license_id) REFERENCES licenses(license_id)
+);
@@ -0,0 +1,11 @@
+-- Token usage for proxied LLM requests
+-- Filled in when TOKEN_USAGE=true, from the usage the provider reports in
+-- each response. Request counts stay in daily_usage.
+
+CREATE TABLE IF NOT EXISTS token_usage (
+	license_id TEXT NOT NULL,
+	date TEXT NOT NULL,
+	tokens INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (license_id, date),
+	FOREIGN KEY (license_id) REFERENCES licenses(license_id)
+);
@@ -0,0 +1,10 @@
+-- Revoked licenses
+-- Written by licensify-admin deactivate and revoke and published, signed, at
+-- GET /revocations so clients holding offline files or proxy keys can sync.
+
+CREATE TABLE IF NOT EXISTS revocations (
+	license_id TEXT PRIMARY KEY,
+	revoked_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	reason TEXT NOT NULL DEFAULT '',
+	FOREIGN KEY (license_id) REFERENCES licenses(license_id)
+);
@@ -0,0 +1,15 @@
+-- Admin audit log
+-- One row per change made through licensify-admin, with who ran it and the
+-- command's parameters as JSON. target_license has no foreign key so entries
+-- outlive the licenses that delete removes.
+
+CREATE TABLE IF NOT EXISTS audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	action TEXT NOT NULL,
+	target_license TEXT NOT NULL DEFAULT '',
+	actor TEXT NOT NULL DEFAULT '',
+	details TEXT NOT NULL DEFAULT '{}',
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_target_license ON audit_log(target_license);
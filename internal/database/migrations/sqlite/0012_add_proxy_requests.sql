@@ -0,0 +1,18 @@
+-- Proxy request audit log
+-- Written when PROXY_AUDIT=true, one row per request sent to a provider.
+-- Only sizes are kept, never request or response bodies. license_id has no
+-- foreign key so rows outlive the licenses that delete removes.
+
+CREATE TABLE IF NOT EXISTS proxy_requests (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	license_id TEXT NOT NULL,
+	hardware_id TEXT NOT NULL,
+	provider TEXT NOT NULL,
+	status_code INTEGER NOT NULL,
+	request_bytes INTEGER NOT NULL DEFAULT 0,
+	response_bytes INTEGER NOT NULL DEFAULT 0,
+	duration_ms INTEGER NOT NULL DEFAULT 0,
+	created_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_proxy_requests_license_created ON proxy_requests(license_id, created_at);
@@ -0,0 +1,6 @@
+-- Proxy key expiry
+-- Set from PROXY_KEY_TTL when a key is issued or rotated. Keys issued before
+-- this column existed, or while PROXY_KEY_TTL is unset, have none and never
+-- expire.
+
+ALTER TABLE proxy_keys ADD COLUMN expires_at TEXT;
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/melihbirim/licensify/internal/database/migrations"
+)
+
+func TestMigrateFreshDatabaseTwice(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		applied, err := migrations.Migrate(db.DB, db.postgres)
+		if err != nil {
+			t.Fatalf("second migrate: %v", err)
+		}
+		if len(applied) != 0 {
+			t.Fatalf("second migrate applied %v, want nothing", applied)
+		}
+
+		createLicense(t, db, "LIC-MIGRATE", 1)
+		_, err = db.Exec(db.rebind(`INSERT INTO proxy_keys (proxy_key, license_id, hardware_id) VALUES (?, ?, ?)`),
+			"px_migrate", "LIC-MIGRATE", "hw-migrate")
+		if err != nil {
+			t.Fatalf("proxy_keys isn't the per-device table: %v", err)
+		}
+	})
+}
+
+func TestMigrateKeepsPerDeviceProxyKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "licensify.db")
+	conn, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	// An unversioned database that already issues per-device proxy keys
+	_, err = conn.Exec(`CREATE TABLE proxy_keys (
+		proxy_key TEXT PRIMARY KEY,
+		license_id TEXT NOT NULL,
+		hardware_id TEXT NOT NULL,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(`INSERT INTO proxy_keys (proxy_key, license_id, hardware_id) VALUES ('px_kept', 'LIC-OLD', 'hw-old')`); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := migrations.Migrate(conn, false); err != nil {
+			t.Fatalf("migrate %d: %v", i+1, err)
+		}
+	}
+
+	var hardwareID string
+	if err := conn.QueryRow(`SELECT hardware_id FROM proxy_keys WHERE proxy_key = 'px_kept'`).Scan(&hardwareID); err != nil {
+		t.Fatalf("existing proxy key lost: %v", err)
+	}
+	if hardwareID != "hw-old" {
+		t.Fatalf("hardware_id = %q, want hw-old", hardwareID)
+	}
+}
@@ -0,0 +1,117 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// cachedStatements returns how many prepared statements db holds
+func cachedStatements(db *DB) int {
+	db.stmtMu.Lock()
+	defer db.stmtMu.Unlock()
+	return len(db.stmts)
+}
+
+func TestPrepareReusesStatements(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-PREPARED", 3)
+		ctx := context.Background()
+
+		if n := cachedStatements(db); n != 0 {
+			t.Fatalf("%d statements cached before any query", n)
+		}
+		first, err := db.prepare(ctx, "SELECT license_id FROM licenses WHERE license_id = ?")
+		if err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		second, err := db.prepare(ctx, "SELECT license_id FROM licenses WHERE license_id = ?")
+		if err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+		if first != second {
+			t.Fatal("the same query was prepared twice")
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := db.GetLicense("LIC-PREPARED"); err != nil {
+					t.Errorf("GetLicense: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := cachedStatements(db); n != 2 {
+			t.Fatalf("%d statements cached, want 2", n)
+		}
+	})
+}
+
+func TestCloseClosesStatements(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-PREPARED", 3)
+		if _, err := db.GetLicense("LIC-PREPARED"); err != nil {
+			t.Fatalf("GetLicense: %v", err)
+		}
+		stmt, err := db.prepare(context.Background(), "SELECT license_id FROM licenses WHERE license_id = ?")
+		if err != nil {
+			t.Fatalf("prepare: %v", err)
+		}
+
+		if err := db.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if n := cachedStatements(db); n != 0 {
+			t.Fatalf("%d statements still cached after Close", n)
+		}
+		var id string
+		if err := stmt.QueryRow("LIC-PREPARED").Scan(&id); err == nil {
+			t.Fatal("cached statement still usable after Close")
+		}
+		if _, err := db.GetLicense("LIC-PREPARED"); err == nil {
+			t.Fatal("GetLicense on a closed database returned nil, want an error")
+		}
+	})
+}
+
+func TestRebind(t *testing.T) {
+	query := "SELECT * FROM licenses WHERE license_id = ? AND tier = ?"
+	if got := (&DB{}).rebind(query); got != query {
+		t.Fatalf("SQLite rebind = %q, want the query unchanged", got)
+	}
+	want := "SELECT * FROM licenses WHERE license_id = $1 AND tier = $2"
+	if got := (&DB{postgres: true}).rebind(query); got != want {
+		t.Fatalf("PostgreSQL rebind = %q, want %q", got, want)
+	}
+}
+
+func BenchmarkGetLicense(b *testing.B) {
+	db := openSQLite(b)
+	createLicense(b, db, "LIC-BENCH", 3)
+
+	b.Run("prepared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := db.GetLicense("LIC-BENCH"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	// The same query without the statement cache, for comparison
+	b.Run("unprepared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var l License
+			var expiresAt, createdAt *string
+			err := db.QueryRow(`SELECT license_id, customer_name, customer_email, tier, expires_at,
+				daily_limit, monthly_limit, max_activations, active, created_at
+				FROM licenses WHERE license_id = ?`, "LIC-BENCH").Scan(
+				&l.LicenseID, &l.CustomerName, &l.CustomerEmail, &l.Tier, &expiresAt,
+				&l.DailyLimit, &l.MonthlyLimit, &l.MaxActivations, &l.Active, &createdAt)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
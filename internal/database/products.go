@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var productIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// ParseProductIDs splits a comma-separated product list, lowercasing,
+// de-duplicating and sorting the IDs. It rejects IDs that are not made of
+// lowercase letters, digits, ".", "_" and "-".
+func ParseProductIDs(list string) ([]string, error) {
+	seen := make(map[string]bool)
+	var products []string
+	for _, id := range strings.Split(list, ",") {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if id == "" || seen[id] {
+			continue
+		}
+		if !productIDPattern.MatchString(id) {
+			return nil, fmt.Errorf("invalid product ID %q (use lowercase letters, digits, '.', '_' and '-')", id)
+		}
+		seen[id] = true
+		products = append(products, id)
+	}
+	sort.Strings(products)
+	return products, nil
+}
+
+// GetLicenseProducts calls GetLicenseProductsContext with context.Background()
+func (db *DB) GetLicenseProducts(licenseID string) ([]string, error) {
+	return db.GetLicenseProductsContext(context.Background(), licenseID)
+}
+
+// GetLicenseProductsContext returns the product IDs a license is explicitly entitled
+// to, sorted. An empty result means the license only covers the default product.
+func (db *DB) GetLicenseProductsContext(ctx context.Context, licenseID string) ([]string, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT product_id FROM license_products WHERE license_id = %s ORDER BY product_id",
+		db.placeholder(1)), licenseID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load products: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var products []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to load products: %w", err)
+		}
+		products = append(products, id)
+	}
+	return products, rows.Err()
+}
+
+// SetLicenseProducts calls SetLicenseProductsContext with context.Background()
+func (db *DB) SetLicenseProducts(licenseID string, products []string) error {
+	return db.SetLicenseProductsContext(context.Background(), licenseID, products)
+}
+
+// SetLicenseProductsContext replaces a license's product entitlements. An empty
+// list returns the license to the default product.
+func (db *DB) SetLicenseProductsContext(ctx context.Context, licenseID string, products []string) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM license_products WHERE license_id = %s", db.placeholder(1)), licenseID); err != nil {
+		return fmt.Errorf("failed to clear products: %w", err)
+	}
+	for _, id := range products {
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO license_products (license_id, product_id) VALUES (%s, %s)",
+			db.placeholder(1), db.placeholder(2)), licenseID, id)
+		if err != nil {
+			return fmt.Errorf("failed to add product %s: %w", id, err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ProxyRequest is one request sent to a provider through the proxy. Only
+// sizes are recorded, never bodies.
+type ProxyRequest struct {
+	LicenseID     string
+	HardwareID    string
+	Provider      string
+	Nonce         string // as sent by the client, empty if it sent none
+	StatusCode    int    // as returned to the client, e.g. 504 when the provider timed out
+	RequestBytes  int64
+	ResponseBytes int64 // bytes copied to the client
+	Duration      time.Duration
+	CreatedAt     time.Time
+}
+
+// RecordProxyRequest calls RecordProxyRequestContext with context.Background()
+func (db *DB) RecordProxyRequest(req ProxyRequest) error {
+	return db.RecordProxyRequestContext(context.Background(), req)
+}
+
+// RecordProxyRequestContext appends a request to the proxy audit log. A zero
+// CreatedAt means now.
+func (db *DB) RecordProxyRequestContext(ctx context.Context, req ProxyRequest) error {
+	createdAt := req.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	stmt, err := db.prepare(ctx, `INSERT INTO proxy_requests
+		(license_id, hardware_id, provider, nonce, status_code, request_bytes, response_bytes, duration_ms, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to record proxy request: %w", err)
+	}
+	_, err = stmt.ExecContext(ctx, req.LicenseID, req.HardwareID, req.Provider, req.Nonce, req.StatusCode,
+		req.RequestBytes, req.ResponseBytes, req.Duration.Milliseconds(), createdAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to record proxy request: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRecordProxyRequest(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		entries := []ProxyRequest{
+			{
+				LicenseID: "LIC-AUDIT", HardwareID: "hw-1", Provider: "openai", Nonce: "nonce-1",
+				StatusCode: 200, RequestBytes: 512, ResponseBytes: 2048, Duration: 1500 * time.Millisecond,
+			},
+			{
+				LicenseID: "LIC-AUDIT", HardwareID: "hw-1", Provider: "anthropic",
+				StatusCode: 504, RequestBytes: 64, Duration: 60 * time.Second,
+				CreatedAt: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+			},
+		}
+		for _, entry := range entries {
+			if err := db.RecordProxyRequest(entry); err != nil {
+				t.Fatalf("RecordProxyRequest: %v", err)
+			}
+		}
+
+		rows, err := db.Query(db.rebind(`SELECT hardware_id, provider, nonce, status_code, request_bytes, response_bytes, duration_ms
+			FROM proxy_requests WHERE license_id = ? ORDER BY id`), "LIC-AUDIT")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = rows.Close() }()
+		var got []string
+		for rows.Next() {
+			var hardwareID, provider, nonce string
+			var status int
+			var requestBytes, responseBytes, durationMs int64
+			if err := rows.Scan(&hardwareID, &provider, &nonce, &status, &requestBytes, &responseBytes, &durationMs); err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, fmt.Sprintf("%s %s %q %d %d %d %d", hardwareID, provider, nonce, status, requestBytes, responseBytes, durationMs))
+		}
+		if err := rows.Err(); err != nil {
+			t.Fatal(err)
+		}
+		want := []string{
+			`hw-1 openai "nonce-1" 200 512 2048 1500`,
+			`hw-1 anthropic "" 504 64 0 60000`,
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("rows = %q, want %q", got, want)
+		}
+
+		// A zero CreatedAt is stamped with the current time
+		var recent int
+		err = db.QueryRow(db.rebind(`SELECT COUNT(*) FROM proxy_requests WHERE license_id = ? AND created_at >= ?`),
+			"LIC-AUDIT", db.timeArg(time.Now().Add(-time.Hour))).Scan(&recent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if recent != 1 {
+			t.Fatalf("%d rows stamped within the last hour, want only the one without CreatedAt", recent)
+		}
+	})
+}
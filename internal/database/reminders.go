@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// GetExpiringLicenses calls GetExpiringLicensesContext with context.Background()
+func (db *DB) GetExpiringLicenses(within time.Duration) ([]License, error) {
+	return db.GetExpiringLicensesContext(context.Background(), within)
+}
+
+// GetExpiringLicensesContext returns the active licenses that have not yet
+// expired and expire within the given duration from now (inclusive), soonest
+// first. Expiry is compared after parsing, since SQLite rows hold timestamps
+// in several text formats that don't sort chronologically.
+func (db *DB) GetExpiringLicensesContext(ctx context.Context, within time.Duration) ([]License, error) {
+	licenses, _, err := db.ListLicensesContext(ctx, LicenseFilter{ActiveOnly: true})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	deadline := now.Add(within)
+	var expiring []License
+	for _, l := range licenses {
+		if l.ExpiresAt.After(now) && !l.ExpiresAt.After(deadline) {
+			expiring = append(expiring, l)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].ExpiresAt.Before(expiring[j].ExpiresAt)
+	})
+	return expiring, nil
+}
+
+// MarkReminderSent calls MarkReminderSentContext with context.Background()
+func (db *DB) MarkReminderSent(licenseID string, days int, expiresAt time.Time) (bool, error) {
+	return db.MarkReminderSentContext(context.Background(), licenseID, days, expiresAt)
+}
+
+// MarkReminderSentContext records that the days-before-expiry reminder for a
+// license's current expiry has been sent. It reports false if it already
+// was, so overlapping runs agree on which one sends it.
+func (db *DB) MarkReminderSentContext(ctx context.Context, licenseID string, days int, expiresAt time.Time) (bool, error) {
+	result, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO reminders_sent (license_id, days, expires_at)
+		VALUES (%s, %s, %s) ON CONFLICT DO NOTHING`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3)),
+		licenseID, days, expiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, fmt.Errorf("failed to record reminder: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record reminder: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ReminderSent calls ReminderSentContext with context.Background()
+func (db *DB) ReminderSent(licenseID string, days int, expiresAt time.Time) (bool, error) {
+	return db.ReminderSentContext(context.Background(), licenseID, days, expiresAt)
+}
+
+// ReminderSentContext reports whether MarkReminderSent has recorded the
+// reminder
+func (db *DB) ReminderSentContext(ctx context.Context, licenseID string, days int, expiresAt time.Time) (bool, error) {
+	var count int
+	err := db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM reminders_sent
+		WHERE license_id = %s AND days = %s AND expires_at = %s`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3)),
+		licenseID, days, expiresAt.UTC().Format(time.RFC3339)).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to load reminders: %w", err)
+	}
+	return count > 0, nil
+}
+
+// UnmarkReminderSent calls UnmarkReminderSentContext with context.Background()
+func (db *DB) UnmarkReminderSent(licenseID string, days int, expiresAt time.Time) error {
+	return db.UnmarkReminderSentContext(context.Background(), licenseID, days, expiresAt)
+}
+
+// UnmarkReminderSentContext forgets a reminder, so a reminder that failed to
+// send is retried on the next run
+func (db *DB) UnmarkReminderSentContext(ctx context.Context, licenseID string, days int, expiresAt time.Time) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`DELETE FROM reminders_sent
+		WHERE license_id = %s AND days = %s AND expires_at = %s`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3)),
+		licenseID, days, expiresAt.UTC().Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("failed to clear reminder: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// setExpiry moves licenseID's expiry and sets whether it is active
+func setExpiry(t *testing.T, db *DB, licenseID string, expiresAt time.Time, active bool) {
+	t.Helper()
+	_, err := db.Exec(fmt.Sprintf(`UPDATE licenses SET expires_at = %s, active = %s WHERE license_id = %s`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3)), db.timeArg(expiresAt), active, licenseID)
+	if err != nil {
+		t.Fatalf("set expiry: %v", err)
+	}
+}
+
+func TestGetExpiringLicenses(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		const within = 7 * 24 * time.Hour
+		now := time.Now().Truncate(time.Second)
+		for id, license := range map[string]struct {
+			expiresAt time.Time
+			active    bool
+		}{
+			"LIC-TOMORROW": {now.Add(24 * time.Hour), true},
+			// The query's now is a little later, so the stored second is
+			// inside its window: the edge itself is included
+			"LIC-AT-EDGE":      {now.Add(within), true},
+			"LIC-PAST-EDGE":    {now.Add(within + time.Minute), true},
+			"LIC-EXPIRED":      {now.Add(-time.Minute), true},
+			"LIC-INACTIVE":     {now.Add(24 * time.Hour), false},
+			"LIC-NEXT-QUARTER": {now.AddDate(0, 3, 0), true},
+		} {
+			createLicense(t, db, id, 1)
+			setExpiry(t, db, id, license.expiresAt, license.active)
+		}
+
+		expiring, err := db.GetExpiringLicenses(within)
+		if err != nil {
+			t.Fatalf("GetExpiringLicenses: %v", err)
+		}
+		if got := licenseIDs(expiring); got != "LIC-TOMORROW,LIC-AT-EDGE" {
+			t.Fatalf("expiring = %s, want LIC-TOMORROW,LIC-AT-EDGE soonest first", got)
+		}
+		if !expiring[1].ExpiresAt.Equal(now.Add(within)) {
+			t.Fatalf("LIC-AT-EDGE expires %v, want %v", expiring[1].ExpiresAt, now.Add(within))
+		}
+	})
+}
+
+func TestReminderDedupe(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-REMIND", 1)
+		expiresAt := time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC)
+
+		mark := func(days int, expiresAt time.Time, want bool) {
+			t.Helper()
+			if sent, err := db.MarkReminderSent("LIC-REMIND", days, expiresAt); err != nil || sent != want {
+				t.Fatalf("MarkReminderSent(%d, %v) = %v, %v, want %v", days, expiresAt, sent, err, want)
+			}
+		}
+		mark(7, expiresAt, true)
+		mark(7, expiresAt, false) // a second run doesn't send it again
+		mark(1, expiresAt, true)  // other thresholds are separate
+		// A renewed license gets reminders again before its new expiry
+		mark(7, expiresAt.AddDate(1, 0, 0), true)
+
+		if sent, err := db.ReminderSent("LIC-REMIND", 7, expiresAt); err != nil || !sent {
+			t.Fatalf("ReminderSent = %v, %v, want true", sent, err)
+		}
+		// The same instant in another zone is the same expiry
+		if sent, err := db.ReminderSent("LIC-REMIND", 7, expiresAt.In(time.FixedZone("UTC+3", 3*60*60))); err != nil || !sent {
+			t.Fatalf("ReminderSent in another zone = %v, %v, want true", sent, err)
+		}
+
+		// A reminder that failed to send is retried
+		if err := db.UnmarkReminderSent("LIC-REMIND", 7, expiresAt); err != nil {
+			t.Fatal(err)
+		}
+		if sent, err := db.ReminderSent("LIC-REMIND", 7, expiresAt); err != nil || sent {
+			t.Fatalf("ReminderSent after unmark = %v, %v, want false", sent, err)
+		}
+		mark(7, expiresAt, true)
+	})
+}
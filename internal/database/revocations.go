@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Revocation records that a license was withdrawn
+type Revocation struct {
+	LicenseID string
+	RevokedAt time.Time
+	Reason    string
+}
+
+// AddRevocation calls AddRevocationContext with context.Background()
+func (db *DB) AddRevocation(licenseID, reason string) error {
+	return db.AddRevocationContext(context.Background(), licenseID, reason)
+}
+
+// AddRevocationContext marks a license as revoked. Revoking an already revoked
+// license keeps the original time and reason.
+func (db *DB) AddRevocationContext(ctx context.Context, licenseID, reason string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`INSERT INTO revocations (license_id, revoked_at, reason) VALUES (%s, %s, %s)
+		ON CONFLICT (license_id) DO NOTHING`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3)), licenseID, time.Now().UTC().Format(time.RFC3339), reason)
+	if err != nil {
+		return fmt.Errorf("failed to record revocation: %w", err)
+	}
+	return nil
+}
+
+// RemoveRevocation calls RemoveRevocationContext with context.Background()
+func (db *DB) RemoveRevocation(licenseID string) (bool, error) {
+	return db.RemoveRevocationContext(context.Background(), licenseID)
+}
+
+// RemoveRevocationContext lifts a license's revocation. It reports false if the
+// license was not revoked.
+func (db *DB) RemoveRevocationContext(ctx context.Context, licenseID string) (bool, error) {
+	result, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM revocations WHERE license_id = %s", db.placeholder(1)), licenseID)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove revocation: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to remove revocation: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// ListRevocations calls ListRevocationsContext with context.Background()
+func (db *DB) ListRevocations() ([]Revocation, error) {
+	return db.ListRevocationsContext(context.Background())
+}
+
+// ListRevocationsContext returns every revoked license, oldest first
+func (db *DB) ListRevocationsContext(ctx context.Context) ([]Revocation, error) {
+	rows, err := db.QueryContext(ctx, "SELECT license_id, revoked_at, reason FROM revocations ORDER BY revoked_at, license_id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load revocations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var revocations []Revocation
+	for rows.Next() {
+		var r Revocation
+		var revokedAt string
+		if err := rows.Scan(&r.LicenseID, &revokedAt, &r.Reason); err != nil {
+			return nil, fmt.Errorf("failed to load revocations: %w", err)
+		}
+		if r.RevokedAt, err = ParseTime(revokedAt); err != nil {
+			return nil, fmt.Errorf("license %s: invalid revoked_at: %w", r.LicenseID, err)
+		}
+		revocations = append(revocations, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load revocations: %w", err)
+	}
+	return revocations, nil
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Stats is an overview of every license on the server
+type Stats struct {
+	Licenses    int
+	Active      int // active and not yet expired
+	Expired     int // active but past expires_at
+	Deactivated int
+	Tiers       []TierStats // by tier name
+	Activations int
+	Month       string // YYYY-MM that MonthScans and MonthTokens cover
+	MonthScans  int64
+	MonthTokens int64
+}
+
+// TierStats counts the licenses on one tier
+type TierStats struct {
+	Tier        string
+	Licenses    int
+	Active      int
+	Expired     int
+	Deactivated int
+}
+
+// GetStats calls GetStatsContext with context.Background()
+func (db *DB) GetStats() (Stats, error) {
+	return db.GetStatsContext(context.Background())
+}
+
+// GetStatsContext counts licenses by tier and state, activations, and usage
+// in the current month
+func (db *DB) GetStatsContext(ctx context.Context) (Stats, error) {
+	now := time.Now()
+	stats := Stats{Month: now.Format("2006-01")}
+
+	// Expiry is compared after parsing, since SQLite rows hold timestamps in
+	// several text formats that don't sort chronologically. Only the three
+	// columns needed are read.
+	rows, err := db.QueryContext(ctx, "SELECT tier, active, expires_at FROM licenses")
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to count licenses: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	byTier := make(map[string]*TierStats)
+	for rows.Next() {
+		var tier, expiresAt string
+		var active bool
+		if err := rows.Scan(&tier, &active, &expiresAt); err != nil {
+			return Stats{}, fmt.Errorf("failed to read license: %w", err)
+		}
+		t := byTier[tier]
+		if t == nil {
+			t = &TierStats{Tier: tier}
+			byTier[tier] = t
+		}
+		t.Licenses++
+		switch expires, err := ParseTime(expiresAt); {
+		case !active:
+			t.Deactivated++
+		case err == nil && !now.Before(expires):
+			t.Expired++
+		default:
+			t.Active++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Stats{}, fmt.Errorf("failed to count licenses: %w", err)
+	}
+
+	for _, t := range byTier {
+		stats.Tiers = append(stats.Tiers, *t)
+		stats.Licenses += t.Licenses
+		stats.Active += t.Active
+		stats.Expired += t.Expired
+		stats.Deactivated += t.Deactivated
+	}
+	sort.Slice(stats.Tiers, func(i, j int) bool { return stats.Tiers[i].Tier < stats.Tiers[j].Tier })
+
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM activations").Scan(&stats.Activations); err != nil {
+		return Stats{}, fmt.Errorf("failed to count activations: %w", err)
+	}
+
+	// Ranges rather than LIKE so the date indexes apply
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	from, to := start.Format("2006-01-02"), start.AddDate(0, 1, 0).Format("2006-01-02")
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(SUM(scans), 0) FROM daily_usage WHERE date >= %s AND date < %s",
+		db.placeholder(1), db.placeholder(2)), from, to).Scan(&stats.MonthScans); err != nil {
+		return Stats{}, fmt.Errorf("failed to sum usage: %w", err)
+	}
+	if err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(SUM(tokens), 0) FROM token_usage WHERE date >= %s AND date < %s",
+		db.placeholder(1), db.placeholder(2)), from, to).Scan(&stats.MonthTokens); err != nil {
+		return Stats{}, fmt.Errorf("failed to sum token usage: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,89 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestGetStats(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		now := time.Now()
+		for id, license := range map[string]struct {
+			tier      string
+			expiresAt time.Time
+			active    bool
+		}{
+			"LIC-BASIC-1":    {"basic", now.AddDate(0, 1, 0), true},
+			"LIC-BASIC-2":    {"basic", now.AddDate(0, 0, -1), true},
+			"LIC-BASIC-3":    {"basic", now.AddDate(0, 1, 0), false},
+			"LIC-PRO-1":      {"pro", now.AddDate(1, 0, 0), true},
+			"LIC-PRO-2":      {"pro", now.AddDate(-1, 0, 0), false}, // deactivated wins over expired
+			"LIC-ENTERPRISE": {"enterprise", now.Add(-time.Minute), true},
+		} {
+			createLicense(t, db, id, 3)
+			setExpiry(t, db, id, license.expiresAt, license.active)
+			if _, err := db.Exec(db.rebind(`UPDATE licenses SET tier = ? WHERE license_id = ?`), license.tier, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, device := range []struct{ license, hardware string }{
+			{"LIC-BASIC-1", "hw-1"}, {"LIC-BASIC-1", "hw-2"}, {"LIC-PRO-1", "hw-3"},
+		} {
+			if _, err := db.ActivateDevice(device.license, device.hardware, 3); err != nil {
+				t.Fatalf("activate: %v", err)
+			}
+		}
+
+		// Only usage dated in the current month counts
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+		thisMonth, lastMonth := monthStart.Format("2006-01-02"), monthStart.AddDate(0, 0, -1).Format("2006-01-02")
+		today := now.Format("2006-01-02")
+		for _, usage := range []struct {
+			license, date string
+			scans         int
+			tokens        int64
+		}{
+			{"LIC-BASIC-1", thisMonth, 5, 1000},
+			{"LIC-PRO-1", today, 7, 250},
+			{"LIC-PRO-1", lastMonth, 100, 99999},
+		} {
+			if err := db.RecordUsage(usage.license, usage.date, "hw-1", usage.scans); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.AddTokenUsage(usage.license, usage.date, usage.tokens); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		stats, err := db.GetStats()
+		if err != nil {
+			t.Fatalf("GetStats: %v", err)
+		}
+		got := fmt.Sprintf("licenses=%d active=%d expired=%d deactivated=%d activations=%d month=%s scans=%d tokens=%d",
+			stats.Licenses, stats.Active, stats.Expired, stats.Deactivated, stats.Activations, stats.Month, stats.MonthScans, stats.MonthTokens)
+		want := fmt.Sprintf("licenses=6 active=2 expired=2 deactivated=2 activations=3 month=%s scans=12 tokens=1250", now.Format("2006-01"))
+		if got != want {
+			t.Fatalf("stats = %s\nwant    %s", got, want)
+		}
+
+		wantTiers := []TierStats{
+			{Tier: "basic", Licenses: 3, Active: 1, Expired: 1, Deactivated: 1},
+			{Tier: "enterprise", Licenses: 1, Expired: 1},
+			{Tier: "pro", Licenses: 2, Active: 1, Deactivated: 1},
+		}
+		if fmt.Sprint(stats.Tiers) != fmt.Sprint(wantTiers) {
+			t.Fatalf("tiers = %+v, want %+v sorted by name", stats.Tiers, wantTiers)
+		}
+	})
+}
+
+func TestGetStatsEmpty(t *testing.T) {
+	stats, err := openSQLite(t).GetStats()
+	if err != nil {
+		t.Fatalf("GetStats: %v", err)
+	}
+	if stats.Licenses != 0 || stats.Activations != 0 || stats.MonthScans != 0 || stats.MonthTokens != 0 || len(stats.Tiers) != 0 {
+		t.Fatalf("stats of an empty database = %+v, want zeros", stats)
+	}
+}
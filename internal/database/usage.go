@@ -0,0 +1,200 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// MarkThresholdNotified calls MarkThresholdNotifiedContext with context.Background()
+func (db *DB) MarkThresholdNotified(licenseID, period, periodKey string, threshold int) (bool, error) {
+	return db.MarkThresholdNotifiedContext(context.Background(), licenseID, period, periodKey, threshold)
+}
+
+// MarkThresholdNotifiedContext records that a usage alert for threshold percent has
+// been sent for a license in the given period ("daily" or "monthly") and
+// period key (YYYY-MM-DD or YYYY-MM). It reports false if the marker already
+// existed, so concurrent requests agree on which one sends the alert.
+func (db *DB) MarkThresholdNotifiedContext(ctx context.Context, licenseID, period, periodKey string, threshold int) (bool, error) {
+	stmt, err := db.prepare(ctx, `INSERT INTO usage_threshold_notified (license_id, period, period_key, threshold)
+		VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`)
+	if err != nil {
+		return false, fmt.Errorf("failed to record usage alert: %w", err)
+	}
+	result, err := stmt.ExecContext(ctx, licenseID, period, periodKey, threshold)
+	if err != nil {
+		return false, fmt.Errorf("failed to record usage alert: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to record usage alert: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// RecordUsage calls RecordUsageContext with context.Background()
+func (db *DB) RecordUsage(licenseID, date, hardwareID string, scans int) error {
+	return db.RecordUsageContext(context.Background(), licenseID, date, hardwareID, scans)
+}
+
+// recordUsageQuery adds to a license's request count for one day
+const recordUsageQuery = `INSERT INTO daily_usage (license_id, date, scans, hardware_id) VALUES (?, ?, ?, ?)
+		ON CONFLICT (license_id, date) DO UPDATE SET scans = daily_usage.scans + excluded.scans`
+
+// RecordUsageContext adds scans to a license's request count for date (YYYY-MM-DD)
+func (db *DB) RecordUsageContext(ctx context.Context, licenseID, date, hardwareID string, scans int) error {
+	stmt, err := db.prepare(ctx, recordUsageQuery)
+	if err == nil {
+		_, err = stmt.ExecContext(ctx, licenseID, date, scans, hardwareID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// UsageEntry is one item of a usage batch
+type UsageEntry struct {
+	Date       string // YYYY-MM-DD
+	HardwareID string
+	Scans      int
+}
+
+// MaxUsageBatch is the most entries RecordUsageBatch accepts at once
+const MaxUsageBatch = 1000
+
+// RecordUsageBatch calls RecordUsageBatchContext with context.Background()
+func (db *DB) RecordUsageBatch(licenseID string, entries []UsageEntry) error {
+	return db.RecordUsageBatchContext(context.Background(), licenseID, entries)
+}
+
+// RecordUsageBatchContext adds every entry to a license's request counts in a
+// single transaction, so either all of them are counted or none are. Entries
+// for the same date are summed first and written once.
+func (db *DB) RecordUsageBatchContext(ctx context.Context, licenseID string, entries []UsageEntry) error {
+	if len(entries) > MaxUsageBatch {
+		return fmt.Errorf("usage batch has %d entries (maximum %d)", len(entries), MaxUsageBatch)
+	}
+
+	// Like RecordUsage, a day keeps the hardware ID it was first recorded with
+	var days []UsageEntry
+	index := make(map[string]int)
+	for _, e := range entries {
+		if i, ok := index[e.Date]; ok {
+			days[i].Scans += e.Scans
+			continue
+		}
+		index[e.Date] = len(days)
+		days = append(days, e)
+	}
+
+	stmt, err := db.prepare(ctx, recordUsageQuery)
+	if err != nil {
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	txStmt := tx.StmtContext(ctx, stmt)
+	for _, day := range days {
+		if _, err := txStmt.ExecContext(ctx, licenseID, day.Date, day.Scans, day.HardwareID); err != nil {
+			return fmt.Errorf("failed to record usage for %s: %w", day.Date, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit usage: %w", err)
+	}
+	return nil
+}
+
+// AddTokenUsage calls AddTokenUsageContext with context.Background()
+func (db *DB) AddTokenUsage(licenseID, date string, tokens int64) error {
+	return db.AddTokenUsageContext(context.Background(), licenseID, date, tokens)
+}
+
+// AddTokenUsageContext adds tokens to a license's token count for date (YYYY-MM-DD)
+func (db *DB) AddTokenUsageContext(ctx context.Context, licenseID, date string, tokens int64) error {
+	stmt, err := db.prepare(ctx, `INSERT INTO token_usage (license_id, date, tokens) VALUES (?, ?, ?)
+		ON CONFLICT (license_id, date) DO UPDATE SET tokens = token_usage.tokens + excluded.tokens`)
+	if err == nil {
+		_, err = stmt.ExecContext(ctx, licenseID, date, tokens)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to record token usage: %w", err)
+	}
+	return nil
+}
+
+// GetTokenUsage calls GetTokenUsageContext with context.Background()
+func (db *DB) GetTokenUsage(licenseID, date string) (daily, monthly int64, err error) {
+	return db.GetTokenUsageContext(context.Background(), licenseID, date)
+}
+
+// GetTokenUsageContext returns the tokens a license used on date (YYYY-MM-DD) and in
+// that date's month
+func (db *DB) GetTokenUsageContext(ctx context.Context, licenseID, date string) (daily, monthly int64, err error) {
+	if len(date) < 7 {
+		return 0, 0, fmt.Errorf("invalid date %q", date)
+	}
+	stmt, err := db.prepare(ctx, `SELECT
+		COALESCE(SUM(CASE WHEN date = ? THEN tokens ELSE 0 END), 0),
+		COALESCE(SUM(tokens), 0)
+		FROM token_usage WHERE license_id = ? AND date LIKE ?`)
+	if err == nil {
+		err = stmt.QueryRowContext(ctx, date, licenseID, date[:7]+"%").Scan(&daily, &monthly)
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to load token usage: %w", err)
+	}
+	return daily, monthly, nil
+}
+
+// MaxUsageRangeDays is the longest date range GetUsageRange returns
+const MaxUsageRangeDays = 366
+
+// DailyUsage is a license's total request count for one day
+type DailyUsage struct {
+	Date  string // YYYY-MM-DD
+	Scans int
+}
+
+// GetUsageRange calls GetUsageRangeContext with context.Background()
+func (db *DB) GetUsageRange(licenseID, from, to string) ([]DailyUsage, error) {
+	return db.GetUsageRangeContext(context.Background(), licenseID, from, to)
+}
+
+// GetUsageRangeContext returns a license's daily usage between from and to
+// (YYYY-MM-DD, inclusive), oldest first. Days without usage are omitted and
+// at most MaxUsageRangeDays rows are returned.
+func (db *DB) GetUsageRangeContext(ctx context.Context, licenseID, from, to string) ([]DailyUsage, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT date, COALESCE(SUM(scans), 0) FROM daily_usage
+		WHERE license_id = %s AND date >= %s AND date <= %s
+		GROUP BY date ORDER BY date LIMIT %d`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), MaxUsageRangeDays), licenseID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load usage: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var usage []DailyUsage
+	for rows.Next() {
+		var day DailyUsage
+		var date string
+		if err := rows.Scan(&date, &day.Scans); err != nil {
+			return nil, fmt.Errorf("failed to load usage: %w", err)
+		}
+		// PostgreSQL DATE columns come back as timestamps
+		t, err := ParseTime(date)
+		if err != nil {
+			return nil, fmt.Errorf("invalid usage date: %w", err)
+		}
+		day.Date = t.Format("2006-01-02")
+		usage = append(usage, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load usage: %w", err)
+	}
+	return usage, nil
+}
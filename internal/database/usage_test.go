@@ -0,0 +1,127 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUsageWritesReportDatabaseErrors(t *testing.T) {
+	today := time.Now().Format("2006-01-02")
+	writes := []struct {
+		name  string
+		write func(db *DB) error
+	}{
+		{"RecordUsage", func(db *DB) error { return db.RecordUsage("LIC-TEST", today, "hw-1", 1) }},
+		{"RecordUsageBatch", func(db *DB) error {
+			return db.RecordUsageBatch("LIC-TEST", []UsageEntry{{Date: today, HardwareID: "hw-1", Scans: 2}})
+		}},
+		{"AddTokenUsage", func(db *DB) error { return db.AddTokenUsage("LIC-TEST", today, 100) }},
+	}
+
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		for _, w := range writes {
+			if err := w.write(db); err != nil {
+				t.Fatalf("%s on an open database: %v", w.name, err)
+			}
+		}
+
+		// Statements prepared above must fail too, not just new queries
+		if err := db.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		for _, w := range writes {
+			if err := w.write(db); err == nil {
+				t.Errorf("%s on a closed database returned nil, want an error", w.name)
+			}
+		}
+	})
+}
+
+func TestRecordUsageBatchTotals(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-BATCH", 1)
+		err := db.RecordUsageBatch("LIC-BATCH", []UsageEntry{
+			{Date: "2026-03-01", HardwareID: "hw-1", Scans: 2},
+			{Date: "2026-03-02", HardwareID: "hw-1", Scans: 5},
+			{Date: "2026-03-01", HardwareID: "hw-2", Scans: 3},
+		})
+		if err != nil {
+			t.Fatalf("RecordUsageBatch: %v", err)
+		}
+		if err := db.RecordUsage("LIC-BATCH", "2026-03-02", "hw-1", 1); err != nil {
+			t.Fatalf("RecordUsage: %v", err)
+		}
+
+		usage, err := db.GetUsageRange("LIC-BATCH", "2026-03-01", "2026-03-31")
+		if err != nil {
+			t.Fatalf("GetUsageRange: %v", err)
+		}
+		want := []DailyUsage{{Date: "2026-03-01", Scans: 5}, {Date: "2026-03-02", Scans: 6}}
+		if len(usage) != len(want) || usage[0] != want[0] || usage[1] != want[1] {
+			t.Fatalf("usage = %v, want %v", usage, want)
+		}
+	})
+}
+
+func TestRecordUsageBatchIsAtomic(t *testing.T) {
+	db := openSQLite(t)
+	createLicense(t, db, "LIC-BATCH", 1)
+	// Fail the write for one day in the middle of the batch
+	_, err := db.Exec(`CREATE TRIGGER fail_usage BEFORE INSERT ON daily_usage WHEN NEW.date = '2026-03-02'
+		BEGIN SELECT RAISE(ABORT, 'usage write failed'); END`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.RecordUsageBatch("LIC-BATCH", []UsageEntry{
+		{Date: "2026-03-01", HardwareID: "hw-1", Scans: 2},
+		{Date: "2026-03-02", HardwareID: "hw-1", Scans: 5},
+		{Date: "2026-03-03", HardwareID: "hw-1", Scans: 7},
+	})
+	if err == nil {
+		t.Fatal("RecordUsageBatch succeeded with a failing entry")
+	}
+	usage, err := db.GetUsageRange("LIC-BATCH", "2026-03-01", "2026-03-31")
+	if err != nil {
+		t.Fatalf("GetUsageRange: %v", err)
+	}
+	if len(usage) != 0 {
+		t.Fatalf("usage = %v after a failed batch, want none", usage)
+	}
+}
+
+func TestGetUsageRangeAcrossMonths(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		createLicense(t, db, "LIC-RANGE", 2)
+		days := []struct {
+			date, hardwareID string
+			scans            int
+		}{
+			{"2026-01-30", "hw-1", 1}, // before the range
+			{"2026-01-31", "hw-1", 2},
+			{"2026-01-31", "hw-2", 3}, // devices on one day are summed
+			{"2026-02-01", "hw-1", 4},
+			{"2026-02-28", "hw-1", 5},
+			{"2026-03-01", "hw-1", 6}, // after the range
+		}
+		for _, d := range days {
+			if err := db.RecordUsage("LIC-RANGE", d.date, d.hardwareID, d.scans); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		usage, err := db.GetUsageRange("LIC-RANGE", "2026-01-31", "2026-02-28")
+		if err != nil {
+			t.Fatalf("GetUsageRange: %v", err)
+		}
+		want := []DailyUsage{{Date: "2026-01-31", Scans: 5}, {Date: "2026-02-01", Scans: 4}, {Date: "2026-02-28", Scans: 5}}
+		if len(usage) != len(want) {
+			t.Fatalf("usage = %+v, want %+v", usage, want)
+		}
+		for i := range want {
+			if usage[i] != want[i] {
+				t.Fatalf("usage = %+v, want %+v", usage, want)
+			}
+		}
+	})
+}
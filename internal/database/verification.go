@@ -0,0 +1,122 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoVerificationCode is returned when an email has no pending code
+var ErrNoVerificationCode = errors.New("no verification code for this email")
+
+// VerificationCode is a pending email verification code
+type VerificationCode struct {
+	Email     string
+	Code      string
+	CreatedAt time.Time // when the code was last sent
+	ExpiresAt time.Time
+}
+
+// SaveVerificationCode calls SaveVerificationCodeContext with context.Background()
+func (db *DB) SaveVerificationCode(email, code string, expiresAt time.Time) error {
+	return db.SaveVerificationCodeContext(context.Background(), email, code, expiresAt)
+}
+
+// SaveVerificationCodeContext replaces any pending code for email. CreatedAt is set
+// to now, which starts the resend cooldown.
+func (db *DB) SaveVerificationCodeContext(ctx context.Context, email, code string, expiresAt time.Time) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM verification_codes WHERE email = %s", db.placeholder(1)), email); err != nil {
+		return fmt.Errorf("failed to replace verification code: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO verification_codes (email, code, created_at, expires_at) VALUES (%s, %s, %s, %s)",
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4)),
+		email, code, time.Now().UTC().Format(time.RFC3339), expiresAt.UTC().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("failed to store verification code: %w", err)
+	}
+	return tx.Commit()
+}
+
+// GetVerificationCode calls GetVerificationCodeContext with context.Background()
+func (db *DB) GetVerificationCode(email string) (*VerificationCode, error) {
+	return db.GetVerificationCodeContext(context.Background(), email)
+}
+
+// GetVerificationCodeContext returns the pending code for email, or
+// ErrNoVerificationCode
+func (db *DB) GetVerificationCodeContext(ctx context.Context, email string) (*VerificationCode, error) {
+	v := VerificationCode{Email: email}
+	var createdAt sql.NullString
+	var expiresAt string
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT code, created_at, expires_at FROM verification_codes WHERE email = %s", db.placeholder(1)),
+		email).Scan(&v.Code, &createdAt, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoVerificationCode
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load verification code: %w", err)
+	}
+	if v.ExpiresAt, err = ParseTime(expiresAt); err != nil {
+		return nil, fmt.Errorf("invalid verification code expires_at: %w", err)
+	}
+	if createdAt.Valid {
+		if v.CreatedAt, err = ParseTime(createdAt.String); err != nil {
+			return nil, fmt.Errorf("invalid verification code created_at: %w", err)
+		}
+	}
+	return &v, nil
+}
+
+// GetVerificationCodeAge calls GetVerificationCodeAgeContext with context.Background()
+func (db *DB) GetVerificationCodeAge(email string) (time.Duration, error) {
+	return db.GetVerificationCodeAgeContext(context.Background(), email)
+}
+
+// GetVerificationCodeAgeContext returns how long ago the pending code for email was
+// sent, or ErrNoVerificationCode
+func (db *DB) GetVerificationCodeAgeContext(ctx context.Context, email string) (time.Duration, error) {
+	v, err := db.GetVerificationCodeContext(ctx, email)
+	if err != nil {
+		return 0, err
+	}
+	return time.Since(v.CreatedAt), nil
+}
+
+// TouchVerificationCode calls TouchVerificationCodeContext with context.Background()
+func (db *DB) TouchVerificationCode(email string) error {
+	return db.TouchVerificationCodeContext(context.Background(), email)
+}
+
+// TouchVerificationCodeContext restarts the resend cooldown of the pending code for
+// email without changing the code or its expiry
+func (db *DB) TouchVerificationCodeContext(ctx context.Context, email string) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("UPDATE verification_codes SET created_at = %s WHERE email = %s", db.placeholder(1), db.placeholder(2)),
+		time.Now().UTC().Format(time.RFC3339), email)
+	if err != nil {
+		return fmt.Errorf("failed to update verification code: %w", err)
+	}
+	return nil
+}
+
+// DeleteVerificationCodes calls DeleteVerificationCodesContext with context.Background()
+func (db *DB) DeleteVerificationCodes(email string) (int, error) {
+	return db.DeleteVerificationCodesContext(context.Background(), email)
+}
+
+// DeleteVerificationCodesContext removes any pending verification codes for
+// email and returns how many were removed
+func (db *DB) DeleteVerificationCodesContext(ctx context.Context, email string) (int, error) {
+	result, err := db.ExecContext(ctx, fmt.Sprintf("DELETE FROM verification_codes WHERE email = %s", db.placeholder(1)), email)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete verification codes: %w", err)
+	}
+	rows, _ := result.RowsAffected()
+	return int(rows), nil
+}
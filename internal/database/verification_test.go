@@ -0,0 +1,95 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerificationCodes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, db *DB) {
+		expiresAt := time.Now().Add(15 * time.Minute).Truncate(time.Second)
+
+		tests := []struct {
+			name     string
+			setup    func(t *testing.T, email string)
+			wantCode string // empty means no pending code
+		}{
+			{
+				name:  "no code",
+				setup: func(t *testing.T, email string) {},
+			},
+			{
+				name: "stored code",
+				setup: func(t *testing.T, email string) {
+					mustSaveCode(t, db, email, "123456", expiresAt)
+				},
+				wantCode: "123456",
+			},
+			{
+				name: "resent code replaces the old one",
+				setup: func(t *testing.T, email string) {
+					mustSaveCode(t, db, email, "111111", expiresAt)
+					mustSaveCode(t, db, email, "222222", expiresAt)
+				},
+				wantCode: "222222",
+			},
+			{
+				name: "touch keeps the code",
+				setup: func(t *testing.T, email string) {
+					mustSaveCode(t, db, email, "333333", expiresAt)
+					if err := db.TouchVerificationCode(email); err != nil {
+						t.Fatalf("TouchVerificationCode: %v", err)
+					}
+				},
+				wantCode: "333333",
+			},
+			{
+				name: "deleted code",
+				setup: func(t *testing.T, email string) {
+					mustSaveCode(t, db, email, "444444", expiresAt)
+					if n, err := db.DeleteVerificationCodes(email); err != nil || n != 1 {
+						t.Fatalf("DeleteVerificationCodes = %d, %v; want 1, nil", n, err)
+					}
+				},
+			},
+		}
+
+		for i, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				email := "user" + string(rune('a'+i)) + "@example.com"
+				tt.setup(t, email)
+
+				got, err := db.GetVerificationCode(email)
+				if tt.wantCode == "" {
+					if !errors.Is(err, ErrNoVerificationCode) {
+						t.Fatalf("GetVerificationCode err = %v, want ErrNoVerificationCode", err)
+					}
+					if _, err := db.GetVerificationCodeAge(email); !errors.Is(err, ErrNoVerificationCode) {
+						t.Fatalf("GetVerificationCodeAge err = %v, want ErrNoVerificationCode", err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("GetVerificationCode: %v", err)
+				}
+				if got.Code != tt.wantCode {
+					t.Errorf("code = %q, want %q", got.Code, tt.wantCode)
+				}
+				if !got.ExpiresAt.Equal(expiresAt) {
+					t.Errorf("expires_at = %v, want %v", got.ExpiresAt, expiresAt)
+				}
+				if age, err := db.GetVerificationCodeAge(email); err != nil || age < 0 || age > time.Minute {
+					t.Errorf("GetVerificationCodeAge = %v, %v; want a few seconds", age, err)
+				}
+			})
+		}
+	})
+}
+
+func mustSaveCode(t *testing.T, db *DB, email, code string, expiresAt time.Time) {
+	t.Helper()
+	if err := db.SaveVerificationCode(email, code, expiresAt); err != nil {
+		t.Fatalf("SaveVerificationCode: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+// Package email renders the emails Licensify sends to customers and delivers
+// them through a pluggable Transport (the Resend API or SMTP).
+package email
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// ErrNotConfigured is returned when sending through a nil Client
+var ErrNotConfigured = errors.New("email is not configured (set SMTP_HOST or RESEND_API_KEY)")
+
+// Transport delivers one rendered email. text is the plaintext alternative
+// to html, for clients and screen readers that don't render HTML.
+type Transport interface {
+	Send(to, subject, html, text string) error
+}
+
+// Client renders emails from its Templates and sends them through its
+// Transport
+type Client struct {
+	transport Transport
+
+	// MaxAttempts is how often an email is tried before giving up (default 3)
+	MaxAttempts int
+	// BaseDelay is the wait before the first retry. It doubles for each
+	// further retry, with jitter, unless the server asks for longer.
+	BaseDelay time.Duration
+	// Timeout caps the total time spent on one email, retries included;
+	// 0 means no cap
+	Timeout time.Duration
+	// Templates renders the HTML part of each email (default: the built-in
+	// templates)
+	Templates *Templates
+}
+
+// NewClient returns a Client sending through transport. A nil *Client is
+// valid and fails every send with ErrNotConfigured.
+func NewClient(transport Transport) *Client {
+	return &Client{
+		transport:   transport,
+		MaxAttempts: DefaultMaxAttempts,
+		BaseDelay:   DefaultBaseDelay,
+		Timeout:     DefaultSendTimeout,
+		Templates:   DefaultTemplates(),
+	}
+}
+
+var funcs = map[string]interface{}{
+	"upper": strings.ToUpper,
+	"limit": formatLimit,
+}
+
+var verificationTextTemplate = texttemplate.Must(texttemplate.New("verification").Funcs(funcs).Parse(`Verify Your Email
+
+Your verification code is: {{.Code}}
+
+Run: licensify init --email={{.Email}} --verify={{.Code}}
+
+Free Tier: 10 scans/day
+`))
+
+var licenseTextTemplate = texttemplate.Must(texttemplate.New("license").Funcs(funcs).Parse(`Your Licensify License
+
+Your license key: {{.LicenseKey}}
+
+Tier: {{upper .Tier}} | Daily Limit: {{.DailyLimit}} scans
+
+Quick start: licensify activate {{.LicenseKey}}
+`))
+
+var tierChangeTextTemplate = texttemplate.Must(texttemplate.New("tier_change").Funcs(funcs).Parse(`Your Licensify plan has changed
+
+Based on your recent usage, license {{.LicenseKey}} is now on the {{.TierName}} plan.
+
+Daily Limit: {{limit .DailyLimit}} | Monthly Limit: {{limit .MonthlyLimit}}
+
+Your license key stays the same. No action is needed.
+`))
+
+var usageThresholdTextTemplate = texttemplate.Must(texttemplate.New("usage_threshold").Funcs(funcs).Parse(`You have used {{.Threshold}}% of your {{.Period}} limit
+
+License {{.LicenseKey}} has made {{.Usage}} of its {{.Limit}} {{.Period}} requests.
+
+Consider upgrading your plan if you regularly need a higher limit.
+`))
+
+var upgradeTextTemplate = texttemplate.Must(texttemplate.New("upgrade").Funcs(funcs).Parse(`License {{.Action}}!
+
+Hi {{.Name}},
+
+Your license has been {{.Action}} from {{.OldTier}} to {{upper .NewTier}}.
+
+Your new license key: {{.LicenseKey}}
+
+New limit: {{if eq .DailyLimit -1}}unlimited requests{{else}}{{.DailyLimit}} requests/day{{end}}
+
+Save the new key and update your application with it. Your previous license key has been deactivated and will no longer work.
+
+Best regards,
+The Licensify Team
+`))
+
+var migrationTextTemplate = texttemplate.Must(texttemplate.New("migration").Funcs(funcs).Parse(`Your License Tier Has Been Updated
+
+Hi {{.Name}},
+
+Your license tier has been migrated to a new plan:
+
+Previous tier: {{.OldTierName}} ({{.OldTier}})
+New tier:      {{.NewTierName}} ({{.NewTier}})
+New limit:     {{if eq .DailyLimit -1}}unlimited requests{{else}}{{.DailyLimit}} requests/day{{end}}
+
+Your license key remains the same: {{.LicenseKey}}
+No action is required from you.
+
+Best regards,
+The Licensify Team
+`))
+
+var welcomeTextTemplate = texttemplate.Must(texttemplate.New("welcome").Funcs(funcs).Parse(`Welcome to Licensify!
+
+Hi {{.Name}},
+
+Your {{.Tier}} license is ready: {{.LicenseKey}}
+
+Valid until {{.ExpiresAt}}. Save the key in a secure location and activate it with: licensify activate --key {{.LicenseKey}}
+
+Best regards,
+The Licensify Team
+`))
+
+var renewalTextTemplate = texttemplate.Must(texttemplate.New("renewal").Funcs(funcs).Parse(`Your Licensify license expires soon
+
+Hi {{.Name}},
+
+Your {{.Tier}} license {{.LicenseKey}} expires on {{.ExpiresAt}}{{if eq .DaysLeft 1}}, tomorrow{{else if gt .DaysLeft 1}}, in {{.DaysLeft}} days{{end}}.
+
+Renew before then to keep using it without interruption. Reply to this email if you have any questions.
+
+Best regards,
+The Licensify Team
+`))
+
+var renewedTextTemplate = texttemplate.Must(texttemplate.New("renewed").Funcs(funcs).Parse(`Your Licensify license has been renewed
+
+Hi {{.Name}},
+
+Thank you for renewing. Your {{.Tier}} license {{.LicenseKey}} {{if .ExpiresAt}}is now valid until {{.ExpiresAt}}{{else}}is now a lifetime license{{end}}.
+
+Your license key stays the same, so there is nothing to update.
+
+Best regards,
+The Licensify Team
+`))
+
+// SendVerification emails a signup verification code
+func (c *Client) SendVerification(to, code string) error {
+	return c.send(to, "Verify Your Email - Licensify", "verification", verificationTextTemplate, map[string]interface{}{
+		"Email": to,
+		"Code":  code,
+	})
+}
+
+// SendLicense emails a newly issued license key
+func (c *Client) SendLicense(to, licenseKey, tier string, dailyLimit int) error {
+	return c.send(to, "Your Licensify License Key", "license", licenseTextTemplate, map[string]interface{}{
+		"LicenseKey": licenseKey,
+		"Tier":       tier,
+		"DailyLimit": dailyLimit,
+	})
+}
+
+// SendTierChange tells a customer their license moved to another tier
+func (c *Client) SendTierChange(to, licenseKey, tierName string, dailyLimit, monthlyLimit int) error {
+	return c.send(to, "Your Licensify plan has changed", "tier_change", tierChangeTextTemplate, map[string]interface{}{
+		"LicenseKey":   licenseKey,
+		"TierName":     tierName,
+		"DailyLimit":   dailyLimit,
+		"MonthlyLimit": monthlyLimit,
+	})
+}
+
+// SendUsageThreshold warns a customer that usage for period ("daily" or
+// "monthly") reached threshold percent of the limit
+func (c *Client) SendUsageThreshold(to, licenseKey, period string, threshold, usage, limit int) error {
+	subject := fmt.Sprintf("You have used %d%% of your %s Licensify limit", threshold, period)
+	return c.send(to, subject, "usage_threshold", usageThresholdTextTemplate, map[string]interface{}{
+		"LicenseKey": licenseKey,
+		"Period":     period,
+		"Threshold":  threshold,
+		"Usage":      usage,
+		"Limit":      limit,
+	})
+}
+
+// SendWelcome emails a customer the license an operator created for them.
+// expiresAt is a display date, e.g. "January 2, 2006" or "Never".
+func (c *Client) SendWelcome(to, name, tier, licenseKey, expiresAt string) error {
+	return c.send(to, "Your Licensify License Key", "welcome", welcomeTextTemplate, map[string]interface{}{
+		"Name":       name,
+		"Tier":       tier,
+		"LicenseKey": licenseKey,
+		"ExpiresAt":  expiresAt,
+	})
+}
+
+// SendUpgradeNotice emails the new license key after a license moved from
+// oldTier to newTier. A move to the free tier is worded as a change rather
+// than an upgrade.
+func (c *Client) SendUpgradeNotice(to, name, oldTier, newTier, licenseKey string, dailyLimit int) error {
+	action := "upgraded"
+	if newTier == "free" {
+		action = "changed"
+	}
+	subject := fmt.Sprintf("Your License Has Been %s to %s!", strings.ToUpper(action[:1])+action[1:], strings.ToUpper(newTier))
+	return c.send(to, subject, "upgrade", upgradeTextTemplate, map[string]interface{}{
+		"Action":     action,
+		"Name":       name,
+		"OldTier":    oldTier,
+		"NewTier":    newTier,
+		"LicenseKey": licenseKey,
+		"DailyLimit": dailyLimit,
+	})
+}
+
+// SendMigrationNotice tells a customer their license was migrated to another
+// tier, keeping the same key
+func (c *Client) SendMigrationNotice(to, name, oldTier, oldTierName, newTier, newTierName string, dailyLimit int, licenseKey string) error {
+	return c.send(to, "Your License Has Been Migrated to "+newTierName, "migration", migrationTextTemplate, map[string]interface{}{
+		"Name":        name,
+		"OldTier":     oldTier,
+		"OldTierName": oldTierName,
+		"NewTier":     newTier,
+		"NewTierName": newTierName,
+		"DailyLimit":  dailyLimit,
+		"LicenseKey":  licenseKey,
+	})
+}
+
+// SendRenewalReminder warns a customer that their license expires in
+// daysLeft days. expiresAt is a display date, as for SendWelcome.
+func (c *Client) SendRenewalReminder(to, name, tier, licenseKey, expiresAt string, daysLeft int) error {
+	return c.send(to, "Your Licensify license expires on "+expiresAt, "renewal", renewalTextTemplate, map[string]interface{}{
+		"Name":       name,
+		"Tier":       tier,
+		"LicenseKey": licenseKey,
+		"ExpiresAt":  expiresAt,
+		"DaysLeft":   daysLeft,
+	})
+}
+
+// SendRenewalConfirmation confirms that a license was extended in place to
+// expiresAt, a display date as for SendWelcome. An empty expiresAt means the
+// license is now lifetime.
+func (c *Client) SendRenewalConfirmation(to, name, tier, licenseKey, expiresAt string) error {
+	return c.send(to, "Your Licensify license has been renewed", "renewed", renewedTextTemplate, map[string]interface{}{
+		"Name":       name,
+		"Tier":       tier,
+		"LicenseKey": licenseKey,
+		"ExpiresAt":  expiresAt,
+	})
+}
+
+func (c *Client) send(to, subject, name string, textTmpl *texttemplate.Template, data interface{}) error {
+	if c == nil {
+		return ErrNotConfigured
+	}
+	templates := c.Templates
+	if templates == nil {
+		templates = defaultTemplates
+	}
+	html, err := templates.Render(name, data)
+	if err != nil {
+		return err
+	}
+	var text bytes.Buffer
+	if err := textTmpl.Execute(&text, data); err != nil {
+		return fmt.Errorf("failed to render %s text email: %w", textTmpl.Name(), err)
+	}
+	return c.sendWithRetry(to, subject, html, text.String())
+}
+
+// formatLimit renders -1 as "Unlimited"
+func formatLimit(limit int) string {
+	if limit == -1 {
+		return "Unlimited"
+	}
+	return strconv.Itoa(limit)
+}
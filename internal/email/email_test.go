@@ -0,0 +1,146 @@
+package email
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	texttemplate "text/template"
+)
+
+// message is one email handed to a fakeTransport
+type message struct {
+	to, subject, html, text string
+}
+
+// fakeTransport records what it is asked to send and fails with errs in
+// turn, succeeding once they run out
+type fakeTransport struct {
+	mu   sync.Mutex
+	sent []message
+	errs []error
+}
+
+func (f *fakeTransport) Send(to, subject, html, text string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, message{to, subject, html, text})
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	return nil
+}
+
+func renderText(t *testing.T, tmpl *texttemplate.Template, data interface{}) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		t.Fatalf("render %s: %v", tmpl.Name(), err)
+	}
+	return buf.String()
+}
+
+func TestTextTemplates(t *testing.T) {
+	tests := []struct {
+		tmpl *texttemplate.Template
+		data map[string]interface{}
+		want []string
+	}{
+		{
+			verificationTextTemplate,
+			map[string]interface{}{"Email": "alice@example.com", "Code": "482913"},
+			[]string{"482913", "licensify init --email=alice@example.com --verify=482913"},
+		},
+		{
+			licenseTextTemplate,
+			map[string]interface{}{"LicenseKey": "LIC-ABCD-1234", "Tier": "pro", "DailyLimit": 1000},
+			[]string{"LIC-ABCD-1234", "licensify activate LIC-ABCD-1234", "Tier: PRO"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tmpl.Name(), func(t *testing.T) {
+			text := renderText(t, tt.tmpl, tt.data)
+			for _, want := range tt.want {
+				if !strings.Contains(text, want) {
+					t.Errorf("text is missing %q:\n%s", want, text)
+				}
+			}
+		})
+	}
+}
+
+func TestSendPassesBothParts(t *testing.T) {
+	transport := &fakeTransport{}
+	if err := NewClient(transport).SendVerification("alice@example.com", "482913"); err != nil {
+		t.Fatalf("SendVerification: %v", err)
+	}
+	if len(transport.sent) != 1 {
+		t.Fatalf("sent %d emails, want 1", len(transport.sent))
+	}
+	msg := transport.sent[0]
+	if msg.to != "alice@example.com" || !strings.Contains(msg.html, "482913") || !strings.Contains(msg.text, "482913") {
+		t.Fatalf("sent %+v, want the code in both parts", msg)
+	}
+
+	var nilClient *Client
+	if err := nilClient.SendVerification("alice@example.com", "482913"); !errors.Is(err, ErrNotConfigured) {
+		t.Fatalf("nil client: error = %v, want ErrNotConfigured", err)
+	}
+}
+
+func TestUpgradeAndMigrationNotices(t *testing.T) {
+	tests := []struct {
+		name    string
+		send    func(c *Client) error
+		subject string
+		want    []string // in both the HTML and the text
+	}{
+		{
+			name: "upgrade",
+			send: func(c *Client) error {
+				return c.SendUpgradeNotice("alice@example.com", "Alice", "basic", "pro", "LIC-NEW-0001", 1000)
+			},
+			subject: "Your License Has Been Upgraded to PRO!",
+			want:    []string{"Alice", "upgraded", "basic", "PRO", "LIC-NEW-0001", "1000 requests/day"},
+		},
+		{
+			name: "downgrade to free",
+			send: func(c *Client) error {
+				return c.SendUpgradeNotice("alice@example.com", "Alice", "pro", "free", "LIC-NEW-0002", -1)
+			},
+			subject: "Your License Has Been Changed to FREE!",
+			want:    []string{"changed", "FREE", "LIC-NEW-0002", "unlimited requests"},
+		},
+		{
+			name: "migration",
+			send: func(c *Client) error {
+				return c.SendMigrationNotice("bob@example.com", "Bob", "pro-legacy", "Pro (legacy)", "pro", "Pro", 5000, "LIC-KEPT-0003")
+			},
+			subject: "Your License Has Been Migrated to Pro",
+			want:    []string{"Bob", "Pro (legacy)", "pro-legacy", "LIC-KEPT-0003", "5000 requests/day"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transport := &fakeTransport{}
+			if err := tt.send(NewClient(transport)); err != nil {
+				t.Fatalf("send: %v", err)
+			}
+			msg := transport.sent[0]
+			if msg.subject != tt.subject {
+				t.Errorf("subject = %q, want %q", msg.subject, tt.subject)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(msg.html, want) {
+					t.Errorf("html is missing %q", want)
+				}
+				if !strings.Contains(msg.text, want) {
+					t.Errorf("text is missing %q:\n%s", want, msg.text)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const resendURL = "https://api.resend.com/emails"
+
+// ResendTransport sends email through the Resend HTTP API
+type ResendTransport struct {
+	APIKey     string
+	From       string
+	HTTPClient *http.Client
+}
+
+// NewResendTransport returns a transport sending as from with apiKey
+func NewResendTransport(apiKey, from string) *ResendTransport {
+	return &ResendTransport{
+		APIKey:     apiKey,
+		From:       from,
+		HTTPClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Send implements Transport
+func (t *ResendTransport) Send(to, subject, html, text string) error {
+	payload, err := json.Marshal(map[string]interface{}{
+		"from":    t.From,
+		"to":      []string{to},
+		"subject": subject,
+		"html":    html,
+		"text":    text,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, resendURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+t.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return &APIError{
+			StatusCode: resp.StatusCode,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+	}
+	return nil
+}
+
+// APIError is a non-2xx response from the Resend API
+type APIError struct {
+	StatusCode int
+	Body       string
+	RetryAfter time.Duration // from the Retry-After header, 0 if absent
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("resend API error (HTTP %d): %s", e.StatusCode, e.Body)
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(t); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
@@ -0,0 +1,138 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc lets a test answer the Resend API's requests
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+// resendResponse is a Resend API response with status and headers
+func resendResponse(status int, header http.Header) *http.Response {
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(`{"id":"email-1"}`))}
+}
+
+func TestResendPayloadIncludesText(t *testing.T) {
+	var payload map[string]interface{}
+	transport := NewResendTransport("re_test", "Licensify <noreply@example.com>")
+	transport.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		if got := r.Header.Get("Authorization"); got != "Bearer re_test" {
+			t.Errorf("Authorization = %q", got)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		return resendResponse(http.StatusOK, nil), nil
+	})}
+
+	if err := NewClient(transport).SendLicense("alice@example.com", "LIC-TEXT-KEY", "pro", 1000); err != nil {
+		t.Fatalf("SendLicense: %v", err)
+	}
+	text, _ := payload["text"].(string)
+	html, _ := payload["html"].(string)
+	if !strings.Contains(text, "LIC-TEXT-KEY") || !strings.Contains(text, "licensify activate LIC-TEXT-KEY") {
+		t.Fatalf("text = %q, want the key and the activate command", text)
+	}
+	if !strings.Contains(html, "LIC-TEXT-KEY") || strings.Contains(text, "<") {
+		t.Fatalf("html = %q, text = %q: want the key in HTML and no markup in the text", html, text)
+	}
+	if to, _ := payload["to"].([]interface{}); len(to) != 1 || to[0] != "alice@example.com" {
+		t.Fatalf("to = %v", payload["to"])
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		header   http.Header
+		wantErr  bool
+		attempts int
+	}{
+		{"flaky twice then sent", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusOK}, nil, false, 3},
+		{"server errors exhaust the attempts", []int{500, 502, 503, 504}, nil, true, 3},
+		{"client error fails fast", []int{http.StatusUnprocessableEntity, http.StatusOK}, nil, true, 1},
+		{"retry after is honoured", []int{http.StatusTooManyRequests, http.StatusOK}, http.Header{"Retry-After": {"1"}}, false, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			transport := NewResendTransport("re_test", "noreply@example.com")
+			transport.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+				status := tt.statuses[attempts]
+				attempts++
+				return resendResponse(status, tt.header), nil
+			})}
+			client := NewClient(transport)
+			client.BaseDelay = time.Millisecond
+
+			start := time.Now()
+			err := client.SendVerification("alice@example.com", "482913")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if attempts != tt.attempts {
+				t.Fatalf("attempts = %d, want %d", attempts, tt.attempts)
+			}
+			var apiErr *APIError
+			if tt.wantErr && !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want an APIError", err)
+			}
+			if tt.header != nil && time.Since(start) < time.Second {
+				t.Fatalf("retried after %v, before the Retry-After of 1s", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestSendTimeoutCapsRetries(t *testing.T) {
+	var attempts int
+	transport := NewResendTransport("re_test", "noreply@example.com")
+	transport.HTTPClient = &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		attempts++
+		return resendResponse(http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}}), nil
+	})}
+	client := NewClient(transport)
+	client.Timeout = time.Second
+
+	start := time.Now()
+	if err := client.SendVerification("alice@example.com", "482913"); err == nil {
+		t.Fatal("expected the rate limit error")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || attempts != 1 {
+		t.Fatalf("gave up after %v and %d attempt(s), want at once when the wait passes the timeout", elapsed, attempts)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: 429}, true},
+		{&APIError{StatusCode: 500}, true},
+		{&APIError{StatusCode: 401}, false},
+		{&textproto.Error{Code: 451, Msg: "try again later"}, true},
+		{&textproto.Error{Code: 550, Msg: "no such user"}, false},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{errors.New("invalid recipient"), false},
+	}
+	for _, tt := range tests {
+		if got, _ := retryable(tt.err); got != tt.want {
+			t.Errorf("retryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"net/textproto"
+	"time"
+)
+
+// Retry defaults for NewClient
+const (
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = time.Second
+	DefaultSendTimeout = 30 * time.Second
+)
+
+// sendWithRetry calls the transport until it succeeds, fails permanently,
+// runs out of attempts or would run past the Client's Timeout
+func (c *Client) sendWithRetry(to, subject, html, text string) error {
+	deadline := time.Now().Add(c.Timeout)
+	delay := c.BaseDelay
+	for attempt := 1; ; attempt++ {
+		err := c.transport.Send(to, subject, html, text)
+		if err == nil {
+			return nil
+		}
+		retry, retryAfter := retryable(err)
+		if !retry || attempt >= c.MaxAttempts {
+			return err
+		}
+
+		// Equal jitter: between half and all of the exponential delay
+		wait := delay/2 + rand.N(delay/2+1)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if c.Timeout > 0 && time.Now().Add(wait).After(deadline) {
+			return err
+		}
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// retryable reports whether a failed send may succeed if repeated, and how
+// long the server asked to wait first. Network errors, rate limiting, server
+// errors and temporary SMTP rejections are retried; anything else, such as a
+// rejected address or bad credentials, fails at once.
+func retryable(err error) (bool, time.Duration) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == 429 || apiErr.StatusCode >= 500, apiErr.RetryAfter
+	}
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500, 0
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr), 0
+}
@@ -0,0 +1,188 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP connection security modes (SMTP_TLS)
+const (
+	SMTPStartTLS = "starttls" // plain connection upgraded with STARTTLS, usually port 587
+	SMTPTLS      = "tls"      // TLS from the start, usually port 465
+	SMTPNone     = "none"     // unencrypted, for local relays only
+)
+
+// smtpTimeout bounds one delivery, from dialing to QUIT
+const smtpTimeout = 30 * time.Second
+
+// SMTPTransport sends email through an SMTP server as a multipart message
+// with the plaintext and HTML alternatives
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string // no AUTH when empty
+	Password string
+	Security string // SMTPStartTLS, SMTPTLS or SMTPNone
+	From     string // "Name <address>" or a bare address
+}
+
+// Send implements Transport
+func (t *SMTPTransport) Send(to, subject, htmlBody, text string) error {
+	from, err := mail.ParseAddress(t.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %w", t.From, err)
+	}
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", to, err)
+	}
+	msg, err := buildMessage(from, rcpt, subject, htmlBody, text, time.Now())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	tlsConfig := &tls.Config{ServerName: t.Host, MinVersion: tls.VersionTLS12}
+	var conn net.Conn
+	if t.Security == SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(smtpTimeout))
+
+	c, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	if t.Security == SMTPStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server %s does not support STARTTLS (set SMTP_TLS=tls or none)", t.Host)
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+	if t.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM rejected: %w", err)
+	}
+	if err := c.Rcpt(rcpt.Address); err != nil {
+		return fmt.Errorf("SMTP RCPT TO rejected: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA rejected: %w", err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected message: %w", err)
+	}
+	return c.Quit()
+}
+
+// buildMessage renders a multipart/alternative message with the plaintext
+// part followed by the HTML. Without text, one is derived from htmlBody.
+func buildMessage(from, to *mail.Address, subject, htmlBody, text string, now time.Time) ([]byte, error) {
+	if text == "" {
+		text = htmlToText(htmlBody)
+	}
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", text},
+		{"text/html; charset=utf-8", htmlBody},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	header := func(name, value string) { fmt.Fprintf(&msg, "%s: %s\r\n", name, value) }
+	header("From", from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", subject))
+	header("Date", now.Format(time.RFC1123Z))
+	header("Message-ID", messageID(from.Address))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func messageID(from string) string {
+	domain := "licensify"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	id := make([]byte, 12)
+	_, _ = rand.Read(id)
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(id), domain)
+}
+
+var (
+	headRe       = regexp.MustCompile(`(?is)<(head|style|script)\b.*?</(head|style|script)>`)
+	blockEndRe   = regexp.MustCompile(`(?i)<br\s*/?>|</(p|div|h[1-6]|li|tr)>`)
+	tagRe        = regexp.MustCompile(`<[^>]*>`)
+	blankLinesRe = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText reduces an HTML email to readable plain text: markup and
+// styles are dropped, block elements end lines and entities are decoded
+func htmlToText(htmlBody string) string {
+	text := headRe.ReplaceAllString(htmlBody, "")
+	text = blockEndRe.ReplaceAllString(text, "\n")
+	text = tagRe.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text = blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text) + "\n"
+}
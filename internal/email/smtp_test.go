@@ -0,0 +1,175 @@
+package email
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// smtpCapture is what fakeSMTPServer received for one message
+type smtpCapture struct {
+	from, to string
+	data     string
+}
+
+// fakeSMTPServer accepts one SMTP session without TLS or AUTH and sends
+// what it received on the returned channel
+func fakeSMTPServer(t *testing.T) (host string, port int, received <-chan smtpCapture) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	ch := make(chan smtpCapture, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = io.WriteString(conn, line+"\r\n") }
+
+		var got smtpCapture
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch {
+			case verb == "EHLO" || verb == "HELO":
+				reply("250 fake")
+			case strings.HasPrefix(strings.ToUpper(line), "MAIL FROM:"):
+				got.from = line[len("MAIL FROM:"):]
+				reply("250 OK")
+			case strings.HasPrefix(strings.ToUpper(line), "RCPT TO:"):
+				got.to = line[len("RCPT TO:"):]
+				reply("250 OK")
+			case verb == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(line, "."))
+				}
+				got.data = data.String()
+				reply("250 queued")
+			case verb == "QUIT":
+				reply("221 bye")
+				ch <- got
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, ch
+}
+
+func TestSMTPTransportSend(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	transport := &SMTPTransport{
+		Host:     host,
+		Port:     port,
+		Security: SMTPNone,
+		From:     "Licensify <noreply@example.com>",
+	}
+
+	html := `<html><head><style>p{}</style></head><body><p>Your code is <b>123456</b></p></body></html>`
+	if err := transport.Send("alice@example.com", "Vérifiez votre e-mail", html, "Your code is 123456\n"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	got := <-received
+
+	if got.from != "<noreply@example.com>" || got.to != "<alice@example.com>" {
+		t.Fatalf("envelope = %s -> %s", got.from, got.to)
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatalf("parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Vérifiez votre e-mail" {
+		t.Fatalf("Subject = %q, %v", subject, err)
+	}
+	for header, want := range map[string]string{
+		"From":         `"Licensify" <noreply@example.com>`,
+		"To":           "<alice@example.com>",
+		"MIME-Version": "1.0",
+	} {
+		if got := msg.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q, want one in the sender's domain", id)
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", mediaType, err)
+	}
+	parts := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := parts.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read part: %v", err)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+	// The plaintext alternative comes first, so clients prefer the HTML
+	if strings.Join(types, ", ") != "text/plain; charset=utf-8, text/html; charset=utf-8" {
+		t.Fatalf("parts = %v", types)
+	}
+	// DATA sends CRLF line endings
+	if bodies[0] != "Your code is 123456\r\n" || bodies[1] != html {
+		t.Fatalf("bodies = %q", bodies)
+	}
+}
+
+func TestSMTPTransportRejectsStartTLSWithoutSupport(t *testing.T) {
+	host, port, _ := fakeSMTPServer(t)
+	transport := &SMTPTransport{Host: host, Port: port, Security: SMTPStartTLS, From: "noreply@example.com"}
+	err := transport.Send("alice@example.com", "Subject", "<p>hi</p>", "")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("error = %v, want STARTTLS to be required", err)
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	got := htmlToText(`<html><head><title>x</title></head><body><h1>Hello</h1><p>Code:   <b>42</b> &amp; more</p><br>bye</body></html>`)
+	if want := "Hello\nCode: 42 & more\n\nbye\n"; got != want {
+		t.Fatalf("htmlToText = %q, want %q", got, want)
+	}
+}
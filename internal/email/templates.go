@@ -0,0 +1,169 @@
+package email
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template/parse"
+)
+
+//go:embed templates/*.html
+var defaultTemplateFS embed.FS
+
+// requiredFields lists the HTML templates an operator can override, by file
+// name without ".html", and the fields each must use. A template missing
+// one of them would send an email without its point, such as a
+// verification email without the code.
+var requiredFields = map[string][]string{
+	"verification":    {"Code"},
+	"license":         {"LicenseKey"},
+	"tier_change":     {"LicenseKey", "TierName"},
+	"usage_threshold": {"Threshold", "Period"},
+	"upgrade":         {"LicenseKey", "NewTier"},
+	"migration":       {"NewTierName"},
+	"welcome":         {"LicenseKey"},
+	"renewal":         {"LicenseKey", "ExpiresAt"},
+	"renewed":         {"LicenseKey", "ExpiresAt"},
+}
+
+// Templates holds the parsed HTML email templates
+type Templates struct {
+	html map[string]*template.Template
+}
+
+var defaultTemplates = mustLoadDefaults()
+
+// DefaultTemplates returns the built-in HTML templates
+func DefaultTemplates() *Templates {
+	return defaultTemplates
+}
+
+// LoadTemplates parses the built-in templates and replaces each one that
+// has a matching file in dir (verification.html, license.html, ...). An
+// empty dir returns the built-in templates. Overrides are validated up
+// front, so a broken file fails at startup rather than on the first send.
+func LoadTemplates(dir string) (*Templates, error) {
+	if dir == "" {
+		return defaultTemplates, nil
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("email template directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("email template directory %s is not a directory", dir)
+	}
+
+	t := &Templates{html: make(map[string]*template.Template, len(requiredFields))}
+	for name, tmpl := range defaultTemplates.html {
+		t.html[name] = tmpl
+	}
+	for name := range requiredFields {
+		path := filepath.Join(dir, name+".html")
+		data, err := os.ReadFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read email template: %w", err)
+		}
+		tmpl, err := parseTemplate(name, string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		t.html[name] = tmpl
+	}
+	return t, nil
+}
+
+// Render executes the named HTML template
+func (t *Templates) Render(name string, data interface{}) (string, error) {
+	tmpl, ok := t.html[name]
+	if !ok {
+		return "", fmt.Errorf("unknown email template %q", name)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	return buf.String(), nil
+}
+
+func mustLoadDefaults() *Templates {
+	t := &Templates{html: make(map[string]*template.Template, len(requiredFields))}
+	for name := range requiredFields {
+		data, err := defaultTemplateFS.ReadFile("templates/" + name + ".html")
+		if err != nil {
+			panic(err)
+		}
+		t.html[name] = template.Must(parseTemplate(name, string(data)))
+	}
+	return t
+}
+
+// parseTemplate parses one HTML template and checks it uses every field
+// in requiredFields
+func parseTemplate(name, text string) (*template.Template, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	used := make(map[string]bool)
+	collectFields(tmpl.Tree.Root, used)
+	var missing []string
+	for _, field := range requiredFields[name] {
+		if !used[field] {
+			missing = append(missing, "{{."+field+"}}")
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("template %s must use %s", name, strings.Join(missing, ", "))
+	}
+	return tmpl, nil
+}
+
+// collectFields records the top-level field names (.Field) used anywhere in
+// a template
+func collectFields(node parse.Node, used map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectFields(child, used)
+		}
+	case *parse.ActionNode:
+		collectFields(n.Pipe, used)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectFields(cmd, used)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectFields(arg, used)
+		}
+	case *parse.FieldNode:
+		used[n.Ident[0]] = true
+	case *parse.IfNode:
+		collectFields(&n.BranchNode, used)
+	case *parse.RangeNode:
+		collectFields(&n.BranchNode, used)
+	case *parse.WithNode:
+		collectFields(&n.BranchNode, used)
+	case *parse.BranchNode:
+		collectFields(n.Pipe, used)
+		collectFields(n.List, used)
+		collectFields(n.ElseList, used)
+	case *parse.TemplateNode:
+		collectFields(n.Pipe, used)
+	}
+}
@@ -0,0 +1,95 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// templateDir writes files, by name, to a temporary template directory
+func templateDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadTemplatesCustom(t *testing.T) {
+	dir := templateDir(t, map[string]string{
+		"verification.html": `<p>Acme code for {{.Email}}: <strong>{{.Code}}</strong></p>`,
+		"license.html":      `<p>Acme key {{.LicenseKey}} on {{upper .Tier}}</p>`,
+		"notes.txt":         `not a template`,
+	})
+	templates, err := LoadTemplates(dir)
+	if err != nil {
+		t.Fatalf("LoadTemplates: %v", err)
+	}
+
+	transport := &fakeTransport{}
+	client := NewClient(transport)
+	client.Templates = templates
+	if err := client.SendVerification("alice@example.com", "482913"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SendLicense("alice@example.com", "LIC-ACME-0001", "pro", 1000); err != nil {
+		t.Fatal(err)
+	}
+	if want := "<p>Acme code for alice@example.com: <strong>482913</strong></p>"; transport.sent[0].html != want {
+		t.Fatalf("verification html = %q, want %q", transport.sent[0].html, want)
+	}
+	if want := "<p>Acme key LIC-ACME-0001 on PRO</p>"; transport.sent[1].html != want {
+		t.Fatalf("license html = %q, want %q", transport.sent[1].html, want)
+	}
+
+	// Templates without a file keep the built-in version
+	html, err := templates.Render("tier_change", map[string]interface{}{
+		"LicenseKey": "LIC-ACME-0001", "TierName": "Pro", "DailyLimit": 1000, "MonthlyLimit": -1,
+	})
+	if err != nil || strings.Contains(html, "Acme") || !strings.Contains(html, "LIC-ACME-0001") {
+		t.Fatalf("tier_change = %q, %v, want the built-in template", html, err)
+	}
+}
+
+func TestLoadTemplatesEscapesValues(t *testing.T) {
+	templates, err := LoadTemplates(templateDir(t, map[string]string{
+		"verification.html": `<p>{{.Email}} {{.Code}}</p>`,
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html, err := templates.Render("verification", map[string]interface{}{"Email": `<script>x</script>@example.com`, "Code": "1"})
+	if err != nil || strings.Contains(html, "<script>") {
+		t.Fatalf("html = %q, %v, want the address escaped", html, err)
+	}
+}
+
+func TestLoadTemplatesErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{"missing placeholder", map[string]string{"verification.html": `<p>Hello {{.Email}}</p>`}, "must use {{.Code}}"},
+		{"placeholder only in a comment", map[string]string{"license.html": `<!-- LicenseKey --><p>{{.Tier}}</p>`}, "must use {{.LicenseKey}}"},
+		{"syntax error", map[string]string{"license.html": `<p>{{.LicenseKey</p>`}, "license.html"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadTemplates(templateDir(t, tt.files)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+
+	if _, err := LoadTemplates(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatal("missing directory: expected an error")
+	}
+	if templates, err := LoadTemplates(""); err != nil || templates != DefaultTemplates() {
+		t.Fatalf("empty dir = %v, %v, want the built-in templates", templates, err)
+	}
+}
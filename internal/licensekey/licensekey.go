@@ -0,0 +1,137 @@
+package licensekey
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Errors returned by Validate and VerifyChecksum
+var (
+	ErrEmpty            = errors.New("license key is empty")
+	ErrMalformed        = errors.New("license key is malformed")
+	ErrChecksumMismatch = errors.New("license key checksum does not match, check it for typos")
+)
+
+// charset is used for random key parts and check characters
+const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// keyPattern matches generated keys: "LIC-YYYYMM-XXXXXX-XXXXXX" from the
+// server and "LIC-YYYYMM-TIER-XXXXXXXX" from licensify-admin, plus the
+// check character ("-C") on keys generated since checksums were added
+var keyPattern = regexp.MustCompile(`^LIC-[0-9]{6}-[A-Z0-9_-]+-[A-Z0-9]{6,8}(-[A-Z0-9])?$`)
+
+// GenerateKeyWithChecksum returns a new key in the server's format,
+// "LIC-YYYYMM-XXXXXX-XXXXXX-C", where C is the check character
+func GenerateKeyWithChecksum() (string, error) {
+	part1, err := RandomString(6)
+	if err != nil {
+		return "", err
+	}
+	part2, err := RandomString(6)
+	if err != nil {
+		return "", err
+	}
+	return AppendChecksum(fmt.Sprintf("LIC-%s-%s-%s", time.Now().Format("200601"), part1, part2)), nil
+}
+
+// TierPrefix returns the tier part of a licensify-admin key: the first four
+// letters, digits, "_" or "-" of the upper-cased tier name, which keeps the
+// key within keyPattern so its checksum is verified. Tier names with none of
+// those characters get "TIER".
+func TierPrefix(tier string) string {
+	var prefix strings.Builder
+	for _, r := range strings.ToUpper(tier) {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			prefix.WriteRune(r)
+			if prefix.Len() == 4 {
+				break
+			}
+		}
+	}
+	if prefix.Len() == 0 {
+		return "TIER"
+	}
+	return prefix.String()
+}
+
+// RandomString returns length random characters from A-Z and 0-9
+func RandomString(length int) (string, error) {
+	result := make([]byte, length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
+		if err != nil {
+			return "", fmt.Errorf("failed to generate license key: %w", err)
+		}
+		result[i] = charset[n.Int64()]
+	}
+	return string(result), nil
+}
+
+// AppendChecksum adds a check character to a generated key
+func AppendChecksum(key string) string {
+	return key + "-" + string(checkChar(key))
+}
+
+// HasChecksum reports whether key has the generated format with a check
+// character. Legacy keys and keys imported from other systems don't.
+func HasChecksum(key string) bool {
+	m := keyPattern.FindStringSubmatch(key)
+	return m != nil && m[1] != ""
+}
+
+// VerifyChecksum checks the check character of a key that has one. Keys
+// without a check character pass, since they may predate checksums.
+func VerifyChecksum(key string) error {
+	if !HasChecksum(key) {
+		return nil
+	}
+	body := key[:len(key)-2]
+	if key[len(key)-1] != checkChar(body) {
+		return ErrChecksumMismatch
+	}
+	return nil
+}
+
+// Validate checks that key has a generated format and, if it carries a check
+// character, that it matches. Keys imported from other systems keep their
+// own format and fail with ErrMalformed, so only reject them on that error
+// when the key is known to be generated here.
+func Validate(key string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return ErrEmpty
+	}
+	if !keyPattern.MatchString(key) {
+		return ErrMalformed
+	}
+	return VerifyChecksum(key)
+}
+
+// checkChar computes a Luhn mod 36 check character over the letters and
+// digits of s, which catches any single mistyped character and most swaps
+// of adjacent characters
+func checkChar(s string) byte {
+	const n = len(charset)
+	sum := 0
+	factor := 2
+	for i := len(s) - 1; i >= 0; i-- {
+		code := strings.IndexByte(charset, s[i])
+		if code < 0 {
+			continue
+		}
+		addend := factor * code
+		addend = addend/n + addend%n
+		sum += addend
+		if factor == 2 {
+			factor = 1
+		} else {
+			factor = 2
+		}
+	}
+	return charset[(n-sum%n)%n]
+}
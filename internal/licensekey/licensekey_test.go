@@ -0,0 +1,104 @@
+package licensekey
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// mistype replaces the character at i with another one from charset
+func mistype(key string, i int) string {
+	replacement := charset[(strings.IndexByte(charset, key[i])+1)%len(charset)]
+	return key[:i] + string(replacement) + key[i+1:]
+}
+
+func TestValidate(t *testing.T) {
+	serverKey := AppendChecksum("LIC-202601-ABC123-XYZ789")
+	adminKey := AppendChecksum("LIC-202601-PRO-ABCD1234")
+
+	tests := []struct {
+		name string
+		key  string
+		want error
+	}{
+		{"server key", serverKey, nil},
+		{"admin key", adminKey, nil},
+		{"admin key with hyphenated tier", AppendChecksum("LIC-202601-T-1-ABCD1234"), nil},
+		{"surrounding whitespace", "  " + serverKey + "\n", nil},
+		{"legacy server key", "LIC-202601-ABC123-XYZ789", nil},
+		{"legacy admin key", "LIC-202601-PRO-ABCD1234", nil},
+		{"empty", "", ErrEmpty},
+		{"blank", "   ", ErrEmpty},
+		{"lowercase", strings.ToLower(serverKey), ErrMalformed},
+		{"wrong prefix", "KEY-202601-ABC123-XYZ789", ErrMalformed},
+		{"short date", "LIC-2026-ABC123-XYZ789", ErrMalformed},
+		{"short random part", "LIC-202601-ABC123-XYZ78", ErrMalformed},
+		{"imported key", "acme-license-0001", ErrMalformed},
+		{"mistyped random character", mistype(serverKey, 12), ErrChecksumMismatch},
+		{"mistyped check character", mistype(serverKey, len(serverKey)-1), ErrChecksumMismatch},
+		{"mistyped tier", mistype(adminKey, 11), ErrChecksumMismatch},
+		{"swapped characters", serverKey[:12] + serverKey[13:14] + serverKey[12:13] + serverKey[14:], ErrChecksumMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.key); !errors.Is(err, tt.want) {
+				t.Fatalf("Validate(%q) = %v, want %v", tt.key, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyChecksumAllowsKeysWithoutOne(t *testing.T) {
+	for _, key := range []string{"LIC-202601-ABC123-XYZ789", "acme-license-0001", ""} {
+		if HasChecksum(key) {
+			t.Errorf("HasChecksum(%q) = true", key)
+		}
+		if err := VerifyChecksum(key); err != nil {
+			t.Errorf("VerifyChecksum(%q) = %v", key, err)
+		}
+	}
+}
+
+func TestGenerateKeyWithChecksum(t *testing.T) {
+	for i := 0; i < 50; i++ {
+		key, err := GenerateKeyWithChecksum()
+		if err != nil {
+			t.Fatalf("GenerateKeyWithChecksum: %v", err)
+		}
+		if !HasChecksum(key) {
+			t.Fatalf("generated key %q has no check character", key)
+		}
+		if err := Validate(key); err != nil {
+			t.Fatalf("generated key %q: %v", key, err)
+		}
+	}
+}
+
+func TestTierPrefix(t *testing.T) {
+	tests := []struct {
+		tier string
+		want string
+	}{
+		{"pro", "PRO"},
+		{"enterprise", "ENTE"},
+		{"tier-1", "TIER"},
+		{"t-1", "T-1"},
+		{"pro_plus", "PRO_"},
+		{"pro.plus", "PROP"},
+		{"équipe", "QUIP"},
+		{"免费", "TIER"},
+		{"", "TIER"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tier, func(t *testing.T) {
+			prefix := TierPrefix(tt.tier)
+			if prefix != tt.want {
+				t.Fatalf("TierPrefix(%q) = %q, want %q", tt.tier, prefix, tt.want)
+			}
+			key := AppendChecksum("LIC-202601-" + prefix + "-ABCD1234")
+			if !HasChecksum(key) {
+				t.Fatalf("key %q for tier %q skips checksum verification", key, tt.tier)
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+// Package logging sets up the server's log/slog logger. Text output keeps
+// the familiar "2026/01/15 10:04:12 message" lines of the standard log
+// package, and slog records add their level and key=value fields. JSON
+// output writes one object per line for log aggregators; lines still
+// written with log.Printf become JSON records too, with the text as their
+// message.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+)
+
+// Formats accepted by Setup
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Setup installs the default slog logger for format, writing to w
+func Setup(format string, w io.Writer) error {
+	switch format {
+	case FormatText, "":
+		// slog's own default handler already writes through the log package
+		log.SetOutput(w)
+	case FormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, nil)))
+	default:
+		return fmt.Errorf("must be %q or %q, got %q", FormatText, FormatJSON, format)
+	}
+	return nil
+}
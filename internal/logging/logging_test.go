@@ -0,0 +1,77 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// restoreLoggers puts the default slog and log loggers back after the test
+func restoreLoggers(t *testing.T) {
+	t.Helper()
+	previous, output, flags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetOutput(output)
+		log.SetFlags(flags)
+	})
+}
+
+func TestSetupJSON(t *testing.T) {
+	restoreLoggers(t)
+	var out bytes.Buffer
+	if err := Setup(FormatJSON, &out); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+
+	slog.Info("request", "method", "POST", "status", 200)
+	log.Printf("📦 Applied migration %s", "0001")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %s", len(lines), out.String())
+	}
+	var records []map[string]any
+	for _, line := range lines {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("line isn't JSON: %s", line)
+		}
+		if record["time"] == nil || record["level"] != "INFO" {
+			t.Fatalf("record = %v, want time and level", record)
+		}
+		records = append(records, record)
+	}
+	if records[0]["msg"] != "request" || records[0]["method"] != "POST" || records[0]["status"] != float64(200) {
+		t.Fatalf("slog record = %v", records[0])
+	}
+	// Lines still written with log.Printf keep their text as the message
+	if records[1]["msg"] != "📦 Applied migration 0001" {
+		t.Fatalf("log.Printf record = %v", records[1])
+	}
+}
+
+func TestSetupText(t *testing.T) {
+	restoreLoggers(t)
+	var out bytes.Buffer
+	for _, format := range []string{FormatText, ""} {
+		out.Reset()
+		if err := Setup(format, &out); err != nil {
+			t.Fatalf("Setup(%q): %v", format, err)
+		}
+		log.Printf("plain line")
+		if got := out.String(); !strings.HasSuffix(got, " plain line\n") || strings.HasPrefix(got, "{") {
+			t.Fatalf("Setup(%q) wrote %q, want a plain log line", format, got)
+		}
+	}
+}
+
+func TestSetupRejectsUnknownFormat(t *testing.T) {
+	restoreLoggers(t)
+	if err := Setup("logfmt", &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), `"logfmt"`) {
+		t.Fatalf("error = %v, want the format rejected", err)
+	}
+}
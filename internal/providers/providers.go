@@ -0,0 +1,303 @@
+package providers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Provider is an upstream API the server proxies requests to at
+// /proxy/<Name>/*
+type Provider struct {
+	Name        string            // routing name, e.g. "openrouter"
+	DisplayName string            // shown in logs and errors, defaults to Name
+	BaseURL     string            // scheme and host, e.g. "https://openrouter.ai"
+	PathPrefix  string            // prepended to every forwarded path, e.g. "/api"
+	DefaultPath string            // used when the client sends no path
+	AuthHeader  string            // header carrying the API key, empty for none
+	AuthScheme  string            // put before the key, e.g. "Bearer"
+	Headers     map[string]string // static headers sent with every request
+	Query       map[string]string // static query parameters, e.g. Azure's api-version
+	Timeout     time.Duration     // for buffered requests, 0 uses the server default
+	APIKey      string            // never read from the config file
+}
+
+// builtins are the providers supported without a config file. Each is
+// enabled by setting its API key.
+var builtins = []Provider{
+	{
+		Name:        "openai",
+		DisplayName: "OpenAI",
+		BaseURL:     "https://api.openai.com",
+		DefaultPath: "/v1/chat/completions",
+		AuthHeader:  "Authorization",
+		AuthScheme:  "Bearer",
+	},
+	{
+		Name:        "anthropic",
+		DisplayName: "Anthropic",
+		BaseURL:     "https://api.anthropic.com",
+		DefaultPath: "/v1/messages",
+		AuthHeader:  "x-api-key",
+		Headers:     map[string]string{"anthropic-version": "2023-06-01"},
+	},
+	{
+		Name:        "gemini",
+		DisplayName: "Gemini",
+		BaseURL:     "https://generativelanguage.googleapis.com",
+		DefaultPath: "/v1beta/models/gemini-pro:generateContent",
+		// Header rather than ?key= so the key never appears in URLs or logs
+		AuthHeader: "x-goog-api-key",
+	},
+}
+
+// Builtin returns a copy of the built-in provider called name, or nil
+func Builtin(name string) *Provider {
+	for _, p := range builtins {
+		if p.Name == name {
+			p.Headers = copyMap(p.Headers)
+			return &p
+		}
+	}
+	return nil
+}
+
+// ErrInvalidPath is returned by URL for a path that would leave the
+// provider's host
+var ErrInvalidPath = errors.New("invalid upstream path")
+
+// URL returns the upstream URL for path, the part of the request path
+// after /proxy/<Name>. path must be empty or start with "/", and the
+// result must stay on the BaseURL host, since the request carries the
+// provider's API key.
+func (p *Provider) URL(path string) (string, error) {
+	if path == "" || path == "/" {
+		path = p.DefaultPath
+	}
+	if path != "" && path[0] != '/' {
+		return "", fmt.Errorf("%w: %q must start with /", ErrInvalidPath, path)
+	}
+	raw := p.BaseURL + p.PathPrefix + path
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPath, err)
+	}
+	base, err := url.Parse(p.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("provider '%s' has invalid base_url: %w", p.Name, err)
+	}
+	if u.Scheme != base.Scheme || u.Host != base.Host || u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%w: %q leaves %s", ErrInvalidPath, path, base.Host)
+	}
+	if len(p.Query) > 0 {
+		query := url.Values{}
+		for name, value := range p.Query {
+			query.Set(name, value)
+		}
+		raw += "?" + query.Encode()
+	}
+	return raw, nil
+}
+
+// RequestHeaders returns the headers sent upstream: the static headers,
+// the API key and a JSON content type
+func (p *Provider) RequestHeaders() map[string]string {
+	headers := copyMap(p.Headers)
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	if p.AuthHeader != "" {
+		if p.AuthScheme != "" {
+			headers[p.AuthHeader] = p.AuthScheme + " " + p.APIKey
+		} else {
+			headers[p.AuthHeader] = p.APIKey
+		}
+	}
+	headers["Content-Type"] = "application/json"
+	return headers
+}
+
+func copyMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// Registry holds the providers requests can be proxied to
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]*Provider
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]*Provider)}
+}
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Register validates p and adds it to the registry. Names must be unique.
+func (r *Registry) Register(p Provider) error {
+	if !namePattern.MatchString(p.Name) {
+		return fmt.Errorf("provider name '%s' is invalid (use lowercase letters, digits, '-' and '_')", p.Name)
+	}
+	u, err := url.Parse(p.BaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("provider '%s' has invalid base_url '%s' (must be an http or https URL)", p.Name, p.BaseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("provider '%s' has a query or fragment in base_url, use query instead", p.Name)
+	}
+	p.BaseURL = strings.TrimSuffix(p.BaseURL, "/")
+	for field, path := range map[string]string{"path_prefix": p.PathPrefix, "default_path": p.DefaultPath} {
+		if path != "" && !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("provider '%s' has invalid %s '%s' (must start with /)", p.Name, field, path)
+		}
+	}
+	p.PathPrefix = strings.TrimSuffix(p.PathPrefix, "/")
+	if p.AuthScheme != "" && p.AuthHeader == "" {
+		return fmt.Errorf("provider '%s' has auth_scheme but no auth_header", p.Name)
+	}
+	if p.AuthHeader != "" && p.APIKey == "" {
+		return fmt.Errorf("provider '%s' has auth_header but no API key", p.Name)
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("provider '%s' has a negative timeout", p.Name)
+	}
+	if p.DisplayName == "" {
+		p.DisplayName = p.Name
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.providers[p.Name]; exists {
+		return fmt.Errorf("provider '%s' is defined more than once", p.Name)
+	}
+	r.providers[p.Name] = &p
+	return nil
+}
+
+// fileConfig is the layout of a providers file, a list of [[provider]]
+// tables in TOML or a {"provider": [...]} object in JSON
+type fileConfig struct {
+	Providers []providerConfig `toml:"provider" json:"provider"`
+}
+
+type providerConfig struct {
+	Name        string            `toml:"name" json:"name"`
+	DisplayName string            `toml:"display_name" json:"display_name"`
+	BaseURL     string            `toml:"base_url" json:"base_url"`
+	PathPrefix  string            `toml:"path_prefix" json:"path_prefix"`
+	DefaultPath string            `toml:"default_path" json:"default_path"`
+	AuthHeader  string            `toml:"auth_header" json:"auth_header"`
+	AuthScheme  string            `toml:"auth_scheme" json:"auth_scheme"`
+	APIKeyEnv   string            `toml:"api_key_env" json:"api_key_env"` // environment variable holding the key
+	Headers     map[string]string `toml:"headers" json:"headers"`
+	Query       map[string]string `toml:"query" json:"query"`
+	Timeout     string            `toml:"timeout" json:"timeout"` // e.g. "2m"
+}
+
+// RegisterFromConfig registers every provider defined in the TOML or JSON
+// file at path (chosen by extension, TOML unless it ends in .json).
+// apiKey looks up the value of each provider's api_key_env. Nothing is
+// registered if any provider is invalid.
+func (r *Registry) RegisterFromConfig(path string, apiKey func(env string) string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read provider configuration: %w", err)
+	}
+
+	var cfg fileConfig
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(data, &cfg)
+	} else {
+		_, err = toml.Decode(string(data), &cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse provider configuration: %w", err)
+	}
+	if len(cfg.Providers) == 0 {
+		return fmt.Errorf("no providers defined in %s", path)
+	}
+
+	// Validate into a scratch registry first so a bad entry doesn't leave
+	// the file half-registered
+	staged := NewRegistry()
+	for _, pc := range cfg.Providers {
+		p := Provider{
+			Name:        pc.Name,
+			DisplayName: pc.DisplayName,
+			BaseURL:     pc.BaseURL,
+			PathPrefix:  pc.PathPrefix,
+			DefaultPath: pc.DefaultPath,
+			AuthHeader:  pc.AuthHeader,
+			AuthScheme:  pc.AuthScheme,
+			Headers:     pc.Headers,
+			Query:       pc.Query,
+		}
+		if pc.Timeout != "" {
+			if p.Timeout, err = time.ParseDuration(pc.Timeout); err != nil {
+				return fmt.Errorf("provider '%s' has invalid timeout '%s'", pc.Name, pc.Timeout)
+			}
+		}
+		if pc.APIKeyEnv != "" {
+			if pc.AuthHeader == "" {
+				return fmt.Errorf("provider '%s' has api_key_env but no auth_header", pc.Name)
+			}
+			if p.APIKey = apiKey(pc.APIKeyEnv); p.APIKey == "" {
+				return fmt.Errorf("provider '%s' needs %s to be set", pc.Name, pc.APIKeyEnv)
+			}
+		} else if pc.AuthHeader != "" {
+			return fmt.Errorf("provider '%s' has auth_header but no api_key_env", pc.Name)
+		}
+		if err := staged.Register(p); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for name := range staged.providers {
+		if _, exists := r.providers[name]; exists {
+			return fmt.Errorf("provider '%s' is defined more than once", name)
+		}
+	}
+	for name, p := range staged.providers {
+		r.providers[name] = p
+	}
+	return nil
+}
+
+// Get returns the provider called name, or nil if it isn't registered
+func (r *Registry) Get(name string) *Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.providers[name]
+}
+
+// Names returns the registered provider names in sorted order
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
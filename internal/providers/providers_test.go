@@ -0,0 +1,109 @@
+package providers
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestProviderURL(t *testing.T) {
+	custom := Provider{
+		Name:        "azure",
+		BaseURL:     "https://example.openai.azure.com",
+		PathPrefix:  "/openai/deployments/gpt4",
+		DefaultPath: "/chat/completions",
+		Query:       map[string]string{"api-version": "2024-02-01"},
+	}
+
+	tests := []struct {
+		name     string
+		provider Provider
+		path     string
+		want     string
+		wantErr  bool
+	}{
+		{"default path", *Builtin("openai"), "", "https://api.openai.com/v1/chat/completions", false},
+		{"slash uses default path", *Builtin("anthropic"), "/", "https://api.anthropic.com/v1/messages", false},
+		{"client path", *Builtin("openai"), "/v1/embeddings", "https://api.openai.com/v1/embeddings", false},
+		{"prefix and query", custom, "", "https://example.openai.azure.com/openai/deployments/gpt4/chat/completions?api-version=2024-02-01", false},
+		{"double slash stays on host", *Builtin("openai"), "//evil.example/x", "https://api.openai.com//evil.example/x", false},
+		{"userinfo", *Builtin("gemini"), "@evil.example/x", "", true},
+		{"host suffix", *Builtin("gemini"), ".evil.example/x", "", true},
+		{"port", *Builtin("openai"), ":8080/x", "", true},
+		{"relative", *Builtin("openai"), "v1/chat", "", true},
+		{"query in path", *Builtin("openai"), "/v1/chat?key=x", "", true},
+		{"fragment in path", *Builtin("openai"), "/v1/chat#x", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.provider.URL(tt.path)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidPath) {
+					t.Fatalf("URL(%q) = %q, %v; want ErrInvalidPath", tt.path, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("URL(%q) = %q, %v; want %q", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuiltinRequestHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      string
+		want        string
+		defaultPath string
+		extra       map[string]string
+	}{
+		{"openai", "Authorization", "Bearer sk-test", "/v1/chat/completions", nil},
+		{"anthropic", "x-api-key", "sk-test", "/v1/messages", map[string]string{"anthropic-version": "2023-06-01"}},
+		{"gemini", "x-goog-api-key", "sk-test", "/v1beta/models/gemini-pro:generateContent", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Builtin(tt.name)
+			if p == nil {
+				t.Fatalf("no built-in provider %q", tt.name)
+			}
+			p.APIKey = "sk-test"
+			registry := NewRegistry()
+			if err := registry.Register(*p); err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			p = registry.Get(tt.name)
+			if p.DefaultPath != tt.defaultPath {
+				t.Fatalf("default path = %q, want %q", p.DefaultPath, tt.defaultPath)
+			}
+
+			headers := p.RequestHeaders()
+			if headers[tt.header] != tt.want {
+				t.Fatalf("%s = %q, want %q", tt.header, headers[tt.header], tt.want)
+			}
+			if headers["Content-Type"] != "application/json" {
+				t.Fatalf("Content-Type = %q", headers["Content-Type"])
+			}
+			for name, value := range tt.extra {
+				if headers[name] != value {
+					t.Fatalf("%s = %q, want %q", name, headers[name], value)
+				}
+			}
+			if want := 2 + len(tt.extra); len(headers) != want {
+				t.Fatalf("sent %d headers, want %d: %v", len(headers), want, headers)
+			}
+			// The key never goes into the URL
+			if u, _ := p.URL(""); u != p.BaseURL+p.DefaultPath {
+				t.Fatalf("URL = %q", u)
+			}
+		})
+	}
+}
+
+func TestBuiltinIsACopy(t *testing.T) {
+	p := Builtin("anthropic")
+	p.Headers["anthropic-version"] = "changed"
+	if Builtin("anthropic").Headers["anthropic-version"] != "2023-06-01" {
+		t.Fatal("changing a built-in provider's headers changed the built-in")
+	}
+}
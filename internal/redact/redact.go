@@ -0,0 +1,48 @@
+package redact
+
+import "strings"
+
+// Ends keeps the first head and last tail characters of s around "...".
+// Strings too short to hide anything are returned unchanged. Characters are
+// counted as runes, so multibyte UTF-8 is never split.
+func Ends(s string, head, tail int) string {
+	runes := []rune(s)
+	if len(runes) <= head+tail {
+		return s
+	}
+	return string(runes[:head]) + "..." + string(runes[len(runes)-tail:])
+}
+
+// PII redacts sensitive data for logging, showing the first 4 and last 4
+// characters for identification without full exposure
+func PII(s string) string {
+	if len([]rune(s)) <= 8 {
+		return "***"
+	}
+	return Ends(s, 4, 4)
+}
+
+// Key redacts a license or API key for display. Keys of 12 characters or
+// fewer are hidden entirely.
+func Key(key string) string {
+	if len([]rune(key)) <= 12 {
+		return "***"
+	}
+	return Ends(key, 4, 4)
+}
+
+// Email redacts an email address for logging, keeping the first 2
+// characters of the local part and the domain
+func Email(email string) string {
+	parts := strings.Split(email, "@")
+	if len(parts) != 2 {
+		return "***@***"
+	}
+	username := []rune(parts[0])
+	domain := parts[1]
+
+	if len(username) <= 2 {
+		return "***@" + domain
+	}
+	return string(username[:2]) + "***@" + domain
+}
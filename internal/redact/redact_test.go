@@ -0,0 +1,92 @@
+package redact
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPII(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", "***"},
+		{"short", "***"},
+		{"12345678", "***"},
+		{"LIC-202601-ABCDEF-123456", "LIC-...3456"},
+		{"LIC-ÄÖÜ-ÉÈÊ-ÇÑ", "LIC-...Ê-ÇÑ"},
+		{"ライセンス番号一二三四五", "ライセン...二三四五"},
+		{"🔑🔑🔑🔑🔑-🔒🔒🔒🔒", "🔑🔑🔑🔑...🔒🔒🔒🔒"},
+		{"ÄÖÜÉÈÊÇÑ", "***"}, // 8 runes, though 16 bytes
+	}
+	for _, tt := range tests {
+		got := PII(tt.in)
+		if got != tt.want {
+			t.Errorf("PII(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("PII(%q) = %q is not valid UTF-8", tt.in, got)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"px_abc", "***"},
+		{"LIC-ABCD1234", "***"},
+		{"LIC-202601-ABCDEF-123456", "LIC-...3456"},
+		{"px_0123456789abcdef", "px_0...cdef"},
+		{"ключ-лицензии-123", "ключ...-123"},
+	}
+	for _, tt := range tests {
+		if got := Key(tt.in); got != tt.want {
+			t.Errorf("Key(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"alice@example.com", "al***@example.com"},
+		{"al@example.com", "***@example.com"},
+		{"a@example.com", "***@example.com"},
+		{"élodie@exemple.fr", "él***@exemple.fr"},
+		{"Ålesund@example.no", "Ål***@example.no"},
+		{"用户名@例子.中国", "用户***@例子.中国"},
+		{"😀😃😄@example.com", "😀😃***@example.com"},
+		{"not-an-email", "***@***"},
+		{"two@at@example.com", "***@***"},
+		{"", "***@***"},
+	}
+	for _, tt := range tests {
+		got := Email(tt.in)
+		if got != tt.want {
+			t.Errorf("Email(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("Email(%q) = %q is not valid UTF-8", tt.in, got)
+		}
+	}
+}
+
+func TestEndsNeverSplitsRunes(t *testing.T) {
+	// Every cut of a string mixing 1-, 2-, 3- and 4-byte characters
+	s := strings.Repeat("aé中😀", 4)
+	for head := 0; head <= 8; head++ {
+		for tail := 0; tail <= 8; tail++ {
+			if got := Ends(s, head, tail); !utf8.ValidString(got) {
+				t.Fatalf("Ends(%q, %d, %d) = %q is not valid UTF-8", s, head, tail, got)
+			}
+		}
+	}
+	if got := Ends("aé中😀", 2, 2); got != "aé中😀" {
+		t.Fatalf("Ends of a string no longer than head+tail = %q, want it unchanged", got)
+	}
+	if got := Ends("aé中😀x", 2, 2); got != "aé...😀x" {
+		t.Fatalf("Ends = %q, want aé...😀x", got)
+	}
+}
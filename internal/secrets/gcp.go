@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+// gcpBackend reads each secret from Google Secret Manager using the latest version.
+// The access token comes from GCP_ACCESS_TOKEN or the GCE/GKE metadata server.
+type gcpBackend struct {
+	project string
+	token   string
+	client  *http.Client
+}
+
+func newGCPBackend() (Backend, error) {
+	project := os.Getenv("GCP_PROJECT")
+	if project == "" {
+		return nil, fmt.Errorf("gcp backend requires GCP_PROJECT")
+	}
+
+	return &gcpBackend{
+		project: project,
+		token:   os.Getenv("GCP_ACCESS_TOKEN"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (g *gcpBackend) Get(name string) (string, error) {
+	token, err := g.accessToken()
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf("https://secretmanager.googleapis.com/v1/projects/%s/secrets/%s/versions/latest:access", g.project, name)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("gcp secret manager request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("gcp secret manager returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode gcp response: %w", err)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(result.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode gcp secret payload: %w", err)
+	}
+	return string(value), nil
+}
+
+func (g *gcpBackend) accessToken() (string, error) {
+	if g.token != "" {
+		return g.token, nil
+	}
+
+	req, err := http.NewRequest("GET", gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get token from metadata server (set GCP_ACCESS_TOKEN outside GCP): %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode metadata token: %w", err)
+	}
+	return result.AccessToken, nil
+}
@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Backend fetches named secrets from a secret store.
+// Get returns an empty string and no error when the secret is not set.
+type Backend interface {
+	Get(name string) (string, error)
+}
+
+var (
+	// Active backend, selected by Init or lazily from SECRET_BACKEND
+	backend Backend
+	mu      sync.Mutex
+)
+
+// Init selects the secret backend by name: env (default), file, vault, aws or gcp
+func Init(name string) error {
+	b, err := newBackend(name)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	backend = b
+	mu.Unlock()
+	return nil
+}
+
+// Get returns the named secret from the active backend.
+// If Init has not been called, the backend is chosen from SECRET_BACKEND.
+func Get(name string) (string, error) {
+	mu.Lock()
+	if backend == nil {
+		b, err := newBackend(os.Getenv("SECRET_BACKEND"))
+		if err != nil {
+			mu.Unlock()
+			return "", err
+		}
+		backend = b
+	}
+	b := backend
+	mu.Unlock()
+
+	value, err := b.Get(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to load secret %s: %w", name, err)
+	}
+	return value, nil
+}
+
+func newBackend(name string) (Backend, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "env":
+		return envBackend{}, nil
+	case "file":
+		dir := os.Getenv("SECRETS_DIR")
+		if dir == "" {
+			dir = "/run/secrets"
+		}
+		return fileBackend{dir: dir}, nil
+	case "vault":
+		return newVaultBackend()
+	case "aws":
+		return newAWSBackend()
+	case "gcp":
+		return newGCPBackend()
+	default:
+		return nil, fmt.Errorf("unknown SECRET_BACKEND %q (expected env, file, vault, aws or gcp)", name)
+	}
+}
+
+// envBackend reads secrets from environment variables
+type envBackend struct{}
+
+func (envBackend) Get(name string) (string, error) {
+	return os.Getenv(name), nil
+}
+
+// fileBackend reads each secret from a file named after it, e.g. /run/secrets/PRIVATE_KEY
+type fileBackend struct {
+	dir string
+}
+
+func (f fileBackend) Get(name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(f.dir, name))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
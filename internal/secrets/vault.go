@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultBackend reads secrets from a single HashiCorp Vault KV path.
+// Both KV v1 and KV v2 response layouts are supported.
+type vaultBackend struct {
+	addr   string
+	token  string
+	path   string
+	client *http.Client
+
+	once   sync.Once
+	values map[string]string
+	err    error
+}
+
+func newVaultBackend() (Backend, error) {
+	addr := strings.TrimRight(os.Getenv("VAULT_ADDR"), "/")
+	token := os.Getenv("VAULT_TOKEN")
+	path := strings.Trim(os.Getenv("VAULT_SECRET_PATH"), "/")
+
+	if addr == "" || token == "" || path == "" {
+		return nil, fmt.Errorf("vault backend requires VAULT_ADDR, VAULT_TOKEN and VAULT_SECRET_PATH")
+	}
+
+	return &vaultBackend{
+		addr:   addr,
+		token:  token,
+		path:   path,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (v *vaultBackend) Get(name string) (string, error) {
+	v.once.Do(func() { v.values, v.err = v.fetch() })
+	if v.err != nil {
+		return "", v.err
+	}
+	return v.values[name], nil
+}
+
+func (v *vaultBackend) fetch() (map[string]string, error) {
+	req, err := http.NewRequest("GET", v.addr+"/v1/"+v.path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("vault request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("vault returned status %d for %s", resp.StatusCode, v.path)
+	}
+
+	var result struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode vault response: %w", err)
+	}
+
+	// KV v2 nests the secret under data.data
+	data := result.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	values := make(map[string]string, len(data))
+	for k, val := range data {
+		if s, ok := val.(string); ok {
+			values[k] = s
+		}
+	}
+	return values, nil
+}
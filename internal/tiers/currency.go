@@ -0,0 +1,64 @@
+package tiers
+
+import "strings"
+
+// DefaultCurrency is used for tiers that don't set currency
+const DefaultCurrency = "USD"
+
+// isoCurrencies holds the active ISO 4217 currency codes
+var isoCurrencies = toSet(`
+AED AFN ALL AMD ANG AOA ARS AUD AWG AZN BAM BBD BDT BGN BHD BIF BMD BND BOB
+BRL BSD BTN BWP BYN BZD CAD CDF CHF CLP CNY COP CRC CUP CVE CZK DJF DKK DOP
+DZD EGP ERN ETB EUR FJD FKP GBP GEL GHS GIP GMD GNF GTQ GYD HKD HNL HTG HUF
+IDR ILS INR IQD IRR ISK JMD JOD JPY KES KGS KHR KMF KPW KRW KWD KYD KZT LAK
+LBP LKR LRD LSL LYD MAD MDL MGA MKD MMK MNT MOP MRU MUR MVR MWK MXN MYR MZN
+NAD NGN NIO NOK NPR NZD OMR PAB PEN PGK PHP PKR PLN PYG QAR RON RSD RUB RWF
+SAR SBD SCR SDG SEK SGD SHP SLE SOS SRD SSP STN SVC SYP SZL THB TJS TMT TND
+TOP TRY TTD TWD TZS UAH UGX USD UYU UZS VED VES VND VUV WST XAF XCD XCG XOF
+XPF YER ZAR ZMW ZWG`)
+
+// currencySymbols covers the currencies prices are commonly shown in
+var currencySymbols = map[string]string{
+	"USD": "$",
+	"EUR": "€",
+	"GBP": "£",
+	"JPY": "¥",
+	"CNY": "¥",
+	"INR": "₹",
+	"KRW": "₩",
+	"TRY": "₺",
+	"RUB": "₽",
+	"BRL": "R$",
+	"CAD": "CA$",
+	"AUD": "A$",
+	"NZD": "NZ$",
+	"CHF": "CHF ",
+	"PLN": "zł",
+	"ILS": "₪",
+	"UAH": "₴",
+	"VND": "₫",
+	"PHP": "₱",
+	"NGN": "₦",
+}
+
+func toSet(codes string) map[string]bool {
+	set := make(map[string]bool)
+	for _, code := range strings.Fields(codes) {
+		set[code] = true
+	}
+	return set
+}
+
+// IsCurrency reports whether code is an active ISO 4217 currency code
+func IsCurrency(code string) bool {
+	return isoCurrencies[code]
+}
+
+// CurrencySymbol returns the symbol prices in code are shown with, or the
+// code itself followed by a space when it has no common symbol
+func CurrencySymbol(code string) string {
+	if symbol, ok := currencySymbols[code]; ok {
+		return symbol
+	}
+	return code + " "
+}
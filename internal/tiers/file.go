@@ -0,0 +1,280 @@
+package tiers
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// File is a tier configuration file opened for editing. It holds only the
+// keys the file sets, so a tier with extends keeps inheriting the rest.
+// Save keeps the tiers and their keys in file order and the comment block
+// at the top of the file; other comments are dropped.
+type File struct {
+	path   string
+	header string                            // leading comment block
+	tiers  map[string]map[string]interface{} // settings of each tier
+	order  []string                          // tier names in file order
+	keys   map[string][]string               // each tier's keys in file order
+	rest   map[string]interface{}            // auto_tier rules and other top-level settings
+}
+
+// OpenFile reads a tier configuration file for editing
+func OpenFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("tier configuration file not found: %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tier configuration: %w", err)
+	}
+
+	raw := make(map[string]interface{})
+	md, err := toml.Decode(string(data), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tier configuration: %w", err)
+	}
+	tables, ok := raw["tiers"].(map[string]interface{})
+	if !ok && raw["tiers"] != nil {
+		return nil, fmt.Errorf("tiers must be a table")
+	}
+	delete(raw, "tiers")
+
+	f := &File{
+		path:   path,
+		header: leadingComments(string(data)),
+		tiers:  make(map[string]map[string]interface{}),
+		keys:   make(map[string][]string),
+		rest:   raw,
+	}
+	for _, key := range md.Keys() {
+		if len(key) < 2 || key[0] != "tiers" {
+			continue
+		}
+		name := key[1]
+		if _, seen := f.tiers[name]; !seen {
+			tier, ok := tables[name].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("tier '%s' must be a table", name)
+			}
+			f.tiers[name] = tier
+			f.order = append(f.order, name)
+		}
+		if len(key) == 3 {
+			f.keys[name] = append(f.keys[name], key[2])
+		}
+	}
+	return f, nil
+}
+
+// leadingComments returns the comment lines at the top of a file
+func leadingComments(data string) string {
+	var header []string
+	for _, line := range strings.Split(data, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		header = append(header, line)
+	}
+	text := strings.TrimSpace(strings.Join(header, "\n"))
+	if text == "" {
+		return ""
+	}
+	return text + "\n"
+}
+
+// Has reports whether the file defines the named tier
+func (f *File) Has(name string) bool {
+	_, exists := f.tiers[name]
+	return exists
+}
+
+// AddTier adds an empty tier, to be filled in with Set
+func (f *File) AddTier(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("tier name cannot be empty")
+	}
+	if f.Has(name) {
+		return fmt.Errorf("tier '%s' already exists", name)
+	}
+	f.tiers[name] = make(map[string]interface{})
+	f.order = append(f.order, name)
+	return nil
+}
+
+// Set sets one setting of a tier, such as "daily_limit", using its
+// tiers.toml key
+func (f *File) Set(name, key string, value interface{}) error {
+	tier, exists := f.tiers[name]
+	if !exists {
+		return fmt.Errorf("tier '%s' not found", name)
+	}
+	if _, defined := tier[key]; !defined {
+		f.keys[name] = append(f.keys[name], key)
+	}
+	tier[key] = value
+	return nil
+}
+
+// Unset removes a setting from a tier, so it takes its default or, with
+// extends, the base tier's value
+func (f *File) Unset(name, key string) error {
+	tier, exists := f.tiers[name]
+	if !exists {
+		return fmt.Errorf("tier '%s' not found", name)
+	}
+	delete(tier, key)
+	f.keys[name] = without(f.keys[name], key)
+	return nil
+}
+
+// RemoveTier removes a tier. A tier that another tier migrates to or
+// extends, or that an auto_tier rule uses, can't be removed.
+func (f *File) RemoveTier(name string) error {
+	if !f.Has(name) {
+		return fmt.Errorf("tier '%s' not found", name)
+	}
+	for _, other := range f.order {
+		if other == name {
+			continue
+		}
+		if f.tiers[other]["migrate_to"] == name {
+			return fmt.Errorf("tier '%s' is the migration target of tier '%s'", name, other)
+		}
+		if f.tiers[other]["extends"] == name {
+			return fmt.Errorf("tier '%s' is extended by tier '%s'", name, other)
+		}
+	}
+	rules, _ := f.rest["auto_tier"].([]map[string]interface{})
+	for i, rule := range rules {
+		if rule["from"] == name || rule["to"] == name {
+			return fmt.Errorf("tier '%s' is used by auto_tier rule %d", name, i+1)
+		}
+	}
+
+	delete(f.tiers, name)
+	delete(f.keys, name)
+	f.order = without(f.order, name)
+	return nil
+}
+
+func without(list []string, item string) []string {
+	kept := list[:0]
+	for _, s := range list {
+		if s != item {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+// Save validates the file and writes it back. The new file replaces the
+// old one only once it is fully written, so a running server never reads
+// half of it.
+func (f *File) Save() error {
+	data, err := f.encode()
+	if err != nil {
+		return err
+	}
+	if _, err := parse(string(data)); err != nil {
+		return err
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(f.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(f.path), ".tiers-*")
+	if err != nil {
+		return fmt.Errorf("failed to write tier configuration: %w", err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	if err := tmp.Chmod(mode); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write tier configuration: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to write tier configuration: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write tier configuration: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.path); err != nil {
+		return fmt.Errorf("failed to write tier configuration: %w", err)
+	}
+	return nil
+}
+
+// encode writes the file as TOML: the header, plain top-level settings,
+// the tiers, then auto_tier rules and other tables
+func (f *File) encode() ([]byte, error) {
+	plain := make(map[string]interface{})
+	tables := make(map[string]interface{})
+	for key, value := range f.rest {
+		switch value.(type) {
+		case map[string]interface{}, []map[string]interface{}:
+			tables[key] = value
+		default:
+			plain[key] = value
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(f.header)
+	if len(plain) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		if err := encodeTOML(&buf, plain); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range f.order {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "[tiers.%s]\n", tomlKey(name))
+		for _, key := range f.keys[name] {
+			value := f.tiers[name][key]
+			if _, nested := value.(map[string]interface{}); nested {
+				return nil, fmt.Errorf("tier '%s' has unsupported table '%s'", name, key)
+			}
+			if err := encodeTOML(&buf, map[string]interface{}{key: value}); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(tables) > 0 {
+		buf.WriteString("\n")
+		if err := encodeTOML(&buf, tables); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeTOML(buf *bytes.Buffer, v map[string]interface{}) error {
+	enc := toml.NewEncoder(buf)
+	enc.Indent = ""
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode tier configuration: %w", err)
+	}
+	return nil
+}
+
+// tomlKey quotes a table name that isn't a bare TOML key
+func tomlKey(name string) string {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return strconv.Quote(name)
+		}
+	}
+	return name
+}
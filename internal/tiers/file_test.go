@@ -0,0 +1,174 @@
+package tiers
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+const editableTiers = `# Tiers for the test server
+# Edited by licensify-admin
+
+[tiers.basic]
+name = "Basic"
+daily_limit = 100
+monthly_limit = 1000
+max_devices = 1
+
+[tiers.basic-legacy]
+name = "Basic (legacy)"
+deprecated = true
+migrate_to = "basic"
+
+[tiers.pro]
+name = "Pro"
+daily_limit = 1000
+monthly_limit = 20000
+max_devices = 5
+features = ["basic_api_access"]
+
+[tiers.pro-team]
+name = "Pro Team"
+extends = "pro"
+max_devices = 25
+
+[tiers.enterprise]
+name = "Enterprise"
+daily_limit = -1
+
+[[auto_tier]]
+from = "basic"
+to = "pro"
+direction = "above"
+percent = 90
+months = 2
+`
+
+// readFile returns the contents of the file at path
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileAddTier(t *testing.T) {
+	path := writeTiers(t, editableTiers)
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if err := file.AddTier("team"); err != nil {
+		t.Fatalf("AddTier: %v", err)
+	}
+	for key, value := range map[string]interface{}{
+		"name": "Team", "daily_limit": 5000, "monthly_limit": 100000, "max_devices": 10,
+		"providers": []string{"openai"},
+	} {
+		if err := file.Set("team", key, value); err != nil {
+			t.Fatalf("Set %s: %v", key, err)
+		}
+	}
+	if err := file.Set("pro-team", "daily_limit", 2000); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// The saved file validates and lists the new tier
+	r := loadRegistry(t, readFile(t, path))
+	if got := strings.Join(r.List(), ","); got != "basic,basic-legacy,enterprise,pro,pro-team,team" {
+		t.Fatalf("List = %s", got)
+	}
+	team, err := r.Get("team")
+	if err != nil || team.Name != "Team" || team.DailyLimit != 5000 || team.MonthlyLimit != 100000 || team.MaxDevices != 10 || !team.AllowsProvider("openai") || team.AllowsProvider("gemini") {
+		t.Fatalf("team = %+v, %v", team, err)
+	}
+	// A tier with extends keeps inheriting what it doesn't set
+	proTeam, err := r.Get("pro-team")
+	if err != nil || proTeam.DailyLimit != 2000 || proTeam.MonthlyLimit != 20000 || proTeam.MaxDevices != 25 || !proTeam.HasFeature("basic_api_access") {
+		t.Fatalf("pro-team = %+v, %v", proTeam, err)
+	}
+	if len(r.AutoTierRules()) != 1 {
+		t.Fatalf("auto_tier rules = %v, want the rule kept", r.AutoTierRules())
+	}
+
+	saved := readFile(t, path)
+	if !strings.HasPrefix(saved, "# Tiers for the test server\n# Edited by licensify-admin\n") {
+		t.Fatalf("header comment lost:\n%s", saved)
+	}
+	if strings.Index(saved, "[tiers.basic]") > strings.Index(saved, "[tiers.pro]") || !strings.Contains(saved, "[tiers.team]") {
+		t.Fatalf("tiers out of file order:\n%s", saved)
+	}
+	if strings.Contains(saved[strings.Index(saved, "[tiers.pro-team]"):strings.Index(saved, "[tiers.enterprise]")], "monthly_limit") {
+		t.Fatalf("pro-team had inherited settings written out:\n%s", saved)
+	}
+
+	if err := file.AddTier("team"); err == nil {
+		t.Fatal("AddTier of an existing tier: expected an error")
+	}
+	if err := file.Set("missing", "daily_limit", 1); err == nil {
+		t.Fatal("Set on a missing tier: expected an error")
+	}
+}
+
+func TestFileRemoveTier(t *testing.T) {
+	path := writeTiers(t, editableTiers)
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+
+	refused := map[string]string{
+		"basic":   "migration target of tier 'basic-legacy'",
+		"pro":     "extended by tier 'pro-team'",
+		"missing": "not found",
+	}
+	for name, reason := range refused {
+		if err := file.RemoveTier(name); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("RemoveTier(%s) = %v, want %q", name, err, reason)
+		}
+	}
+
+	// Once nothing migrates to basic, the auto_tier rule still holds it
+	if err := file.RemoveTier("basic-legacy"); err != nil {
+		t.Fatalf("RemoveTier(basic-legacy): %v", err)
+	}
+	if err := file.RemoveTier("basic"); err == nil || !strings.Contains(err.Error(), "auto_tier rule 1") {
+		t.Fatalf("RemoveTier(basic) = %v, want the auto_tier rule to block it", err)
+	}
+
+	if err := file.RemoveTier("enterprise"); err != nil {
+		t.Fatalf("RemoveTier(enterprise): %v", err)
+	}
+	if err := file.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	r := loadRegistry(t, readFile(t, path))
+	if got := strings.Join(r.List(), ","); got != "basic,pro,pro-team" {
+		t.Fatalf("List after removal = %s", got)
+	}
+}
+
+func TestFileSaveRefusesInvalidConfig(t *testing.T) {
+	path := writeTiers(t, editableTiers)
+	file, err := OpenFile(path)
+	if err != nil {
+		t.Fatalf("OpenFile: %v", err)
+	}
+	if err := file.Set("basic-legacy", "migrate_to", "nowhere"); err != nil {
+		t.Fatal(err)
+	}
+	if err := file.Save(); err == nil {
+		t.Fatal("Save with a migration to a missing tier: expected an error")
+	}
+	if readFile(t, path) != editableTiers {
+		t.Fatal("file changed by a failed Save")
+	}
+	if _, err := OpenFile(path + ".missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Fatalf("OpenFile of a missing file = %v", err)
+	}
+}
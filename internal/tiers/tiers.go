@@ -4,13 +4,27 @@ import (
 	"fmt"
 	"os"
 	"sort"
+	"strings"
+	"sync"
 
 	"github.com/BurntSushi/toml"
 )
 
 // TierConfig represents the entire tier configuration
 type TierConfig struct {
-	Tiers map[string]*TierDetails `toml:"tiers"`
+	Tiers    map[string]*TierDetails `toml:"tiers"`
+	AutoTier []AutoTierRule          `toml:"auto_tier"`
+}
+
+// AutoTierRule moves licenses between tiers based on sustained monthly usage.
+// A license on From moves to To when its usage is above (or below) Percent
+// of its monthly limit for Months consecutive completed months.
+type AutoTierRule struct {
+	From      string `toml:"from"`
+	To        string `toml:"to"`
+	Direction string `toml:"direction"` // "above" to promote, "below" to demote
+	Percent   int    `toml:"percent"`
+	Months    int    `toml:"months"`
 }
 
 // TierDetails represents the configuration for a single tier
@@ -20,33 +34,214 @@ type TierDetails struct {
 	MonthlyLimit              int      `toml:"monthly_limit"`
 	MaxDevices                int      `toml:"max_devices"`
 	Features                  []string `toml:"features"`
+	Providers                 []string `toml:"providers,omitempty"` // Proxy providers the tier may call; empty allows all
 	EmailVerificationRequired bool     `toml:"email_verification_required"`
 	PriceMonthly              float64  `toml:"price_monthly,omitempty"`
+	PriceAnnual               float64  `toml:"price_annual,omitempty"`
 	OneTimePayment            float64  `toml:"one_time_payment,omitempty"`
+	Currency                  string   `toml:"currency,omitempty"` // ISO 4217 code of the prices, default USD
 	CustomPricing             bool     `toml:"custom_pricing,omitempty"`
 	Hidden                    bool     `toml:"hidden,omitempty"`
 	Deprecated                bool     `toml:"deprecated,omitempty"`
 	MigrateTo                 string   `toml:"migrate_to,omitempty"`
+	UsageThresholds           []int    `toml:"usage_thresholds,omitempty"` // Percentages of the daily/monthly limit that trigger usage alerts
 	Description               string   `toml:"description"`
+	Extends                   string   `toml:"extends,omitempty"`           // Base tier whose limits, features and pricing are inherited
+	OverrideFeatures          bool     `toml:"override_features,omitempty"` // Replace the base tier's features instead of adding to them
+}
+
+// AllowsProvider reports whether the tier may call the named proxy provider.
+// Tiers without a providers list may call any provider.
+func (t *TierDetails) AllowsProvider(name string) bool {
+	if len(t.Providers) == 0 {
+		return true
+	}
+	for _, provider := range t.Providers {
+		if provider == name {
+			return true
+		}
+	}
+	return false
+}
+
+// HasFeature reports whether the tier includes the named feature
+func (t *TierDetails) HasFeature(name string) bool {
+	for _, feature := range t.Features {
+		if feature == name {
+			return true
+		}
+	}
+	return false
 }
 
-var (
-	// Global tier configuration
+// Registry holds one tier configuration. It is safe for concurrent use, and
+// a Load replaces the configuration atomically.
+type Registry struct {
+	mu     sync.RWMutex
 	config *TierConfig
-)
+}
+
+// NewRegistry returns an empty registry; call Load or LoadWithFallback before use
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// defaultRegistry backs the package-level functions
+var defaultRegistry = NewRegistry()
+
+// Default returns the registry used by the package-level functions
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// current returns the loaded configuration, or nil before the first Load
+func (r *Registry) current() *TierConfig {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.config
+}
+
+func (r *Registry) set(cfg *TierConfig) {
+	r.mu.Lock()
+	r.config = cfg
+	r.mu.Unlock()
+}
 
 // Load loads the tier configuration from a TOML file
-func Load(path string) error {
+func (r *Registry) Load(path string) error {
 	// Check if file exists
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		return fmt.Errorf("tier configuration file not found: %s", path)
 	}
 
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read tier configuration: %w", err)
+	}
+	cfg, err := parse(string(data))
+	if err != nil {
+		return err
+	}
+
+	r.set(cfg)
+	return nil
+}
+
+// parse decodes a tier configuration, resolves inheritance and validates it
+func parse(data string) (*TierConfig, error) {
 	var cfg TierConfig
-	if _, err := toml.DecodeFile(path, &cfg); err != nil {
-		return fmt.Errorf("failed to parse tier configuration: %w", err)
+	md, err := toml.Decode(data, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tier configuration: %w", err)
+	}
+
+	if err := resolveInheritance(&cfg, md); err != nil {
+		return nil, err
+	}
+	if err := validate(&cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// resolveInheritance fills in the settings each tier with extends doesn't set
+// itself from its base tier, resolving bases first. Name, description,
+// visibility and deprecation are never inherited.
+func resolveInheritance(cfg *TierConfig, md toml.MetaData) error {
+	resolved := make(map[string]bool)
+	var resolve func(name string, chain []string) error
+	resolve = func(name string, chain []string) error {
+		tier := cfg.Tiers[name]
+		if resolved[name] || tier.Extends == "" {
+			return nil
+		}
+		for i, seen := range chain {
+			if seen == name {
+				return fmt.Errorf("tier '%s' has an extends cycle: %s", name, strings.Join(append(chain[i:], name), " -> "))
+			}
+		}
+		base, exists := cfg.Tiers[tier.Extends]
+		if !exists {
+			return fmt.Errorf("tier '%s' extends unknown tier '%s'", name, tier.Extends)
+		}
+		if err := resolve(tier.Extends, append(chain, name)); err != nil {
+			return err
+		}
+
+		defined := func(key string) bool { return md.IsDefined("tiers", name, key) }
+		if !defined("daily_limit") {
+			tier.DailyLimit = base.DailyLimit
+		}
+		if !defined("monthly_limit") {
+			tier.MonthlyLimit = base.MonthlyLimit
+		}
+		if !defined("max_devices") {
+			tier.MaxDevices = base.MaxDevices
+		}
+		if !defined("email_verification_required") {
+			tier.EmailVerificationRequired = base.EmailVerificationRequired
+		}
+		if !defined("price_monthly") {
+			tier.PriceMonthly = base.PriceMonthly
+		}
+		if !defined("price_annual") {
+			tier.PriceAnnual = base.PriceAnnual
+		}
+		if !defined("currency") {
+			tier.Currency = base.Currency
+		}
+		if !defined("one_time_payment") {
+			tier.OneTimePayment = base.OneTimePayment
+		}
+		if !defined("custom_pricing") {
+			tier.CustomPricing = base.CustomPricing
+		}
+		if !defined("providers") {
+			tier.Providers = append([]string(nil), base.Providers...)
+		}
+		if !defined("usage_thresholds") {
+			tier.UsageThresholds = append([]int(nil), base.UsageThresholds...)
+		}
+		if !defined("features") || !tier.OverrideFeatures {
+			tier.Features = mergeFeatures(base.Features, tier.Features)
+		}
+
+		resolved[name] = true
+		return nil
+	}
+
+	for _, name := range sortedNames(cfg.Tiers) {
+		if err := resolve(name, nil); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
+// mergeFeatures returns base followed by the features of own it lacks
+func mergeFeatures(base, own []string) []string {
+	merged := make([]string, 0, len(base)+len(own))
+	seen := make(map[string]bool)
+	for _, feature := range append(append([]string(nil), base...), own...) {
+		if !seen[feature] {
+			seen[feature] = true
+			merged = append(merged, feature)
+		}
+	}
+	return merged
+}
+
+func sortedNames(tiers map[string]*TierDetails) []string {
+	names := make([]string, 0, len(tiers))
+	for name := range tiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validate checks a parsed configuration and fills in defaults
+func validate(cfg *TierConfig) error {
 	// Validate configuration
 	if len(cfg.Tiers) == 0 {
 		return fmt.Errorf("no tiers defined in configuration")
@@ -66,6 +261,20 @@ func Load(path string) error {
 		if tier.MaxDevices < -1 {
 			return fmt.Errorf("tier '%s' has invalid max_devices (must be >= -1)", name)
 		}
+		if tier.PriceMonthly < 0 || tier.PriceAnnual < 0 || tier.OneTimePayment < 0 {
+			return fmt.Errorf("tier '%s' has a negative price", name)
+		}
+		if tier.Currency == "" {
+			tier.Currency = DefaultCurrency
+		}
+		if !IsCurrency(tier.Currency) {
+			return fmt.Errorf("tier '%s' has unknown currency '%s' (must be an ISO 4217 code such as USD or EUR)", name, tier.Currency)
+		}
+		for _, percent := range tier.UsageThresholds {
+			if percent < 1 || percent > 1000 {
+				return fmt.Errorf("tier '%s' has invalid usage_thresholds value %d (must be 1-1000)", name, percent)
+			}
+		}
 		// Validate migration target if deprecated
 		if tier.Deprecated && tier.MigrateTo != "" {
 			if tier.MigrateTo == name {
@@ -97,13 +306,62 @@ func Load(path string) error {
 		}
 	}
 
-	config = &cfg
+	// Validate automatic tier assignment rules
+	for i := range cfg.AutoTier {
+		rule := &cfg.AutoTier[i]
+		if _, exists := cfg.Tiers[rule.From]; !exists {
+			return fmt.Errorf("auto_tier rule %d has unknown from tier '%s'", i+1, rule.From)
+		}
+		if _, exists := cfg.Tiers[rule.To]; !exists {
+			return fmt.Errorf("auto_tier rule %d has unknown to tier '%s'", i+1, rule.To)
+		}
+		if rule.From == rule.To {
+			return fmt.Errorf("auto_tier rule %d moves tier '%s' to itself", i+1, rule.From)
+		}
+		if rule.Direction != "above" && rule.Direction != "below" {
+			return fmt.Errorf("auto_tier rule %d has invalid direction '%s' (must be above or below)", i+1, rule.Direction)
+		}
+		if rule.Percent <= 0 {
+			return fmt.Errorf("auto_tier rule %d has invalid percent (must be > 0)", i+1)
+		}
+		if rule.Months == 0 {
+			rule.Months = 1
+		}
+		if rule.Months < 0 {
+			return fmt.Errorf("auto_tier rule %d has invalid months (must be >= 1)", i+1)
+		}
+	}
+
 	return nil
 }
 
+// LoadWithFallback loads tier configuration with fallback to defaults
+func (r *Registry) LoadWithFallback(path string) error {
+	err := r.Load(path)
+	if err != nil {
+		// If file doesn't exist, create default configuration
+		if os.IsNotExist(err) {
+			r.set(getDefaultConfig())
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// AutoTierRules returns the configured automatic tier assignment rules
+func (r *Registry) AutoTierRules() []AutoTierRule {
+	config := r.current()
+	if config == nil {
+		return nil
+	}
+	return config.AutoTier
+}
+
 // Get returns the tier details for a given tier name
 // If the tier is deprecated, returns the migration target tier
-func Get(tierName string) (*TierDetails, error) {
+func (r *Registry) Get(tierName string) (*TierDetails, error) {
+	config := r.current()
 	if config == nil {
 		return nil, fmt.Errorf("tier configuration not loaded")
 	}
@@ -124,9 +382,30 @@ func Get(tierName string) (*TierDetails, error) {
 	return tier, nil
 }
 
+// TierHasFeature reports whether a tier includes the named feature. Like Get,
+// a deprecated tier is resolved to its migration target.
+func (r *Registry) TierHasFeature(tierName, feature string) (bool, error) {
+	tier, err := r.Get(tierName)
+	if err != nil {
+		return false, err
+	}
+	return tier.HasFeature(feature), nil
+}
+
+// TierAllowsProvider reports whether a tier may call the named proxy
+// provider. Like Get, a deprecated tier is resolved to its migration target.
+func (r *Registry) TierAllowsProvider(tierName, provider string) (bool, error) {
+	tier, err := r.Get(tierName)
+	if err != nil {
+		return false, err
+	}
+	return tier.AllowsProvider(provider), nil
+}
+
 // GetRaw returns the tier details without following migration targets
 // This is useful for admin operations that need the actual tier data
-func GetRaw(tierName string) (*TierDetails, error) {
+func (r *Registry) GetRaw(tierName string) (*TierDetails, error) {
+	config := r.current()
 	if config == nil {
 		return nil, fmt.Errorf("tier configuration not loaded")
 	}
@@ -140,7 +419,8 @@ func GetRaw(tierName string) (*TierDetails, error) {
 }
 
 // Exists checks if a tier exists
-func Exists(tierName string) bool {
+func (r *Registry) Exists(tierName string) bool {
+	config := r.current()
 	if config == nil {
 		return false
 	}
@@ -149,7 +429,8 @@ func Exists(tierName string) bool {
 }
 
 // List returns all tier names
-func List() []string {
+func (r *Registry) List() []string {
+	config := r.current()
 	if config == nil {
 		return []string{}
 	}
@@ -163,7 +444,8 @@ func List() []string {
 }
 
 // ListVisible returns all non-hidden tier names
-func ListVisible() []string {
+func (r *Registry) ListVisible() []string {
+	config := r.current()
 	if config == nil {
 		return []string{}
 	}
@@ -179,7 +461,8 @@ func ListVisible() []string {
 }
 
 // GetAll returns all tier configurations
-func GetAll() map[string]*TierDetails {
+func (r *Registry) GetAll() map[string]*TierDetails {
+	config := r.current()
 	if config == nil {
 		return map[string]*TierDetails{}
 	}
@@ -187,7 +470,8 @@ func GetAll() map[string]*TierDetails {
 }
 
 // GetAllVisible returns all non-hidden tier configurations
-func GetAllVisible() map[string]*TierDetails {
+func (r *Registry) GetAllVisible() map[string]*TierDetails {
+	config := r.current()
 	if config == nil {
 		return map[string]*TierDetails{}
 	}
@@ -201,60 +485,9 @@ func GetAllVisible() map[string]*TierDetails {
 	return visible
 }
 
-// LoadWithFallback loads tier configuration with fallback to defaults
-func LoadWithFallback(path string) error {
-	err := Load(path)
-	if err != nil {
-		// If file doesn't exist, create default configuration
-		if os.IsNotExist(err) {
-			config = getDefaultConfig()
-			return nil
-		}
-		return err
-	}
-	return nil
-}
-
-// getDefaultConfig returns hardcoded default tier configuration
-func getDefaultConfig() *TierConfig {
-	return &TierConfig{
-		Tiers: map[string]*TierDetails{
-			"tier-1": {
-				Name:                      "Free",
-				DailyLimit:                10,
-				MonthlyLimit:              100,
-				MaxDevices:                1,
-				Features:                  []string{"basic_api_access"},
-				EmailVerificationRequired: true,
-				Description:               "Perfect for trying out the service",
-			},
-			"tier-2": {
-				Name:                      "Professional",
-				DailyLimit:                1000,
-				MonthlyLimit:              30000,
-				MaxDevices:                3,
-				Features:                  []string{"basic_api_access", "priority_support"},
-				EmailVerificationRequired: false,
-				PriceMonthly:              29.99,
-				Description:               "For individual developers and small teams",
-			},
-			"tier-3": {
-				Name:                      "Enterprise",
-				DailyLimit:                -1,
-				MonthlyLimit:              -1,
-				MaxDevices:                -1,
-				Features:                  []string{"basic_api_access", "priority_support", "api_analytics", "custom_endpoints", "sla"},
-				EmailVerificationRequired: false,
-				PriceMonthly:              299.99,
-				CustomPricing:             true,
-				Description:               "Unlimited access with dedicated support and SLA",
-			},
-		},
-	}
-}
-
 // IsDeprecated checks if a tier is marked as deprecated
-func IsDeprecated(tierName string) bool {
+func (r *Registry) IsDeprecated(tierName string) bool {
+	config := r.current()
 	if config == nil {
 		return false
 	}
@@ -266,7 +499,8 @@ func IsDeprecated(tierName string) bool {
 }
 
 // GetMigrationTarget returns the migration target for a deprecated tier
-func GetMigrationTarget(tierName string) (string, error) {
+func (r *Registry) GetMigrationTarget(tierName string) (string, error) {
+	config := r.current()
 	if config == nil {
 		return "", fmt.Errorf("tier configuration not loaded")
 	}
@@ -293,7 +527,8 @@ func GetMigrationTarget(tierName string) (string, error) {
 }
 
 // ListDeprecated returns all deprecated tier names
-func ListDeprecated() []string {
+func (r *Registry) ListDeprecated() []string {
+	config := r.current()
 	if config == nil {
 		return []string{}
 	}
@@ -309,7 +544,8 @@ func ListDeprecated() []string {
 }
 
 // ListActive returns all non-deprecated tier names
-func ListActive() []string {
+func (r *Registry) ListActive() []string {
+	config := r.current()
 	if config == nil {
 		return []string{}
 	}
@@ -323,3 +559,121 @@ func ListActive() []string {
 	sort.Strings(names)
 	return names
 }
+
+// getDefaultConfig returns hardcoded default tier configuration
+func getDefaultConfig() *TierConfig {
+	return &TierConfig{
+		Tiers: map[string]*TierDetails{
+			"tier-1": {
+				Name:                      "Free",
+				DailyLimit:                10,
+				MonthlyLimit:              100,
+				MaxDevices:                1,
+				Features:                  []string{"basic_api_access"},
+				EmailVerificationRequired: true,
+				Currency:                  DefaultCurrency,
+				Description:               "Perfect for trying out the service",
+			},
+			"tier-2": {
+				Name:                      "Professional",
+				DailyLimit:                1000,
+				MonthlyLimit:              30000,
+				MaxDevices:                3,
+				Features:                  []string{"basic_api_access", "priority_support"},
+				EmailVerificationRequired: false,
+				PriceMonthly:              29.99,
+				Currency:                  DefaultCurrency,
+				Description:               "For individual developers and small teams",
+			},
+			"tier-3": {
+				Name:                      "Enterprise",
+				DailyLimit:                -1,
+				MonthlyLimit:              -1,
+				MaxDevices:                -1,
+				Features:                  []string{"basic_api_access", "priority_support", "api_analytics", "custom_endpoints", "sla"},
+				EmailVerificationRequired: false,
+				PriceMonthly:              299.99,
+				CustomPricing:             true,
+				Currency:                  DefaultCurrency,
+				Description:               "Unlimited access with dedicated support and SLA",
+			},
+		},
+	}
+}
+
+// Package-level functions use the default registry
+
+// Load loads the tier configuration into the default registry
+func Load(path string) error {
+	return defaultRegistry.Load(path)
+}
+
+// LoadWithFallback loads the default registry with fallback to defaults
+func LoadWithFallback(path string) error {
+	return defaultRegistry.LoadWithFallback(path)
+}
+
+// AutoTierRules returns the default registry's automatic tier assignment rules
+func AutoTierRules() []AutoTierRule {
+	return defaultRegistry.AutoTierRules()
+}
+
+// Get calls Registry.Get on the default registry
+func Get(tierName string) (*TierDetails, error) {
+	return defaultRegistry.Get(tierName)
+}
+
+// TierHasFeature calls Registry.TierHasFeature on the default registry
+func TierHasFeature(tierName, feature string) (bool, error) {
+	return defaultRegistry.TierHasFeature(tierName, feature)
+}
+
+// GetRaw calls Registry.GetRaw on the default registry
+func GetRaw(tierName string) (*TierDetails, error) {
+	return defaultRegistry.GetRaw(tierName)
+}
+
+// Exists calls Registry.Exists on the default registry
+func Exists(tierName string) bool {
+	return defaultRegistry.Exists(tierName)
+}
+
+// List calls Registry.List on the default registry
+func List() []string {
+	return defaultRegistry.List()
+}
+
+// ListVisible calls Registry.ListVisible on the default registry
+func ListVisible() []string {
+	return defaultRegistry.ListVisible()
+}
+
+// GetAll calls Registry.GetAll on the default registry
+func GetAll() map[string]*TierDetails {
+	return defaultRegistry.GetAll()
+}
+
+// GetAllVisible calls Registry.GetAllVisible on the default registry
+func GetAllVisible() map[string]*TierDetails {
+	return defaultRegistry.GetAllVisible()
+}
+
+// IsDeprecated calls Registry.IsDeprecated on the default registry
+func IsDeprecated(tierName string) bool {
+	return defaultRegistry.IsDeprecated(tierName)
+}
+
+// GetMigrationTarget calls Registry.GetMigrationTarget on the default registry
+func GetMigrationTarget(tierName string) (string, error) {
+	return defaultRegistry.GetMigrationTarget(tierName)
+}
+
+// ListDeprecated calls Registry.ListDeprecated on the default registry
+func ListDeprecated() []string {
+	return defaultRegistry.ListDeprecated()
+}
+
+// ListActive calls Registry.ListActive on the default registry
+func ListActive() []string {
+	return defaultRegistry.ListActive()
+}
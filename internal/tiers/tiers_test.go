@@ -0,0 +1,333 @@
+package tiers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// writeTiers writes config to a tiers.toml in a temporary directory and
+// returns its path
+func writeTiers(t *testing.T, config string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tiers.toml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadRegistry returns a new registry loaded from config
+func loadRegistry(t *testing.T, config string) *Registry {
+	t.Helper()
+	r := NewRegistry()
+	if err := r.Load(writeTiers(t, config)); err != nil {
+		t.Fatalf("load tiers: %v", err)
+	}
+	return r
+}
+
+// tierWithLimit is a configuration with one tier, basic, with a daily limit
+func tierWithLimit(daily int) string {
+	return fmt.Sprintf("[tiers.basic]\nname = \"Basic\"\ndaily_limit = %d\nmonthly_limit = 1000\nmax_devices = 1\n", daily)
+}
+
+func TestRegistriesAreIsolated(t *testing.T) {
+	first := loadRegistry(t, tierWithLimit(10))
+	second := loadRegistry(t, tierWithLimit(20))
+	if err := second.Load(writeTiers(t, tierWithLimit(30)+"\n[tiers.pro]\nname = \"Pro\"\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	tier, err := first.Get("basic")
+	if err != nil || tier.DailyLimit != 10 {
+		t.Fatalf("first registry basic = %+v, %v, want a daily limit of 10", tier, err)
+	}
+	if first.Exists("pro") {
+		t.Fatal("a tier loaded into one registry showed up in another")
+	}
+	if tier, err := second.Get("basic"); err != nil || tier.DailyLimit != 30 {
+		t.Fatalf("second registry basic = %+v, %v, want a daily limit of 30", tier, err)
+	}
+	if Default() == first || Default() == second {
+		t.Fatal("NewRegistry returned the default registry")
+	}
+}
+
+func TestRegistryConcurrentLoad(t *testing.T) {
+	r := loadRegistry(t, tierWithLimit(1))
+	paths := []string{writeTiers(t, tierWithLimit(1)), writeTiers(t, tierWithLimit(2))}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := r.Load(paths[(i+j)%2]); err != nil {
+					t.Errorf("load: %v", err)
+					return
+				}
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				tier, err := r.Get("basic")
+				if err != nil {
+					t.Errorf("get: %v", err)
+					return
+				}
+				// A reader sees one whole configuration or the other
+				if tier.DailyLimit != 1 && tier.DailyLimit != 2 {
+					t.Errorf("daily limit = %d mid-load", tier.DailyLimit)
+					return
+				}
+				_ = r.List()
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestExtends(t *testing.T) {
+	r := loadRegistry(t, `
+[tiers.basic]
+name = "Basic"
+daily_limit = 100
+monthly_limit = 1000
+max_devices = 1
+features = ["basic_api_access"]
+price_monthly = 9.0
+
+[tiers.pro]
+name = "Pro"
+extends = "basic"
+daily_limit = 1000
+features = ["api_analytics"]
+
+[tiers.enterprise]
+name = "Enterprise"
+extends = "pro"
+max_devices = 50
+features = ["sso"]
+
+[tiers.restricted]
+name = "Restricted"
+extends = "pro"
+features = ["sso"]
+override_features = true
+`)
+
+	tests := []struct {
+		tier     string
+		daily    int
+		monthly  int
+		devices  int
+		price    float64
+		features []string
+	}{
+		{"pro", 1000, 1000, 1, 9.0, []string{"basic_api_access", "api_analytics"}},
+		{"enterprise", 1000, 1000, 50, 9.0, []string{"basic_api_access", "api_analytics", "sso"}},
+		{"restricted", 1000, 1000, 1, 9.0, []string{"sso"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tier, func(t *testing.T) {
+			tier, err := r.Get(tt.tier)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tier.DailyLimit != tt.daily || tier.MonthlyLimit != tt.monthly || tier.MaxDevices != tt.devices || tier.PriceMonthly != tt.price {
+				t.Fatalf("limits %d/%d, %d devices, price %v, want %d/%d, %d devices, price %v",
+					tier.DailyLimit, tier.MonthlyLimit, tier.MaxDevices, tier.PriceMonthly,
+					tt.daily, tt.monthly, tt.devices, tt.price)
+			}
+			if fmt.Sprint(tier.Features) != fmt.Sprint(tt.features) {
+				t.Fatalf("features = %v, want %v", tier.Features, tt.features)
+			}
+		})
+	}
+	// The base tier isn't changed by the tiers extending it
+	if basic, _ := r.Get("basic"); fmt.Sprint(basic.Features) != "[basic_api_access]" {
+		t.Fatalf("basic features = %v", basic.Features)
+	}
+}
+
+func TestExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"self", `
+[tiers.a]
+name = "A"
+extends = "a"
+`, "a -> a"},
+		{"cycle", `
+[tiers.a]
+name = "A"
+extends = "c"
+
+[tiers.b]
+name = "B"
+extends = "a"
+
+[tiers.c]
+name = "C"
+extends = "b"
+`, "a -> c -> b -> a"},
+		{"unknown base", `
+[tiers.a]
+name = "A"
+extends = "missing"
+`, "unknown tier 'missing'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewRegistry().Load(writeTiers(t, tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTierHasFeature(t *testing.T) {
+	r := loadRegistry(t, `
+[tiers.basic]
+name = "Basic"
+features = ["basic_api_access"]
+
+[tiers.pro]
+name = "Pro"
+features = ["basic_api_access", "api_analytics"]
+
+[tiers.pro-legacy]
+name = "Pro (legacy)"
+features = ["legacy_export"]
+deprecated = true
+migrate_to = "pro"
+`)
+
+	tests := []struct {
+		tier, feature string
+		want          bool
+	}{
+		{"basic", "basic_api_access", true},
+		{"basic", "api_analytics", false},
+		{"pro", "api_analytics", true},
+		{"pro", "API_ANALYTICS", false}, // names are case-sensitive
+		// A deprecated tier has the features of its migration target
+		{"pro-legacy", "api_analytics", true},
+		{"pro-legacy", "legacy_export", false},
+	}
+	for _, tt := range tests {
+		got, err := r.TierHasFeature(tt.tier, tt.feature)
+		if err != nil || got != tt.want {
+			t.Errorf("TierHasFeature(%s, %s) = %v, %v, want %v", tt.tier, tt.feature, got, err, tt.want)
+		}
+	}
+
+	// GetRaw doesn't follow the migration, so the tier's own list is kept
+	raw, err := r.GetRaw("pro-legacy")
+	if err != nil || !raw.HasFeature("legacy_export") || raw.HasFeature("api_analytics") {
+		t.Fatalf("pro-legacy's own features = %v, %v", raw, err)
+	}
+	if _, err := r.TierHasFeature("missing", "api_analytics"); err == nil {
+		t.Fatal("unknown tier: expected an error")
+	}
+	if _, err := NewRegistry().TierHasFeature("basic", "api_analytics"); err == nil {
+		t.Fatal("unloaded registry: expected an error")
+	}
+}
+
+func TestTierCurrency(t *testing.T) {
+	r := loadRegistry(t, `
+[tiers.basic]
+name = "Basic"
+price_monthly = 9.99
+
+[tiers.eu]
+name = "EU"
+currency = "EUR"
+price_monthly = 8.99
+
+[tiers.eu-team]
+name = "EU Team"
+extends = "eu"
+`)
+	for name, want := range map[string]string{"basic": DefaultCurrency, "eu": "EUR", "eu-team": "EUR"} {
+		if tier, err := r.Get(name); err != nil || tier.Currency != want {
+			t.Errorf("%s currency = %+v, %v, want %s", name, tier, err, want)
+		}
+	}
+
+	for _, code := range []string{"eur", "EURO", "XYZ"} {
+		config := fmt.Sprintf("[tiers.basic]\nname = \"Basic\"\ncurrency = %q\n", code)
+		err := NewRegistry().Load(writeTiers(t, config))
+		if err == nil || !strings.Contains(err.Error(), "unknown currency") {
+			t.Errorf("currency %q: error = %v, want an unknown currency error", code, err)
+		}
+	}
+
+	if !IsCurrency("JPY") || IsCurrency("jpy") {
+		t.Fatal("IsCurrency must accept upper-case ISO codes only")
+	}
+	if got := CurrencySymbol("EUR"); got != "€" {
+		t.Fatalf("CurrencySymbol(EUR) = %q, want €", got)
+	}
+	if got := CurrencySymbol("SEK"); got != "SEK " {
+		t.Fatalf("CurrencySymbol(SEK) = %q, want the code and a space", got)
+	}
+}
+
+func TestTierAllowsProvider(t *testing.T) {
+	r := loadRegistry(t, `
+[tiers.basic]
+name = "Basic"
+providers = ["openai"]
+
+[tiers.basic-team]
+name = "Basic Team"
+extends = "basic"
+
+[tiers.pro]
+name = "Pro"
+
+[tiers.basic-legacy]
+name = "Basic (legacy)"
+providers = ["gemini"]
+deprecated = true
+migrate_to = "basic"
+`)
+
+	tests := []struct {
+		tier, provider string
+		want           bool
+	}{
+		{"basic", "openai", true},
+		{"basic", "anthropic", false},
+		{"basic", "OpenAI", false}, // names are case-sensitive
+		{"basic-team", "openai", true},
+		{"basic-team", "anthropic", false},
+		// No providers list means every provider
+		{"pro", "anthropic", true},
+		{"pro", "custom", true},
+		// A deprecated tier has the providers of its migration target
+		{"basic-legacy", "openai", true},
+		{"basic-legacy", "gemini", false},
+	}
+	for _, tt := range tests {
+		got, err := r.TierAllowsProvider(tt.tier, tt.provider)
+		if err != nil || got != tt.want {
+			t.Errorf("TierAllowsProvider(%s, %s) = %v, %v, want %v", tt.tier, tt.provider, got, err, tt.want)
+		}
+	}
+	if allowed, err := r.TierAllowsProvider("missing", "openai"); allowed || err == nil {
+		t.Fatalf("unknown tier = %v, %v, want refused with an error", allowed, err)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useLicenseCache replaces cachedLicenses with a cache of ttl for the
+// duration of the test
+func useLicenseCache(t *testing.T, ttl time.Duration) *licenseCache {
+	t.Helper()
+	previous := cachedLicenses
+	cachedLicenses = newLicenseCache(ttl)
+	t.Cleanup(func() { cachedLicenses = previous })
+	return cachedLicenses
+}
+
+// renameCustomer changes a license's customer name behind the cache's back
+func renameCustomer(t *testing.T, licenseID, name string) {
+	t.Helper()
+	_, err := db.Exec(fmt.Sprintf(`UPDATE licenses SET customer_name = %s WHERE license_id = %s`, sqlPlaceholder(1), sqlPlaceholder(2)), name, licenseID)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// customerName loads licenseID through getLicense
+func customerName(t *testing.T, licenseID string) string {
+	t.Helper()
+	license, err := getLicense(t.Context(), licenseID)
+	if err != nil {
+		t.Fatalf("getLicense: %v", err)
+	}
+	return license.CustomerName
+}
+
+func TestLicenseCacheHit(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	useLicenseCache(t, time.Minute)
+	seedLicense(t, "LIC-CACHE", "pro", time.Now().AddDate(0, 1, 0))
+
+	if got := customerName(t, "LIC-CACHE"); got != "Test Customer" {
+		t.Fatalf("first load = %q", got)
+	}
+	renameCustomer(t, "LIC-CACHE", "Renamed")
+	if got := customerName(t, "LIC-CACHE"); got != "Test Customer" {
+		t.Fatalf("second load = %q, want the cached row", got)
+	}
+
+	// Callers get copies, so changing one doesn't change the cache
+	license, err := getLicense(t.Context(), "LIC-CACHE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	license.CustomerName = "Changed by a caller"
+	if got := customerName(t, "LIC-CACHE"); got != "Test Customer" {
+		t.Fatalf("cached license changed through a returned copy: %q", got)
+	}
+}
+
+func TestLicenseCacheTTL(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	cache := useLicenseCache(t, time.Minute)
+	seedLicense(t, "LIC-CACHE", "pro", time.Now().AddDate(0, 1, 0))
+
+	customerName(t, "LIC-CACHE")
+	renameCustomer(t, "LIC-CACHE", "Renamed")
+	cache.mu.Lock()
+	entry := cache.entries["LIC-CACHE"]
+	entry.expires = time.Now().Add(-time.Second)
+	cache.entries["LIC-CACHE"] = entry
+	cache.mu.Unlock()
+
+	if got := customerName(t, "LIC-CACHE"); got != "Renamed" {
+		t.Fatalf("load after expiry = %q, want the database row", got)
+	}
+
+	// A zero TTL caches nothing
+	useLicenseCache(t, 0)
+	customerName(t, "LIC-CACHE")
+	renameCustomer(t, "LIC-CACHE", "Renamed again")
+	if got := customerName(t, "LIC-CACHE"); got != "Renamed again" {
+		t.Fatalf("load without a cache = %q", got)
+	}
+}
+
+func TestLicenseCacheInvalidate(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	useLicenseCache(t, time.Minute)
+	seedLicense(t, "LIC-CACHE-A", "pro", time.Now().AddDate(0, 1, 0))
+	seedLicense(t, "LIC-CACHE-B", "pro", time.Now().AddDate(0, 1, 0))
+	handler := handleCacheInvalidate()
+
+	invalidate := func(body string) int {
+		t.Helper()
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodPost, "/admin/cache/invalidate", strings.NewReader(body)))
+		var resp CacheInvalidateResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("status = %d, %v: %s", w.Code, err, w.Body)
+		}
+		return resp.Dropped
+	}
+
+	customerName(t, "LIC-CACHE-A")
+	customerName(t, "LIC-CACHE-B")
+	renameCustomer(t, "LIC-CACHE-A", "Renamed A")
+	renameCustomer(t, "LIC-CACHE-B", "Renamed B")
+
+	if dropped := invalidate(`{"license_key":"LIC-CACHE-A"}`); dropped != 1 {
+		t.Fatalf("dropped = %d, want 1", dropped)
+	}
+	if got := customerName(t, "LIC-CACHE-A"); got != "Renamed A" {
+		t.Fatalf("invalidated license = %q, want the database row", got)
+	}
+	if got := customerName(t, "LIC-CACHE-B"); got != "Test Customer" {
+		t.Fatalf("other license = %q, want it still cached", got)
+	}
+
+	if dropped := invalidate(""); dropped != 2 {
+		t.Fatalf("dropped = %d, want both licenses", dropped)
+	}
+	if got := customerName(t, "LIC-CACHE-B"); got != "Renamed B" {
+		t.Fatalf("license after clearing the cache = %q", got)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/database"
+)
+
+func TestEffectiveLimit(t *testing.T) {
+	limit := func(n int64) sql.NullInt64 { return sql.NullInt64{Int64: n, Valid: true} }
+	day := func(d string) sql.NullString { return sql.NullString{String: d, Valid: true} }
+
+	tests := []struct {
+		name      string
+		current   int64
+		previous  sql.NullInt64
+		changedOn sql.NullString
+		window    string
+		want      int64
+	}{
+		{"never changed", 10, sql.NullInt64{}, sql.NullString{}, "2026-06-15", 10},
+		{"reduced today", 10, limit(100), day("2026-06-15"), "2026-06-15", 100},
+		{"reduced yesterday", 10, limit(100), day("2026-06-14"), "2026-06-15", 10},
+		{"raised today", 100, limit(10), day("2026-06-15"), "2026-06-15", 100},
+		{"reduced from unlimited today", 10, limit(-1), day("2026-06-15"), "2026-06-15", -1},
+		{"made unlimited today", -1, limit(10), day("2026-06-15"), "2026-06-15", -1},
+		{"reduced this month", 500, limit(1000), day("2026-06-01"), "2026-06", 1000},
+		{"reduced on the last day of last month", 500, limit(1000), day("2026-05-31"), "2026-06", 500},
+		{"reduced next year, same month", 500, limit(1000), day("2027-06-01"), "2026-06", 500},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectiveLimit(tt.current, tt.previous, tt.changedOn, tt.window); got != tt.want {
+				t.Fatalf("effectiveLimit = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+// changeLimits sets a license's limits on day the way licensify-admin does
+func changeLimits(t *testing.T, licenseID string, daily, monthly int, day time.Time) {
+	t.Helper()
+	limitChange, limitArgs := database.LimitChangeAssignments(sqlPlaceholder, 3, day)
+	args := append([]interface{}{daily, monthly}, limitArgs...)
+	_, err := db.Exec(fmt.Sprintf(`UPDATE licenses SET daily_limit = %s, monthly_limit = %s, %s WHERE license_id = %s`,
+		sqlPlaceholder(1), sqlPlaceholder(2), strings.Join(limitChange, ", "), sqlPlaceholder(6)), append(args, licenseID)...)
+	if err != nil {
+		t.Fatalf("change limits: %v", err)
+	}
+}
+
+func TestLimitsInForceAfterSameDayChanges(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	seedLicense(t, "LIC-LIMITS", "basic", time.Now().AddDate(0, 1, 0)) // 100/day, 1000/month
+
+	now := time.Now()
+	changeLimits(t, "LIC-LIMITS", 50, 500, now)
+	changeLimits(t, "LIC-LIMITS", 20, 200, now)
+
+	check := func(t *testing.T, handler http.HandlerFunc, body interface{}) (daily, monthly int) {
+		t.Helper()
+		w := postJSON(handler, "/", body)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var resp struct {
+			DailyLimit   int `json:"daily_limit"`
+			MonthlyLimit int `json:"monthly_limit"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("response isn't JSON: %v", err)
+		}
+		return resp.DailyLimit, resp.MonthlyLimit
+	}
+
+	// The limits from the start of the day stay in force, not the first reduction
+	t.Run("check", func(t *testing.T) {
+		if daily, monthly := check(t, handleCheck(), CheckRequest{LicenseKey: "LIC-LIMITS"}); daily != 100 || monthly != 1000 {
+			t.Fatalf("/check limits = %d/%d, want 100/1000", daily, monthly)
+		}
+	})
+	t.Run("usage", func(t *testing.T) {
+		report := UsageReport{LicenseKey: "LIC-LIMITS", Date: now.Format("2006-01-02"), Scans: 1, HardwareID: "hw-1"}
+		if daily, monthly := check(t, handleUsageReport(nil), report); daily != 100 || monthly != 1000 {
+			t.Fatalf("/usage limits = %d/%d, want 100/1000", daily, monthly)
+		}
+	})
+	t.Run("next day", func(t *testing.T) {
+		license, err := loadLicense(t.Context(), "LIC-LIMITS")
+		if err != nil {
+			t.Fatalf("loadLicense: %v", err)
+		}
+		tomorrow := now.AddDate(0, 0, 1)
+		daily, _ := license.limitsOn(tomorrow.Format("2006-01-02"))
+		if daily != 20 {
+			t.Fatalf("daily limit tomorrow = %d, want 20", daily)
+		}
+	})
+}
@@ -14,25 +14,44 @@ import (
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	htmlpkg "html"
 	"io"
 	"log"
+	"log/slog"
+	"math"
 	"math/big"
+	"math/bits"
 	"net"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unicode/utf8"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
+	licensecrypto "github.com/melihbirim/licensify/internal/crypto"
+	"github.com/melihbirim/licensify/internal/database"
+	"github.com/melihbirim/licensify/internal/database/migrations"
+	"github.com/melihbirim/licensify/internal/email"
+	"github.com/melihbirim/licensify/internal/licensekey"
+	"github.com/melihbirim/licensify/internal/logging"
+	"github.com/melihbirim/licensify/internal/metrics"
+	"github.com/melihbirim/licensify/internal/providers"
+	"github.com/melihbirim/licensify/internal/redact"
+	"github.com/melihbirim/licensify/internal/secrets"
 	"github.com/melihbirim/licensify/internal/tiers"
-	"golang.org/x/crypto/argon2"
 	"golang.org/x/time/rate"
 	_ "modernc.org/sqlite"
 )
@@ -43,19 +62,40 @@ const (
 )
 
 var (
-	db           *sql.DB
-	privateKey   ed25519.PrivateKey //nolint:unused // Used for license signing (future feature)
-	isPostgresDB bool               // Track database type
+	db             *sql.DB
+	store          *database.DB               // Shared queries from internal/database
+	privateKey     ed25519.PrivateKey         // Signs activation bundles
+	retiredKeys    []licensecrypto.RetiredKey // Previous signing keys from KEYRING_PATH, still listed by /pubkey
+	isPostgresDB   bool                       // Track database type
+	defaultProduct = "default"                // Product covered by licenses without entitlements (DEFAULT_PRODUCT)
+	tierRegistry   *tiers.Registry            // Tier configuration from TIERS_CONFIG_PATH
 
 	// Build information (set via ldflags)
 	Version   = "1.1.0"
 	GitCommit = "unknown"
 	BuildTime = "unknown"
 
+	// Prometheus metrics, served on METRICS_ADDR
+	httpRequestsTotal        = metrics.NewCounterVec("licensify_http_requests_total", "HTTP requests by route and status code.", "route", "code")
+	activationsTotal         = metrics.NewCounterVec("licensify_activations_total", "Successful license activations by delivery mode.", "mode")
+	verificationsTotal       = metrics.NewCounterVec("licensify_verifications_total", "Email verification attempts by result.", "result")
+	proxyRequestsTotal       = metrics.NewCounterVec("licensify_proxy_requests_total", "Proxied requests by provider and upstream status code.", "provider", "code")
+	proxyRetriesTotal        = metrics.NewCounterVec("licensify_proxy_retries_total", "Upstream requests retried after a connection failure or 502/503/504.", "provider")
+	proxyCircuitOpen         = metrics.NewGaugeVec("licensify_proxy_circuit_open", "1 while a provider's circuit breaker is open, 0 when closed.", "provider")
+	rateLimitRejectionsTotal = metrics.NewCounterVec("licensify_rate_limit_rejections_total", "Requests rejected by a rate limiter.", "limiter")
+	dbQueryDuration          = metrics.NewHistogramVec("licensify_db_query_duration_seconds", "Database query latency.", metrics.DefBuckets, "query")
+
 	// Rate limiting
-	ipLimiters       = make(map[string]*rate.Limiter)
-	ipLimitersMu     sync.RWMutex
-	ipLimiterCleanup = 5 * time.Minute // Cleanup interval for rate limiters
+	ipLimiters      = newKeyedLimiters(10, 20) // Per client IP (RATE_LIMIT, RATE_BURST)
+	licenseLimiters *keyedLimiters             // Per license on /proxy (LICENSE_RATE_LIMIT), nil when disabled
+	limiterCleanup  = 5 * time.Minute          // Cleanup interval for rate limiters
+	trustedProxies  []netip.Prefix             // Peers whose X-Forwarded-For is honoured (TRUSTED_PROXIES)
+
+	proxyReplays    = newReplayCache(maxReplayEntries, maxReplayEntriesPerKey) // Signatures of recent proxy requests, cleaned up with the limiters
+	cachedLicenses  = newLicenseCache(0)                                       // getLicense results for LICENSE_CACHE_TTL, disabled until main sets it
+	activateReplies = newIdempotencyCache()                                    // /activate responses by Idempotency-Key, cleaned up with the limiters
+
+	kdfParams = licensecrypto.DefaultKDFParams // Argon2id settings for new salts (KDF_TIME, KDF_MEMORY_KIB, KDF_THREADS)
 )
 
 // sqlPlaceholder returns the correct SQL placeholder for the database type
@@ -66,30 +106,6 @@ func sqlPlaceholder(n int) string {
 	return "?"
 }
 
-// redactPII returns a redacted version of sensitive data for logging
-// Shows first 4 and last 4 characters for identification without full exposure
-func redactPII(s string) string {
-	if len(s) <= 8 {
-		return "***"
-	}
-	return s[:4] + "..." + s[len(s)-4:]
-}
-
-// redactEmail redacts email addresses for logging
-func redactEmail(email string) string {
-	parts := strings.Split(email, "@")
-	if len(parts) != 2 {
-		return "***@***"
-	}
-	username := parts[0]
-	domain := parts[1]
-
-	if len(username) <= 2 {
-		return "***@" + domain
-	}
-	return username[:min(2, len(username))] + "***@" + domain
-}
-
 // truncateStringUTF8 safely truncates a string to maxLen bytes while preserving UTF-8 character boundaries
 func truncateStringUTF8(s string, maxLen int) string {
 	if len(s) <= maxLen {
@@ -120,25 +136,97 @@ func min(a, b int) int {
 	return b
 }
 
-// getIPLimiter returns rate limiter for IP address
-func getIPLimiter(ip string) *rate.Limiter {
-	ipLimitersMu.RLock()
-	limiter, exists := ipLimiters[ip]
-	ipLimitersMu.RUnlock()
+// observeQuery records the latency of a database query started at start.
+// Call it as defer observeQuery("name", time.Now()).
+func observeQuery(query string, start time.Time) {
+	dbQueryDuration.Observe(time.Since(start).Seconds(), query)
+}
+
+// instrumentRequests counts every request by the mux pattern that served it,
+// so the route label stays bounded however many distinct paths clients send.
+// With logRequests it also logs each request with its request ID.
+func instrumentRequests(mux *http.ServeMux, logRequests bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+		httpRequestsTotal.Inc(route, strconv.Itoa(rec.status))
+		if logRequests {
+			requestLogger(r).Info("request", "method", r.Method, "path", r.URL.Path, "status", rec.status,
+				"duration_ms", time.Since(start).Milliseconds(), "ip", clientIP(r))
+		}
+	})
+}
+
+// keyedLimiters holds one token bucket per key, such as a client IP or a
+// license ID, so every request with the same key shares a rate limit
+type keyedLimiters struct {
+	limit rate.Limit
+	burst int
+
+	mu       sync.RWMutex
+	limiters map[string]*rate.Limiter
+}
+
+func newKeyedLimiters(limit rate.Limit, burst int) *keyedLimiters {
+	return &keyedLimiters{
+		limit:    limit,
+		burst:    burst,
+		limiters: make(map[string]*rate.Limiter),
+	}
+}
+
+// get returns the limiter for key, creating it on first use
+func (l *keyedLimiters) get(key string) *rate.Limiter {
+	l.mu.RLock()
+	limiter, exists := l.limiters[key]
+	l.mu.RUnlock()
 
 	if !exists {
-		ipLimitersMu.Lock()
-		limiter = rate.NewLimiter(rate.Limit(10), 20) // 10 req/sec, burst 20
-		ipLimiters[ip] = limiter
-		ipLimitersMu.Unlock()
+		l.mu.Lock()
+		// Re-check under the write lock so concurrent first requests share one limiter
+		if limiter, exists = l.limiters[key]; !exists {
+			limiter = rate.NewLimiter(l.limit, l.burst)
+			l.limiters[key] = limiter
+		}
+		l.mu.Unlock()
 	}
 
 	return limiter
 }
 
-// cleanupIPLimiters periodically removes inactive limiters to prevent memory leaks
-func cleanupIPLimiters(ctx context.Context) {
-	ticker := time.NewTicker(ipLimiterCleanup)
+// allow reports whether a request for key is within its rate limit.
+// A nil keyedLimiters allows everything.
+func (l *keyedLimiters) allow(key string) bool {
+	if l == nil {
+		return true
+	}
+	return l.get(key).Allow()
+}
+
+// cleanup removes limiters that have had no recent activity
+func (l *keyedLimiters) cleanup() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, limiter := range l.limiters {
+		// If limiter has full tokens (unused), remove it
+		if limiter.Tokens() >= float64(l.burst) {
+			delete(l.limiters, key)
+		}
+	}
+}
+
+// cleanupLimiters periodically removes inactive limiters and tarpit entries to prevent memory leaks
+func cleanupLimiters(ctx context.Context, t *tarpit) {
+	ticker := time.NewTicker(limiterCleanup)
 	defer ticker.Stop()
 
 	for {
@@ -146,15 +234,15 @@ func cleanupIPLimiters(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			ipLimitersMu.Lock()
-			// Remove limiters that have had no recent activity
-			for ip, limiter := range ipLimiters {
-				// If limiter has full tokens (unused), remove it
-				if limiter.Tokens() >= 20 {
-					delete(ipLimiters, ip)
-				}
+			ipLimiters.cleanup()
+			licenseLimiters.cleanup()
+			proxyReplays.cleanup()
+			cachedLicenses.cleanup()
+			activateReplies.cleanup()
+
+			if t != nil {
+				t.cleanup()
 			}
-			ipLimitersMu.Unlock()
 		}
 	}
 }
@@ -162,19 +250,10 @@ func cleanupIPLimiters(ctx context.Context) {
 // rateLimitMiddleware enforces per-IP rate limiting
 func rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			ip = r.RemoteAddr // Fallback if port parsing fails
-		}
-
-		// Check X-Forwarded-For header for proxied requests
-		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-			parts := strings.Split(xff, ",")
-			ip = strings.TrimSpace(parts[0])
-		}
+		ip := clientIP(r)
 
-		limiter := getIPLimiter(ip)
-		if !limiter.Allow() {
+		if !ipLimiters.allow(ip) {
+			rateLimitRejectionsTotal.Inc("ip")
 			w.Header().Set("Retry-After", "1")
 			sendError(w, "Too many requests from this IP", http.StatusTooManyRequests)
 			log.Printf("Rate limit exceeded for IP: %s", ip)
@@ -185,25 +264,637 @@ func rateLimitMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// tarpit slows down clients that repeatedly fail authentication (invalid
+// license keys, verification codes or proxy keys) with an escalating delay
+type tarpit struct {
+	threshold int           // failures allowed before delays start
+	baseDelay time.Duration // delay at the first failure past the threshold
+	maxDelay  time.Duration // cap for the escalating delay
+	window    time.Duration // failures are forgotten after this much quiet time
+	slots     chan struct{} // bounds how many requests can be held at once
+
+	mu       sync.Mutex
+	failures map[string]*tarpitEntry
+}
+
+type tarpitEntry struct {
+	count    int
+	lastSeen time.Time
+}
+
+func newTarpit(config *Config) *tarpit {
+	return &tarpit{
+		threshold: config.TarpitThreshold,
+		baseDelay: config.TarpitBaseDelay,
+		maxDelay:  config.TarpitMaxDelay,
+		window:    10 * time.Minute,
+		slots:     make(chan struct{}, config.TarpitMaxConcurrent),
+		failures:  make(map[string]*tarpitEntry),
+	}
+}
+
+// delay returns how long to hold a request from ip, doubling per failure past the threshold
+func (t *tarpit) delay(ip string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.failures[ip]
+	if !ok || time.Since(entry.lastSeen) > t.window {
+		return 0
+	}
+
+	excess := entry.count - t.threshold
+	if excess < 0 {
+		return 0
+	}
+
+	d := t.baseDelay
+	for i := 0; i < excess && d < t.maxDelay; i++ {
+		d *= 2
+	}
+	if d > t.maxDelay {
+		d = t.maxDelay
+	}
+	return d
+}
+
+func (t *tarpit) recordFailure(ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.failures[ip]
+	if !ok || time.Since(entry.lastSeen) > t.window {
+		entry = &tarpitEntry{}
+		t.failures[ip] = entry
+	}
+	entry.count++
+	entry.lastSeen = time.Now()
+}
+
+// cleanup drops entries that have been quiet longer than the window
+func (t *tarpit) cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for ip, entry := range t.failures {
+		if time.Since(entry.lastSeen) > t.window {
+			delete(t.failures, ip)
+		}
+	}
+}
+
+// statusRecorder captures the response status code for middleware
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying connection
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// responseCapture keeps a copy of the response status and body
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+// maxProxyBodySize caps the upstream request body a /proxy request may carry
+const maxProxyBodySize = 1024 * 1024
+
+// bodyLimitMiddleware answers 413 to request bodies over limit bytes, so a
+// huge POST can't exhaust memory while the handler decodes it
+func bodyLimitMiddleware(limit int64, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength > limit {
+			sendError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		// Read the body up front: handlers would report an overflow
+		// mid-decode as an invalid request
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				sendError(w, "Request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			sendError(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next(w, r)
+	}
+}
+
+// tarpitMiddleware delays responses to IPs with many recent authentication failures.
+// A nil tarpit disables the middleware.
+func tarpitMiddleware(t *tarpit, next http.HandlerFunc) http.HandlerFunc {
+	if t == nil {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := clientIP(r)
+
+		if d := t.delay(ip); d > 0 {
+			// Never hold more than the configured number of connections;
+			// reject outright once the tarpit is full
+			select {
+			case t.slots <- struct{}{}:
+			default:
+				w.Header().Set("Retry-After", strconv.Itoa(int(t.maxDelay.Seconds())+1))
+				sendError(w, "Too many failed attempts, try again later", http.StatusTooManyRequests)
+				return
+			}
+
+			log.Printf("🐌 Tarpitting %s for %v", ip, d)
+			timer := time.NewTimer(d)
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+				timer.Stop()
+				<-t.slots
+				return
+			}
+			<-t.slots
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+
+		if rec.status == http.StatusUnauthorized {
+			t.recordFailure(ip)
+		}
+	}
+}
+
+// inFlightCounter counts requests currently being handled, so shutdown can
+// report how many it waited for
+type inFlightCounter struct {
+	n atomic.Int64
+}
+
+func (c *inFlightCounter) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.n.Add(1)
+		defer c.n.Add(-1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+type requestIDKey struct{}
+
+// requestIDMiddleware gives every request an ID, taken from the client's
+// X-Request-ID when it is a sensible token and generated otherwise. The ID
+// is stored in the request context and echoed in the X-Request-ID response
+// header so a client's error report can be matched with the server logs.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// corsMiddleware lets browser apps on the CORS_ORIGINS allowlist call the
+// API. Preflight requests are answered with 204 before they reach a route,
+// so they don't count against rate limits, while rejections such as 429
+// still carry the headers a browser needs to read them. An empty allowlist
+// disables CORS.
+func corsMiddleware(origins []string, next http.Handler) http.Handler {
+	if len(origins) == 0 {
+		return next
+	}
+	allowAll := slices.Contains(origins, "*")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && (allowAll || slices.Contains(origins, strings.ToLower(origin)))
+
+		h := w.Header()
+		if !allowAll {
+			h.Add("Vary", "Origin")
+		}
+		if allowed {
+			if allowAll {
+				h.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				h.Set("Access-Control-Allow-Origin", origin)
+			}
+			h.Set("Access-Control-Expose-Headers", "X-Request-ID, Retry-After, ETag, Idempotent-Replayed")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if allowed {
+				h.Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+				h.Set("Access-Control-Allow-Headers", "Content-Type, X-Request-ID, If-None-Match, Idempotency-Key")
+				h.Set("Access-Control-Max-Age", "600")
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestIDFromContext returns the ID assigned by requestIDMiddleware, or ""
+// outside a request
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestLogger returns the default logger tagged with the request's ID
+func requestLogger(r *http.Request) *slog.Logger {
+	if id := requestIDFromContext(r.Context()); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// validRequestID accepts client IDs of up to 128 letters, digits and
+// "-_.:", enough for UUIDs and trace IDs without letting clients inject
+// arbitrary text into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// clientIP returns the client IP. X-Forwarded-For is only honoured when the
+// connection comes from a TRUSTED_PROXIES address, since anyone else could
+// send a fake header to dodge rate limits; the client is then the nearest
+// entry that isn't itself a trusted proxy. IPs are normalized so one client
+// always maps to the same rate limiter and tarpit key.
+func clientIP(r *http.Request) string {
+	ip := normalizeIP(r.RemoteAddr)
+	if ip == "" {
+		return r.RemoteAddr // Fallback if the address can't be parsed
+	}
+	if !isTrustedProxy(ip) {
+		return ip
+	}
+
+	// Walk the proxied hops from the nearest one, skipping malformed entries
+	hops := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		forwarded := normalizeIP(hops[i])
+		if forwarded == "" {
+			continue
+		}
+		ip = forwarded
+		if !isTrustedProxy(forwarded) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// isTrustedProxy reports whether a normalized IP is in TRUSTED_PROXIES
+func isTrustedProxy(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeIP parses an IP address, optionally with a port or in brackets
+// ("[::1]:8080"), and returns it in canonical form: lowercase IPv6 without a
+// zone and IPv4-mapped IPv6 as plain IPv4. It returns "" if s is not an IP.
+func normalizeIP(s string) string {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return ""
+	}
+	return addr.WithZone("").Unmap().String()
+}
+
+// initChallenge is an optional anti-bot check on /init, run before a
+// verification code is created (INIT_CHALLENGE)
+type initChallenge interface {
+	// describe tells clients what to solve; served at GET /init/challenge
+	describe() map[string]interface{}
+	// verify checks the challenge fields of an /init request
+	verify(r *http.Request, req InitRequest) error
+}
+
+// captchaVerifyURLs are the server-side verification endpoints of the
+// supported CAPTCHA providers, which all share the same form API
+var captchaVerifyURLs = map[string]string{
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+}
+
+// newInitChallenge builds the configured challenge, or nil when disabled
+func newInitChallenge(config *Config) initChallenge {
+	switch config.InitChallenge {
+	case "pow":
+		// Derive the HMAC key from the signing key so every instance accepts
+		// challenges issued by any other
+		key := sha256.Sum256(append([]byte("licensify-init-challenge:"), privateKey.Seed()...))
+		return &powChallenge{
+			difficulty: config.PowDifficulty,
+			key:        key[:],
+			ttl:        5 * time.Minute,
+			used:       make(map[string]time.Time),
+		}
+	case "turnstile", "hcaptcha", "recaptcha":
+		return &captchaChallenge{
+			provider:  config.InitChallenge,
+			verifyURL: captchaVerifyURLs[config.InitChallenge],
+			secret:    config.CaptchaSecret,
+			siteKey:   config.CaptchaSiteKey,
+			client:    &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return nil
+}
+
+// powChallenge is a stateless hashcash-style proof of work. A challenge is
+// "<unix time>.<random>.<hmac>"; the client must find a response such that
+// SHA-256(challenge + ":" + response) starts with difficulty zero bits.
+type powChallenge struct {
+	difficulty int
+	key        []byte        // HMAC key proving the challenge was issued here
+	ttl        time.Duration // how long a challenge can be solved and used
+
+	mu   sync.Mutex
+	used map[string]time.Time // solved challenges, remembered until they expire
+}
+
+func (p *powChallenge) describe() map[string]interface{} {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	payload := fmt.Sprintf("%d.%s", time.Now().Unix(), hex.EncodeToString(nonce))
+
+	return map[string]interface{}{
+		"type":       "pow",
+		"algorithm":  "sha256",
+		"challenge":  payload + "." + p.sign(payload),
+		"difficulty": p.difficulty,
+		"expires_in": int(p.ttl.Seconds()),
+	}
+}
+
+func (p *powChallenge) sign(payload string) string {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (p *powChallenge) verify(r *http.Request, req InitRequest) error {
+	if req.Challenge == "" || req.ChallengeResponse == "" {
+		return fmt.Errorf("challenge required: fetch one from GET /init/challenge")
+	}
+
+	parts := strings.Split(req.Challenge, ".")
+	if len(parts) != 3 || !hmac.Equal([]byte(parts[2]), []byte(p.sign(parts[0]+"."+parts[1]))) {
+		return fmt.Errorf("invalid challenge")
+	}
+	issued, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || time.Since(time.Unix(issued, 0)) > p.ttl {
+		return fmt.Errorf("challenge expired")
+	}
+
+	sum := sha256.Sum256([]byte(req.Challenge + ":" + req.ChallengeResponse))
+	if leadingZeroBits(sum[:]) < p.difficulty {
+		return fmt.Errorf("invalid challenge response")
+	}
+
+	// Each solved challenge can be used once
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for c, expires := range p.used {
+		if time.Now().After(expires) {
+			delete(p.used, c)
+		}
+	}
+	if _, seen := p.used[req.Challenge]; seen {
+		return fmt.Errorf("challenge already used")
+	}
+	p.used[req.Challenge] = time.Unix(issued, 0).Add(p.ttl)
+	return nil
+}
+
+func leadingZeroBits(b []byte) int {
+	n := 0
+	for _, c := range b {
+		if c != 0 {
+			return n + bits.LeadingZeros8(c)
+		}
+		n += 8
+	}
+	return n
+}
+
+// captchaChallenge verifies a CAPTCHA token with the provider's siteverify API
+type captchaChallenge struct {
+	provider  string
+	verifyURL string
+	secret    string
+	siteKey   string
+	client    *http.Client
+}
+
+func (c *captchaChallenge) describe() map[string]interface{} {
+	return map[string]interface{}{
+		"type":     "captcha",
+		"provider": c.provider,
+		"site_key": c.siteKey,
+	}
+}
+
+func (c *captchaChallenge) verify(r *http.Request, req InitRequest) error {
+	if req.ChallengeResponse == "" {
+		return fmt.Errorf("CAPTCHA required")
+	}
+
+	resp, err := c.client.PostForm(c.verifyURL, url.Values{
+		"secret":   {c.secret},
+		"response": {req.ChallengeResponse},
+		"remoteip": {clientIP(r)},
+	})
+	if err != nil {
+		log.Printf("⚠️  %s verification failed: %v", c.provider, err)
+		return fmt.Errorf("could not verify CAPTCHA, try again")
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Printf("⚠️  %s verification returned invalid JSON: %v", c.provider, err)
+		return fmt.Errorf("could not verify CAPTCHA, try again")
+	}
+	if !result.Success {
+		return fmt.Errorf("CAPTCHA verification failed")
+	}
+	return nil
+}
+
+// handleInitChallenge tells clients which challenge /init expects
+func handleInitChallenge(challenge initChallenge) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		response := map[string]interface{}{"type": "none"}
+		if challenge != nil {
+			response = challenge.describe()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
 // Config represents server configuration
 type Config struct {
 	Port                     string
 	PrivateKeyB64            string
+	KeyringPath              string
 	ProtectedAPIKey          string
 	DatabasePath             string
 	DatabaseURL              string
 	ResendAPIKey             string
 	FromEmail                string
+	SMTPHost                 string
+	SMTPPort                 int
+	SMTPUser                 string
+	SMTPPass                 string
+	SMTPTLS                  string
+	EmailTemplateDir         string
+	EmailTransport           string        // "smtp", "resend" or "" when email is not configured
+	Mailer                   *email.Client // nil when email is not configured
 	ProxyMode                bool
 	OpenAIKey                string
 	AnthropicKey             string
+	GeminiKey                string
+	ProvidersConfigPath      string
+	Providers                *providers.Registry // upstreams available in proxy mode
 	TiersConfigPath          string
+	DefaultTier              string
+	FreeLicenseDays          int
+	DefaultProduct           string
 	ShutdownTimeout          time.Duration
 	RequireEmailVerification bool
 	WebhookURL               string
 	WebhookSecret            string
 	AdminUsername            string
 	AdminPassword            string
+	AdminAPIKey              string
+	AllowAnonymousTrial      bool
+	TrialDays                int
+	MultipleLicensesPerEmail bool
+	EnableActivationTest     bool
+	EnableReceipts           bool
+	WALCheckpointOnShutdown  bool
+	AutoTierEnabled          bool
+	AutoTierInterval         time.Duration
+	AutoTierDryRun           bool
+	TarpitEnabled            bool
+	TarpitThreshold          int
+	TarpitBaseDelay          time.Duration
+	TarpitMaxDelay           time.Duration
+	TarpitMaxConcurrent      int
+	RateLimit                float64
+	RateBurst                int
+	LicenseRateLimit         float64
+	LicenseRateBurst         int
+	TrustedProxies           []netip.Prefix
+	KDFTime                  int
+	KDFMemoryKiB             int
+	KDFThreads               int
+	TiersCacheMaxAge         time.Duration
+	InitChallenge            string
+	PowDifficulty            int
+	CaptchaSecret            string
+	CaptchaSiteKey           string
+	UsageThresholds          []int
+	UsageAlertEmail          bool
+	TokenUsage               bool
+	ProxyAudit               bool
+	ProxyStrictUsage         bool
+	ProxyKeyTTL              time.Duration // 0 means proxy keys never expire
+	ProxyLegacySignatures    bool
+	LicenseCacheTTL          time.Duration // 0 disables the license cache
+	RevocationRefresh        time.Duration
+	VerificationCooldown     time.Duration
+	MetricsAddr              string
+	LogRequests              bool
+	LogFormat                string
+	MaxRequestBody           int
+	CORSOrigins              []string
+	ProxyRetries             int
+	ProxyRetryBackoff        time.Duration
+	ProxyBreakerThreshold    int
+	ProxyBreakerCooldown     time.Duration
+	ProxyTimeout             time.Duration
+	ProxyStreamTimeout       time.Duration
+	ProviderTimeouts         map[string]time.Duration
 }
 
 // LicenseData represents license information
@@ -219,7 +910,23 @@ type LicenseData struct {
 		MonthlyLimit   int `json:"monthly_limit"`
 		MaxActivations int `json:"max_activations"`
 	} `json:"limits"`
-	Active bool `json:"active"`
+	Active   bool     `json:"active"`
+	Products []string `json:"products"` // Entitled products; DEFAULT_PRODUCT when none are set
+
+	// Limits before the last change, still in force until the next reset
+	previousDailyLimit, previousMonthlyLimit sql.NullInt64
+	limitsChangedOn                          sql.NullString
+}
+
+// limitsOn returns the daily and monthly limits enforced on date
+// (YYYY-MM-DD), see effectiveLimit
+func (l *LicenseData) limitsOn(date string) (daily, monthly int) {
+	daily = int(effectiveLimit(int64(l.Limits.DailyLimit), l.previousDailyLimit, l.limitsChangedOn, date))
+	if len(date) >= 7 {
+		date = date[:7]
+	}
+	monthly = int(effectiveLimit(int64(l.Limits.MonthlyLimit), l.previousMonthlyLimit, l.limitsChangedOn, date))
+	return daily, monthly
 }
 
 // ActivationRequest from CLI
@@ -229,14 +936,31 @@ type ActivationRequest struct {
 	Timestamp  string `json:"timestamp"`
 }
 
-// ActivationResponse to CLI
+// ActivationResponse to CLI.
+//
+// encrypted_api_key is an AES-256-GCM sealed JSON bundle (see DecryptedData),
+// base64 encoded, with its nonce in iv. The AES key is
+// Argon2id(license_key + ":" + hardware_id, salt, t=3, m=64MiB, p=4, len=32),
+// where salt is the hex encoded per-license salt. Salts created with other
+// settings carry them as a prefix, "argon2id$t=1,m=19456,p=1$<hex salt>"
+// (see licensecrypto.EncodeSalt). In "proxy" mode the bundle's
+// api_key is the proxy key; in "direct" mode it is the protected API key.
+//
+// bundle_signature is a base64 Ed25519 signature over
+// encrypted_api_key + "." + iv + "." + license_key, verifiable with the key
+// from GET /pubkey.
 type ActivationResponse struct {
-	Success         bool      `json:"success"`
-	CustomerName    string    `json:"customer_name,omitempty"`
-	ExpiresAt       time.Time `json:"expires_at,omitempty"`
-	Tier            string    `json:"tier,omitempty"`
-	EncryptedAPIKey string    `json:"encrypted_api_key,omitempty"`
-	IV              string    `json:"iv,omitempty"`
+	Success         bool       `json:"success"`
+	Mode            string     `json:"mode,omitempty"` // "direct" or "proxy"
+	CustomerName    string     `json:"customer_name,omitempty"`
+	ExpiresAt       time.Time  `json:"expires_at,omitempty"`
+	Tier            string     `json:"tier,omitempty"`
+	EncryptedAPIKey string     `json:"encrypted_api_key,omitempty"`
+	IV              string     `json:"iv,omitempty"`
+	Salt            string     `json:"salt,omitempty"`
+	BundleSignature string     `json:"bundle_signature,omitempty"`
+	Products        []string   `json:"products,omitempty"`
+	ProxyKeyExpires *time.Time `json:"proxy_key_expires_at,omitempty"` // proxy mode, when PROXY_KEY_TTL is set
 	Limits          struct {
 		DailyLimit     int `json:"daily_limit"`
 		MonthlyLimit   int `json:"monthly_limit"`
@@ -245,14 +969,36 @@ type ActivationResponse struct {
 	Error string `json:"error,omitempty"`
 }
 
+// ActivationTestSentinel is the API key placed in /activate/test bundles
+const ActivationTestSentinel = "licensify-activation-test-sentinel"
+
+// ActivationTestResponse carries a sentinel bundle plus everything needed to derive the key
+type ActivationTestResponse struct {
+	Success         bool   `json:"success"`
+	EncryptedAPIKey string `json:"encrypted_api_key"`
+	IV              string `json:"iv"`
+	Salt            string `json:"salt"`
+	KDF             string `json:"kdf"`
+	Sentinel        string `json:"sentinel"`
+}
+
 // ErrorResponse for generic errors
 type ErrorResponse struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error"`
+	Code       string `json:"code,omitempty"`        // machine-readable error code
+	ServerTime int64  `json:"server_time,omitempty"` // server clock, sent with timestamp_out_of_window
 }
 
 // InitRequest for free tier onboarding
 type InitRequest struct {
+	Email             string `json:"email"`
+	Challenge         string `json:"challenge,omitempty"`          // proof-of-work challenge from GET /init/challenge
+	ChallengeResponse string `json:"challenge_response,omitempty"` // proof-of-work solution or CAPTCHA token
+}
+
+// ResendRequest asks for the pending verification code to be emailed again
+type ResendRequest struct {
 	Email string `json:"email"`
 }
 
@@ -272,26 +1018,75 @@ type VerifyRequest struct {
 
 // VerifyResponse with license key
 type VerifyResponse struct {
-	Success    bool   `json:"success"`
-	LicenseKey string `json:"license_key,omitempty"`
-	Tier       string `json:"tier,omitempty"`
-	DailyLimit int    `json:"daily_limit,omitempty"`
-	Message    string `json:"message,omitempty"`
-	Error      string `json:"error,omitempty"`
+	Success      bool       `json:"success"`
+	LicenseKey   string     `json:"license_key,omitempty"`
+	Tier         string     `json:"tier,omitempty"`
+	DailyLimit   int        `json:"daily_limit,omitempty"`
+	MonthlyLimit int        `json:"monthly_limit,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Message      string     `json:"message,omitempty"`
+	Error        string     `json:"error,omitempty"`
 }
 
-// UsageReport from CLI
-type UsageReport struct {
-	LicenseKey string `json:"license_key"`
-	Date       string `json:"date"` // YYYY-MM-DD
-	Scans      int    `json:"scans"`
+// TrialRequest for anonymous, hardware-bound trial licenses
+type TrialRequest struct {
 	HardwareID string `json:"hardware_id"`
 }
 
-// UsageResponse to CLI
-type UsageResponse struct {
-	Success      bool   `json:"success"`
-	DailyUsage   int    `json:"daily_usage,omitempty"`
+// TrialResponse with the trial license key
+type TrialResponse struct {
+	Success      bool      `json:"success"`
+	LicenseKey   string    `json:"license_key,omitempty"`
+	Tier         string    `json:"tier,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	DailyLimit   int       `json:"daily_limit,omitempty"`
+	MonthlyLimit int       `json:"monthly_limit,omitempty"`
+	Message      string    `json:"message,omitempty"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// SeatsRequest sets a license's activation limit from a billing quantity
+type SeatsRequest struct {
+	LicenseKey string `json:"license_key"`
+	Seats      int    `json:"seats"`
+}
+
+// SeatsResponse reports the new seat limit and current device count
+type SeatsResponse struct {
+	Success            bool   `json:"success"`
+	LicenseKey         string `json:"license_key"`
+	Seats              int    `json:"seats"`
+	CurrentActivations int    `json:"current_activations"`
+	OverProvisioned    bool   `json:"over_provisioned"`
+	Error              string `json:"error,omitempty"`
+}
+
+// UsageReport from CLI
+type UsageReport struct {
+	LicenseKey string `json:"license_key"`
+	Date       string `json:"date"` // YYYY-MM-DD
+	Scans      int    `json:"scans"`
+	HardwareID string `json:"hardware_id"`
+}
+
+// UsageBatchReport reports several days or devices of usage at once
+type UsageBatchReport struct {
+	LicenseKey string            `json:"license_key"`
+	Entries    []UsageBatchEntry `json:"entries"`
+}
+
+// UsageBatchEntry is one report in a UsageBatchReport
+type UsageBatchEntry struct {
+	Date       string `json:"date"` // YYYY-MM-DD
+	Scans      int    `json:"scans"`
+	HardwareID string `json:"hardware_id"`
+}
+
+// UsageResponse to CLI
+type UsageResponse struct {
+	Success      bool   `json:"success"`
+	Recorded     int    `json:"recorded,omitempty"` // scans recorded by a batch
+	DailyUsage   int    `json:"daily_usage,omitempty"`
 	MonthlyUsage int    `json:"monthly_usage,omitempty"`
 	DailyLimit   int    `json:"daily_limit,omitempty"`
 	MonthlyLimit int    `json:"monthly_limit,omitempty"`
@@ -299,6 +1094,22 @@ type UsageResponse struct {
 	Error        string `json:"error,omitempty"`
 }
 
+// UsageHistoryResponse is returned by GET /usage
+type UsageHistoryResponse struct {
+	Success    bool       `json:"success"`
+	From       string     `json:"from"`
+	To         string     `json:"to"`
+	Days       []UsageDay `json:"days"` // every day in the range, including days without usage
+	TotalScans int        `json:"total_scans"`
+	DailyLimit int        `json:"daily_limit"`
+}
+
+// UsageDay is one entry of a usage history
+type UsageDay struct {
+	Date  string `json:"date"`
+	Scans int    `json:"scans"`
+}
+
 // DecryptedData represents the data bundle sent to client
 type DecryptedData struct {
 	APIKey       string    `json:"api_key"`
@@ -312,48 +1123,376 @@ type DecryptedData struct {
 	} `json:"limits"`
 }
 
-func loadConfig() *Config {
-	proxyMode := getEnv("PROXY_MODE", "false") == "true"
-	requireEmailVerification := getEnv("REQUIRE_EMAIL_VERIFICATION", "true") == "true"
+// envLoader reads typed environment variables, collecting every parse
+// error so misconfiguration is reported all at once
+type envLoader struct {
+	errors []string
+}
+
+func (l *envLoader) str(key, defaultValue string) string {
+	return getEnv(key, defaultValue)
+}
 
-	// Parse shutdown timeout with default of 30 seconds
-	shutdownTimeout := 30 * time.Second
-	if timeoutStr := getEnv("SHUTDOWN_TIMEOUT", ""); timeoutStr != "" {
-		if parsed, err := time.ParseDuration(timeoutStr); err == nil {
-			shutdownTimeout = parsed
-		} else {
-			log.Printf("⚠️  Invalid SHUTDOWN_TIMEOUT format, using default 30s")
+func (l *envLoader) secret(key string) string {
+	value, err := secrets.Get(key)
+	if err != nil {
+		l.errors = append(l.errors, err.Error())
+	}
+	return value
+}
+
+func (l *envLoader) boolean(key string, defaultValue bool) bool {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(v)
+	if err != nil {
+		l.errors = append(l.errors, fmt.Sprintf("%s must be true or false, got %q", key, v))
+		return defaultValue
+	}
+	return parsed
+}
+
+func (l *envLoader) integer(key string, defaultValue, minValue int) int {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(v)
+	if err != nil || parsed < minValue {
+		l.errors = append(l.errors, fmt.Sprintf("%s must be an integer >= %d, got %q", key, minValue, v))
+		return defaultValue
+	}
+	return parsed
+}
+
+func (l *envLoader) number(key string, defaultValue float64) float64 {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseFloat(v, 64)
+	if err != nil || parsed <= 0 {
+		l.errors = append(l.errors, fmt.Sprintf("%s must be a positive number, got %q", key, v))
+		return defaultValue
+	}
+	return parsed
+}
+
+func (l *envLoader) duration(key string, defaultValue time.Duration) time.Duration {
+	v := os.Getenv(key)
+	if v == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(v)
+	if err != nil || parsed <= 0 {
+		l.errors = append(l.errors, fmt.Sprintf("%s must be a positive duration like 30s or 5m, got %q", key, v))
+		return defaultValue
+	}
+	return parsed
+}
+
+// timeout is duration, but also accepts 0 for no limit
+func (l *envLoader) timeout(key string, defaultValue time.Duration) time.Duration {
+	if os.Getenv(key) == "0" {
+		return 0
+	}
+	return l.duration(key, defaultValue)
+}
+
+// origins parses a comma-separated list of browser origins like
+// "https://app.example.com,http://localhost:3000", or "*" for any origin
+func (l *envLoader) origins(key string) []string {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var values []string
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSuffix(strings.TrimSpace(part), "/")
+		if part == "*" {
+			values = append(values, part)
+			continue
+		}
+		u, err := url.Parse(part)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			l.errors = append(l.errors, fmt.Sprintf("%s must be \"*\" or a comma-separated list of origins like https://app.example.com, got %q", key, part))
+			return nil
+		}
+		values = append(values, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	return values
+}
+
+// prefixes parses a comma-separated list of CIDRs like "10.0.0.0/8,::1/128".
+// A bare IP is taken as a single-address prefix.
+func (l *envLoader) prefixes(key string) []netip.Prefix {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var values []netip.Prefix
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(part)
+			if addrErr != nil {
+				l.errors = append(l.errors, fmt.Sprintf("%s must be a comma-separated list of CIDRs or IPs, got %q", key, part))
+				return nil
+			}
+			prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+		}
+		values = append(values, prefix.Masked())
+	}
+	return values
+}
+
+// percentages parses a comma-separated list of whole percentages like "80,100"
+func (l *envLoader) percentages(key string) []int {
+	v := os.Getenv(key)
+	if v == "" {
+		return nil
+	}
+	var values []int
+	for _, part := range strings.Split(v, ",") {
+		parsed, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || parsed < 1 || parsed > 1000 {
+			l.errors = append(l.errors, fmt.Sprintf("%s must be a comma-separated list of percentages between 1 and 1000, got %q", key, v))
+			return nil
+		}
+		values = append(values, parsed)
+	}
+	return values
+}
+
+// loadConfig parses all server environment variables into a Config.
+// Malformed values are returned as a single error listing every problem;
+// cross-field checks happen in validateConfig.
+func loadConfig() (*Config, error) {
+	env := &envLoader{}
+
+	config := &Config{
+		Port:                     env.str("PORT", DefaultPort),
+		DatabasePath:             env.str("DB_PATH", DBFile),
+		DatabaseURL:              env.str("DATABASE_URL", ""),
+		PrivateKeyB64:            env.secret("PRIVATE_KEY"),
+		KeyringPath:              env.str("KEYRING_PATH", ""),
+		ResendAPIKey:             env.secret("RESEND_API_KEY"),
+		FromEmail:                env.str("FROM_EMAIL", ""),
+		EmailTemplateDir:         env.str("EMAIL_TEMPLATE_DIR", ""),
+		SMTPHost:                 env.str("SMTP_HOST", ""),
+		SMTPPort:                 env.integer("SMTP_PORT", 587, 1),
+		SMTPUser:                 env.str("SMTP_USER", ""),
+		SMTPPass:                 env.secret("SMTP_PASS"),
+		SMTPTLS:                  env.str("SMTP_TLS", email.SMTPStartTLS),
+		ProtectedAPIKey:          env.secret("PROTECTED_API_KEY"),
+		ProxyMode:                env.boolean("PROXY_MODE", false),
+		OpenAIKey:                env.secret("OPENAI_API_KEY"),
+		AnthropicKey:             env.secret("ANTHROPIC_API_KEY"),
+		GeminiKey:                env.secret("GEMINI_API_KEY"),
+		ProvidersConfigPath:      env.str("PROVIDERS_CONFIG_PATH", ""),
+		TiersConfigPath:          env.str("TIERS_CONFIG_PATH", "tiers.toml"),
+		DefaultTier:              env.str("DEFAULT_TIER", "tier-1"),
+		FreeLicenseDays:          env.integer("FREE_LICENSE_DAYS", 30, 1),
+		MultipleLicensesPerEmail: env.boolean("ALLOW_MULTIPLE_LICENSES_PER_EMAIL", false),
+		DefaultProduct:           env.str("DEFAULT_PRODUCT", "default"),
+		ShutdownTimeout:          env.duration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		RequireEmailVerification: env.boolean("REQUIRE_EMAIL_VERIFICATION", true),
+		WebhookURL:               env.str("WEBHOOK_URL", ""),
+		WebhookSecret:            env.str("WEBHOOK_SECRET", ""),
+		AdminUsername:            env.str("ADMIN_USERNAME", ""),
+		AdminPassword:            env.str("ADMIN_PASSWORD", ""),
+		AdminAPIKey:              env.secret("ADMIN_API_KEY"),
+		AllowAnonymousTrial:      env.boolean("ALLOW_ANONYMOUS_TRIAL", false),
+		TrialDays:                env.integer("TRIAL_DAYS", 7, 1),
+		EnableActivationTest:     env.boolean("ENABLE_ACTIVATION_TEST", false),
+		EnableReceipts:           env.boolean("ENABLE_RECEIPTS", false),
+		WALCheckpointOnShutdown:  env.boolean("WAL_CHECKPOINT_ON_SHUTDOWN", true),
+		AutoTierEnabled:          env.boolean("AUTO_TIER_ENABLED", false),
+		AutoTierInterval:         env.duration("AUTO_TIER_INTERVAL", 24*time.Hour),
+		AutoTierDryRun:           env.boolean("AUTO_TIER_DRY_RUN", false),
+		TarpitEnabled:            env.boolean("TARPIT_ENABLED", false),
+		TarpitThreshold:          env.integer("TARPIT_THRESHOLD", 5, 0),
+		TarpitBaseDelay:          env.duration("TARPIT_BASE_DELAY", 500*time.Millisecond),
+		TarpitMaxDelay:           env.duration("TARPIT_MAX_DELAY", 10*time.Second),
+		TarpitMaxConcurrent:      env.integer("TARPIT_MAX_CONCURRENT", 50, 1),
+		RateLimit:                env.number("RATE_LIMIT", 10),
+		RateBurst:                env.integer("RATE_BURST", 20, 1),
+		LicenseRateLimit:         env.number("LICENSE_RATE_LIMIT", 0),
+		LicenseRateBurst:         env.integer("LICENSE_RATE_BURST", 20, 1),
+		TrustedProxies:           env.prefixes("TRUSTED_PROXIES"),
+		MaxRequestBody:           env.integer("MAX_REQUEST_BODY", 64*1024, 1024),
+		CORSOrigins:              env.origins("CORS_ORIGINS"),
+		KDFTime:                  env.integer("KDF_TIME", int(licensecrypto.DefaultKDFParams.Time), 1),
+		KDFMemoryKiB:             env.integer("KDF_MEMORY_KIB", int(licensecrypto.DefaultKDFParams.Memory), 8),
+		KDFThreads:               env.integer("KDF_THREADS", int(licensecrypto.DefaultKDFParams.Threads), 1),
+		TiersCacheMaxAge:         env.duration("TIERS_CACHE_MAX_AGE", 5*time.Minute),
+		InitChallenge:            env.str("INIT_CHALLENGE", ""),
+		PowDifficulty:            env.integer("POW_DIFFICULTY", 20, 1),
+		CaptchaSecret:            env.secret("CAPTCHA_SECRET"),
+		CaptchaSiteKey:           env.str("CAPTCHA_SITE_KEY", ""),
+		UsageThresholds:          env.percentages("USAGE_THRESHOLDS"),
+		UsageAlertEmail:          env.boolean("USAGE_ALERT_EMAIL", false),
+		TokenUsage:               env.boolean("TOKEN_USAGE", false),
+		ProxyAudit:               env.boolean("PROXY_AUDIT", false),
+		ProxyStrictUsage:         env.boolean("PROXY_STRICT_USAGE", false),
+		ProxyKeyTTL:              env.timeout("PROXY_KEY_TTL", 0),
+		ProxyLegacySignatures:    env.boolean("PROXY_LEGACY_SIGNATURES", false),
+		LicenseCacheTTL:          env.timeout("LICENSE_CACHE_TTL", 0),
+		RevocationRefresh:        env.duration("REVOCATION_REFRESH", time.Minute),
+		ProxyRetries:             env.integer("PROXY_RETRIES", 2, 0),
+		ProxyRetryBackoff:        env.duration("PROXY_RETRY_BACKOFF", 250*time.Millisecond),
+		ProxyBreakerThreshold:    env.integer("PROXY_BREAKER_THRESHOLD", 5, 0),
+		ProxyBreakerCooldown:     env.duration("PROXY_BREAKER_COOLDOWN", 30*time.Second),
+		ProxyTimeout:             env.duration("PROXY_TIMEOUT", 60*time.Second),
+		ProxyStreamTimeout:       env.timeout("PROXY_STREAM_TIMEOUT", 10*time.Minute),
+		VerificationCooldown:     env.duration("VERIFICATION_RESEND_COOLDOWN", time.Minute),
+		MetricsAddr:              env.str("METRICS_ADDR", ""),
+		LogRequests:              env.boolean("LOG_REQUESTS", false),
+		LogFormat:                env.str("LOG_FORMAT", logging.FormatText),
+	}
+
+	// OPENAI_TIMEOUT etc. override PROXY_TIMEOUT for one provider, e.g. a
+	// short one for quick embeddings or a long one for slow models
+	config.ProviderTimeouts = make(map[string]time.Duration)
+	for _, provider := range []string{"openai", "anthropic", "gemini"} {
+		config.ProviderTimeouts[provider] = env.duration(strings.ToUpper(provider)+"_TIMEOUT", config.ProxyTimeout)
+	}
+
+	// Built-in providers are enabled by their API key, others are defined
+	// in PROVIDERS_CONFIG_PATH
+	config.Providers = providers.NewRegistry()
+	for name, key := range map[string]string{"openai": config.OpenAIKey, "anthropic": config.AnthropicKey, "gemini": config.GeminiKey} {
+		if key == "" {
+			continue
+		}
+		provider := providers.Builtin(name)
+		provider.APIKey = key
+		provider.Timeout = config.ProviderTimeouts[name]
+		if err := config.Providers.Register(*provider); err != nil {
+			env.errors = append(env.errors, err.Error())
+		}
+	}
+	if config.ProvidersConfigPath != "" {
+		if err := config.Providers.RegisterFromConfig(config.ProvidersConfigPath, env.secret); err != nil {
+			env.errors = append(env.errors, fmt.Sprintf("PROVIDERS_CONFIG_PATH: %v", err))
+		}
+	}
+
+	if len(env.errors) > 0 {
+		return nil, fmt.Errorf("invalid environment variables:\n  - %s", strings.Join(env.errors, "\n  - "))
+	}
+
+	// SMTP takes precedence so self-hosters can send without a Resend account
+	switch {
+	case config.SMTPHost != "":
+		config.EmailTransport = "smtp"
+		config.Mailer = email.NewClient(&email.SMTPTransport{
+			Host:     config.SMTPHost,
+			Port:     config.SMTPPort,
+			Username: config.SMTPUser,
+			Password: config.SMTPPass,
+			Security: config.SMTPTLS,
+			From:     config.FromEmail,
+		})
+	case config.ResendAPIKey != "":
+		config.EmailTransport = "resend"
+		config.Mailer = email.NewClient(email.NewResendTransport(config.ResendAPIKey, config.FromEmail))
+	}
+	if config.Mailer != nil {
+		templates, err := email.LoadTemplates(config.EmailTemplateDir)
+		if err != nil {
+			return nil, fmt.Errorf("EMAIL_TEMPLATE_DIR: %w", err)
+		}
+		config.Mailer.Templates = templates
+	}
+	return config, nil
+}
+
+// logConfig prints the effective configuration with secrets redacted
+func logConfig(config *Config) {
+	secret := func(v string) string {
+		if v == "" {
+			return "(not set)"
 		}
+		return "(set)"
+	}
+	database := "sqlite:" + config.DatabasePath
+	if config.DatabaseURL != "" {
+		database = "postgres"
 	}
 
-	return &Config{
-		Port:                     getEnv("PORT", DefaultPort),
-		DatabasePath:             getEnv("DB_PATH", DBFile),
-		DatabaseURL:              getEnv("DATABASE_URL", ""),
-		PrivateKeyB64:            getEnv("PRIVATE_KEY", ""),
-		ResendAPIKey:             getEnv("RESEND_API_KEY", ""),
-		FromEmail:                getEnv("FROM_EMAIL", ""),
-		ProtectedAPIKey:          getEnv("PROTECTED_API_KEY", ""),
-		ProxyMode:                proxyMode,
-		OpenAIKey:                getEnv("OPENAI_API_KEY", ""),
-		AnthropicKey:             getEnv("ANTHROPIC_API_KEY", ""),
-		TiersConfigPath:          getEnv("TIERS_CONFIG_PATH", "tiers.toml"),
-		ShutdownTimeout:          shutdownTimeout,
-		RequireEmailVerification: requireEmailVerification,
-		WebhookURL:               getEnv("WEBHOOK_URL", ""),
-		WebhookSecret:            getEnv("WEBHOOK_SECRET", ""),
-		AdminUsername:            getEnv("ADMIN_USERNAME", ""),
-		AdminPassword:            getEnv("ADMIN_PASSWORD", ""),
+	log.Printf("⚙️  Effective configuration:")
+	log.Printf("   PORT=%s DATABASE=%s TIERS_CONFIG_PATH=%s TIERS_CACHE_MAX_AGE=%v DEFAULT_TIER=%s FREE_LICENSE_DAYS=%d ALLOW_MULTIPLE_LICENSES_PER_EMAIL=%v DEFAULT_PRODUCT=%s",
+		config.Port, database, config.TiersConfigPath, config.TiersCacheMaxAge, config.DefaultTier, config.FreeLicenseDays, config.MultipleLicensesPerEmail, config.DefaultProduct)
+	log.Printf("   PROXY_MODE=%v PROTECTED_API_KEY=%s OPENAI_API_KEY=%s ANTHROPIC_API_KEY=%s GEMINI_API_KEY=%s",
+		config.ProxyMode, secret(config.ProtectedAPIKey), secret(config.OpenAIKey), secret(config.AnthropicKey), secret(config.GeminiKey))
+	log.Printf("   PRIVATE_KEY=%s KEYRING_PATH=%s RESEND_API_KEY=%s FROM_EMAIL=%s REQUIRE_EMAIL_VERIFICATION=%v",
+		secret(config.PrivateKeyB64), config.KeyringPath, secret(config.ResendAPIKey), config.FromEmail, config.RequireEmailVerification)
+	log.Printf("   EMAIL_TRANSPORT=%s SMTP_HOST=%s SMTP_PORT=%d SMTP_USER=%s SMTP_PASS=%s SMTP_TLS=%s EMAIL_TEMPLATE_DIR=%s",
+		config.EmailTransport, config.SMTPHost, config.SMTPPort, config.SMTPUser, secret(config.SMTPPass), config.SMTPTLS, config.EmailTemplateDir)
+	log.Printf("   WEBHOOK_URL=%s WEBHOOK_SECRET=%s ADMIN_USERNAME=%s ADMIN_PASSWORD=%s ADMIN_API_KEY=%s",
+		config.WebhookURL, secret(config.WebhookSecret), config.AdminUsername, secret(config.AdminPassword), secret(config.AdminAPIKey))
+	log.Printf("   SHUTDOWN_TIMEOUT=%v WAL_CHECKPOINT_ON_SHUTDOWN=%v METRICS_ADDR=%s LOG_REQUESTS=%v LOG_FORMAT=%s", config.ShutdownTimeout, config.WALCheckpointOnShutdown, config.MetricsAddr, config.LogRequests, config.LogFormat)
+	log.Printf("   ALLOW_ANONYMOUS_TRIAL=%v TRIAL_DAYS=%d ENABLE_ACTIVATION_TEST=%v ENABLE_RECEIPTS=%v",
+		config.AllowAnonymousTrial, config.TrialDays, config.EnableActivationTest, config.EnableReceipts)
+	log.Printf("   AUTO_TIER_ENABLED=%v AUTO_TIER_INTERVAL=%v AUTO_TIER_DRY_RUN=%v",
+		config.AutoTierEnabled, config.AutoTierInterval, config.AutoTierDryRun)
+	log.Printf("   TARPIT_ENABLED=%v TARPIT_THRESHOLD=%d TARPIT_BASE_DELAY=%v TARPIT_MAX_DELAY=%v TARPIT_MAX_CONCURRENT=%d",
+		config.TarpitEnabled, config.TarpitThreshold, config.TarpitBaseDelay, config.TarpitMaxDelay, config.TarpitMaxConcurrent)
+	log.Printf("   RATE_LIMIT=%g RATE_BURST=%d LICENSE_RATE_LIMIT=%g LICENSE_RATE_BURST=%d TRUSTED_PROXIES=%v MAX_REQUEST_BODY=%d CORS_ORIGINS=%v",
+		config.RateLimit, config.RateBurst, config.LicenseRateLimit, config.LicenseRateBurst, config.TrustedProxies, config.MaxRequestBody, config.CORSOrigins)
+	log.Printf("   INIT_CHALLENGE=%s POW_DIFFICULTY=%d CAPTCHA_SECRET=%s CAPTCHA_SITE_KEY=%s VERIFICATION_RESEND_COOLDOWN=%v",
+		config.InitChallenge, config.PowDifficulty, secret(config.CaptchaSecret), config.CaptchaSiteKey, config.VerificationCooldown)
+	log.Printf("   USAGE_THRESHOLDS=%v USAGE_ALERT_EMAIL=%v TOKEN_USAGE=%v PROXY_AUDIT=%v PROXY_KEY_TTL=%v REVOCATION_REFRESH=%v LICENSE_CACHE_TTL=%v",
+		config.UsageThresholds, config.UsageAlertEmail, config.TokenUsage, config.ProxyAudit, config.ProxyKeyTTL, config.RevocationRefresh, config.LicenseCacheTTL)
+	log.Printf("   PROXY_RETRIES=%d PROXY_RETRY_BACKOFF=%v PROXY_BREAKER_THRESHOLD=%d PROXY_BREAKER_COOLDOWN=%v PROXY_LEGACY_SIGNATURES=%v PROXY_STRICT_USAGE=%v",
+		config.ProxyRetries, config.ProxyRetryBackoff, config.ProxyBreakerThreshold, config.ProxyBreakerCooldown, config.ProxyLegacySignatures, config.ProxyStrictUsage)
+	log.Printf("   PROXY_TIMEOUT=%v PROXY_STREAM_TIMEOUT=%v OPENAI_TIMEOUT=%v ANTHROPIC_TIMEOUT=%v GEMINI_TIMEOUT=%v",
+		config.ProxyTimeout, config.ProxyStreamTimeout, config.ProviderTimeouts["openai"], config.ProviderTimeouts["anthropic"], config.ProviderTimeouts["gemini"])
+	log.Printf("   PROVIDERS_CONFIG_PATH=%s PROVIDERS=%v", config.ProvidersConfigPath, config.Providers.Names())
+	log.Printf("   KDF_TIME=%d KDF_MEMORY_KIB=%d KDF_THREADS=%d", config.KDFTime, config.KDFMemoryKiB, config.KDFThreads)
+}
+
+// configKDFParams returns the Argon2id settings from KDF_TIME, KDF_MEMORY_KIB
+// and KDF_THREADS
+func configKDFParams(config *Config) (licensecrypto.KDFParams, error) {
+	if config.KDFThreads > 255 {
+		return licensecrypto.KDFParams{}, fmt.Errorf("KDF_THREADS must be at most 255, got %d", config.KDFThreads)
+	}
+	if config.KDFTime > licensecrypto.MaxKDFTime {
+		return licensecrypto.KDFParams{}, fmt.Errorf("KDF_TIME must be at most %d, got %d", licensecrypto.MaxKDFTime, config.KDFTime)
 	}
+	if config.KDFMemoryKiB > licensecrypto.MaxKDFMemory {
+		return licensecrypto.KDFParams{}, fmt.Errorf("KDF_MEMORY_KIB must be at most %d (1 GiB), got %d", licensecrypto.MaxKDFMemory, config.KDFMemoryKiB)
+	}
+	params := licensecrypto.KDFParams{
+		Time:    uint32(config.KDFTime),
+		Memory:  uint32(config.KDFMemoryKiB),
+		Threads: uint8(config.KDFThreads),
+	}
+	if err := params.Validate(); err != nil {
+		return licensecrypto.KDFParams{}, fmt.Errorf("KDF_TIME, KDF_MEMORY_KIB, KDF_THREADS: %w", err)
+	}
+	return params, nil
 }
 
 // validateConfig checks that required configuration is present and valid
 func validateConfig(config *Config) error {
 	var errors []string
 
-	// Required: Private key for license signing
-	if config.PrivateKeyB64 == "" {
-		errors = append(errors, "PRIVATE_KEY is required for license signature verification")
+	// Required: Private key for license signing, from PRIVATE_KEY or a keyring
+	if config.KeyringPath != "" {
+		if _, err := licensecrypto.LoadKeyring(config.KeyringPath); err != nil {
+			errors = append(errors, fmt.Sprintf("KEYRING_PATH: %v", err))
+		}
+		if config.PrivateKeyB64 != "" {
+			log.Printf("⚠️  PRIVATE_KEY is ignored because KEYRING_PATH is set")
+		}
+	} else if config.PrivateKeyB64 == "" {
+		errors = append(errors, "PRIVATE_KEY or KEYRING_PATH is required for license signature verification")
 	} else {
 		// Validate it's valid base64 and correct length
 		keyBytes, err := base64.StdEncoding.DecodeString(config.PrivateKeyB64)
@@ -370,14 +1509,14 @@ func validateConfig(config *Config) error {
 	}
 
 	// Required for proxy mode: At least one upstream API key
-	if config.ProxyMode && config.OpenAIKey == "" && config.AnthropicKey == "" {
-		errors = append(errors, "PROXY_MODE=true requires at least one of OPENAI_API_KEY or ANTHROPIC_API_KEY")
+	if config.ProxyMode && len(config.Providers.Names()) == 0 {
+		errors = append(errors, "PROXY_MODE=true requires at least one of OPENAI_API_KEY, ANTHROPIC_API_KEY or GEMINI_API_KEY, or providers in PROVIDERS_CONFIG_PATH")
 	}
 
 	// Email configuration for verification (conditional)
 	if config.RequireEmailVerification {
-		if config.ResendAPIKey == "" {
-			log.Printf("⚠️  REQUIRE_EMAIL_VERIFICATION=true but RESEND_API_KEY not set - email verification will fail")
+		if config.Mailer == nil {
+			log.Printf("⚠️  REQUIRE_EMAIL_VERIFICATION=true but neither SMTP_HOST nor RESEND_API_KEY is set - email verification will fail")
 		}
 		if config.FromEmail == "" {
 			log.Printf("⚠️  REQUIRE_EMAIL_VERIFICATION=true but FROM_EMAIL not set - email verification will fail")
@@ -386,17 +1525,22 @@ func validateConfig(config *Config) error {
 		log.Printf("ℹ️  REQUIRE_EMAIL_VERIFICATION=false - email verification disabled (development mode)")
 	}
 
+	// Changes made with licensify-admin only show up once entries expire
+	if config.LicenseCacheTTL > maxLicenseCacheTTL {
+		errors = append(errors, fmt.Sprintf("LICENSE_CACHE_TTL must be at most %v, got %v", maxLicenseCacheTTL, config.LicenseCacheTTL))
+	}
+
 	// Database configuration
 	if config.DatabaseURL == "" && config.DatabasePath == "" {
 		errors = append(errors, "Either DATABASE_URL (PostgreSQL) or DB_PATH (SQLite) must be set")
 	}
 
 	// Admin dashboard security (warning only)
-	if config.AdminUsername == "" || config.AdminPassword == "" {
+	if config.AdminUsername == "" && config.AdminPassword == "" {
 		log.Printf("⚠️  WARNING: Admin dashboard authentication not configured")
 		log.Printf("   Set ADMIN_USERNAME and ADMIN_PASSWORD to secure the /admin endpoint")
 		log.Printf("   Currently running in INSECURE mode - anyone can access /admin")
-	} else {
+	} else if config.AdminUsername != "" && config.AdminPassword != "" {
 		// Validate password strength
 		if len(config.AdminPassword) < 8 {
 			errors = append(errors, "ADMIN_PASSWORD must be at least 8 characters long")
@@ -409,6 +1553,70 @@ func validateConfig(config *Config) error {
 		}
 	}
 
+	if config.AdminAPIKey != "" && len(config.AdminAPIKey) < 32 {
+		errors = append(errors, "ADMIN_API_KEY must be at least 32 characters long (e.g. openssl rand -hex 32)")
+	}
+
+	// Value ranges and formats
+	if port, err := strconv.Atoi(config.Port); err != nil || port < 1 || port > 65535 {
+		errors = append(errors, fmt.Sprintf("PORT must be a number between 1 and 65535, got %q", config.Port))
+	}
+	if config.FromEmail != "" && !strings.Contains(config.FromEmail, "@") {
+		errors = append(errors, fmt.Sprintf("FROM_EMAIL is not an email address: %q", config.FromEmail))
+	}
+	if config.WebhookURL != "" && !strings.HasPrefix(config.WebhookURL, "http://") && !strings.HasPrefix(config.WebhookURL, "https://") {
+		errors = append(errors, "WEBHOOK_URL must start with http:// or https://")
+	}
+	if products, err := database.ParseProductIDs(config.DefaultProduct); err != nil || len(products) != 1 || products[0] != config.DefaultProduct {
+		errors = append(errors, fmt.Sprintf("DEFAULT_PRODUCT must be a single lowercase product ID, got %q", config.DefaultProduct))
+	}
+	if _, err := configKDFParams(config); err != nil {
+		errors = append(errors, err.Error())
+	}
+
+	// Settings that only work together
+	if (config.AdminUsername == "") != (config.AdminPassword == "") {
+		errors = append(errors, "ADMIN_USERNAME and ADMIN_PASSWORD must be set together")
+	}
+	if config.WebhookSecret != "" && config.WebhookURL == "" {
+		log.Printf("⚠️  WEBHOOK_SECRET is set but WEBHOOK_URL is not - webhooks are disabled")
+	}
+	if config.UsageAlertEmail && config.Mailer == nil {
+		log.Printf("⚠️  USAGE_ALERT_EMAIL=true but neither SMTP_HOST nor RESEND_API_KEY is set - usage alert emails are disabled")
+	}
+	if config.EmailTemplateDir != "" && config.Mailer == nil {
+		log.Printf("⚠️  EMAIL_TEMPLATE_DIR is set but neither SMTP_HOST nor RESEND_API_KEY is set - custom templates are unused")
+	}
+	if config.SMTPHost != "" {
+		switch config.SMTPTLS {
+		case email.SMTPStartTLS, email.SMTPTLS, email.SMTPNone:
+		default:
+			errors = append(errors, fmt.Sprintf("SMTP_TLS must be starttls, tls or none, got %q", config.SMTPTLS))
+		}
+		if config.FromEmail == "" {
+			errors = append(errors, "SMTP_HOST requires FROM_EMAIL")
+		}
+	}
+
+	// Tarpit delays must finish well within the server's 15s write timeout
+	if config.TarpitEnabled && config.TarpitMaxDelay >= 15*time.Second {
+		errors = append(errors, "TARPIT_MAX_DELAY must be less than 15s (server write timeout)")
+	}
+
+	switch config.InitChallenge {
+	case "":
+	case "pow":
+		if config.PowDifficulty > 32 {
+			errors = append(errors, "POW_DIFFICULTY must be at most 32 (each step doubles client work)")
+		}
+	case "turnstile", "hcaptcha", "recaptcha":
+		if config.CaptchaSecret == "" {
+			errors = append(errors, fmt.Sprintf("CAPTCHA_SECRET is required when INIT_CHALLENGE=%s", config.InitChallenge))
+		}
+	default:
+		errors = append(errors, fmt.Sprintf("INIT_CHALLENGE must be pow, turnstile, hcaptcha or recaptcha, got %q", config.InitChallenge))
+	}
+
 	if len(errors) > 0 {
 		return fmt.Errorf("configuration validation failed:\n  - %s", strings.Join(errors, "\n  - "))
 	}
@@ -423,6 +1631,22 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// checkpointWAL runs a truncating WAL checkpoint so the next startup doesn't
+// have to replay a large write-ahead log
+func checkpointWAL() {
+	var busy, logFrames, checkpointed int
+	err := db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE);").Scan(&busy, &logFrames, &checkpointed)
+	if err != nil {
+		log.Printf("⚠️  WAL checkpoint failed: %v", err)
+		return
+	}
+	if busy != 0 {
+		log.Printf("⚠️  WAL checkpoint incomplete: database busy (%d/%d frames)", checkpointed, logFrames)
+		return
+	}
+	log.Printf("💾 WAL checkpointed (%d frames)", checkpointed)
+}
+
 func initDB(dbPath, dbURL string) error {
 	var err error
 	var driverName, dataSource string
@@ -479,36 +1703,89 @@ func initDB(dbPath, dbURL string) error {
 		log.Printf("📊 SQLite WAL mode enabled for better concurrency")
 	}
 
-	// Load and execute schema from SQL files
-	var schemaPath string
-	if isPostgresDB {
-		schemaPath = "sql/postgres/init.sql"
-	} else {
-		schemaPath = "sql/sqlite/init.sql"
-	}
+	store = database.New(db, isPostgresDB)
 
-	schema, err := os.ReadFile(schemaPath)
+	// Bring the schema up to date before serving any requests
+	applied, err := migrations.Migrate(db, isPostgresDB)
 	if err != nil {
-		return fmt.Errorf("failed to read schema file %s: %w", schemaPath, err)
+		return fmt.Errorf("failed to migrate schema: %w", err)
 	}
-
-	_, err = db.Exec(string(schema))
-	if err != nil {
-		return fmt.Errorf("failed to create schema: %w", err)
+	for _, m := range applied {
+		log.Printf("📦 Applied migration %s", m)
 	}
 
 	return nil
 }
 
+// healthCheckTimeout bounds the database checks of /health?deep=1, so a hung
+// connection fails the check instead of the load balancer's request
+const healthCheckTimeout = 2 * time.Second
+
+// handleHealth is a cheap liveness check. With ?deep=1 it also pings the
+// database and runs SELECT 1, answering 503 if either fails, for readiness
+// checks that should take an instance with a dead database out of rotation.
 func handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]interface{}{
 		"status":     "ok",
 		"service":    "licensify",
 		"version":    Version,
 		"git_commit": GitCommit,
 		"build_time": BuildTime,
-	})
+	}
+	status := http.StatusOK
+
+	if deep, _ := strconv.ParseBool(r.URL.Query().Get("deep")); deep {
+		database, err := checkDatabaseHealth(r.Context(), db)
+		response["database"] = database
+		if err != nil {
+			requestLogger(r).Error("Health check failed", "error", err)
+			response["status"] = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// checkDatabaseHealth pings the database and runs a trivial query. The
+// returned details hold the backend, the failed step if any, and pool
+// stats; the error itself is only logged, since it can contain hostnames.
+func checkDatabaseHealth(ctx context.Context, conn *sql.DB) (map[string]interface{}, error) {
+	backend := "sqlite"
+	if isPostgresDB {
+		backend = "postgres"
+	}
+	details := map[string]interface{}{
+		"backend": backend,
+		"status":  "ok",
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	err := conn.PingContext(ctx)
+	if err != nil {
+		details["status"] = "ping failed"
+	} else {
+		var one int
+		if err = conn.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+			details["status"] = "query failed"
+		}
+	}
+	details["latency_ms"] = time.Since(start).Milliseconds()
+
+	stats := conn.Stats()
+	details["pool"] = map[string]interface{}{
+		"max_open_connections": stats.MaxOpenConnections,
+		"open_connections":     stats.OpenConnections,
+		"in_use":               stats.InUse,
+		"idle":                 stats.Idle,
+		"wait_count":           stats.WaitCount,
+		"wait_duration_ms":     stats.WaitDuration.Milliseconds(),
+	}
+	return details, err
 }
 
 // handleVersion returns version information in JSON format
@@ -528,6 +1805,31 @@ func handleVersion(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// handlePubKey serves the Ed25519 public key clients use to verify
+// activation bundle signatures, plus any retired keys that signed receipts
+// and offline licenses still in circulation
+func handlePubKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := map[string]interface{}{
+		"algorithm":  "ed25519",
+		"public_key": base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+	}
+	if len(retiredKeys) > 0 {
+		retired := make([]string, 0, len(retiredKeys))
+		for i := len(retiredKeys) - 1; i >= 0; i-- {
+			retired = append(retired, base64.StdEncoding.EncodeToString(retiredKeys[i].PublicKey))
+		}
+		response["retired_keys"] = retired
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
 // TierInfo represents public tier information
 type TierInfo struct {
 	Name                      string   `json:"name"`
@@ -535,44 +1837,80 @@ type TierInfo struct {
 	MonthlyLimit              int      `json:"monthly_limit"`
 	MaxDevices                int      `json:"max_devices"`
 	Features                  []string `json:"features"`
+	Providers                 []string `json:"providers,omitempty"` // proxy providers the tier may call, all when empty
 	Description               string   `json:"description"`
 	PriceMonthly              float64  `json:"price_monthly,omitempty"`
+	PriceAnnual               float64  `json:"price_annual,omitempty"`
 	OneTimePayment            float64  `json:"one_time_payment,omitempty"`
+	Currency                  string   `json:"currency"`
 	CustomPricing             bool     `json:"custom_pricing,omitempty"`
 	EmailVerificationRequired bool     `json:"email_verification_required"`
 }
 
-func handleTiers(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+func handleTiers(maxAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// Get all visible tiers
+		allTiers := tierRegistry.GetAllVisible()
+
+		// Convert to response format
+		response := make(map[string]TierInfo)
+		for name, tier := range allTiers {
+			response[name] = TierInfo{
+				Name:                      tier.Name,
+				DailyLimit:                tier.DailyLimit,
+				MonthlyLimit:              tier.MonthlyLimit,
+				MaxDevices:                tier.MaxDevices,
+				Features:                  tier.Features,
+				Providers:                 tier.Providers,
+				Description:               tier.Description,
+				PriceMonthly:              tier.PriceMonthly,
+				PriceAnnual:               tier.PriceAnnual,
+				OneTimePayment:            tier.OneTimePayment,
+				Currency:                  tier.Currency,
+				CustomPricing:             tier.CustomPricing,
+				EmailVerificationRequired: tier.EmailVerificationRequired,
+			}
+		}
+
+		writeCacheableJSON(w, r, maxAge, map[string]interface{}{
+			"success": true,
+			"tiers":   response,
+		})
+	}
+}
+
+// writeCacheableJSON writes a public catalog response with an ETag derived
+// from its content, so it changes whenever the tier config does, and answers
+// matching If-None-Match requests with 304 Not Modified
+func writeCacheableJSON(w http.ResponseWriter, r *http.Request, maxAge time.Duration, v interface{}) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Failed to encode response: %v", err)
+		sendError(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
+	body = append(body, '\n')
 
-	// Get all visible tiers
-	allTiers := tiers.GetAllVisible()
+	sum := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds())))
 
-	// Convert to response format
-	response := make(map[string]TierInfo)
-	for name, tier := range allTiers {
-		response[name] = TierInfo{
-			Name:                      tier.Name,
-			DailyLimit:                tier.DailyLimit,
-			MonthlyLimit:              tier.MonthlyLimit,
-			MaxDevices:                tier.MaxDevices,
-			Features:                  tier.Features,
-			Description:               tier.Description,
-			PriceMonthly:              tier.PriceMonthly,
-			OneTimePayment:            tier.OneTimePayment,
-			CustomPricing:             tier.CustomPricing,
-			EmailVerificationRequired: tier.EmailVerificationRequired,
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			w.WriteHeader(http.StatusNotModified)
+			return
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]interface{}{
-		"success": true,
-		"tiers":   response,
-	})
+	_, _ = w.Write(body)
 }
 
 // CheckRequest from CLI to check license status
@@ -583,1052 +1921,3329 @@ type CheckRequest struct {
 // CheckResponse with current license status
 type CheckResponse struct {
 	Success       bool      `json:"success"`
+	Valid         bool      `json:"valid"`
+	Reason        string    `json:"reason,omitempty"` // why the license is not valid
 	CustomerName  string    `json:"customer_name,omitempty"`
 	CustomerEmail string    `json:"customer_email,omitempty"`
 	Tier          string    `json:"tier,omitempty"`
 	ExpiresAt     time.Time `json:"expires_at,omitempty"`
 	Active        bool      `json:"active"`
+	Products      []string  `json:"products,omitempty"`
 	Limits        struct {
 		DailyLimit     int `json:"daily_limit"`
 		MonthlyLimit   int `json:"monthly_limit"`
 		MaxActivations int `json:"max_activations"`
 	} `json:"limits,omitempty"`
 	CurrentActivations int    `json:"current_activations,omitempty"`
+	DailyUsage         int    `json:"daily_usage"`
+	MonthlyUsage       int    `json:"monthly_usage"`
+	DailyLimit         int    `json:"daily_limit"`
+	MonthlyLimit       int    `json:"monthly_limit"`
+	DailyTokens        int64  `json:"daily_tokens,omitempty"`   // proxied LLM tokens, when TOKEN_USAGE=true
+	MonthlyTokens      int64  `json:"monthly_tokens,omitempty"` // proxied LLM tokens, when TOKEN_USAGE=true
 	Error              string `json:"error,omitempty"`
 }
 
-func handleCheck() http.HandlerFunc {
+// FeaturesResponse lists the features a license's tier includes
+type FeaturesResponse struct {
+	Success  bool     `json:"success"`
+	Tier     string   `json:"tier"`
+	Features []string `json:"features"`
+}
+
+// LicenseReceipt is a signed proof of license for a customer's records.
+// Field order is part of the signed form; only append new fields.
+type LicenseReceipt struct {
+	Version       int       `json:"version"`
+	LicenseID     string    `json:"license_id"`
+	CustomerName  string    `json:"customer_name"`
+	CustomerEmail string    `json:"customer_email"`
+	Tier          string    `json:"tier"`
+	HardwareID    string    `json:"hardware_id"`
+	ActivatedAt   time.Time `json:"activated_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+	IssuedAt      time.Time `json:"issued_at"`
+}
+
+// ReceiptResponse wraps a receipt with its Ed25519 signature over the
+// compact receipt JSON and the public key that made it
+type ReceiptResponse struct {
+	Receipt   json.RawMessage `json:"receipt"`
+	Algorithm string          `json:"algorithm"`
+	Signature string          `json:"signature"`
+	PublicKey string          `json:"public_key"`
+}
+
+// handleReceipt issues a signed receipt for an activated device
+func handleReceipt() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != "POST" {
+		if r.Method != http.MethodPost {
 			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req CheckRequest
+		var req ActivationRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			sendError(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
 
-		if req.LicenseKey == "" {
-			sendError(w, "License key is required", http.StatusBadRequest)
+		if req.LicenseKey == "" || req.HardwareID == "" {
+			sendError(w, "license_key and hardware_id are required", http.StatusBadRequest)
 			return
 		}
 
-		// Get license from database
-		license, err := getLicense(req.LicenseKey)
+		license, err := getLicense(r.Context(), req.LicenseKey)
+		if err == nil {
+			err = validateLicense(license)
+		}
 		if err != nil {
-			sendError(w, "Invalid license key", http.StatusUnauthorized)
+			sendLicenseError(w, err)
 			return
 		}
 
-		// Get activation count
-		count, err := getActivationCount(req.LicenseKey)
+		var activatedAtStr string
+		err = db.QueryRowContext(r.Context(), fmt.Sprintf(`
+SELECT activated_at FROM activations
+WHERE license_id = %s AND hardware_id = %s
+`, sqlPlaceholder(1), sqlPlaceholder(2)), req.LicenseKey, req.HardwareID).Scan(&activatedAtStr)
+		if err == sql.ErrNoRows {
+			sendError(w, "Device is not activated for this license", http.StatusNotFound)
+			return
+		}
 		if err != nil {
-			log.Printf("Error checking activations: %v", err)
-			count = 0
+			log.Printf("Error loading activation: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		activatedAt, err := parseDBTime(activatedAtStr)
+		if err != nil {
+			log.Printf("Error parsing activated_at %q: %v", activatedAtStr, err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
 		}
 
-		resp := CheckResponse{
-			Success:            true,
-			CustomerName:       license.CustomerName,
-			CustomerEmail:      license.CustomerEmail,
-			Tier:               license.Tier,
-			ExpiresAt:          license.ExpiresAt,
-			Active:             license.Active,
-			CurrentActivations: count,
+		receipt, err := json.Marshal(LicenseReceipt{
+			Version:       1,
+			LicenseID:     req.LicenseKey,
+			CustomerName:  license.CustomerName,
+			CustomerEmail: license.CustomerEmail,
+			Tier:          license.Tier,
+			HardwareID:    req.HardwareID,
+			ActivatedAt:   activatedAt.UTC(),
+			ExpiresAt:     license.ExpiresAt.UTC(),
+			IssuedAt:      time.Now().UTC().Truncate(time.Second),
+		})
+		var signature string
+		if err == nil {
+			signature, err = licensecrypto.SignReceipt(privateKey, receipt)
+		}
+		if err != nil {
+			log.Printf("Error signing receipt: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
 		}
-		resp.Limits.DailyLimit = license.Limits.DailyLimit
-		resp.Limits.MonthlyLimit = license.Limits.MonthlyLimit
-		resp.Limits.MaxActivations = license.Limits.MaxActivations
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(resp)
+		log.Printf("🧾 Receipt issued for %s", redact.PII(req.LicenseKey))
 
-		log.Printf("License check for %s: tier=%s, active=%v", req.LicenseKey, license.Tier, license.Active)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ReceiptResponse{
+			Receipt:   receipt,
+			Algorithm: "ed25519",
+			Signature: signature,
+			PublicKey: base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+		})
 	}
 }
 
-func handleInit(resendAPIKey, fromEmail string, requireEmailVerification bool) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
+// RevocationsResponse wraps the compact revocation list JSON with its Ed25519
+// signature, made with the same key as activation bundles
+type RevocationsResponse struct {
+	Revocations json.RawMessage `json:"revocations"`
+	Algorithm   string          `json:"algorithm"`
+	Signature   string          `json:"signature"`
+	PublicKey   string          `json:"public_key"`
+}
 
-		var req InitRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			sendError(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
+// revocationCache holds the revoked license IDs checked on every proxy
+// request and the signed list served at /revocations. It is reloaded from the
+// database every REVOCATION_REFRESH, so revocations made with licensify-admin
+// take effect within that interval.
+type revocationCache struct {
+	mu       sync.RWMutex
+	revoked  map[string]bool
+	response RevocationsResponse
+}
 
-		// Validate email
-		if !strings.Contains(req.Email, "@") {
-			sendError(w, "Invalid email address", http.StatusBadRequest)
-			return
-		}
+// refresh reloads the revocations and re-signs the published list
+func (c *revocationCache) refresh() error {
+	rows, err := store.ListRevocations()
+	if err != nil {
+		return err
+	}
 
-		// If email verification is disabled, return dummy success
-		if !requireEmailVerification {
-			resp := InitResponse{
-				Success: true,
-				Message: "Email verification disabled (development mode). Proceed to /verify with any code.",
-				Email:   req.Email,
-			}
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(resp)
-			return
-		}
+	revoked := make(map[string]bool, len(rows))
+	list := licensecrypto.RevocationList{IssuedAt: time.Now().UTC().Truncate(time.Second)}
+	for _, r := range rows {
+		revoked[r.LicenseID] = true
+		list.Revocations = append(list.Revocations, licensecrypto.RevokedLicense{LicenseID: r.LicenseID, RevokedAt: r.RevokedAt.UTC()})
+	}
+	payload, signature, err := licensecrypto.SignRevocationList(privateKey, list)
+	if err != nil {
+		return err
+	}
 
-		// Generate 6-digit code
-		code, err := generateVerificationCode()
-		if err != nil {
-			log.Printf("Failed to generate code: %v", err)
-			sendError(w, "Internal server error", http.StatusInternalServerError)
-			return
-		}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.revoked = revoked
+	c.response = RevocationsResponse{
+		Revocations: payload,
+		Algorithm:   "ed25519",
+		Signature:   signature,
+		PublicKey:   base64.StdEncoding.EncodeToString(privateKey.Public().(ed25519.PublicKey)),
+	}
+	return nil
+}
+
+// isRevoked reports whether a license was on the list at the last refresh.
+// A nil cache has no revocations.
+func (c *revocationCache) isRevoked(licenseID string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.revoked[licenseID]
+}
 
-		// Store code (expires in 15 minutes)
-		expiresAt := time.Now().Add(15 * time.Minute)
+// signed returns the signed list from the last refresh
+func (c *revocationCache) signed() RevocationsResponse {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.response
+}
 
-		// Delete existing code if any
-		_, _ = db.Exec(fmt.Sprintf(`DELETE FROM verification_codes WHERE email = %s`, sqlPlaceholder(1)), req.Email)
+// run refreshes the cache every interval until ctx is cancelled, keeping the
+// previous list when a refresh fails
+func (c *revocationCache) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		// Insert new code
-		_, err = db.Exec(fmt.Sprintf(`
-			INSERT INTO verification_codes (email, code, created_at, expires_at) 
-			VALUES (%s, %s, CURRENT_TIMESTAMP, %s)
-		`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3)), req.Email, code, expiresAt.Format(time.RFC3339))
-		if err != nil {
-			log.Printf("Failed to store verification code: %v", err)
-			sendError(w, "Internal server error", http.StatusInternalServerError)
+	for {
+		select {
+		case <-ctx.Done():
 			return
+		case <-ticker.C:
+			if err := c.refresh(); err != nil {
+				log.Printf("⚠️  Failed to refresh revocations: %v", err)
+			}
 		}
+	}
+}
 
-		// Send email via Resend
-		if err := sendVerificationEmail(resendAPIKey, fromEmail, req.Email, code); err != nil {
-			log.Printf("Failed to send verification email: %v", err)
-			sendError(w, "Failed to send verification email", http.StatusInternalServerError)
+// handleRevocations serves the signed list of revoked licenses so clients
+// holding offline license files or proxy keys can sync it periodically
+func handleRevocations(revocations *revocationCache, maxAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
+		writeCacheableJSON(w, r, maxAge, revocations.signed())
+	}
+}
 
-		log.Printf("Sent verification code to %s", redactEmail(req.Email))
+// DeactivationRequest releases a device seat. As with /activate, the license
+// key is the credential: it is sent in the request, so a signature keyed with
+// it would prove nothing more. Older clients also send timestamp and
+// signature, which are ignored.
+type DeactivationRequest struct {
+	LicenseKey string `json:"license_key"`
+	HardwareID string `json:"hardware_id"`
+}
 
-		resp := InitResponse{
-			Success: true,
-			Message: "Verification code sent to your email",
-			Email:   req.Email,
-		}
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(resp)
-	}
+// DeactivationResponse reports the seats in use after a deactivation
+type DeactivationResponse struct {
+	Success        bool   `json:"success"`
+	Message        string `json:"message"`
+	Activations    int    `json:"activations"`
+	MaxActivations int    `json:"max_activations"`
 }
 
-func handleVerify(resendAPIKey, fromEmail string, requireEmailVerification bool, config *Config) http.HandlerFunc {
+func handleDeactivation(config *Config) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req VerifyRequest
+		var req DeactivationRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			sendError(w, "Invalid request body", http.StatusBadRequest)
+			sendError(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
 
-		// If email verification is disabled, skip verification
-		var err error
-		if !requireEmailVerification {
-			log.Printf("Bypassing email verification for %s (development mode)", redactEmail(req.Email))
-		} else {
-			// Verify code
-			var storedCode string
-			var expiresAtStr string
-			err = db.QueryRow(fmt.Sprintf(`
-				SELECT code, expires_at FROM verification_codes 
-				WHERE email = %s
-			`, sqlPlaceholder(1)), req.Email).Scan(&storedCode, &expiresAtStr)
-
-			if err == sql.ErrNoRows {
-				sendError(w, "No verification code found for this email", http.StatusNotFound)
-				return
-			}
-			if err != nil {
-				log.Printf("Database error: %v", err)
-				sendError(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-
-			expiresAt, err := time.Parse(time.RFC3339, expiresAtStr)
-			if err != nil {
-				log.Printf("Failed to parse expiration time: %v", err)
-				sendError(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-
-			if time.Now().After(expiresAt) {
-				sendError(w, "Verification code expired", http.StatusBadRequest)
-				return
-			}
-
-			log.Printf("Verification attempt: email=%s, match=%v",
-				redactEmail(req.Email), storedCode == req.Code)
-
-			if storedCode != req.Code {
-				sendError(w, "Invalid verification code", http.StatusUnauthorized)
-				return
-			}
+		if req.LicenseKey == "" || req.HardwareID == "" {
+			sendError(w, "license_key and hardware_id are required", http.StatusBadRequest)
+			return
 		}
 
-		// Check if user already has a license
-		var existingLicense string
-		err = db.QueryRow(fmt.Sprintf(`
-			SELECT license_id FROM licenses WHERE customer_email = %s
-		`, sqlPlaceholder(1)), req.Email).Scan(&existingLicense)
-
+		license, err := getLicense(r.Context(), req.LicenseKey)
 		if err == nil {
-			// User already has a license
-			resp := VerifyResponse{
-				Success:    true,
-				LicenseKey: existingLicense,
-				Tier:       "free",
-				DailyLimit: 10,
-				Message:    "Email verified! Your existing license key is ready.",
-			}
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(resp)
-			return
+			err = validateLicense(license)
 		}
-
-		// Generate FREE license
-		licenseKey := generateLicenseKey()
-		expiresAtLicense := time.Now().AddDate(0, 1, 0) // 1 month for free tier
-
-		// Generate encryption salt
-		var encryptionSalt string
-		encryptionSalt, err = generateSalt()
 		if err != nil {
-			log.Printf("Failed to generate salt: %v", err)
-			sendError(w, "Internal server error", http.StatusInternalServerError)
+			sendLicenseError(w, err)
 			return
 		}
 
-		_, err = db.Exec(fmt.Sprintf(`
-			INSERT INTO licenses (
-license_id, customer_name, customer_email, tier, 
-expires_at, daily_limit, monthly_limit, max_activations, active, encryption_salt
-) VALUES (%s, %s, %s, 'free', %s, 10, 10, 3, 1, %s)
-		`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4), sqlPlaceholder(5)), licenseKey, req.Email, req.Email, expiresAtLicense, encryptionSalt)
-
+		deleted, err := store.DeleteActivationsContext(r.Context(), req.LicenseKey, req.HardwareID)
 		if err != nil {
-			log.Printf("Failed to create license: %v", err)
+			log.Printf("Error deactivating device: %v", err)
 			sendError(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
+		if deleted == 0 {
+			sendError(w, "Device is not activated for this license", http.StatusNotFound)
+			return
+		}
 
-		// Delete verification code
-		_, _ = db.Exec(fmt.Sprintf("DELETE FROM verification_codes WHERE email = %s", sqlPlaceholder(1)), req.Email)
-
-		// Send license email
-		if err := sendLicenseEmail(resendAPIKey, fromEmail, req.Email, licenseKey, "free", 10); err != nil {
-			log.Printf("Failed to send license email: %v", err)
-			// Don't fail - license is already created
+		count, err := getActivationCount(r.Context(), req.LicenseKey)
+		if err != nil {
+			log.Printf("Error checking activations: %v", err)
 		}
 
-		log.Printf("Created FREE license for %s: %s", redactEmail(req.Email), redactPII(licenseKey))
+		log.Printf("🔓 Device deactivated for %s (%d/%d activations)", redact.PII(req.LicenseKey), count, license.Limits.MaxActivations)
 
-		// Send webhook for license.created event
 		if config.WebhookURL != "" {
-			sendWebhook(config.WebhookURL, config.WebhookSecret, "license.created", map[string]interface{}{
-				"license_key":     licenseKey,
-				"customer_email":  req.Email,
-				"tier":            "free",
-				"daily_limit":     10,
-				"monthly_limit":   10,
-				"max_activations": 3,
-				"expires_at":      expiresAtLicense.Format(time.RFC3339),
+			sendWebhook(config.WebhookURL, config.WebhookSecret, "license.device_deactivated", map[string]interface{}{
+				"license_key":    req.LicenseKey,
+				"hardware_id":    req.HardwareID,
+				"customer_email": license.CustomerEmail,
+				"activations":    count,
 			})
 		}
 
-		resp := VerifyResponse{
-			Success:    true,
-			LicenseKey: licenseKey,
-			Tier:       "free",
-			DailyLimit: 10,
-			Message:    "Email verified! Your FREE license is ready.",
-		}
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(resp)
-	}
-}
-
-// generateProxyKey creates a unique API key for proxy mode
-func generateProxyKey() (string, error) {
-	b := make([]byte, 32)
-	if _, err := rand.Read(b); err != nil {
-		return "", err
-	}
-	return "px_" + base64.URLEncoding.EncodeToString(b)[:43], nil
-}
-
-// storeProxyKey saves the proxy key mapping
-func storeProxyKey(proxyKey, licenseID, hardwareID string) error {
-	// Use transaction to ensure atomicity
-	tx, err := db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
-	}
-	defer func() { _ = tx.Rollback() }()
-
-	// Delete existing proxy key for this license+hardware (if any)
-	_, err = tx.Exec(fmt.Sprintf(`DELETE FROM proxy_keys WHERE license_id = %s AND hardware_id = %s`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID)
-	if err != nil {
-		return fmt.Errorf("failed to delete old proxy key: %w", err)
-	}
-
-	// Insert new proxy key
-	_, err = tx.Exec(fmt.Sprintf(`
-		INSERT INTO proxy_keys (proxy_key, license_id, hardware_id)
-		VALUES (%s, %s, %s)
-	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3)), proxyKey, licenseID, hardwareID)
-	if err != nil {
-		return fmt.Errorf("failed to insert proxy key: %w", err)
+		_ = json.NewEncoder(w).Encode(DeactivationResponse{
+			Success:        true,
+			Message:        "Device deactivated",
+			Activations:    count,
+			MaxActivations: license.Limits.MaxActivations,
+		})
 	}
-
-	return tx.Commit()
-}
-
-// validateProxyKey checks if proxy key is valid and returns license info
-func validateProxyKey(proxyKey string) (licenseID, hardwareID string, err error) {
-	err = db.QueryRow(fmt.Sprintf(`
-		SELECT license_id, hardware_id 
-		FROM proxy_keys 
-		WHERE proxy_key = %s
-	`, sqlPlaceholder(1)), proxyKey).Scan(&licenseID, &hardwareID)
-	return
 }
 
-func handleActivation(protectedAPIKey string, proxyMode bool, config *Config) http.HandlerFunc {
+// handleCheck reports license status and usage. Deactivated and expired
+// licenses return 200 with valid=false; unknown keys return 401.
+func handleCheck() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != "POST" {
 			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req ActivationRequest
+		var req CheckRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			sendError(w, "Invalid request body", http.StatusBadRequest)
-			return
-		}
-
-		// Normalize and validate inputs early to avoid panics and wasted work
-		req.HardwareID = strings.TrimSpace(req.HardwareID)
-		if len(req.HardwareID) < 8 {
-			sendError(w, "hardware_id must be at least 8 characters", http.StatusBadRequest)
+			sendError(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
 
-		req.LicenseKey = strings.TrimSpace(req.LicenseKey)
 		if req.LicenseKey == "" {
 			sendError(w, "License key is required", http.StatusBadRequest)
 			return
 		}
 
-		hwPrefix := req.HardwareID
-		if len(req.HardwareID) > 8 {
-			hwPrefix = req.HardwareID[:8] + "..."
+		// Get license from database
+		license, err := getLicense(r.Context(), req.LicenseKey)
+		if err != nil {
+			sendLicenseError(w, err)
+			return
 		}
-		log.Printf("Activation request: license=%s, hardware=%s", redactPII(req.LicenseKey), hwPrefix)
 
-		// Validate license key exists
-		license, err := getLicense(req.LicenseKey)
+		// Get activation count
+		count, err := getActivationCount(r.Context(), req.LicenseKey)
 		if err != nil {
-			log.Printf("License not found: %v", err)
-			sendError(w, "Invalid license key", http.StatusUnauthorized)
-			return
+			log.Printf("Error checking activations: %v", err)
+			count = 0
 		}
 
-		// For FREE tier: Check if this hardware already has an active free license
-		if license.Tier == "free" && isFreeHardwareAlreadyActive(req.HardwareID, req.LicenseKey) {
-			hwPrefix := req.HardwareID
-			if len(req.HardwareID) > 8 {
-				hwPrefix = req.HardwareID[:8] + "..."
-			}
-			log.Printf("Hardware %s already has an active free license, blocking new free license %s", hwPrefix, redactPII(req.LicenseKey))
-			sendError(w, "This device already has an active FREE license. Each device is limited to one free license.", http.StatusForbidden)
-			return
+		today := time.Now().Format("2006-01-02")
+		dailyUsage, monthlyUsage := getUsage(r.Context(), req.LicenseKey, today)
+		dailyTokens, monthlyTokens, err := store.GetTokenUsageContext(r.Context(), req.LicenseKey, today)
+		if err != nil {
+			log.Printf("Error checking token usage: %v", err)
 		}
+		dailyLimit, monthlyLimit := license.limitsOn(today)
 
-		// Check if license is active
-		if !license.Active {
-			sendError(w, "License has been deactivated", http.StatusForbidden)
-			return
+		resp := CheckResponse{
+			Success:            true,
+			Valid:              true,
+			CustomerName:       license.CustomerName,
+			CustomerEmail:      license.CustomerEmail,
+			Tier:               license.Tier,
+			ExpiresAt:          license.ExpiresAt,
+			Active:             license.Active,
+			Products:           license.Products,
+			CurrentActivations: count,
+			DailyUsage:         dailyUsage,
+			MonthlyUsage:       monthlyUsage,
+			DailyLimit:         dailyLimit,
+			MonthlyLimit:       monthlyLimit,
+			DailyTokens:        dailyTokens,
+			MonthlyTokens:      monthlyTokens,
+		}
+		if err := validateLicense(license); err != nil {
+			resp.Valid = false
+			resp.Reason = err.Error()
 		}
+		resp.Limits.DailyLimit = dailyLimit
+		resp.Limits.MonthlyLimit = monthlyLimit
+		resp.Limits.MaxActivations = license.Limits.MaxActivations
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
 
-		// Check if expired
-		if time.Now().After(license.ExpiresAt) {
-			sendError(w, "License has expired", http.StatusForbidden)
+		log.Printf("License check for %s: tier=%s, valid=%v", redact.PII(req.LicenseKey), license.Tier, resp.Valid)
+	}
+}
+
+// handleFeatures returns the features of a valid license's tier, following
+// deprecated tiers to their migration target
+func handleFeatures() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Check activation count
-		count, err := getActivationCount(req.LicenseKey)
-		if err != nil {
-			log.Printf("Error checking activations: %v", err)
-			sendError(w, "Internal server error", http.StatusInternalServerError)
+		var req CheckRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
 
-		if count >= license.Limits.MaxActivations {
-			sendError(w, fmt.Sprintf("Maximum activations (%d) reached", license.Limits.MaxActivations), http.StatusForbidden)
+		if req.LicenseKey == "" {
+			sendError(w, "License key is required", http.StatusBadRequest)
 			return
 		}
 
-		// Check if already activated on this hardware
-		alreadyActivated, err := isHardwareActivated(req.LicenseKey, req.HardwareID)
+		license, err := getLicense(r.Context(), req.LicenseKey)
+		if err == nil {
+			err = validateLicense(license)
+		}
 		if err != nil {
-			log.Printf("Error checking hardware: %v", err)
-			sendError(w, "Internal server error", http.StatusInternalServerError)
+			sendLicenseError(w, err)
 			return
 		}
 
-		// Record activation if new hardware
-		if !alreadyActivated {
-			if err := recordActivation(req.LicenseKey, req.HardwareID); err != nil {
-				log.Printf("Error recording activation: %v", err)
-				sendError(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
-			log.Printf("New activation recorded for license %s", redactPII(req.LicenseKey))
+		resp := FeaturesResponse{Success: true, Tier: license.Tier, Features: []string{}}
+		if tier, err := tierRegistry.Get(license.Tier); err == nil {
+			resp.Features = append(resp.Features, tier.Features...)
 		} else {
-			log.Printf("Re-activation on existing hardware for license %s", redactPII(req.LicenseKey))
+			log.Printf("⚠️  Features for %s: %v", redact.PII(req.LicenseKey), err)
 		}
 
-		// Record check-in
-		recordCheckIn(req.LicenseKey)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
 
-		// Generate response based on proxy mode
-		var resp ActivationResponse
-		if proxyMode {
-			// Generate and store proxy key
-			proxyKey, err := generateProxyKey()
-			if err != nil {
-				log.Printf("Error generating proxy key: %v", err)
-				sendError(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
+func handleInit(mailer *email.Client, requireEmailVerification bool, challenge initChallenge, cooldown time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-			if err := storeProxyKey(proxyKey, req.LicenseKey, req.HardwareID); err != nil {
-				log.Printf("Error storing proxy key: %v", err)
-				sendError(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
+		var req InitRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
 
-			// Encrypt the proxy key for the client
-			encryptedData, iv, err := encryptAPIKeyBundle(proxyKey, license, req.LicenseKey, req.HardwareID)
-			if err != nil {
-				log.Printf("Encryption error: %v", err)
-				sendError(w, "Internal server error", http.StatusInternalServerError)
+		// Validate email
+		if !strings.Contains(req.Email, "@") {
+			sendError(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+
+		// Anti-bot challenge must pass before any code is generated
+		if challenge != nil {
+			if err := challenge.verify(r, req); err != nil {
+				sendError(w, err.Error(), http.StatusForbidden)
 				return
 			}
+		}
 
-			resp = ActivationResponse{
-				Success:         true,
-				CustomerName:    license.CustomerName,
-				ExpiresAt:       license.ExpiresAt,
-				Tier:            license.Tier,
-				EncryptedAPIKey: encryptedData,
-				IV:              iv,
-				Limits: struct {
-					DailyLimit     int `json:"daily_limit"`
-					MonthlyLimit   int `json:"monthly_limit"`
-					MaxActivations int `json:"max_activations"`
-				}{
-					DailyLimit:     license.Limits.DailyLimit,
-					MonthlyLimit:   license.Limits.MonthlyLimit,
-					MaxActivations: license.Limits.MaxActivations,
-				},
+		// If email verification is disabled, return dummy success
+		if !requireEmailVerification {
+			resp := InitResponse{
+				Success: true,
+				Message: "Email verification disabled (development mode). Proceed to /verify with any code.",
+				Email:   req.Email,
 			}
-			log.Printf("✅ Activation successful for %s (proxy mode - generated key: %s...)", redactPII(req.LicenseKey), proxyKey[:10])
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
 
-			// Send webhook for activation event
-			if config.WebhookURL != "" {
-				sendWebhook(config.WebhookURL, config.WebhookSecret, "license.activated", map[string]interface{}{
-					"license_key":    req.LicenseKey,
-					"hardware_id":    req.HardwareID,
-					"customer_email": license.CustomerEmail,
-					"customer_name":  license.CustomerName,
-					"tier":           license.Tier,
-					"mode":           "proxy",
-				})
-			}
-		} else {
-			// Normal mode: encrypt the protected API key
-			encryptedData, iv, err := encryptAPIKeyBundle(protectedAPIKey, license, req.LicenseKey, req.HardwareID)
-			if err != nil {
-				log.Printf("Encryption error: %v", err)
-				sendError(w, "Internal server error", http.StatusInternalServerError)
-				return
-			}
+		// Re-running /init must not be a way around the resend cooldown
+		if remaining, err := verificationCooldown(r.Context(), req.Email, cooldown); err != nil {
+			log.Printf("Failed to check verification code: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		} else if remaining > 0 {
+			sendCooldownError(w, remaining)
+			return
+		}
 
-			resp = ActivationResponse{
-				Success:         true,
-				CustomerName:    license.CustomerName,
-				ExpiresAt:       license.ExpiresAt,
-				Tier:            license.Tier,
-				EncryptedAPIKey: encryptedData,
-				IV:              iv,
-				Limits: struct {
-					DailyLimit     int `json:"daily_limit"`
-					MonthlyLimit   int `json:"monthly_limit"`
-					MaxActivations int `json:"max_activations"`
-				}{
-					DailyLimit:     license.Limits.DailyLimit,
-					MonthlyLimit:   license.Limits.MonthlyLimit,
-					MaxActivations: license.Limits.MaxActivations,
-				},
-			}
-			log.Printf("✅ Activation successful for %s", redactPII(req.LicenseKey))
+		// Generate 6-digit code
+		code, err := generateVerificationCode()
+		if err != nil {
+			log.Printf("Failed to generate code: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
 
-			// Send webhook for activation event
-			if config.WebhookURL != "" {
-				sendWebhook(config.WebhookURL, config.WebhookSecret, "license.activated", map[string]interface{}{
-					"license_key":    req.LicenseKey,
-					"hardware_id":    req.HardwareID,
-					"customer_email": license.CustomerEmail,
-					"customer_name":  license.CustomerName,
-					"tier":           license.Tier,
-					"mode":           "direct",
-				})
-			}
+		// Store code, replacing any previous one
+		if err := store.SaveVerificationCodeContext(r.Context(), req.Email, code, time.Now().Add(verificationCodeTTL)); err != nil {
+			log.Printf("Failed to store verification code: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Send email via Resend
+		if err := mailer.SendVerification(req.Email, code); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+			sendError(w, "Failed to send verification email", http.StatusInternalServerError)
+			return
 		}
 
+		log.Printf("Sent verification code to %s", redact.Email(req.Email))
+
+		resp := InitResponse{
+			Success: true,
+			Message: "Verification code sent to your email",
+			Email:   req.Email,
+		}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(resp)
 	}
 }
 
-func handleUsageReport() http.HandlerFunc {
+// handleResend emails the pending verification code again, or a new one if
+// it has expired. Like /init it is limited to one email per cooldown.
+func handleResend(mailer *email.Client, requireEmailVerification bool, cooldown time.Duration) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		var req UsageReport
+		var req ResendRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			sendError(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
 
-		// Validate license exists
-		license, err := getLicense(req.LicenseKey)
-		if err != nil {
-			sendError(w, "Invalid license key", http.StatusUnauthorized)
+		if !strings.Contains(req.Email, "@") {
+			sendError(w, "Invalid email address", http.StatusBadRequest)
 			return
 		}
 
-		// Record check-in
-		recordCheckIn(req.LicenseKey)
-
-		// Update usage
-		_, err = db.Exec(fmt.Sprintf(`
-INSERT INTO daily_usage (license_id, date, scans, hardware_id) 
-VALUES (%s, %s, %s, %s)
-ON CONFLICT(license_id, date) DO UPDATE SET 
-scans = scans + excluded.scans
-`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4)), req.LicenseKey, req.Date, req.Scans, req.HardwareID)
+		if !requireEmailVerification {
+			resp := InitResponse{
+				Success: true,
+				Message: "Email verification disabled (development mode). Proceed to /verify with any code.",
+				Email:   req.Email,
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
 
+		pending, err := store.GetVerificationCodeContext(r.Context(), req.Email)
+		if errors.Is(err, database.ErrNoVerificationCode) {
+			sendError(w, "No verification code pending for this email, request one with /init", http.StatusNotFound)
+			return
+		}
 		if err != nil {
-			log.Printf("Failed to record usage: %v", err)
+			log.Printf("Failed to load verification code: %v", err)
 			sendError(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Get current usage
-		dailyUsage, monthlyUsage := getUsage(req.LicenseKey, req.Date)
+		if remaining := cooldown - time.Since(pending.CreatedAt); remaining > 0 {
+			sendCooldownError(w, remaining)
+			return
+		}
 
-		resp := UsageResponse{
-			Success:      true,
-			DailyUsage:   dailyUsage,
-			MonthlyUsage: monthlyUsage,
-			DailyLimit:   license.Limits.DailyLimit,
-			MonthlyLimit: license.Limits.MonthlyLimit,
-			Tier:         license.Tier,
+		// Resend the same code while it is valid so an earlier email still works
+		code := pending.Code
+		if time.Now().After(pending.ExpiresAt) {
+			if code, err = generateVerificationCode(); err == nil {
+				err = store.SaveVerificationCodeContext(r.Context(), req.Email, code, time.Now().Add(verificationCodeTTL))
+			}
+		} else {
+			err = store.TouchVerificationCodeContext(r.Context(), req.Email)
+		}
+		if err != nil {
+			log.Printf("Failed to reissue verification code: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if err := mailer.SendVerification(req.Email, code); err != nil {
+			log.Printf("Failed to resend verification email: %v", err)
+			sendError(w, "Failed to send verification email", http.StatusInternalServerError)
+			return
 		}
 
+		log.Printf("Resent verification code to %s", redact.Email(req.Email))
+
+		resp := InitResponse{
+			Success: true,
+			Message: "Verification code sent to your email",
+			Email:   req.Email,
+		}
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(resp)
 	}
 }
 
-func getLicense(licenseID string) (*LicenseData, error) {
-	var license LicenseData
-	license.LicenseID = licenseID
+// verificationCooldown returns how long email must wait before another
+// verification code may be sent, or 0 if it may be sent now
+func verificationCooldown(ctx context.Context, email string, cooldown time.Duration) (time.Duration, error) {
+	age, err := store.GetVerificationCodeAgeContext(ctx, email)
+	if errors.Is(err, database.ErrNoVerificationCode) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if age >= cooldown {
+		return 0, nil
+	}
+	return cooldown - age, nil
+}
 
-	var encryptionSalt sql.NullString
-	var expiresAtStr string
+// sendCooldownError rejects a verification email request made too soon,
+// with the wait in whole seconds in the message and Retry-After
+func sendCooldownError(w http.ResponseWriter, remaining time.Duration) {
+	seconds := int((remaining + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	sendError(w, fmt.Sprintf("Please wait %d seconds before requesting another verification code", seconds), http.StatusTooManyRequests)
+}
 
-	err := db.QueryRow(fmt.Sprintf(`
-SELECT customer_name, customer_email, tier, expires_at, 
-       daily_limit, monthly_limit, max_activations, active, encryption_salt
-FROM licenses WHERE license_id = %s
-`, sqlPlaceholder(1)), licenseID).Scan(
-		&license.CustomerName,
-		&license.CustomerEmail,
-		&license.Tier,
-		&expiresAtStr,
-		&license.Limits.DailyLimit,
-		&license.Limits.MonthlyLimit,
-		&license.Limits.MaxActivations,
-		&license.Active,
-		&encryptionSalt,
-	)
+// existingLicenseFor picks the license /verify returns instead of issuing a
+// new one, preferring usable licenses, or nil if a free license should be
+// issued. With ALLOW_MULTIPLE_LICENSES_PER_EMAIL only licenses on the free
+// tiers count, so a paying customer can still get a free license but
+// re-verifying never piles up free ones.
+func existingLicenseFor(licenses []database.License, config *Config) *database.License {
+	free := freeTiers(config.DefaultTier)
+	var candidates []database.License
+	for _, l := range licenses {
+		if !config.MultipleLicensesPerEmail || slices.Contains(free, l.Tier) {
+			candidates = append(candidates, l)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+	for i, l := range candidates {
+		if l.Active && time.Now().Before(l.ExpiresAt) {
+			return &candidates[i]
+		}
+	}
+	return &candidates[0]
+}
+
+func handleVerify(mailer *email.Client, requireEmailVerification bool, config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req VerifyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// If email verification is disabled, skip verification
+		var err error
+		if !requireEmailVerification {
+			log.Printf("Bypassing email verification for %s (development mode)", redact.Email(req.Email))
+		} else {
+			// Verify code
+			var storedCode string
+			var expiresAtStr string
+			err = db.QueryRowContext(r.Context(), fmt.Sprintf(`
+				SELECT code, expires_at FROM verification_codes 
+				WHERE email = %s
+			`, sqlPlaceholder(1)), req.Email).Scan(&storedCode, &expiresAtStr)
+
+			if err == sql.ErrNoRows {
+				verificationsTotal.Inc("no_code")
+				sendError(w, "No verification code found for this email", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				log.Printf("Database error: %v", err)
+				sendError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			expiresAt, err := time.Parse(time.RFC3339, expiresAtStr)
+			if err != nil {
+				log.Printf("Failed to parse expiration time: %v", err)
+				sendError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			if time.Now().After(expiresAt) {
+				verificationsTotal.Inc("expired")
+				sendError(w, "Verification code expired", http.StatusBadRequest)
+				return
+			}
+
+			log.Printf("Verification attempt: email=%s, match=%v",
+				redact.Email(req.Email), storedCode == req.Code)
+
+			if storedCode != req.Code {
+				verificationsTotal.Inc("invalid_code")
+				sendError(w, "Invalid verification code", http.StatusUnauthorized)
+				return
+			}
+			verificationsTotal.Inc("success")
+		}
+
+		// Check if user already has a license
+		licenses, err := store.GetLicensesByEmailContext(r.Context(), req.Email)
+		if err != nil {
+			log.Printf("Failed to look up licenses for %s: %v", redact.Email(req.Email), err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if existing := existingLicenseFor(licenses, config); existing != nil {
+			resp := VerifyResponse{
+				Success:      true,
+				LicenseKey:   existing.LicenseID,
+				Tier:         existing.Tier,
+				DailyLimit:   existing.DailyLimit,
+				MonthlyLimit: existing.MonthlyLimit,
+				ExpiresAt:    &existing.ExpiresAt,
+				Message:      "Email verified! Your existing license key is ready.",
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+			return
+		}
+
+		// Generate FREE license on the default tier
+		tier, err := tierRegistry.GetRaw(config.DefaultTier)
+		if err != nil {
+			log.Printf("Failed to load default tier %s: %v", config.DefaultTier, err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		licenseKey, err := licensekey.GenerateKeyWithChecksum()
+		if err != nil {
+			log.Printf("Failed to generate license key: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		expiresAtLicense := time.Now().AddDate(0, 0, config.FreeLicenseDays)
+
+		// Generate encryption salt
+		var encryptionSalt string
+		encryptionSalt, err = generateSalt()
+		if err != nil {
+			log.Printf("Failed to generate salt: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		_, err = db.ExecContext(r.Context(), fmt.Sprintf(`
+			INSERT INTO licenses (
+license_id, customer_name, customer_email, tier, 
+expires_at, daily_limit, monthly_limit, max_activations, active, encryption_salt
+) VALUES (%s, %s, %s, %s, %s, %s, %s, %s, 1, %s)
+		`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4), sqlPlaceholder(5),
+			sqlPlaceholder(6), sqlPlaceholder(7), sqlPlaceholder(8), sqlPlaceholder(9)),
+			licenseKey, req.Email, req.Email, config.DefaultTier, expiresAtLicense,
+			tier.DailyLimit, tier.MonthlyLimit, tier.MaxDevices, encryptionSalt)
+
+		if err != nil {
+			log.Printf("Failed to create license: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Delete verification code
+		_, _ = db.ExecContext(r.Context(), fmt.Sprintf("DELETE FROM verification_codes WHERE email = %s", sqlPlaceholder(1)), req.Email)
+
+		// Send license email
+		if err := mailer.SendLicense(req.Email, licenseKey, config.DefaultTier, tier.DailyLimit); err != nil {
+			log.Printf("Failed to send license email: %v", err)
+			// Don't fail - license is already created
+		}
+
+		log.Printf("Created FREE license for %s: %s", redact.Email(req.Email), redact.PII(licenseKey))
+
+		// Send webhook for license.created event
+		if config.WebhookURL != "" {
+			sendWebhook(config.WebhookURL, config.WebhookSecret, "license.created", map[string]interface{}{
+				"license_key":     licenseKey,
+				"customer_email":  req.Email,
+				"tier":            config.DefaultTier,
+				"daily_limit":     tier.DailyLimit,
+				"monthly_limit":   tier.MonthlyLimit,
+				"max_activations": tier.MaxDevices,
+				"expires_at":      expiresAtLicense.Format(time.RFC3339),
+			})
+		}
+
+		resp := VerifyResponse{
+			Success:      true,
+			LicenseKey:   licenseKey,
+			Tier:         config.DefaultTier,
+			DailyLimit:   tier.DailyLimit,
+			MonthlyLimit: tier.MonthlyLimit,
+			ExpiresAt:    &expiresAtLicense,
+			Message:      "Email verified! Your FREE license is ready.",
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// handleTrial issues a short-lived anonymous FREE license bound to a hardware ID.
+// No email is required, but the one-free-license-per-device rule still applies.
+func handleTrial(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req TrialRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		req.HardwareID = strings.TrimSpace(req.HardwareID)
+		if len(req.HardwareID) < 8 {
+			sendError(w, "hardware_id must be at least 8 characters", http.StatusBadRequest)
+			return
+		}
+
+		hwPrefix := req.HardwareID[:8] + "..."
+
+		// One free license per device, trial or not
+		if isFreeHardwareAlreadyActive(r.Context(), req.HardwareID, "", freeTiers(config.DefaultTier)) {
+			log.Printf("Hardware %s already has an active free license, refusing trial", hwPrefix)
+			sendError(w, "This device already has an active FREE license. Each device is limited to one free license.", http.StatusForbidden)
+			return
+		}
+
+		tier, err := tierRegistry.GetRaw(config.DefaultTier)
+		if err != nil {
+			log.Printf("Failed to load default tier %s: %v", config.DefaultTier, err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		licenseKey, err := licensekey.GenerateKeyWithChecksum()
+		if err != nil {
+			log.Printf("Failed to generate license key: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		expiresAt := time.Now().AddDate(0, 0, config.TrialDays)
+
+		encryptionSalt, err := generateSalt()
+		if err != nil {
+			log.Printf("Failed to generate salt: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Trial licenses carry no email and are limited to the requesting device
+		_, err = db.ExecContext(r.Context(), fmt.Sprintf(`
+			INSERT INTO licenses (
+license_id, customer_name, customer_email, tier,
+expires_at, daily_limit, monthly_limit, max_activations, active, encryption_salt
+) VALUES (%s, 'Anonymous Trial', '', %s, %s, %s, %s, 1, 1, %s)
+		`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4), sqlPlaceholder(5), sqlPlaceholder(6)),
+			licenseKey, config.DefaultTier, expiresAt, tier.DailyLimit, tier.MonthlyLimit, encryptionSalt)
+		if err != nil {
+			log.Printf("Failed to create trial license: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Bind the trial to this hardware right away so it counts towards the per-device rule
+		if err := recordActivation(r.Context(), licenseKey, req.HardwareID); err != nil {
+			log.Printf("Error recording trial activation: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Created TRIAL license for hardware %s: %s (%d days)", hwPrefix, redact.PII(licenseKey), config.TrialDays)
+
+		if config.WebhookURL != "" {
+			sendWebhook(config.WebhookURL, config.WebhookSecret, "license.created", map[string]interface{}{
+				"license_key":     licenseKey,
+				"hardware_id":     req.HardwareID,
+				"tier":            config.DefaultTier,
+				"trial":           true,
+				"daily_limit":     tier.DailyLimit,
+				"monthly_limit":   tier.MonthlyLimit,
+				"max_activations": 1,
+				"expires_at":      expiresAt.Format(time.RFC3339),
+			})
+		}
+
+		resp := TrialResponse{
+			Success:      true,
+			LicenseKey:   licenseKey,
+			Tier:         config.DefaultTier,
+			ExpiresAt:    expiresAt,
+			DailyLimit:   tier.DailyLimit,
+			MonthlyLimit: tier.MonthlyLimit,
+			Message:      fmt.Sprintf("Your %d-day FREE trial is ready.", config.TrialDays),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// generateProxyKey creates a unique API key for proxy mode
+func generateProxyKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "px_" + base64.URLEncoding.EncodeToString(b)[:43], nil
+}
+
+// proxyKeyID identifies a proxy key in logs by a hash, so log lines can be
+// correlated without revealing any of the key
+func proxyKeyID(proxyKey string) string {
+	sum := sha256.Sum256([]byte(proxyKey))
+	return hex.EncodeToString(sum[:6])
+}
+
+// ErrProxyKeyExpired is returned by validateProxyKey for keys past their
+// PROXY_KEY_TTL. Clients rotate them, or re-activate once they have expired.
+var ErrProxyKeyExpired = errors.New("proxy key has expired")
+
+// proxyKeyExpiry returns when a key issued now with ttl expires, or nil for
+// keys that never expire (ttl 0)
+func proxyKeyExpiry(ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
+	return &expiresAt
+}
+
+// proxyKeyExpiryArg returns expiresAt as a query argument, NULL for nil
+func proxyKeyExpiryArg(expiresAt *time.Time) interface{} {
+	if expiresAt == nil {
+		return nil
+	}
+	return expiresAt.Format(time.RFC3339)
+}
+
+// storeProxyKey saves the proxy key mapping, replacing the device's previous
+// key. A nil expiresAt means the key never expires.
+func storeProxyKey(ctx context.Context, proxyKey, licenseID, hardwareID string, expiresAt *time.Time) error {
+	// Use transaction to ensure atomicity
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Delete existing proxy key for this license+hardware (if any)
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM proxy_keys WHERE license_id = %s AND hardware_id = %s`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID)
+	if err != nil {
+		return fmt.Errorf("failed to delete old proxy key: %w", err)
+	}
+
+	// Insert new proxy key
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO proxy_keys (proxy_key, license_id, hardware_id, expires_at)
+		VALUES (%s, %s, %s, %s)
+	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4)), proxyKey, licenseID, hardwareID, proxyKeyExpiryArg(expiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to insert proxy key: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// validateProxyKey checks if proxy key is valid and returns license info.
+// It returns sql.ErrNoRows for unknown keys and ErrProxyKeyExpired for
+// expired ones.
+func validateProxyKey(ctx context.Context, proxyKey string) (licenseID, hardwareID string, err error) {
+	defer observeQuery("validate_proxy_key", time.Now())
+	var expiresAt sql.NullString
+	err = db.QueryRowContext(ctx, fmt.Sprintf(`
+		SELECT license_id, hardware_id, expires_at
+		FROM proxy_keys 
+		WHERE proxy_key = %s
+	`, sqlPlaceholder(1)), proxyKey).Scan(&licenseID, &hardwareID, &expiresAt)
+	if err != nil || !expiresAt.Valid {
+		return
+	}
+	expiry, err := database.ParseTime(expiresAt.String)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid proxy key expiry: %w", err)
+	}
+	if !time.Now().Before(expiry) {
+		return "", "", ErrProxyKeyExpired
+	}
+	return
+}
+
+// rotateProxyKey replaces a valid proxy key with a new one for the same
+// device. The old key stops working as soon as the new one is stored.
+func rotateProxyKey(ctx context.Context, oldKey, licenseID, hardwareID string, expiresAt *time.Time) (string, error) {
+	newKey, err := generateProxyKey()
+	if err != nil {
+		return "", err
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Only the caller that removes the old key gets a new one, so two
+	// concurrent rotations can't both succeed
+	result, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM proxy_keys WHERE proxy_key = %s`, sqlPlaceholder(1)), oldKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to delete old proxy key: %w", err)
+	}
+	if rows, err := result.RowsAffected(); err != nil {
+		return "", fmt.Errorf("failed to delete old proxy key: %w", err)
+	} else if rows == 0 {
+		return "", sql.ErrNoRows
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`
+		INSERT INTO proxy_keys (proxy_key, license_id, hardware_id, expires_at)
+		VALUES (%s, %s, %s, %s)
+	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4)), newKey, licenseID, hardwareID, proxyKeyExpiryArg(expiresAt))
+	if err != nil {
+		return "", fmt.Errorf("failed to insert proxy key: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return newKey, nil
+}
+
+// ProxyKeyRotationRequest asks for a new proxy key. Signature is
+// HMAC-SHA256(proxy_key, timestamp + "rotate"), hex encoded, with the same
+// 5 minute timestamp window as proxy requests.
+type ProxyKeyRotationRequest struct {
+	ProxyKey  string `json:"proxy_key"`
+	Timestamp int64  `json:"timestamp"`
+	Signature string `json:"signature"`
+}
+
+// handleProxyKeyRotation replaces a valid proxy key with a new one, e.g.
+// when it may have leaked or before it expires. The new key is returned in
+// an encrypted, signed bundle like the one from /activate, so only the
+// license holder can read it.
+func handleProxyKeyRotation(config *Config, revocations *revocationCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ProxyKeyRotationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if !strings.HasPrefix(req.ProxyKey, "px_") || len(req.ProxyKey) < 10 {
+			sendError(w, "Invalid proxy key format", http.StatusBadRequest)
+			return
+		}
+
+		if err := validateRequestSignature(req.ProxyKey, fmt.Sprintf("%drotate", req.Timestamp), req.Timestamp, req.Signature); err != nil {
+			requestLogger(r).Warn("Rejected proxy key rotation", "proxy_key_id", proxyKeyID(req.ProxyKey), "error", err)
+			sendSignatureError(w, err)
+			return
+		}
+
+		// Expired keys can't be rotated, or a stolen key would never expire
+		licenseID, hardwareID, err := validateProxyKey(r.Context(), req.ProxyKey)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				sendError(w, "Unauthorized", http.StatusUnauthorized)
+			} else if errors.Is(err, ErrProxyKeyExpired) {
+				sendError(w, "Proxy key expired, activate the license again to get a new one", http.StatusUnauthorized)
+			} else {
+				requestLogger(r).Error("Database error validating proxy key", "error", err)
+				sendError(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		if revocations.isRevoked(licenseID) {
+			sendLicenseError(w, ErrLicenseRevoked)
+			return
+		}
+
+		license, err := getLicense(r.Context(), licenseID)
+		if err == nil {
+			err = validateLicense(license)
+		}
+		if err != nil {
+			sendLicenseError(w, err)
+			return
+		}
+
+		expiresAt := proxyKeyExpiry(config.ProxyKeyTTL)
+		proxyKey, err := rotateProxyKey(r.Context(), req.ProxyKey, licenseID, hardwareID, expiresAt)
+		if err == sql.ErrNoRows {
+			// Rotated or deactivated by a concurrent request
+			sendError(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			requestLogger(r).Error("Error rotating proxy key", "license", redact.PII(licenseID), "error", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		encryptedData, iv, err := encryptAPIKeyBundle(proxyKey, license, licenseID, hardwareID)
+		if err != nil {
+			requestLogger(r).Error("Encryption error", "license", redact.PII(licenseID), "error", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		requestLogger(r).Info("🔑 Rotated proxy key", "license", redact.PII(licenseID), "proxy_key_id", proxyKeyID(proxyKey))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ActivationResponse{
+			Success:         true,
+			Mode:            "proxy",
+			CustomerName:    license.CustomerName,
+			ExpiresAt:       license.ExpiresAt,
+			Tier:            license.Tier,
+			EncryptedAPIKey: encryptedData,
+			IV:              iv,
+			Salt:            license.EncryptionSalt,
+			BundleSignature: licensecrypto.SignBundle(privateKey, encryptedData, iv, license.EncryptionSalt, licenseID),
+			Products:        license.Products,
+			ProxyKeyExpires: expiresAt,
+		})
+	}
+}
+
+func handleActivation(protectedAPIKey string, proxyMode bool, config *Config, revocations *revocationCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ActivationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Normalize and validate inputs early to avoid panics and wasted work
+		req.HardwareID = strings.TrimSpace(req.HardwareID)
+		if len(req.HardwareID) < 8 {
+			sendError(w, "hardware_id must be at least 8 characters", http.StatusBadRequest)
+			return
+		}
+
+		req.LicenseKey = strings.TrimSpace(req.LicenseKey)
+		if req.LicenseKey == "" {
+			sendError(w, "License key is required", http.StatusBadRequest)
+			return
+		}
+
+		// A retried request with the same Idempotency-Key gets the response
+		// of the first one instead of activating again
+		if key := r.Header.Get("Idempotency-Key"); key != "" {
+			if len(key) > maxIdempotencyKeyLength {
+				sendError(w, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength), http.StatusBadRequest)
+				return
+			}
+			fingerprint := idempotencyFingerprint(req.LicenseKey, req.HardwareID)
+			reply, err := activateReplies.begin(key, fingerprint)
+			if reply != nil && !activationStillValid(r.Context(), revocations, req.LicenseKey, req.HardwareID) {
+				// The license or device changed since the stored response, whose
+				// key would no longer work, so run the request again
+				activateReplies.forget(key)
+				reply, err = activateReplies.begin(key, fingerprint)
+			}
+			switch {
+			case errors.Is(err, errIdempotencyMismatch):
+				sendError(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+				return
+			case errors.Is(err, errIdempotencyInProgress):
+				sendError(w, "A request with this Idempotency-Key is still in progress", http.StatusConflict)
+				return
+			case reply != nil:
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(reply.status)
+				_, _ = w.Write(reply.body)
+				return
+			}
+			capture := &responseCapture{ResponseWriter: w}
+			w = capture
+			defer func() { activateReplies.finish(key, fingerprint, capture.status, capture.body.Bytes()) }()
+		}
+
+		hwPrefix := req.HardwareID
+		if len(req.HardwareID) > 8 {
+			hwPrefix = req.HardwareID[:8] + "..."
+		}
+		logger := requestLogger(r).With("license", redact.PII(req.LicenseKey), "hardware", hwPrefix)
+		logger.Info("Activation request")
+
+		// Validate license key exists
+		license, err := getLicense(r.Context(), req.LicenseKey)
+		if err != nil {
+			logger.Warn("License lookup failed", "error", err)
+			sendLicenseError(w, err)
+			return
+		}
+
+		// For FREE tier: Check if this hardware already has an active free license
+		if free := freeTiers(config.DefaultTier); slices.Contains(free, license.Tier) && isFreeHardwareAlreadyActive(r.Context(), req.HardwareID, req.LicenseKey, free) {
+			logger.Warn("Hardware already has an active free license, blocking new free license")
+			sendError(w, "This device already has an active FREE license. Each device is limited to one free license.", http.StatusForbidden)
+			return
+		}
+
+		// Check if license is active and not expired
+		if err := validateLicense(license); err != nil {
+			sendLicenseError(w, err)
+			return
+		}
+		if revocations.isRevoked(license.LicenseID) {
+			logger.Warn("🚫 Activation for revoked license")
+			sendLicenseError(w, ErrLicenseRevoked)
+			return
+		}
+
+		// Record the activation if the device is new. The seat limit only
+		// applies to new devices, so existing ones keep working when seats are
+		// reduced below the current activation count. Checking and recording
+		// happen atomically, so concurrent activations can't overfill a license.
+		added, err := activateDevice(r.Context(), license, req.HardwareID)
+		if errors.Is(err, ErrMaxActivations) {
+			sendError(w, fmt.Sprintf("Maximum activations (%d) reached", license.Limits.MaxActivations), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			logger.Error("Error recording activation", "error", err)
+			sendLicenseError(w, err)
+			return
+		}
+		if added {
+			logger.Info("New activation recorded")
+		} else {
+			logger.Info("Re-activation on existing hardware")
+		}
+
+		// Record check-in
+		if err := recordCheckIn(r.Context(), req.LicenseKey); err != nil {
+			logger.Error("Failed to record check-in", "error", err)
+		}
+
+		// Generate response based on proxy mode
+		var resp ActivationResponse
+		if proxyMode {
+			// Generate and store proxy key
+			proxyKey, err := generateProxyKey()
+			if err != nil {
+				logger.Error("Error generating proxy key", "error", err)
+				sendError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			proxyKeyExpiresAt := proxyKeyExpiry(config.ProxyKeyTTL)
+			if err := storeProxyKey(r.Context(), proxyKey, req.LicenseKey, req.HardwareID, proxyKeyExpiresAt); err != nil {
+				logger.Error("Error storing proxy key", "error", err)
+				sendError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			// Encrypt the proxy key for the client
+			encryptedData, iv, err := encryptAPIKeyBundle(proxyKey, license, req.LicenseKey, req.HardwareID)
+			if err != nil {
+				logger.Error("Encryption error", "error", err)
+				sendError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			resp = ActivationResponse{
+				Success:         true,
+				CustomerName:    license.CustomerName,
+				ExpiresAt:       license.ExpiresAt,
+				Tier:            license.Tier,
+				EncryptedAPIKey: encryptedData,
+				IV:              iv,
+				Salt:            license.EncryptionSalt,
+				BundleSignature: licensecrypto.SignBundle(privateKey, encryptedData, iv, license.EncryptionSalt, req.LicenseKey),
+				Products:        license.Products,
+				Mode:            "proxy",
+				ProxyKeyExpires: proxyKeyExpiresAt,
+				Limits: struct {
+					DailyLimit     int `json:"daily_limit"`
+					MonthlyLimit   int `json:"monthly_limit"`
+					MaxActivations int `json:"max_activations"`
+				}{
+					DailyLimit:     license.Limits.DailyLimit,
+					MonthlyLimit:   license.Limits.MonthlyLimit,
+					MaxActivations: license.Limits.MaxActivations,
+				},
+			}
+			logger.Info("✅ Activation successful", "mode", "proxy", "proxy_key_id", proxyKeyID(proxyKey))
+			activationsTotal.Inc("proxy")
+
+			// Send webhook for activation event
+			if config.WebhookURL != "" {
+				sendWebhook(config.WebhookURL, config.WebhookSecret, "license.activated", map[string]interface{}{
+					"license_key":    req.LicenseKey,
+					"hardware_id":    req.HardwareID,
+					"customer_email": license.CustomerEmail,
+					"customer_name":  license.CustomerName,
+					"tier":           license.Tier,
+					"products":       license.Products,
+					"mode":           "proxy",
+				})
+			}
+		} else {
+			// Normal mode: encrypt the protected API key
+			encryptedData, iv, err := encryptAPIKeyBundle(protectedAPIKey, license, req.LicenseKey, req.HardwareID)
+			if err != nil {
+				logger.Error("Encryption error", "error", err)
+				sendError(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+
+			resp = ActivationResponse{
+				Success:         true,
+				CustomerName:    license.CustomerName,
+				ExpiresAt:       license.ExpiresAt,
+				Tier:            license.Tier,
+				EncryptedAPIKey: encryptedData,
+				IV:              iv,
+				Salt:            license.EncryptionSalt,
+				BundleSignature: licensecrypto.SignBundle(privateKey, encryptedData, iv, license.EncryptionSalt, req.LicenseKey),
+				Products:        license.Products,
+				Mode:            "direct",
+				Limits: struct {
+					DailyLimit     int `json:"daily_limit"`
+					MonthlyLimit   int `json:"monthly_limit"`
+					MaxActivations int `json:"max_activations"`
+				}{
+					DailyLimit:     license.Limits.DailyLimit,
+					MonthlyLimit:   license.Limits.MonthlyLimit,
+					MaxActivations: license.Limits.MaxActivations,
+				},
+			}
+			logger.Info("✅ Activation successful", "mode", "direct")
+			activationsTotal.Inc("direct")
+
+			// Send webhook for activation event
+			if config.WebhookURL != "" {
+				sendWebhook(config.WebhookURL, config.WebhookSecret, "license.activated", map[string]interface{}{
+					"license_key":    req.LicenseKey,
+					"hardware_id":    req.HardwareID,
+					"customer_email": license.CustomerEmail,
+					"customer_name":  license.CustomerName,
+					"tier":           license.Tier,
+					"products":       license.Products,
+					"mode":           "direct",
+				})
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// handleSeats sets a license's activation limit to the purchased seat count.
+// Lowering seats blocks new activations but leaves existing devices activated.
+func handleSeats(config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req SeatsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.LicenseKey == "" {
+			sendError(w, "License key is required", http.StatusBadRequest)
+			return
+		}
+		if req.Seats < 1 {
+			sendError(w, "Seats must be at least 1", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.ExecContext(r.Context(), fmt.Sprintf(`UPDATE licenses SET max_activations = %s WHERE license_id = %s`,
+			sqlPlaceholder(1), sqlPlaceholder(2)), req.Seats, req.LicenseKey)
+		if err != nil {
+			log.Printf("Failed to update seats: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			sendLicenseError(w, ErrLicenseNotFound)
+			return
+		}
+		cachedLicenses.invalidate(req.LicenseKey)
+
+		count, err := getActivationCount(r.Context(), req.LicenseKey)
+		if err != nil {
+			log.Printf("Error checking activations: %v", err)
+		}
+
+		overProvisioned := count > req.Seats
+		if overProvisioned {
+			log.Printf("⚠️  License %s has %d activations but only %d seats; new activations blocked", redact.PII(req.LicenseKey), count, req.Seats)
+		} else {
+			log.Printf("✅ Seats for license %s set to %d", redact.PII(req.LicenseKey), req.Seats)
+		}
+
+		sendWebhook(config.WebhookURL, config.WebhookSecret, "license.seats_updated", map[string]interface{}{
+			"license_key":         req.LicenseKey,
+			"seats":               req.Seats,
+			"current_activations": count,
+			"over_provisioned":    overProvisioned,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(SeatsResponse{
+			Success:            true,
+			LicenseKey:         req.LicenseKey,
+			Seats:              req.Seats,
+			CurrentActivations: count,
+			OverProvisioned:    overProvisioned,
+		})
+	}
+}
+
+// handleUsage serves POST /usage (report usage) and GET /usage (usage history)
+func handleUsage(alerts *usageAlerts) http.HandlerFunc {
+	report := handleUsageReport(alerts)
+	history := handleUsageHistory()
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			history(w, r)
+			return
+		}
+		report(w, r)
+	}
+}
+
+// handleUsageHistory returns a license's daily usage between the from and to
+// query parameters (YYYY-MM-DD, inclusive). The range defaults to the last 30
+// days and may span at most database.MaxUsageRangeDays days.
+func handleUsageHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		licenseKey := query.Get("license_key")
+		if licenseKey == "" {
+			sendError(w, "license_key is required", http.StatusBadRequest)
+			return
+		}
+
+		// Usage is recorded under the server's local date
+		to, _ := time.Parse("2006-01-02", time.Now().Format("2006-01-02"))
+		if v := query.Get("to"); v != "" {
+			parsed, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				sendError(w, "to must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+				return
+			}
+			to = parsed
+		}
+		from := to.AddDate(0, 0, -29)
+		if v := query.Get("from"); v != "" {
+			parsed, err := time.Parse("2006-01-02", v)
+			if err != nil {
+				sendError(w, "from must be a date in YYYY-MM-DD format", http.StatusBadRequest)
+				return
+			}
+			from = parsed
+		}
+		if from.After(to) {
+			sendError(w, "from must not be after to", http.StatusBadRequest)
+			return
+		}
+		days := int(to.Sub(from).Hours()/24) + 1
+		if days > database.MaxUsageRangeDays {
+			sendError(w, fmt.Sprintf("Date range too long: %d days (maximum %d)", days, database.MaxUsageRangeDays), http.StatusBadRequest)
+			return
+		}
+
+		license, err := getLicense(r.Context(), licenseKey)
+		if err != nil {
+			sendLicenseError(w, err)
+			return
+		}
+
+		usage, err := store.GetUsageRangeContext(r.Context(), license.LicenseID, from.Format("2006-01-02"), to.Format("2006-01-02"))
+		if err != nil {
+			log.Printf("Failed to load usage history: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		scans := make(map[string]int, len(usage))
+		for _, day := range usage {
+			scans[day.Date] = day.Scans
+		}
+
+		resp := UsageHistoryResponse{
+			Success:    true,
+			From:       from.Format("2006-01-02"),
+			To:         to.Format("2006-01-02"),
+			Days:       make([]UsageDay, 0, days),
+			DailyLimit: license.Limits.DailyLimit,
+		}
+		for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+			date := d.Format("2006-01-02")
+			resp.Days = append(resp.Days, UsageDay{Date: date, Scans: scans[date]})
+			resp.TotalScans += scans[date]
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func handleUsageReport(alerts *usageAlerts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req UsageReport
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		// Validate license exists
+		license, err := getLicense(r.Context(), req.LicenseKey)
+		if err != nil {
+			sendLicenseError(w, err)
+			return
+		}
+
+		// Record check-in
+		if err := recordCheckIn(r.Context(), req.LicenseKey); err != nil {
+			log.Printf("Failed to record check-in: %v", err)
+		}
+
+		// Update usage
+		if err := store.RecordUsageContext(r.Context(), req.LicenseKey, req.Date, req.HardwareID, req.Scans); err != nil {
+			log.Printf("Failed to record usage: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		dailyLimit, monthlyLimit := license.limitsOn(req.Date)
+		go alerts.check(license.LicenseID, license.Tier, dailyLimit, monthlyLimit, req.Date)
+
+		// Get current usage
+		dailyUsage, monthlyUsage := getUsage(r.Context(), req.LicenseKey, req.Date)
+
+		resp := UsageResponse{
+			Success:      true,
+			DailyUsage:   dailyUsage,
+			MonthlyUsage: monthlyUsage,
+			DailyLimit:   dailyLimit,
+			MonthlyLimit: monthlyLimit,
+			Tier:         license.Tier,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// usageBatchMaxAge is how many days back a /usage/batch entry may be dated.
+// Clients buffer scans while offline, but older entries would rewrite
+// months that were already reported.
+const usageBatchMaxAge = 30
+
+// usageBatchDates returns the first and last dates (YYYY-MM-DD) a batch entry
+// may have at now. Tomorrow is allowed for clients ahead of UTC.
+func usageBatchDates(now time.Time) (earliest, latest string) {
+	now = now.UTC()
+	return now.AddDate(0, 0, -usageBatchMaxAge).Format("2006-01-02"), now.AddDate(0, 0, 1).Format("2006-01-02")
+}
+
+// handleUsageBatch records a batch of usage reports in one transaction, so
+// clients can buffer scans instead of reporting each one. The response
+// shows usage for the latest date in the batch.
+func handleUsageBatch(alerts *usageAlerts) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req UsageBatchReport
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Entries) == 0 {
+			sendError(w, "entries must not be empty", http.StatusBadRequest)
+			return
+		}
+		if len(req.Entries) > database.MaxUsageBatch {
+			sendError(w, fmt.Sprintf("Too many entries: %d (maximum %d)", len(req.Entries), database.MaxUsageBatch), http.StatusBadRequest)
+			return
+		}
+
+		// Reject the whole batch before writing anything
+		entries := make([]database.UsageEntry, 0, len(req.Entries))
+		var latest string
+		recorded := 0
+		earliest, newest := usageBatchDates(time.Now())
+		for i, e := range req.Entries {
+			if _, err := time.Parse("2006-01-02", e.Date); err != nil {
+				sendError(w, fmt.Sprintf("entries[%d]: date must be in YYYY-MM-DD format", i), http.StatusBadRequest)
+				return
+			}
+			if e.Date < earliest || e.Date > newest {
+				sendError(w, fmt.Sprintf("entries[%d]: date must be between %s and %s", i, earliest, newest), http.StatusBadRequest)
+				return
+			}
+			if e.Scans < 1 {
+				sendError(w, fmt.Sprintf("entries[%d]: scans must be at least 1", i), http.StatusBadRequest)
+				return
+			}
+			entries = append(entries, database.UsageEntry{Date: e.Date, HardwareID: e.HardwareID, Scans: e.Scans})
+			latest = max(latest, e.Date)
+			recorded += e.Scans
+		}
+
+		license, err := getLicense(r.Context(), req.LicenseKey)
+		if err != nil {
+			sendLicenseError(w, err)
+			return
+		}
+
+		if err := recordCheckIn(r.Context(), license.LicenseID); err != nil {
+			log.Printf("Failed to record check-in: %v", err)
+		}
+
+		if err := store.RecordUsageBatchContext(r.Context(), license.LicenseID, entries); err != nil {
+			log.Printf("Failed to record usage batch: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		dailyLimit, monthlyLimit := license.limitsOn(latest)
+		go alerts.check(license.LicenseID, license.Tier, dailyLimit, monthlyLimit, latest)
+
+		dailyUsage, monthlyUsage := getUsage(r.Context(), license.LicenseID, latest)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(UsageResponse{
+			Success:      true,
+			Recorded:     recorded,
+			DailyUsage:   dailyUsage,
+			MonthlyUsage: monthlyUsage,
+			DailyLimit:   dailyLimit,
+			MonthlyLimit: monthlyLimit,
+			Tier:         license.Tier,
+		})
+	}
+}
+
+// StatsResponse is an overview of every license on the server
+type StatsResponse struct {
+	Success     bool         `json:"success"`
+	Licenses    int          `json:"licenses"`
+	Active      int          `json:"active"`
+	Expired     int          `json:"expired"`
+	Deactivated int          `json:"deactivated"`
+	Tiers       []TierCounts `json:"tiers"`
+	Activations int          `json:"activations"`
+	Month       string       `json:"month"` // YYYY-MM
+	MonthScans  int64        `json:"month_scans"`
+	MonthTokens int64        `json:"month_tokens"`
+}
+
+// TierCounts counts the licenses on one tier
+type TierCounts struct {
+	Tier        string `json:"tier"`
+	Licenses    int    `json:"licenses"`
+	Active      int    `json:"active"`
+	Expired     int    `json:"expired"`
+	Deactivated int    `json:"deactivated"`
+}
+
+// handleStats serves GET /stats: license counts by tier and state,
+// activations, and this month's usage
+func handleStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		stats, err := store.GetStatsContext(r.Context())
+		if err != nil {
+			log.Printf("Failed to load stats: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := StatsResponse{
+			Success:     true,
+			Licenses:    stats.Licenses,
+			Active:      stats.Active,
+			Expired:     stats.Expired,
+			Deactivated: stats.Deactivated,
+			Tiers:       make([]TierCounts, 0, len(stats.Tiers)),
+			Activations: stats.Activations,
+			Month:       stats.Month,
+			MonthScans:  stats.MonthScans,
+			MonthTokens: stats.MonthTokens,
+		}
+		for _, t := range stats.Tiers {
+			resp.Tiers = append(resp.Tiers, TierCounts(t))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// CacheInvalidateRequest names the license to drop from the license cache.
+// An empty license key clears the whole cache.
+type CacheInvalidateRequest struct {
+	LicenseKey string `json:"license_key"`
+}
+
+type CacheInvalidateResponse struct {
+	Success bool `json:"success"`
+	Dropped int  `json:"dropped"` // licenses that were cached
+}
+
+// handleCacheInvalidate drops licenses from the license cache so changes made
+// with licensify-admin or directly in the database apply at once instead of
+// after LICENSE_CACHE_TTL
+func handleCacheInvalidate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req CacheInvalidateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		dropped := cachedLicenses.invalidate(req.LicenseKey)
+		if req.LicenseKey == "" {
+			log.Printf("🗃️  License cache cleared (%d licenses)", dropped)
+		} else {
+			log.Printf("🗃️  License %s dropped from the cache", redact.PII(req.LicenseKey))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(CacheInvalidateResponse{Success: true, Dropped: dropped})
+	}
+}
+
+// License errors returned by getLicense, validateLicense and activateDevice.
+// Handlers map them to HTTP responses with sendLicenseError.
+var (
+	ErrLicenseNotFound    = errors.New("license not found")
+	ErrLicenseKeyChecksum = licensekey.ErrChecksumMismatch
+	ErrLicenseExpired     = errors.New("license has expired")
+	ErrLicenseDeactivated = errors.New("license has been deactivated")
+	ErrLicenseRevoked     = errors.New("license has been revoked")
+	ErrMaxActivations     = database.ErrMaxActivations
+)
+
+// validateLicense checks that a license is active and not expired
+func validateLicense(license *LicenseData) error {
+	if !license.Active {
+		return ErrLicenseDeactivated
+	}
+	if time.Now().After(license.ExpiresAt) {
+		return ErrLicenseExpired
+	}
+	return nil
+}
+
+// activateDevice activates a device for a license, reporting false if it
+// already was. It returns ErrMaxActivations if the license has no device
+// slots left.
+func activateDevice(ctx context.Context, license *LicenseData, hardwareID string) (bool, error) {
+	defer observeQuery("record_activation", time.Now())
+	return store.ActivateDeviceContext(ctx, license.LicenseID, hardwareID, license.Limits.MaxActivations)
+}
+
+// activationStillValid reports whether a stored activation response may be
+// replayed: the license is still valid and not revoked, and the device is
+// still activated
+func activationStillValid(ctx context.Context, revocations *revocationCache, licenseID, hardwareID string) bool {
+	license, err := getLicense(ctx, licenseID)
+	if err != nil || validateLicense(license) != nil || revocations.isRevoked(licenseID) {
+		return false
+	}
+	activated, err := isDeviceActivated(ctx, licenseID, hardwareID)
+	return err == nil && activated
+}
+
+// sendLicenseError maps license errors to an HTTP status and client-facing message
+func sendLicenseError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrLicenseNotFound):
+		sendError(w, "Invalid license key", http.StatusUnauthorized)
+	case errors.Is(err, ErrLicenseKeyChecksum):
+		sendError(w, "Invalid license key: checksum does not match, check it for typos", http.StatusBadRequest)
+	case errors.Is(err, ErrLicenseDeactivated):
+		sendError(w, "License has been deactivated", http.StatusForbidden)
+	case errors.Is(err, ErrLicenseRevoked):
+		sendError(w, "License has been revoked", http.StatusForbidden)
+	case errors.Is(err, ErrLicenseExpired):
+		sendError(w, "License has expired", http.StatusForbidden)
+	case errors.Is(err, ErrMaxActivations):
+		sendError(w, "Maximum activations reached", http.StatusForbidden)
+	default:
+		sendError(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// parseDBTime parses a timestamp column (handles both SQLite TEXT and
+// PostgreSQL TIMESTAMP)
+func parseDBTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	// Try alternate formats for SQLite/Postgres TIMESTAMP (no timezone)
+	// ParseInLocation uses the local timezone to avoid UTC shift
+	if t, err = time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	// Try SQLite default format with timezone
+	return time.Parse("2006-01-02 15:04:05.999999 -0700 MST", value)
+}
+
+// getLicense returns a license, from cachedLicenses when it was loaded within
+// LICENSE_CACHE_TTL
+func getLicense(ctx context.Context, licenseID string) (*LicenseData, error) {
+	// A key with a wrong check character is a typo, not worth a query
+	if err := licensekey.VerifyChecksum(licenseID); err != nil {
+		return nil, err
+	}
+	if license := cachedLicenses.get(licenseID); license != nil {
+		return license, nil
+	}
+	license, err := loadLicense(ctx, licenseID)
+	if err != nil {
+		return nil, err
+	}
+	cachedLicenses.put(license)
+	return license, nil
+}
+
+// loadLicense reads a license from the database
+func loadLicense(ctx context.Context, licenseID string) (*LicenseData, error) {
+	defer observeQuery("get_license", time.Now())
+	var license LicenseData
+	license.LicenseID = licenseID
+
+	var encryptionSalt sql.NullString
+	var expiresAtStr string
+
+	err := db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT customer_name, customer_email, tier, expires_at, 
+       daily_limit, monthly_limit, max_activations, active, encryption_salt,
+       previous_daily_limit, previous_monthly_limit, limits_changed_on
+FROM licenses WHERE license_id = %s
+`, sqlPlaceholder(1)), licenseID).Scan(
+		&license.CustomerName,
+		&license.CustomerEmail,
+		&license.Tier,
+		&expiresAtStr,
+		&license.Limits.DailyLimit,
+		&license.Limits.MonthlyLimit,
+		&license.Limits.MaxActivations,
+		&license.Active,
+		&encryptionSalt,
+		&license.previousDailyLimit,
+		&license.previousMonthlyLimit,
+		&license.limitsChangedOn,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, ErrLicenseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	license.ExpiresAt, err = parseDBTime(expiresAtStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse expires_at: %w", err)
+	}
+
+	// If no salt exists (legacy license), generate and store one
+	if !encryptionSalt.Valid || encryptionSalt.String == "" {
+		salt, err := generateSalt()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+		_, err = db.ExecContext(ctx, fmt.Sprintf("UPDATE licenses SET encryption_salt = %s WHERE license_id = %s",
+			sqlPlaceholder(1), sqlPlaceholder(2)), salt, licenseID)
+		if err != nil {
+			log.Printf("Warning: Failed to store salt for license %s: %v", redact.PII(licenseID), err)
+		}
+		license.EncryptionSalt = salt
+	} else {
+		license.EncryptionSalt = encryptionSalt.String
+	}
+
+	license.Products, err = store.GetLicenseProductsContext(ctx, licenseID)
+	if err != nil {
+		return nil, err
+	}
+	if len(license.Products) == 0 {
+		license.Products = []string{defaultProduct}
+	}
+
+	return &license, nil
+}
+
+// maxLicenseCacheTTL bounds LICENSE_CACHE_TTL, since licenses changed with
+// licensify-admin stay stale in the cache for up to that long
+const maxLicenseCacheTTL = 5 * time.Minute
+
+// maxLicenseCacheEntries bounds the licenses kept in licenseCache
+const maxLicenseCacheEntries = 10000
+
+// licenseCache keeps recently loaded licenses so busy clients don't read
+// the same row on every request. Expiry dates are checked against the clock
+// on every use, so only changes to the row itself can be stale. The server
+// drops a license when it changes one, and POST /admin/cache/invalidate
+// does the same for changes made elsewhere.
+type licenseCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]licenseCacheEntry
+}
+
+type licenseCacheEntry struct {
+	license LicenseData
+	expires time.Time
+}
+
+func newLicenseCache(ttl time.Duration) *licenseCache {
+	return &licenseCache{ttl: ttl, entries: make(map[string]licenseCacheEntry)}
+}
+
+// get returns a copy of the cached license, or nil if it isn't cached or
+// has expired
+func (c *licenseCache) get(licenseID string) *LicenseData {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[licenseID]
+	if !ok {
+		return nil
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(c.entries, licenseID)
+		return nil
+	}
+	license := entry.license
+	license.Products = slices.Clone(license.Products)
+	return &license
+}
+
+// put caches a copy of license. When the cache is full and nothing has
+// expired, the license is simply not cached.
+func (c *licenseCache) put(license *LicenseData) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	if _, ok := c.entries[license.LicenseID]; !ok && len(c.entries) >= maxLicenseCacheEntries {
+		c.removeExpired(now)
+		if len(c.entries) >= maxLicenseCacheEntries {
+			return
+		}
+	}
+	entry := licenseCacheEntry{license: *license, expires: now.Add(c.ttl)}
+	entry.license.Products = slices.Clone(license.Products)
+	c.entries[license.LicenseID] = entry
+}
+
+// invalidate drops one license, or every license when licenseID is empty,
+// and returns how many were cached
+func (c *licenseCache) invalidate(licenseID string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if licenseID == "" {
+		n := len(c.entries)
+		clear(c.entries)
+		return n
+	}
+	if _, ok := c.entries[licenseID]; !ok {
+		return 0
+	}
+	delete(c.entries, licenseID)
+	return 1
+}
+
+// cleanup drops expired licenses
+func (c *licenseCache) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeExpired(time.Now())
+}
+
+func (c *licenseCache) removeExpired(now time.Time) {
+	for id, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+}
+
+func getActivationCount(ctx context.Context, licenseID string) (int, error) {
+	defer observeQuery("get_activation_count", time.Now())
+	var count int
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s", sqlPlaceholder(1)), licenseID).Scan(&count)
+	return count, err
+}
+
+// isDeviceActivated reports whether hardwareID is activated for licenseID
+func isDeviceActivated(ctx context.Context, licenseID, hardwareID string) (bool, error) {
+	defer observeQuery("get_activation", time.Now())
+	var count int
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s AND hardware_id = %s",
+		sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID).Scan(&count)
+	return count > 0, err
+}
+
+func recordActivation(ctx context.Context, licenseID, hardwareID string) error {
+	defer observeQuery("record_activation", time.Now())
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO activations (license_id, hardware_id) 
+VALUES (%s, %s)
+`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID)
+	return err
+}
+
+// legacyFreeTier is the tier self-service licenses were created on before
+// DEFAULT_TIER existed
+const legacyFreeTier = "free"
+
+// freeTiers returns the tiers self-service licenses can be on: the default
+// tier, the deprecated tiers that migrate to it, and the legacy 'free' tier
+func freeTiers(defaultTier string) []string {
+	names := []string{defaultTier}
+	for _, name := range tierRegistry.ListDeprecated() {
+		// Follow migration chains, e.g. tier-1 -> tier-11 -> tier-12
+		target := name
+		for hops := 0; hops <= len(tierRegistry.List()) && target != defaultTier; hops++ {
+			next, err := tierRegistry.GetMigrationTarget(target)
+			if err != nil {
+				break
+			}
+			target = next
+		}
+		if target == defaultTier && name != defaultTier {
+			names = append(names, name)
+		}
+	}
+	if !slices.Contains(names, legacyFreeTier) {
+		names = append(names, legacyFreeTier)
+	}
+	return names
+}
+
+// isFreeHardwareAlreadyActive reports whether the device already has another
+// active license on one of the free tiers (see freeTiers)
+func isFreeHardwareAlreadyActive(ctx context.Context, hardwareID, requestedLicenseID string, free []string) bool {
+	placeholders := make([]string, len(free))
+	args := []interface{}{hardwareID, requestedLicenseID}
+	for i, tier := range free {
+		placeholders[i] = sqlPlaceholder(i + 3)
+		args = append(args, tier)
+	}
+
+	var count int
+	// Use boolean true for PostgreSQL compatibility, works with SQLite too
+	err := db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT COUNT(DISTINCT a.license_id) 
+FROM activations a
+JOIN licenses l ON a.license_id = l.license_id
+WHERE a.hardware_id = %s 
+  AND a.license_id != %s
+  AND l.active = true 
+  AND l.expires_at > CURRENT_TIMESTAMP
+  AND l.tier IN (%s)
+`, sqlPlaceholder(1), sqlPlaceholder(2), strings.Join(placeholders, ", ")), args...).Scan(&count)
+
+	if err != nil {
+		log.Printf("Error checking free hardware: %v", err)
+		return false
+	}
+
+	return count > 0
+}
+
+// recordCheckIn sets a license's last check-in to now
+func recordCheckIn(ctx context.Context, licenseID string) error {
+	defer observeQuery("record_check_in", time.Now())
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+INSERT INTO check_ins (license_id, last_check_in) 
+VALUES (%s, CURRENT_TIMESTAMP)
+ON CONFLICT(license_id) DO UPDATE SET 
+last_check_in = CURRENT_TIMESTAMP
+`, sqlPlaceholder(1)), licenseID)
+	if err != nil {
+		return fmt.Errorf("failed to record check-in: %w", err)
+	}
+	return nil
+}
+
+func getUsage(ctx context.Context, licenseID, date string) (int, int) {
+	defer observeQuery("get_usage", time.Now())
+	var dailyUsage int
+	_ = db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT COALESCE(SUM(scans), 0) FROM daily_usage 
+WHERE license_id = %s AND date = %s
+`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, date).Scan(&dailyUsage)
+
+	// Monthly usage (current month)
+	var monthlyUsage int
+	yearMonth := date[:7] // YYYY-MM
+	_ = db.QueryRowContext(ctx, fmt.Sprintf(`
+SELECT COALESCE(SUM(scans), 0) FROM daily_usage 
+WHERE license_id = %s AND date LIKE %s
+`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, yearMonth+"%").Scan(&monthlyUsage)
+
+	return dailyUsage, monthlyUsage
+}
+
+// usageAlerts sends a usage.threshold_reached webhook, and optionally an email
+// to the customer, when a license's daily or monthly usage crosses one of the
+// configured percentages of its limit. A nil usageAlerts disables alerts.
+type usageAlerts struct {
+	defaults      []int // USAGE_THRESHOLDS, used by tiers without usage_thresholds
+	webhookURL    string
+	webhookSecret string
+	mailer        *email.Client // nil unless USAGE_ALERT_EMAIL is enabled and email is configured
+}
+
+// newUsageAlerts returns nil when there is nowhere to send alerts
+func newUsageAlerts(config *Config) *usageAlerts {
+	var mailer *email.Client
+	if config.UsageAlertEmail {
+		mailer = config.Mailer
+	}
+	if config.WebhookURL == "" && mailer == nil {
+		return nil
+	}
+	return &usageAlerts{
+		defaults:      config.UsageThresholds,
+		webhookURL:    config.WebhookURL,
+		webhookSecret: config.WebhookSecret,
+		mailer:        mailer,
+	}
+}
+
+// thresholds returns the alert percentages for a tier
+func (a *usageAlerts) thresholds(tier string) []int {
+	if details, err := tierRegistry.Get(tier); err == nil && len(details.UsageThresholds) > 0 {
+		return details.UsageThresholds
+	}
+	return a.defaults
+}
+
+// check compares a license's usage on date against its limits and sends any
+// alerts that have not already gone out this day or month
+func (a *usageAlerts) check(licenseID, tier string, dailyLimit, monthlyLimit int, date string) {
+	if a == nil {
+		return
+	}
+	thresholds := a.thresholds(tier)
+	if len(thresholds) == 0 {
+		return
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return
+	}
+
+	dailyUsage, monthlyUsage := getUsage(context.Background(), licenseID, date)
+	a.notify(licenseID, tier, "daily", date, dailyUsage, dailyLimit, thresholds)
+	a.notify(licenseID, tier, "monthly", date[:7], monthlyUsage, monthlyLimit, thresholds)
+}
+
+// notify marks every threshold usage has reached in the period and alerts once
+// for the highest newly reached one, so a jump from 50% to 110% sends a single
+// 100% alert rather than one per threshold
+func (a *usageAlerts) notify(licenseID, tier, period, periodKey string, usage, limit int, thresholds []int) {
+	if limit <= 0 {
+		return // unlimited
+	}
+	percent := usage * 100 / limit
+
+	reached := 0
+	for _, threshold := range thresholds {
+		if percent < threshold {
+			continue
+		}
+		first, err := store.MarkThresholdNotified(licenseID, period, periodKey, threshold)
+		if err != nil {
+			log.Printf("Failed to record usage alert for license %s: %v", redact.PII(licenseID), err)
+			continue
+		}
+		if first && threshold > reached {
+			reached = threshold
+		}
+	}
+	if reached == 0 {
+		return
+	}
+
+	var customerEmail string
+	if license, err := getLicense(context.Background(), licenseID); err == nil {
+		customerEmail = license.CustomerEmail
+	}
+
+	log.Printf("📈 License %s reached %d%% of its %s limit (%d/%d)", redact.PII(licenseID), reached, period, usage, limit)
+	sendWebhook(a.webhookURL, a.webhookSecret, "usage.threshold_reached", map[string]interface{}{
+		"license_key":    licenseID,
+		"customer_email": customerEmail,
+		"tier":           tier,
+		"period":         period,
+		"period_key":     periodKey,
+		"threshold":      reached,
+		"usage":          usage,
+		"limit":          limit,
+		"percent":        percent,
+	})
+
+	if a.mailer != nil && customerEmail != "" {
+		if err := a.mailer.SendUsageThreshold(customerEmail, licenseID, period, reached, usage, limit); err != nil {
+			log.Printf("Failed to send usage alert email: %v", err)
+		}
+	}
+}
+
+// handleActivationTest returns a bundle encrypted exactly like /activate but holding
+// a known sentinel instead of the protected API key, so integrators can verify
+// their key derivation and decryption without a real license or secret.
+func handleActivationTest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var req ActivationRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			sendError(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if req.LicenseKey == "" || req.HardwareID == "" {
+			sendError(w, "license_key and hardware_id are required", http.StatusBadRequest)
+			return
+		}
+
+		salt, err := generateSalt()
+		if err != nil {
+			log.Printf("Error generating salt: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		license := &LicenseData{
+			LicenseID:      req.LicenseKey,
+			CustomerName:   "Activation Test",
+			Tier:           "test",
+			ExpiresAt:      time.Now().Add(time.Hour),
+			EncryptionSalt: salt,
+		}
+
+		encryptedData, iv, err := encryptAPIKeyBundle(ActivationTestSentinel, license, req.LicenseKey, req.HardwareID)
+		if err != nil {
+			log.Printf("Encryption error: %v", err)
+			sendError(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ActivationTestResponse{
+			Success:         true,
+			EncryptedAPIKey: encryptedData,
+			IV:              iv,
+			Salt:            salt,
+			KDF:             kdfParams.String(),
+			Sentinel:        ActivationTestSentinel,
+		})
+	}
+}
+
+func encryptAPIKeyBundle(protectedAPIKey string, license *LicenseData, licenseKey, hwID string) (string, string, error) {
+	// Prepare bundle
+	bundle := DecryptedData{
+		APIKey:       protectedAPIKey,
+		CustomerName: license.CustomerName,
+		ExpiresAt:    license.ExpiresAt,
+		Tier:         license.Tier,
+		Limits: struct {
+			DailyLimit     int `json:"daily_limit"`
+			MonthlyLimit   int `json:"monthly_limit"`
+			MaxActivations int `json:"max_activations"`
+		}{
+			DailyLimit:     license.Limits.DailyLimit,
+			MonthlyLimit:   license.Limits.MonthlyLimit,
+			MaxActivations: license.Limits.MaxActivations,
+		},
+	}
+
+	// Serialize
+	plaintext, err := json.Marshal(bundle)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Derive key from license + hardware ID + salt using Argon2
+	key, err := licensecrypto.DeriveKey(licenseKey, hwID, license.EncryptionSalt)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Create cipher
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Create GCM
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", "", err
+	}
+
+	// Generate nonce
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", "", err
+	}
+
+	// Encrypt
+	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+
+	// Encode to base64
+	encrypted := base64.StdEncoding.EncodeToString(ciphertext)
+	iv := base64.StdEncoding.EncodeToString(nonce)
+
+	return encrypted, iv, nil
+}
+
+// generateSalt creates a cryptographically secure random salt, prefixed
+// with the Argon2id settings when they differ from the legacy ones
+func generateSalt() (string, error) {
+	salt := make([]byte, 32) // 256-bit salt
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	return licensecrypto.EncodeSalt(hex.EncodeToString(salt), kdfParams), nil
+}
+
+func sendError(w http.ResponseWriter, message string, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{
+		Success: false,
+		Error:   message,
+	})
+}
+
+// verificationCodeTTL is how long an emailed verification code is valid
+const verificationCodeTTL = 15 * time.Minute
+
+func generateVerificationCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// sendWebhook sends event data to configured webhook URL (e.g., Zapier)
+func sendWebhook(webhookURL, webhookSecret, event string, data map[string]interface{}) {
+	if webhookURL == "" {
+		return // Webhooks not configured
+	}
+
+	// Add event type and timestamp
+	payload := map[string]interface{}{
+		"event":     event,
+		"timestamp": time.Now().Unix(),
+		"data":      data,
+	}
+
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal webhook payload: %v", err)
+		return
+	}
+
+	// Create request
+	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(jsonData))
+	if err != nil {
+		log.Printf("Failed to create webhook request: %v", err)
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("Licensify/%s", Version))
+
+	// Add HMAC signature if secret is configured
+	if webhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(webhookSecret))
+		mac.Write(jsonData)
+		signature := hex.EncodeToString(mac.Sum(nil))
+		req.Header.Set("X-Webhook-Signature", signature)
+	}
+
+	// Send async (don't block main flow)
+	go func() {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Do(req)
+
+		var statusCode int
+		var errorMsg string
+
+		if err != nil {
+			log.Printf("Webhook delivery failed (%s): %v", event, err)
+			errorMsg = err.Error()
+		} else {
+			defer func() { _ = resp.Body.Close() }()
+			statusCode = resp.StatusCode
+
+			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+				body, _ := io.ReadAll(resp.Body)
+				errorMsg = string(body)
+				log.Printf("Webhook returned error (%s): %d - %s", event, resp.StatusCode, body)
+			} else {
+				log.Printf("Webhook delivered successfully: %s", event)
+			}
+		}
+
+		// Log to database
+		_, err = db.Exec(fmt.Sprintf(`
+		INSERT INTO webhook_logs (event, payload, status_code, error)
+		VALUES (%s, %s, %s, %s)
+	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4)),
+			event, string(jsonData), statusCode, errorMsg)
+		if err != nil {
+			log.Printf("Failed to log webhook to database: %v", err)
+		}
+	}()
+}
+
+// ProxyRequest handles proxying to external APIs
+type ProxyRequest struct {
+	ProxyKey  string          `json:"proxy_key"`       // Generated proxy key from activation
+	Provider  string          `json:"provider"`        // "openai", "anthropic" or "gemini"
+	Body      json.RawMessage `json:"body"`            // Original API request body
+	Signature string          `json:"signature"`       // HMAC-SHA256 signature for request authentication
+	Timestamp int64           `json:"timestamp"`       // Unix timestamp to prevent replay attacks
+	Nonce     string          `json:"nonce,omitempty"` // Random per-request value, accepted once per proxy key
+}
+
+// maxSignatureSkew is how far, in seconds, a signed request's timestamp may
+// be from the server clock
+const maxSignatureSkew = 300
+
+// Signature errors returned by validateRequestSignature. Handlers report them
+// with sendSignatureError.
+var (
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrTimestampOutOfWindow = errors.New("timestamp out of window")
+	ErrReplayedRequest      = errors.New("request was already received")
+	ErrReplayCacheFull      = errors.New("replay cache is full")
+	ErrReplayKeyLimit       = errors.New("too many signed requests for this proxy key")
+	ErrInvalidNonce         = errors.New("invalid nonce")
+)
+
+// maxReplayEntries bounds the nonces and signatures remembered for replay
+// detection.
+// Entries only last for the timestamp window, so this is only reached
+// under heavy load.
+const maxReplayEntries = 100000
+
+// maxReplayEntriesPerKey bounds the entries one proxy key may hold. An entry
+// lives for up to twice maxSignatureSkew, so this allows a sustained three or
+// so requests per second per key.
+const maxReplayEntriesPerKey = 2000
+
+// proxySignatureMessage is the signed form of a proxy request:
+// timestamp, method, path, provider, nonce (when sent) and body separated by
+// newlines. The method and path bind the signature to one endpoint.
+func proxySignatureMessage(timestamp int64, method, path, provider, nonce string, body []byte) string {
+	if nonce != "" {
+		return fmt.Sprintf("%d\n%s\n%s\n%s\n%s\n%s", timestamp, method, path, provider, nonce, body)
+	}
+	return fmt.Sprintf("%d\n%s\n%s\n%s\n%s", timestamp, method, path, provider, body)
+}
+
+// noncePattern is what clients may send as a proxy request nonce, e.g. 32
+// hex characters from 16 random bytes
+var noncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,64}$`)
+
+// proxySignatures checks proxy request signatures and rejects replays
+type proxySignatures struct {
+	replays *replayCache
+	legacy  bool // also accept HMAC(timestamp + provider + body) from older clients
+}
+
+// validateProxySignature validates the HMAC-SHA256 signature on a proxy
+// request, computed as HMAC-SHA256(proxy_key, proxySignatureMessage(...)),
+// and accepts each nonce, or each signature when there is no nonce, only once
+func (s *proxySignatures) validateProxySignature(r *http.Request, req *ProxyRequest) error {
+	if req.Nonce != "" && !noncePattern.MatchString(req.Nonce) {
+		return ErrInvalidNonce
+	}
+	message := proxySignatureMessage(req.Timestamp, r.Method, r.URL.Path, req.Provider, req.Nonce, req.Body)
+	err := validateRequestSignature(req.ProxyKey, message, req.Timestamp, req.Signature)
+	if errors.Is(err, ErrInvalidSignature) && s.legacy && req.Nonce == "" {
+		err = validateRequestSignature(req.ProxyKey, fmt.Sprintf("%d%s%s", req.Timestamp, req.Provider, req.Body), req.Timestamp, req.Signature)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Nonces are scoped to the proxy key so one client can't use up
+	// another's. Either stays valid until the timestamp leaves the window.
+	key := "sig:" + req.Signature
+	if req.Nonce != "" {
+		key = "nonce:" + req.Nonce
+	}
+	return s.replays.firstUse(req.ProxyKey, key, time.Unix(req.Timestamp+maxSignatureSkew, 0))
+}
+
+// replayCache remembers nonces and signatures until they expire so each
+// signed request is accepted once. Entries are grouped by proxy key so no key
+// can hold more than maxPerKey of them and crowd out everyone else.
+type replayCache struct {
+	mu        sync.Mutex
+	seen      map[string]map[string]time.Time // proxy key -> nonce or signature -> when it stops being valid
+	size      int
+	maxSize   int
+	maxPerKey int
+}
+
+func newReplayCache(maxSize, maxPerKey int) *replayCache {
+	return &replayCache{seen: make(map[string]map[string]time.Time), maxSize: maxSize, maxPerKey: maxPerKey}
+}
+
+// firstUse records key for proxyKey until expires, returning
+// ErrReplayedRequest if it was already recorded. When proxyKey already has
+// maxPerKey live entries it returns ErrReplayKeyLimit, and when the whole
+// cache is full of live entries ErrReplayCacheFull, refusing the request
+// rather than forgetting entries that could then be replayed.
+func (c *replayCache) firstUse(proxyKey, key string, expires time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	entries := c.seen[proxyKey]
+	if until, ok := entries[key]; ok && now.Before(until) {
+		return ErrReplayedRequest
+	}
+	if len(entries) >= c.maxPerKey {
+		c.dropExpired(proxyKey, now)
+		if len(c.seen[proxyKey]) >= c.maxPerKey {
+			return ErrReplayKeyLimit
+		}
+	}
+	if c.size >= c.maxSize {
+		for k := range c.seen {
+			c.dropExpired(k, now)
+		}
+		if c.size >= c.maxSize {
+			log.Printf("⚠️  Replay cache full (%d entries), rejecting request", c.size)
+			return ErrReplayCacheFull
+		}
+	}
 
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("license not found")
+	if c.seen[proxyKey] == nil {
+		c.seen[proxyKey] = make(map[string]time.Time)
 	}
-	if err != nil {
-		return nil, fmt.Errorf("database error: %w", err)
+	if _, ok := c.seen[proxyKey][key]; !ok {
+		c.size++
 	}
+	c.seen[proxyKey][key] = expires
+	return nil
+}
 
-	// Parse expires_at (handle both SQLite TEXT and PostgreSQL TIMESTAMP)
-	license.ExpiresAt, err = time.Parse(time.RFC3339, expiresAtStr)
-	if err != nil {
-		// Try alternate formats for SQLite/Postgres TIMESTAMP (no timezone)
-		// ParseInLocation uses the local timezone to avoid UTC shift
-		license.ExpiresAt, err = time.ParseInLocation("2006-01-02 15:04:05", expiresAtStr, time.Local)
-		if err != nil {
-			// Try SQLite default format with timezone
-			license.ExpiresAt, err = time.Parse("2006-01-02 15:04:05.999999 -0700 MST", expiresAtStr)
-			if err != nil {
-				return nil, fmt.Errorf("failed to parse expires_at: %w", err)
-			}
+// dropExpired removes proxyKey's expired entries. The caller holds c.mu.
+func (c *replayCache) dropExpired(proxyKey string, now time.Time) {
+	entries := c.seen[proxyKey]
+	for k, until := range entries {
+		if !now.Before(until) {
+			delete(entries, k)
+			c.size--
 		}
 	}
+	if len(entries) == 0 {
+		delete(c.seen, proxyKey)
+	}
+}
 
-	// If no salt exists (legacy license), generate and store one
-	if !encryptionSalt.Valid || encryptionSalt.String == "" {
-		salt, err := generateSalt()
-		if err != nil {
-			return nil, fmt.Errorf("failed to generate salt: %w", err)
-		}
-		_, err = db.Exec(fmt.Sprintf("UPDATE licenses SET encryption_salt = %s WHERE license_id = %s",
-			sqlPlaceholder(1), sqlPlaceholder(2)), salt, licenseID)
-		if err != nil {
-			log.Printf("Warning: Failed to store salt for license %s: %v", redactPII(licenseID), err)
-		}
-		license.EncryptionSalt = salt
-	} else {
-		license.EncryptionSalt = encryptionSalt.String
+// cleanup drops expired entries
+func (c *replayCache) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for proxyKey := range c.seen {
+		c.dropExpired(proxyKey, now)
 	}
+}
+
+const (
+	idempotencyWindow       = 24 * time.Hour // how long a response is replayed for its Idempotency-Key
+	maxIdempotencyEntries   = 10000
+	maxIdempotencyKeyLength = 255
+)
+
+var (
+	errIdempotencyMismatch   = errors.New("idempotency key used for a different request")
+	errIdempotencyInProgress = errors.New("request with this idempotency key in progress")
+)
 
-	return &license, err
+// idempotencyCache keeps successful responses by the client's
+// Idempotency-Key, so a client retrying after a timeout gets the response
+// it missed. Failed requests are forgotten, so their retries run again.
+// Each server instance has its own cache.
+type idempotencyCache struct {
+	mu      sync.Mutex
+	entries map[string]*idempotentReply
 }
 
-func getActivationCount(licenseID string) (int, error) {
-	var count int
-	err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM activations WHERE license_id = %s", sqlPlaceholder(1)), licenseID).Scan(&count)
-	return count, err
+type idempotentReply struct {
+	fingerprint string // which request the key was first used for
+	done        bool   // false while the first request is running
+	status      int
+	body        []byte
+	expires     time.Time
 }
 
-func isHardwareActivated(licenseID, hardwareID string) (bool, error) {
-	var count int
-	err := db.QueryRow(fmt.Sprintf(`
-SELECT COUNT(*) FROM activations 
-WHERE license_id = %s AND hardware_id = %s
-`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID).Scan(&count)
-	return count > 0, err
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{entries: make(map[string]*idempotentReply)}
 }
 
-func recordActivation(licenseID, hardwareID string) error {
-	_, err := db.Exec(fmt.Sprintf(`
-INSERT INTO activations (license_id, hardware_id) 
-VALUES (%s, %s)
-`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID)
-	return err
+// idempotencyFingerprint identifies an activation request, so a key reused
+// for another license or device is refused rather than replayed
+func idempotencyFingerprint(licenseKey, hardwareID string) string {
+	sum := sha256.Sum256([]byte(licenseKey + "\x00" + hardwareID))
+	return hex.EncodeToString(sum[:])
 }
 
-func isFreeHardwareAlreadyActive(hardwareID, requestedLicenseID string) bool {
-	var count int
-	// Use boolean true for PostgreSQL compatibility, works with SQLite too
-	err := db.QueryRow(fmt.Sprintf(`
-SELECT COUNT(DISTINCT a.license_id) 
-FROM activations a
-JOIN licenses l ON a.license_id = l.license_id
-WHERE a.hardware_id = %s 
-  AND l.tier = 'free' 
-  AND l.active = true 
-  AND l.expires_at > CURRENT_TIMESTAMP
-  AND a.license_id != %s
-`, sqlPlaceholder(1), sqlPlaceholder(2)), hardwareID, requestedLicenseID).Scan(&count)
+// begin returns the stored reply for key, or reserves key and returns nil
+// when it hasn't been used. When the cache is full of live entries the
+// request simply runs without being stored.
+func (c *idempotencyCache) begin(key, fingerprint string) (*idempotentReply, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if e, ok := c.entries[key]; ok && now.Before(e.expires) {
+		switch {
+		case e.fingerprint != fingerprint:
+			return nil, errIdempotencyMismatch
+		case !e.done:
+			return nil, errIdempotencyInProgress
+		}
+		reply := *e
+		return &reply, nil
+	}
+	if len(c.entries) >= maxIdempotencyEntries {
+		c.removeExpired(now)
+		if len(c.entries) >= maxIdempotencyEntries {
+			return nil, nil
+		}
+	}
+	c.entries[key] = &idempotentReply{fingerprint: fingerprint, expires: now.Add(idempotencyWindow)}
+	return nil, nil
+}
 
-	if err != nil {
-		log.Printf("Error checking free hardware: %v", err)
-		return false
+// finish stores the response to the request that reserved key, or drops
+// the reservation if the request failed
+func (c *idempotencyCache) finish(key, fingerprint string, status int, body []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok || e.done || e.fingerprint != fingerprint {
+		return
+	}
+	if status != http.StatusOK || len(body) == 0 {
+		delete(c.entries, key)
+		return
+	}
+	e.done = true
+	e.status = status
+	e.body = bytes.Clone(body)
+	e.expires = time.Now().Add(idempotencyWindow)
+}
+
+// forget drops the stored response for key
+func (c *idempotencyCache) forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok && e.done {
+		delete(c.entries, key)
 	}
+}
 
-	return count > 0
+// cleanup drops expired entries
+func (c *idempotencyCache) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.removeExpired(time.Now())
 }
 
-func recordCheckIn(licenseID string) {
-	_, _ = db.Exec(fmt.Sprintf(`
-INSERT INTO check_ins (license_id, last_check_in) 
-VALUES (%s, CURRENT_TIMESTAMP)
-ON CONFLICT(license_id) DO UPDATE SET 
-last_check_in = CURRENT_TIMESTAMP
-`, sqlPlaceholder(1)), licenseID)
+func (c *idempotencyCache) removeExpired(now time.Time) {
+	for key, e := range c.entries {
+		if !now.Before(e.expires) {
+			delete(c.entries, key)
+		}
+	}
 }
 
-func getUsage(licenseID, date string) (int, int) {
-	var dailyUsage int
-	_ = db.QueryRow(fmt.Sprintf(`
-SELECT COALESCE(SUM(scans), 0) FROM daily_usage 
-WHERE license_id = %s AND date = %s
-`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, date).Scan(&dailyUsage)
+// validateRequestSignature checks a hex HMAC-SHA256 signature of message
+// keyed with key, rejecting timestamps more than maxSignatureSkew seconds off.
+// The signature is checked first so clock-skew details are only revealed to
+// callers holding the key.
+func validateRequestSignature(key, message string, timestamp int64, signature string) error {
+	// Compute HMAC-SHA256
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(message))
+	expectedSignature := hex.EncodeToString(h.Sum(nil))
 
-	// Monthly usage (current month)
-	var monthlyUsage int
-	yearMonth := date[:7] // YYYY-MM
-	_ = db.QueryRow(fmt.Sprintf(`
-SELECT COALESCE(SUM(scans), 0) FROM daily_usage 
-WHERE license_id = %s AND date LIKE %s
-`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, yearMonth+"%").Scan(&monthlyUsage)
+	// Constant-time comparison to prevent timing attacks
+	if !hmac.Equal([]byte(expectedSignature), []byte(signature)) {
+		return ErrInvalidSignature
+	}
 
-	return dailyUsage, monthlyUsage
+	if skew := time.Now().Unix() - timestamp; abs(skew) > maxSignatureSkew {
+		return fmt.Errorf("%w (client clock off by %+ds)", ErrTimestampOutOfWindow, -skew)
+	}
+	return nil
 }
 
-func encryptAPIKeyBundle(protectedAPIKey string, license *LicenseData, licenseKey, hwID string) (string, string, error) {
-	// Prepare bundle
-	bundle := DecryptedData{
-		APIKey:       protectedAPIKey,
-		CustomerName: license.CustomerName,
-		ExpiresAt:    license.ExpiresAt,
-		Tier:         license.Tier,
-		Limits: struct {
-			DailyLimit     int `json:"daily_limit"`
-			MonthlyLimit   int `json:"monthly_limit"`
-			MaxActivations int `json:"max_activations"`
-		}{
-			DailyLimit:     license.Limits.DailyLimit,
-			MonthlyLimit:   license.Limits.MonthlyLimit,
-			MaxActivations: license.Limits.MaxActivations,
-		},
+// sendSignatureError reports a rejected request signature. Clock skew gets
+// its own code and the server time so clients can correct their clock.
+func sendSignatureError(w http.ResponseWriter, err error) {
+	resp := ErrorResponse{
+		Success: false,
+		Error:   "Invalid signature",
+		Code:    "invalid_signature",
 	}
-
-	// Serialize
-	plaintext, err := json.Marshal(bundle)
-	if err != nil {
-		return "", "", err
+	status := http.StatusUnauthorized
+	if errors.Is(err, ErrTimestampOutOfWindow) {
+		resp.Error = fmt.Sprintf("Request timestamp is more than %d seconds from server time; check the client clock", maxSignatureSkew)
+		resp.Code = "timestamp_out_of_window"
+		resp.ServerTime = time.Now().Unix()
+	} else if errors.Is(err, ErrReplayedRequest) {
+		resp.Error = "Request was already received; sign each request with a fresh nonce and timestamp"
+		resp.Code = "replayed_request"
+	} else if errors.Is(err, ErrReplayCacheFull) {
+		// The request may be genuine; the server is just too busy to tell
+		resp.Error = "Server is too busy to check the request for replays; retry with a fresh nonce and timestamp"
+		resp.Code = "replay_cache_full"
+		status = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", "1")
+	} else if errors.Is(err, ErrReplayKeyLimit) {
+		resp.Error = "Too many signed requests for this proxy key; slow down"
+		resp.Code = "too_many_signed_requests"
+		status = http.StatusTooManyRequests
+		w.Header().Set("Retry-After", "1")
+	} else if errors.Is(err, ErrInvalidNonce) {
+		resp.Error = "Nonce must be 16 to 64 letters, digits, '-' or '_'"
+		resp.Code = "invalid_nonce"
+		status = http.StatusBadRequest
 	}
 
-	// Derive key from license + hardware ID + salt using Argon2
-	key := deriveKey(licenseKey, hwID, license.EncryptionSalt)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
 
-	// Create cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", "", err
+// effectiveLimit returns the limit to enforce for the reset window identified by
+// window ("YYYY-MM-DD" for daily, "YYYY-MM" for monthly). When the limits were
+// changed inside that window and the previous limit was more generous, the
+// previous limit stays in force until the next reset so downgraded customers
+// aren't blocked retroactively.
+func effectiveLimit(current int64, previous sql.NullInt64, changedOn sql.NullString, window string) int64 {
+	if !previous.Valid || !changedOn.Valid || !strings.HasPrefix(changedOn.String, window) {
+		return current
+	}
+	if current == -1 {
+		return current // Already unlimited
+	}
+	if previous.Int64 == -1 || previous.Int64 > current {
+		return previous.Int64
 	}
+	return current
+}
 
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", "", err
+// runAutoTier periodically applies the auto_tier rules from the tier configuration
+func runAutoTier(ctx context.Context, config *Config) {
+	ticker := time.NewTicker(config.AutoTierInterval)
+	defer ticker.Stop()
+
+	for {
+		evaluateAutoTier(config, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
+}
 
-	// Generate nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", "", err
+// evaluateAutoTier moves licenses whose usage crossed a rule's threshold for
+// every one of the rule's last completed months. Only months that start after
+// the license was created and after its last limit change are considered, so a
+// freshly moved license is not immediately moved back.
+func evaluateAutoTier(config *Config, now time.Time) {
+	rules := tierRegistry.AutoTierRules()
+	if len(rules) == 0 {
+		return
 	}
 
-	// Encrypt
-	ciphertext := gcm.Seal(nil, nonce, plaintext, nil)
+	moved := make(map[string]bool)
+	for _, rule := range rules {
+		target, err := tierRegistry.Get(rule.To)
+		if err != nil {
+			log.Printf("⚠️  Auto-tier: %v", err)
+			continue
+		}
 
-	// Encode to base64
-	encrypted := base64.StdEncoding.EncodeToString(ciphertext)
-	iv := base64.StdEncoding.EncodeToString(nonce)
+		// The N completed months before the current one, oldest first
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		windowStart := monthStart.AddDate(0, -rule.Months, 0).Format("2006-01-02")
+		months := make([]string, 0, rule.Months)
+		for i := rule.Months; i >= 1; i-- {
+			months = append(months, monthStart.AddDate(0, -i, 0).Format("2006-01"))
+		}
 
-	return encrypted, iv, nil
-}
+		rows, err := db.Query(fmt.Sprintf(`
+			SELECT license_id, customer_email, daily_limit, monthly_limit, created_at, limits_changed_on
+			FROM licenses
+			WHERE tier = %s AND active = true
+		`, sqlPlaceholder(1)), rule.From)
+		if err != nil {
+			log.Printf("⚠️  Auto-tier query failed: %v", err)
+			continue
+		}
 
-// deriveKey uses Argon2id to derive encryption key from license, hardware ID, and salt
-func deriveKey(licenseKey, hardwareID, salt string) []byte {
-	// Argon2id parameters (recommended for password hashing and key derivation)
-	const (
-		time    = 3         // Number of iterations
-		memory  = 64 * 1024 // Memory cost in KiB (64 MB)
-		threads = 4         // Parallelism
-		keyLen  = 32        // Output key length (AES-256)
-	)
+		type candidate struct {
+			id, email                string
+			dailyLimit, monthlyLimit int
+		}
+		var candidates []candidate
+		for rows.Next() {
+			var c candidate
+			var createdAt string
+			var changedOn sql.NullString
+			if err := rows.Scan(&c.id, &c.email, &c.dailyLimit, &c.monthlyLimit, &createdAt, &changedOn); err != nil {
+				log.Printf("Error scanning license row: %v", err)
+				continue
+			}
+			if c.monthlyLimit <= 0 || moved[c.id] {
+				continue // Unlimited licenses have no usage ratio
+			}
+			if len(createdAt) >= 10 && createdAt[:10] >= windowStart {
+				continue
+			}
+			if changedOn.Valid && changedOn.String >= windowStart {
+				continue
+			}
+			candidates = append(candidates, c)
+		}
+		_ = rows.Close()
+
+		for _, c := range candidates {
+			threshold := c.monthlyLimit * rule.Percent / 100
+			matches := true
+			for _, month := range months {
+				var usage int
+				if err := db.QueryRow(fmt.Sprintf(`
+					SELECT COALESCE(SUM(scans), 0) FROM daily_usage
+					WHERE license_id = %s AND date LIKE %s
+				`, sqlPlaceholder(1), sqlPlaceholder(2)), c.id, month+"%").Scan(&usage); err != nil {
+					log.Printf("⚠️  Auto-tier usage query failed: %v", err)
+					matches = false
+					break
+				}
+				if (rule.Direction == "above" && usage < threshold) || (rule.Direction == "below" && usage > threshold) {
+					matches = false
+					break
+				}
+			}
+			if !matches {
+				continue
+			}
 
-	// Combine license key and hardware ID as the "password"
-	password := []byte(licenseKey + ":" + hardwareID)
-	saltBytes, _ := hex.DecodeString(salt)
+			if config.AutoTierDryRun {
+				log.Printf("🔁 Auto-tier (dry run): would move %s from %s to %s (usage %s %d%% for %d months)",
+					redact.PII(c.id), rule.From, rule.To, rule.Direction, rule.Percent, rule.Months)
+				moved[c.id] = true
+				continue
+			}
 
-	// If salt decode fails (legacy), use salt as-is
-	if len(saltBytes) == 0 {
-		saltBytes = []byte(salt)
-	}
+			limitChange, limitArgs := database.LimitChangeAssignments(sqlPlaceholder, 5, now)
+			args := append([]interface{}{rule.To, target.DailyLimit, target.MonthlyLimit, target.MaxDevices}, limitArgs...)
+			_, err := db.Exec(fmt.Sprintf(`
+				UPDATE licenses
+				SET tier = %s, daily_limit = %s, monthly_limit = %s, max_activations = %s, %s
+				WHERE license_id = %s AND tier = %s
+			`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4), strings.Join(limitChange, ", "), sqlPlaceholder(8), sqlPlaceholder(9)),
+				append(args, c.id, rule.From)...)
+			if err != nil {
+				log.Printf("⚠️  Auto-tier update failed for %s: %v", redact.PII(c.id), err)
+				continue
+			}
+			cachedLicenses.invalidate(c.id)
+			moved[c.id] = true
+			log.Printf("🔁 Auto-tier: moved %s from %s to %s", redact.PII(c.id), rule.From, rule.To)
+
+			sendWebhook(config.WebhookURL, config.WebhookSecret, "license.tier_changed", map[string]interface{}{
+				"license_key":     c.id,
+				"old_tier":        rule.From,
+				"new_tier":        rule.To,
+				"reason":          "auto_tier",
+				"daily_limit":     target.DailyLimit,
+				"monthly_limit":   target.MonthlyLimit,
+				"max_activations": target.MaxDevices,
+			})
 
-	return argon2.IDKey(password, saltBytes, time, memory, threads, keyLen)
+			if config.Mailer != nil && c.email != "" {
+				if err := config.Mailer.SendTierChange(c.email, c.id, target.Name, target.DailyLimit, target.MonthlyLimit); err != nil {
+					log.Printf("⚠️  Failed to send tier change email to %s: %v", redact.Email(c.email), err)
+				}
+			}
+		}
+	}
 }
 
-// generateSalt creates a cryptographically secure random salt
-func generateSalt() (string, error) {
-	salt := make([]byte, 32) // 256-bit salt
-	if _, err := rand.Read(salt); err != nil {
-		return "", err
+// abs returns absolute value of an int64
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
 	}
-	return hex.EncodeToString(salt), nil
+	return n
 }
 
-func sendError(w http.ResponseWriter, message string, code int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(ErrorResponse{
-		Success: false,
-		Error:   message,
-	})
-}
+const (
+	// featureAPIAnalytics unlocks the X-RateLimit-Tokens-Used proxy header
+	featureAPIAnalytics = "api_analytics"
 
-func generateVerificationCode() (string, error) {
-	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
-	if err != nil {
-		return "", err
-	}
-	return fmt.Sprintf("%06d", n.Int64()), nil
+	// serverWriteTimeout is the API server's write timeout. Proxied
+	// requests extend it to their upstream timeout plus this much, to
+	// leave time for sending the response or a 504.
+	serverWriteTimeout = 15 * time.Second
+)
+
+// circuitBreaker stops sending requests to a provider after threshold
+// consecutive failed requests. Once cooldown has passed, one request is let
+// through to probe the provider: success closes the breaker, failure keeps it
+// open for another cooldown. A nil breaker never trips.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	providers map[string]*breakerState
 }
 
-func generateLicenseKey() string {
-	timestamp := time.Now().Format("200601")
-	part1 := randomString(6)
-	part2 := randomString(6)
-	return fmt.Sprintf("LIC-%s-%s-%s", timestamp, part1, part2)
+type breakerState struct {
+	failures  int       // consecutive failed requests
+	openUntil time.Time // no requests before this while failures >= threshold
 }
 
-func randomString(length int) string {
-	const charset = "ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	result := make([]byte, length)
-	for i := range result {
-		n, _ := rand.Int(rand.Reader, big.NewInt(int64(len(charset))))
-		result[i] = charset[n.Int64()]
+// newCircuitBreaker returns a breaker, or nil when threshold is 0
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	if threshold == 0 {
+		return nil
 	}
-	return string(result)
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, providers: make(map[string]*breakerState)}
 }
 
-func sendVerificationEmail(apiKey, fromEmail, toEmail, code string) error {
-	html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <style>
-        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; }
-        .container { max-width: 600px; margin: 0 auto; padding: 40px 20px; }
-        .code { 
-            font-size: 32px; 
-            font-weight: bold; 
-            letter-spacing: 8px; 
-            text-align: center;
-            background: #f5f5f5;
-            padding: 20px;
-            border-radius: 8px;
-            margin: 30px 0;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>🧾 Verify Your Email</h1>
-        <p>Your verification code is:</p>
-        <div class="code">%s</div>
-        <p>Run: <code>licensify init --email=%s --verify=%s</code></p>
-        <p><strong>Free Tier: 10 scans/day</strong></p>
-    </div>
-</body>
-</html>
-`, code, toEmail, code)
+// allow reports whether a request to provider may be sent, and if not, how
+// long until the breaker lets a probe through
+func (b *circuitBreaker) allow(provider string) (time.Duration, bool) {
+	if b == nil {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	return sendResendEmail(apiKey, fromEmail, toEmail, "Verify Your Email - Licensify", html)
+	state := b.providers[provider]
+	if state == nil || state.failures < b.threshold {
+		return 0, true
+	}
+	now := time.Now()
+	if now.Before(state.openUntil) {
+		return state.openUntil.Sub(now), false
+	}
+	// Half-open: this request probes the provider while the others keep
+	// failing fast until it has an answer
+	state.openUntil = now.Add(b.cooldown)
+	log.Printf("🔌 Circuit breaker for %s half-open, probing the provider", provider)
+	return 0, true
 }
 
-func sendLicenseEmail(apiKey, fromEmail, toEmail, licenseKey, tier string, dailyLimit int) error {
-	html := fmt.Sprintf(`
-<!DOCTYPE html>
-<html>
-<head>
-    <style>
-        body { font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, sans-serif; }
-        .container { max-width: 600px; margin: 0 auto; padding: 40px 20px; }
-        .license-key {
-            font-size: 18px;
-            font-weight: bold;
-            font-family: monospace;
-            background: #f0f9ff;
-            padding: 20px;
-            border-radius: 8px;
-            margin: 20px 0;
-        }
-    </style>
-</head>
-<body>
-    <div class="container">
-        <h1>🎉 Your Licensify License</h1>
-        <p>Your license key:</p>
-        <div class="license-key">%s</div>
-        <p><strong>Tier:</strong> %s | <strong>Daily Limit:</strong> %d scans</p>
-        <p>Quick start: <code>licensify activate %s</code></p>
-    </div>
-</body>
-</html>
-`, licenseKey, strings.ToUpper(tier), dailyLimit, licenseKey)
+// record updates provider's breaker with the outcome of a request
+func (b *circuitBreaker) record(provider string, failed bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := b.providers[provider]
+	if state == nil {
+		state = &breakerState{}
+		b.providers[provider] = state
+		proxyCircuitOpen.Set(0, provider)
+	}
+	if !failed {
+		if state.failures >= b.threshold {
+			log.Printf("🔌 Circuit breaker for %s closed, provider recovered", provider)
+			proxyCircuitOpen.Set(0, provider)
+		}
+		state.failures = 0
+		return
+	}
 
-	return sendResendEmail(apiKey, fromEmail, toEmail, "Your Licensify License Key", html)
+	state.failures++
+	if state.failures < b.threshold {
+		return
+	}
+	state.openUntil = time.Now().Add(b.cooldown)
+	if state.failures == b.threshold {
+		log.Printf("🔌 Circuit breaker for %s open after %d consecutive failures, failing fast for %v", provider, state.failures, b.cooldown)
+		proxyCircuitOpen.Set(1, provider)
+	}
 }
 
-func sendResendEmail(apiKey, fromEmail, toEmail, subject, html string) error {
-	payload := map[string]interface{}{
-		"from":    fromEmail,
-		"to":      []string{toEmail},
-		"subject": subject,
-		"html":    html,
-	}
+// proxyUpstream sends proxied requests to the providers, retrying brief
+// failures and failing fast while a provider's circuit breaker is open
+type proxyUpstream struct {
+	retries int
+	backoff time.Duration // before the first retry, doubled after each
+	breaker *circuitBreaker
 
-	jsonData, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", "https://api.resend.com/emails", strings.NewReader(string(jsonData)))
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-	req.Header.Set("Content-Type", "application/json")
+	timeout       time.Duration // for buffered requests to providers without their own
+	streamTimeout time.Duration // 0 means no limit
+}
 
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+// timeoutFor returns how long a request to provider may take, retries
+// included. Streaming responses stay open while the model generates, so
+// they have their own, usually longer, limit. 0 means no limit.
+func (u *proxyUpstream) timeoutFor(provider *providers.Provider, stream bool) time.Duration {
+	if stream {
+		return u.streamTimeout
 	}
-	defer func() { _ = resp.Body.Close() }()
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("resend API error: %s", body)
+	if provider.Timeout > 0 {
+		return provider.Timeout
 	}
-
-	return nil
+	return u.timeout
 }
 
-// sendWebhook sends event data to configured webhook URL (e.g., Zapier)
-func sendWebhook(webhookURL, webhookSecret, event string, data map[string]interface{}) {
-	if webhookURL == "" {
-		return // Webhooks not configured
-	}
+// do sends body to apiURL. Connection failures and 502/503/504 are retried
+// with backoff while ctx allows; the provider never saw a request that
+// failed to connect, and these statuses mean it didn't handle the request.
+// The final outcome is recorded in the circuit breaker.
+func (u *proxyUpstream) do(ctx context.Context, r *http.Request, provider, apiURL string, headers map[string]string, body []byte) (*http.Response, error) {
+	backoff := u.backoff
+	for attempt := 0; ; attempt++ {
+		resp, err := sendUpstream(ctx, apiURL, headers, body)
+		if attempt >= u.retries || !retryableUpstream(resp, err) {
+			u.recordOutcome(r, provider, resp, err)
+			return resp, err
+		}
 
-	// Add event type and timestamp
-	payload := map[string]interface{}{
-		"event":     event,
-		"timestamp": time.Now().Unix(),
-		"data":      data,
+		reason := "connection failure"
+		if resp != nil {
+			reason = resp.Status
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			_ = resp.Body.Close()
+		}
+		proxyRetriesTotal.Inc(provider)
+		requestLogger(r).Warn("Retrying upstream request", "provider", provider, "backoff", backoff, "reason", reason,
+			"attempt", attempt+2, "max_attempts", u.retries+1)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			u.recordOutcome(r, provider, nil, ctx.Err())
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// recordOutcome counts connection failures, timeouts and 502/503/504 against
+// the provider. Requests the client abandoned say nothing about it.
+func (u *proxyUpstream) recordOutcome(r *http.Request, provider string, resp *http.Response, err error) {
+	if err != nil && r.Context().Err() != nil {
+		return
 	}
+	u.breaker.record(provider, err != nil || isUpstreamUnavailable(resp.StatusCode))
+}
 
-	jsonData, err := json.Marshal(payload)
+// sendUpstream makes one request to the provider
+func sendUpstream(ctx context.Context, apiURL string, headers map[string]string, body []byte) (*http.Response, error) {
+	proxyReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewReader(body))
 	if err != nil {
-		log.Printf("Failed to marshal webhook payload: %v", err)
-		return
+		return nil, err
+	}
+	for key, value := range headers {
+		proxyReq.Header.Set(key, value)
 	}
+	// ctx carries the timeout for the whole proxied request, retries included
+	return http.DefaultClient.Do(proxyReq)
+}
 
-	// Create request
-	req, err := http.NewRequest("POST", webhookURL, bytes.NewReader(jsonData))
+// retryableUpstream reports whether a failed upstream attempt is safe to
+// repeat: the connection was never made, or the provider answered 502/503/504
+func retryableUpstream(resp *http.Response, err error) bool {
 	if err != nil {
-		log.Printf("Failed to create webhook request: %v", err)
-		return
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
 	}
+	return isUpstreamUnavailable(resp.StatusCode)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("User-Agent", fmt.Sprintf("Licensify/%s", Version))
+func isUpstreamUnavailable(status int) bool {
+	return status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+}
 
-	// Add HMAC signature if secret is configured
-	if webhookSecret != "" {
-		mac := hmac.New(sha256.New, []byte(webhookSecret))
-		mac.Write(jsonData)
-		signature := hex.EncodeToString(mac.Sum(nil))
-		req.Header.Set("X-Webhook-Signature", signature)
+// isStreamingRequest reports whether a provider request body asks for a
+// streamed (server-sent events) response with "stream": true
+func isStreamingRequest(body []byte) bool {
+	var params struct {
+		Stream bool `json:"stream"`
 	}
+	return json.Unmarshal(body, &params) == nil && params.Stream
+}
 
-	// Send async (don't block main flow)
-	go func() {
-		client := &http.Client{Timeout: 10 * time.Second}
-		resp, err := client.Do(req)
+// truncation is why a proxied response was cut short
+type truncation string
 
-		var statusCode int
-		var errorMsg string
+const (
+	truncationUpstreamDropped    truncation = "upstream connection dropped"
+	truncationUpstreamTimeout    truncation = "upstream timeout"
+	truncationClientDisconnected truncation = "client disconnected"
+)
 
-		if err != nil {
-			log.Printf("Webhook delivery failed (%s): %v", event, err)
-			errorMsg = err.Error()
-		} else {
-			defer func() { _ = resp.Body.Close() }()
-			statusCode = resp.StatusCode
+// truncationReason works out why copying a response failed from the client's
+// request context and the upstream call's context
+func truncationReason(client, upstream context.Context) truncation {
+	switch {
+	case client.Err() != nil:
+		return truncationClientDisconnected
+	case upstream.Err() == context.DeadlineExceeded:
+		return truncationUpstreamTimeout
+	default:
+		return truncationUpstreamDropped
+	}
+}
 
-			if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-				body, _ := io.ReadAll(resp.Body)
-				errorMsg = string(body)
-				log.Printf("Webhook returned error (%s): %d - %s", event, resp.StatusCode, body)
-			} else {
-				log.Printf("Webhook delivered successfully: %s", event)
+// billable reports whether a response cut short for this reason is still
+// billed. A client that disconnects is: the provider call was already paid
+// for.
+func (t truncation) billable() bool {
+	return t == truncationClientDisconnected
+}
+
+// streamResponse copies an upstream body to the client, flushing after every
+// chunk so server-sent events arrive as the provider produces them
+func streamResponse(w http.ResponseWriter, body io.Reader) (int64, error) {
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	var written int64
+	for {
+		n, readErr := body.Read(buf)
+		if n > 0 {
+			m, err := w.Write(buf[:n])
+			written += int64(m)
+			if err != nil {
+				return written, err
+			}
+			if flusher != nil {
+				flusher.Flush()
 			}
 		}
-
-		// Log to database
-		_, err = db.Exec(fmt.Sprintf(`
-		INSERT INTO webhook_logs (event, payload, status_code, error)
-		VALUES (%s, %s, %s, %s)
-	`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4)),
-			event, string(jsonData), statusCode, errorMsg)
-		if err != nil {
-			log.Printf("Failed to log webhook to database: %v", err)
+		if readErr == io.EOF {
+			return written, nil
 		}
-	}()
+		if readErr != nil {
+			return written, readErr
+		}
+	}
 }
 
-// ProxyRequest handles proxying to external APIs
-type ProxyRequest struct {
-	ProxyKey  string          `json:"proxy_key"` // Generated proxy key from activation
-	Provider  string          `json:"provider"`  // "openai" or "anthropic"
-	Body      json.RawMessage `json:"body"`      // Original API request body
-	Signature string          `json:"signature"` // HMAC-SHA256 signature for request authentication
-	Timestamp int64           `json:"timestamp"` // Unix timestamp to prevent replay attacks
-}
-
-// validateProxySignature validates the HMAC-SHA256 signature on a proxy request
-// Signature is computed as: HMAC-SHA256(proxy_key, timestamp + provider + body)
-func validateProxySignature(proxyKey, provider string, body []byte, timestamp int64, signature string) bool {
-	// Check timestamp (must be within 5 minutes)
-	now := time.Now().Unix()
-	if abs(now-timestamp) > 300 { // 5 minutes
-		return false
-	}
+// maxTokenScanBytes caps how much of a buffered JSON response, or of one
+// event-stream line, is kept in memory to find the provider's token usage
+const maxTokenScanBytes = 4 << 20
+
+// tokenCounter finds the token usage a provider reports in a proxied response
+// as the body is copied to the client. It understands OpenAI ("usage" with
+// total_tokens), Anthropic ("usage" or "message.usage" with input_tokens and
+// output_tokens) and Gemini ("usageMetadata.totalTokenCount"), both in JSON
+// bodies and in server-sent events, where the counts are cumulative.
+type tokenCounter struct {
+	stream   bool
+	pending  []byte
+	overflow bool
+
+	input, output, total int64
+}
 
-	// Construct message: timestamp + provider + body
-	message := fmt.Sprintf("%d%s%s", timestamp, provider, string(body))
+type providerUsage struct {
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	TotalTokens  int64 `json:"total_tokens"`
+}
 
-	// Compute HMAC-SHA256
-	h := hmac.New(sha256.New, []byte(proxyKey))
-	h.Write([]byte(message))
-	expectedSignature := hex.EncodeToString(h.Sum(nil))
+type providerResponse struct {
+	Usage   *providerUsage `json:"usage"`
+	Message *struct {
+		Usage *providerUsage `json:"usage"`
+	} `json:"message"` // Anthropic message_start event
+	UsageMetadata *struct {
+		TotalTokenCount int64 `json:"totalTokenCount"`
+	} `json:"usageMetadata"` // Gemini
+}
 
-	// Constant-time comparison to prevent timing attacks
-	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+func (c *tokenCounter) Write(p []byte) (int, error) {
+	if c.overflow {
+		return len(p), nil
+	}
+	c.pending = append(c.pending, p...)
+	if c.stream {
+		for {
+			i := bytes.IndexByte(c.pending, '\n')
+			if i < 0 {
+				break
+			}
+			c.scanEvent(c.pending[:i])
+			c.pending = c.pending[i+1:]
+		}
+	}
+	if len(c.pending) > maxTokenScanBytes {
+		c.pending = nil
+		c.overflow = true
+	}
+	return len(p), nil
 }
 
-// abs returns absolute value of an int64
-func abs(n int64) int64 {
-	if n < 0 {
-		return -n
+// scanEvent reads the usage from one "data:" line of an event stream
+func (c *tokenCounter) scanEvent(line []byte) {
+	data, ok := bytes.CutPrefix(bytes.TrimSpace(line), []byte("data:"))
+	if !ok {
+		return
 	}
-	return n
+	var resp providerResponse
+	if json.Unmarshal(bytes.TrimSpace(data), &resp) == nil {
+		c.observe(resp)
+	}
+}
+
+func (c *tokenCounter) observe(resp providerResponse) {
+	usages := []*providerUsage{resp.Usage}
+	if resp.Message != nil {
+		usages = append(usages, resp.Message.Usage)
+	}
+	for _, u := range usages {
+		if u == nil {
+			continue
+		}
+		c.input = max(c.input, u.InputTokens)
+		c.output = max(c.output, u.OutputTokens)
+		c.total = max(c.total, u.TotalTokens)
+	}
+	if resp.UsageMetadata != nil {
+		c.total = max(c.total, resp.UsageMetadata.TotalTokenCount)
+	}
+}
+
+// tokens returns the total tokens found once the whole body has been written
+func (c *tokenCounter) tokens() int64 {
+	if c.stream {
+		c.scanEvent(c.pending)
+	} else if !c.overflow {
+		var resp providerResponse
+		var chunks []providerResponse // Gemini streamGenerateContent without alt=sse
+		if json.Unmarshal(c.pending, &resp) == nil {
+			c.observe(resp)
+		} else if json.Unmarshal(c.pending, &chunks) == nil {
+			for _, chunk := range chunks {
+				c.observe(chunk)
+			}
+		}
+	}
+	c.pending = nil
+
+	if c.total > 0 {
+		return c.total
+	}
+	return c.input + c.output
 }
 
-// handleProxy forwards requests to external APIs while validating license and rate limits
-func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
+func handleProxy(registry *providers.Registry, alerts *usageAlerts, countTokens, auditRequests, strictUsage bool, revocations *revocationCache, upstream *proxyUpstream, signatures *proxySignatures) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			sendError(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -1640,6 +5255,7 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 			sendError(w, "Invalid request body", http.StatusBadRequest)
 			return
 		}
+		logger := requestLogger(r).With("provider", req.Provider)
 
 		// Validate proxy key format
 		if !strings.HasPrefix(req.ProxyKey, "px_") {
@@ -1647,44 +5263,64 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 			return
 		}
 
-		// Validate HMAC signature
-		if !validateProxySignature(req.ProxyKey, req.Provider, req.Body, req.Timestamp, req.Signature) {
-			log.Printf("Invalid proxy signature for key: %s...", redactPII(req.ProxyKey[:10]))
-			sendError(w, "Invalid signature or expired timestamp", http.StatusUnauthorized)
+		// The signature covers the path, so it must name the same provider
+		if rest, ok := strings.CutPrefix(r.URL.Path, "/proxy/"+req.Provider); !ok || (rest != "" && rest[0] != '/') {
+			sendError(w, "Provider does not match the request path", http.StatusBadRequest)
 			return
 		}
 
 		// Validate proxy key and get license info
-		licenseKey, hardwareID, err := validateProxyKey(req.ProxyKey)
+		licenseKey, hardwareID, err := validateProxyKey(r.Context(), req.ProxyKey)
 		if err != nil {
 			if err == sql.ErrNoRows {
-				log.Printf("Proxy key not found: %s...", req.ProxyKey[:10])
+				logger.Warn("Proxy key not found", "proxy_key_id", proxyKeyID(req.ProxyKey))
 				sendError(w, "Unauthorized", http.StatusUnauthorized)
+			} else if errors.Is(err, ErrProxyKeyExpired) {
+				logger.Warn("Expired proxy key", "proxy_key_id", proxyKeyID(req.ProxyKey))
+				sendError(w, "Proxy key expired, activate the license again to get a new one", http.StatusUnauthorized)
 			} else {
-				log.Printf("Database error validating proxy key: %v", err)
+				logger.Error("Database error validating proxy key", "error", err)
 				sendError(w, "Internal server error", http.StatusInternalServerError)
 			}
 			return
 		}
+		logger = logger.With("license", redact.PII(licenseKey))
+
+		// Validate HMAC signature. Only issued keys get this far, so made-up
+		// keys can't fill the replay cache.
+		if err := signatures.validateProxySignature(r, &req); err != nil {
+			logger.Warn("Rejected proxy request", "proxy_key_id", proxyKeyID(req.ProxyKey), "error", err)
+			sendSignatureError(w, err)
+			return
+		}
+		if revocations.isRevoked(licenseKey) {
+			logger.Warn("🚫 Proxy request for revoked license")
+			sendLicenseError(w, ErrLicenseRevoked)
+			return
+		}
 
 		// Check if license exists and is active
 		var licenseID, tier, expiresAtStr string
 		var dailyLimit, monthlyLimit int64
+		var prevDailyLimit, prevMonthlyLimit sql.NullInt64
+		var limitsChangedOn sql.NullString
 
 		if isPostgresDB {
 			// PostgreSQL: use EXTRACT(EPOCH FROM expires_at)
 			var expiresAtUnix int64
-			err := db.QueryRow(fmt.Sprintf(`
-				SELECT license_id, tier, daily_limit, monthly_limit, EXTRACT(EPOCH FROM expires_at)::bigint
+			err := db.QueryRowContext(r.Context(), fmt.Sprintf(`
+				SELECT license_id, tier, daily_limit, monthly_limit, EXTRACT(EPOCH FROM expires_at)::bigint,
+				       previous_daily_limit, previous_monthly_limit, limits_changed_on
 				FROM licenses 
 				WHERE license_id = %s AND active = true
-			`, sqlPlaceholder(1)), licenseKey).Scan(&licenseID, &tier, &dailyLimit, &monthlyLimit, &expiresAtUnix)
+			`, sqlPlaceholder(1)), licenseKey).Scan(&licenseID, &tier, &dailyLimit, &monthlyLimit, &expiresAtUnix,
+				&prevDailyLimit, &prevMonthlyLimit, &limitsChangedOn)
 
 			if err == sql.ErrNoRows {
 				sendError(w, "License not found or inactive", http.StatusUnauthorized)
 				return
 			} else if err != nil {
-				log.Printf("Database error: %v", err)
+				logger.Error("Database error loading license", "error", err)
 				sendError(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
@@ -1692,17 +5328,19 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 			expiresAtStr = time.Unix(expiresAtUnix, 0).Format(time.RFC3339)
 		} else {
 			// SQLite: expires_at is stored as TEXT in RFC3339 format
-			err := db.QueryRow(fmt.Sprintf(`
-				SELECT license_id, tier, daily_limit, monthly_limit, expires_at
+			err := db.QueryRowContext(r.Context(), fmt.Sprintf(`
+				SELECT license_id, tier, daily_limit, monthly_limit, expires_at,
+				       previous_daily_limit, previous_monthly_limit, limits_changed_on
 				FROM licenses 
 				WHERE license_id = %s AND active = true
-			`, sqlPlaceholder(1)), licenseKey).Scan(&licenseID, &tier, &dailyLimit, &monthlyLimit, &expiresAtStr)
+			`, sqlPlaceholder(1)), licenseKey).Scan(&licenseID, &tier, &dailyLimit, &monthlyLimit, &expiresAtStr,
+				&prevDailyLimit, &prevMonthlyLimit, &limitsChangedOn)
 
 			if err == sql.ErrNoRows {
 				sendError(w, "License not found or inactive", http.StatusUnauthorized)
 				return
 			} else if err != nil {
-				log.Printf("Database error: %v", err)
+				logger.Error("Database error loading license", "error", err)
 				sendError(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
@@ -1711,7 +5349,7 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 		// Parse expiration time
 		expiresAt, err := time.Parse(time.RFC3339, expiresAtStr)
 		if err != nil {
-			log.Printf("Failed to parse expiration time: %v", err)
+			logger.Error("Failed to parse expiration time", "error", err)
 			sendError(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -1722,13 +5360,13 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 
 		// Verify hardware ID is activated
 		var count int
-		err = db.QueryRow(fmt.Sprintf(`
+		err = db.QueryRowContext(r.Context(), fmt.Sprintf(`
 			SELECT COUNT(*) FROM activations 
 			WHERE license_id = %s AND hardware_id = %s
 		`, sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID).Scan(&count)
 
 		if err != nil {
-			log.Printf("Database error: %v", err)
+			logger.Error("Database error checking activation", "error", err)
 			sendError(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
@@ -1738,22 +5376,44 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 			return
 		}
 
+		// Per-license request rate, shared by every device and IP using the license
+		if !licenseLimiters.allow(licenseID) {
+			rateLimitRejectionsTotal.Inc("license")
+			logger.Warn("License rate limit exceeded")
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message": "Too many requests for this license",
+					"type":    "rate_limit_exceeded",
+					"code":    "license_rate_limited",
+				},
+			})
+			return
+		}
+
 		// Check rate limits
 		today := time.Now().Format("2006-01-02")
+		thisMonth := time.Now().Format("2006-01")
+
+		// A limit reduced during the current window only takes effect from the next reset
+		dailyLimit = effectiveLimit(dailyLimit, prevDailyLimit, limitsChangedOn, today)
+		monthlyLimit = effectiveLimit(monthlyLimit, prevMonthlyLimit, limitsChangedOn, thisMonth)
 		var currentUsage int
-		err = db.QueryRow(fmt.Sprintf(`
+		err = db.QueryRowContext(r.Context(), fmt.Sprintf(`
 			SELECT scans FROM daily_usage 
 			WHERE license_id = %s AND date = %s AND hardware_id = %s
 		`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3)), licenseID, today, hardwareID).Scan(&currentUsage)
 
 		if err != nil && err != sql.ErrNoRows {
-			log.Printf("Database error checking usage: %v", err)
+			logger.Error("Database error checking usage", "error", err)
 			sendError(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		// Check if limit exceeded
-		if currentUsage >= int(dailyLimit) {
+		// Check if limit exceeded (-1 means unlimited)
+		if dailyLimit != -1 && currentUsage >= int(dailyLimit) {
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusTooManyRequests)
 			_ = json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1768,15 +5428,14 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 
 		// Check monthly limit (if not unlimited -1)
 		if monthlyLimit > 0 {
-			thisMonth := time.Now().Format("2006-01")
 			var monthlyUsage int
-			err = db.QueryRow(fmt.Sprintf(`
+			err = db.QueryRowContext(r.Context(), fmt.Sprintf(`
 				SELECT COALESCE(SUM(scans), 0) FROM daily_usage
 				WHERE license_id = %s AND hardware_id = %s AND date LIKE %s
 			`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3)), licenseID, hardwareID, thisMonth+"%").Scan(&monthlyUsage)
 
 			if err != nil {
-				log.Printf("Database error checking monthly usage: %v", err)
+				logger.Error("Database error checking monthly usage", "error", err)
 				sendError(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
@@ -1796,103 +5455,152 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 		}
 
 		// Determine API endpoint and key
-		var apiURL, apiKey string
-		var headers map[string]string
-
-		switch req.Provider {
-		case "openai":
-			if openaiKey == "" {
-				sendError(w, "OpenAI API key not configured", http.StatusServiceUnavailable)
-				return
-			}
-			// Extract path from request
-			path := strings.TrimPrefix(r.URL.Path, "/proxy/openai")
-			if path == "" || path == "/" {
-				path = "/v1/chat/completions" // Default endpoint
-			}
-			apiURL = "https://api.openai.com" + path
-			apiKey = openaiKey
-			headers = map[string]string{
-				"Authorization": "Bearer " + apiKey,
-				"Content-Type":  "application/json",
-			}
-
-		case "anthropic":
-			if anthropicKey == "" {
-				sendError(w, "Anthropic API key not configured", http.StatusServiceUnavailable)
+		provider := registry.Get(req.Provider)
+		if provider == nil {
+			if builtin := providers.Builtin(req.Provider); builtin != nil {
+				sendError(w, builtin.DisplayName+" API key not configured", http.StatusServiceUnavailable)
 				return
 			}
-			path := strings.TrimPrefix(r.URL.Path, "/proxy/anthropic")
-			if path == "" || path == "/" {
-				path = "/v1/messages" // Default endpoint
-			}
-			apiURL = "https://api.anthropic.com" + path
-			apiKey = anthropicKey
-			headers = map[string]string{
-				"x-api-key":         apiKey,
-				"anthropic-version": "2023-06-01",
-				"Content-Type":      "application/json",
+			sendError(w, "Unsupported provider. Supported: "+strings.Join(registry.Names(), ", "), http.StatusBadRequest)
+			return
+		}
+		// Tiers can be limited to some providers, e.g. to keep cheap tiers
+		// off expensive models
+		if allowed, err := tierRegistry.TierAllowsProvider(tier, req.Provider); !allowed {
+			if err != nil {
+				logger.Error("Failed to check providers of tier", "tier", tier, "error", err)
 			}
+			proxyRequestsTotal.Inc(req.Provider, "forbidden")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"error": map[string]interface{}{
+					"message": fmt.Sprintf("Your plan does not include the %s provider", provider.DisplayName),
+					"type":    "permission_denied",
+					"code":    "provider_not_allowed",
+				},
+			})
+			return
+		}
 
-		default:
-			sendError(w, "Unsupported provider. Supported: openai, anthropic", http.StatusBadRequest)
+		apiURL, err := provider.URL(strings.TrimPrefix(r.URL.Path, "/proxy/"+req.Provider))
+		if err != nil {
+			logger.Warn("Rejected proxy path", "path", r.URL.Path, "error", err)
+			sendError(w, "Invalid provider path", http.StatusBadRequest)
 			return
 		}
+		headers := provider.RequestHeaders()
 
 		// Validate request body size (max 1MB)
-		if len(req.Body) > 1024*1024 {
+		if len(req.Body) > maxProxyBodySize {
 			sendError(w, "Request body too large", http.StatusRequestEntityTooLarge)
 			return
 		}
 
-		// Create context with timeout
-		ctx, cancel := context.WithTimeout(r.Context(), 60*time.Second)
+		if wait, ok := upstream.breaker.allow(req.Provider); !ok {
+			proxyRequestsTotal.Inc(req.Provider, "circuit_open")
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			sendError(w, "Provider temporarily unavailable, try again later", http.StatusServiceUnavailable)
+			return
+		}
+
+		// In strict mode the request is counted before the provider is paid
+		// for it, and refused if it can't be. Failed and truncated responses
+		// are refunded below.
+		if strictUsage {
+			if err := store.RecordUsageContext(r.Context(), licenseID, today, hardwareID, 1); err != nil {
+				logger.Error("Failed to update usage, refusing request", "error", err)
+				proxyRequestsTotal.Inc(req.Provider, "usage_error")
+				sendError(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+				return
+			}
+		}
+		refundUsage := func() {
+			if !strictUsage {
+				return
+			}
+			if err := store.RecordUsage(licenseID, today, hardwareID, -1); err != nil {
+				logger.Error("Failed to refund usage", "error", err)
+			}
+		}
+
+		// Create context with the provider's timeout
+		stream := isStreamingRequest(req.Body)
+		timeout := upstream.timeoutFor(provider, stream)
+		var ctx context.Context
+		var cancel context.CancelFunc
+		var writeDeadline time.Time // zero clears the server's write timeout
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(r.Context(), timeout)
+			writeDeadline = time.Now().Add(timeout + serverWriteTimeout)
+		} else {
+			ctx, cancel = context.WithCancel(r.Context())
+		}
 		defer cancel()
 
+		// The server's write timeout would cut slow completions and long
+		// streams short, so extend it to match
+		if err := http.NewResponseController(w).SetWriteDeadline(writeDeadline); err != nil {
+			logger.Warn("Failed to extend write deadline for proxied response", "error", err)
+		}
+
 		// Forward request to actual API
-		proxyReq, err := http.NewRequestWithContext(ctx, "POST", apiURL, strings.NewReader(string(req.Body)))
+		upstreamStart := time.Now()
+		resp, err := upstream.do(ctx, r, req.Provider, apiURL, headers, req.Body)
+		upstreamLatency := time.Since(upstreamStart)
+
+		// Audit records are written in the background so they never delay
+		// the response
+		auditRequest := func(status int, responseBytes int64) {
+			if !auditRequests {
+				return
+			}
+			entry := database.ProxyRequest{
+				LicenseID:     licenseID,
+				HardwareID:    hardwareID,
+				Provider:      req.Provider,
+				Nonce:         req.Nonce,
+				StatusCode:    status,
+				RequestBytes:  int64(len(req.Body)),
+				ResponseBytes: responseBytes,
+				Duration:      time.Since(upstreamStart),
+			}
+			go func() {
+				if err := store.RecordProxyRequest(entry); err != nil {
+					logger.Error("Failed to record proxy request", "error", err)
+				}
+			}()
+		}
 		if err != nil {
-			log.Printf("Failed to create proxy request: %v", err)
-			sendError(w, "Internal server error", http.StatusInternalServerError)
-			return
+			proxyRequestsTotal.Inc(req.Provider, "error")
+		} else {
+			proxyRequestsTotal.Inc(req.Provider, strconv.Itoa(resp.StatusCode))
 		}
 
-		// Set headers
-		for key, value := range headers {
-			proxyReq.Header.Set(key, value)
-		}
+		// Let clients tell proxy overhead apart from upstream latency
+		w.Header().Set("X-Provider", req.Provider)
+		w.Header().Set("X-Upstream-Latency-Ms", strconv.FormatInt(upstreamLatency.Milliseconds(), 10))
 
-		// Execute request with timeout
-		client := &http.Client{Timeout: 60 * time.Second}
-		resp, err := client.Do(proxyReq)
 		if err != nil {
 			if ctx.Err() == context.DeadlineExceeded {
-				log.Printf("Proxy request timeout: %v", err)
+				logger.Warn("Proxy request timeout", "error", err)
 				sendError(w, "Request timeout", http.StatusGatewayTimeout)
+				auditRequest(http.StatusGatewayTimeout, 0)
 			} else {
-				log.Printf("Failed to execute proxy request: %v", err)
+				logger.Error("Failed to execute proxy request", "error", err)
 				sendError(w, "Service temporarily unavailable", http.StatusServiceUnavailable)
+				auditRequest(http.StatusServiceUnavailable, 0)
 			}
+			refundUsage()
 			return
 		}
 		defer func() { _ = resp.Body.Close() }()
 
-		// Increment usage counter for all responses (prevents retry abuse)
-		// Count all API calls regardless of status code since they consume provider quota
-		_, err = db.Exec(fmt.Sprintf(`
-			INSERT INTO daily_usage (license_id, date, scans, hardware_id)
-			VALUES (%s, %s, 1, %s)
-			ON CONFLICT (license_id, date)
-			DO UPDATE SET scans = daily_usage.scans + 1
-		`, sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3)), licenseID, today, hardwareID)
-
-		if err != nil {
-			log.Printf("Failed to update usage: %v", err)
-			// Don't fail the request, just log the error
-		}
-
 		// Copy response headers
 		for key, values := range resp.Header {
+			if key == "X-Provider" || key == "X-Upstream-Latency-Ms" {
+				continue
+			}
 			for _, value := range values {
 				w.Header().Add(key, value)
 			}
@@ -1902,12 +5610,69 @@ func handleProxy(openaiKey, anthropicKey string) http.HandlerFunc {
 		w.Header().Set("X-RateLimit-Limit", fmt.Sprintf("%d", dailyLimit))
 		w.Header().Set("X-RateLimit-Remaining", fmt.Sprintf("%d", int(dailyLimit)-currentUsage-1))
 		w.Header().Set("X-RateLimit-Reset", time.Now().Add(24*time.Hour).Format(time.RFC3339))
+		// Usage analytics are a tier feature
+		if analytics, _ := tierRegistry.TierHasFeature(tier, featureAPIAnalytics); countTokens && analytics {
+			if dailyTokens, _, err := store.GetTokenUsageContext(r.Context(), licenseID, today); err == nil {
+				w.Header().Set("X-RateLimit-Tokens-Used", strconv.FormatInt(dailyTokens, 10))
+			}
+		}
+
+		// Copy the body through a token counter when token usage is recorded
+		isEventStream := stream || strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream")
+		var counter *tokenCounter
+		var body io.Reader = resp.Body
+		if countTokens {
+			counter = &tokenCounter{stream: isEventStream}
+			body = io.TeeReader(resp.Body, counter)
+		}
+
+		// Server-sent events are passed through unbuffered
+		var written int64
+		var copyErr error
+		if isEventStream {
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("X-Accel-Buffering", "no") // disable nginx response buffering
+			w.WriteHeader(resp.StatusCode)
+			written, copyErr = streamResponse(w, body)
+		} else {
+			w.WriteHeader(resp.StatusCode)
+			written, copyErr = io.Copy(w, body)
+		}
+		auditRequest(resp.StatusCode, written)
+		if copyErr != nil {
+			// The body was cut short, so the client never received a complete response.
+			// Log why, and skip billing when the provider side failed.
+			reason := truncationReason(r.Context(), ctx)
+			logger.Warn("⚠️  Truncated proxied response", "bytes", written, "reason", string(reason), "error", copyErr)
+			if !reason.billable() {
+				refundUsage()
+				return
+			}
+		}
+
+		// Increment usage counter for all completed responses (prevents retry abuse)
+		// Count all API calls regardless of status code since they consume provider quota.
+		// The provider has already been paid for, so this is not tied to the request context.
+		// Strict mode counted the request before forwarding it.
+		if strictUsage {
+			go alerts.check(licenseID, tier, int(dailyLimit), int(monthlyLimit), today)
+		} else if err := store.RecordUsage(licenseID, today, hardwareID, 1); err != nil {
+			logger.Error("Failed to update usage", "error", err)
+			// Don't fail the request, just log the error
+		} else {
+			go alerts.check(licenseID, tier, int(dailyLimit), int(monthlyLimit), today)
+		}
 
-		// Set status code and stream response body
-		w.WriteHeader(resp.StatusCode)
-		_, _ = io.Copy(w, resp.Body)
+		if counter != nil {
+			if tokens := counter.tokens(); tokens > 0 {
+				if err := store.AddTokenUsage(licenseID, today, tokens); err != nil {
+					logger.Error("Failed to update token usage", "error", err)
+				}
+			}
+		}
 
-		log.Printf("Proxied %s request for license %s (usage: %d/%d)", req.Provider, redactPII(licenseID), currentUsage+1, dailyLimit)
+		logger.Info("Proxied request", "status", resp.StatusCode, "usage", currentUsage+1, "daily_limit", dailyLimit,
+			"upstream_ms", upstreamLatency.Milliseconds())
 	}
 }
 
@@ -1935,6 +5700,52 @@ func basicAuthMiddleware(username, password string, next http.HandlerFunc) http.
 	}
 }
 
+// apiKeyMiddleware requires the admin API key, sent as
+// "Authorization: Bearer <key>" or "X-Admin-Key: <key>", for scripts and
+// billing integrations calling privileged endpoints
+func apiKeyMiddleware(apiKey string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey == "" {
+			http.Error(w, "Admin API key not configured. Set the ADMIN_API_KEY environment variable.", http.StatusServiceUnavailable)
+			return
+		}
+
+		// Compared in constant time so response timing doesn't reveal the key
+		key := apiKeyFromRequest(r)
+		if key == "" || !hmac.Equal([]byte(key), []byte(apiKey)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="Licensify Admin"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			log.Printf("⚠️  Failed admin API key attempt from %s", r.RemoteAddr)
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// adminAuthMiddleware accepts ADMIN_API_KEY from requests that send an API
+// key and otherwise falls back to the dashboard's Basic Authentication
+func adminAuthMiddleware(config *Config, next http.HandlerFunc) http.HandlerFunc {
+	withKey := apiKeyMiddleware(config.AdminAPIKey, next)
+	withPassword := basicAuthMiddleware(config.AdminUsername, config.AdminPassword, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if config.AdminAPIKey != "" && apiKeyFromRequest(r) != "" {
+			withKey(w, r)
+			return
+		}
+		withPassword(w, r)
+	}
+}
+
+// apiKeyFromRequest returns the API key from a Bearer Authorization header
+// or X-Admin-Key, or "" if the request has neither
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); len(auth) > len("Bearer ") && strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(auth[len("Bearer "):])
+	}
+	return r.Header.Get("X-Admin-Key")
+}
+
 // handleAdmin serves a simple admin dashboard
 func handleAdmin() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -1944,7 +5755,7 @@ func handleAdmin() http.HandlerFunc {
 		}
 
 		// Get licenses
-		licenses, err := db.Query(`
+		licenses, err := db.QueryContext(r.Context(), `
 			SELECT license_id, customer_email, tier, expires_at, active, daily_limit, monthly_limit, max_activations, created_at
 			FROM licenses 
 			ORDER BY created_at DESC 
@@ -1993,7 +5804,7 @@ func handleAdmin() http.HandlerFunc {
 		}
 
 		// Get activations
-		activations, err := db.Query(`
+		activations, err := db.QueryContext(r.Context(), `
 			SELECT a.license_id, a.hardware_id, a.activated_at, l.customer_email, l.tier
 			FROM activations a
 			JOIN licenses l ON a.license_id = l.license_id
@@ -2028,7 +5839,7 @@ func handleAdmin() http.HandlerFunc {
 		}
 
 		// Get webhook logs
-		webhookLogs, err := db.Query(`
+		webhookLogs, err := db.QueryContext(r.Context(), `
 			SELECT event, payload, status_code, error, created_at
 			FROM webhook_logs
 			ORDER BY created_at DESC
@@ -2353,58 +6164,189 @@ func main() {
 	// Load .env file (ignore error if doesn't exist)
 	_ = godotenv.Load()
 
+	// Pick the log format first so every later line uses it
+	if err := logging.Setup(getEnv("LOG_FORMAT", logging.FormatText), os.Stderr); err != nil {
+		log.Fatalf("❌ Configuration error: LOG_FORMAT %v", err)
+	}
+
+	// Select secret backend before any secrets are read
+	if err := secrets.Init(getEnv("SECRET_BACKEND", "env")); err != nil {
+		log.Fatalf("❌ Configuration error: %v", err)
+	}
+
 	// Load configuration
-	config := loadConfig()
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatalf("❌ Configuration error:\n%v\n\nPlease check your environment variables and try again.", err)
+	}
 
 	// Validate configuration before proceeding
 	if err := validateConfig(config); err != nil {
 		log.Fatalf("❌ Configuration error:\n%v\n\nPlease check your environment variables and try again.", err)
 	}
+	logConfig(config)
 
 	// Load tier configuration
-	if err := tiers.LoadWithFallback(config.TiersConfigPath); err != nil {
+	tierRegistry = tiers.NewRegistry()
+	if err := tierRegistry.LoadWithFallback(config.TiersConfigPath); err != nil {
 		log.Fatalf("Failed to load tier configuration: %v", err)
 	}
-	log.Printf("📋 Loaded tiers: %v", tiers.List())
+	log.Printf("📋 Loaded tiers: %v", tierRegistry.List())
+
+	// Self-service licenses (email verification, trials) use the default tier,
+	// or its migration target once it is deprecated
+	if tierRegistry.IsDeprecated(config.DefaultTier) {
+		if target, err := tierRegistry.GetMigrationTarget(config.DefaultTier); err == nil {
+			log.Printf("📋 DEFAULT_TIER %s is deprecated, using %s", config.DefaultTier, target)
+			config.DefaultTier = target
+		}
+	}
+	if !tierRegistry.Exists(config.DefaultTier) {
+		log.Fatalf("DEFAULT_TIER %q not found in %s. Available tiers: %v", config.DefaultTier, config.TiersConfigPath, tierRegistry.List())
+	}
 
 	// Initialize database
 	if err := initDB(config.DatabasePath, config.DatabaseURL); err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	defer func() { _ = db.Close() }()
+	defer func() { _ = store.Close() }() // closes cached statements, then db
 
 	// Load private key (already validated in validateConfig)
-	privKeyBytes, err := base64.StdEncoding.DecodeString(config.PrivateKeyB64)
-	if err != nil {
-		log.Fatalf("Failed to decode private key: %v", err)
+	if config.KeyringPath != "" {
+		keyring, err := licensecrypto.LoadKeyring(config.KeyringPath)
+		if err != nil {
+			log.Fatalf("Failed to load keyring: %v", err)
+		}
+		privateKey, retiredKeys = keyring.Primary, keyring.Retired
+		log.Printf("🔑 Signing with keyring %s (%d retired keys)", config.KeyringPath, len(retiredKeys))
+	} else {
+		privKeyBytes, err := base64.StdEncoding.DecodeString(config.PrivateKeyB64)
+		if err != nil {
+			log.Fatalf("Failed to decode private key: %v", err)
+		}
+		privateKey = ed25519.PrivateKey(privKeyBytes)
 	}
-	privateKey = ed25519.PrivateKey(privKeyBytes)
+	defaultProduct = config.DefaultProduct
 
 	// Start background cleanup for rate limiters
+	ipLimiters = newKeyedLimiters(rate.Limit(config.RateLimit), config.RateBurst)
+	trustedProxies = config.TrustedProxies
+	kdfParams, _ = configKDFParams(config) // already validated in validateConfig
+	if kdfParams != licensecrypto.LegacyKDFParams {
+		log.Printf("🔑 New activation salts use %s", kdfParams)
+	}
+	if len(trustedProxies) > 0 {
+		log.Printf("🔗 Trusting X-Forwarded-For from %v", trustedProxies)
+	}
+	log.Printf("🚦 Rate limit: %g req/s per IP, burst %d", config.RateLimit, config.RateBurst)
+	if config.LicenseRateLimit > 0 {
+		licenseLimiters = newKeyedLimiters(rate.Limit(config.LicenseRateLimit), config.LicenseRateBurst)
+		log.Printf("🚦 License rate limit: %g req/s per license on /proxy, burst %d", config.LicenseRateLimit, config.LicenseRateBurst)
+	}
+	if config.LicenseCacheTTL > 0 {
+		cachedLicenses = newLicenseCache(config.LicenseCacheTTL)
+		log.Printf("🗃️  License cache: %v", config.LicenseCacheTTL)
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go cleanupIPLimiters(ctx)
+	var tp *tarpit
+	if config.TarpitEnabled {
+		tp = newTarpit(config)
+		log.Printf("🐌 Tarpit enabled: %d failures, %v base delay, %v max", config.TarpitThreshold, config.TarpitBaseDelay, config.TarpitMaxDelay)
+	}
+	go cleanupLimiters(ctx, tp)
+
+	revocations := &revocationCache{}
+	if err := revocations.refresh(); err != nil {
+		log.Fatalf("Failed to load revocations: %v", err)
+	}
+	go revocations.run(ctx, config.RevocationRefresh)
+
+	alerts := newUsageAlerts(config)
+	if alerts != nil {
+		log.Printf("📈 Usage alerts enabled (default thresholds: %v, email: %v)", alerts.defaults, alerts.mailer != nil)
+	}
+
+	// Start automatic tier assignment if rules are configured
+	if config.AutoTierEnabled {
+		if len(tierRegistry.AutoTierRules()) == 0 {
+			log.Printf("⚠️  AUTO_TIER_ENABLED=true but no [[auto_tier]] rules in %s", config.TiersConfigPath)
+		} else {
+			log.Printf("🔁 Auto-tier: %d rules, every %v (dry run: %v)", len(tierRegistry.AutoTierRules()), config.AutoTierInterval, config.AutoTierDryRun)
+			go runAutoTier(ctx, config)
+		}
+	}
 
 	// Setup HTTP routes with rate limiting
 	http.HandleFunc("/health", handleHealth)
 	http.HandleFunc("/version", handleVersion)
-	http.HandleFunc("/admin", rateLimitMiddleware(basicAuthMiddleware(config.AdminUsername, config.AdminPassword, handleAdmin())))
-	http.HandleFunc("/tiers", handleTiers)
-	http.HandleFunc("/init", rateLimitMiddleware(handleInit(config.ResendAPIKey, config.FromEmail, config.RequireEmailVerification)))
-	http.HandleFunc("/verify", rateLimitMiddleware(handleVerify(config.ResendAPIKey, config.FromEmail, config.RequireEmailVerification, config)))
-	http.HandleFunc("/activate", rateLimitMiddleware(handleActivation(config.ProtectedAPIKey, config.ProxyMode, config)))
-	http.HandleFunc("/check", rateLimitMiddleware(handleCheck()))
-	http.HandleFunc("/usage", rateLimitMiddleware(handleUsageReport()))
+	http.HandleFunc("/pubkey", handlePubKey)
+	http.HandleFunc("/revocations", handleRevocations(revocations, config.RevocationRefresh))
+	// JSON endpoints never need more than MAX_REQUEST_BODY; /proxy also
+	// carries the upstream request body
+	maxBody := int64(config.MaxRequestBody)
+	http.HandleFunc("/admin", rateLimitMiddleware(bodyLimitMiddleware(maxBody, adminAuthMiddleware(config, handleAdmin()))))
+	http.HandleFunc("/admin/seats", rateLimitMiddleware(bodyLimitMiddleware(maxBody, adminAuthMiddleware(config, handleSeats(config)))))
+	http.HandleFunc("/stats", rateLimitMiddleware(adminAuthMiddleware(config, handleStats())))
+	http.HandleFunc("/admin/cache/invalidate", rateLimitMiddleware(bodyLimitMiddleware(maxBody, adminAuthMiddleware(config, handleCacheInvalidate()))))
+	http.HandleFunc("/tiers", handleTiers(config.TiersCacheMaxAge))
+	challenge := newInitChallenge(config)
+	if challenge != nil {
+		log.Printf("🧩 /init challenge enabled: %s", config.InitChallenge)
+	}
+	http.HandleFunc("/init", rateLimitMiddleware(bodyLimitMiddleware(maxBody, handleInit(config.Mailer, config.RequireEmailVerification, challenge, config.VerificationCooldown))))
+	http.HandleFunc("/resend", rateLimitMiddleware(bodyLimitMiddleware(maxBody, handleResend(config.Mailer, config.RequireEmailVerification, config.VerificationCooldown))))
+	http.HandleFunc("/init/challenge", rateLimitMiddleware(bodyLimitMiddleware(maxBody, handleInitChallenge(challenge))))
+	http.HandleFunc("/verify", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleVerify(config.Mailer, config.RequireEmailVerification, config)))))
+	http.HandleFunc("/activate", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleActivation(config.ProtectedAPIKey, config.ProxyMode, config, revocations)))))
+	http.HandleFunc("/deactivate", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleDeactivation(config)))))
+	http.HandleFunc("/check", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleCheck()))))
+	http.HandleFunc("/features", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleFeatures()))))
+	http.HandleFunc("/usage", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleUsage(alerts)))))
+	http.HandleFunc("/usage/batch", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleUsageBatch(alerts)))))
+
+	// Sentinel bundles for testing client decryption, for development only
+	if config.EnableActivationTest {
+		http.HandleFunc("/activate/test", rateLimitMiddleware(bodyLimitMiddleware(maxBody, handleActivationTest())))
+		log.Printf("🧪 Activation test endpoint enabled at /activate/test")
+	}
+
+	// Signed license receipts for customers' procurement records
+	if config.EnableReceipts {
+		http.HandleFunc("/receipt", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleReceipt()))))
+		log.Printf("🧾 License receipts enabled at /receipt")
+	}
+
+	// Anonymous trials are only exposed when explicitly enabled
+	if config.AllowAnonymousTrial {
+		http.HandleFunc("/trial", rateLimitMiddleware(bodyLimitMiddleware(maxBody, handleTrial(config))))
+		log.Printf("🎟️  Anonymous trials: ENABLED (%d days)", config.TrialDays)
+	}
 
 	// Setup proxy routes if proxy mode is enabled
 	if config.ProxyMode {
-		http.HandleFunc("/proxy/", rateLimitMiddleware(handleProxy(config.OpenAIKey, config.AnthropicKey)))
+		upstream := &proxyUpstream{
+			retries:       config.ProxyRetries,
+			backoff:       config.ProxyRetryBackoff,
+			breaker:       newCircuitBreaker(config.ProxyBreakerThreshold, config.ProxyBreakerCooldown),
+			timeout:       config.ProxyTimeout,
+			streamTimeout: config.ProxyStreamTimeout,
+		}
+		signatures := &proxySignatures{replays: proxyReplays, legacy: config.ProxyLegacySignatures}
+		http.HandleFunc("/proxy/", rateLimitMiddleware(bodyLimitMiddleware(maxBody+maxProxyBodySize, tarpitMiddleware(tp, handleProxy(config.Providers, alerts, config.TokenUsage, config.ProxyAudit, config.ProxyStrictUsage, revocations, upstream, signatures)))))
+		http.HandleFunc("/proxy-key/rotate", rateLimitMiddleware(bodyLimitMiddleware(maxBody, tarpitMiddleware(tp, handleProxyKeyRotation(config, revocations)))))
 		log.Printf("🔀 Proxy mode: ENABLED")
-		if config.OpenAIKey != "" {
-			log.Printf("   ✓ OpenAI proxy available at /proxy/openai/*")
+		for _, name := range config.Providers.Names() {
+			provider := config.Providers.Get(name)
+			log.Printf("   ✓ %s proxy available at /proxy/%s/* -> %s", provider.DisplayName, name, provider.BaseURL)
 		}
-		if config.AnthropicKey != "" {
-			log.Printf("   ✓ Anthropic proxy available at /proxy/anthropic/*")
+		for _, name := range tierRegistry.List() {
+			tier, _ := tierRegistry.GetRaw(name)
+			for _, provider := range tier.Providers {
+				if config.Providers.Get(provider) == nil {
+					log.Printf("⚠️  Tier %s allows provider %s, which is not configured", name, provider)
+				}
+			}
 		}
 	}
 
@@ -2426,19 +6368,27 @@ func main() {
 		log.Printf("📊 Database: SQLite (%s)", config.DatabasePath)
 	}
 
-	log.Printf("📧 Email: %s (Resend)", config.FromEmail)
+	switch config.EmailTransport {
+	case "smtp":
+		log.Printf("📧 Email: %s (SMTP via %s:%d)", config.FromEmail, config.SMTPHost, config.SMTPPort)
+	case "resend":
+		log.Printf("📧 Email: %s (Resend)", config.FromEmail)
+	default:
+		log.Printf("📧 Email: not configured")
+	}
 
 	// Create HTTP server instance for graceful shutdown
+	var inFlight inFlightCounter
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      nil, // Using DefaultServeMux
+		Handler:      inFlight.wrap(requestIDMiddleware(corsMiddleware(config.CORSOrigins, instrumentRequests(http.DefaultServeMux, config.LogRequests)))),
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: serverWriteTimeout,
 		IdleTimeout:  60 * time.Second,
 	}
 
 	// Start server in a goroutine
-	serverErr := make(chan error, 1)
+	serverErr := make(chan error, 2)
 	go func() {
 		log.Printf("✅ Server ready to accept connections")
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -2447,6 +6397,25 @@ func main() {
 		serverErr <- nil
 	}()
 
+	// Metrics get their own listener so they can stay off the public port
+	var metricsServer *http.Server
+	if config.MetricsAddr != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:         config.MetricsAddr,
+			Handler:      metricsMux,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+		}
+		go func() {
+			log.Printf("📊 Metrics available at http://%s/metrics", config.MetricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serverErr <- fmt.Errorf("metrics server failed: %w", err)
+			}
+		}()
+	}
+
 	// Setup signal handling for graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -2462,16 +6431,28 @@ func main() {
 	}
 
 	// Graceful shutdown
-	log.Printf("🔄 Shutting down server gracefully (timeout: %v)...", config.ShutdownTimeout)
+	draining := inFlight.n.Load()
+	log.Printf("🔄 Shutting down server gracefully (timeout: %v, %d requests in flight)...", config.ShutdownTimeout, draining)
 
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
 	defer shutdownCancel()
 
-	// Attempt graceful shutdown
-	if err := server.Shutdown(shutdownCtx); err != nil {
-		log.Printf("❌ Server forced to shutdown: %v", err)
+	// Attempt graceful shutdown, then stop background workers
+	shutdownErr := server.Shutdown(shutdownCtx)
+	if metricsServer != nil {
+		_ = metricsServer.Shutdown(shutdownCtx)
+	}
+	cancel()
+
+	// Fold the SQLite WAL back into the main database file
+	if config.WALCheckpointOnShutdown && !isPostgresDB {
+		checkpointWAL()
+	}
+
+	if shutdownErr != nil {
+		log.Printf("❌ Server forced to shutdown: %v (%d requests still in flight)", shutdownErr, inFlight.n.Load())
 		return
 	}
 
-	log.Println("✅ Server stopped gracefully")
+	log.Printf("✅ Server stopped gracefully (%d in-flight requests drained)", draining)
 }
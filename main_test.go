@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// openTestDB points the server's database globals at a fresh, migrated
+// SQLite file for the duration of the test
+func openTestDB(t *testing.T) {
+	t.Helper()
+	if err := initDB(filepath.Join(t.TempDir(), "licensify.db"), ""); err != nil {
+		t.Fatalf("initDB: %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+}
+
+func TestRecordCheckInReportsDatabaseErrors(t *testing.T) {
+	openTestDB(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := recordCheckIn(ctx, "LIC-TEST"); err != nil {
+			t.Fatalf("recordCheckIn #%d: %v", i+1, err)
+		}
+	}
+	if last, err := store.GetLastCheckIn("LIC-TEST"); err != nil || last.IsZero() {
+		t.Fatalf("GetLastCheckIn = %v, %v; want a check-in", last, err)
+	}
+
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := recordCheckIn(ctx, "LIC-TEST"); err == nil {
+		t.Fatal("recordCheckIn on a closed database returned nil, want an error")
+	}
+}
+
+// slowServer starts a server whose handler, wrapped in inFlight, holds each
+// request until release is closed
+func slowServer(t *testing.T, inFlight *inFlightCounter, started chan<- struct{}, release <-chan struct{}) (*http.Server, string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: inFlight.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		_, _ = w.Write([]byte("done"))
+	}))}
+	go func() { _ = server.Serve(listener) }()
+	return server, "http://" + listener.Addr().String()
+}
+
+func TestGracefulShutdownDrainsSlowRequest(t *testing.T) {
+	var inFlight inFlightCounter
+	started, release := make(chan struct{}), make(chan struct{})
+	server, url := slowServer(t, &inFlight, started, release)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			body <- "error: " + err.Error()
+			return
+		}
+		defer func() { _ = resp.Body.Close() }()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+	<-started
+	if n := inFlight.n.Load(); n != 1 {
+		t.Fatalf("in flight = %d, want 1", n)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- server.Shutdown(ctx)
+	}()
+	select {
+	case err := <-shutdown:
+		t.Fatalf("shutdown returned before the slow request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if got := <-body; got != "done" {
+		t.Fatalf("slow request got %q, want its full response", got)
+	}
+	if n := inFlight.n.Load(); n != 0 {
+		t.Fatalf("in flight after shutdown = %d, want 0", n)
+	}
+}
+
+func TestGracefulShutdownTimeout(t *testing.T) {
+	var inFlight inFlightCounter
+	started, release := make(chan struct{}), make(chan struct{})
+	server, url := slowServer(t, &inFlight, started, release)
+	defer close(release)
+
+	go func() {
+		if resp, err := http.Get(url); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown error = %v, want the timeout", err)
+	}
+	if n := inFlight.n.Load(); n != 1 {
+		t.Fatalf("in flight at the timeout = %d, want the slow request", n)
+	}
+}
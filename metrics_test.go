@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/metrics"
+)
+
+// scrapeMetric returns the value of series from the metrics endpoint, or 0
+// if it hasn't been recorded yet
+func scrapeMetric(t *testing.T, series string) float64 {
+	t.Helper()
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("scrape: status = %d", w.Code)
+	}
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatalf("%s: %v", series, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+func TestMetricsAfterActivation(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	useTestSigningKey(t)
+	seedLicense(t, "LIC-METRICS", "basic", time.Now().AddDate(0, 1, 0))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/activate", handleActivation("sk-test", false, &Config{}, nil))
+	handler := instrumentRequests(mux, false)
+
+	series := []string{
+		`licensify_activations_total{mode="direct"}`,
+		`licensify_http_requests_total{route="/activate",code="200"}`,
+		`licensify_db_query_duration_seconds_count{query="record_activation"}`,
+	}
+	before := make([]float64, len(series))
+	for i, s := range series {
+		before[i] = scrapeMetric(t, s)
+	}
+
+	w := httptest.NewRecorder()
+	body := `{"license_key":"LIC-METRICS","hardware_id":"hw-metrics"}`
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/activate", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("activate: status = %d: %s", w.Code, w.Body)
+	}
+
+	for i, s := range series {
+		if got := scrapeMetric(t, s); got != before[i]+1 {
+			t.Errorf("%s = %v, want %v", s, got, before[i]+1)
+		}
+	}
+}
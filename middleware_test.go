@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/melihbirim/licensify/internal/logging"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	generated := regexp.MustCompile(`^[0-9a-f]{32}$`)
+	tests := []struct {
+		name     string
+		incoming string
+		want     string // empty when a new ID should be generated
+	}{
+		{"generated", "", ""},
+		{"passed through", "client-req_42.retry:1", "client-req_42.retry:1"},
+		{"header injection", "abc\r\nSet-Cookie: x=1", ""},
+		{"spaces", "my request", ""},
+		{"too long", strings.Repeat("a", 129), ""},
+		{"longest allowed", strings.Repeat("a", 128), strings.Repeat("a", 128)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestIDFromContext(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/health", nil)
+			if tt.incoming != "" {
+				r.Header.Set("X-Request-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			echoed := w.Header().Get("X-Request-ID")
+			if echoed != seen {
+				t.Fatalf("response header %q, handler saw %q", echoed, seen)
+			}
+			if tt.want != "" && seen != tt.want {
+				t.Fatalf("request ID = %q, want %q passed through", seen, tt.want)
+			}
+			if tt.want == "" && !generated.MatchString(seen) {
+				t.Fatalf("request ID = %q, want a generated one", seen)
+			}
+		})
+	}
+
+	// Each request without an ID gets its own
+	ids := make(map[string]bool)
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 10; i++ {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		ids[w.Header().Get("X-Request-ID")] = true
+	}
+	if len(ids) != 10 {
+		t.Fatalf("10 requests got %d distinct IDs", len(ids))
+	}
+
+	if id := requestIDFromContext(httptest.NewRequest(http.MethodGet, "/", nil).Context()); id != "" {
+		t.Fatalf("requestIDFromContext without the middleware = %q, want empty", id)
+	}
+}
+
+// captureJSONLogs sends the server's logs to the returned buffer as JSON
+// lines, the way LOG_FORMAT=json does, for the rest of the test
+func captureJSONLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	previous, output, flags := slog.Default(), log.Writer(), log.Flags()
+	t.Cleanup(func() {
+		slog.SetDefault(previous)
+		log.SetOutput(output)
+		log.SetFlags(flags)
+	})
+	var logs bytes.Buffer
+	if err := logging.Setup(logging.FormatJSON, &logs); err != nil {
+		t.Fatal(err)
+	}
+	return &logs
+}
+
+// jsonLogRecords returns the records in logs whose msg is msg
+func jsonLogRecords(t *testing.T, logs *bytes.Buffer, msg string) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line isn't JSON: %q", line)
+		}
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestRequestLogJSON(t *testing.T) {
+	logs := captureJSONLogs(t)
+	useTrustedProxies(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/activate", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})
+	handler := requestIDMiddleware(instrumentRequests(mux, true))
+
+	r := httptest.NewRequest(http.MethodPost, "/activate?license=LIC-SECRET", nil)
+	r.RemoteAddr = "198.51.100.7:4242"
+	r.Header.Set("X-Request-ID", "req-log-1")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	records := jsonLogRecords(t, logs, "request")
+	if len(records) != 1 {
+		t.Fatalf("got %d request records, want 1: %s", len(records), logs)
+	}
+	record := records[0]
+	for field, want := range map[string]any{
+		"level":      "INFO",
+		"request_id": "req-log-1",
+		"method":     "POST",
+		"path":       "/activate",
+		"status":     float64(http.StatusForbidden),
+		"ip":         "198.51.100.7",
+	} {
+		if record[field] != want {
+			t.Errorf("%s = %v, want %v", field, record[field], want)
+		}
+	}
+	if _, ok := record["duration_ms"].(float64); !ok {
+		t.Errorf("duration_ms = %v, want a number", record["duration_ms"])
+	}
+	// The query string can carry secrets, so only the path is logged
+	if strings.Contains(logs.String(), "LIC-SECRET") {
+		t.Fatalf("query string logged: %s", logs)
+	}
+
+	// Without LOG_REQUESTS nothing is logged per request
+	logs.Reset()
+	requestIDMiddleware(instrumentRequests(mux, false)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/activate", nil))
+	if logs.Len() != 0 {
+		t.Fatalf("logged with LOG_REQUESTS off: %s", logs)
+	}
+}
+
+// useTrustedProxies trusts X-Forwarded-For from cidrs for the rest of the
+// test
+func useTrustedProxies(t *testing.T, cidrs ...string) {
+	t.Helper()
+	previous := trustedProxies
+	trustedProxies = nil
+	for _, cidr := range cidrs {
+		trustedProxies = append(trustedProxies, netip.MustParsePrefix(cidr))
+	}
+	t.Cleanup(func() { trustedProxies = previous })
+}
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"203.0.113.7", "203.0.113.7"},
+		{"203.0.113.7:54321", "203.0.113.7"},
+		{" 203.0.113.7 ", "203.0.113.7"},
+		{"2001:DB8::1", "2001:db8::1"},
+		{"2001:0db8:0000:0000:0000:0000:0000:0001", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"[2001:db8::1]:8080", "2001:db8::1"},
+		{"[::1]:12345", "::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"[fe80::1%25eth0]:443", "fe80::1"},
+		{"::ffff:203.0.113.7", "203.0.113.7"},
+		{"[::ffff:203.0.113.7]:80", "203.0.113.7"},
+		{"", ""},
+		{"unknown", ""},
+		{"203.0.113.300", ""},
+		{"2001:db8::1::2", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeIP(tt.in); got != tt.want {
+			t.Errorf("normalizeIP(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestClientIPNormalizesIPv6Hops(t *testing.T) {
+	useTrustedProxies(t, "2001:db8:ffff::/48")
+
+	// Every spelling of the same client maps to one limiter key
+	for _, xff := range []string{
+		"2001:DB8:1::5",
+		"[2001:db8:1::5]",
+		"2001:db8:1:0:0:0:0:5",
+		"2001:db8:1::5, 2001:db8:ffff::2",
+		"2001:db8:1::5, garbage, [2001:DB8:FFFF::3]:443",
+		"fe80::9, 2001:db8:1::5%eth0",
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.RemoteAddr = "[2001:db8:ffff::1]:443"
+		r.Header.Set("X-Forwarded-For", xff)
+		if got := clientIP(r); got != "2001:db8:1::5" {
+			t.Errorf("X-Forwarded-For %q: clientIP = %q, want 2001:db8:1::5", xff, got)
+		}
+	}
+}
+
+func TestClientIPTrustedProxies(t *testing.T) {
+	useTrustedProxies(t, "10.0.0.0/8", "192.0.2.1/32")
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"untrusted peer can't spoof", "198.51.100.9:5000", "1.2.3.4", "198.51.100.9"},
+		{"untrusted peer without header", "198.51.100.9:5000", "", "198.51.100.9"},
+		{"trusted proxy", "10.1.2.3:5000", "203.0.113.7", "203.0.113.7"},
+		{"single trusted address", "192.0.2.1:5000", "203.0.113.7", "203.0.113.7"},
+		{"next to the trusted address", "192.0.2.2:5000", "203.0.113.7", "192.0.2.2"},
+		// The client can prepend anything; the entry the proxy added wins
+		{"spoofed entry before the real one", "10.1.2.3:5000", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"chain of trusted proxies", "10.1.2.3:5000", "203.0.113.7, 10.9.9.9, 10.8.8.8", "203.0.113.7"},
+		{"trusted proxy without header", "10.1.2.3:5000", "", "10.1.2.3"},
+		{"only malformed entries", "10.1.2.3:5000", "not-an-ip, ", "10.1.2.3"},
+		{"every hop trusted", "10.1.2.3:5000", "10.4.4.4", "10.4.4.4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Fatalf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// With no trusted proxies the header is never honoured
+	useTrustedProxies(t)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.1.2.3:5000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if got := clientIP(r); got != "10.1.2.3" {
+		t.Fatalf("clientIP without TRUSTED_PROXIES = %q, want the peer", got)
+	}
+}
+
+func TestTrustedProxiesConfig(t *testing.T) {
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8, 192.0.2.1, 2001:db8::/32")
+	loader := &envLoader{}
+	prefixes := loader.prefixes("TRUSTED_PROXIES")
+	if len(loader.errors) != 0 || fmt.Sprint(prefixes) != "[10.0.0.0/8 192.0.2.1/32 2001:db8::/32]" {
+		t.Fatalf("prefixes = %v, errors %v", prefixes, loader.errors)
+	}
+
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/8,proxy.internal")
+	loader = &envLoader{}
+	if prefixes := loader.prefixes("TRUSTED_PROXIES"); prefixes != nil || len(loader.errors) != 1 {
+		t.Fatalf("invalid entry: prefixes = %v, errors %v", prefixes, loader.errors)
+	}
+}
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	const limit = 64
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool // unknown length, so only reading finds the overflow
+		want    int
+	}{
+		{"small", `{"license_key":"LIC-1"}`, false, http.StatusOK},
+		{"exactly the limit", strings.Repeat("a", limit), false, http.StatusOK},
+		{"over the limit", strings.Repeat("a", limit+1), false, http.StatusRequestEntityTooLarge},
+		{"chunked under the limit", strings.Repeat("a", limit), true, http.StatusOK},
+		{"chunked over the limit", strings.Repeat("a", 10*limit), true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			called := false
+			handler := bodyLimitMiddleware(limit, func(w http.ResponseWriter, r *http.Request) {
+				called = true
+				data, _ := io.ReadAll(r.Body)
+				got = string(data)
+			})
+
+			r := httptest.NewRequest(http.MethodPost, "/activate", io.MultiReader(strings.NewReader(tt.body)))
+			if !tt.chunked {
+				r.ContentLength = int64(len(tt.body))
+			} else {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			handler(w, r)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && got != tt.body {
+				t.Fatalf("handler read %d bytes, want the whole %d byte body", len(got), len(tt.body))
+			}
+			if tt.want != http.StatusOK && called {
+				t.Fatal("handler ran for an oversized body")
+			}
+		})
+	}
+}
+
+func TestOversizedCheckGets413(t *testing.T) {
+	openTestDB(t)
+	handler := bodyLimitMiddleware(1024, handleCheck())
+	body := `{"license_key":"` + strings.Repeat("A", 2048) + `"}`
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, "/check", strings.NewReader(body)))
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "too large") {
+		t.Fatalf("status = %d: %s, want 413", w.Code, w.Body)
+	}
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	const app = "https://app.example.com"
+	allowlist := corsMiddleware([]string{app}, http.HandlerFunc(okHandler))
+	wildcard := corsMiddleware([]string{"*"}, http.HandlerFunc(okHandler))
+
+	request := func(method, origin string, preflight bool) *http.Request {
+		r := httptest.NewRequest(method, "/verify", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if preflight {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		handler     http.Handler
+		req         *http.Request
+		wantStatus  int
+		allowOrigin string
+		wantMethods bool
+		wantVary    bool
+	}{
+		{"preflight from allowed origin", allowlist, request(http.MethodOptions, app, true), http.StatusNoContent, app, true, true},
+		{"preflight matches origin case-insensitively", allowlist, request(http.MethodOptions, "HTTPS://App.Example.com", true), http.StatusNoContent, "HTTPS://App.Example.com", true, true},
+		{"preflight from other origin", allowlist, request(http.MethodOptions, "https://evil.example", true), http.StatusNoContent, "", false, true},
+		{"request from allowed origin", allowlist, request(http.MethodPost, app, false), http.StatusOK, app, false, true},
+		{"request from other origin", allowlist, request(http.MethodPost, "https://evil.example", false), http.StatusOK, "", false, true},
+		{"request without origin", allowlist, request(http.MethodPost, "", false), http.StatusOK, "", false, true},
+		{"plain OPTIONS reaches the handler", allowlist, request(http.MethodOptions, app, false), http.StatusOK, app, false, true},
+		{"wildcard preflight", wildcard, request(http.MethodOptions, "https://anyone.example", true), http.StatusNoContent, "*", true, false},
+		{"wildcard request", wildcard, request(http.MethodPost, "https://anyone.example", false), http.StatusOK, "*", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.handler.ServeHTTP(w, tt.req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			h := w.Header()
+			if got := h.Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Fatalf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if exposed := h.Get("Access-Control-Expose-Headers"); (tt.allowOrigin != "") != strings.Contains(exposed, "X-Request-ID") {
+				t.Fatalf("Access-Control-Expose-Headers = %q", exposed)
+			}
+			if methods := h.Get("Access-Control-Allow-Methods"); tt.wantMethods != (methods != "") {
+				t.Fatalf("Access-Control-Allow-Methods = %q", methods)
+			}
+			if tt.wantMethods && h.Get("Access-Control-Allow-Headers") == "" {
+				t.Fatal("preflight is missing Access-Control-Allow-Headers")
+			}
+			// Responses differ by origin, so caches must key on it
+			if vary := h.Get("Vary"); (vary == "Origin") != tt.wantVary {
+				t.Fatalf("Vary = %q, want Origin: %v", vary, tt.wantVary)
+			}
+		})
+	}
+
+	t.Run("disabled without origins", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		corsMiddleware(nil, http.HandlerFunc(okHandler)).ServeHTTP(w, request(http.MethodOptions, app, true))
+		if w.Code != http.StatusOK || w.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Fatalf("status = %d, headers %v; want the request passed through untouched", w.Code, w.Header())
+		}
+	})
+}
+
+func TestCORSOriginsConfig(t *testing.T) {
+	t.Setenv("CORS_ORIGINS", "https://App.Example.com/, http://localhost:3000")
+	loader := &envLoader{}
+	if origins := loader.origins("CORS_ORIGINS"); len(loader.errors) != 0 || fmt.Sprint(origins) != "[https://app.example.com http://localhost:3000]" {
+		t.Fatalf("origins = %v, errors %v", origins, loader.errors)
+	}
+
+	for _, bad := range []string{"app.example.com", "https://app.example.com/path", "ftp://app.example.com"} {
+		t.Setenv("CORS_ORIGINS", bad)
+		loader = &envLoader{}
+		if origins := loader.origins("CORS_ORIGINS"); origins != nil || len(loader.errors) != 1 {
+			t.Fatalf("%q: origins = %v, errors %v", bad, origins, loader.errors)
+		}
+	}
+}
@@ -0,0 +1,900 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/providers"
+	"github.com/melihbirim/licensify/internal/tiers"
+)
+
+// testTiers are the tiers licenses in handler tests are created on
+const testTiers = `
+[tiers.basic]
+name = "Basic"
+daily_limit = 100
+monthly_limit = 1000
+max_devices = 2
+features = ["basic_api_access"]
+description = "Limited tier"
+
+[tiers.pro]
+name = "Pro"
+daily_limit = -1
+monthly_limit = -1
+max_devices = 5
+features = ["basic_api_access", "api_analytics"]
+description = "Unlimited tier"
+
+[tiers.basic-legacy]
+name = "Basic (legacy)"
+daily_limit = 10
+monthly_limit = 100
+max_devices = 1
+description = "Replaced by basic"
+deprecated = true
+migrate_to = "basic"
+
+[tiers.openai-only]
+name = "OpenAI only"
+daily_limit = 100
+monthly_limit = 1000
+max_devices = 1
+features = ["basic_api_access"]
+providers = ["openai"]
+description = "Tier limited to one provider"
+`
+
+// useTestTiers points tierRegistry at testTiers for the duration of the test
+func useTestTiers(t *testing.T) {
+	t.Helper()
+	useTiers(t, testTiers)
+}
+
+// useTiers points tierRegistry at the tiers in config for the duration of
+// the test
+func useTiers(t *testing.T, config string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tiers.toml")
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	registry := tiers.NewRegistry()
+	if err := registry.Load(path); err != nil {
+		t.Fatalf("load tiers: %v", err)
+	}
+	previous := tierRegistry
+	tierRegistry = registry
+	t.Cleanup(func() { tierRegistry = previous })
+}
+
+// useTestSigningKey gives the server a fresh signing key for the duration
+// of the test
+func useTestSigningKey(t *testing.T) ed25519.PublicKey {
+	t.Helper()
+	publicKey, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := privateKey
+	privateKey = key
+	t.Cleanup(func() { privateKey = previous })
+	return publicKey
+}
+
+// seedLicense inserts an active license on tier with the tier's limits that
+// expires at expiresAt
+func seedLicense(t *testing.T, licenseID, tier string, expiresAt time.Time) {
+	t.Helper()
+	details, err := tierRegistry.GetRaw(tier)
+	if err != nil {
+		t.Fatalf("tier %s: %v", tier, err)
+	}
+	insertLicense(t, licenseID, tier, expiresAt, details.DailyLimit, details.MonthlyLimit, details.MaxDevices)
+}
+
+// insertLicense inserts an active license with the given limits
+func insertLicense(t *testing.T, licenseID, tier string, expiresAt time.Time, dailyLimit, monthlyLimit, maxActivations int) {
+	t.Helper()
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO licenses (license_id, customer_name, customer_email, tier, expires_at,
+		daily_limit, monthly_limit, max_activations) VALUES (%s, %s, %s, %s, %s, %s, %s, %s)`,
+		sqlPlaceholder(1), sqlPlaceholder(2), sqlPlaceholder(3), sqlPlaceholder(4), sqlPlaceholder(5),
+		sqlPlaceholder(6), sqlPlaceholder(7), sqlPlaceholder(8)),
+		licenseID, "Test Customer", "test@example.com", tier, expiresAt.UTC().Format(time.RFC3339),
+		dailyLimit, monthlyLimit, maxActivations)
+	if err != nil {
+		t.Fatalf("insert license: %v", err)
+	}
+}
+
+// seedDevice activates hardwareID on licenseID and returns the device's
+// proxy key, which expires at expiresAt (nil for never)
+func seedDevice(t *testing.T, licenseID, hardwareID string, expiresAt *time.Time) string {
+	t.Helper()
+	_, err := db.Exec(fmt.Sprintf(`INSERT INTO activations (license_id, hardware_id) VALUES (%s, %s)`,
+		sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID)
+	if err != nil {
+		t.Fatalf("insert activation: %v", err)
+	}
+	proxyKey, err := generateProxyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storeProxyKey(t.Context(), proxyKey, licenseID, hardwareID, expiresAt); err != nil {
+		t.Fatalf("store proxy key: %v", err)
+	}
+	return proxyKey
+}
+
+// proxyTest serves handleProxy with every built-in provider pointed at an
+// httptest upstream
+type proxyTest struct {
+	handler      http.HandlerFunc
+	registry     *providers.Registry
+	revocations  *revocationCache
+	upstream     *proxyUpstream
+	signatures   *proxySignatures
+	upstreamURL  string
+	upstreamHits int32
+
+	mu   sync.Mutex
+	last *http.Request // the last request the upstream received
+	body []byte        // and its body
+
+	countTokens, auditRequests, strictUsage bool
+}
+
+// newProxyTest opens a test database with testTiers and starts an upstream
+// that answers with upstream
+func newProxyTest(t *testing.T, upstream http.HandlerFunc) *proxyTest {
+	t.Helper()
+	openTestDB(t)
+	useTestTiers(t)
+	useTestSigningKey(t)
+
+	p := &proxyTest{
+		revocations: &revocationCache{},
+		upstream:    &proxyUpstream{timeout: 5 * time.Second},
+		signatures:  &proxySignatures{replays: newReplayCache(maxReplayEntries, maxReplayEntriesPerKey)},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&p.upstreamHits, 1)
+		body := new(bytes.Buffer)
+		_, _ = body.ReadFrom(r.Body)
+		p.mu.Lock()
+		p.last, p.body = r, body.Bytes()
+		p.mu.Unlock()
+		upstream(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	p.upstreamURL = srv.URL
+
+	p.registry = providers.NewRegistry()
+	for _, name := range []string{"openai", "anthropic", "gemini"} {
+		provider := providers.Builtin(name)
+		provider.BaseURL = srv.URL
+		provider.APIKey = "sk-" + name
+		if err := p.registry.Register(*provider); err != nil {
+			t.Fatalf("register %s: %v", name, err)
+		}
+	}
+	if err := p.revocations.refresh(); err != nil {
+		t.Fatalf("load revocations: %v", err)
+	}
+	p.build()
+	return p
+}
+
+// build (re)creates the handler from the test's settings
+func (p *proxyTest) build() {
+	p.handler = handleProxy(p.registry, nil, p.countTokens, p.auditRequests, p.strictUsage, p.revocations, p.upstream, p.signatures)
+}
+
+// hits returns how many requests reached the upstream
+func (p *proxyTest) hits() int {
+	return int(atomic.LoadInt32(&p.upstreamHits))
+}
+
+// lastRequest returns the last request the upstream received and its body
+func (p *proxyTest) lastRequest() (*http.Request, []byte) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.last, p.body
+}
+
+var testNonces int64
+
+// post sends body to path signed with proxyKey, the way the CLI does
+func (p *proxyTest) post(proxyKey, provider, path, body string) *httptest.ResponseRecorder {
+	req := signProxyRequest(proxyKey, provider, path, body)
+	encoded, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	p.handler(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded)))
+	return w
+}
+
+// signProxyRequest returns a proxy request for path signed with proxyKey
+// and a fresh nonce
+func signProxyRequest(proxyKey, provider, path, body string) *ProxyRequest {
+	req := &ProxyRequest{
+		ProxyKey:  proxyKey,
+		Provider:  provider,
+		Body:      json.RawMessage(body),
+		Timestamp: time.Now().Unix(),
+		Nonce:     fmt.Sprintf("nonce-%016d", atomic.AddInt64(&testNonces, 1)),
+	}
+	h := hmac.New(sha256.New, []byte(proxyKey))
+	h.Write([]byte(proxySignatureMessage(req.Timestamp, http.MethodPost, path, provider, req.Nonce, req.Body)))
+	req.Signature = hex.EncodeToString(h.Sum(nil))
+	return req
+}
+
+func TestProxyKeepsRequestsOnProviderHost(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	seedLicense(t, "LIC-ROUTE", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-ROUTE", "hw-route", nil)
+
+	tests := []struct {
+		name     string
+		provider string
+		path     string
+		status   int
+		upstream string // path the upstream receives
+	}{
+		{"default path", "gemini", "/proxy/gemini", http.StatusOK, "/v1beta/models/gemini-pro:generateContent"},
+		{"client path", "gemini", "/proxy/gemini/v1beta/models/gemini-1.5-pro:generateContent", http.StatusOK, "/v1beta/models/gemini-1.5-pro:generateContent"},
+		{"userinfo", "gemini", "/proxy/gemini@evil.example/x", http.StatusBadRequest, ""},
+		{"host suffix", "gemini", "/proxy/gemini.evil.example/x", http.StatusBadRequest, ""},
+		{"port", "openai", "/proxy/openai:8080/x", http.StatusBadRequest, ""},
+		{"another provider's path", "openai", "/proxy/anthropic/v1/messages", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := p.hits()
+			w := p.post(proxyKey, tt.provider, tt.path, `{}`)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.upstream == "" {
+				if p.hits() != before {
+					t.Fatal("rejected request reached the upstream")
+				}
+				return
+			}
+			r, _ := p.lastRequest()
+			if r.Host != p.upstreamURL[len("http://"):] || r.URL.Path != tt.upstream {
+				t.Fatalf("upstream got %s%s, want %s", r.Host, r.URL.Path, tt.upstream)
+			}
+		})
+	}
+}
+
+func TestProxySendsProviderHeaders(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"candidates":[]}`))
+	})
+	seedLicense(t, "LIC-HEADERS", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-HEADERS", "hw-headers", nil)
+
+	tests := []struct {
+		provider string
+		header   string
+		want     string
+		path     string
+	}{
+		{"gemini", "x-goog-api-key", "sk-gemini", "/v1beta/models/gemini-pro:generateContent"},
+		{"anthropic", "x-api-key", "sk-anthropic", "/v1/messages"},
+		{"openai", "Authorization", "Bearer sk-openai", "/v1/chat/completions"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.provider, func(t *testing.T) {
+			w := p.post(proxyKey, tt.provider, "/proxy/"+tt.provider, `{"contents":[]}`)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if got := w.Header().Get("X-Provider"); got != tt.provider {
+				t.Fatalf("X-Provider = %q, want %q", got, tt.provider)
+			}
+			r, body := p.lastRequest()
+			if got := r.Header.Get(tt.header); got != tt.want {
+				t.Fatalf("%s = %q, want %q", tt.header, got, tt.want)
+			}
+			if r.URL.Path != tt.path || r.URL.RawQuery != "" {
+				t.Fatalf("upstream got %s, want %s without a query", r.URL, tt.path)
+			}
+			if string(body) != `{"contents":[]}` {
+				t.Fatalf("upstream got body %q", body)
+			}
+		})
+	}
+}
+
+func TestProxyBlocksRevokedLicenseWithActivation(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	seedLicense(t, "LIC-REVOKED", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-REVOKED", "hw-revoked", nil)
+
+	if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("before revocation: status = %d: %s", w.Code, w.Body)
+	}
+	if err := store.AddRevocation("LIC-REVOKED", "chargeback"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.revocations.refresh(); err != nil {
+		t.Fatal(err)
+	}
+
+	before := p.hits()
+	w := p.post(proxyKey, "openai", "/proxy/openai", `{}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "revoked") {
+		t.Fatalf("after revocation: status = %d: %s", w.Code, w.Body)
+	}
+	if p.hits() != before {
+		t.Fatal("revoked license reached the upstream")
+	}
+	var activations int
+	if err := db.QueryRow(fmt.Sprintf(`SELECT COUNT(*) FROM activations WHERE license_id = %s`, sqlPlaceholder(1)), "LIC-REVOKED").Scan(&activations); err != nil {
+		t.Fatal(err)
+	}
+	if activations != 1 {
+		t.Fatalf("activations = %d, want the device still activated", activations)
+	}
+}
+
+func TestProxyUnknownKeysSkipReplayCache(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+
+	for i := 0; i < 3; i++ {
+		proxyKey, err := generateProxyKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401: %s", w.Code, w.Body)
+		}
+	}
+	if p.signatures.replays.size != 0 {
+		t.Fatalf("replay cache holds %d entries for keys that were never issued", p.signatures.replays.size)
+	}
+}
+
+func TestProxyTruncatedResponseNotBilled(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		// Promise more than is sent, so the proxy's copy fails mid-body
+		w.Header().Set("Content-Length", "100")
+		_, _ = w.Write([]byte(`{"choices":`))
+	})
+	seedLicense(t, "LIC-TRUNCATED", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-TRUNCATED", "hw-truncated", nil)
+
+	logs := captureJSONLogs(t)
+
+	encoded, _ := json.Marshal(signProxyRequest(proxyKey, "openai", "/proxy/openai", `{}`))
+	r := httptest.NewRequest(http.MethodPost, "/proxy/openai", bytes.NewReader(encoded))
+	r = r.WithContext(context.WithValue(r.Context(), requestIDKey{}, "req-truncated"))
+	p.handler(httptest.NewRecorder(), r)
+
+	if scans := totalScans(t, "LIC-TRUNCATED"); scans != 0 {
+		t.Fatalf("truncated response billed %d scans", scans)
+	}
+	var logged bool
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var entry map[string]any
+		if json.Unmarshal([]byte(line), &entry) != nil || !strings.Contains(fmt.Sprint(entry["msg"]), "Truncated") {
+			continue
+		}
+		logged = true
+		if entry["request_id"] != "req-truncated" || entry["reason"] != string(truncationUpstreamDropped) {
+			t.Fatalf("truncation logged as %v", entry)
+		}
+	}
+	if !logged {
+		t.Fatalf("truncation wasn't logged: %s", logs.String())
+	}
+}
+
+func TestTruncationReason(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	timedOut, cancelTimeout := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelTimeout()
+
+	tests := []struct {
+		name     string
+		client   context.Context
+		upstream context.Context
+		want     truncation
+		billable bool
+	}{
+		{"upstream dropped", context.Background(), context.Background(), truncationUpstreamDropped, false},
+		{"upstream timeout", context.Background(), timedOut, truncationUpstreamTimeout, false},
+		{"client disconnected", canceled, canceled, truncationClientDisconnected, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncationReason(tt.client, tt.upstream)
+			if got != tt.want || got.billable() != tt.billable {
+				t.Fatalf("reason = %q (billable %v), want %q (billable %v)", got, got.billable(), tt.want, tt.billable)
+			}
+		})
+	}
+}
+
+func TestProxyReportsProviderAndLatency(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		// An upstream can't spoof the headers the proxy sets
+		w.Header().Set("X-Provider", "spoofed")
+		w.Header().Set("X-Upstream-Latency-Ms", "999999")
+		time.Sleep(20 * time.Millisecond)
+		if r.URL.Path == "/v1/messages" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	})
+	seedLicense(t, "LIC-LATENCY", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-LATENCY", "hw-latency", nil)
+
+	for _, provider := range []string{"openai", "anthropic"} {
+		t.Run(provider, func(t *testing.T) {
+			w := p.post(proxyKey, provider, "/proxy/"+provider, `{}`)
+			if got := w.Header().Values("X-Provider"); len(got) != 1 || got[0] != provider {
+				t.Fatalf("X-Provider = %q, want %q (status %d)", got, provider, w.Code)
+			}
+			latency, err := strconv.Atoi(w.Header().Get("X-Upstream-Latency-Ms"))
+			if err != nil || latency < 20 || latency >= 999999 {
+				t.Fatalf("X-Upstream-Latency-Ms = %q, want the measured upstream latency", w.Header().Values("X-Upstream-Latency-Ms"))
+			}
+		})
+	}
+}
+
+func TestProxyStreamsEventsAsTheyArrive(t *testing.T) {
+	firstRead := make(chan struct{})
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte("data: {\"n\":1}\n\n"))
+		w.(http.Flusher).Flush()
+		// Hold the rest of the stream until the client has the first event
+		select {
+		case <-firstRead:
+		case <-time.After(5 * time.Second):
+		}
+		_, _ = w.Write([]byte("data: {\"n\":2}\n\ndata: [DONE]\n\n"))
+	})
+	seedLicense(t, "LIC-SSE", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-SSE", "hw-sse", nil)
+
+	srv := httptest.NewServer(p.handler)
+	t.Cleanup(srv.Close)
+	encoded, _ := json.Marshal(signProxyRequest(proxyKey, "openai", "/proxy/openai", `{"stream":true}`))
+
+	// The response headers and the first event must both arrive while the
+	// upstream is still holding the rest of the stream
+	type firstEvent struct {
+		resp   *http.Response
+		reader *bufio.Reader
+		line   string
+		err    error
+	}
+	first := make(chan firstEvent, 1)
+	go func() {
+		resp, err := http.Post(srv.URL+"/proxy/openai", "application/json", bytes.NewReader(encoded))
+		if err != nil {
+			first <- firstEvent{err: err}
+			return
+		}
+		reader := bufio.NewReader(resp.Body)
+		line, err := reader.ReadString('\n')
+		first <- firstEvent{resp, reader, line, err}
+	}()
+	var event firstEvent
+	select {
+	case event = <-first:
+	case <-time.After(2 * time.Second):
+		close(firstRead)
+		t.Fatal("the first event was held back until the stream ended")
+	}
+	if event.err != nil {
+		t.Fatal(event.err)
+	}
+	defer func() { _ = event.resp.Body.Close() }()
+	if event.resp.StatusCode != http.StatusOK || event.resp.Header.Get("Cache-Control") != "no-cache" {
+		t.Fatalf("status = %d, Cache-Control = %q", event.resp.StatusCode, event.resp.Header.Get("Cache-Control"))
+	}
+	if event.line != "data: {\"n\":1}\n" {
+		t.Fatalf("first line = %q", event.line)
+	}
+	close(firstRead)
+
+	rest, err := io.ReadAll(event.reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != "\ndata: {\"n\":2}\n\ndata: [DONE]\n\n" {
+		t.Fatalf("rest of the stream = %q", rest)
+	}
+}
+
+// scriptedUpstream answers each request with the next status in statuses,
+// repeating the last one once they run out
+func scriptedUpstream(statuses ...int) http.HandlerFunc {
+	var calls int32
+	return func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(&calls, 1)) - 1
+		w.WriteHeader(statuses[min(n, len(statuses)-1)])
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+func TestProxyRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		want     int
+		hits     int
+	}{
+		{"recovers after 502 and 503", []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK}, http.StatusOK, 3},
+		{"gives up after the retries", []int{http.StatusGatewayTimeout}, http.StatusGatewayTimeout, 3},
+		{"client errors aren't retried", []int{http.StatusBadRequest, http.StatusOK}, http.StatusBadRequest, 1},
+		{"server errors aren't retried", []int{http.StatusInternalServerError, http.StatusOK}, http.StatusInternalServerError, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newProxyTest(t, scriptedUpstream(tt.statuses...))
+			p.upstream.retries = 2
+			p.upstream.backoff = time.Millisecond
+			seedLicense(t, "LIC-RETRY", "pro", time.Now().AddDate(0, 1, 0))
+			proxyKey := seedDevice(t, "LIC-RETRY", "hw-retry", nil)
+
+			retriesBefore := scrapeMetric(t, `licensify_proxy_retries_total{provider="openai"}`)
+			w := p.post(proxyKey, "openai", "/proxy/openai", `{}`)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if p.hits() != tt.hits {
+				t.Fatalf("upstream hits = %d, want %d", p.hits(), tt.hits)
+			}
+			if retries := scrapeMetric(t, `licensify_proxy_retries_total{provider="openai"}`) - retriesBefore; int(retries) != tt.hits-1 {
+				t.Fatalf("retries counted = %g, want %d", retries, tt.hits-1)
+			}
+		})
+	}
+}
+
+func TestProxyRetriesConnectionFailure(t *testing.T) {
+	p := newProxyTest(t, scriptedUpstream(http.StatusOK))
+	p.upstream.retries = 1
+	p.upstream.backoff = time.Millisecond
+	p.upstream.breaker = newCircuitBreaker(1, time.Hour)
+	seedLicense(t, "LIC-DIAL", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-DIAL", "hw-dial", nil)
+
+	// Nothing listens on a closed server's address
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	provider := *p.registry.Get("openai")
+	provider.BaseURL = dead.URL
+	p.registry = providers.NewRegistry()
+	if err := p.registry.Register(provider); err != nil {
+		t.Fatal(err)
+	}
+	p.build()
+
+	if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503: %s", w.Code, w.Body)
+	}
+	if _, ok := p.upstream.breaker.allow("openai"); ok {
+		t.Fatal("connection failures didn't count against the breaker")
+	}
+}
+
+func TestProxyCircuitBreaker(t *testing.T) {
+	var healthy atomic.Bool
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_, _ = w.Write([]byte(`{}`))
+	})
+	const cooldown = 100 * time.Millisecond
+	p.upstream.breaker = newCircuitBreaker(2, cooldown)
+	seedLicense(t, "LIC-BREAKER", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-BREAKER", "hw-breaker", nil)
+
+	// Two failed requests reach the provider and trip its breaker
+	for i := 0; i < 2; i++ {
+		if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusServiceUnavailable {
+			t.Fatalf("request %d: status = %d, want the upstream's 503", i+1, w.Code)
+		}
+	}
+	if open := scrapeMetric(t, `licensify_proxy_circuit_open{provider="openai"}`); open != 1 {
+		t.Fatalf("licensify_proxy_circuit_open = %g, want 1", open)
+	}
+
+	// While open, requests fail fast without reaching the provider
+	w := p.post(proxyKey, "openai", "/proxy/openai", `{}`)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("status = %d, Retry-After = %q; want 503 and 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	if p.hits() != 2 {
+		t.Fatalf("upstream hits = %d, want 2: the open breaker let a request through", p.hits())
+	}
+
+	// Other providers are unaffected
+	if w := p.post(proxyKey, "anthropic", "/proxy/anthropic", `{}`); w.Code != http.StatusServiceUnavailable || p.hits() != 3 {
+		t.Fatalf("anthropic: status = %d, hits = %d; want its request sent", w.Code, p.hits())
+	}
+
+	// After the cooldown one probe goes through, and its success closes
+	// the breaker
+	time.Sleep(cooldown + 20*time.Millisecond)
+	healthy.Store(true)
+	if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("probe: status = %d, want 200", w.Code)
+	}
+	if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("after recovery: status = %d, want 200", w.Code)
+	}
+	if open := scrapeMetric(t, `licensify_proxy_circuit_open{provider="openai"}`); open != 0 {
+		t.Fatalf("licensify_proxy_circuit_open = %g, want 0", open)
+	}
+}
+
+func TestCircuitBreakerProbe(t *testing.T) {
+	b := newCircuitBreaker(1, 50*time.Millisecond)
+	b.record("openai", true)
+	if _, ok := b.allow("openai"); ok {
+		t.Fatal("breaker didn't open at the threshold")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := b.allow("openai"); !ok {
+		t.Fatal("breaker didn't let a probe through after the cooldown")
+	}
+	// Only one probe is in flight at a time
+	if wait, ok := b.allow("openai"); ok || wait <= 0 {
+		t.Fatalf("second request during the probe: allowed = %v, wait = %v", ok, wait)
+	}
+	// A failed probe keeps it open for another cooldown
+	b.record("openai", true)
+	if _, ok := b.allow("openai"); ok {
+		t.Fatal("breaker closed after a failed probe")
+	}
+
+	if newCircuitBreaker(0, time.Minute) != nil {
+		t.Fatal("a threshold of 0 should disable the breaker")
+	}
+	var disabled *circuitBreaker
+	disabled.record("openai", true)
+	if _, ok := disabled.allow("openai"); !ok {
+		t.Fatal("a nil breaker refused a request")
+	}
+}
+
+func TestProxyUpstreamTimeout(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		// A provider that takes longer than any limit below
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	})
+	p.upstream.timeout = time.Minute
+	p.upstream.streamTimeout = 0
+	// anthropic has its own short limit; openai uses the long default
+	registry := providers.NewRegistry()
+	for _, name := range []string{"openai", "anthropic"} {
+		provider := *p.registry.Get(name)
+		if name == "anthropic" {
+			provider.Timeout = 50 * time.Millisecond
+		}
+		if err := registry.Register(provider); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.registry = registry
+	p.build()
+	seedLicense(t, "LIC-TIMEOUT", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-TIMEOUT", "hw-timeout", nil)
+
+	start := time.Now()
+	w := p.post(proxyKey, "anthropic", "/proxy/anthropic", `{}`)
+	if w.Code != http.StatusGatewayTimeout {
+		t.Fatalf("status = %d, want 504: %s", w.Code, w.Body)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Fatalf("timed out after %v, want close to the provider's 50ms", elapsed)
+	}
+
+	if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("openai: status = %d, want 200 within the default limit", w.Code)
+	}
+	// Streams ignore the buffered limit; PROXY_STREAM_TIMEOUT=0 means none
+	if w := p.post(proxyKey, "anthropic", "/proxy/anthropic", `{"stream":true}`); w.Code != http.StatusOK {
+		t.Fatalf("stream: status = %d, want 200 without a stream limit", w.Code)
+	}
+}
+
+func TestProxyTimeoutFor(t *testing.T) {
+	u := &proxyUpstream{timeout: time.Minute, streamTimeout: 10 * time.Minute}
+	tests := []struct {
+		name     string
+		provider time.Duration
+		stream   bool
+		want     time.Duration
+	}{
+		{"server default", 0, false, time.Minute},
+		{"provider override", 5 * time.Second, false, 5 * time.Second},
+		{"stream", 5 * time.Second, true, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := u.timeoutFor(&providers.Provider{Timeout: tt.provider}, tt.stream); got != tt.want {
+			t.Errorf("%s: timeoutFor = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestProviderTimeoutsConfig(t *testing.T) {
+	t.Setenv("PROXY_TIMEOUT", "45s")
+	t.Setenv("ANTHROPIC_TIMEOUT", "3m")
+	t.Setenv("PROXY_STREAM_TIMEOUT", "0")
+	t.Setenv("OPENAI_API_KEY", "sk-openai")
+	t.Setenv("ANTHROPIC_API_KEY", "sk-anthropic")
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if config.ProxyStreamTimeout != 0 {
+		t.Fatalf("PROXY_STREAM_TIMEOUT=0 gave %v, want no limit", config.ProxyStreamTimeout)
+	}
+	for name, want := range map[string]time.Duration{"openai": 45 * time.Second, "anthropic": 3 * time.Minute} {
+		if got := config.Providers.Get(name).Timeout; got != want {
+			t.Errorf("%s timeout = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestProxyRejectsProviderOutsideTier(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	seedLicense(t, "LIC-OPENAI", "openai-only", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-OPENAI", "hw-openai", nil)
+
+	forbiddenBefore := scrapeMetric(t, `licensify_proxy_requests_total{provider="anthropic",code="forbidden"}`)
+	w := p.post(proxyKey, "anthropic", "/proxy/anthropic", `{}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Error struct {
+			Message, Type, Code string
+		}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error.Code != "provider_not_allowed" || resp.Error.Type != "permission_denied" {
+		t.Fatalf("body = %s, %v; want a provider_not_allowed error", w.Body, err)
+	}
+	if p.hits() != 0 {
+		t.Fatal("a provider outside the tier was called")
+	}
+	if forbidden := scrapeMetric(t, `licensify_proxy_requests_total{provider="anthropic",code="forbidden"}`) - forbiddenBefore; forbidden != 1 {
+		t.Fatalf("forbidden requests counted = %g, want 1", forbidden)
+	}
+
+	// Refused requests don't use up the license's quota
+	var used int
+	if err := db.QueryRow(fmt.Sprintf(`SELECT COALESCE(SUM(count), 0) FROM daily_usage WHERE license_id = %s`, sqlPlaceholder(1)), "LIC-OPENAI").Scan(&used); err != nil {
+		t.Fatal(err)
+	}
+	if used != 0 {
+		t.Fatalf("usage = %d, want the refused request uncounted", used)
+	}
+
+	if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK || p.hits() != 1 {
+		t.Fatalf("openai: status = %d, hits = %d; want it sent", w.Code, p.hits())
+	}
+}
+
+// proxyAuditRows waits for the background audit writes of licenseID to reach
+// want rows and returns them as "provider status request_bytes response_bytes",
+// sorted since the writes race each other
+func proxyAuditRows(t *testing.T, licenseID string, want int) []string {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rows, err := db.Query(fmt.Sprintf(`SELECT hardware_id, provider, nonce, status_code, request_bytes, response_bytes
+			FROM proxy_requests WHERE license_id = %s ORDER BY id`, sqlPlaceholder(1)), licenseID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for rows.Next() {
+			var hardwareID, provider, nonce string
+			var status int
+			var requestBytes, responseBytes int64
+			if err := rows.Scan(&hardwareID, &provider, &nonce, &status, &requestBytes, &responseBytes); err != nil {
+				t.Fatal(err)
+			}
+			if hardwareID == "" || !strings.HasPrefix(nonce, "nonce-") {
+				t.Fatalf("audit row without hardware ID or nonce: %q %q", hardwareID, nonce)
+			}
+			got = append(got, fmt.Sprintf("%s %d %d %d", provider, status, requestBytes, responseBytes))
+		}
+		_ = rows.Close()
+		if len(got) >= want || time.Now().After(deadline) {
+			slices.Sort(got)
+			return got
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestProxyAuditRecordsRequests(t *testing.T) {
+	const response = `{"choices":[{"message":{"content":"hello"}}]}`
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/messages" {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{}`))
+			return
+		}
+		_, _ = w.Write([]byte(response))
+	})
+	p.auditRequests = true
+	p.build()
+	seedLicense(t, "LIC-AUDIT", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-AUDIT", "hw-audit", nil)
+
+	const body = `{"model":"gpt-4o","messages":[]}`
+	if w := p.post(proxyKey, "openai", "/proxy/openai", body); w.Code != http.StatusOK {
+		t.Fatalf("openai: status = %d", w.Code)
+	}
+	if w := p.post(proxyKey, "anthropic", "/proxy/anthropic", `{}`); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("anthropic: status = %d", w.Code)
+	}
+
+	want := []string{
+		"anthropic 429 2 2",
+		fmt.Sprintf("openai 200 %d %d", len(body), len(response)),
+	}
+	if got := proxyAuditRows(t, "LIC-AUDIT", len(want)); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("audit rows = %q, want %q", got, want)
+	}
+
+	// Without PROXY_AUDIT nothing is written
+	p.auditRequests = false
+	p.build()
+	if w := p.post(proxyKey, "openai", "/proxy/openai", body); w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := proxyAuditRows(t, "LIC-AUDIT", 0); len(got) != len(want) {
+		t.Fatalf("audit rows = %q, want none added with auditing off", got)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rotateKey asks handler to rotate proxyKey, signed the way the CLI signs it
+func rotateKey(handler http.HandlerFunc, proxyKey string) int {
+	req := ProxyKeyRotationRequest{ProxyKey: proxyKey, Timestamp: time.Now().Unix()}
+	h := hmac.New(sha256.New, []byte(proxyKey))
+	h.Write([]byte(fmt.Sprintf("%drotate", req.Timestamp)))
+	req.Signature = hex.EncodeToString(h.Sum(nil))
+	return postJSON(handler, "/proxy-key/rotate", req).Code
+}
+
+// currentProxyKey returns the proxy key stored for a device
+func currentProxyKey(t *testing.T, licenseID, hardwareID string) string {
+	t.Helper()
+	var proxyKey string
+	err := db.QueryRow(fmt.Sprintf(`SELECT proxy_key FROM proxy_keys WHERE license_id = %s AND hardware_id = %s`,
+		sqlPlaceholder(1), sqlPlaceholder(2)), licenseID, hardwareID).Scan(&proxyKey)
+	if err != nil {
+		t.Fatalf("load proxy key: %v", err)
+	}
+	return proxyKey
+}
+
+func TestProxyKeyExpiry(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	seedLicense(t, "LIC-TTL", "pro", time.Now().AddDate(0, 1, 0))
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	expired := seedDevice(t, "LIC-TTL", "hw-expired", &past)
+	live := seedDevice(t, "LIC-TTL", "hw-live", &future)
+	rotate := handleProxyKeyRotation(&Config{}, p.revocations)
+
+	if w := p.post(live, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("unexpired key: status = %d: %s", w.Code, w.Body)
+	}
+	before := p.hits()
+	if w := p.post(expired, "openai", "/proxy/openai", `{}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expired key: status = %d, want 401: %s", w.Code, w.Body)
+	}
+	if p.hits() != before {
+		t.Fatal("expired key reached the upstream")
+	}
+	if status := rotateKey(rotate, expired); status != http.StatusUnauthorized {
+		t.Fatalf("rotating an expired key: status = %d, want 401", status)
+	}
+}
+
+func TestProxyKeyRotationInvalidatesOldKey(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	seedLicense(t, "LIC-ROTATE", "pro", time.Now().AddDate(0, 1, 0))
+	oldKey := seedDevice(t, "LIC-ROTATE", "hw-rotate", nil)
+	rotate := handleProxyKeyRotation(&Config{}, p.revocations)
+
+	if status := rotateKey(rotate, oldKey); status != http.StatusOK {
+		t.Fatalf("rotation: status = %d", status)
+	}
+	newKey := currentProxyKey(t, "LIC-ROTATE", "hw-rotate")
+	if newKey == oldKey {
+		t.Fatal("rotation kept the old key")
+	}
+
+	if w := p.post(oldKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusUnauthorized {
+		t.Fatalf("old key after rotation: status = %d, want 401: %s", w.Code, w.Body)
+	}
+	if w := p.post(newKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("new key: status = %d: %s", w.Code, w.Body)
+	}
+	if status := rotateKey(rotate, oldKey); status != http.StatusUnauthorized {
+		t.Fatalf("rotating the old key again: status = %d, want 401", status)
+	}
+}
+
+func TestProxyKeyID(t *testing.T) {
+	a, err := generateProxyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := generateProxyKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proxyKeyID(a) != proxyKeyID(a) || proxyKeyID(a) == proxyKeyID(b) {
+		t.Fatal("proxyKeyID must be stable and differ between keys")
+	}
+	if strings.Contains(a, proxyKeyID(a)[:6]) || strings.HasPrefix(proxyKeyID(a), "px_") {
+		t.Fatalf("proxyKeyID %q reveals part of the key", proxyKeyID(a))
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// useIPLimiters replaces the per-IP limiters for the duration of the test
+func useIPLimiters(t *testing.T, limit rate.Limit, burst int) {
+	t.Helper()
+	previous := ipLimiters
+	ipLimiters = newKeyedLimiters(limit, burst)
+	t.Cleanup(func() { ipLimiters = previous })
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	useIPLimiters(t, rate.Limit(0.001), 2)
+	calls := 0
+	handler := rateLimitMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/activate", nil)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("203.0.113.7:4000"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: status = %d", i+1, w.Code)
+		}
+	}
+	w := request("203.0.113.7:4001")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusTooManyRequests)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("Retry-After = %q, want 1", w.Header().Get("Retry-After"))
+	}
+	var resp ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.Error == "" {
+		t.Fatalf("rejection isn't a JSON error: %s", w.Body)
+	}
+	if calls != 2 {
+		t.Fatalf("handler ran %d times, want 2", calls)
+	}
+
+	// Another client has its own budget
+	if w := request("198.51.100.9:4000"); w.Code != http.StatusOK {
+		t.Fatalf("another IP: status = %d", w.Code)
+	}
+}
+
+func TestKeyedLimitersPerKey(t *testing.T) {
+	limiters := newKeyedLimiters(rate.Limit(0.001), 2)
+	for i := 0; i < 2; i++ {
+		if !limiters.allow("LIC-ONE") {
+			t.Fatalf("request %d within the burst was refused", i+1)
+		}
+	}
+	if limiters.allow("LIC-ONE") {
+		t.Fatal("request past the burst was allowed")
+	}
+	if !limiters.allow("LIC-TWO") {
+		t.Fatal("another key shared the exhausted budget")
+	}
+
+	var disabled *keyedLimiters
+	if !disabled.allow("LIC-ONE") {
+		t.Fatal("nil limiters refused a request")
+	}
+}
+
+func TestProxyLicenseRateLimitSharedByDevices(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	previous := licenseLimiters
+	licenseLimiters = newKeyedLimiters(rate.Limit(0.001), 2)
+	t.Cleanup(func() { licenseLimiters = previous })
+
+	seedLicense(t, "LIC-SHARED", "pro", time.Now().AddDate(0, 1, 0))
+	laptop := seedDevice(t, "LIC-SHARED", "hw-laptop", nil)
+	desktop := seedDevice(t, "LIC-SHARED", "hw-desktop", nil)
+	seedLicense(t, "LIC-OTHER", "pro", time.Now().AddDate(0, 1, 0))
+	other := seedDevice(t, "LIC-OTHER", "hw-other", nil)
+
+	for i, proxyKey := range []string{laptop, desktop} {
+		if w := p.post(proxyKey, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+			t.Fatalf("device %d: status = %d: %s", i+1, w.Code, w.Body)
+		}
+	}
+	w := p.post(laptop, "openai", "/proxy/openai", `{}`)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("third request on the license: status = %d, Retry-After = %q", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := p.post(other, "openai", "/proxy/openai", `{}`); w.Code != http.StatusOK {
+		t.Fatalf("another license: status = %d: %s", w.Code, w.Body)
+	}
+}
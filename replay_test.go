@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// signedProxyRequest returns a proxy request signed the way clients sign it,
+// and the HTTP request it arrives in
+func signedProxyRequest(proxyKey, path, nonce, body string, timestamp int64) (*http.Request, *ProxyRequest) {
+	req := &ProxyRequest{
+		ProxyKey:  proxyKey,
+		Provider:  "openai",
+		Body:      json.RawMessage(body),
+		Timestamp: timestamp,
+		Nonce:     nonce,
+	}
+	h := hmac.New(sha256.New, []byte(proxyKey))
+	h.Write([]byte(proxySignatureMessage(timestamp, http.MethodPost, path, req.Provider, nonce, req.Body)))
+	req.Signature = hex.EncodeToString(h.Sum(nil))
+	return httptest.NewRequest(http.MethodPost, path, nil), req
+}
+
+// signLegacy re-signs req with the older timestamp + provider + body message
+func signLegacy(req *ProxyRequest) {
+	h := hmac.New(sha256.New, []byte(req.ProxyKey))
+	h.Write([]byte(fmt.Sprintf("%d%s%s", req.Timestamp, req.Provider, req.Body)))
+	req.Signature = hex.EncodeToString(h.Sum(nil))
+}
+
+func TestProxySignatureMessageMatchesCLI(t *testing.T) {
+	// The inputs and signature from TestSignProxyRequestMatchesServer in
+	// cmd/licensify-cli/proxy_test.go, so the CLI and the server can't
+	// drift apart on the message format
+	const (
+		proxyKey  = "px_0racle0racle0racle0racle0racle0racle0racle0"
+		path      = "/proxy/openai/v1/chat/completions"
+		nonce     = "0123456789abcdef0123456789abcdef"
+		body      = `{"messages":[{"content":"<a & b>"}]}`
+		timestamp = 1767225600
+		signature = "5af56a148c5bd96b5f07c92844c929d3ba6ca4af2c77ea7d1520df589b540f22"
+	)
+	_, req := signedProxyRequest(proxyKey, path, nonce, body, timestamp)
+	if req.Signature != signature {
+		t.Fatalf("signature = %s, want the CLI's %s", req.Signature, signature)
+	}
+}
+
+func TestProxySignatureRejectsReplays(t *testing.T) {
+	const path = "/proxy/openai/v1/chat/completions"
+	now := time.Now().Unix()
+
+	tests := []struct {
+		name   string
+		legacy bool
+		first  func() (*http.Request, *ProxyRequest)
+		second func() (*http.Request, *ProxyRequest)
+		want   error
+	}{
+		{
+			name: "same request twice",
+			first: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			want: ErrReplayedRequest,
+		},
+		{
+			name: "nonce reused with another body and timestamp",
+			first: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{"model":"gpt-4"}`, now+1)
+			},
+			want: ErrReplayedRequest,
+		},
+		{
+			name: "nonce reused with another proxy key",
+			first: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_b", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			want: nil,
+		},
+		{
+			name: "fresh nonce",
+			first: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-fedcba9876543210", `{}`, now)
+			},
+			want: nil,
+		},
+		{
+			name:   "signature without nonce reused",
+			first:  func() (*http.Request, *ProxyRequest) { return signedProxyRequest("px_a", path, "", `{}`, now) },
+			second: func() (*http.Request, *ProxyRequest) { return signedProxyRequest("px_a", path, "", `{}`, now) },
+			want:   ErrReplayedRequest,
+		},
+		{
+			name: "signature replayed to another endpoint",
+			first: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				_, req := signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+				return httptest.NewRequest(http.MethodPost, "/proxy/openai/v1/embeddings", nil), req
+			},
+			want: ErrInvalidSignature,
+		},
+		{
+			name:   "legacy signature reused",
+			legacy: true,
+			first: func() (*http.Request, *ProxyRequest) {
+				r, req := signedProxyRequest("px_a", path, "", `{}`, now)
+				signLegacy(req)
+				return r, req
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				r, req := signedProxyRequest("px_a", path, "", `{}`, now)
+				signLegacy(req)
+				return r, req
+			},
+			want: ErrReplayedRequest,
+		},
+		{
+			name: "malformed nonce",
+			first: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "short", `{}`, now)
+			},
+			want: ErrInvalidNonce,
+		},
+		{
+			name: "replay outside the window",
+			first: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now)
+			},
+			second: func() (*http.Request, *ProxyRequest) {
+				return signedProxyRequest("px_a", path, "nonce-0123456789abcdef", `{}`, now-maxSignatureSkew-60)
+			},
+			want: ErrTimestampOutOfWindow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &proxySignatures{replays: newReplayCache(maxReplayEntries, maxReplayEntriesPerKey), legacy: tt.legacy}
+			if err := s.validateProxySignature(tt.first()); err != nil {
+				t.Fatalf("first request: %v", err)
+			}
+			err := s.validateProxySignature(tt.second())
+			if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+				t.Fatalf("second request: error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayCacheFull(t *testing.T) {
+	cache := newReplayCache(2, 2)
+	now := time.Now()
+
+	if err := cache.firstUse("px_a", "a", now.Add(time.Minute)); err != nil {
+		t.Fatalf("first entry: %v", err)
+	}
+	if err := cache.firstUse("px_b", "b", now.Add(-time.Second)); err != nil {
+		t.Fatalf("second entry: %v", err)
+	}
+	// "b" has expired, so it makes room
+	if err := cache.firstUse("px_c", "c", now.Add(time.Minute)); err != nil {
+		t.Fatalf("entry after an expired one: %v", err)
+	}
+	if err := cache.firstUse("px_d", "d", now.Add(time.Minute)); !errors.Is(err, ErrReplayCacheFull) {
+		t.Fatalf("entry in a full cache: error = %v, want ErrReplayCacheFull", err)
+	}
+	if err := cache.firstUse("px_a", "a", now.Add(time.Minute)); !errors.Is(err, ErrReplayedRequest) {
+		t.Fatalf("replay in a full cache: error = %v, want ErrReplayedRequest", err)
+	}
+}
+
+func TestReplayCacheLimitsEachProxyKey(t *testing.T) {
+	cache := newReplayCache(10, 2)
+	now := time.Now()
+
+	if err := cache.firstUse("px_busy", "a", now.Add(time.Minute)); err != nil {
+		t.Fatalf("first entry: %v", err)
+	}
+	if err := cache.firstUse("px_busy", "b", now.Add(-time.Second)); err != nil {
+		t.Fatalf("second entry: %v", err)
+	}
+	// "b" has expired, so it makes room for the same key
+	if err := cache.firstUse("px_busy", "c", now.Add(time.Minute)); err != nil {
+		t.Fatalf("entry after an expired one: %v", err)
+	}
+	if err := cache.firstUse("px_busy", "d", now.Add(time.Minute)); !errors.Is(err, ErrReplayKeyLimit) {
+		t.Fatalf("entry over the key's share: error = %v, want ErrReplayKeyLimit", err)
+	}
+	if err := cache.firstUse("px_quiet", "d", now.Add(time.Minute)); err != nil {
+		t.Fatalf("other key blocked by a busy one: %v", err)
+	}
+	if cache.size != 3 {
+		t.Fatalf("size = %d, want 3", cache.size)
+	}
+}
+
+func TestReplayCacheForgetsExpiredEntries(t *testing.T) {
+	cache := newReplayCache(10, 10)
+	expires := time.Now().Add(50 * time.Millisecond)
+
+	if err := cache.firstUse("px_a", "nonce:n1", expires); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := cache.firstUse("px_a", "nonce:n1", expires); !errors.Is(err, ErrReplayedRequest) {
+		t.Fatalf("inside the window: error = %v, want ErrReplayedRequest", err)
+	}
+	// Each proxy key has its own nonces
+	if err := cache.firstUse("px_b", "nonce:n1", expires); err != nil {
+		t.Fatalf("same nonce for another key: %v", err)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	// Once the timestamp is outside the window the signature check refuses
+	// the request, so the nonce may be accepted again
+	if err := cache.firstUse("px_a", "nonce:n1", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("after the window: %v", err)
+	}
+	if cache.size != 2 {
+		t.Fatalf("size = %d, want the reused entry counted once", cache.size)
+	}
+	cache.cleanup()
+	if cache.size != 1 || cache.seen["px_b"] != nil {
+		t.Fatalf("after cleanup: size = %d, keys %v; want only px_a's live entry", cache.size, cache.seen)
+	}
+}
+
+func TestProxyRejectsReplayedNonce(t *testing.T) {
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{}`))
+	})
+	seedLicense(t, "LIC-NONCE", "pro", time.Now().AddDate(0, 1, 0))
+	first := seedDevice(t, "LIC-NONCE", "hw-nonce-1", nil)
+	second := seedDevice(t, "LIC-NONCE", "hw-nonce-2", nil)
+
+	send := func(proxyKey string) *httptest.ResponseRecorder {
+		const path = "/proxy/openai"
+		_, req := signedProxyRequest(proxyKey, path, "nonce-0123456789abcdef", `{}`, time.Now().Unix())
+		encoded, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		p.handler(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded)))
+		return w
+	}
+
+	if w := send(first); w.Code != http.StatusOK {
+		t.Fatalf("first use: status = %d: %s", w.Code, w.Body)
+	}
+	w := send(first)
+	var resp ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if w.Code != http.StatusUnauthorized || resp.Code != "replayed_request" {
+		t.Fatalf("replay: status = %d, code %q; want 401 replayed_request", w.Code, resp.Code)
+	}
+	if p.hits() != 1 {
+		t.Fatalf("upstream hits = %d, want the replay stopped before the provider", p.hits())
+	}
+	// Another device choosing the same nonce isn't a replay
+	if w := send(second); w.Code != http.StatusOK {
+		t.Fatalf("same nonce on another key: status = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestSendSignatureErrorStatus(t *testing.T) {
+	tests := []struct {
+		err        error
+		status     int
+		code       string
+		retryAfter bool
+	}{
+		{ErrInvalidSignature, http.StatusUnauthorized, "invalid_signature", false},
+		{ErrReplayedRequest, http.StatusUnauthorized, "replayed_request", false},
+		{ErrReplayCacheFull, http.StatusServiceUnavailable, "replay_cache_full", true},
+		{ErrReplayKeyLimit, http.StatusTooManyRequests, "too_many_signed_requests", true},
+		{ErrInvalidNonce, http.StatusBadRequest, "invalid_nonce", false},
+		{fmt.Errorf("%w (client clock off by +400s)", ErrTimestampOutOfWindow), http.StatusUnauthorized, "timestamp_out_of_window", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			sendSignatureError(w, tt.err)
+
+			var resp ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+			if w.Code != tt.status || resp.Code != tt.code {
+				t.Fatalf("got %d %q, want %d %q", w.Code, resp.Code, tt.status, tt.code)
+			}
+			if got := w.Header().Get("Retry-After") != ""; got != tt.retryAfter {
+				t.Fatalf("Retry-After set: %v, want %v", got, tt.retryAfter)
+			}
+		})
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/melihbirim/licensify/internal/database"
+	"github.com/melihbirim/licensify/internal/email"
+)
+
+// postJSON sends body to handler and returns the recorded response
+func postJSON(handler http.HandlerFunc, path string, body interface{}) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded)))
+	return w
+}
+
+func TestFreeTiers(t *testing.T) {
+	useTestTiers(t)
+
+	free := freeTiers("basic")
+	for _, tier := range []string{"basic", "basic-legacy", legacyFreeTier} {
+		if !slices.Contains(free, tier) {
+			t.Errorf("freeTiers(basic) = %v, missing %s", free, tier)
+		}
+	}
+	if slices.Contains(free, "pro") {
+		t.Errorf("freeTiers(basic) = %v, includes pro", free)
+	}
+}
+
+func TestSelfServiceLimitsComeFromTierConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		defaultTier string
+		handler     func(config *Config) http.HandlerFunc
+		body        interface{}
+		daily       int
+		monthly     int
+		devices     int
+	}{
+		{
+			name:        "verify on basic",
+			defaultTier: "basic",
+			handler:     func(config *Config) http.HandlerFunc { return handleVerify(nil, false, config) },
+			body:        VerifyRequest{Email: "basic@example.com"},
+			daily:       100, monthly: 1000, devices: 2,
+		},
+		{
+			name:        "verify on pro",
+			defaultTier: "pro",
+			handler:     func(config *Config) http.HandlerFunc { return handleVerify(nil, false, config) },
+			body:        VerifyRequest{Email: "pro@example.com"},
+			daily:       -1, monthly: -1, devices: 5,
+		},
+		{
+			name:        "trial on basic",
+			defaultTier: "basic",
+			handler:     handleTrial,
+			body:        TrialRequest{HardwareID: "hw-trial-0001"},
+			daily:       100, monthly: 1000, devices: 1, // trials are bound to one device
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			useTestTiers(t)
+			config := &Config{DefaultTier: tt.defaultTier, FreeLicenseDays: 30, TrialDays: 7}
+
+			w := postJSON(tt.handler(config), "/", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp struct {
+				LicenseKey   string `json:"license_key"`
+				Tier         string `json:"tier"`
+				DailyLimit   int    `json:"daily_limit"`
+				MonthlyLimit int    `json:"monthly_limit"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response isn't JSON: %v", err)
+			}
+			if resp.Tier != tt.defaultTier || resp.DailyLimit != tt.daily || resp.MonthlyLimit != tt.monthly {
+				t.Fatalf("response = %+v, want tier %s with limits %d/%d", resp, tt.defaultTier, tt.daily, tt.monthly)
+			}
+
+			license, err := store.GetLicense(resp.LicenseKey)
+			if err != nil {
+				t.Fatalf("GetLicense: %v", err)
+			}
+			if license.Tier != tt.defaultTier || license.DailyLimit != tt.daily || license.MonthlyLimit != tt.monthly || license.MaxActivations != tt.devices {
+				t.Fatalf("stored license = %+v, want tier %s with limits %d/%d and %d devices",
+					license, tt.defaultTier, tt.daily, tt.monthly, tt.devices)
+			}
+		})
+	}
+}
+
+func TestTrialRefusedWhenDeviceHasFreeLicense(t *testing.T) {
+	tests := []struct {
+		tier   string
+		status int
+	}{
+		{"basic", http.StatusForbidden},
+		{"basic-legacy", http.StatusForbidden},
+		{legacyFreeTier, http.StatusForbidden},
+		{"pro", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tier, func(t *testing.T) {
+			openTestDB(t)
+			useTestTiers(t)
+			const hardwareID = "hw-existing-0001"
+			insertLicense(t, "LIC-EXISTING", tt.tier, time.Now().AddDate(0, 1, 0), 10, 100, 1)
+			if err := recordActivation(t.Context(), "LIC-EXISTING", hardwareID); err != nil {
+				t.Fatalf("recordActivation: %v", err)
+			}
+
+			w := postJSON(handleTrial(&Config{DefaultTier: "basic", TrialDays: 7}), "/trial", TrialRequest{HardwareID: hardwareID})
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+		})
+	}
+}
+
+// recordingTransport is an email.Transport that keeps the text of each
+// email instead of sending it
+type recordingTransport struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (r *recordingTransport) Send(to, subject, html, text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.texts = append(r.texts, text)
+	return nil
+}
+
+func (r *recordingTransport) sent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.texts...)
+}
+
+// ageVerificationCode moves the pending code for address back by age,
+// as if it had been sent that long ago
+func ageVerificationCode(t *testing.T, address string, age time.Duration) {
+	t.Helper()
+	_, err := db.Exec(fmt.Sprintf(`UPDATE verification_codes SET created_at = %s WHERE email = %s`, sqlPlaceholder(1), sqlPlaceholder(2)),
+		time.Now().Add(-age).UTC().Format(time.RFC3339), address)
+	if err != nil {
+		t.Fatalf("age verification code: %v", err)
+	}
+}
+
+func TestResendCooldown(t *testing.T) {
+	const address = "resend@example.com"
+	cooldown := time.Minute
+
+	tests := []struct {
+		name       string
+		age        time.Duration
+		status     int
+		retryAfter int
+	}{
+		{"just sent", 0, http.StatusTooManyRequests, 60},
+		{"inside the cooldown", cooldown - 10*time.Second, http.StatusTooManyRequests, 10},
+		{"cooldown over", cooldown + time.Second, http.StatusOK, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			openTestDB(t)
+			transport := &recordingTransport{}
+			if err := store.SaveVerificationCode(address, "123456", time.Now().Add(verificationCodeTTL)); err != nil {
+				t.Fatal(err)
+			}
+			ageVerificationCode(t, address, tt.age)
+
+			w := postJSON(handleResend(email.NewClient(transport), true, cooldown), "/resend", ResendRequest{Email: address})
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.status == http.StatusTooManyRequests {
+				// created_at has second resolution, so allow the clock to tick
+				if got, _ := strconv.Atoi(w.Header().Get("Retry-After")); got < tt.retryAfter-1 || got > tt.retryAfter {
+					t.Fatalf("Retry-After = %d, want %d", got, tt.retryAfter)
+				}
+				if !strings.Contains(w.Body.String(), "seconds") || len(transport.sent()) != 0 {
+					t.Fatalf("refused resend: body %s, %d email(s) sent", w.Body, len(transport.sent()))
+				}
+				return
+			}
+
+			// A valid code is resent unchanged and the cooldown restarts
+			sent := transport.sent()
+			if len(sent) != 1 || !strings.Contains(sent[0], "123456") {
+				t.Fatalf("sent %q, want the pending code", sent)
+			}
+			if w := postJSON(handleResend(email.NewClient(transport), true, cooldown), "/resend", ResendRequest{Email: address}); w.Code != http.StatusTooManyRequests {
+				t.Fatalf("immediate second resend: status = %d, want 429", w.Code)
+			}
+		})
+	}
+}
+
+func TestResendRegeneratesExpiredCode(t *testing.T) {
+	openTestDB(t)
+	const address = "expired@example.com"
+	transport := &recordingTransport{}
+	if err := store.SaveVerificationCode(address, "123456", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	ageVerificationCode(t, address, verificationCodeTTL)
+
+	w := postJSON(handleResend(email.NewClient(transport), true, time.Minute), "/resend", ResendRequest{Email: address})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	pending, err := store.GetVerificationCode(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Code == "123456" || !pending.ExpiresAt.After(time.Now()) {
+		t.Fatalf("pending code = %s expiring %v, want a new unexpired code", pending.Code, pending.ExpiresAt)
+	}
+	if sent := transport.sent(); len(sent) != 1 || !strings.Contains(sent[0], pending.Code) {
+		t.Fatalf("sent %q, want the new code %s", sent, pending.Code)
+	}
+
+	if w := postJSON(handleResend(email.NewClient(transport), true, time.Minute), "/resend", ResendRequest{Email: "nobody@example.com"}); w.Code != http.StatusNotFound {
+		t.Fatalf("no pending code: status = %d, want 404", w.Code)
+	}
+}
+
+func TestFreeLicenseDays(t *testing.T) {
+	for _, days := range []int{1, 30, 365} {
+		t.Run(strconv.Itoa(days), func(t *testing.T) {
+			openTestDB(t)
+			useTestTiers(t)
+			config := &Config{DefaultTier: "basic", FreeLicenseDays: days}
+
+			before := time.Now()
+			w := postJSON(handleVerify(nil, false, config), "/verify", VerifyRequest{Email: "days@example.com"})
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var resp VerifyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || resp.ExpiresAt == nil {
+				t.Fatalf("response = %s, %v; want expires_at", w.Body, err)
+			}
+			want := before.AddDate(0, 0, days)
+			if diff := resp.ExpiresAt.Sub(want); diff < -time.Second || diff > 5*time.Second {
+				t.Fatalf("expires_at = %v, want %d days from now (%v)", resp.ExpiresAt, days, want)
+			}
+
+			license, err := store.GetLicense(resp.LicenseKey)
+			if err != nil {
+				t.Fatalf("GetLicense: %v", err)
+			}
+			if diff := license.ExpiresAt.Sub(*resp.ExpiresAt); diff < -time.Second || diff > time.Second {
+				t.Fatalf("stored expires_at = %v, response said %v", license.ExpiresAt, resp.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestFreeLicenseDaysConfig(t *testing.T) {
+	for value, want := range map[string]int{"": 30, "14": 14} {
+		t.Setenv("FREE_LICENSE_DAYS", value)
+		config, err := loadConfig()
+		if err != nil {
+			t.Fatalf("FREE_LICENSE_DAYS=%q: %v", value, err)
+		}
+		if config.FreeLicenseDays != want {
+			t.Fatalf("FREE_LICENSE_DAYS=%q gave %d days, want %d", value, config.FreeLicenseDays, want)
+		}
+	}
+
+	for _, bad := range []string{"0", "-5", "two weeks"} {
+		t.Setenv("FREE_LICENSE_DAYS", bad)
+		if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), "FREE_LICENSE_DAYS") {
+			t.Errorf("FREE_LICENSE_DAYS=%q: error = %v, want it rejected", bad, err)
+		}
+	}
+}
+
+func TestExistingLicenseFor(t *testing.T) {
+	useTestTiers(t)
+	now := time.Now()
+	license := func(id, tier string, active bool, expiresAt time.Time) database.License {
+		return database.License{LicenseID: id, Tier: tier, Active: active, ExpiresAt: expiresAt}
+	}
+	paid := license("LIC-PRO", "pro", true, now.AddDate(1, 0, 0))
+	free := license("LIC-BASIC", "basic", true, now.AddDate(0, 1, 0))
+	expiredFree := license("LIC-BASIC-OLD", "basic", true, now.AddDate(0, -1, 0))
+	revokedFree := license("LIC-BASIC-OFF", "basic", false, now.AddDate(0, 1, 0))
+
+	tests := []struct {
+		name     string
+		multiple bool
+		licenses []database.License // newest first, as GetLicensesByEmail returns them
+		want     string             // empty when a new free license should be issued
+	}{
+		{"no licenses", false, nil, ""},
+		{"paid customer re-verifying", false, []database.License{paid}, "LIC-PRO"},
+		{"usable license preferred over newer unusable ones", false, []database.License{expiredFree, revokedFree, paid}, "LIC-PRO"},
+		{"newest returned when none is usable", false, []database.License{expiredFree, revokedFree}, "LIC-BASIC-OLD"},
+		{"multiple: paid customer gets a free license", true, []database.License{paid}, ""},
+		{"multiple: existing free license reused", true, []database.License{paid, free}, "LIC-BASIC"},
+		{"multiple: legacy free tiers count as free", true, []database.License{license("LIC-LEGACY", "basic-legacy", true, now.AddDate(0, 1, 0))}, "LIC-LEGACY"},
+		{"multiple: expired free license still blocks another", true, []database.License{paid, expiredFree}, "LIC-BASIC-OLD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{DefaultTier: "basic", MultipleLicensesPerEmail: tt.multiple}
+			var got string
+			if existing := existingLicenseFor(tt.licenses, config); existing != nil {
+				got = existing.LicenseID
+			}
+			if got != tt.want {
+				t.Fatalf("existingLicenseFor = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyReturnsExistingLicense(t *testing.T) {
+	verify := func(t *testing.T, config *Config) VerifyResponse {
+		t.Helper()
+		// Addresses match regardless of case
+		w := postJSON(handleVerify(nil, false, config), "/verify", VerifyRequest{Email: "Test@Example.com"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body)
+		}
+		var resp VerifyResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	expiresAt := time.Now().AddDate(1, 0, 0).Truncate(time.Second)
+
+	t.Run("one license per email", func(t *testing.T) {
+		openTestDB(t)
+		useTestTiers(t)
+		seedLicense(t, "LIC-PAID", "pro", expiresAt)
+
+		resp := verify(t, &Config{DefaultTier: "basic", FreeLicenseDays: 30})
+		if resp.LicenseKey != "LIC-PAID" || resp.Tier != "pro" || resp.DailyLimit != -1 || resp.MonthlyLimit != -1 {
+			t.Fatalf("response = %+v, want the paid license's real details", resp)
+		}
+		if resp.ExpiresAt == nil || !resp.ExpiresAt.Equal(expiresAt) {
+			t.Fatalf("expires_at = %v, want %v", resp.ExpiresAt, expiresAt)
+		}
+	})
+
+	t.Run("several licenses per email", func(t *testing.T) {
+		openTestDB(t)
+		useTestTiers(t)
+		seedLicense(t, "LIC-PAID", "pro", expiresAt)
+		config := &Config{DefaultTier: "basic", FreeLicenseDays: 30, MultipleLicensesPerEmail: true}
+
+		first := verify(t, config)
+		if first.LicenseKey == "LIC-PAID" || first.Tier != "basic" {
+			t.Fatalf("first verify = %+v, want a new basic license", first)
+		}
+		// Verifying again returns that free license rather than adding one
+		if again := verify(t, config); again.LicenseKey != first.LicenseKey {
+			t.Fatalf("second verify = %s, want %s again", again.LicenseKey, first.LicenseKey)
+		}
+		licenses, err := store.GetLicensesByEmail("test@example.com")
+		if err != nil || len(licenses) != 2 {
+			t.Fatalf("licenses for the email = %d, %v, want the paid one and one free one", len(licenses), err)
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTokenCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream bool
+		body   string
+		want   int64
+	}{
+		{"openai", false, `{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":30,"total_tokens":42}}`, 42},
+		{"anthropic", false, `{"content":[],"usage":{"input_tokens":25,"output_tokens":17}}`, 42},
+		{"no usage", false, `{"choices":[]}`, 0},
+		{"openai stream", true, "data: {\"choices\":[]}\n\n" +
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":12,\"completion_tokens\":30,\"total_tokens\":42}}\n\n" +
+			"data: [DONE]\n\n", 42},
+		// Anthropic reports input tokens in message_start and cumulative
+		// output tokens in each message_delta
+		{"anthropic stream", true, "event: message_start\n" +
+			"data: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":25,\"output_tokens\":1}}}\n\n" +
+			"event: message_delta\n" +
+			"data: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":9}}\n\n" +
+			"event: message_delta\n" +
+			"data: {\"type\":\"message_delta\",\"usage\":{\"output_tokens\":17}}\n\n" +
+			"event: message_stop\n" +
+			"data: {\"type\":\"message_stop\"}", 42},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Write a few bytes at a time so events span writes
+			counter := &tokenCounter{stream: tt.stream}
+			for body := tt.body; body != ""; {
+				n := min(7, len(body))
+				_, _ = counter.Write([]byte(body[:n]))
+				body = body[n:]
+			}
+			if got := counter.tokens(); got != tt.want {
+				t.Fatalf("tokens = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyRecordsTokenUsage(t *testing.T) {
+	responses := map[string]string{
+		"/v1/chat/completions": `{"usage":{"prompt_tokens":10,"completion_tokens":20,"total_tokens":30}}`,
+		"/v1/messages":         `{"usage":{"input_tokens":5,"output_tokens":7}}`,
+	}
+	p := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(responses[r.URL.Path]))
+	})
+	p.countTokens = true
+	p.build()
+	seedLicense(t, "LIC-TOKENS", "pro", time.Now().AddDate(0, 1, 0))
+	proxyKey := seedDevice(t, "LIC-TOKENS", "hw-tokens", nil)
+
+	for _, provider := range []string{"openai", "anthropic"} {
+		if w := p.post(proxyKey, provider, "/proxy/"+provider, `{}`); w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", provider, w.Code, w.Body)
+		}
+	}
+
+	daily, monthly, err := store.GetTokenUsage("LIC-TOKENS", time.Now().Format("2006-01-02"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if daily != 42 || monthly != 42 {
+		t.Fatalf("token usage = %d daily, %d monthly, want 42 for both", daily, monthly)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestUsageBatchDateBounds(t *testing.T) {
+	openTestDB(t)
+	useTestTiers(t)
+	seedLicense(t, "LIC-BATCH", "pro", time.Now().AddDate(0, 1, 0))
+	handler := handleUsageBatch(nil)
+	today := time.Now().UTC()
+	day := func(offset int) string { return today.AddDate(0, 0, offset).Format("2006-01-02") }
+
+	tests := []struct {
+		name   string
+		dates  []string
+		status int
+	}{
+		{"today", []string{day(0)}, http.StatusOK},
+		{"oldest allowed", []string{day(-usageBatchMaxAge)}, http.StatusOK},
+		{"tomorrow", []string{day(1)}, http.StatusOK},
+		{"too old", []string{day(0), day(-usageBatchMaxAge - 1)}, http.StatusBadRequest},
+		{"too far ahead", []string{day(0), day(2)}, http.StatusBadRequest},
+		{"years ago", []string{"2001-01-01"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := totalScans(t, "LIC-BATCH")
+			req := UsageBatchReport{LicenseKey: "LIC-BATCH"}
+			for _, date := range tt.dates {
+				req.Entries = append(req.Entries, UsageBatchEntry{Date: date, HardwareID: "hw-batch", Scans: 1})
+			}
+			w := postJSON(handler, "/usage/batch", req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			want := before
+			if tt.status == http.StatusOK {
+				want += len(tt.dates)
+			}
+			if got := totalScans(t, "LIC-BATCH"); got != want {
+				t.Fatalf("recorded scans = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+// totalScans returns every scan recorded for licenseID
+func totalScans(t *testing.T, licenseID string) int {
+	t.Helper()
+	var total int
+	if err := db.QueryRow(`SELECT COALESCE(SUM(scans), 0) FROM daily_usage WHERE license_id = `+sqlPlaceholder(1), licenseID).Scan(&total); err != nil {
+		t.Fatal(err)
+	}
+	return total
+}